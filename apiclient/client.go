@@ -0,0 +1,358 @@
+// Package apiclient is a Go client for the destination API, the endpoints one
+// DockerApp instance calls on another to replicate containers, volumes and
+// networks to it. The endpoints and their bodies are described by the OpenAPI
+// document in openapi.json, which every instance also serves at
+// /api/openapi.json. Tests check that every destination endpoint there has a
+// Client method and that the body types here encode to its schemas.
+package apiclient
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// APIVersion is the destination API version this client speaks. An instance
+// lists the versions it serves in the apiVersions field of its About.
+const APIVersion = "v1"
+
+// OpenAPI is the OpenAPI 3 document describing the destination and job APIs.
+//
+//go:embed openapi.json
+var OpenAPI []byte
+
+// Client calls the destination API of one DockerApp instance.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+// New returns a client for the instance at baseURL, e.g.
+// http://10.0.0.6:8080. A nil httpClient uses http.DefaultClient; pass one
+// whose transport adds the bearer token when the instance sets API_TOKEN.
+func New(baseURL string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{baseURL: strings.TrimRight(baseURL, "/"), httpClient: httpClient}
+}
+
+// Error is a non-200 response from the instance. Message holds the problem's
+// detail, or the start of the body from instances that answer errors in plain
+// text. Code is the problem's machine-readable code, such as policy_denied or
+// image_pull_failed, and empty for plain text errors.
+type Error struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("HTTP %d: %s", e.StatusCode, e.Message)
+}
+
+// Problem is an RFC 7807 problem+json error response, with which instances
+// answer failed API requests.
+type Problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	Code      string `json:"code"`
+	RequestID string `json:"requestId,omitempty"`
+}
+
+// ReadError reads a failed response into an Error, from its problem+json
+// body or, for older instances, its plain text one.
+func ReadError(resp *http.Response) *Error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	e := &Error{StatusCode: resp.StatusCode}
+	var p Problem
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/problem+json") && json.Unmarshal(body, &p) == nil {
+		e.Code, e.Message = p.Code, p.Detail
+		if e.Message == "" {
+			e.Message = p.Title
+		}
+		return e
+	}
+	if len(body) > 512 {
+		body = body[:512]
+	}
+	e.Message = strings.TrimSpace(string(body))
+	return e
+}
+
+// PullImage pulls an image on the instance.
+func (c *Client) PullImage(ctx context.Context, req PullImageRequest) error {
+	return c.post(ctx, "/api/v1/pull-image", req, nil)
+}
+
+// CreateNetwork creates a network, or reuses an existing one of the same name.
+func (c *Client) CreateNetwork(ctx context.Context, req CreateNetworkRequest) (*CreateNetworkResponse, error) {
+	var resp CreateNetworkResponse
+	if err := c.post(ctx, "/api/v1/create-network", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// CreateVolume creates a volume.
+func (c *Client) CreateVolume(ctx context.Context, req CreateVolumeRequest) (*CreateVolumeResponse, error) {
+	var resp CreateVolumeResponse
+	if err := c.post(ctx, "/api/v1/create-volume", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// CreateContainer creates a container and applies its start policy.
+func (c *Client) CreateContainer(ctx context.Context, req CreateContainerRequest) (*CreateContainerResponse, error) {
+	var resp CreateContainerResponse
+	if err := c.post(ctx, "/api/v1/create-container", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// StartContainer applies a start policy to a container created earlier.
+func (c *Client) StartContainer(ctx context.Context, req StartContainerRequest) error {
+	return c.post(ctx, "/api/v1/start-container", req, nil)
+}
+
+// Pair exchanges a one-time pairing code for a token and the instance's
+// capabilities. It needs no token of its own.
+func (c *Client) Pair(ctx context.Context, req PairRequest) (*PairResponse, error) {
+	var resp PairResponse
+	if err := c.post(ctx, "/api/v1/pair", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// LoadImage loads a docker save archive on the instance and, given id and
+// tag, tags image id as tag. The archive may leave out layers the instance
+// already has.
+func (c *Client) LoadImage(ctx context.Context, id, tag string, archive io.Reader) error {
+	q := url.Values{}
+	q.Set("id", id)
+	q.Set("tag", tag)
+	resp, err := c.do(ctx, http.MethodPost, "/api/v1/load-image", q, "application/x-tar", archive)
+	if err != nil {
+		return err
+	}
+	return discard(resp)
+}
+
+// ImageLayers returns the layer chain IDs of every image on the instance.
+func (c *Client) ImageLayers(ctx context.Context) ([]string, error) {
+	var resp ImageLayersResponse
+	if err := c.get(ctx, "/api/v1/image-layers", nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.ChainIDs, nil
+}
+
+// RestoreData unpacks a tar archive, as the Docker archive API returns for a
+// mount path, into the mount target names.
+func (c *Client) RestoreData(ctx context.Context, target RestoreTarget, archive io.Reader) error {
+	q := url.Values{}
+	if target.Volume != "" {
+		q.Set("volume", target.Volume)
+	} else {
+		q.Set("container", target.Container)
+	}
+	q.Set("path", target.Path)
+	resp, err := c.do(ctx, http.MethodPost, "/api/v1/restore-data", q, "application/x-tar", archive)
+	if err != nil {
+		return err
+	}
+	return discard(resp)
+}
+
+// RemoveJob removes the containers, volumes and networks a replication job
+// created on the instance.
+func (c *Client) RemoveJob(ctx context.Context, job string) (*RemovedResources, error) {
+	q := url.Values{}
+	q.Set("job", job)
+	resp, err := c.do(ctx, http.MethodPost, "/api/v1/remove-job", q, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var removed RemovedResources
+	if err := json.NewDecoder(resp.Body).Decode(&removed); err != nil {
+		return nil, err
+	}
+	return &removed, nil
+}
+
+// CollectGarbage finds, and unless req.DryRun removes, the replicas of
+// req.SourceHost's containers, volumes and networks not in the keep lists.
+func (c *Client) CollectGarbage(ctx context.Context, req GCRequest) (*GCResult, error) {
+	var resp GCResult
+	if err := c.post(ctx, "/api/v1/gc", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Fingerprint fingerprints containers and checks volumes exist.
+func (c *Client) Fingerprint(ctx context.Context, req FingerprintRequest) (*FingerprintResponse, error) {
+	var resp FingerprintResponse
+	if err := c.post(ctx, "/api/v1/fingerprint", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// VolumeManifest lists the files in a volume with a hash of each.
+func (c *Client) VolumeManifest(ctx context.Context, req VolumeManifestRequest) (*VolumeManifest, error) {
+	var resp VolumeManifest
+	if err := c.post(ctx, "/api/v1/volume-manifest", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ExportData returns a tar archive of files in a volume, rooted like the
+// Docker archive API's for the volume's mount path. The caller closes it.
+func (c *Client) ExportData(ctx context.Context, req ExportDataRequest) (io.ReadCloser, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(ctx, http.MethodPost, "/api/v1/export-data", nil, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Checklist runs the instance's pre-replication checklist against the
+// source facts in req.
+func (c *Client) Checklist(ctx context.Context, req ChecklistRequest) ([]CheckItem, error) {
+	q := url.Values{}
+	q.Set("sourceTime", req.SourceTime)
+	q.Set("arch", req.Arch)
+	q.Set("modules", strings.Join(req.Modules, ","))
+	q.Set("ports", strings.Join(req.Ports, ","))
+	var items []CheckItem
+	if err := c.get(ctx, "/api/v1/checklist", q, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// SystemDF returns the instance's Docker disk usage.
+func (c *Client) SystemDF(ctx context.Context) (*DiskUsage, error) {
+	var resp DiskUsage
+	if err := c.get(ctx, "/api/v1/system-df", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// DestinationAbout returns the instance's build and the destination API
+// versions it serves. Instances that predate /api/v1/about answer it with
+// 404 or with their UI page; for those it reads /api/about instead, which
+// only a UI login reaches on recent instances.
+func (c *Client) DestinationAbout(ctx context.Context) (*About, error) {
+	about, err := c.about(ctx, "/api/"+APIVersion+"/about")
+	if errors.Is(err, errNoAbout) {
+		return c.about(ctx, "/api/about")
+	}
+	return about, err
+}
+
+// errNoAbout is an instance without the about endpoint asked.
+var errNoAbout = errors.New("no about endpoint")
+
+func (c *Client) about(ctx context.Context, path string) (*About, error) {
+	resp, err := c.do(ctx, http.MethodGet, path, nil, "", nil)
+	var apiErr *Error
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		return nil, errNoAbout
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		return nil, errNoAbout
+	}
+	var about About
+	if err := json.NewDecoder(resp.Body).Decode(&about); err != nil {
+		return nil, err
+	}
+	return &about, nil
+}
+
+// get reads path with query q and decodes the JSON response into out.
+func (c *Client) get(ctx context.Context, path string, q url.Values, out interface{}) error {
+	resp, err := c.do(ctx, http.MethodGet, path, q, "", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// post sends in as JSON to path and decodes the response into out, unless
+// out is nil.
+func (c *Client) post(ctx context.Context, path string, in, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(ctx, http.MethodPost, path, nil, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if out == nil {
+		return discard(resp)
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// do sends a request with body of type contentType, if body is not nil, and
+// returns the response if it is a 200. Otherwise it returns the response as
+// an Error.
+func (c *Client) do(ctx context.Context, method, path string, q url.Values, contentType string, body io.Reader) (*http.Response, error) {
+	target := c.baseURL + path
+	if len(q) > 0 {
+		target += "?" + q.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, ReadError(resp)
+	}
+	return resp, nil
+}
+
+// discard drains and closes a response whose body the caller doesn't need.
+func discard(resp *http.Response) error {
+	defer resp.Body.Close()
+	_, err := io.Copy(io.Discard, resp.Body)
+	return err
+}
@@ -0,0 +1,66 @@
+package apiclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDestinationAboutFallsBackForOlderInstances(t *testing.T) {
+	tests := []struct {
+		name    string
+		v1      http.HandlerFunc
+		version string
+	}{
+		{"current", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(About{Version: "v2", APIVersions: []string{"v1"}})
+		}, "v2"},
+		{"answers 404", http.NotFound, "v1-old"},
+		{"answers its UI page", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte("<html></html>"))
+		}, "v1-old"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc("/api/v1/about", tt.v1)
+			mux.HandleFunc("/api/about", func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(About{Version: "v1-old"})
+			})
+			srv := httptest.NewServer(mux)
+			defer srv.Close()
+
+			about, err := New(srv.URL, srv.Client()).DestinationAbout(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if about.Version != tt.version {
+				t.Errorf("version = %q, want %q", about.Version, tt.version)
+			}
+		})
+	}
+}
+
+func TestErrorsCarryTheProblem(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(Problem{Title: "Forbidden", Status: http.StatusForbidden, Detail: "destination policy denies the image", Code: "policy_denied"})
+	}))
+	defer srv.Close()
+
+	_, err := New(srv.URL, srv.Client()).CollectGarbage(context.Background(), GCRequest{SourceHost: "10.0.0.5"})
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("err = %v, want an *Error", err)
+	}
+	if apiErr.StatusCode != http.StatusForbidden || apiErr.Code != "policy_denied" || apiErr.Message != "destination policy denies the image" {
+		t.Errorf("err = %+v", apiErr)
+	}
+}
@@ -0,0 +1,231 @@
+package apiclient
+
+import (
+	"encoding/json"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"unicode"
+)
+
+// operations maps each destination API operation in openapi.json to the Go
+// types of its JSON request body and 200 response body. A nil request means
+// the operation takes no JSON body; a nil response means the client doesn't
+// read it.
+var operations = map[string]struct{ request, response any }{
+	"pullImage":        {PullImageRequest{}, nil},
+	"loadImage":        {nil, nil},
+	"imageLayers":      {nil, ImageLayersResponse{}},
+	"createNetwork":    {CreateNetworkRequest{}, CreateNetworkResponse{}},
+	"createVolume":     {CreateVolumeRequest{}, CreateVolumeResponse{}},
+	"createContainer":  {CreateContainerRequest{}, CreateContainerResponse{}},
+	"restoreData":      {nil, nil},
+	"startContainer":   {StartContainerRequest{}, nil},
+	"removeJob":        {nil, RemovedResources{}},
+	"collectGarbage":   {GCRequest{}, GCResult{}},
+	"fingerprint":      {FingerprintRequest{}, FingerprintResponse{}},
+	"volumeManifest":   {VolumeManifestRequest{}, VolumeManifest{}},
+	"exportData":       {ExportDataRequest{}, nil},
+	"checklist":        {nil, []CheckItem{}},
+	"systemDF":         {nil, DiskUsage{}},
+	"pair":             {PairRequest{}, PairResponse{}},
+	"destinationAbout": {nil, About{}},
+}
+
+type spec struct {
+	Paths      map[string]map[string]json.RawMessage `json:"paths"` // operations by method, and shared parameters
+	Components struct {
+		Schemas map[string]*schema `json:"schemas"`
+	} `json:"components"`
+
+	operations map[string]map[string]operation // by path and method
+}
+
+type operation struct {
+	OperationID string `json:"operationId"`
+	RequestBody *struct {
+		Content map[string]struct {
+			Schema *schema `json:"schema"`
+		} `json:"content"`
+	} `json:"requestBody"`
+	Responses map[string]struct {
+		Content map[string]struct {
+			Schema *schema `json:"schema"`
+		} `json:"content"`
+	} `json:"responses"`
+}
+
+type schema struct {
+	Ref                  string             `json:"$ref"`
+	Type                 string             `json:"type"`
+	Properties           map[string]*schema `json:"properties"`
+	Items                *schema            `json:"items"`
+	AdditionalProperties json.RawMessage    `json:"additionalProperties"` // a schema, or true or false
+}
+
+func loadSpec(t *testing.T) *spec {
+	t.Helper()
+	var s spec
+	if err := json.Unmarshal(OpenAPI, &s); err != nil {
+		t.Fatalf("openapi.json: %v", err)
+	}
+	s.operations = make(map[string]map[string]operation)
+	for path, item := range s.Paths {
+		s.operations[path] = make(map[string]operation)
+		for method, raw := range item {
+			if method == "parameters" {
+				continue
+			}
+			var op operation
+			if err := json.Unmarshal(raw, &op); err != nil {
+				t.Fatalf("openapi.json: %s %s: %v", method, path, err)
+			}
+			s.operations[path][method] = op
+		}
+	}
+	return &s
+}
+
+func TestClientCoversDestinationAPI(t *testing.T) {
+	s := loadSpec(t)
+	client := reflect.TypeOf(&Client{})
+	seen := make(map[string]bool)
+	for path, methods := range s.operations {
+		if !strings.HasPrefix(path, "/api/"+APIVersion+"/") {
+			continue
+		}
+		for method, op := range methods {
+			seen[op.OperationID] = true
+			if _, ok := operations[op.OperationID]; !ok {
+				t.Errorf("%s %s (%s) has no entry in operations", strings.ToUpper(method), path, op.OperationID)
+			}
+			name := string(unicode.ToUpper(rune(op.OperationID[0]))) + op.OperationID[1:]
+			if _, ok := client.MethodByName(name); !ok {
+				t.Errorf("%s %s has no Client.%s", strings.ToUpper(method), path, name)
+			}
+		}
+	}
+	for id := range operations {
+		if !seen[id] {
+			t.Errorf("operations lists %s, which openapi.json doesn't describe", id)
+		}
+	}
+}
+
+func TestTypesMatchOpenAPI(t *testing.T) {
+	s := loadSpec(t)
+	for path, methods := range s.operations {
+		for _, op := range methods {
+			types, ok := operations[op.OperationID]
+			if !ok {
+				continue
+			}
+			var request *schema
+			if op.RequestBody != nil {
+				request = op.RequestBody.Content["application/json"].Schema
+			}
+			switch {
+			case request != nil && types.request == nil:
+				t.Errorf("%s takes a JSON body in openapi.json but has no request type", op.OperationID)
+			case request == nil && types.request != nil:
+				t.Errorf("%s takes no JSON body in openapi.json but has request type %T", op.OperationID, types.request)
+			case request != nil:
+				s.compare(t, op.OperationID+" request", request, reflect.TypeOf(types.request))
+			}
+
+			response := op.Responses["200"].Content["application/json"].Schema
+			switch {
+			case response == nil && types.response != nil:
+				t.Errorf("%s (%s) answers no JSON in openapi.json but has response type %T", op.OperationID, path, types.response)
+			case response != nil && types.response != nil:
+				s.compare(t, op.OperationID+" response", response, reflect.TypeOf(types.response))
+			}
+		}
+	}
+}
+
+// compare reports where the JSON encoding of typ disagrees with sch. Objects
+// the spec leaves without properties, such as the Docker configs a request
+// passes through, match any struct.
+func (s *spec) compare(t *testing.T, where string, sch *schema, typ reflect.Type) {
+	t.Helper()
+	if sch.Ref != "" {
+		name := strings.TrimPrefix(sch.Ref, "#/components/schemas/")
+		ref, ok := s.Components.Schemas[name]
+		if !ok {
+			t.Errorf("%s: unknown schema %s", where, sch.Ref)
+			return
+		}
+		sch = ref
+	}
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+
+	kinds := map[string][]reflect.Kind{
+		"string":  {reflect.String},
+		"boolean": {reflect.Bool},
+		"integer": {reflect.Int, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64},
+		"number":  {reflect.Float32, reflect.Float64},
+		"array":   {reflect.Slice, reflect.Array},
+		"object":  {reflect.Struct, reflect.Map},
+	}
+	want, ok := kinds[sch.Type]
+	if !ok {
+		t.Errorf("%s: unexpected schema type %q", where, sch.Type)
+		return
+	}
+	if !slices.Contains(want, typ.Kind()) {
+		t.Errorf("%s: openapi.json has %s, Go has %s", where, sch.Type, typ)
+		return
+	}
+
+	switch {
+	case sch.Type == "array" && sch.Items != nil:
+		s.compare(t, where+"[]", sch.Items, typ.Elem())
+	case typ.Kind() == reflect.Map:
+		var elem schema
+		if json.Unmarshal(sch.AdditionalProperties, &elem) != nil {
+			t.Errorf("%s: openapi.json has an object without an additionalProperties schema, Go has %s", where, typ)
+			return
+		}
+		s.compare(t, where+"{}", &elem, typ.Elem())
+	case typ.Kind() == reflect.Struct && len(sch.Properties) > 0:
+		fields := jsonFields(typ)
+		for _, name := range slices.Sorted(maps.Keys(sch.Properties)) {
+			field, ok := fields[name]
+			if !ok {
+				t.Errorf("%s: openapi.json has property %s, %s has no such field", where, name, typ)
+				continue
+			}
+			s.compare(t, where+"."+name, sch.Properties[name], field)
+		}
+		for _, name := range slices.Sorted(maps.Keys(fields)) {
+			if _, ok := sch.Properties[name]; !ok {
+				t.Errorf("%s: %s has field %s, openapi.json doesn't", where, typ, name)
+			}
+		}
+	}
+}
+
+// jsonFields returns the types of the fields of struct typ by JSON name.
+func jsonFields(typ reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
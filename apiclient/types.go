@@ -0,0 +1,269 @@
+package apiclient
+
+import (
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+)
+
+// RegistryAuth is a registry login sent along with a pull.
+type RegistryAuth struct {
+	Name          string `json:"name,omitempty"`
+	ServerAddress string `json:"serverAddress"`
+	Username      string `json:"username,omitempty"`
+	Password      string `json:"password,omitempty"`
+	IdentityToken string `json:"identityToken,omitempty"`
+}
+
+// PullImageRequest is the body of POST /api/v1/pull-image.
+type PullImageRequest struct {
+	ImageName     string        `json:"imageName"`
+	Digest        string        `json:"digest,omitempty"`        // pull this exact digest and tag it as ImageName
+	RegistryAuth  *RegistryAuth `json:"registryAuth,omitempty"`  // inline registry login
+	CredentialRef string        `json:"credentialRef,omitempty"` // name of a credential stored on the instance
+	TagAs         string        `json:"tagAs,omitempty"`         // extra local name for the pulled image
+}
+
+// CreateNetworkRequest is the body of POST /api/v1/create-network.
+type CreateNetworkRequest struct {
+	Name       string            `json:"name"`
+	Driver     string            `json:"driver"`
+	Options    map[string]string `json:"options"`
+	Labels     map[string]string `json:"labels"`
+	IPAM       *network.IPAM     `json:"ipam"`
+	Internal   bool              `json:"internal"`
+	Attachable bool              `json:"attachable"`
+	EnableIPv6 bool              `json:"enableIPv6"`
+}
+
+// CreateNetworkResponse reports the network created, or found, by name.
+type CreateNetworkResponse struct {
+	Status    string `json:"status"` // "success" or "exists"
+	NetworkID string `json:"networkID"`
+}
+
+// CreateVolumeRequest is the body of POST /api/v1/create-volume.
+type CreateVolumeRequest struct {
+	Name       string            `json:"name"`
+	Driver     string            `json:"driver"`
+	DriverOpts map[string]string `json:"driverOpts"`
+	Labels     map[string]string `json:"labels"`
+}
+
+// CreateVolumeResponse reports the name of the created volume.
+type CreateVolumeResponse struct {
+	Status     string `json:"status"`
+	VolumeName string `json:"volumeName"`
+}
+
+// CreateContainerRequest is the body of POST /api/v1/create-container. Config,
+// HostConfig and NetworkConfig are passed to the Docker API unchanged.
+type CreateContainerRequest struct {
+	Name          string                    `json:"name"`
+	Config        *container.Config         `json:"config"`
+	HostConfig    *container.HostConfig     `json:"hostConfig"`
+	NetworkConfig *network.NetworkingConfig `json:"networkConfig"`
+	StartPolicy   string                    `json:"startPolicy,omitempty"` // created (default), stopped or running
+}
+
+// CreateContainerResponse reports the ID of the created container.
+type CreateContainerResponse struct {
+	Status      string `json:"status"`
+	ContainerID string `json:"containerID"`
+}
+
+// StartContainerRequest is the body of POST /api/v1/start-container.
+type StartContainerRequest struct {
+	Name        string `json:"name"`
+	StartPolicy string `json:"startPolicy"`
+}
+
+// PairRequest is the body of POST /api/v1/pair.
+type PairRequest struct {
+	Code string `json:"code"` // one-time pairing code shown by the destination
+	Name string `json:"name"` // how the destination lists the source's token
+}
+
+// PairResponse carries the token the source uses from now on and what the
+// destination can do.
+type PairResponse struct {
+	Token        string       `json:"token"`
+	Capabilities Capabilities `json:"capabilities"`
+}
+
+// Capabilities describes a destination's host.
+type Capabilities struct {
+	Version       string `json:"version"`
+	Architecture  string `json:"architecture"`
+	DiskAvailable int64  `json:"diskAvailable"` // bytes free for Docker's data, 0 if unknown
+}
+
+// ImageLayersResponse lists the layer chain IDs of every image on the
+// instance, so a source can leave those layers out of an image it sends.
+type ImageLayersResponse struct {
+	ChainIDs []string `json:"chainIDs"`
+}
+
+// RestoreTarget says where POST /api/v1/restore-data unpacks its archive:
+// into the mount at Path of Container or, given Volume instead, of that
+// volume.
+type RestoreTarget struct {
+	Container string
+	Volume    string
+	Path      string
+}
+
+// RemovedResources lists what was removed from a destination when a job was
+// rolled back.
+type RemovedResources struct {
+	Containers []string `json:"containers"`
+	Volumes    []string `json:"volumes"`
+	Networks   []string `json:"networks"`
+	Errors     []string `json:"errors,omitempty"`
+}
+
+// GCRequest tells a destination which of one source's replicas to keep.
+// Everything else labelled with that source host is an orphan.
+type GCRequest struct {
+	SourceHost     string   `json:"sourceHost"`
+	KeepContainers []string `json:"keepContainers"` // source container IDs
+	KeepVolumes    []string `json:"keepVolumes"`    // volume names on the destination
+	KeepNetworks   []string `json:"keepNetworks"`
+	DryRun         bool     `json:"dryRun"`
+}
+
+// GCResult lists the orphans found on a destination, removed unless it was a
+// dry run.
+type GCResult struct {
+	Destination string   `json:"destination,omitempty"`
+	DryRun      bool     `json:"dryRun"`
+	Containers  []string `json:"containers"`
+	Volumes     []string `json:"volumes"`
+	Networks    []string `json:"networks"`
+	Errors      []string `json:"errors,omitempty"`
+}
+
+// FingerprintRequest asks an instance to fingerprint containers and volumes.
+type FingerprintRequest struct {
+	Containers []FingerprintTarget `json:"containers"`
+	Volumes    []string            `json:"volumes"`
+}
+
+// FingerprintTarget is a container to fingerprint and the mounts to checksum.
+type FingerprintTarget struct {
+	Name   string          `json:"name"` // container name or ID
+	Mounts []MountChecksum `json:"mounts"`
+}
+
+// MountChecksum identifies a mount's contents; Checksum is empty in requests.
+type MountChecksum struct {
+	Path     string   `json:"path"`
+	Excludes []string `json:"excludes,omitempty"`
+	Checksum string   `json:"checksum,omitempty"`
+	Files    int      `json:"files"`
+	Bytes    int64    `json:"bytes"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// ContainerFingerprint is what verification compares for one container.
+type ContainerFingerprint struct {
+	Name       string          `json:"name"`
+	Found      bool            `json:"found"`
+	ImageID    string          `json:"imageId"`
+	ConfigHash string          `json:"configHash"`
+	Mounts     []MountChecksum `json:"mounts"`
+	Error      string          `json:"error,omitempty"`
+}
+
+// FingerprintResponse holds a fingerprint for each container asked for, in
+// the same order.
+type FingerprintResponse struct {
+	Containers []ContainerFingerprint `json:"containers"`
+	Volumes    map[string]bool        `json:"volumes"` // volume name -> exists
+}
+
+// VolumeManifestRequest is the body of POST /api/v1/volume-manifest.
+type VolumeManifestRequest struct {
+	Volume   string   `json:"volume"`
+	Excludes []string `json:"excludes"`
+}
+
+// VolumeManifest lists the files in a volume with a hash of each one's
+// content and mode (or a symlink's target), keyed by path inside the volume.
+// Container and Path are the container and mount path used to read it.
+type VolumeManifest struct {
+	Container string            `json:"container"`
+	Path      string            `json:"path"`
+	Files     map[string]string `json:"files"`
+}
+
+// ExportDataRequest is the body of POST /api/v1/export-data.
+type ExportDataRequest struct {
+	Volume string   `json:"volume"`
+	Files  []string `json:"files"` // paths inside the volume
+}
+
+// ChecklistRequest carries the source facts a destination's checklist
+// compares against.
+type ChecklistRequest struct {
+	SourceTime string   // source clock in RFC 3339
+	Arch       string   // source architecture
+	Modules    []string // kernel modules the replicas need
+	Ports      []string // host ports the replicas publish
+}
+
+// CheckItem is one entry in a destination's pre-replication checklist.
+type CheckItem struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	Hint   string `json:"hint,omitempty"`
+}
+
+// DiskUsage is the same figures as docker system df.
+type DiskUsage struct {
+	Images      DiskUsageCategory `json:"images"`
+	Containers  DiskUsageCategory `json:"containers"`
+	Volumes     DiskUsageCategory `json:"volumes"`
+	BuildCache  DiskUsageCategory `json:"buildCache"`
+	Total       int64             `json:"total"`       // bytes used by all of the above
+	Reclaimable int64             `json:"reclaimable"` // bytes a prune of each category would free
+}
+
+// DiskUsageCategory is the disk usage of one kind of Docker object. Active
+// objects are images used by a container, running containers, volumes
+// mounted by a container and build cache records in use.
+type DiskUsageCategory struct {
+	Count       int   `json:"count"`
+	Active      int   `json:"active"`
+	Size        int64 `json:"size"` // bytes
+	Reclaimable int64 `json:"reclaimable"`
+}
+
+// About describes an instance's build and the Docker daemon it talks to.
+type About struct {
+	Version          string   `json:"version"`
+	Commit           string   `json:"commit"`
+	BuildDate        string   `json:"buildDate"`
+	GoVersion        string   `json:"goVersion"`
+	DockerAPIVersion string   `json:"dockerApiVersion"`        // API version the client library was built for
+	DockerVersion    string   `json:"dockerVersion,omitempty"` // daemon version, empty if unreachable
+	DockerNegotiated string   `json:"dockerNegotiatedApiVersion,omitempty"`
+	APIVersions      []string `json:"apiVersions"` // destination API versions served under /api/
+	Features         []string `json:"features"`
+}
+
+// String returns a one-line summary for logs.
+func (a About) String() string {
+	s := a.Version
+	if a.Commit != "" {
+		commit := a.Commit
+		if len(commit) > 7 {
+			commit = commit[:7]
+		}
+		s += " (" + commit + ")"
+	}
+	if a.DockerVersion != "" {
+		s += ", Docker " + a.DockerVersion
+	}
+	return s
+}
@@ -0,0 +1,160 @@
+// Package config collects configuration problems from flags and environment
+// variables so they can all be reported at startup, each with a hint on how
+// to fix it, instead of failing on the first one.
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Problem is one invalid or inconsistent setting.
+type Problem struct {
+	Setting string
+	Message string
+	Hint    string
+}
+
+// Problems is every problem found in a configuration. It is returned as an
+// error when non-empty.
+type Problems []Problem
+
+func (p Problems) Error() string {
+	var b strings.Builder
+	if len(p) == 1 {
+		b.WriteString("1 configuration problem:")
+	} else {
+		fmt.Fprintf(&b, "%d configuration problems:", len(p))
+	}
+	for _, prob := range p {
+		fmt.Fprintf(&b, "\n  - %s: %s", prob.Setting, prob.Message)
+		if prob.Hint != "" {
+			fmt.Fprintf(&b, "\n    hint: %s", prob.Hint)
+		}
+	}
+	return b.String()
+}
+
+// Validator accumulates problems while a configuration is read.
+type Validator struct {
+	problems Problems
+}
+
+// Add records a problem.
+func (v *Validator) Add(setting, message, hint string) {
+	v.problems = append(v.problems, Problem{Setting: setting, Message: message, Hint: hint})
+}
+
+// Err returns the recorded problems, or nil if there are none.
+func (v *Validator) Err() error {
+	if len(v.problems) == 0 {
+		return nil
+	}
+	return v.problems
+}
+
+// Merge records the problems in err if it is a Problems, or err itself otherwise.
+func (v *Validator) Merge(setting string, err error) {
+	if err == nil {
+		return
+	}
+	if p, ok := err.(Problems); ok {
+		v.problems = append(v.problems, p...)
+		return
+	}
+	v.Add(setting, err.Error(), "")
+}
+
+// Required records a problem if the environment variable key is unset.
+func (v *Validator) Required(key, hint string) string {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		v.Add(key, "must be set", hint)
+	}
+	return value
+}
+
+// Duration reads a positive duration from the environment variable key.
+func (v *Validator) Duration(key string, def time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		v.Add(key, fmt.Sprintf("%q is not a positive duration", value), "use a Go duration such as 30s, 5m or 24h")
+		return def
+	}
+	return d
+}
+
+// Bool reads a boolean from the environment variable key.
+func (v *Validator) Bool(key string, def bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		v.Add(key, fmt.Sprintf("%q is not a boolean", value), "use true or false")
+		return def
+	}
+	return b
+}
+
+// Int reads a whole number of at least min from the environment variable key.
+func (v *Validator) Int(key string, def, min int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < min {
+		v.Add(key, fmt.Sprintf("%q is not a whole number of at least %d", value, min), "use a number such as 4")
+		return def
+	}
+	return n
+}
+
+// URL checks that value is an absolute http or https URL.
+func (v *Validator) URL(setting, value string) {
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		v.Add(setting, fmt.Sprintf("%q is not an http(s) URL", value), "include the scheme and host, e.g. http://10.0.0.5:8080")
+	}
+}
+
+// URLList reads a comma-separated list of http(s) URLs from the environment
+// variable key, trimming trailing slashes.
+func (v *Validator) URLList(key string) []string {
+	var urls []string
+	for _, u := range strings.Split(os.Getenv(key), ",") {
+		if u = strings.TrimRight(strings.TrimSpace(u), "/"); u != "" {
+			v.URL(key, u)
+			urls = append(urls, u)
+		}
+	}
+	return urls
+}
+
+// File checks that path names a readable file.
+func (v *Validator) File(setting, path string) {
+	if _, err := os.Stat(path); err != nil {
+		v.Add(setting, fmt.Sprintf("cannot read %s: %s", path, err), "check the path and that the file is mounted into the container")
+	}
+}
+
+// Pair checks that two settings that only make sense together are both set
+// or both unset.
+func (v *Validator) Pair(settingA, valueA, settingB, valueB string) {
+	switch {
+	case valueA != "" && valueB == "":
+		v.Add(settingB, "must be set when "+settingA+" is set", "set both or neither")
+	case valueA == "" && valueB != "":
+		v.Add(settingA, "must be set when "+settingB+" is set", "set both or neither")
+	}
+}
@@ -0,0 +1,115 @@
+// Package failback drives a failback from the command line: it asks a
+// standby DockerApp to copy its replicas' volumes back to the primary and
+// prints the resulting report.
+package failback
+
+import (
+	"bytes"
+	"dockerap/apiclient"
+	"dockerap/config"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Config controls a failback run.
+type Config struct {
+	StandbyURL   string
+	PrimaryURL   string
+	SourceHost   string
+	StopReplicas bool
+	APIToken     string // sent as a bearer token when the standby requires a login
+}
+
+// LoadConfig reads the FAILBACK_* environment variables.
+func LoadConfig() (*Config, error) {
+	v := &config.Validator{}
+	cfg := &Config{
+		StandbyURL:   strings.TrimRight(os.Getenv("FAILBACK_STANDBY_URL"), "/"),
+		PrimaryURL:   strings.TrimRight(v.Required("FAILBACK_PRIMARY_URL", "set it to the URL of the primary DockerApp to copy the volumes back to"), "/"),
+		SourceHost:   os.Getenv("FAILBACK_SOURCE_HOST"),
+		StopReplicas: v.Bool("FAILBACK_STOP_REPLICAS", false),
+		APIToken:     os.Getenv("API_TOKEN"),
+	}
+	if cfg.StandbyURL == "" {
+		cfg.StandbyURL = "http://localhost:8080"
+	}
+	v.URL("FAILBACK_STANDBY_URL", cfg.StandbyURL)
+	if cfg.PrimaryURL != "" {
+		v.URL("FAILBACK_PRIMARY_URL", cfg.PrimaryURL)
+	}
+
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// report is the part of the standby's replication report printed here.
+type report struct {
+	JobID        string `json:"jobId"`
+	Status       string `json:"status"`
+	DurationMs   int64  `json:"durationMs"`
+	Replicated   int    `json:"replicated"`
+	Failed       int    `json:"failed"`
+	Bytes        int64  `json:"bytes"`
+	Destinations []struct {
+		Items []struct {
+			Name   string `json:"name"`
+			Status string `json:"status"`
+			Error  string `json:"error"`
+		} `json:"items"`
+	} `json:"destinations"`
+}
+
+// Run performs the failback and returns an error if any volume failed.
+func Run(cfg *Config) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"primary":      cfg.PrimaryURL,
+		"sourceHost":   cfg.SourceHost,
+		"stopReplicas": cfg.StopReplicas,
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Copying replica volumes from %s back to %s...\n", cfg.StandbyURL, cfg.PrimaryURL)
+	req, err := http.NewRequest(http.MethodPost, cfg.StandbyURL+"/api/failback", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if cfg.APIToken != "" {
+		req.Header.Set("Authorization", "Bearer "+cfg.APIToken)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failback: %w", err)
+	}
+	defer resp.Body.Close()
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		return fmt.Errorf("failback: %w", apiclient.ReadError(resp))
+	}
+
+	var rep report
+	if err := json.NewDecoder(resp.Body).Decode(&rep); err != nil {
+		return fmt.Errorf("decode report: %w", err)
+	}
+	for _, d := range rep.Destinations {
+		for _, item := range d.Items {
+			if item.Error != "" {
+				fmt.Printf("  %-40s %s: %s\n", item.Name, item.Status, item.Error)
+			} else {
+				fmt.Printf("  %-40s %s\n", item.Name, item.Status)
+			}
+		}
+	}
+	fmt.Printf("Failback job %s %s: %d volumes copied, %d failed, %d bytes in %dms\n",
+		rep.JobID, rep.Status, rep.Replicated, rep.Failed, rep.Bytes, rep.DurationMs)
+	if rep.Failed > 0 {
+		return fmt.Errorf("%d volumes failed", rep.Failed)
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+// Package labels defines the Docker labels DockerApp puts on the resources it
+// creates, shared by the server that creates replicas and the monitor that
+// starts them.
+package labels
+
+const (
+	// Replica marks a container created by replication ("true").
+	Replica = "dockerapp.replica"
+	// SourceHost is the address of the primary the replica was copied from.
+	// Also set on the volumes and networks created for replicas.
+	SourceHost = "dockerapp.source-host"
+	// SourceID is the container ID on the primary.
+	SourceID = "dockerapp.source-id"
+	// SourceName is the container name on the primary.
+	SourceName = "dockerapp.source-name"
+	// Job is the replication job that created the resource, so a failed job
+	// can be rolled back. Set on replica containers and on the volumes and
+	// networks created for them.
+	Job = "dockerapp.job"
+	// DependsOn lists, comma-separated, the source names of the replicas a
+	// replica depends on, so the monitor starts those first.
+	DependsOn = "dockerapp.depends-on"
+	// Helper marks a short-lived container created only to read or write a
+	// volume no other container mounts ("true"). It is never started.
+	Helper = "dockerapp.helper"
+)
@@ -0,0 +1,79 @@
+// Package logging sets up the process-wide log/slog logger and carries the
+// request ID that ties log lines to the HTTP request they belong to.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Setup installs the default logger. level is debug, info, warn or error and
+// format is text or json; empty values fall back to LOG_LEVEL and LOG_FORMAT,
+// then to info and text. Output from the standard log package, used only for
+// fatal startup errors, is logged at error level.
+func Setup(level, format string) error {
+	if level == "" {
+		level = os.Getenv("LOG_LEVEL")
+	}
+	if format == "" {
+		format = os.Getenv("LOG_FORMAT")
+	}
+
+	var lvl slog.Level
+	if level != "" {
+		if err := lvl.UnmarshalText([]byte(level)); err != nil {
+			return fmt.Errorf("invalid log level %q: use debug, info, warn or error", level)
+		}
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+
+	var h slog.Handler
+	switch strings.ToLower(format) {
+	case "", "text":
+		h = slog.NewTextHandler(os.Stderr, opts)
+	case "json":
+		h = slog.NewJSONHandler(os.Stderr, opts)
+	default:
+		return fmt.Errorf("invalid log format %q: use text or json", format)
+	}
+	slog.SetDefault(slog.New(contextHandler{h}))
+	slog.SetLogLoggerLevel(slog.LevelError)
+	return nil
+}
+
+type requestIDKey struct{}
+
+// WithRequestID returns a context carrying the request ID id.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID carried by ctx, or "".
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// contextHandler adds the request ID to records logged with a context, so
+// slog.InfoContext(ctx, ...) needs no explicit attribute.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
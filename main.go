@@ -1,39 +1,149 @@
 package main
 
 import (
+	"dockerap/failback"
+	"dockerap/logging"
 	"dockerap/monitor"
 	"dockerap/server"
+	"dockerap/soak"
 	"dockerap/store"
 	"flag"
+	"fmt"
 	"log"
+	"log/slog"
+	"os"
+	"strconv"
 )
 
+// dbPath is the server's database when -db and $DATABASE_URL are not set,
+// relative to its working directory.
+const dbPath = "./dockerapp.db"
+
 var (
-	modeFlag = flag.String("mode", "server", "Operating mode: 'server' or 'monitor'")
+	modeFlag     = flag.String("mode", "server", "Operating mode: 'server', 'monitor', 'soak' or 'failback'")
+	validateFlag = flag.Bool("validate", false, "Check the configuration and exit")
+	listenFlag   = flag.String("listen", "", "Server listen address, e.g. 0.0.0.0:9000 (default $LISTEN_ADDR or :8080)")
+	levelFlag    = flag.String("log-level", "", "Log level: debug, info, warn or error (default $LOG_LEVEL or info)")
+	formatFlag   = flag.String("log-format", "", "Log format: text or json (default $LOG_FORMAT or text)")
+	tmplDirFlag  = flag.String("templates-dir", "", "Read UI templates from this directory instead of the embedded copies (default $TEMPLATES_DIR)")
+	devFlag      = flag.Bool("dev", false, "Re-parse UI templates on every request, from -templates-dir or ./templates")
+	migrateFlag  = flag.String("migrate-to", "", "Migrate the database to this schema version, or 'latest', and exit; a lower version reverts migrations")
+	dbFlag       = flag.String("db", "", "Database: a SQLite file, a postgres:// URL to share one database between servers, or 'memory' to keep nothing once the server stops (default $DATABASE_URL or "+dbPath+")")
 )
 
 func main() {
 	flag.Parse()
+	if err := logging.Setup(*levelFlag, *formatFlag); err != nil {
+		log.Fatalf("Invalid logging flags: %s", err)
+	}
 
 	if *modeFlag == "server" {
-		s, err := store.NewStore("./dockerapp.db")
+		if *migrateFlag != "" {
+			if err := migrate(*migrateFlag); err != nil {
+				log.Fatalf("Migration failed: %s", err)
+			}
+			return
+		}
+		cfg, err := server.LoadConfig(server.Flags{Listen: *listenFlag, TemplatesDir: *tmplDirFlag, Dev: *devFlag})
+		if err != nil {
+			log.Fatalf("Invalid configuration: %s", err)
+		}
+		if *validateFlag {
+			slog.Info("Configuration OK")
+			return
+		}
+
+		s, err := store.NewStore(dataSource())
 		if err != nil {
 			log.Fatalf("Failed to create store: %s", err)
 		}
 		defer s.Close()
-		s.InitSchema()
+		if err := s.Migrate(); err != nil {
+			log.Fatalf("Failed to migrate database: %s", err)
+		}
 
-		srv := server.NewServer(s)
-		srv.Run()
+		srv, err := server.NewServer(s, cfg)
+		if err != nil {
+			log.Fatalf("Failed to create server: %s", err)
+		}
+		if err := srv.Run(); err != nil {
+			log.Fatalf("Server failed: %s", err)
+		}
 
 	} else if *modeFlag == "monitor" {
 		mon, err := monitor.NewMonitor()
 		if err != nil {
-			log.Fatalf("Failed to create monitor: %s", err)
+			log.Fatalf("Invalid configuration: %s", err)
+		}
+		if *validateFlag {
+			if !mon.Validate() {
+				os.Exit(1)
+			}
+			return
 		}
 		mon.Run()
 
+	} else if *modeFlag == "soak" {
+		cfg, err := soak.LoadConfig()
+		if err != nil {
+			log.Fatalf("Invalid configuration: %s", err)
+		}
+		if *validateFlag {
+			slog.Info("Configuration OK")
+			return
+		}
+		if err := soak.Run(cfg); err != nil {
+			log.Fatalf("Soak test failed: %s", err)
+		}
+
+	} else if *modeFlag == "failback" {
+		cfg, err := failback.LoadConfig()
+		if err != nil {
+			log.Fatalf("Invalid configuration: %s", err)
+		}
+		if *validateFlag {
+			slog.Info("Configuration OK")
+			return
+		}
+		if err := failback.Run(cfg); err != nil {
+			log.Fatalf("Failback failed: %s", err)
+		}
+
 	} else {
 		log.Fatalf("Unknown mode: %s", *modeFlag)
 	}
-}
\ No newline at end of file
+}
+
+// dataSource names the server's database: -db, $DATABASE_URL or dbPath.
+func dataSource() string {
+	if *dbFlag != "" {
+		return *dbFlag
+	}
+	if dsn := os.Getenv("DATABASE_URL"); dsn != "" {
+		return dsn
+	}
+	return dbPath
+}
+
+// migrate brings the server's database to the schema version named by to,
+// a number or "latest", without starting the server.
+func migrate(to string) error {
+	version := store.LatestSchemaVersion()
+	if to != "latest" {
+		v, err := strconv.Atoi(to)
+		if err != nil {
+			return fmt.Errorf("invalid schema version %q, expected a number or 'latest'", to)
+		}
+		version = v
+	}
+	s, err := store.NewStore(dataSource())
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	if err := s.MigrateTo(version); err != nil {
+		return err
+	}
+	slog.Info("Database schema migrated", "version", version, "latest", store.LatestSchemaVersion())
+	return nil
+}
@@ -0,0 +1,164 @@
+package monitor
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Failure classes recorded for health checks.
+const (
+	FailureDNS        = "dns"
+	FailureTCP        = "tcp_connect"
+	FailureTimeout    = "timeout"
+	FailureTLS        = "tls"
+	FailureHTTPStatus = "http_status"
+	FailureBody       = "body_mismatch"
+	FailureOther      = "other"
+)
+
+const (
+	historySize = 50
+	snippetSize = 256
+	maxBodyScan = 64 << 10
+)
+
+// CheckResult captures one health check against the primary.
+type CheckResult struct {
+	Time         time.Time `json:"time"`
+	Healthy      bool      `json:"healthy"`
+	StatusCode   int       `json:"statusCode,omitempty"`
+	LatencyMS    int64     `json:"latencyMs"`
+	Snippet      string    `json:"snippet,omitempty"`
+	FailureClass string    `json:"failureClass,omitempty"`
+	Error        string    `json:"error,omitempty"`
+}
+
+// checkHistory is a fixed-size ring of recent check results.
+type checkHistory struct {
+	mu      sync.Mutex
+	results []CheckResult
+}
+
+func (h *checkHistory) add(r CheckResult) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.results = append(h.results, r)
+	if len(h.results) > historySize {
+		h.results = h.results[len(h.results)-historySize:]
+	}
+}
+
+// recent returns a copy of the history, oldest first.
+func (h *checkHistory) recent() []CheckResult {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]CheckResult(nil), h.results...)
+}
+
+// failures returns the failed checks in the history.
+func (h *checkHistory) failures() []CheckResult {
+	var failed []CheckResult
+	for _, r := range h.recent() {
+		if !r.Healthy {
+			failed = append(failed, r)
+		}
+	}
+	return failed
+}
+
+// checkPrimary performs a single health check and records its details.
+func (m *Monitor) checkPrimary() CheckResult {
+	start := time.Now()
+	result := CheckResult{Time: start}
+
+	req, err := m.probe.newRequest(m.primaryHostAddr)
+	if err != nil {
+		result.FailureClass = FailureOther
+		result.Error = err.Error()
+		m.history.add(result)
+		return result
+	}
+
+	resp, err := m.probe.client.Do(req)
+	if err != nil {
+		result.LatencyMS = time.Since(start).Milliseconds()
+		result.FailureClass = classifyError(err)
+		result.Error = err.Error()
+		m.history.add(result)
+		return result
+	}
+	defer resp.Body.Close()
+
+	result.StatusCode = resp.StatusCode
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxBodyScan))
+	result.LatencyMS = time.Since(start).Milliseconds()
+
+	switch {
+	case !m.probe.statusOK(resp.StatusCode):
+		result.FailureClass = FailureHTTPStatus
+		result.Error = "unexpected status " + resp.Status
+	case m.probe.expectedBody != "" && !strings.Contains(string(body), m.probe.expectedBody):
+		result.FailureClass = FailureBody
+		result.Error = "response body does not contain the expected text"
+	default:
+		result.Healthy = true
+	}
+	if !result.Healthy {
+		if len(body) > snippetSize {
+			body = body[:snippetSize]
+		}
+		result.Snippet = strings.TrimSpace(string(body))
+	}
+	m.history.add(result)
+	return result
+}
+
+// classifyError maps a transport error to a failure class so post-mortems can
+// tell name resolution, connectivity, and certificate problems apart.
+func classifyError(err error) string {
+	var dnsErr *net.DNSError
+	var opErr *net.OpError
+	var certErr *tls.CertificateVerificationError
+	var unknownAuth x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var recordErr tls.RecordHeaderError
+
+	switch {
+	case errors.As(err, &dnsErr):
+		return FailureDNS
+	case errors.As(err, &certErr), errors.As(err, &unknownAuth), errors.As(err, &hostnameErr), errors.As(err, &recordErr):
+		return FailureTLS
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return FailureTimeout
+	}
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return FailureTCP
+	}
+	return FailureOther
+}
+
+func (m *Monitor) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"primary":  m.primaryHostAddr,
+		"id":       m.id,
+		"history":  m.history.recent(),
+		"replicas": m.replicas.get(),
+	})
+}
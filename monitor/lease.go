@@ -0,0 +1,193 @@
+package monitor
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// lease records which standby is allowed to promote replicas of the primary.
+// Every monitor keeps its own copy; a standby only fails over once a majority
+// of monitors (itself included) have granted it the lease.
+type lease struct {
+	mu      sync.Mutex
+	holder  string
+	expires time.Time
+}
+
+// leaseRequest is the body of POST /lease. With Release set it gives back a
+// lease granted to Holder instead of asking for one.
+type leaseRequest struct {
+	Holder     string `json:"holder"`
+	Primary    string `json:"primary"`
+	TTLSeconds int    `json:"ttlSeconds"`
+	Release    bool   `json:"release,omitempty"`
+}
+
+// leaseResponse is returned by POST /lease.
+type leaseResponse struct {
+	Granted bool   `json:"granted"`
+	Holder  string `json:"holder"`
+}
+
+// tryAcquire grants the lease to holder if it is free, expired, or already theirs.
+func (l *lease) tryAcquire(holder string, ttl time.Duration) (bool, string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if l.holder == "" || l.holder == holder || now.After(l.expires) {
+		l.holder = holder
+		l.expires = now.Add(ttl)
+		return true, holder
+	}
+	return false, l.holder
+}
+
+// release frees the lease if holder has it.
+func (l *lease) release(holder string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.holder == holder {
+		l.holder = ""
+		l.expires = time.Time{}
+	}
+}
+
+func (m *Monitor) handleLease(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if m.leaseToken == "" || subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+m.leaseToken)) != 1 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req leaseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Holder == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Primary != m.primaryHostAddr {
+		http.Error(w, "Lease requested for a different primary", http.StatusConflict)
+		return
+	}
+
+	if req.Release {
+		m.lease.release(req.Holder)
+		slog.Info("Released failover lease", "holder", req.Holder)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	// A peer can't hold the lease longer than this monitor would grant itself
+	ttl := time.Duration(req.TTLSeconds) * time.Second
+	if ttl <= 0 || ttl > m.leaseTTL {
+		ttl = m.leaseTTL
+	}
+	granted, holder := m.lease.tryAcquire(req.Holder, ttl)
+	if granted {
+		slog.Info("Granted failover lease", "holder", holder)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !granted {
+		w.WriteHeader(http.StatusConflict)
+	}
+	json.NewEncoder(w).Encode(leaseResponse{Granted: granted, Holder: holder})
+}
+
+// acquireFailoverLease asks this monitor and every peer for the lease and
+// reports whether a majority granted it. Unreachable peers count as refusals.
+// Without a majority it gives back every grant it got and waits a random
+// part of the lease TTL, so two standbys that asked at once don't keep
+// splitting the vote.
+func (m *Monitor) acquireFailoverLease() bool {
+	if len(m.peerMonitors) == 0 {
+		return true
+	}
+
+	granted, holder := m.lease.tryAcquire(m.id, m.leaseTTL)
+	if !granted {
+		slog.Info("Failover lease is held by another monitor; not promoting", "holder", holder)
+		return false
+	}
+	if grantedBy, ok := m.requestLeaseVotes(); !ok {
+		m.lease.release(m.id)
+		for _, peer := range grantedBy {
+			m.postLease(peer, leaseRequest{Holder: m.id, Primary: m.primaryHostAddr, Release: true})
+		}
+		backoff := rand.N(m.leaseTTL / 3)
+		slog.Info("No majority for the failover lease; released it and backing off", "backoff", backoff)
+		time.Sleep(backoff)
+		return false
+	}
+	return true
+}
+
+// requestLeaseVotes asks every peer for the lease, which this monitor has
+// already granted itself, and returns the peers that granted it and whether
+// they and this monitor make a majority.
+func (m *Monitor) requestLeaseVotes() ([]string, bool) {
+	var grantedBy []string
+	for _, peer := range m.peerMonitors {
+		lr, err := m.postLease(peer, leaseRequest{Holder: m.id, Primary: m.primaryHostAddr, TTLSeconds: int(m.leaseTTL.Seconds())})
+		if err != nil {
+			slog.Warn("Failed to request lease from peer", "peer", peer, "err", err)
+			continue
+		}
+		if lr.Granted {
+			grantedBy = append(grantedBy, peer)
+		} else {
+			slog.Warn("Peer refused lease", "peer", peer, "holder", lr.Holder)
+		}
+	}
+
+	votes := len(grantedBy) + 1
+	quorum := (len(m.peerMonitors)+1)/2 + 1
+	slog.Info("Failover lease votes", "votes", votes, "voters", len(m.peerMonitors)+1, "quorum", quorum)
+	return grantedBy, votes >= quorum
+}
+
+// postLease sends req to a peer's /lease with the shared lease token.
+func (m *Monitor) postLease(peer string, req leaseRequest) (leaseResponse, error) {
+	var lr leaseResponse
+	body, _ := json.Marshal(req)
+	httpReq, err := http.NewRequest(http.MethodPost, peer+"/lease", bytes.NewReader(body))
+	if err != nil {
+		return lr, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", "Bearer "+m.leaseToken)
+	httpClient := &http.Client{Timeout: 5 * time.Second}
+	resp, err := httpClient.Do(httpReq)
+	if err != nil {
+		return lr, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusUnauthorized {
+		return lr, fmt.Errorf("peer rejected LEASE_TOKEN")
+	}
+	json.NewDecoder(resp.Body).Decode(&lr)
+	return lr, nil
+}
+
+// holdFailoverLease keeps renewing the lease after a promotion so peers never
+// see it expire and start the same workloads a second time. Unlike
+// acquireFailoverLease it never gives the lease back.
+func (m *Monitor) holdFailoverLease() {
+	ticker := time.NewTicker(m.leaseTTL / 3)
+	defer ticker.Stop()
+	for range ticker.C {
+		m.lease.tryAcquire(m.id, m.leaseTTL)
+		m.requestLeaseVotes()
+	}
+}
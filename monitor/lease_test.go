@@ -0,0 +1,88 @@
+package monitor
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newLeaseMonitor returns a monitor named id serving /lease, and the URL it
+// serves on.
+func newLeaseMonitor(t *testing.T, id string) (*Monitor, string) {
+	t.Helper()
+	m := &Monitor{id: id, primaryHostAddr: "http://primary:8080", leaseToken: "lease-secret", leaseTTL: 300 * time.Millisecond}
+	srv := httptest.NewServer(http.HandlerFunc(m.handleLease))
+	t.Cleanup(srv.Close)
+	return m, srv.URL
+}
+
+func TestSplitLeaseVoteResolves(t *testing.T) {
+	a, aURL := newLeaseMonitor(t, "a")
+	b, bURL := newLeaseMonitor(t, "b")
+	a.peerMonitors = []string{bURL}
+	b.peerMonitors = []string{aURL}
+
+	// Both standbys cross the failure threshold in the same tick and grant
+	// themselves the lease
+	a.lease.tryAcquire("a", a.leaseTTL)
+	b.lease.tryAcquire("b", b.leaseTTL)
+
+	if a.acquireFailoverLease() {
+		t.Fatal("a won the lease while b held its own vote")
+	}
+	if !b.acquireFailoverLease() {
+		t.Fatal("b didn't win the lease after a gave its vote back")
+	}
+	if a.acquireFailoverLease() {
+		t.Error("a won the lease b holds")
+	}
+}
+
+func TestHandleLease(t *testing.T) {
+	m, url := newLeaseMonitor(t, "a")
+	m.leaseTTL = time.Minute
+	post := func(token string, req leaseRequest) int {
+		body, _ := json.Marshal(req)
+		r, _ := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		req   leaseRequest
+		want  int
+	}{
+		{"no token", "", leaseRequest{Holder: "b", Primary: m.primaryHostAddr, TTLSeconds: 60}, http.StatusUnauthorized},
+		{"wrong token", "guess", leaseRequest{Holder: "b", Primary: m.primaryHostAddr, TTLSeconds: 60}, http.StatusUnauthorized},
+		{"other primary", "lease-secret", leaseRequest{Holder: "b", Primary: "http://other:8080", TTLSeconds: 60}, http.StatusConflict},
+		{"granted", "lease-secret", leaseRequest{Holder: "b", Primary: m.primaryHostAddr, TTLSeconds: 1 << 30}, http.StatusOK},
+		{"held", "lease-secret", leaseRequest{Holder: "c", Primary: m.primaryHostAddr, TTLSeconds: 60}, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		if got := post(tt.token, tt.req); got != tt.want {
+			t.Errorf("%s: %d, want %d", tt.name, got, tt.want)
+		}
+	}
+
+	if left := time.Until(m.lease.expires); left > m.leaseTTL {
+		t.Errorf("lease granted for %s, want no more than LEASE_TTL %s", left, m.leaseTTL)
+	}
+	if got := post("lease-secret", leaseRequest{Holder: "c", Primary: m.primaryHostAddr, Release: true}); got != http.StatusOK || m.lease.holder != "b" {
+		t.Errorf("c released b's lease: %d, holder %q", got, m.lease.holder)
+	}
+	if got := post("lease-secret", leaseRequest{Holder: "b", Primary: m.primaryHostAddr, Release: true}); got != http.StatusOK || m.lease.holder != "" {
+		t.Errorf("b's release: %d, holder %q", got, m.lease.holder)
+	}
+}
@@ -0,0 +1,54 @@
+package monitor
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+// Monitor metrics, served on the monitor API's /metrics.
+var (
+	metricsRegistry = prometheus.NewRegistry()
+
+	healthChecks = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "dockerapp_monitor_health_checks_total",
+		Help: "Health checks of the primary by result (healthy, unhealthy) and failure class.",
+	}, []string{"result", "class"})
+	healthCheckLatency = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "dockerapp_monitor_health_check_latency_seconds",
+		Help:    "Latency of health checks of the primary.",
+		Buckets: prometheus.DefBuckets,
+	})
+	primaryUp = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "dockerapp_monitor_primary_up",
+		Help: "1 if the last health check of the primary passed, 0 if it failed.",
+	})
+	consecutiveFailures = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "dockerapp_monitor_consecutive_failures",
+		Help: "Failed health checks since the last success.",
+	})
+	failovers = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "dockerapp_monitor_failovers_total",
+		Help: "Failovers triggered by this monitor by outcome (complete, unhealthy, error).",
+	}, []string{"outcome"})
+)
+
+func init() {
+	metricsRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		healthChecks, healthCheckLatency, primaryUp, consecutiveFailures, failovers,
+	)
+}
+
+// observeCheck records a health check of the primary.
+func observeCheck(result CheckResult, failureCount int) {
+	if result.Healthy {
+		healthChecks.WithLabelValues("healthy", "").Inc()
+		primaryUp.Set(1)
+	} else {
+		healthChecks.WithLabelValues("unhealthy", result.FailureClass).Inc()
+		primaryUp.Set(0)
+	}
+	healthCheckLatency.Observe(float64(result.LatencyMS) / 1000)
+	consecutiveFailures.Set(float64(failureCount))
+}
@@ -2,7 +2,11 @@ package monitor
 
 import (
 	"context"
-	"log"
+	"dockerap/config"
+	"dockerap/notify"
+	"dockerap/store"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
 	"strings"
@@ -10,35 +14,103 @@ import (
 
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/client"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 // Monitor handles the failover logic.
 type Monitor struct {
-	primaryHostAddr      string
+	primaryHostAddr        string
 	replicatedContainerIDs []string
+	probe                  *probeConfig
+
+	// Coordination with other standbys replicating the same primary
+	id           string
+	listenAddr   string
+	peerMonitors []string
+	leaseToken   string // sent to and required from peers on /lease
+	leaseTTL     time.Duration
+	lease        lease
+
+	// How long promoted containers get to report healthy
+	healthTimeout time.Duration
+
+	// The server's database, when it is on this host, to record failovers in
+	// its audit log
+	auditDBPath string
+
+	// Posts failovers to webhooks
+	notifier *notify.Notifier
+
+	history  checkHistory
+	replicas replicaCache
 }
 
-// NewMonitor creates a new Monitor instance from environment variables.
+// NewMonitor creates a new Monitor instance from environment variables. All
+// configuration problems are reported together as config.Problems.
 func NewMonitor() (*Monitor, error) {
-	primaryHost := os.Getenv("PRIMARY_HOST_ADDR")
-	if primaryHost == "" {
-		return nil, &ConfigError{"PRIMARY_HOST_ADDR environment variable not set."}
+	v := &config.Validator{}
+	primaryHost := v.Required("PRIMARY_HOST_ADDR", "set it to the URL of the primary DockerApp, e.g. http://10.0.0.5:8080")
+	if primaryHost != "" {
+		v.URL("PRIMARY_HOST_ADDR", primaryHost)
 	}
 
-	containerIDsStr := os.Getenv("REPLICATED_CONTAINER_IDS")
-	if containerIDsStr == "" {
-		return nil, &ConfigError{"REPLICATED_CONTAINER_IDS environment variable not set."}
+	// Replicas are found by label at failover time; explicit IDs are only a fallback
+	var containerIDs []string
+	for _, id := range strings.Split(os.Getenv("REPLICATED_CONTAINER_IDS"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			containerIDs = append(containerIDs, id)
+		}
+	}
+
+	m := &Monitor{
+		primaryHostAddr:        primaryHost,
+		replicatedContainerIDs: containerIDs,
+		probe:                  loadProbeConfig(v),
+		id:                     os.Getenv("MONITOR_ID"),
+		listenAddr:             os.Getenv("MONITOR_LISTEN_ADDR"),
+		peerMonitors:           v.URLList("PEER_MONITORS"),
+		leaseToken:             os.Getenv("LEASE_TOKEN"),
+		leaseTTL:               v.Duration("LEASE_TTL", 5*time.Minute),
+		healthTimeout:          v.Duration("FAILOVER_HEALTH_TIMEOUT", 2*time.Minute),
+		auditDBPath:            os.Getenv("AUDIT_DB_PATH"),
+	}
+	if m.auditDBPath != "" {
+		v.File("AUDIT_DB_PATH", m.auditDBPath)
+	}
+	if m.id == "" {
+		m.id, _ = os.Hostname()
+	}
+	if m.listenAddr == "" {
+		m.listenAddr = ":8081"
+	}
+	m.notifier = notify.Load(v, m.id)
+	if len(m.peerMonitors) > 0 && m.id == "" {
+		v.Add("MONITOR_ID", "is empty and the hostname is unavailable", "set a unique MONITOR_ID when PEER_MONITORS is set")
+	}
+	if len(m.peerMonitors) > 0 && m.leaseToken == "" {
+		v.Add("LEASE_TOKEN", "is empty", "set the same LEASE_TOKEN on every monitor when PEER_MONITORS is set")
 	}
 
-	return &Monitor{
-		primaryHostAddr:      primaryHost,
-		replicatedContainerIDs: strings.Split(containerIDsStr, ","),
-	}, nil
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+	return m, nil
 }
 
 // Run starts the monitoring loop.
 func (m *Monitor) Run() {
-	log.Println("Starting in monitor mode...")
+	slog.Info("Starting in monitor mode")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/lease", m.handleLease)
+	mux.HandleFunc("/status", m.handleStatus)
+	mux.Handle("/metrics", promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{}))
+	go func() {
+		slog.Info("Monitor API listening", "addr", m.listenAddr)
+		if err := http.ListenAndServe(m.listenAddr, mux); err != nil {
+			slog.Error("Monitor API stopped", "err", err)
+		}
+	}()
 
 	const failureThreshold = 3
 	const checkInterval = 10 * time.Second
@@ -47,53 +119,123 @@ func (m *Monitor) Run() {
 	ticker := time.NewTicker(checkInterval)
 	defer ticker.Stop()
 
+	m.refreshReplicaCache()
 	for range ticker.C {
-		log.Printf("Pinging primary host at %s...", m.primaryHostAddr)
-		resp, err := http.Get(m.primaryHostAddr)
-		if err != nil || (resp != nil && resp.StatusCode >= 500) {
+		m.refreshReplicaCache()
+
+		slog.Debug("Pinging primary host", "primary", m.primaryHostAddr)
+		result := m.checkPrimary()
+		if !result.Healthy {
 			failureCount++
-			log.Printf("Health check failed (%d/%d): %v", failureCount, failureThreshold, err)
+			slog.Warn("Health check failed", "failure_count", failureCount, "failure_threshold", failureThreshold,
+				"failure_class", result.FailureClass, "status_code", result.StatusCode, "latency_ms", result.LatencyMS,
+				"error", result.Error, "snippet", result.Snippet)
 		} else {
-			if resp != nil {
-				resp.Body.Close()
-			}
 			failureCount = 0
-			log.Println("Health check successful.")
+			slog.Info("Health check successful", "status_code", result.StatusCode, "latency_ms", result.LatencyMS)
 		}
+		observeCheck(result, failureCount)
 
 		if failureCount >= failureThreshold {
-			log.Println("Primary host is down! Triggering failover...")
+			slog.Warn("Primary host is down! Requesting failover lease")
+			if !m.acquireFailoverLease() {
+				// Another standby is promoting; keep watching in case it fails
+				continue
+			}
+			slog.Info("Failover lease acquired. Triggering failover")
+			m.notifier.Notify(context.Background(), notify.Event{
+				Type:    notify.FailoverStarted,
+				Primary: m.primaryHostAddr,
+				Summary: fmt.Sprintf("Failover started on %s: primary %s failed %d health checks", m.id, m.primaryHostAddr, failureCount),
+			})
 			m.triggerFailover()
+			if len(m.peerMonitors) > 0 {
+				m.holdFailoverLease()
+			}
 			return // Exit after triggering failover
 		}
 	}
 }
 
 func (m *Monitor) triggerFailover() {
+	slog.Info("Recent failed health checks")
+	for _, f := range m.history.failures() {
+		slog.Info("Failed health check", "time", f.Time.Format(time.RFC3339), "failure_class", f.FailureClass,
+			"status_code", f.StatusCode, "latency_ms", f.LatencyMS, "error", f.Error)
+	}
+
 	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
 	if err != nil {
-		log.Printf("Failed to create docker client for failover: %s", err)
+		slog.Error("Failed to create docker client for failover", "err", err)
+		failovers.WithLabelValues("error").Inc()
+		m.failoverFinished("failed", err.Error())
 		return
 	}
 	defer cli.Close()
 
+	// Start the replicas level by level, each level once the containers it
+	// depends on are healthy
 	ctx := context.Background()
-	for _, id := range m.replicatedContainerIDs {
-		log.Printf("Starting container %s...", id)
-		if err := cli.ContainerStart(ctx, id, container.StartOptions{}); err != nil {
-			log.Printf("Failed to start container %s: %s", id, err)
-		} else {
-			log.Printf("Successfully started container %s.", id)
+	var unhealthy []string
+	for _, level := range startLevels(ctx, cli, m.failoverTargets(ctx, cli)) {
+		var started []string
+		for _, id := range level {
+			slog.Info("Starting container", "id", id)
+			if err := cli.ContainerStart(ctx, id, container.StartOptions{}); err != nil {
+				slog.Warn("Failed to start container", "id", id, "err", err)
+			} else {
+				slog.Info("Successfully started container", "id", id)
+				started = append(started, id)
+			}
 		}
+
+		slog.Info("Waiting for containers to report healthy", "timeout", m.healthTimeout, "containers", len(started))
+		unhealthy = append(unhealthy, m.waitHealthy(ctx, cli, started)...)
+	}
+	if len(unhealthy) > 0 {
+		slog.Warn("Failover finished, but some containers did not become healthy in time", "unhealthy", unhealthy)
+		failovers.WithLabelValues("unhealthy").Inc()
+		m.failoverFinished("partial", fmt.Sprintf("%d replicas did not become healthy in time", len(unhealthy)))
+		return
 	}
-	log.Println("Failover process complete.")
+	failovers.WithLabelValues("complete").Inc()
+	m.failoverFinished("succeeded", "")
+	slog.Info("Failover process complete")
 }
 
-// ConfigError is a custom error for configuration issues.
-type ConfigError struct {
-	message string
+// failoverFinished records the failover's outcome in the audit log and
+// posts it to the webhooks, waiting for them, as the monitor stops next.
+func (m *Monitor) failoverFinished(outcome, detail string) {
+	m.recordFailover(outcome, detail)
+	e := notify.Event{Type: "failover." + outcome, Primary: m.primaryHostAddr, Error: detail}
+	e.Summary = fmt.Sprintf("Failover on %s from primary %s %s", m.id, m.primaryHostAddr, outcome)
+	if detail != "" {
+		e.Summary += ": " + detail
+	}
+	m.notifier.Notify(context.Background(), e)
 }
 
-func (e *ConfigError) Error() string {
-	return e.message
+// recordFailover adds the failover to the server's audit log when
+// AUDIT_DB_PATH is set. The monitor holds no session, so the actor is the
+// monitor's ID.
+func (m *Monitor) recordFailover(outcome, detail string) {
+	if m.auditDBPath == "" {
+		return
+	}
+	st, err := store.NewStore(m.auditDBPath)
+	if err != nil {
+		slog.Error("Unable to open audit database", "path", m.auditDBPath, "err", err)
+		return
+	}
+	defer st.Close()
+	entry := store.AuditEntry{
+		Actor:   "monitor:" + m.id,
+		Action:  "failover",
+		Target:  m.primaryHostAddr,
+		Outcome: outcome,
+		Detail:  detail,
+	}
+	if err := st.RecordAudit(entry); err != nil {
+		slog.Error("Unable to record audit entry", "action", entry.Action, "err", err)
+	}
 }
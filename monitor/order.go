@@ -0,0 +1,57 @@
+package monitor
+
+import (
+	"context"
+	"dockerap/labels"
+	"dockerap/startorder"
+	"log/slog"
+	"strings"
+
+	"github.com/docker/docker/client"
+)
+
+// startLevels groups the failover targets so each replica's dependencies,
+// named in its dockerapp.depends-on label, start in an earlier level.
+// Containers that cannot be inspected are started in the first level.
+func startLevels(ctx context.Context, cli *client.Client, ids []string) [][]string {
+	var first []string
+	deps := make(map[string][]string, len(ids))
+	idByName := make(map[string]string, len(ids))
+	for _, id := range ids {
+		inspect, err := cli.ContainerInspect(ctx, id)
+		if err != nil {
+			slog.Warn("Failed to inspect container for start order", "id", id, "err", err)
+			first = append(first, id)
+			continue
+		}
+		name := inspect.Config.Labels[labels.SourceName]
+		if name == "" {
+			name = strings.TrimPrefix(inspect.Name, "/")
+		}
+		idByName[name] = id
+		deps[name] = nil
+		if dependsOn := inspect.Config.Labels[labels.DependsOn]; dependsOn != "" {
+			deps[name] = strings.Split(dependsOn, ",")
+		}
+	}
+
+	levels, cyclic := startorder.Levels(deps)
+	if len(cyclic) > 0 {
+		slog.Warn("Replicas have circular dependencies; starting them together", "replicas", cyclic)
+	}
+	result := make([][]string, 0, len(levels))
+	for _, level := range levels {
+		idLevel := make([]string, 0, len(level))
+		for _, name := range level {
+			idLevel = append(idLevel, idByName[name])
+		}
+		result = append(result, idLevel)
+	}
+	if len(first) > 0 {
+		if len(result) == 0 {
+			result = append(result, nil)
+		}
+		result[0] = append(first, result[0]...)
+	}
+	return result
+}
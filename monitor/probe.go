@@ -0,0 +1,123 @@
+package monitor
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"dockerap/config"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// statusRange is an inclusive range of acceptable HTTP status codes.
+type statusRange struct {
+	min, max int
+}
+
+// probeConfig controls how the primary is health-checked.
+type probeConfig struct {
+	path           string // appended to PRIMARY_HOST_ADDR
+	timeout        time.Duration
+	expectedStatus []statusRange // empty means any status below 500
+	expectedBody   string
+	authHeader     string
+	client         *http.Client
+}
+
+// loadProbeConfig reads the HEALTH_CHECK_* environment variables, recording
+// any problems in v.
+func loadProbeConfig(v *config.Validator) *probeConfig {
+	cfg := &probeConfig{
+		path:         os.Getenv("HEALTH_CHECK_PATH"),
+		timeout:      v.Duration("HEALTH_CHECK_TIMEOUT", 10*time.Second),
+		expectedBody: os.Getenv("HEALTH_CHECK_EXPECTED_BODY"),
+		authHeader:   os.Getenv("HEALTH_CHECK_AUTH_HEADER"),
+	}
+
+	if cfg.path == "" {
+		cfg.path = "/readyz"
+	}
+	if !strings.HasPrefix(cfg.path, "/") {
+		v.Add("HEALTH_CHECK_PATH", cfg.path+" does not start with /", "use a path such as /readyz or /healthz")
+	}
+
+	if s := os.Getenv("HEALTH_CHECK_EXPECTED_STATUS"); s != "" {
+		ranges, err := parseStatusRanges(s)
+		if err != nil {
+			v.Add("HEALTH_CHECK_EXPECTED_STATUS", err.Error(), "use codes and ranges such as 200,204,300-399")
+		}
+		cfg.expectedStatus = ranges
+	}
+
+	tlsConfig := &tls.Config{}
+	if caFile := os.Getenv("HEALTH_CHECK_CA_FILE"); caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			v.Add("HEALTH_CHECK_CA_FILE", fmt.Sprintf("cannot read %s: %s", caFile, err), "check the path and that the file is mounted into the container")
+		} else {
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				v.Add("HEALTH_CHECK_CA_FILE", caFile+" contains no PEM certificates", "point it at a PEM-encoded CA bundle")
+			}
+			tlsConfig.RootCAs = pool
+		}
+	}
+	tlsConfig.InsecureSkipVerify = v.Bool("HEALTH_CHECK_INSECURE_SKIP_VERIFY", false)
+	if tlsConfig.InsecureSkipVerify && tlsConfig.RootCAs != nil {
+		v.Add("HEALTH_CHECK_INSECURE_SKIP_VERIFY", "is set together with HEALTH_CHECK_CA_FILE, so the CA bundle is ignored", "unset one of them")
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	cfg.client = &http.Client{Timeout: cfg.timeout, Transport: transport}
+	return cfg
+}
+
+// parseStatusRanges parses a list like "200,204,300-399".
+func parseStatusRanges(s string) ([]statusRange, error) {
+	var ranges []statusRange
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		lo, hi, isRange := strings.Cut(part, "-")
+		min, err := strconv.Atoi(lo)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a status code", part)
+		}
+		max := min
+		if isRange {
+			if max, err = strconv.Atoi(hi); err != nil || max < min {
+				return nil, fmt.Errorf("%q is not a valid status range", part)
+			}
+		}
+		ranges = append(ranges, statusRange{min, max})
+	}
+	return ranges, nil
+}
+
+// statusOK reports whether code is an expected status.
+func (c *probeConfig) statusOK(code int) bool {
+	if len(c.expectedStatus) == 0 {
+		return code < 500
+	}
+	for _, r := range c.expectedStatus {
+		if code >= r.min && code <= r.max {
+			return true
+		}
+	}
+	return false
+}
+
+// newRequest builds the health-check request for the primary at base.
+func (c *probeConfig) newRequest(base string) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(base, "/")+c.path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.authHeader != "" {
+		req.Header.Set("Authorization", c.authHeader)
+	}
+	return req, nil
+}
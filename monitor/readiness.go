@@ -0,0 +1,65 @@
+package monitor
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+)
+
+const readinessPollInterval = 2 * time.Second
+
+// waitHealthy waits until every started container is running and, if it has
+// a healthcheck, reports healthy. It returns the containers that did not get
+// there before the timeout, so failover is only declared complete once the
+// promoted services are actually serving.
+func (m *Monitor) waitHealthy(ctx context.Context, cli *client.Client, ids []string) []string {
+	ctx, cancel := context.WithTimeout(ctx, m.healthTimeout)
+	defer cancel()
+
+	pending := append([]string(nil), ids...)
+	ticker := time.NewTicker(readinessPollInterval)
+	defer ticker.Stop()
+	for {
+		var still []string
+		for _, id := range pending {
+			inspect, err := cli.ContainerInspect(ctx, id)
+			if err != nil {
+				if ctx.Err() == nil {
+					slog.Warn("Failed to inspect container for start order", "id", id, "err", err)
+				}
+				still = append(still, id)
+				continue
+			}
+			if ready, status := containerReady(inspect); ready {
+				slog.Info("Container ready", "id", id, "status", status)
+			} else {
+				still = append(still, id)
+			}
+		}
+		pending = still
+		if len(pending) == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return pending
+		case <-ticker.C:
+		}
+	}
+}
+
+// containerReady reports whether a container is running and, when it has a
+// healthcheck, healthy, along with the status it is in.
+func containerReady(inspect types.ContainerJSON) (bool, string) {
+	if inspect.State == nil || !inspect.State.Running {
+		return false, "not running"
+	}
+	if inspect.State.Health == nil {
+		return true, "running (no healthcheck)"
+	}
+	return inspect.State.Health.Status == types.Healthy, inspect.State.Health.Status
+}
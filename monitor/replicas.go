@@ -0,0 +1,87 @@
+package monitor
+
+import (
+	"context"
+	"dockerap/labels"
+	"log/slog"
+	"sync"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+)
+
+// replicaCache holds the most recent label lookup so a failover can still
+// proceed if the daemon is briefly unresponsive at the moment it is needed.
+type replicaCache struct {
+	mu  sync.Mutex
+	ids []string
+}
+
+func (c *replicaCache) set(ids []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ids = ids
+}
+
+func (c *replicaCache) get() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.ids...)
+}
+
+// resolveReplicas finds the local replicas of the primary by label.
+func (m *Monitor) resolveReplicas(ctx context.Context, cli *client.Client) ([]string, error) {
+	containers, err := cli.ContainerList(ctx, container.ListOptions{
+		All: true,
+		Filters: filters.NewArgs(
+			filters.Arg("label", labels.Replica+"=true"),
+			filters.Arg("label", labels.SourceHost+"="+m.primaryHostAddr),
+		),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(containers))
+	for _, c := range containers {
+		ids = append(ids, c.ID)
+	}
+	return ids, nil
+}
+
+// refreshReplicaCache re-resolves the replicas, keeping the previous cache on error.
+func (m *Monitor) refreshReplicaCache() {
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		slog.Warn("Failed to create docker client for replica lookup", "err", err)
+		return
+	}
+	defer cli.Close()
+
+	ids, err := m.resolveReplicas(context.Background(), cli)
+	if err != nil {
+		slog.Warn("Failed to refresh replica cache", "err", err)
+		return
+	}
+	m.replicas.set(ids)
+}
+
+// failoverTargets returns the containers to start: a fresh label lookup,
+// then the warm cache, then the statically configured IDs.
+func (m *Monitor) failoverTargets(ctx context.Context, cli *client.Client) []string {
+	ids, err := m.resolveReplicas(ctx, cli)
+	if err != nil {
+		slog.Warn("Failed to resolve replicas by label", "err", err)
+	}
+	if len(ids) > 0 {
+		slog.Info("Resolved replicas by label", "count", len(ids))
+		return ids
+	}
+	if cached := m.replicas.get(); len(cached) > 0 {
+		slog.Info("Using cached replica IDs", "count", len(cached))
+		return cached
+	}
+	slog.Info("No labelled replicas found, using REPLICATED_CONTAINER_IDS")
+	return m.replicatedContainerIDs
+}
@@ -0,0 +1,102 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/client"
+)
+
+// Validate checks the monitor's configuration against the live environment
+// and prints what a failover would do. It reports false if any check fails,
+// so misconfigurations surface at deploy time rather than during an outage.
+func (m *Monitor) Validate() bool {
+	ok := true
+	pass := func(format string, args ...interface{}) {
+		fmt.Printf("  [OK]   "+format+"\n", args...)
+	}
+	fail := func(format string, args ...interface{}) {
+		fmt.Printf("  [FAIL] "+format+"\n", args...)
+		ok = false
+	}
+
+	fmt.Println("Validating monitor configuration...")
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// Docker socket
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		fail("Docker client: %s", err)
+	} else {
+		defer cli.Close()
+		if _, err := cli.Ping(ctx); err != nil {
+			fail("Docker daemon unreachable: %s", err)
+			cli = nil
+		} else {
+			pass("Docker daemon reachable")
+		}
+	}
+
+	// Primary connectivity
+	result := m.checkPrimary()
+	if result.Healthy {
+		pass("Primary %s healthy (HTTP %d, %dms)", m.primaryHostAddr, result.StatusCode, result.LatencyMS)
+	} else {
+		fail("Primary %s unhealthy: class=%s %s", m.primaryHostAddr, result.FailureClass, result.Error)
+	}
+
+	// Peer monitors
+	httpClient := &http.Client{Timeout: 5 * time.Second}
+	for _, peer := range m.peerMonitors {
+		resp, err := httpClient.Get(peer + "/status")
+		if err != nil {
+			fail("Peer monitor %s unreachable: %s", peer, err)
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			fail("Peer monitor %s returned HTTP %d", peer, resp.StatusCode)
+		} else {
+			pass("Peer monitor %s reachable", peer)
+		}
+	}
+
+	// Replicas that would be started
+	if cli != nil {
+		targets := m.failoverTargets(ctx, cli)
+		if len(targets) == 0 {
+			fail("No replicas found for %s (no labelled containers and REPLICATED_CONTAINER_IDS is empty)", m.primaryHostAddr)
+		}
+		var plan []string
+		for i, level := range startLevels(ctx, cli, targets) {
+			for _, id := range level {
+				c, err := cli.ContainerInspect(ctx, id)
+				if err != nil {
+					fail("Replica %s not found locally: %s", id, err)
+					continue
+				}
+				pass("Replica %s present (%s)", strings.TrimPrefix(c.Name, "/"), c.State.Status)
+				plan = append(plan, fmt.Sprintf("start %s (%s) from image %s in level %d", strings.TrimPrefix(c.Name, "/"), c.ID[:12], c.Config.Image, i+1))
+			}
+		}
+
+		fmt.Println("On failover this monitor would:")
+		if len(m.peerMonitors) > 0 {
+			fmt.Printf("  acquire the failover lease from a majority of %d monitors\n", len(m.peerMonitors)+1)
+		}
+		for _, step := range plan {
+			fmt.Println("  " + step)
+		}
+	}
+
+	if ok {
+		fmt.Println("Validation passed.")
+	} else {
+		fmt.Println("Validation failed.")
+	}
+	return ok
+}
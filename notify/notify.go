@@ -0,0 +1,212 @@
+// Package notify posts replication and failover events to webhooks, so they
+// reach chat and alerting without anyone watching the logs. It is shared by
+// the server, which reports finished replication jobs, and the monitor, which
+// reports failovers.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"dockerap/config"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event types. A replication or failover ends with the event for its outcome.
+const (
+	ReplicationSucceeded = "replication.succeeded"
+	ReplicationPartial   = "replication.partial"
+	ReplicationFailed    = "replication.failed"
+	FailoverStarted      = "failover.started"
+	FailoverSucceeded    = "failover.succeeded"
+	FailoverPartial      = "failover.partial"
+	FailoverFailed       = "failover.failed"
+)
+
+const (
+	// deliveryAttempts is how often a webhook is tried before the event is
+	// dropped; each retry waits a second longer than the last.
+	deliveryAttempts = 3
+	deliveryTimeout  = 10 * time.Second
+)
+
+// Event is what a generic webhook receives as its JSON body. Fields that do
+// not apply to the event type are left out.
+type Event struct {
+	Type     string    `json:"event"`
+	Time     time.Time `json:"time"`
+	Instance string    `json:"instance"` // host name of the server, or the monitor's ID
+	Summary  string    `json:"summary"`  // one line for people, the whole of a Slack message
+
+	// Replication
+	JobID        string   `json:"jobId,omitempty"`
+	Profile      string   `json:"profile,omitempty"`
+	Direction    string   `json:"direction,omitempty"` // "failback" for reverse runs
+	Destinations []string `json:"destinations,omitempty"`
+	Replicated   int      `json:"replicated,omitempty"`
+	Failed       int      `json:"failed,omitempty"`
+	Bytes        int64    `json:"bytes,omitempty"`
+
+	// Failover
+	Primary string `json:"primary,omitempty"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// webhook is one URL events are posted to.
+type webhook struct {
+	url   string
+	slack bool // post {"text": summary} instead of the event
+}
+
+// Notifier posts events to the configured webhooks. A nil Notifier, or one
+// with no webhooks, drops every event.
+type Notifier struct {
+	hooks    []webhook
+	events   []string // types or type prefixes to send, all when empty
+	instance string
+	client   *http.Client
+}
+
+// Load reads NOTIFY_WEBHOOK_URLS and NOTIFY_SLACK_WEBHOOK_URLS, comma
+// separated lists of URLs that get the event as JSON or as a Slack message,
+// and NOTIFY_EVENTS, the event types to send, such as
+// replication.failed,failover. instance names the sender in every event.
+func Load(v *config.Validator, instance string) *Notifier {
+	n := &Notifier{instance: instance, client: &http.Client{Timeout: deliveryTimeout}}
+	for _, u := range v.URLList("NOTIFY_WEBHOOK_URLS") {
+		n.hooks = append(n.hooks, webhook{url: u})
+	}
+	for _, u := range v.URLList("NOTIFY_SLACK_WEBHOOK_URLS") {
+		n.hooks = append(n.hooks, webhook{url: u, slack: true})
+	}
+	for _, e := range strings.Split(os.Getenv("NOTIFY_EVENTS"), ",") {
+		e = strings.TrimSpace(e)
+		if e == "" {
+			continue
+		}
+		if !knownEvent(e) {
+			v.Add("NOTIFY_EVENTS", fmt.Sprintf("%q is not an event type", e), "use replication, failover, or a type such as replication.failed")
+			continue
+		}
+		n.events = append(n.events, e)
+	}
+	return n
+}
+
+// knownEvent reports whether name is an event type or the part before its dot.
+func knownEvent(name string) bool {
+	for _, t := range []string{ReplicationSucceeded, ReplicationPartial, ReplicationFailed, FailoverStarted, FailoverSucceeded, FailoverPartial, FailoverFailed} {
+		if name == t || strings.HasPrefix(t, name+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// Enabled reports whether any webhook is configured.
+func (n *Notifier) Enabled() bool {
+	return n != nil && len(n.hooks) > 0
+}
+
+// wants reports whether events of type t are sent.
+func (n *Notifier) wants(t string) bool {
+	if len(n.events) == 0 {
+		return true
+	}
+	for _, e := range n.events {
+		if t == e || strings.HasPrefix(t, e+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// Notify posts e to every webhook and returns once each has taken it or run
+// out of attempts. Failures are logged, never returned: a lost notification
+// must not fail the job or failover it is about. Callers that cannot wait
+// run it in a goroutine.
+func (n *Notifier) Notify(ctx context.Context, e Event) {
+	if !n.Enabled() || !n.wants(e.Type) {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	e.Instance = n.instance
+	// One slow or failing webhook does not hold up the others
+	var wg sync.WaitGroup
+	for _, h := range n.hooks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := n.deliver(ctx, h, e); err != nil {
+				slog.WarnContext(ctx, "Unable to deliver webhook notification", "event", e.Type, "url", redactURL(h.url), "err", err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func (n *Notifier) deliver(ctx context.Context, h webhook, e Event) error {
+	var body any = e
+	if h.slack {
+		body = map[string]string{"text": e.Summary}
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	for attempt := 1; ; attempt++ {
+		err = n.post(ctx, h.url, data)
+		if err == nil || attempt == deliveryAttempts {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(attempt) * time.Second):
+		}
+	}
+}
+
+func (n *Notifier) post(ctx context.Context, target string, data []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "dockerapp-notify")
+	resp, err := n.client.Do(req)
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		// Without the URL, which redactURL keeps out of the logs
+		return urlErr.Err
+	}
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 200))
+		return fmt.Errorf("webhook answered %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// redactURL keeps a webhook's secret path out of the logs; Slack and most
+// chat webhooks carry their token there.
+func redactURL(u string) string {
+	scheme, rest, _ := strings.Cut(u, "://")
+	host, _, _ := strings.Cut(rest, "/")
+	return scheme + "://" + host + "/..."
+}
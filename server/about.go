@@ -0,0 +1,65 @@
+package server
+
+import (
+	"context"
+	"dockerap/apiclient"
+	"dockerap/version"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"runtime"
+
+	"github.com/docker/docker/api"
+)
+
+// features lists the optional capabilities this build supports, so a peer can
+// tell what an older or newer instance on the other side will understand.
+var features = []string{
+	"delta-images",
+	"relay-transport",
+	"volume-data",
+	"bind-mounts",
+	"volume-excludes",
+	"quiesce",
+	"hooks",
+	"port-remap",
+	"inventory-snapshots",
+	"notes",
+}
+
+// readAbout collects the build info and asks the local daemon for its version.
+func readAbout(ctx context.Context) apiclient.About {
+	commit, buildDate := version.Info()
+	about := apiclient.About{
+		Version:          version.Version,
+		Commit:           commit,
+		BuildDate:        buildDate,
+		GoVersion:        runtime.Version(),
+		DockerAPIVersion: api.DefaultVersion,
+		APIVersions:      []string{apiclient.APIVersion},
+		Features:         features,
+	}
+
+	cli, err := newDockerClient(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "Unable to create docker client", "err", err)
+		return about
+	}
+	defer cli.Close()
+	if v, err := cli.ServerVersion(ctx); err == nil {
+		about.DockerVersion = v.Version
+		about.DockerNegotiated = cli.ClientVersion()
+	}
+	return about
+}
+
+// handleAbout reports the application version, build info and enabled features.
+func (s *Server) handleAbout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(readAbout(r.Context()))
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"context"
+	"dockerap/apiclient"
+	"dockerap/version"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// legacyDestinationPaths are the destination API paths used before the API
+// moved under /api/v1. Without a handler of their own they would fall through
+// to the container list page, which a source that old would take for success.
+var legacyDestinationPaths = []string{
+	"/api/pull-image",
+	"/api/load-image",
+	"/api/image-layers",
+	"/api/create-container",
+	"/api/create-volume",
+	"/api/create-network",
+	"/api/restore-data",
+	"/api/start-container",
+	"/api/remove-job",
+	"/api/gc",
+	"/api/fingerprint",
+	"/api/volume-manifest",
+	"/api/export-data",
+	"/api/checklist",
+}
+
+// handleLegacyAPI answers requests from sources that predate /api/v1.
+func handleLegacyAPI(w http.ResponseWriter, r *http.Request) {
+	slog.WarnContext(r.Context(), "Request for unversioned destination API", "path", r.URL.Path, "remote_addr", r.RemoteAddr)
+	msg := fmt.Sprintf("This instance (%s) serves the destination API under /api/%s/; upgrade the source to the same version", version.Version, apiclient.APIVersion)
+	http.Error(w, msg, http.StatusGone)
+}
+
+// checkPeerAPI makes sure peer serves the destination API version this
+// instance speaks, so a mixed-version pair fails up front with a clear error
+// instead of with 404s part way through a job.
+func checkPeerAPI(ctx context.Context, httpClient *http.Client, peer string) error {
+	about, err := apiclient.New(peer, httpClient).DestinationAbout(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to check the API version of %s: %w", peer, err)
+	}
+	slog.InfoContext(ctx, "Destination version", "dest", peer, "version", about.String(), "api_versions", about.APIVersions)
+	if len(about.APIVersions) == 0 {
+		return fmt.Errorf("%s runs %s, which predates the /api/%s destination API; upgrade it to %s", peer, about.Version, apiclient.APIVersion, version.Version)
+	}
+	if !slices.Contains(about.APIVersions, apiclient.APIVersion) {
+		return fmt.Errorf("%s runs %s, which serves destination API %s but this instance (%s) needs %s",
+			peer, about.Version, strings.Join(about.APIVersions, ", "), version.Version, apiclient.APIVersion)
+	}
+	return nil
+}
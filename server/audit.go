@@ -0,0 +1,213 @@
+package server
+
+import (
+	"context"
+	"dockerap/store"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+	// maxAuditDetail is how much of a failed response's body is kept as detail
+	maxAuditDetail = 200
+	// auditPruneInterval is how often entries older than AUDIT_RETENTION go
+	auditPruneInterval = time.Hour
+)
+
+type auditKey struct{}
+
+// auditFrom returns the entry an audited request is filling in, or nil.
+func auditFrom(ctx context.Context) *store.AuditEntry {
+	e, _ := ctx.Value(auditKey{}).(*store.AuditEntry)
+	return e
+}
+
+// setAuditAction replaces the action recorded for an audited request, for
+// handlers that know better than the method what the request did.
+func setAuditAction(r *http.Request, action string) {
+	if e := auditFrom(r.Context()); e != nil {
+		e.Action = action
+	}
+}
+
+// setAuditTarget records what an audited request acted on and, when detail
+// is not empty, how.
+func setAuditTarget(r *http.Request, target, detail string) {
+	if e := auditFrom(r.Context()); e != nil {
+		e.Target = target
+		if detail != "" {
+			e.Detail = detail
+		}
+	}
+}
+
+// auditRecorder keeps the status and the start of an error body, which
+// becomes the entry's detail when the handler gave none.
+type auditRecorder struct {
+	http.ResponseWriter
+	status int
+	body   []byte
+}
+
+func (rec *auditRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *auditRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	if rec.status >= 400 && len(rec.body) < maxProblemDetail {
+		rec.body = append(rec.body, b[:min(len(b), maxProblemDetail-len(rec.body))]...)
+	}
+	return rec.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (rec *auditRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// audited records every state-changing request to next in the audit log:
+// who made it, from where, and whether it succeeded. The action is kind and
+// the method, such as destination:put, and the target is the {name} or {id}
+// in the path; handlers may set either, and the outcome, themselves. It wraps
+// the role check, so refused requests are recorded as failed too. GET, HEAD
+// and OPTIONS requests only read and are not recorded.
+func (s *Server) audited(kind string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next(w, r)
+			return
+		}
+		p, _ := principalFrom(r.Context())
+		entry := &store.AuditEntry{
+			Actor:      p.User,
+			RemoteAddr: r.RemoteAddr,
+			Action:     kind + ":" + strings.ToLower(r.Method),
+			Target:     r.PathValue("name"),
+		}
+		if entry.Target == "" {
+			entry.Target = r.PathValue("id")
+		}
+		rec := &auditRecorder{ResponseWriter: w}
+		next(rec, r.WithContext(context.WithValue(r.Context(), auditKey{}, entry)))
+
+		switch {
+		case entry.Outcome != "":
+			// The handler knows better, as for a partly replicated job
+		case rec.status >= 400:
+			entry.Outcome = "failed"
+			if entry.Detail == "" {
+				entry.Detail = auditDetail(rec.body)
+			}
+		default:
+			entry.Outcome = "succeeded"
+		}
+		if err := s.store.RecordAudit(*entry); err != nil {
+			slog.ErrorContext(r.Context(), "Unable to record audit entry", "action", entry.Action, "err", err)
+		}
+	}
+}
+
+// auditDetail turns an error body, plain text or a problem, into a one line
+// detail of at most maxAuditDetail bytes.
+func auditDetail(body []byte) string {
+	var p problem
+	if json.Unmarshal(body, &p) == nil && p.Detail != "" {
+		body = []byte(p.Detail)
+	}
+	detail, _, _ := strings.Cut(strings.TrimSpace(string(body)), "\n")
+	if len(detail) > maxAuditDetail {
+		detail = detail[:maxAuditDetail]
+		for !utf8.ValidString(detail) {
+			detail = detail[:len(detail)-1]
+		}
+	}
+	return detail
+}
+
+// parseAuditFilter reads the actor, action, target, outcome, since and limit
+// parameters. since is an RFC 3339 time or a duration back from now.
+func parseAuditFilter(v url.Values) (store.AuditFilter, error) {
+	f := store.AuditFilter{
+		Actor:   strings.TrimSpace(v.Get("actor")),
+		Action:  strings.TrimSpace(v.Get("action")),
+		Target:  strings.TrimSpace(v.Get("target")),
+		Outcome: strings.TrimSpace(v.Get("outcome")),
+		Limit:   defaultAuditLimit,
+	}
+	if since := strings.TrimSpace(v.Get("since")); since != "" {
+		if d, err := time.ParseDuration(since); err == nil {
+			f.Since = time.Now().Add(-d)
+		} else if t, err := time.Parse(time.RFC3339, since); err == nil {
+			f.Since = t
+		} else {
+			return f, fmt.Errorf("invalid since %q, expected an RFC 3339 time or a duration such as 24h", since)
+		}
+	}
+	if l := v.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 || n > maxAuditLimit {
+			return f, fmt.Errorf("invalid limit %q, expected a number from 1 to %d", l, maxAuditLimit)
+		}
+		f.Limit = n
+	}
+	return f, nil
+}
+
+// handleAudit lists audit entries, newest first.
+func (s *Server) handleAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	f, err := parseAuditFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	entries, err := s.store.GetAudit(f)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to get audit log", "err", err)
+		writeError(w, r, "Unable to get audit log", err)
+		return
+	}
+	if entries == nil {
+		entries = []store.AuditEntry{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// runAuditPruning deletes audit entries older than AUDIT_RETENTION every
+// hour until ctx is done.
+func (s *Server) runAuditPruning(ctx context.Context) {
+	ticker := time.NewTicker(auditPruneInterval)
+	defer ticker.Stop()
+	for {
+		if n, err := s.store.PruneAudit(time.Now().Add(-s.cfg.AuditRetention)); err != nil {
+			slog.ErrorContext(ctx, "Unable to prune audit log", "err", err)
+		} else if n > 0 {
+			slog.InfoContext(ctx, "Pruned audit log", "entries", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"dockerap/store"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAuditLogNeedsAdmin(t *testing.T) {
+	srv := newTestServer(t, testRoles)
+	if err := srv.store.RecordAudit(store.AuditEntry{CreatedAt: time.Now(), Actor: "ada", RemoteAddr: "10.0.0.9", Action: "destination:post", Outcome: "succeeded"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, user := range []string{"vera", "otto"} {
+		if w := serve(t, srv, http.MethodGet, "/api/audit", user, nil); w.Code != http.StatusForbidden {
+			t.Errorf("GET /api/audit as %s: %d, want 403", user, w.Code)
+		}
+	}
+
+	const token = "peer-token-0123456789"
+	if err := srv.store.CreatePeerToken("source", "10.0.0.5", token); err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodGet, "/api/audit", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("GET /api/audit with a peer token: %d, want 401", w.Code)
+	}
+
+	w = serve(t, srv, http.MethodGet, "/api/audit", "ada", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /api/audit as admin: %d %s", w.Code, w.Body)
+	}
+	var entries []store.AuditEntry
+	if err := json.NewDecoder(w.Body).Decode(&entries); err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].RemoteAddr != "10.0.0.9" {
+		t.Errorf("entries = %+v, want the recorded one", entries)
+	}
+}
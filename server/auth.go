@@ -0,0 +1,75 @@
+package server
+
+import (
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// requireToken guards a destination endpoint with the shared API token and,
+// with mutual TLS, a verified client certificate. When neither is configured
+// the endpoint stays open, as before.
+func (s *Server) requireToken(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.cfg.ClientCAs != nil && (r.TLS == nil || len(r.TLS.VerifiedChains) == 0) {
+			slog.WarnContext(r.Context(), "Rejected request without a client certificate", "path", r.URL.Path, "remote_addr", r.RemoteAddr)
+			http.Error(w, "A valid client certificate is required", http.StatusUnauthorized)
+			return
+		}
+		if !s.validPeerToken(r) {
+			slog.WarnContext(r.Context(), "Rejected unauthenticated request", "path", r.URL.Path, "remote_addr", r.RemoteAddr)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="dockerapp"`)
+			http.Error(w, "A valid API token is required", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// validAPIToken reports whether r carries API_TOKEN as a bearer token.
+func (s *Server) validAPIToken(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && s.cfg.APIToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.cfg.APIToken)) == 1
+}
+
+// validPeerToken reports whether r carries API_TOKEN or a token issued by
+// pairing. Without either configured, the destination API is open.
+func (s *Server) validPeerToken(r *http.Request) bool {
+	if s.validAPIToken(r) {
+		return true
+	}
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		valid, err := s.store.PeerTokenValid(token)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Unable to check peer token", "err", err)
+			return false
+		}
+		if valid {
+			return true
+		}
+	}
+	if s.cfg.APIToken != "" {
+		return false
+	}
+	paired, err := s.store.HasPeerTokens()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to check peer tokens", "err", err)
+		return false
+	}
+	return !paired
+}
+
+// tokenTransport adds the shared API token to requests to other instances.
+type tokenTransport struct {
+	base  http.RoundTripper
+	token string
+}
+
+func (t *tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("Authorization") == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("Authorization", "Bearer "+t.token)
+	}
+	return t.base.RoundTrip(req)
+}
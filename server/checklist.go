@@ -0,0 +1,203 @@
+package server
+
+import (
+	"context"
+	"dockerap/apiclient"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Checklist statuses. "manual" items cannot be verified automatically and are
+// listed so the operator confirms them before relying on the destination.
+const (
+	CheckPass   = "pass"
+	CheckWarn   = "warn"
+	CheckFail   = "fail"
+	CheckManual = "manual"
+)
+
+// maxClockSkew is the largest source/destination clock difference tolerated
+// before the checklist reports the hosts as out of sync.
+const maxClockSkew = 5 * time.Second
+
+// networkDriverModules maps network drivers to the kernel module they need.
+var networkDriverModules = map[string]string{
+	"macvlan": "macvlan",
+	"ipvlan":  "ipvlan",
+	"overlay": "vxlan",
+}
+
+// Destination API: Report the local environment checklist
+func (s *Server) handleChecklist(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	cli, err := newDockerClient(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to create docker client", "err", err)
+		writeError(w, r, "Unable to create docker client", err)
+		return
+	}
+	defer cli.Close()
+
+	info, err := cli.Info(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to get Docker info", "err", err)
+		writeError(w, r, "Unable to get Docker info", err)
+		return
+	}
+
+	q := r.URL.Query()
+	var items []apiclient.CheckItem
+
+	// Registry mirrors and insecure registries
+	if info.RegistryConfig != nil && len(info.RegistryConfig.Mirrors) > 0 {
+		items = append(items, apiclient.CheckItem{Name: "registry mirrors", Status: CheckPass, Detail: strings.Join(info.RegistryConfig.Mirrors, ", ")})
+	} else {
+		items = append(items, apiclient.CheckItem{Name: "registry mirrors", Status: CheckWarn, Detail: "none configured",
+			Hint: "set registry-mirrors in daemon.json if this host cannot reach public registries directly"})
+	}
+	if info.RegistryConfig != nil {
+		var insecure []string
+		for name, idx := range info.RegistryConfig.IndexConfigs {
+			if !idx.Secure {
+				insecure = append(insecure, name)
+			}
+		}
+		if len(insecure) > 0 {
+			items = append(items, apiclient.CheckItem{Name: "insecure registries", Status: CheckWarn, Detail: strings.Join(insecure, ", "),
+				Hint: "make sure these match the source daemon's insecure-registries or pulls will fail"})
+		}
+	}
+
+	// Proxy settings
+	if info.HTTPProxy != "" || info.HTTPSProxy != "" {
+		items = append(items, apiclient.CheckItem{Name: "daemon proxy", Status: CheckPass,
+			Detail: fmt.Sprintf("http=%s https=%s no_proxy=%s", info.HTTPProxy, info.HTTPSProxy, info.NoProxy)})
+	} else {
+		items = append(items, apiclient.CheckItem{Name: "daemon proxy", Status: CheckManual, Detail: "no proxy configured",
+			Hint: "confirm this host reaches registries without a proxy"})
+	}
+
+	// Clock synchronisation against the source's clock
+	items = append(items, clockCheck(info.SystemTime, q.Get("sourceTime")))
+
+	// Architecture must match for images to run
+	if arch := q.Get("arch"); arch != "" {
+		if arch == info.Architecture {
+			items = append(items, apiclient.CheckItem{Name: "architecture", Status: CheckPass, Detail: arch})
+		} else {
+			items = append(items, apiclient.CheckItem{Name: "architecture", Status: CheckFail,
+				Detail: fmt.Sprintf("source %s, destination %s", arch, info.Architecture),
+				Hint:   "single-architecture images from the source will not run here"})
+		}
+	}
+
+	// Kernel modules required by replicated networks
+	for _, module := range strings.Split(q.Get("modules"), ",") {
+		if module != "" {
+			items = append(items, kernelModuleCheck(module))
+		}
+	}
+
+	// Host ports the replicas will publish
+	if ports := q.Get("ports"); ports != "" {
+		portItems, err := portChecks(r.Context(), cli, strings.Split(ports, ","))
+		if err != nil {
+			items = append(items, apiclient.CheckItem{Name: "host ports", Status: CheckManual, Detail: err.Error(),
+				Hint: "check that the published ports are free on this host"})
+		}
+		items = append(items, portItems...)
+	}
+
+	for _, warning := range info.Warnings {
+		items = append(items, apiclient.CheckItem{Name: "daemon warning", Status: CheckWarn, Detail: warning})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(items)
+}
+
+// clockCheck compares the daemon clock with the time the source sent the request.
+func clockCheck(daemonTime, sourceTime string) apiclient.CheckItem {
+	item := apiclient.CheckItem{Name: "clock sync"}
+	dt, err := time.Parse(time.RFC3339Nano, daemonTime)
+	if err != nil {
+		item.Status = CheckManual
+		item.Detail = "daemon did not report its time"
+		item.Hint = "verify NTP is running on this host"
+		return item
+	}
+	st, err := time.Parse(time.RFC3339Nano, sourceTime)
+	if err != nil {
+		item.Status = CheckManual
+		item.Detail = "source time not supplied"
+		item.Hint = "verify NTP is running on both hosts"
+		return item
+	}
+
+	skew := dt.Sub(st)
+	if skew < 0 {
+		skew = -skew
+	}
+	item.Detail = fmt.Sprintf("skew %s", skew.Round(time.Millisecond))
+	if skew > maxClockSkew {
+		item.Status = CheckFail
+		item.Hint = "enable NTP (chrony/systemd-timesyncd) on both hosts; TLS and scheduled jobs depend on it"
+	} else {
+		item.Status = CheckPass
+	}
+	return item
+}
+
+// kernelModuleCheck probes /proc/modules and /sys/module for module, which
+// covers both loadable and built-in modules on the host kernel.
+func kernelModuleCheck(module string) apiclient.CheckItem {
+	item := apiclient.CheckItem{Name: "kernel module " + module}
+	if data, err := os.ReadFile("/proc/modules"); err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			if strings.HasPrefix(line, module+" ") {
+				item.Status = CheckPass
+				item.Detail = "loaded"
+				return item
+			}
+		}
+	}
+	if _, err := os.Stat("/sys/module/" + module); err == nil {
+		item.Status = CheckPass
+		item.Detail = "built in"
+		return item
+	}
+	item.Status = CheckWarn
+	item.Detail = "not loaded"
+	item.Hint = fmt.Sprintf("run 'modprobe %s' on the host and add it to /etc/modules-load.d", module)
+	return item
+}
+
+// fetchChecklist asks dest for its checklist, passing along the source facts it compares against.
+func fetchChecklist(ctx context.Context, httpClient *http.Client, dest, arch string, plan *replicationPlan) ([]apiclient.CheckItem, error) {
+	modules := make(map[string]bool)
+	for _, n := range plan.Networks {
+		if m, ok := networkDriverModules[n.Driver]; ok {
+			modules[m] = true
+		}
+	}
+	var moduleList []string
+	for m := range modules {
+		moduleList = append(moduleList, m)
+	}
+
+	return apiclient.New(dest, httpClient).Checklist(ctx, apiclient.ChecklistRequest{
+		SourceTime: time.Now().UTC().Format(time.RFC3339Nano),
+		Arch:       arch,
+		Modules:    moduleList,
+		Ports:      plannedPorts(plan),
+	})
+}
@@ -0,0 +1,171 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/client"
+)
+
+// composeProjectLabel is set by Docker Compose on every resource of a project.
+const composeProjectLabel = "com.docker.compose.project"
+
+// ComposeProject is a Compose project on this host and the resources that belong to it.
+type ComposeProject struct {
+	Name         string   `json:"name"`
+	ContainerIDs []string `json:"containerIds"`
+	Containers   []string `json:"containers"`
+	Volumes      []string `json:"volumes"`
+	Networks     []string `json:"networks"`
+	IsSelected   bool     `json:"isSelected"`
+}
+
+// listComposeProjects groups the containers, volumes and networks on this
+// host by Compose project. Named volumes a project's containers mount count
+// as the project's even when they were declared external.
+func listComposeProjects(ctx context.Context, cli *client.Client) (map[string]*ComposeProject, error) {
+	labelFilter := filters.NewArgs(filters.Arg("label", composeProjectLabel))
+	projects := make(map[string]*ComposeProject)
+	project := func(name string) *ComposeProject {
+		if p, ok := projects[name]; ok {
+			return p
+		}
+		p := &ComposeProject{Name: name, ContainerIDs: []string{}, Containers: []string{}, Volumes: []string{}, Networks: []string{}}
+		projects[name] = p
+		return p
+	}
+	seenVolumes := make(map[string]bool)
+	addVolume := func(p *ComposeProject, name string) {
+		if !seenVolumes[p.Name+"/"+name] {
+			seenVolumes[p.Name+"/"+name] = true
+			p.Volumes = append(p.Volumes, name)
+		}
+	}
+
+	containers, err := cli.ContainerList(ctx, container.ListOptions{All: true, Filters: labelFilter})
+	if err != nil {
+		return nil, fmt.Errorf("list containers: %w", err)
+	}
+	for _, c := range containers {
+		p := project(c.Labels[composeProjectLabel])
+		p.ContainerIDs = append(p.ContainerIDs, c.ID)
+		if len(c.Names) > 0 {
+			p.Containers = append(p.Containers, strings.TrimPrefix(c.Names[0], "/"))
+		}
+		for _, m := range c.Mounts {
+			if m.Type == mount.TypeVolume && m.Name != "" && !isAnonymousVolume(m.Name) {
+				addVolume(p, m.Name)
+			}
+		}
+	}
+
+	volumes, err := cli.VolumeList(ctx, volume.ListOptions{Filters: labelFilter})
+	if err != nil {
+		return nil, fmt.Errorf("list volumes: %w", err)
+	}
+	for _, v := range volumes.Volumes {
+		addVolume(project(v.Labels[composeProjectLabel]), v.Name)
+	}
+
+	networks, err := cli.NetworkList(ctx, types.NetworkListOptions{Filters: labelFilter})
+	if err != nil {
+		return nil, fmt.Errorf("list networks: %w", err)
+	}
+	for _, n := range networks {
+		p := project(n.Labels[composeProjectLabel])
+		p.Networks = append(p.Networks, n.Name)
+	}
+
+	for _, p := range projects {
+		sort.Strings(p.Containers)
+		sort.Strings(p.Volumes)
+		sort.Strings(p.Networks)
+	}
+	return projects, nil
+}
+
+// expandProjects adds the containers and volumes of the selected Compose
+// projects to the selection sets and returns the projects' networks. Members
+// are resolved at replication time, so containers added to a project later
+// are replicated with it.
+func expandProjects(ctx context.Context, cli *client.Client, selected, containers, volumes map[string]bool) ([]string, error) {
+	if len(selected) == 0 {
+		return nil, nil
+	}
+	projects, err := listComposeProjects(ctx, cli)
+	if err != nil {
+		return nil, err
+	}
+	var networks []string
+	for name := range selected {
+		p, ok := projects[name]
+		if !ok {
+			slog.InfoContext(ctx, "Selected compose project has no resources on this host", "name", name)
+			continue
+		}
+		for _, id := range p.ContainerIDs {
+			containers[id] = true
+		}
+		for _, v := range p.Volumes {
+			volumes[v] = true
+		}
+		networks = append(networks, p.Networks...)
+	}
+	return networks, nil
+}
+
+// handleComposeProjects lists the Compose projects on this host with their
+// selection state. Projects are selected through /select with type "project".
+func (s *Server) handleComposeProjects(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	cli, err := newDockerClient(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to create docker client", "err", err)
+		writeError(w, r, "Unable to create docker client", err)
+		return
+	}
+	defer cli.Close()
+
+	projects, err := listComposeProjects(r.Context(), cli)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to list compose projects", "err", err)
+		writeError(w, r, "Unable to list compose projects", err)
+		return
+	}
+	selected, err := s.store.GetSelectedProjects()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to get selected projects", "err", err)
+		writeError(w, r, "Unable to get selected projects", err)
+		return
+	}
+
+	list := make([]*ComposeProject, 0, len(projects))
+	for _, p := range projects {
+		p.IsSelected = selected[p.Name]
+		list = append(list, p)
+	}
+	// Selected projects that no longer exist stay visible so they can be unselected
+	for name := range selected {
+		if _, ok := projects[name]; !ok {
+			list = append(list, &ComposeProject{Name: name, ContainerIDs: []string{}, Containers: []string{}, Volumes: []string{}, Networks: []string{}, IsSelected: true})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
@@ -0,0 +1,342 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/client"
+	"gopkg.in/yaml.v3"
+)
+
+// handleExportCompose writes the selected containers, or a profile's, as a
+// compose file: a portable, reviewable record of what is replicated that
+// /api/compose/up, or docker compose, can bring up elsewhere.
+func (s *Server) handleExportCompose(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	cli, err := newDockerClient(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to create docker client", "err", err)
+		writeError(w, r, "Unable to create docker client", err)
+		return
+	}
+	defer cli.Close()
+
+	profile := r.URL.Query().Get("profile")
+	f, skipped, err := s.exportCompose(r.Context(), cli, profile)
+	if err != nil {
+		writeSelectionError(w, r, err)
+		return
+	}
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(f); err != nil {
+		slog.ErrorContext(r.Context(), "Unable to encode compose file", "err", err)
+		writeError(w, r, "Unable to encode compose file", err)
+		return
+	}
+
+	source := "the current selection"
+	if profile != "" {
+		source = "profile " + profile
+	}
+	host, _ := os.Hostname()
+	w.Header().Set("Content-Type", "application/yaml")
+	fmt.Fprintf(w, "# Exported by DockerApp from %s on %s at %s\n", source, host, time.Now().UTC().Format(time.RFC3339))
+	for _, line := range skipped {
+		fmt.Fprintf(w, "# Skipped: %s\n", line)
+	}
+	w.Write(buf.Bytes())
+}
+
+// exportSelection inspects the selected containers, or a profile's, in the
+// order replication would create them, and returns them with the selected
+// volumes and the containers that could not be inspected.
+func (s *Server) exportSelection(ctx context.Context, cli *client.Client, profile string) ([]plannedContainer, map[string]bool, []string, error) {
+	sel, err := s.loadSelection(ctx, cli, "", profile)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if profile == "" {
+		if err := s.addRuleMatches(ctx, cli, sel); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	if _, err := expandProjects(ctx, cli, sel.Projects, sel.Containers, sel.Volumes); err != nil {
+		return nil, nil, nil, fmt.Errorf("unable to resolve compose projects: %w", err)
+	}
+
+	var skipped []string
+	plan := &replicationPlan{}
+	for id := range sel.Containers {
+		c, err := cli.ContainerInspect(ctx, id)
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to inspect selected container", "container_id", id, "err", err)
+			skipped = append(skipped, fmt.Sprintf("container %s: %s", id, err))
+			continue
+		}
+		plan.Containers = append(plan.Containers, plannedContainer{Inspect: c, Name: containerName(c)})
+	}
+	orderPlanContainers(plan)
+	return plan.Containers, sel.Volumes, skipped, nil
+}
+
+// exportCompose converts the selection's containers, with the named volumes
+// and user-defined networks they use, to a compose file. Names are kept as
+// they are on this host, so bringing the file up elsewhere creates the same
+// names. It returns the items that could not be exported.
+func (s *Server) exportCompose(ctx context.Context, cli *client.Client, profile string) (*composeFile, []string, error) {
+	containers, volumes, skipped, err := s.exportSelection(ctx, cli, profile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	f := &composeFile{
+		Services: make(map[string]composeService),
+		Networks: make(map[string]*composeNetwork),
+		Volumes:  make(map[string]*composeVolume),
+	}
+	for name := range volumes {
+		f.Volumes[name] = nil
+	}
+	for _, pc := range containers {
+		svc, err := exportComposeService(ctx, cli, pc)
+		if err != nil {
+			skipped = append(skipped, fmt.Sprintf("container %s: %s", pc.Name, err))
+			continue
+		}
+		for _, m := range svc.Volumes {
+			if m.Type == "volume" && m.Source != "" {
+				f.Volumes[m.Source] = nil
+			}
+		}
+		for name := range svc.Networks {
+			f.Networks[name] = nil
+		}
+		f.Services[pc.Name] = svc
+	}
+
+	for name := range f.Volumes {
+		v, err := cli.VolumeInspect(ctx, name)
+		if err != nil {
+			skipped = append(skipped, fmt.Sprintf("volume %s: %s", name, err))
+			delete(f.Volumes, name)
+			continue
+		}
+		cv := &composeVolume{Name: v.Name, DriverOpts: v.Options, Labels: exportLabels(v.Labels)}
+		if v.Driver != "local" {
+			cv.Driver = v.Driver
+		}
+		f.Volumes[name] = cv
+	}
+	if len(f.Networks) > 0 {
+		networks, err := userNetworks(ctx, cli)
+		if err != nil {
+			return nil, nil, err
+		}
+		for name := range f.Networks {
+			n, ok := networks[name]
+			if !ok {
+				skipped = append(skipped, fmt.Sprintf("network %s: no such network", name))
+				delete(f.Networks, name)
+				continue
+			}
+			cn := &composeNetwork{Name: n.Name, DriverOpts: n.Options, Internal: n.Internal, Attachable: n.Attachable, EnableIPv6: n.EnableIPv6, Labels: exportLabels(n.Labels)}
+			if n.Driver != "bridge" {
+				cn.Driver = n.Driver
+			}
+			for _, c := range n.IPAM.Config {
+				cn.IPAM.Config = append(cn.IPAM.Config, composeIPAMConfig{Subnet: c.Subnet, Gateway: c.Gateway, IPRange: c.IPRange})
+			}
+			f.Networks[name] = cn
+		}
+	}
+	return f, skipped, nil
+}
+
+// exportComposeService describes one container as a compose service. The
+// command, entrypoint, environment and labels its image already sets are
+// left out, so the file shows what the container adds.
+func exportComposeService(ctx context.Context, cli *client.Client, pc plannedContainer) (composeService, error) {
+	c := pc.Inspect
+	if c.ContainerJSONBase == nil || c.Config == nil || c.HostConfig == nil {
+		return composeService{}, fmt.Errorf("incomplete inspect output from Docker")
+	}
+	var imageConfig *container.Config
+	if img, _, err := cli.ImageInspectWithRaw(ctx, c.Image); err == nil {
+		imageConfig = img.Config
+	} else {
+		slog.WarnContext(ctx, "Unable to inspect image; exporting the full container config", "image", c.Config.Image, "err", err)
+	}
+
+	svc := composeService{
+		Image:         c.Config.Image,
+		ContainerName: pc.Name,
+		Environment:   composeMapping{},
+		Labels:        composeMapping{},
+		Hostname:      exportHostname(c),
+		User:          c.Config.User,
+		WorkingDir:    c.Config.WorkingDir,
+		Privileged:    c.HostConfig.Privileged,
+		ReadOnly:      c.HostConfig.ReadonlyRootfs,
+		CapAdd:        c.HostConfig.CapAdd,
+		CapDrop:       c.HostConfig.CapDrop,
+		ExtraHosts:    c.HostConfig.ExtraHosts,
+		TTY:           c.Config.Tty,
+		StdinOpen:     c.Config.OpenStdin,
+		DependsOn:     pc.DependsOn,
+		Restart:       exportRestartPolicy(c.HostConfig.RestartPolicy),
+	}
+	// Setting an entrypoint clears the image's command, so a changed
+	// entrypoint is written with the command
+	entrypointChanged := imageConfig == nil || !slices.Equal(c.Config.Entrypoint, imageConfig.Entrypoint)
+	if entrypointChanged || !slices.Equal(c.Config.Cmd, imageConfig.Cmd) {
+		svc.Command = composeCommand(c.Config.Cmd)
+	}
+	if entrypointChanged {
+		svc.Entrypoint = composeCommand(c.Config.Entrypoint)
+	}
+	if imageConfig != nil {
+		if svc.User == imageConfig.User {
+			svc.User = ""
+		}
+		if svc.WorkingDir == imageConfig.WorkingDir {
+			svc.WorkingDir = ""
+		}
+	}
+
+	imageEnv := make(map[string]bool)
+	imageLabels := make(map[string]string)
+	if imageConfig != nil {
+		for _, kv := range imageConfig.Env {
+			imageEnv[kv] = true
+		}
+		imageLabels = imageConfig.Labels
+	}
+	for _, kv := range c.Config.Env {
+		if imageEnv[kv] {
+			continue
+		}
+		k, v, _ := strings.Cut(kv, "=")
+		svc.Environment[k] = &v
+	}
+	for k, v := range exportLabels(c.Config.Labels) {
+		if iv, ok := imageLabels[k]; !ok || iv != *v {
+			svc.Labels[k] = v
+		}
+	}
+
+	for port, bindings := range c.HostConfig.PortBindings {
+		for _, b := range bindings {
+			spec := port.Port()
+			if b.HostPort != "" {
+				spec = b.HostPort + ":" + spec
+				if b.HostIP != "" {
+					spec = b.HostIP + ":" + spec
+				}
+			}
+			if port.Proto() != "tcp" {
+				spec += "/" + port.Proto()
+			}
+			svc.Ports = append(svc.Ports, composePort(spec))
+		}
+	}
+	slices.Sort(svc.Ports)
+
+	for _, m := range c.Mounts {
+		switch m.Type {
+		case mount.TypeVolume:
+			cm := composeMount{Type: "volume", Target: m.Destination, ReadOnly: !m.RW}
+			if !isAnonymousVolume(m.Name) {
+				cm.Source = m.Name
+			}
+			svc.Volumes = append(svc.Volumes, cm)
+		case mount.TypeBind:
+			svc.Volumes = append(svc.Volumes, composeMount{Type: "bind", Source: m.Source, Target: m.Destination, ReadOnly: !m.RW})
+		}
+	}
+
+	mode := c.HostConfig.NetworkMode
+	switch {
+	case mode.IsHost() || mode.IsNone():
+		svc.NetworkMode = string(mode)
+	case mode.IsContainer():
+		return svc, fmt.Errorf("shares the network of another container (%s)", mode)
+	default:
+		svc.Networks = composeServiceNetworks{}
+		for name, ep := range c.NetworkSettings.Networks {
+			if isPredefinedNetwork(name) {
+				svc.NetworkMode = name
+				continue
+			}
+			svc.Networks[name] = exportAliases(c, ep.Aliases)
+		}
+		if len(svc.Networks) > 0 {
+			svc.NetworkMode = ""
+		}
+	}
+	return svc, nil
+}
+
+// exportLabels drops the labels Compose and DockerApp set themselves, which
+// are set again when the file is brought up.
+func exportLabels(l map[string]string) composeMapping {
+	out := composeMapping{}
+	for k, v := range l {
+		if strings.HasPrefix(k, "com.docker.compose.") || strings.HasPrefix(k, "dockerapp.") {
+			continue
+		}
+		out[k] = &v
+	}
+	return out
+}
+
+// exportAliases drops the aliases Docker and Compose add on their own: the
+// container's short ID, its name and its Compose service name.
+func exportAliases(c types.ContainerJSON, aliases []string) []string {
+	var out []string
+	for _, a := range aliases {
+		if strings.HasPrefix(c.ID, a) || a == containerName(c) || a == c.Config.Labels[composeServiceLabel] {
+			continue
+		}
+		out = append(out, a)
+	}
+	return out
+}
+
+// exportHostname returns the hostname when it was set, not defaulted to the
+// short container ID.
+func exportHostname(c types.ContainerJSON) string {
+	if c.Config.Hostname == "" || strings.HasPrefix(c.ID, c.Config.Hostname) {
+		return ""
+	}
+	return c.Config.Hostname
+}
+
+// exportRestartPolicy converts a restart policy to Compose's restart value.
+func exportRestartPolicy(p container.RestartPolicy) string {
+	switch p.Name {
+	case "", container.RestartPolicyDisabled:
+		return ""
+	case container.RestartPolicyOnFailure:
+		if p.MaximumRetryCount > 0 {
+			return "on-failure:" + strconv.Itoa(p.MaximumRetryCount)
+		}
+	}
+	return string(p.Name)
+}
@@ -0,0 +1,462 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// composeFile is the part of the Compose file format /api/compose/up
+// understands and /api/export/compose writes. Keys outside it are reported
+// as warnings, not errors, so a file written for docker compose can be used
+// as it is.
+type composeFile struct {
+	Name     string                     `yaml:"name,omitempty"`
+	Services map[string]composeService  `yaml:"services,omitempty"`
+	Networks map[string]*composeNetwork `yaml:"networks,omitempty"`
+	Volumes  map[string]*composeVolume  `yaml:"volumes,omitempty"`
+}
+
+type composeService struct {
+	Image         string                 `yaml:"image,omitempty"`
+	ContainerName string                 `yaml:"container_name,omitempty"`
+	Command       composeCommand         `yaml:"command,omitempty"`
+	Entrypoint    composeCommand         `yaml:"entrypoint,omitempty"`
+	Environment   composeMapping         `yaml:"environment,omitempty"`
+	Labels        composeMapping         `yaml:"labels,omitempty"`
+	Ports         []composePort          `yaml:"ports,omitempty"`
+	Volumes       []composeMount         `yaml:"volumes,omitempty"`
+	Networks      composeServiceNetworks `yaml:"networks,omitempty"`
+	NetworkMode   string                 `yaml:"network_mode,omitempty"`
+	DependsOn     composeDependsOn       `yaml:"depends_on,omitempty"`
+	Restart       string                 `yaml:"restart,omitempty"`
+	Hostname      string                 `yaml:"hostname,omitempty"`
+	User          string                 `yaml:"user,omitempty"`
+	WorkingDir    string                 `yaml:"working_dir,omitempty"`
+	Privileged    bool                   `yaml:"privileged,omitempty"`
+	ReadOnly      bool                   `yaml:"read_only,omitempty"`
+	CapAdd        []string               `yaml:"cap_add,omitempty"`
+	CapDrop       []string               `yaml:"cap_drop,omitempty"`
+	ExtraHosts    []string               `yaml:"extra_hosts,omitempty"`
+	TTY           bool                   `yaml:"tty,omitempty"`
+	StdinOpen     bool                   `yaml:"stdin_open,omitempty"`
+}
+
+// composeServiceKeys are the service keys composeService reads.
+var composeServiceKeys = map[string]bool{
+	"image": true, "container_name": true, "command": true, "entrypoint": true,
+	"environment": true, "labels": true, "ports": true, "volumes": true,
+	"networks": true, "network_mode": true, "depends_on": true, "restart": true,
+	"hostname": true, "user": true, "working_dir": true, "privileged": true,
+	"read_only": true, "cap_add": true, "cap_drop": true, "extra_hosts": true,
+	"tty": true, "stdin_open": true,
+}
+
+type composeNetwork struct {
+	Name       string            `yaml:"name,omitempty"`
+	External   bool              `yaml:"external,omitempty"`
+	Driver     string            `yaml:"driver,omitempty"`
+	DriverOpts map[string]string `yaml:"driver_opts,omitempty"`
+	Internal   bool              `yaml:"internal,omitempty"`
+	Attachable bool              `yaml:"attachable,omitempty"`
+	EnableIPv6 bool              `yaml:"enable_ipv6,omitempty"`
+	Labels     composeMapping    `yaml:"labels,omitempty"`
+	IPAM       composeIPAM       `yaml:"ipam,omitempty"`
+}
+
+type composeIPAM struct {
+	Driver string              `yaml:"driver,omitempty"`
+	Config []composeIPAMConfig `yaml:"config,omitempty"`
+}
+
+type composeIPAMConfig struct {
+	Subnet  string `yaml:"subnet,omitempty"`
+	Gateway string `yaml:"gateway,omitempty"`
+	IPRange string `yaml:"ip_range,omitempty"`
+}
+
+type composeVolume struct {
+	Name       string            `yaml:"name,omitempty"`
+	External   bool              `yaml:"external,omitempty"`
+	Driver     string            `yaml:"driver,omitempty"`
+	DriverOpts map[string]string `yaml:"driver_opts,omitempty"`
+	Labels     composeMapping    `yaml:"labels,omitempty"`
+}
+
+// composeCommand is a command given as a list, or as a string that is split
+// like a shell would.
+type composeCommand []string
+
+func (c *composeCommand) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode {
+		words, err := splitShellWords(n.Value)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", n.Line, err)
+		}
+		*c = words
+		return nil
+	}
+	var list []string
+	if err := n.Decode(&list); err != nil {
+		return err
+	}
+	*c = list
+	return nil
+}
+
+// splitShellWords splits s on unquoted whitespace, honouring single and
+// double quotes and backslash escapes.
+func splitShellWords(s string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	escaped := false
+	for _, r := range s {
+		switch {
+		case escaped:
+			word.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inWord = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("unterminated quote or escape in %q", s)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// composeMapping is an environment or label set, written either as a map or
+// as a list of KEY=VALUE. A key without a value maps to nil: Compose would
+// take it from the shell, which this host does not have.
+type composeMapping map[string]*string
+
+func (m *composeMapping) UnmarshalYAML(n *yaml.Node) error {
+	out := make(composeMapping)
+	switch n.Kind {
+	case yaml.SequenceNode:
+		for _, item := range n.Content {
+			k, v, ok := strings.Cut(item.Value, "=")
+			if ok {
+				out[k] = &v
+			} else {
+				out[k] = nil
+			}
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			k, v := n.Content[i].Value, n.Content[i+1]
+			if v.Tag == "!!null" {
+				out[k] = nil
+				continue
+			}
+			value := v.Value
+			out[k] = &value
+		}
+	default:
+		return fmt.Errorf("line %d: expected a map or a list", n.Line)
+	}
+	*m = out
+	return nil
+}
+
+// values returns the mapping as a map, dropping the keys without a value.
+func (m composeMapping) values() map[string]string {
+	out := make(map[string]string, len(m))
+	for k, v := range m {
+		if v != nil {
+			out[k] = *v
+		}
+	}
+	return out
+}
+
+// unset returns the keys without a value, sorted.
+func (m composeMapping) unset() []string {
+	var keys []string
+	for k, v := range m {
+		if v == nil {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// composePort is a port in the short syntax ("127.0.0.1:8080:80/udp"); the
+// long syntax is converted to it.
+type composePort string
+
+func (p *composePort) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode {
+		*p = composePort(n.Value)
+		return nil
+	}
+	var long struct {
+		Target    string `yaml:"target"`
+		Published string `yaml:"published"`
+		HostIP    string `yaml:"host_ip"`
+		Protocol  string `yaml:"protocol"`
+	}
+	if err := n.Decode(&long); err != nil {
+		return err
+	}
+	if long.Target == "" {
+		return fmt.Errorf("line %d: port has no target", n.Line)
+	}
+	spec := long.Target
+	if long.Published != "" {
+		spec = long.Published + ":" + spec
+		if long.HostIP != "" {
+			spec = long.HostIP + ":" + spec
+		}
+	}
+	if long.Protocol != "" {
+		spec += "/" + long.Protocol
+	}
+	*p = composePort(spec)
+	return nil
+}
+
+// MarshalYAML quotes the port, since YAML 1.1 reads 22:22 as a number.
+func (p composePort) MarshalYAML() (interface{}, error) {
+	return &yaml.Node{Kind: yaml.ScalarNode, Style: yaml.DoubleQuotedStyle, Value: string(p)}, nil
+}
+
+// composeMount is a service volume in either syntax. Source is empty for an
+// anonymous volume.
+type composeMount struct {
+	Type     string // "volume" or "bind"
+	Source   string
+	Target   string
+	ReadOnly bool
+}
+
+func (m *composeMount) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode {
+		parts := strings.Split(n.Value, ":")
+		switch len(parts) {
+		case 1:
+			*m = composeMount{Type: "volume", Target: parts[0]}
+		case 2, 3:
+			*m = composeMount{Type: "volume", Source: parts[0], Target: parts[1]}
+			if len(parts) == 3 {
+				for _, opt := range strings.Split(parts[2], ",") {
+					m.ReadOnly = m.ReadOnly || opt == "ro"
+				}
+			}
+		default:
+			return fmt.Errorf("line %d: invalid volume %q", n.Line, n.Value)
+		}
+		if isComposeHostPath(m.Source) {
+			m.Type = "bind"
+		}
+		return nil
+	}
+	var long struct {
+		Type     string `yaml:"type"`
+		Source   string `yaml:"source"`
+		Target   string `yaml:"target"`
+		ReadOnly bool   `yaml:"read_only"`
+	}
+	if err := n.Decode(&long); err != nil {
+		return err
+	}
+	*m = composeMount(long)
+	if m.Type == "" {
+		m.Type = "volume"
+	}
+	return nil
+}
+
+// MarshalYAML writes the short syntax.
+func (m composeMount) MarshalYAML() (interface{}, error) {
+	return m.shortSyntax(), nil
+}
+
+// shortSyntax returns the mount as source:target[:ro], the form docker run
+// -v also takes.
+func (m composeMount) shortSyntax() string {
+	spec := m.Target
+	if m.Source != "" {
+		spec = m.Source + ":" + spec
+	}
+	if m.ReadOnly {
+		spec += ":ro"
+	}
+	return spec
+}
+
+// isComposeHostPath reports whether a short-syntax volume source is a host
+// path rather than a volume name.
+func isComposeHostPath(source string) bool {
+	return strings.HasPrefix(source, "/") || strings.HasPrefix(source, ".") || strings.HasPrefix(source, "~")
+}
+
+// composeServiceNetworks maps the networks a service joins to the aliases it
+// has on each. Written either as a list of names or as a map.
+type composeServiceNetworks map[string][]string
+
+func (c *composeServiceNetworks) UnmarshalYAML(n *yaml.Node) error {
+	out := make(composeServiceNetworks)
+	switch n.Kind {
+	case yaml.SequenceNode:
+		for _, item := range n.Content {
+			out[item.Value] = nil
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			var opts struct {
+				Aliases []string `yaml:"aliases"`
+			}
+			if err := n.Content[i+1].Decode(&opts); err != nil {
+				return err
+			}
+			out[n.Content[i].Value] = opts.Aliases
+		}
+	default:
+		return fmt.Errorf("line %d: expected a map or a list of networks", n.Line)
+	}
+	*c = out
+	return nil
+}
+
+// MarshalYAML writes a list of names unless a network has aliases.
+func (c composeServiceNetworks) MarshalYAML() (interface{}, error) {
+	type options struct {
+		Aliases []string `yaml:"aliases,omitempty"`
+	}
+	withAliases := make(map[string]*options, len(c))
+	hasAliases := false
+	for name, aliases := range c {
+		withAliases[name] = &options{Aliases: aliases}
+		hasAliases = hasAliases || len(aliases) > 0
+	}
+	if hasAliases {
+		return withAliases, nil
+	}
+	return sortedKeys(c), nil
+}
+
+// composeDependsOn lists the services a service depends on. Conditions in
+// the map syntax are ignored: services are only created in order.
+type composeDependsOn []string
+
+func (d *composeDependsOn) UnmarshalYAML(n *yaml.Node) error {
+	var out []string
+	switch n.Kind {
+	case yaml.SequenceNode:
+		if err := n.Decode(&out); err != nil {
+			return err
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			out = append(out, n.Content[i].Value)
+		}
+	default:
+		return fmt.Errorf("line %d: expected a map or a list of services", n.Line)
+	}
+	*d = out
+	return nil
+}
+
+// composeProjectPattern is what Compose accepts as a project name.
+var composeProjectPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// parseComposeFile decodes a Compose file and returns it with warnings for
+// what it contains that will be ignored.
+func parseComposeFile(data []byte) (*composeFile, []string, error) {
+	var f composeFile
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, nil, fmt.Errorf("invalid compose file: %w", err)
+	}
+	if len(f.Services) == 0 {
+		return nil, nil, fmt.Errorf("invalid compose file: no services")
+	}
+
+	var warnings []string
+	if bytes.Contains(data, []byte("${")) {
+		warnings = append(warnings, "variables such as ${VAR} are not substituted")
+	}
+	var raw struct {
+		Services map[string]map[string]yaml.Node `yaml:"services"`
+	}
+	if err := yaml.Unmarshal(data, &raw); err == nil {
+		for _, name := range sortedKeys(raw.Services) {
+			var ignored []string
+			for key := range raw.Services[name] {
+				if !composeServiceKeys[key] {
+					ignored = append(ignored, key)
+				}
+			}
+			if len(ignored) > 0 {
+				sort.Strings(ignored)
+				warnings = append(warnings, fmt.Sprintf("service %s: ignored %s", name, strings.Join(ignored, ", ")))
+			}
+		}
+	}
+	for _, name := range sortedKeys(f.Services) {
+		if unset := f.Services[name].Environment.unset(); len(unset) > 0 {
+			warnings = append(warnings, fmt.Sprintf("service %s: no value for %s", name, strings.Join(unset, ", ")))
+		}
+	}
+	return &f, warnings, nil
+}
+
+// composeRestartPolicy converts a Compose restart value.
+func composeRestartPolicy(restart string) (name string, retries int, err error) {
+	name, count, hasCount := strings.Cut(restart, ":")
+	switch name {
+	case "", "no", "always", "unless-stopped":
+		if hasCount {
+			return "", 0, fmt.Errorf("invalid restart policy %q", restart)
+		}
+	case "on-failure":
+		if hasCount {
+			if retries, err = strconv.Atoi(count); err != nil || retries < 0 {
+				return "", 0, fmt.Errorf("invalid restart policy %q", restart)
+			}
+		}
+	default:
+		return "", 0, fmt.Errorf("invalid restart policy %q", restart)
+	}
+	return name, retries, nil
+}
+
+// composeBindSource checks a bind mount source. Paths relative to the
+// project directory cannot be resolved, since only the file is uploaded.
+func composeBindSource(source string) (string, error) {
+	if !strings.HasPrefix(source, "/") {
+		return "", fmt.Errorf("bind mount %q is relative to the project directory; use an absolute path", source)
+	}
+	return path.Clean(source), nil
+}
@@ -0,0 +1,254 @@
+package server
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/go-connections/nat"
+)
+
+// parseService parses a file with a single service named app and returns it.
+func parseService(t *testing.T, service string) composeService {
+	t.Helper()
+	f, _, err := parseComposeFile([]byte("services:\n  app:\n    image: nginx\n" + service))
+	if err != nil {
+		t.Fatalf("parseComposeFile: %v", err)
+	}
+	return f.Services["app"]
+}
+
+func TestComposePortSyntaxes(t *testing.T) {
+	tests := []struct {
+		name  string
+		ports string
+		want  []composePort
+	}{
+		{"short", `
+    ports:
+      - "80"
+      - "8080:80"
+      - "127.0.0.1:5353:53/udp"
+`, []composePort{"80", "8080:80", "127.0.0.1:5353:53/udp"}},
+		{"long", `
+    ports:
+      - target: 80
+      - target: 80
+        published: 8080
+      - target: 53
+        published: "5353"
+        host_ip: 127.0.0.1
+        protocol: udp
+`, []composePort{"80", "8080:80", "127.0.0.1:5353:53/udp"}},
+		{"host ip without a published port", `
+    ports:
+      - target: 80
+        host_ip: 127.0.0.1
+`, []composePort{"80"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseService(t, tt.ports).Ports; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ports = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, _, err := parseComposeFile([]byte("services:\n  app:\n    image: nginx\n    ports:\n      - published: 8080\n")); err == nil {
+		t.Error("a long-syntax port without a target parsed")
+	}
+}
+
+func TestComposeMountSyntaxes(t *testing.T) {
+	tests := []struct {
+		name    string
+		volumes string
+		want    []composeMount
+	}{
+		{"short", `
+    volumes:
+      - /var/cache
+      - data:/var/lib/data
+      - data:/srv:ro,z
+      - /etc/app:/etc/app:ro
+      - ./conf:/conf
+`, []composeMount{
+			{Type: "volume", Target: "/var/cache"},
+			{Type: "volume", Source: "data", Target: "/var/lib/data"},
+			{Type: "volume", Source: "data", Target: "/srv", ReadOnly: true},
+			{Type: "bind", Source: "/etc/app", Target: "/etc/app", ReadOnly: true},
+			{Type: "bind", Source: "./conf", Target: "/conf"},
+		}},
+		{"long", `
+    volumes:
+      - target: /var/cache
+      - type: volume
+        source: data
+        target: /var/lib/data
+      - type: bind
+        source: /etc/app
+        target: /etc/app
+        read_only: true
+`, []composeMount{
+			{Type: "volume", Target: "/var/cache"},
+			{Type: "volume", Source: "data", Target: "/var/lib/data"},
+			{Type: "bind", Source: "/etc/app", Target: "/etc/app", ReadOnly: true},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseService(t, tt.volumes).Volumes; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("volumes = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if _, _, err := parseComposeFile([]byte("services:\n  app:\n    image: nginx\n    volumes:\n      - a:b:ro:extra\n")); err == nil {
+		t.Error("a short-syntax volume with four parts parsed")
+	}
+}
+
+func TestComposeDependsOnSyntaxes(t *testing.T) {
+	tests := []struct {
+		name      string
+		dependsOn string
+		want      composeDependsOn
+	}{
+		{"list", `
+    depends_on:
+      - db
+      - cache
+`, composeDependsOn{"db", "cache"}},
+		{"map", `
+    depends_on:
+      db:
+        condition: service_healthy
+      cache:
+        condition: service_started
+`, composeDependsOn{"db", "cache"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseService(t, tt.dependsOn).DependsOn; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("depends_on = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveComposeStack(t *testing.T) {
+	f, warnings, err := parseComposeFile([]byte(`
+services:
+  web:
+    image: nginx:1.27
+    ports:
+      - "8080:80"
+      - target: 443
+        published: 8443
+    volumes:
+      - static:/usr/share/nginx/html:ro
+    depends_on:
+      app:
+        condition: service_healthy
+  app:
+    image: shop/app:2
+    depends_on: [db]
+    build: .
+  db:
+    image: postgres:16
+    volumes:
+      - type: volume
+        source: pgdata
+        target: /var/lib/postgresql/data
+volumes:
+  static:
+  pgdata:
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(warnings, "; ") != "service app: ignored build" {
+		t.Errorf("warnings = %q, want build reported as ignored", warnings)
+	}
+
+	stack, err := resolveComposeStack(f, "shop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var order []string
+	for _, c := range stack.Containers {
+		order = append(order, c.Name)
+	}
+	if got, want := strings.Join(order, " "), "shop-db-1 shop-app-1 shop-web-1"; got != want {
+		t.Errorf("containers in order %s, want %s", got, want)
+	}
+
+	web := stack.Containers[2]
+	if got := web.Config.Labels[composeDependsOnLabel]; got != "app:service_started:false" {
+		t.Errorf("web's depends_on label = %q", got)
+	}
+	wantPorts := nat.PortMap{
+		"80/tcp":  {{HostPort: "8080"}},
+		"443/tcp": {{HostPort: "8443"}},
+	}
+	if !reflect.DeepEqual(web.HostConfig.PortBindings, wantPorts) {
+		t.Errorf("web's port bindings = %v, want %v", web.HostConfig.PortBindings, wantPorts)
+	}
+	wantMounts := []mount.Mount{{Type: mount.TypeVolume, Source: "shop_static", Target: "/usr/share/nginx/html", ReadOnly: true}}
+	if !reflect.DeepEqual(web.HostConfig.Mounts, wantMounts) {
+		t.Errorf("web's mounts = %+v, want %+v", web.HostConfig.Mounts, wantMounts)
+	}
+	if len(stack.Networks) != 1 || stack.Networks[0].Name != "shop_default" {
+		t.Errorf("networks = %+v, want the project's default network", stack.Networks)
+	}
+}
+
+func TestResolveComposeStackRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		want string // in the error
+	}{
+		{"cycle", `
+services:
+  a: {image: busybox, depends_on: [b]}
+  b: {image: busybox, depends_on: [c]}
+  c: {image: busybox, depends_on: [a]}
+  d: {image: busybox}
+`, "cycle: a, b, c"},
+		{"cycle in the map syntax", `
+services:
+  a: {image: busybox, depends_on: {b: {condition: service_healthy}}}
+  b: {image: busybox, depends_on: {a: {condition: service_started}}}
+`, "cycle: a, b"},
+		{"undefined dependency", `
+services:
+  a: {image: busybox, depends_on: [db]}
+`, "undefined service db"},
+		{"undeclared volume", `
+services:
+  a: {image: busybox, volumes: ["data:/data"]}
+`, "volume data is not declared"},
+		{"relative bind", `
+services:
+  a: {image: busybox, volumes: ["./conf:/conf"]}
+`, "relative to the project directory"},
+		{"no image", `
+services:
+  a: {command: ["true"]}
+`, "no image"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, _, err := parseComposeFile([]byte(tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = resolveComposeStack(f, "p")
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,542 @@
+package server
+
+import (
+	"context"
+	"dockerap/startorder"
+	"dockerap/store"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/client"
+	"github.com/docker/go-connections/nat"
+)
+
+// maxComposeFileSize bounds the body of /api/compose/up.
+const maxComposeFileSize = 1 << 20
+
+// Labels Docker Compose sets on the resources of a project, besides
+// composeProjectLabel and composeServiceLabel.
+const (
+	composeNetworkLabel   = "com.docker.compose.network"
+	composeVolumeLabel    = "com.docker.compose.volume"
+	composeNumberLabel    = "com.docker.compose.container-number"
+	composeOneoffLabel    = "com.docker.compose.oneoff"
+	composeDefaultNetwork = "default"
+)
+
+// composeStack is a Compose file resolved for one project: the Docker names
+// and settings of everything it creates, with the containers in start order.
+type composeStack struct {
+	Project    string
+	Networks   []composeStackNetwork
+	Volumes    []composeStackVolume
+	Containers []composeStackContainer
+}
+
+type composeStackNetwork struct {
+	Name     string
+	External bool
+	Create   types.NetworkCreate
+}
+
+type composeStackVolume struct {
+	Name     string
+	External bool
+	Create   volume.CreateOptions
+}
+
+type composeStackContainer struct {
+	Name       string
+	Service    string
+	Config     *container.Config
+	HostConfig *container.HostConfig
+	Networks   []string            // joined in order; the first at create
+	Aliases    map[string][]string // network -> aliases
+}
+
+// ComposeUpItem is the outcome for one network, volume or container.
+type ComposeUpItem struct {
+	Name    string `json:"name"`
+	Service string `json:"service,omitempty"`
+	ID      string `json:"id,omitempty"`
+	Status  string `json:"status"` // planned, created, exists or failed
+	Error   string `json:"error,omitempty"`
+}
+
+// ComposeUpResult is the response of /api/compose/up.
+type ComposeUpResult struct {
+	Project    string          `json:"project"`
+	DryRun     bool            `json:"dryRun"`
+	Networks   []ComposeUpItem `json:"networks"`
+	Volumes    []ComposeUpItem `json:"volumes"`
+	Containers []ComposeUpItem `json:"containers"`
+	Warnings   []string        `json:"warnings"`
+}
+
+// resolveComposeStack turns a parsed file into the resources to create for
+// project, named and labelled as docker compose would so the stack shows up
+// as a Compose project.
+func resolveComposeStack(f *composeFile, project string) (*composeStack, error) {
+	stack := &composeStack{Project: project}
+	projectLabels := func(extra map[string]string, key, value string) map[string]string {
+		l := map[string]string{composeProjectLabel: project, key: value}
+		for k, v := range extra {
+			l[k] = v
+		}
+		return l
+	}
+
+	// Services without networks or network_mode join the project's default network
+	networks := make(map[string]*composeNetwork, len(f.Networks))
+	for key, n := range f.Networks {
+		if n == nil {
+			n = &composeNetwork{}
+		}
+		networks[key] = n
+	}
+	for _, svc := range f.Services {
+		if len(svc.Networks) == 0 && svc.NetworkMode == "" && networks[composeDefaultNetwork] == nil {
+			networks[composeDefaultNetwork] = &composeNetwork{}
+		}
+	}
+	networkNames := make(map[string]string, len(networks))
+	for _, key := range sortedKeys(networks) {
+		n := networks[key]
+		name := n.Name
+		if name == "" {
+			if n.External {
+				name = key
+			} else {
+				name = project + "_" + key
+			}
+		}
+		networkNames[key] = name
+		sn := composeStackNetwork{Name: name, External: n.External}
+		if !n.External {
+			sn.Create = types.NetworkCreate{
+				Driver:     n.Driver,
+				Options:    n.DriverOpts,
+				Internal:   n.Internal,
+				Attachable: n.Attachable,
+				EnableIPv6: n.EnableIPv6,
+				Labels:     projectLabels(n.Labels.values(), composeNetworkLabel, key),
+			}
+			if n.IPAM.Driver != "" || len(n.IPAM.Config) > 0 {
+				ipam := &network.IPAM{Driver: n.IPAM.Driver}
+				for _, c := range n.IPAM.Config {
+					ipam.Config = append(ipam.Config, network.IPAMConfig{Subnet: c.Subnet, Gateway: c.Gateway, IPRange: c.IPRange})
+				}
+				sn.Create.IPAM = ipam
+			}
+		}
+		stack.Networks = append(stack.Networks, sn)
+	}
+
+	volumeNames := make(map[string]string, len(f.Volumes))
+	for _, key := range sortedKeys(f.Volumes) {
+		v := f.Volumes[key]
+		if v == nil {
+			v = &composeVolume{}
+		}
+		name := v.Name
+		if name == "" {
+			if v.External {
+				name = key
+			} else {
+				name = project + "_" + key
+			}
+		}
+		volumeNames[key] = name
+		sv := composeStackVolume{Name: name, External: v.External}
+		if !v.External {
+			sv.Create = volume.CreateOptions{
+				Name:       name,
+				Driver:     v.Driver,
+				DriverOpts: v.DriverOpts,
+				Labels:     projectLabels(v.Labels.values(), composeVolumeLabel, key),
+			}
+		}
+		stack.Volumes = append(stack.Volumes, sv)
+	}
+
+	deps := make(map[string][]string, len(f.Services))
+	byService := make(map[string]composeStackContainer, len(f.Services))
+	for _, service := range sortedKeys(f.Services) {
+		svc := f.Services[service]
+		c, err := resolveComposeService(project, service, svc, networkNames, volumeNames)
+		if err != nil {
+			return nil, fmt.Errorf("service %s: %w", service, err)
+		}
+		for _, dep := range svc.DependsOn {
+			if _, ok := f.Services[dep]; !ok {
+				return nil, fmt.Errorf("service %s: depends on undefined service %s", service, dep)
+			}
+		}
+		c.Config.Labels = projectLabels(c.Config.Labels, composeServiceLabel, service)
+		c.Config.Labels[composeNumberLabel] = "1"
+		c.Config.Labels[composeOneoffLabel] = "False"
+		if len(svc.DependsOn) > 0 {
+			c.Config.Labels[composeDependsOnLabel] = composeDependsOnValue(svc.DependsOn)
+		}
+		deps[service] = svc.DependsOn
+		byService[service] = c
+	}
+	levels, cyclic := startorder.Levels(deps)
+	if len(cyclic) > 0 {
+		return nil, fmt.Errorf("services depend on each other in a cycle: %s", strings.Join(cyclic, ", "))
+	}
+	for _, service := range startorder.Flatten(levels) {
+		stack.Containers = append(stack.Containers, byService[service])
+	}
+	return stack, nil
+}
+
+// composeDependsOnValue formats depends_on as Compose records it in a label,
+// which orderPlanContainers reads when the stack is replicated later.
+func composeDependsOnValue(services []string) string {
+	parts := make([]string, len(services))
+	for i, s := range services {
+		parts[i] = s + ":service_started:false"
+	}
+	return strings.Join(parts, ",")
+}
+
+// resolveComposeService builds the create request for one service.
+func resolveComposeService(project, service string, svc composeService, networkNames, volumeNames map[string]string) (composeStackContainer, error) {
+	c := composeStackContainer{Name: svc.ContainerName, Service: service, Aliases: make(map[string][]string)}
+	if c.Name == "" {
+		c.Name = project + "-" + service + "-1"
+	}
+	if svc.Image == "" {
+		return c, fmt.Errorf("no image; services that are only built are not supported")
+	}
+
+	exposed, bindings, err := composePorts(svc.Ports)
+	if err != nil {
+		return c, err
+	}
+	env := make([]string, 0, len(svc.Environment))
+	for _, k := range sortedKeys(svc.Environment) {
+		if v := svc.Environment[k]; v != nil {
+			env = append(env, k+"="+*v)
+		}
+	}
+	c.Config = &container.Config{
+		Image:        svc.Image,
+		Cmd:          []string(svc.Command),
+		Entrypoint:   []string(svc.Entrypoint),
+		Env:          env,
+		Labels:       svc.Labels.values(),
+		ExposedPorts: exposed,
+		Hostname:     svc.Hostname,
+		User:         svc.User,
+		WorkingDir:   svc.WorkingDir,
+		Tty:          svc.TTY,
+		OpenStdin:    svc.StdinOpen,
+	}
+
+	restart, retries, err := composeRestartPolicy(svc.Restart)
+	if err != nil {
+		return c, err
+	}
+	c.HostConfig = &container.HostConfig{
+		PortBindings:   bindings,
+		RestartPolicy:  container.RestartPolicy{Name: container.RestartPolicyMode(restart), MaximumRetryCount: retries},
+		Privileged:     svc.Privileged,
+		ReadonlyRootfs: svc.ReadOnly,
+		CapAdd:         svc.CapAdd,
+		CapDrop:        svc.CapDrop,
+		ExtraHosts:     svc.ExtraHosts,
+	}
+	for _, m := range svc.Volumes {
+		if m.Target == "" {
+			return c, fmt.Errorf("volume without a target path")
+		}
+		mt := mount.Mount{Target: m.Target, ReadOnly: m.ReadOnly}
+		switch m.Type {
+		case "bind":
+			src, err := composeBindSource(m.Source)
+			if err != nil {
+				return c, err
+			}
+			mt.Type, mt.Source = mount.TypeBind, src
+		case "volume":
+			mt.Type = mount.TypeVolume
+			if m.Source != "" {
+				name, ok := volumeNames[m.Source]
+				if !ok {
+					return c, fmt.Errorf("volume %s is not declared under the top-level volumes", m.Source)
+				}
+				mt.Source = name
+			}
+		default:
+			return c, fmt.Errorf("volume type %q is not supported", m.Type)
+		}
+		c.HostConfig.Mounts = append(c.HostConfig.Mounts, mt)
+	}
+
+	if svc.NetworkMode != "" {
+		if len(svc.Networks) > 0 {
+			return c, fmt.Errorf("network_mode and networks cannot both be set")
+		}
+		c.HostConfig.NetworkMode = container.NetworkMode(svc.NetworkMode)
+		return c, nil
+	}
+	joined := svc.Networks
+	if len(joined) == 0 {
+		joined = composeServiceNetworks{composeDefaultNetwork: nil}
+	}
+	for _, key := range sortedKeys(joined) {
+		name, ok := networkNames[key]
+		if !ok {
+			return c, fmt.Errorf("network %s is not declared under the top-level networks", key)
+		}
+		c.Networks = append(c.Networks, name)
+		c.Aliases[name] = append([]string{service}, joined[key]...)
+	}
+	c.HostConfig.NetworkMode = container.NetworkMode(c.Networks[0])
+	return c, nil
+}
+
+// composePorts converts a service's ports to Docker's exposed ports and bindings.
+func composePorts(ports []composePort) (nat.PortSet, nat.PortMap, error) {
+	specs := make([]string, len(ports))
+	for i, p := range ports {
+		specs[i] = string(p)
+	}
+	exposed, bindings, err := nat.ParsePortSpecs(specs)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid ports: %w", err)
+	}
+	return exposed, bindings, nil
+}
+
+// handleComposeUp creates the networks, volumes and containers of a Compose
+// file on this host, so a whole stack can be bootstrapped on a standby from
+// its compose file. Networks and volumes that already exist are reused and
+// containers that already exist are left alone, so it can be run again after
+// a failure.
+func (s *Server) handleComposeUp(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxComposeFileSize))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Unable to read compose file: %s", err), http.StatusBadRequest)
+		return
+	}
+	f, warnings, err := parseComposeFile(data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	project := r.URL.Query().Get("project")
+	if project == "" {
+		project = f.Name
+	}
+	if !composeProjectPattern.MatchString(project) {
+		http.Error(w, fmt.Sprintf("Invalid project name %q: give ?project= or a top-level name, using lowercase letters, digits, '_' and '-'", project), http.StatusBadRequest)
+		return
+	}
+	startPolicy := r.URL.Query().Get("start")
+	switch startPolicy {
+	case "", store.StartCreated, store.StartStopped, store.StartRunning:
+	default:
+		http.Error(w, fmt.Sprintf("Invalid start policy %q", startPolicy), http.StatusBadRequest)
+		return
+	}
+	stack, err := resolveComposeStack(f, project)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result := ComposeUpResult{
+		Project:    project,
+		DryRun:     r.URL.Query().Get("dryRun") == "true",
+		Networks:   []ComposeUpItem{},
+		Volumes:    []ComposeUpItem{},
+		Containers: []ComposeUpItem{},
+		Warnings:   warnings,
+	}
+	if result.Warnings == nil {
+		result.Warnings = []string{}
+	}
+	if result.DryRun {
+		for _, n := range stack.Networks {
+			result.Networks = append(result.Networks, ComposeUpItem{Name: n.Name, Status: "planned"})
+		}
+		for _, v := range stack.Volumes {
+			result.Volumes = append(result.Volumes, ComposeUpItem{Name: v.Name, Status: "planned"})
+		}
+		for _, c := range stack.Containers {
+			result.Containers = append(result.Containers, ComposeUpItem{Name: c.Name, Service: c.Service, Status: "planned"})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+		return
+	}
+
+	cli, err := newDockerClient(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to create docker client", "err", err)
+		writeError(w, r, "Unable to create docker client", err)
+		return
+	}
+	defer cli.Close()
+
+	slog.InfoContext(r.Context(), "Bringing up compose project", "project", project, "containers", len(stack.Containers))
+	ctx := context.WithoutCancel(r.Context())
+	err = s.composeUp(ctx, cli, stack, startPolicy, &result)
+
+	p, _ := principalFrom(r.Context())
+	entry := store.AuditEntry{
+		Actor:      p.User,
+		RemoteAddr: r.RemoteAddr,
+		Action:     "compose-up",
+		Target:     project,
+		Outcome:    "succeeded",
+		Detail:     fmt.Sprintf("%d networks, %d volumes, %d containers", len(result.Networks), len(result.Volumes), len(result.Containers)),
+	}
+	if err != nil {
+		entry.Outcome = "failed"
+		entry.Detail = err.Error()
+	}
+	if auditErr := s.store.RecordAudit(entry); auditErr != nil {
+		slog.ErrorContext(ctx, "Unable to record audit entry", "action", entry.Action, "err", auditErr)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to bring up compose project", "project", project, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+	} else {
+		slog.InfoContext(ctx, "Brought up compose project", "project", project)
+	}
+	json.NewEncoder(w).Encode(result)
+}
+
+// composeUp creates stack's resources in order, recording each in result. It
+// stops at the first failure, which is recorded too.
+func (s *Server) composeUp(ctx context.Context, cli *client.Client, stack *composeStack, startPolicy string, result *ComposeUpResult) error {
+	fail := func(items *[]ComposeUpItem, item ComposeUpItem, err error) error {
+		item.Status, item.Error = "failed", err.Error()
+		*items = append(*items, item)
+		return fmt.Errorf("%s: %w", item.Name, err)
+	}
+
+	for _, n := range stack.Networks {
+		item := ComposeUpItem{Name: n.Name}
+		existing, err := cli.NetworkList(ctx, types.NetworkListOptions{Filters: filters.NewArgs(filters.Arg("name", n.Name))})
+		if err != nil {
+			return fail(&result.Networks, item, err)
+		}
+		for _, e := range existing {
+			if e.Name == n.Name {
+				item.ID, item.Status = e.ID, "exists"
+			}
+		}
+		if item.Status == "" {
+			if n.External {
+				return fail(&result.Networks, item, errors.New("external network does not exist"))
+			}
+			created, err := cli.NetworkCreate(ctx, n.Name, n.Create)
+			if err != nil {
+				return fail(&result.Networks, item, err)
+			}
+			item.ID, item.Status = created.ID, "created"
+		}
+		result.Networks = append(result.Networks, item)
+	}
+
+	for _, v := range stack.Volumes {
+		item := ComposeUpItem{Name: v.Name, Status: "exists"}
+		if _, err := cli.VolumeInspect(ctx, v.Name); client.IsErrNotFound(err) {
+			if v.External {
+				return fail(&result.Volumes, item, errors.New("external volume does not exist"))
+			}
+			if _, err := cli.VolumeCreate(ctx, v.Create); err != nil {
+				return fail(&result.Volumes, item, err)
+			}
+			item.Status = "created"
+		} else if err != nil {
+			return fail(&result.Volumes, item, err)
+		}
+		result.Volumes = append(result.Volumes, item)
+	}
+
+	for _, c := range stack.Containers {
+		item := ComposeUpItem{Name: c.Name, Service: c.Service}
+		if existing, err := cli.ContainerInspect(ctx, c.Name); err == nil {
+			item.ID, item.Status = existing.ID, "exists"
+			result.Containers = append(result.Containers, item)
+			continue
+		} else if !client.IsErrNotFound(err) {
+			return fail(&result.Containers, item, err)
+		}
+		if err := s.ensureImage(ctx, cli, c.Config.Image); err != nil {
+			return fail(&result.Containers, item, err)
+		}
+
+		// Older daemons take one network at create; the rest are connected after
+		var netConfig *network.NetworkingConfig
+		if len(c.Networks) > 0 {
+			first := c.Networks[0]
+			netConfig = &network.NetworkingConfig{EndpointsConfig: map[string]*network.EndpointSettings{
+				first: {Aliases: c.Aliases[first]},
+			}}
+		}
+		created, err := cli.ContainerCreate(ctx, c.Config, c.HostConfig, netConfig, nil, c.Name)
+		if err != nil {
+			return fail(&result.Containers, item, err)
+		}
+		item.ID = created.ID
+		for _, name := range c.Networks[min(1, len(c.Networks)):] {
+			if err := cli.NetworkConnect(ctx, name, created.ID, &network.EndpointSettings{Aliases: c.Aliases[name]}); err != nil {
+				return fail(&result.Containers, item, fmt.Errorf("connect to network %s: %w", name, err))
+			}
+		}
+		if err := applyStartPolicy(ctx, cli, created.ID, startPolicy); err != nil {
+			return fail(&result.Containers, item, err)
+		}
+		item.Status = "created"
+		result.Containers = append(result.Containers, item)
+		slog.InfoContext(ctx, "Created compose service", "project", stack.Project, "service", c.Service, "name", c.Name, "id", created.ID)
+	}
+	return nil
+}
+
+// ensureImage pulls img if this host does not have it.
+func (s *Server) ensureImage(ctx context.Context, cli *client.Client, img string) error {
+	_, _, err := cli.ImageInspectWithRaw(ctx, img)
+	if err == nil {
+		return nil
+	}
+	if !client.IsErrNotFound(err) {
+		return fmt.Errorf("inspect image %s: %w", img, err)
+	}
+	slog.InfoContext(ctx, "Pulling image", "image", img)
+	rc, err := cli.ImagePull(ctx, img, image.PullOptions{RegistryAuth: s.registryAuthForImage(img)})
+	if err != nil {
+		return fmt.Errorf("pull image %s: %w", img, err)
+	}
+	err = drainJSONMessages(rc)
+	rc.Close()
+	if err != nil {
+		return fmt.Errorf("pull image %s: %w", img, err)
+	}
+	return nil
+}
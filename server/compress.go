@@ -0,0 +1,238 @@
+package server
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+)
+
+// compressMinSize is the smallest response worth compressing; smaller ones
+// grow with the encoding's framing.
+const compressMinSize = 1024
+
+// compressibleTypes are the content types that shrink; tar streams, archives
+// and images are sent as they are.
+var compressibleTypes = []string{
+	"text/",
+	"application/json",
+	"application/problem+json",
+	"application/x-ndjson",
+	"application/javascript",
+	"application/xml",
+	"application/yaml",
+	"application/x-yaml",
+	"image/svg+xml",
+}
+
+var (
+	gzipWriters   = sync.Pool{New: func() any { return gzip.NewWriter(io.Discard) }}
+	brotliWriters = sync.Pool{New: func() any {
+		// Quality 5 beats gzip's size at a similar speed, where the default
+		// of 6 costs noticeably more CPU on large container lists
+		return brotli.NewWriterLevel(io.Discard, 5)
+	}}
+)
+
+// compressor is what gzip.Writer and brotli.Writer have in common.
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+	Reset(io.Writer)
+}
+
+// negotiateEncoding picks br or gzip from an Accept-Encoding header,
+// preferring br when the client weighs them the same, or "" for neither.
+func negotiateEncoding(header string) string {
+	weights := map[string]float64{}
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		weights[strings.ToLower(strings.TrimSpace(name))] = q
+	}
+	best, bestQ := "", 0.0
+	for _, name := range []string{"br", "gzip"} {
+		q, ok := weights[name]
+		if !ok {
+			q, ok = weights["*"]
+		}
+		if ok && q > bestQ {
+			best, bestQ = name, q
+		}
+	}
+	return best
+}
+
+// compressWriter compresses a response once its headers and first bytes
+// show it is worth it. Until then the status and up to compressMinSize bytes
+// are held back.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	enc      compressor // nil when the response is sent as it is
+	status   int
+	buf      []byte
+	decided  bool
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.decided {
+		cw.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if cw.status != 0 {
+		return
+	}
+	cw.status = status
+	switch n, err := strconv.Atoi(cw.Header().Get("Content-Length")); {
+	case !cw.compressible():
+		cw.start(false)
+	case err == nil:
+		cw.start(n >= compressMinSize)
+	}
+}
+
+// compressible reports whether the status and headers allow compression.
+func (cw *compressWriter) compressible() bool {
+	h := cw.Header()
+	if cw.status < 200 || cw.status == http.StatusNoContent || cw.status == http.StatusNotModified || h.Get("Content-Encoding") != "" {
+		return false
+	}
+	contentType := strings.ToLower(h.Get("Content-Type"))
+	for _, prefix := range compressibleTypes {
+		if strings.HasPrefix(contentType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// start sends the held back status and bytes, compressed or not.
+func (cw *compressWriter) start(compress bool) error {
+	cw.decided = true
+	if compress {
+		h := cw.Header()
+		h.Set("Content-Encoding", cw.encoding)
+		h.Del("Content-Length")
+		if cw.encoding == "br" {
+			cw.enc = brotliWriters.Get().(compressor)
+		} else {
+			cw.enc = gzipWriters.Get().(compressor)
+		}
+		cw.enc.Reset(cw.ResponseWriter)
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	_, err := cw.write(buf)
+	return err
+}
+
+func (cw *compressWriter) write(b []byte) (int, error) {
+	if cw.enc == nil {
+		return cw.ResponseWriter.Write(b)
+	}
+	return cw.enc.Write(b)
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if cw.decided {
+		return cw.write(b)
+	}
+	if cw.status == 0 {
+		// Sniff the type here, as net/http would, so it can be judged
+		if cw.Header().Get("Content-Type") == "" {
+			cw.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		if cw.WriteHeader(http.StatusOK); cw.decided {
+			return cw.write(b)
+		}
+	}
+	cw.buf = append(cw.buf, b...)
+	if len(cw.buf) >= compressMinSize {
+		if err := cw.start(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// Flush pushes out what has been written so far, so logs, stats and events
+// still stream. A response flushed before reaching compressMinSize is sent
+// as it is.
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		if cw.status == 0 {
+			cw.status = http.StatusOK
+		}
+		cw.start(false)
+	}
+	if cw.enc != nil {
+		cw.enc.Flush()
+	}
+	http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+// Hijack hands the connection to WebSocket handlers; upgrades are not
+// compressed, but a handler may hijack without one.
+func (cw *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(cw.ResponseWriter).Hijack()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// close sends a response too small to compress, or finishes the compressed
+// stream and returns the encoder to its pool.
+func (cw *compressWriter) close() {
+	if !cw.decided && cw.status != 0 {
+		cw.start(false)
+	}
+	if cw.enc == nil {
+		return
+	}
+	cw.enc.Close()
+	cw.enc.Reset(io.Discard)
+	if cw.encoding == "br" {
+		brotliWriters.Put(cw.enc)
+	} else {
+		gzipWriters.Put(cw.enc)
+	}
+}
+
+// compress sends text and JSON responses gzip or brotli compressed to
+// clients that accept it, while the compressResponses setting is on.
+// Upgrades, range and HEAD requests are left alone.
+func (s *Server) compress(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.boolSetting(settingCompressResponses) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Accept-Encoding")
+		encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+		if encoding == "" || r.Method == http.MethodHead || r.Header.Get("Upgrade") != "" || r.Header.Get("Range") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cw := &compressWriter{ResponseWriter: w, encoding: encoding}
+		defer cw.close()
+		next.ServeHTTP(cw, r)
+	})
+}
@@ -0,0 +1,146 @@
+package server
+
+import (
+	"crypto/x509"
+	"dockerap/config"
+	"dockerap/notify"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Config holds the server settings read from the environment.
+type Config struct {
+	ListenAddr        string
+	TemplatesDir      string // read templates from here instead of the embedded copies, for development
+	Dev               bool   // re-parse templates on every request
+	SnapshotInterval  time.Duration
+	SnapshotRetention time.Duration
+	AuditRetention    time.Duration // how long audit log entries are kept
+	ShutdownTimeout   time.Duration // how long in-flight requests get to finish on SIGTERM
+	APIToken          string        // shared bearer token for the destination API, empty for none
+	CompressResponses bool          // gzip or brotli text and JSON for clients that accept it
+
+	// ReplicationConcurrency is how many destinations a job copies to at
+	// once, 0 for all of them
+	ReplicationConcurrency int
+
+	// VolumeHelperImage backs the never-started containers used to reach the
+	// contents of volumes no container mounts
+	VolumeHelperImage string
+
+	// HTTPS: either a certificate and key, or a self-signed pair generated in TLSDir
+	TLSCertFile   string
+	TLSKeyFile    string
+	TLSSelfSigned bool
+	TLSDir        string
+	TLSHosts      []string // extra names and IPs for the self-signed certificate
+
+	// PeerTransport carries requests to other instances, trusting PEER_CA_FILE
+	// and presenting the mTLS client certificate if one is configured
+	PeerTransport *http.Transport
+
+	// ClientCAs verifies peer client certificates; when set, the destination
+	// API requires one (mutual TLS)
+	ClientCAs *x509.CertPool
+
+	// Web UI login: user name to bcrypt, {SHA} or plain password; empty
+	// leaves the UI open
+	Users      map[string]string
+	SessionTTL time.Duration
+
+	// Roles of UI users; users not listed get DefaultRole
+	Roles       map[string]role
+	DefaultRole role
+
+	// Token bucket limits for the /api/ routes, nil when off
+	IPLimiter    *rateLimiter
+	TokenLimiter *rateLimiter
+
+	// CORS lets a frontend on another origin call the API, nil for same-origin only
+	CORS *corsPolicy
+
+	// CreatePolicy limits the containers peers may create on this host
+	CreatePolicy createPolicy
+
+	// DockerContextsDir holds the docker CLI's contexts, offered as hosts
+	DockerContextsDir string
+
+	// Notifier posts finished replication jobs to webhooks
+	Notifier *notify.Notifier
+}
+
+// Flags are the server settings that can also be given on the command line.
+// Non-empty values override the matching environment variables.
+type Flags struct {
+	Listen       string // LISTEN_ADDR
+	TemplatesDir string // TEMPLATES_DIR
+	Dev          bool   // re-parse templates on every request, from TemplatesDir or ./templates
+}
+
+// LoadConfig reads the server settings from environment variables and flags.
+// All problems are reported together as config.Problems.
+func LoadConfig(flags Flags) (*Config, error) {
+	v := &config.Validator{}
+	listen := flags.Listen
+	if listen == "" {
+		listen = os.Getenv("LISTEN_ADDR")
+	}
+	if listen == "" {
+		listen = ":8080"
+	}
+	if _, port, err := net.SplitHostPort(listen); err != nil {
+		v.Add("LISTEN_ADDR", fmt.Sprintf("%q is not a host:port address: %s", listen, err), "use a form such as :8080 or 0.0.0.0:9000")
+	} else if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		v.Add("LISTEN_ADDR", fmt.Sprintf("%q has an invalid port", listen), "use a port between 1 and 65535")
+	}
+
+	cfg := &Config{
+		ListenAddr:             listen,
+		SnapshotInterval:       v.Duration("INVENTORY_SNAPSHOT_INTERVAL", time.Hour),
+		SnapshotRetention:      v.Duration("INVENTORY_SNAPSHOT_RETENTION", 30*24*time.Hour),
+		AuditRetention:         v.Duration("AUDIT_RETENTION", 90*24*time.Hour),
+		ShutdownTimeout:        v.Duration("SHUTDOWN_TIMEOUT", 10*time.Minute),
+		APIToken:               os.Getenv("API_TOKEN"),
+		CompressResponses:      v.Bool("COMPRESS_RESPONSES", true),
+		ReplicationConcurrency: v.Int("REPLICATION_CONCURRENCY", 0, 0),
+		VolumeHelperImage:      os.Getenv("VOLUME_HELPER_IMAGE"),
+		TemplatesDir:           flags.TemplatesDir,
+		Dev:                    flags.Dev,
+	}
+	if cfg.VolumeHelperImage == "" {
+		cfg.VolumeHelperImage = "busybox:latest"
+	}
+	if cfg.TemplatesDir == "" {
+		cfg.TemplatesDir = os.Getenv("TEMPLATES_DIR")
+	}
+	if cfg.Dev && cfg.TemplatesDir == "" {
+		cfg.TemplatesDir = "templates"
+	}
+	if cfg.TemplatesDir != "" {
+		v.File("TEMPLATES_DIR", cfg.TemplatesDir)
+	}
+	if cfg.APIToken != "" && len(cfg.APIToken) < 16 {
+		v.Add("API_TOKEN", "is shorter than 16 characters", "use a long random value, e.g. the output of openssl rand -hex 32")
+	}
+	loadTLSConfig(v, cfg)
+	loadLoginConfig(v, cfg)
+	loadRoles(v, cfg)
+	loadRateLimits(v, cfg)
+	loadCORS(v, cfg)
+	loadCreatePolicy(v, cfg)
+	loadDockerContextsDir(v, cfg)
+	host, _ := os.Hostname()
+	cfg.Notifier = notify.Load(v, host)
+	if cfg.SnapshotRetention < cfg.SnapshotInterval {
+		v.Add("INVENTORY_SNAPSHOT_RETENTION", "is shorter than INVENTORY_SNAPSHOT_INTERVAL, so at most one snapshot would be kept",
+			"make the retention several times the interval")
+	}
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+)
+
+// containerDetail is what the container detail page shows.
+type containerDetail struct {
+	Name        string
+	Inspect     types.ContainerJSON
+	Env         []envVar
+	Raw         string // the inspect output, indented
+	IsSelected  bool
+	MatchedRule string
+}
+
+type envVar struct {
+	Name  string
+	Value string
+}
+
+// handleContainerInspect returns Docker's full inspect output for one
+// container: the configuration replication copies to destinations.
+func (s *Server) handleContainerInspect(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	cli, err := newDockerClient(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to create docker client", "err", err)
+		writeError(w, r, "Unable to create docker client", err)
+		return
+	}
+	defer cli.Close()
+
+	_, raw, err := cli.ContainerInspectWithRaw(r.Context(), r.PathValue("id"), false)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if client.IsErrNotFound(err) {
+			status = http.StatusNotFound
+		}
+		http.Error(w, fmt.Sprintf("Unable to inspect container: %s", err), status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(raw)
+}
+
+// handleContainerDetail renders one container's configuration, its
+// environment, mounts, networks, ports, restart policy and labels, followed by
+// the full inspect output, so it can be reviewed before it is selected.
+func (s *Server) handleContainerDetail(w http.ResponseWriter, r *http.Request) {
+	cli, err := newDockerClient(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to create docker client", "err", err)
+		writeError(w, r, "Unable to create docker client", err)
+		return
+	}
+	defer cli.Close()
+
+	inspect, raw, err := cli.ContainerInspectWithRaw(r.Context(), r.PathValue("id"), false)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if client.IsErrNotFound(err) {
+			status = http.StatusNotFound
+		}
+		http.Error(w, fmt.Sprintf("Unable to inspect container: %s", err), status)
+		return
+	}
+	if inspect.ContainerJSONBase == nil || inspect.Config == nil {
+		http.Error(w, "Incomplete inspect output from Docker", http.StatusBadGateway)
+		return
+	}
+
+	detail := containerDetail{Name: containerName(inspect), Inspect: inspect}
+	for _, kv := range inspect.Config.Env {
+		name, value, _ := strings.Cut(kv, "=")
+		detail.Env = append(detail.Env, envVar{Name: name, Value: value})
+	}
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, raw, "", "  "); err == nil {
+		detail.Raw = indented.String()
+	} else {
+		detail.Raw = string(raw)
+	}
+
+	selected, err := s.store.ResolveSelectedContainers("", map[string]string{inspect.ID: detail.Name})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to get selected containers", "err", err)
+		writeError(w, r, "Unable to get selected containers", err)
+		return
+	}
+	rules, err := s.ruleMatches(r.Context(), cli)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to evaluate selection rules", "err", err)
+		writeError(w, r, "Unable to evaluate selection rules", err)
+		return
+	}
+	detail.MatchedRule = rules[inspect.ID]
+	detail.IsSelected = selected[inspect.ID] || detail.MatchedRule != ""
+
+	pages, err := s.pages()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to parse template", "err", err)
+		writeError(w, r, "Unable to parse template", err)
+		return
+	}
+	if err := pages.container.Execute(w, detail); err != nil {
+		slog.ErrorContext(r.Context(), "Unable to execute template", "err", err)
+	}
+}
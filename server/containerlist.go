@@ -0,0 +1,244 @@
+package server
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+)
+
+// Page sizes for the container list. The UI shows defaultContainerPageSize
+// rows unless asked for more.
+const (
+	defaultContainerPageSize = 50
+	maxContainerPageSize     = 500
+)
+
+// containerStates are the states the container list can be filtered by.
+var containerStates = []string{"created", "running", "paused", "restarting", "exited", "removing", "dead"}
+
+// containerQuery is the filtering and paging of a container listing, taken
+// from the query string of / and /api/containers.
+type containerQuery struct {
+	Page     int      // from 1
+	PageSize int      // 0 lists every matching container
+	States   []string // any of these states
+	Name     string   // substring of a name, case-insensitive
+	Image    string   // substring of the image, case-insensitive
+	Labels   []string // key or key=value, all must match; comma-separated in the query
+	Search   string   // free text, see matchSearch
+	ID       string   // ID or ID prefix, for one container's row
+}
+
+// parseContainerQuery reads the page, pageSize, state, name, image, label and
+// q parameters. pageSize is used when the request names no page size.
+func parseContainerQuery(v url.Values, pageSize int) (containerQuery, error) {
+	q := containerQuery{
+		Page:     1,
+		PageSize: pageSize,
+		Name:     strings.TrimSpace(v.Get("name")),
+		Image:    strings.TrimSpace(v.Get("image")),
+		Search:   strings.TrimSpace(v.Get("q")),
+	}
+	if p := v.Get("page"); p != "" {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 1 {
+			return q, fmt.Errorf("invalid page %q, expected a number from 1", p)
+		}
+		q.Page = n
+		if q.PageSize == 0 {
+			q.PageSize = defaultContainerPageSize
+		}
+	}
+	if p := v.Get("pageSize"); p != "" {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 1 || n > maxContainerPageSize {
+			return q, fmt.Errorf("invalid pageSize %q, expected a number from 1 to %d", p, maxContainerPageSize)
+		}
+		q.PageSize = n
+	}
+	for _, s := range v["state"] {
+		for _, state := range strings.Split(s, ",") {
+			state = strings.ToLower(strings.TrimSpace(state))
+			if state == "" {
+				continue
+			}
+			if !slices.Contains(containerStates, state) {
+				return q, fmt.Errorf("unknown state %q, expected one of %s", state, strings.Join(containerStates, ", "))
+			}
+			q.States = append(q.States, state)
+		}
+	}
+	for _, s := range v["label"] {
+		for _, l := range strings.Split(s, ",") {
+			if l = strings.TrimSpace(l); l != "" {
+				q.Labels = append(q.Labels, l)
+			}
+		}
+	}
+	return q, nil
+}
+
+// match reports whether c passes every filter in q.
+func (q containerQuery) match(c types.Container) bool {
+	if q.ID != "" && !strings.HasPrefix(c.ID, q.ID) {
+		return false
+	}
+	if len(q.States) > 0 && !slices.Contains(q.States, c.State) {
+		return false
+	}
+	if q.Name != "" {
+		name := strings.ToLower(q.Name)
+		found := false
+		for _, n := range c.Names {
+			if strings.Contains(strings.ToLower(strings.TrimPrefix(n, "/")), name) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if q.Image != "" && !strings.Contains(strings.ToLower(c.Image), strings.ToLower(q.Image)) {
+		return false
+	}
+	for _, l := range q.Labels {
+		key, value, hasValue := strings.Cut(l, "=")
+		got, ok := c.Labels[key]
+		if !ok || (hasValue && got != value) {
+			return false
+		}
+	}
+	return q.Search == "" || matchSearch(c, q.Search)
+}
+
+// matchSearch reports whether every word of search appears, ignoring case,
+// in one of c's names, its image, a label value or the name of a network it
+// is attached to.
+func matchSearch(c types.Container, search string) bool {
+	fields := []string{c.Image}
+	for _, n := range c.Names {
+		fields = append(fields, strings.TrimPrefix(n, "/"))
+	}
+	for _, v := range c.Labels {
+		fields = append(fields, v)
+	}
+	if c.NetworkSettings != nil {
+		for name := range c.NetworkSettings.Networks {
+			fields = append(fields, name)
+		}
+	}
+	for _, word := range strings.Fields(strings.ToLower(search)) {
+		found := false
+		for _, f := range fields {
+			if strings.Contains(strings.ToLower(f), word) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// values returns q as query parameters for page, leaving out defaults.
+func (q containerQuery) values(page int) url.Values {
+	v := url.Values{}
+	if page > 1 {
+		v.Set("page", strconv.Itoa(page))
+	}
+	if q.PageSize != 0 && q.PageSize != defaultContainerPageSize {
+		v.Set("pageSize", strconv.Itoa(q.PageSize))
+	}
+	if len(q.States) > 0 {
+		v.Set("state", strings.Join(q.States, ","))
+	}
+	if q.Name != "" {
+		v.Set("name", q.Name)
+	}
+	if q.Image != "" {
+		v.Set("image", q.Image)
+	}
+	if len(q.Labels) > 0 {
+		v.Set("label", strings.Join(q.Labels, ","))
+	}
+	if q.Search != "" {
+		v.Set("q", q.Search)
+	}
+	return v
+}
+
+// containerPage is one page of the container list and what it was cut from.
+type containerPage struct {
+	Containers []ContainerInfo
+	Query      containerQuery
+	Total      int // containers matching the filters, on all pages
+}
+
+// Pages is the number of pages the matching containers fill.
+func (p containerPage) Pages() int {
+	if p.Query.PageSize == 0 || p.Total == 0 {
+		return 1
+	}
+	return (p.Total + p.Query.PageSize - 1) / p.Query.PageSize
+}
+
+// First and Last are the 1-based positions of the page's first and last rows.
+func (p containerPage) First() int {
+	if len(p.Containers) == 0 {
+		return 0
+	}
+	return (p.Query.Page-1)*p.Query.PageSize + 1
+}
+
+func (p containerPage) Last() int {
+	return p.First() + len(p.Containers) - 1
+}
+
+// Filtered reports whether any filter narrows the list.
+func (p containerPage) Filtered() bool {
+	q := p.Query
+	return len(q.States) > 0 || q.Name != "" || q.Image != "" || len(q.Labels) > 0 || q.Search != ""
+}
+
+// HasState reports whether the list is filtered to state, for the UI's state picker.
+func (p containerPage) HasState(state string) bool {
+	return slices.Contains(p.Query.States, state)
+}
+
+// States lists the states the UI's state picker offers.
+func (p containerPage) States() []string {
+	return containerStates
+}
+
+// PageURL is the query string of page n with the same filters.
+func (p containerPage) PageURL(n int) string {
+	if enc := p.Query.values(n).Encode(); enc != "" {
+		return "?" + enc
+	}
+	return "?"
+}
+
+// PrevURL and NextURL link to the neighbouring pages.
+func (p containerPage) PrevURL() string { return p.PageURL(p.Query.Page - 1) }
+func (p containerPage) NextURL() string { return p.PageURL(p.Query.Page + 1) }
+
+// page cuts the page q asks for out of containers, which must already be
+// filtered. A page past the end is empty.
+func (q containerQuery) page(containers []types.Container) []types.Container {
+	if q.PageSize == 0 {
+		return containers
+	}
+	// Compare pages rather than offsets, which a huge page would overflow
+	if q.Page > (len(containers)+q.PageSize-1)/q.PageSize {
+		return nil
+	}
+	start := (q.Page - 1) * q.PageSize
+	return containers[start:min(start+q.PageSize, len(containers))]
+}
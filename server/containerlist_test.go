@@ -0,0 +1,155 @@
+package server
+
+import (
+	"math"
+	"net/url"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/network"
+)
+
+func TestParseContainerQuery(t *testing.T) {
+	tests := []struct {
+		query    string
+		pageSize int // the caller's default
+		want     containerQuery
+		ok       bool
+	}{
+		{"", 0, containerQuery{Page: 1}, true},
+		{"", 25, containerQuery{Page: 1, PageSize: 25}, true},
+		{"page=3", 0, containerQuery{Page: 3, PageSize: defaultContainerPageSize}, true},
+		{"page=3", 25, containerQuery{Page: 3, PageSize: 25}, true},
+		{"page=2&pageSize=500", 0, containerQuery{Page: 2, PageSize: 500}, true},
+		{"pageSize=1", 0, containerQuery{Page: 1, PageSize: 1}, true},
+		{"page=0", 0, containerQuery{}, false},
+		{"page=-1", 0, containerQuery{}, false},
+		{"page=two", 0, containerQuery{}, false},
+		{"page=99999999999999999999", 0, containerQuery{}, false},
+		{"pageSize=0", 0, containerQuery{}, false},
+		{"pageSize=-10", 0, containerQuery{}, false},
+		{"pageSize=501", 0, containerQuery{}, false},
+		{"state=Running,+exited&state=&state=paused", 0, containerQuery{Page: 1, States: []string{"running", "exited", "paused"}}, true},
+		{"state=stopped", 0, containerQuery{}, false},
+		{"label=env%3Dprod,+backup&label=,", 0, containerQuery{Page: 1, Labels: []string{"env=prod", "backup"}}, true},
+		{"name=+web+&image=nginx&q=shop+db", 0, containerQuery{Page: 1, Name: "web", Image: "nginx", Search: "shop db"}, true},
+	}
+	for _, tt := range tests {
+		v, err := url.ParseQuery(tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := parseContainerQuery(v, tt.pageSize)
+		if (err == nil) != tt.ok {
+			t.Errorf("parseContainerQuery(%q) error = %v, want ok %t", tt.query, err, tt.ok)
+			continue
+		}
+		if tt.ok && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseContainerQuery(%q) = %+v, want %+v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestContainerQueryMatch(t *testing.T) {
+	c := types.Container{
+		ID:     "0123456789abcdef",
+		Names:  []string{"/shop-web"},
+		Image:  "nginx:1.27",
+		State:  "running",
+		Labels: map[string]string{"env": "prod", "com.docker.compose.project": "shop"},
+		NetworkSettings: &types.SummaryNetworkSettings{Networks: map[string]*network.EndpointSettings{
+			"frontend": {},
+		}},
+	}
+	tests := []struct {
+		name string
+		q    containerQuery
+		want bool
+	}{
+		{"no filters", containerQuery{}, true},
+		{"ID prefix", containerQuery{ID: "0123"}, true},
+		{"other ID", containerQuery{ID: "fedc"}, false},
+		{"one of the states", containerQuery{States: []string{"exited", "running"}}, true},
+		{"other state", containerQuery{States: []string{"exited"}}, false},
+		{"name ignores case and slash", containerQuery{Name: "SHOP-"}, true},
+		{"other name", containerQuery{Name: "db"}, false},
+		{"image", containerQuery{Image: "NGINX"}, true},
+		{"label key", containerQuery{Labels: []string{"env"}}, true},
+		{"label value", containerQuery{Labels: []string{"env=prod"}}, true},
+		{"label other value", containerQuery{Labels: []string{"env=dev"}}, false},
+		{"every label", containerQuery{Labels: []string{"env", "backup"}}, false},
+		{"search words anywhere", containerQuery{Search: "shop Frontend nginx"}, true},
+		{"search word missing", containerQuery{Search: "shop postgres"}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.q.match(c); got != tt.want {
+			t.Errorf("%s: match = %t, want %t", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestContainerQueryPage(t *testing.T) {
+	containers := make([]types.Container, 7)
+	for i := range containers {
+		containers[i].ID = strconv.Itoa(i)
+	}
+	tests := []struct {
+		name      string
+		page      int
+		pageSize  int
+		want      string // IDs on the page
+		wantPages int
+		first     int
+		last      int
+	}{
+		{"everything", 1, 0, "0123456", 1, 1, 7},
+		{"first page", 1, 3, "012", 3, 1, 3},
+		{"middle page", 2, 3, "345", 3, 4, 6},
+		{"short last page", 3, 3, "6", 3, 7, 7},
+		{"past the end", 4, 3, "", 3, 0, -1},
+		{"far past the end", math.MaxInt, 500, "", 1, 0, -1},
+		{"exactly full", 1, 7, "0123456", 1, 1, 7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := containerQuery{Page: tt.page, PageSize: tt.pageSize}
+			var got string
+			var rows []ContainerInfo
+			for _, c := range q.page(containers) {
+				got += c.ID
+				rows = append(rows, ContainerInfo{})
+			}
+			if got != tt.want {
+				t.Errorf("page = %q, want %q", got, tt.want)
+			}
+			p := containerPage{Containers: rows, Query: q, Total: len(containers)}
+			if p.Pages() != tt.wantPages || p.First() != tt.first || p.Last() != tt.last {
+				t.Errorf("pages %d, rows %d to %d, want %d, %d to %d", p.Pages(), p.First(), p.Last(), tt.wantPages, tt.first, tt.last)
+			}
+		})
+	}
+	if got := (containerQuery{Page: 1, PageSize: 3}).page(nil); got != nil {
+		t.Errorf("page of nothing = %v", got)
+	}
+	if p := (containerPage{Query: containerQuery{Page: 1, PageSize: 3}}); p.Pages() != 1 {
+		t.Errorf("an empty list fills %d pages, want 1", p.Pages())
+	}
+}
+
+func TestContainerPageURLs(t *testing.T) {
+	p := containerPage{Query: containerQuery{Page: 2, PageSize: defaultContainerPageSize, States: []string{"running"}, Name: "web"}}
+	if got := p.PrevURL(); got != "?name=web&state=running" {
+		t.Errorf("PrevURL = %s", got)
+	}
+	if got := p.NextURL(); got != "?name=web&page=3&state=running" {
+		t.Errorf("NextURL = %s", got)
+	}
+	if got := (containerPage{Query: containerQuery{Page: 2, PageSize: 10}}).PrevURL(); got != "?pageSize=10" {
+		t.Errorf("PrevURL with a page size = %s", got)
+	}
+	if got := (containerPage{}).PageURL(1); got != "?" {
+		t.Errorf("PageURL(1) with no filters = %s", got)
+	}
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"dockerap/config"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// corsPolicy says which other origins may call the JSON API from a browser.
+type corsPolicy struct {
+	origins     map[string]bool
+	anyOrigin   bool
+	methods     string
+	headers     string
+	credentials bool
+	maxAge      time.Duration
+}
+
+// loadCORS reads the CORS_* settings. Without CORS_ALLOWED_ORIGINS browsers
+// keep the same-origin policy.
+func loadCORS(v *config.Validator, cfg *Config) {
+	origins := splitList(os.Getenv("CORS_ALLOWED_ORIGINS"))
+	if len(origins) == 0 {
+		return
+	}
+	p := &corsPolicy{
+		origins:     make(map[string]bool),
+		methods:     "GET, POST, PUT, DELETE, OPTIONS",
+		headers:     "Content-Type, Authorization, X-CSRF-Token",
+		credentials: v.Bool("CORS_ALLOW_CREDENTIALS", false),
+		maxAge:      v.Duration("CORS_MAX_AGE", 10*time.Minute),
+	}
+	for _, o := range origins {
+		if o == "*" {
+			p.anyOrigin = true
+			continue
+		}
+		o = strings.TrimRight(o, "/")
+		v.URL("CORS_ALLOWED_ORIGINS", o)
+		p.origins[o] = true
+	}
+	if m := splitList(os.Getenv("CORS_ALLOWED_METHODS")); len(m) > 0 {
+		p.methods = strings.ToUpper(strings.Join(m, ", "))
+	}
+	if h := splitList(os.Getenv("CORS_ALLOWED_HEADERS")); len(h) > 0 {
+		p.headers = strings.Join(h, ", ")
+	}
+	if p.anyOrigin && p.credentials {
+		v.Add("CORS_ALLOW_CREDENTIALS", "cannot be used with CORS_ALLOWED_ORIGINS=*", "list the frontend origins explicitly")
+	}
+	cfg.CORS = p
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// trusts reports whether origin is listed by name; a wildcard trusts no one
+// for CSRF purposes.
+func (p *corsPolicy) trusts(origin string) bool {
+	return p != nil && p.origins[origin]
+}
+
+// cors adds the CORS headers for allowed origins and answers their preflight
+// requests before they reach the login, CSRF and rate checks.
+func (s *Server) cors(next http.Handler) http.Handler {
+	p := s.cfg.CORS
+	if p == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		w.Header().Add("Vary", "Origin")
+		if origin == "" || (!p.anyOrigin && !p.origins[origin]) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if p.anyOrigin {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		} else {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+		}
+		if p.credentials {
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", p.methods)
+			w.Header().Set("Access-Control-Allow-Headers", p.headers)
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(p.maxAge.Seconds())))
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"dockerap/config"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLoadCORS(t *testing.T) {
+	tests := []struct {
+		origins     string
+		credentials string
+		trusted     []string
+		untrusted   []string
+		ok          bool
+	}{
+		{"https://app.example/, http://localhost:5173", "", []string{"https://app.example", "http://localhost:5173"}, []string{"https://app.example/", "http://localhost", ""}, true},
+		{"*", "", nil, []string{"https://app.example"}, true},
+		{"*, https://app.example", "true", nil, nil, false},
+		{"app.example", "", nil, nil, false},
+	}
+	for _, tt := range tests {
+		t.Setenv("CORS_ALLOWED_ORIGINS", tt.origins)
+		t.Setenv("CORS_ALLOW_CREDENTIALS", tt.credentials)
+		v := &config.Validator{}
+		var cfg Config
+		loadCORS(v, &cfg)
+		if err := v.Err(); (err == nil) != tt.ok {
+			t.Errorf("%s: error = %v, want ok %t", tt.origins, err, tt.ok)
+			continue
+		}
+		for _, o := range tt.trusted {
+			if !cfg.CORS.trusts(o) {
+				t.Errorf("%s: %q is not trusted", tt.origins, o)
+			}
+		}
+		for _, o := range tt.untrusted {
+			if cfg.CORS.trusts(o) {
+				t.Errorf("%s: %q is trusted", tt.origins, o)
+			}
+		}
+	}
+
+	t.Setenv("CORS_ALLOWED_ORIGINS", "")
+	var cfg Config
+	loadCORS(&config.Validator{}, &cfg)
+	if cfg.CORS != nil || cfg.CORS.trusts("https://app.example") {
+		t.Errorf("a policy without CORS_ALLOWED_ORIGINS: %+v", cfg.CORS)
+	}
+}
+
+func TestCORSHeaders(t *testing.T) {
+	tests := []struct {
+		name        string
+		origins     string
+		credentials string
+		method      string
+		origin      string
+		wantOrigin  string // Access-Control-Allow-Origin, "" for none
+		preflight   bool   // answered 204 with the allowed methods
+	}{
+		{"same origin", "https://app.example", "", http.MethodGet, "", "", false},
+		{"allowed origin", "https://app.example", "true", http.MethodGet, "https://app.example", "https://app.example", false},
+		{"allowed preflight", "https://app.example", "true", http.MethodOptions, "https://app.example", "https://app.example", true},
+		{"other origin", "https://app.example", "", http.MethodGet, "https://evil.example", "", false},
+		{"other origin's preflight", "https://app.example", "", http.MethodOptions, "https://evil.example", "", false},
+		{"any origin", "*", "", http.MethodGet, "https://evil.example", "*", false},
+		{"any origin's preflight", "*", "", http.MethodOptions, "https://evil.example", "*", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CORS_ALLOWED_ORIGINS", tt.origins)
+			t.Setenv("CORS_ALLOW_CREDENTIALS", tt.credentials)
+			srv := newTestServer(t, nil)
+			v := &config.Validator{}
+			loadCORS(v, srv.cfg)
+			if err := v.Err(); err != nil {
+				t.Fatal(err)
+			}
+
+			r := httptest.NewRequest(tt.method, "/api/settings", nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if tt.method == http.MethodOptions {
+				r.Header.Set("Access-Control-Request-Method", http.MethodPost)
+			}
+			w := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(w, r)
+
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantOrigin)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Credentials"); (got == "true") != (tt.wantOrigin != "" && tt.credentials == "true") {
+				t.Errorf("Access-Control-Allow-Credentials = %q", got)
+			}
+			if !strings.Contains(strings.Join(w.Header().Values("Vary"), ","), "Origin") {
+				t.Errorf("Vary = %v, want Origin", w.Header().Values("Vary"))
+			}
+			preflight := w.Code == http.StatusNoContent && w.Header().Get("Access-Control-Allow-Methods") != ""
+			if preflight != tt.preflight {
+				t.Errorf("%s: %d, methods %q, want preflight %t", tt.method, w.Code, w.Header().Get("Access-Control-Allow-Methods"), tt.preflight)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"dockerap/apiclient"
+	"dockerap/config"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/distribution/reference"
+	"github.com/docker/docker/api/types/mount"
+)
+
+// createPolicy limits the containers peers may create through the
+// destination API. The zero value allows everything, as before there was a
+// policy.
+type createPolicy struct {
+	denyPrivileged  bool
+	denyHostNetwork bool
+	bindPrefixes    []string // nil allows binds from anywhere
+	registries      []string // nil allows images from any registry
+}
+
+// loadCreatePolicy reads the DESTINATION_* settings.
+func loadCreatePolicy(v *config.Validator, cfg *Config) {
+	p := createPolicy{
+		denyPrivileged:  v.Bool("DESTINATION_DENY_PRIVILEGED", false),
+		denyHostNetwork: v.Bool("DESTINATION_DENY_HOST_NETWORK", false),
+	}
+	prefixes := splitList(os.Getenv("DESTINATION_ALLOWED_BIND_PREFIXES"))
+	if os.Getenv("DESTINATION_ALLOWED_BIND_PREFIXES") != "" && len(prefixes) == 0 {
+		v.Add("DESTINATION_ALLOWED_BIND_PREFIXES", "lists no directories", "list host directories such as /srv,/data")
+	}
+	for _, prefix := range prefixes {
+		if !path.IsAbs(prefix) {
+			v.Add("DESTINATION_ALLOWED_BIND_PREFIXES", fmt.Sprintf("%q is not an absolute path", prefix), "list host directories such as /srv,/data")
+			continue
+		}
+		p.bindPrefixes = append(p.bindPrefixes, path.Clean(prefix))
+	}
+	for _, registry := range splitList(os.Getenv("DESTINATION_ALLOWED_REGISTRIES")) {
+		p.registries = append(p.registries, normalizeRegistry(registry))
+	}
+	cfg.CreatePolicy = p
+}
+
+// normalizeRegistry lower-cases a registry host and maps Docker Hub's
+// aliases to docker.io, the domain image references resolve to.
+func normalizeRegistry(registry string) string {
+	registry = strings.ToLower(registry)
+	registry = strings.TrimPrefix(strings.TrimPrefix(registry, "https://"), "http://")
+	registry = strings.TrimSuffix(registry, "/")
+	switch registry {
+	case "index.docker.io", "registry-1.docker.io", "hub.docker.com":
+		return "docker.io"
+	}
+	return registry
+}
+
+// violations lists every way req breaks the policy, or nothing if it may be
+// created.
+func (p createPolicy) violations(req apiclient.CreateContainerRequest) []string {
+	var out []string
+	if req.Config != nil && len(p.registries) > 0 {
+		if named, err := reference.ParseNormalizedNamed(req.Config.Image); err != nil {
+			out = append(out, fmt.Sprintf("image %q is not a valid reference", req.Config.Image))
+		} else if domain := strings.ToLower(reference.Domain(named)); !slices.Contains(p.registries, domain) {
+			out = append(out, fmt.Sprintf("image %s is from %s, not an allowed registry (%s)", req.Config.Image, domain, strings.Join(p.registries, ", ")))
+		}
+	}
+	hc := req.HostConfig
+	if hc == nil {
+		return out
+	}
+	if p.denyPrivileged && hc.Privileged {
+		out = append(out, "privileged containers are not allowed")
+	}
+	if p.denyHostNetwork && hc.NetworkMode.IsHost() {
+		out = append(out, "the host network is not allowed")
+	}
+	if p.bindPrefixes != nil {
+		var sources []string
+		for _, b := range hc.Binds {
+			// A source that is not a path is a volume name
+			if source, _, _ := strings.Cut(b, ":"); path.IsAbs(source) {
+				sources = append(sources, source)
+			}
+		}
+		for _, m := range hc.Mounts {
+			if m.Type == mount.TypeBind {
+				sources = append(sources, m.Source)
+			}
+		}
+		for _, source := range sources {
+			if !p.allowsBind(source) {
+				out = append(out, fmt.Sprintf("bind mount of %s is outside the allowed directories (%s)", source, strings.Join(p.bindPrefixes, ", ")))
+			}
+		}
+	}
+	return out
+}
+
+// allowsBind reports whether source is one of the allowed directories or
+// inside one. The source is cleaned first so .. cannot climb out.
+func (p createPolicy) allowsBind(source string) bool {
+	source = path.Clean(source)
+	for _, prefix := range p.bindPrefixes {
+		if prefix == "/" || source == prefix || strings.HasPrefix(source, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"dockerap/apiclient"
+	"dockerap/config"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+)
+
+func TestCreatePolicyViolations(t *testing.T) {
+	strict := createPolicy{
+		denyPrivileged:  true,
+		denyHostNetwork: true,
+		bindPrefixes:    []string{"/srv", "/data"},
+		registries:      []string{"docker.io", "registry.example.com"},
+	}
+	request := func(image string, hc *container.HostConfig) apiclient.CreateContainerRequest {
+		return apiclient.CreateContainerRequest{Name: "app", Config: &container.Config{Image: image}, HostConfig: hc}
+	}
+	tests := []struct {
+		name   string
+		policy createPolicy
+		req    apiclient.CreateContainerRequest
+		want   []string // each in a violation, in order
+	}{
+		{"zero policy allows everything", createPolicy{},
+			request("evil.example.net/miner", &container.HostConfig{Privileged: true, NetworkMode: "host", Binds: []string{"/:/host"}}), nil},
+		{"allowed", strict,
+			request("nginx:1.27", &container.HostConfig{Binds: []string{"/srv/www:/usr/share/nginx/html:ro", "cache:/cache"}}), nil},
+		{"docker hub", strict, request("docker.io/library/postgres:16", nil), nil},
+		{"other registry", strict, request("ghcr.io/acme/app:1", nil), []string{"image ghcr.io/acme/app:1 is from ghcr.io"}},
+		{"invalid reference", strict, request("Nginx", nil), []string{`image "Nginx" is not a valid reference`}},
+		{"registry in capitals", strict, request("Registry.Example.com/app:1", nil), nil},
+		{"privileged", strict, request("nginx", &container.HostConfig{Privileged: true}), []string{"privileged containers"}},
+		{"host network", strict, request("nginx", &container.HostConfig{NetworkMode: "host"}), []string{"the host network"}},
+		{"bind outside", strict, request("nginx", &container.HostConfig{Binds: []string{"/etc:/etc"}}), []string{"bind mount of /etc"}},
+		{"bind climbing out", strict, request("nginx", &container.HostConfig{Binds: []string{"/srv/../etc:/etc"}}), []string{"bind mount of /srv/../etc"}},
+		{"bind sharing a prefix", strict, request("nginx", &container.HostConfig{Binds: []string{"/srvx:/x"}}), []string{"bind mount of /srvx"}},
+		{"bind mount outside", strict,
+			request("nginx", &container.HostConfig{Mounts: []mount.Mount{{Type: mount.TypeBind, Source: "/root", Target: "/r"}, {Type: mount.TypeVolume, Source: "data", Target: "/d"}}}),
+			[]string{"bind mount of /root"}},
+		{"every violation", strict,
+			request("quay.io/x/y", &container.HostConfig{Privileged: true, NetworkMode: "host", Binds: []string{"/var/run/docker.sock:/var/run/docker.sock"}}),
+			[]string{"quay.io", "privileged", "host network", "/var/run/docker.sock"}},
+		{"root allows any bind", createPolicy{bindPrefixes: []string{"/"}}, request("nginx", &container.HostConfig{Binds: []string{"/etc:/etc"}}), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.policy.violations(tt.req)
+			if len(got) != len(tt.want) {
+				t.Fatalf("violations = %q, want %d", got, len(tt.want))
+			}
+			for i, want := range tt.want {
+				if !strings.Contains(got[i], want) {
+					t.Errorf("violation %d = %q, want it to mention %q", i, got[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadCreatePolicy(t *testing.T) {
+	t.Setenv("DESTINATION_DENY_PRIVILEGED", "true")
+	t.Setenv("DESTINATION_ALLOWED_BIND_PREFIXES", "/srv/, /data")
+	t.Setenv("DESTINATION_ALLOWED_REGISTRIES", "https://index.docker.io/, Registry.Example.com")
+	v := &config.Validator{}
+	var cfg Config
+	loadCreatePolicy(v, &cfg)
+	if err := v.Err(); err != nil {
+		t.Fatal(err)
+	}
+	p := cfg.CreatePolicy
+	if !p.denyPrivileged || p.denyHostNetwork {
+		t.Errorf("deny privileged %t, host network %t, want true and false", p.denyPrivileged, p.denyHostNetwork)
+	}
+	if got := strings.Join(p.bindPrefixes, ","); got != "/srv,/data" {
+		t.Errorf("bind prefixes = %s", got)
+	}
+	if got := strings.Join(p.registries, ","); got != "docker.io,registry.example.com" {
+		t.Errorf("registries = %s", got)
+	}
+
+	t.Setenv("DESTINATION_ALLOWED_BIND_PREFIXES", "srv")
+	v = &config.Validator{}
+	loadCreatePolicy(v, &cfg)
+	if v.Err() == nil {
+		t.Error("a relative bind prefix was accepted")
+	}
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"dockerap/apiclient"
+	"dockerap/store"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/distribution/reference"
+	"github.com/docker/docker/api/types/registry"
+)
+
+// encodeRegistryAuth converts a stored credential into an X-Registry-Auth header value.
+func encodeRegistryAuth(c *store.RegistryCredential) (string, error) {
+	if c == nil {
+		return "", nil
+	}
+	return registry.EncodeAuthConfig(registry.AuthConfig{
+		Username:      c.Username,
+		Password:      c.Password,
+		ServerAddress: c.ServerAddress,
+		IdentityToken: c.IdentityToken,
+	})
+}
+
+// registryAuth converts a stored credential for sending with a pull.
+func registryAuth(c *store.RegistryCredential) *apiclient.RegistryAuth {
+	if c == nil {
+		return nil
+	}
+	return &apiclient.RegistryAuth{Name: c.Name, ServerAddress: c.ServerAddress, Username: c.Username, Password: c.Password, IdentityToken: c.IdentityToken}
+}
+
+// registryCredential converts a credential received with a pull.
+func registryCredential(a *apiclient.RegistryAuth) *store.RegistryCredential {
+	if a == nil {
+		return nil
+	}
+	return &store.RegistryCredential{Name: a.Name, ServerAddress: a.ServerAddress, Username: a.Username, Password: a.Password, IdentityToken: a.IdentityToken}
+}
+
+// credentialForImage returns the stored credential for the registry hosting
+// image, or nil if there is none.
+func (s *Server) credentialForImage(image string) (*store.RegistryCredential, error) {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return nil, nil
+	}
+	domain := reference.Domain(named)
+	cred, err := s.store.GetRegistryCredentialForServer(domain)
+	if cred != nil || err != nil || domain != "docker.io" {
+		return cred, err
+	}
+	// Docker Hub logins are commonly stored under the legacy index address
+	return s.store.GetRegistryCredentialForServer("https://index.docker.io/v1/")
+}
+
+// registryAuthForImage returns the encoded credential for image's registry, or "".
+func (s *Server) registryAuthForImage(image string) string {
+	cred, err := s.credentialForImage(image)
+	if err != nil {
+		slog.Error("Unable to look up registry credential", "image", image, "err", err)
+		return ""
+	}
+	auth, err := encodeRegistryAuth(cred)
+	if err != nil {
+		slog.Error("Unable to encode registry credential", "image", image, "err", err)
+		return ""
+	}
+	return auth
+}
+
+func (s *Server) handleRegistryCredentials(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		creds, err := s.store.GetRegistryCredentials()
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Unable to get registry credentials", "err", err)
+			writeError(w, r, "Unable to get registry credentials", err)
+			return
+		}
+		// Never hand secrets back out over the API
+		for i := range creds {
+			creds[i].Password = ""
+			creds[i].IdentityToken = ""
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(creds)
+
+	case http.MethodPost:
+		var cred store.RegistryCredential
+		if err := json.NewDecoder(r.Body).Decode(&cred); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if err := s.store.SaveRegistryCredential(cred); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		slog.InfoContext(r.Context(), "Saved registry credential", "name", cred.Name, "server", cred.ServerAddress)
+		w.WriteHeader(http.StatusOK)
+
+	case http.MethodDelete:
+		name := r.URL.Query().Get("name")
+		if err := s.store.DeleteRegistryCredential(name); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+
+	default:
+		http.Error(w, "Only GET, POST and DELETE methods are allowed", http.StatusMethodNotAllowed)
+	}
+}
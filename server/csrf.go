@@ -0,0 +1,71 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+)
+
+const (
+	csrfCookie = "dockerapp_csrf"
+	csrfHeader = "X-CSRF-Token"
+	csrfField  = "csrf_token"
+)
+
+// csrfToken returns the browser's CSRF token, issuing a new cookie if it has
+// none. Templates embed it so the page can send it back with every change.
+func (s *Server) csrfToken(w http.ResponseWriter, r *http.Request) string {
+	if c, err := r.Cookie(csrfCookie); err == nil && len(c.Value) == 64 {
+		return c.Value
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		slog.ErrorContext(r.Context(), "Unable to generate CSRF token", "err", err)
+		return ""
+	}
+	token := hex.EncodeToString(b)
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookie,
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   s.cfg.TLSEnabled(),
+		SameSite: http.SameSiteStrictMode,
+	})
+	return token
+}
+
+// csrfProtect rejects state-changing requests from browsers unless they echo
+// the CSRF cookie in the X-CSRF-Token header or a csrf_token form field.
+// Requests with a valid API token, from clients that are not browsers (no Origin
+// or Sec-Fetch-Site header) and from origins named in CORS_ALLOWED_ORIGINS
+// cannot be forged by another site and pass.
+func (s *Server) csrfProtect(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+		origin := r.Header.Get("Origin")
+		if s.validAPIToken(r) ||
+			(origin == "" && r.Header.Get("Sec-Fetch-Site") == "") || s.cfg.CORS.trusts(origin) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		c, err := r.Cookie(csrfCookie)
+		sent := r.Header.Get(csrfHeader)
+		if sent == "" {
+			sent = r.PostFormValue(csrfField)
+		}
+		if err != nil || c.Value == "" || subtle.ConstantTimeCompare([]byte(sent), []byte(c.Value)) != 1 {
+			slog.WarnContext(r.Context(), "Rejected request without a valid CSRF token", "method", r.Method, "path", r.URL.Path, "remote_addr", r.RemoteAddr)
+			writeProblem(w, r, http.StatusForbidden, codeCSRFInvalid, "Missing or invalid CSRF token; reload the page and try again")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"dockerap/config"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCSRFProtect(t *testing.T) {
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://app.example")
+	srv := newTestServer(t, testRoles)
+	srv.cfg.APIToken = "api-secret"
+	v := &config.Validator{}
+	loadCORS(v, srv.cfg)
+	if err := v.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	csrf := strings.Repeat("ab", 32)
+	tests := []struct {
+		name    string
+		method  string
+		cookie  bool   // logged in as ada with the CSRF cookie set
+		headers string // "Name: value" pairs separated by "; "
+		form    bool   // send the CSRF token as a form field
+		allowed bool
+	}{
+		{"read from another site", http.MethodGet, true, "Origin: https://evil.example", false, true},
+		{"script without an origin", http.MethodPost, true, "", false, true},
+		{"API token from another site", http.MethodPost, false, "Origin: https://evil.example; Authorization: Bearer api-secret", false, true},
+		{"trusted origin", http.MethodPost, true, "Origin: https://app.example", false, true},
+		{"token in the header", http.MethodPost, true, "Origin: https://evil.example; X-CSRF-Token: " + csrf, false, true},
+		{"token in the form", http.MethodPost, true, "Origin: https://evil.example", true, true},
+
+		{"cross-site cookie POST", http.MethodPost, true, "Origin: https://evil.example", false, false},
+		{"cross-site without an origin", http.MethodDelete, true, "Sec-Fetch-Site: cross-site", false, false},
+		{"wrong token", http.MethodPost, true, "Origin: https://evil.example; X-CSRF-Token: " + strings.Repeat("cd", 32), false, false},
+		{"wrong API token", http.MethodPost, true, "Origin: https://evil.example; Authorization: Bearer guess", false, false},
+		{"trusted origin's prefix", http.MethodPost, true, "Origin: https://app.example.evil.example", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var r *http.Request
+			if tt.form {
+				r = httptest.NewRequest(tt.method, "/api/settings", strings.NewReader(csrfField+"="+csrf))
+				r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			} else {
+				r = httptest.NewRequest(tt.method, "/api/settings", strings.NewReader(`{}`))
+			}
+			if tt.cookie {
+				token, err := srv.sessions.create("ada", time.Hour)
+				if err != nil {
+					t.Fatal(err)
+				}
+				r.AddCookie(&http.Cookie{Name: sessionCookie, Value: token})
+				r.AddCookie(&http.Cookie{Name: csrfCookie, Value: csrf})
+			}
+			for _, h := range strings.Split(tt.headers, "; ") {
+				if name, value, ok := strings.Cut(h, ": "); ok {
+					r.Header.Set(name, value)
+				}
+			}
+			w := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(w, r)
+
+			rejected := w.Code == http.StatusForbidden && strings.Contains(w.Body.String(), codeCSRFInvalid)
+			if rejected == tt.allowed {
+				t.Errorf("%s: %d %s, want allowed %t", tt.method, w.Code, w.Body, tt.allowed)
+			}
+		})
+	}
+}
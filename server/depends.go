@@ -0,0 +1,109 @@
+package server
+
+import (
+	"dockerap/startorder"
+	"log/slog"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+)
+
+// Labels Docker Compose sets on a service's containers.
+const (
+	composeServiceLabel   = "com.docker.compose.service"
+	composeDependsOnLabel = "com.docker.compose.depends_on" // "db:service_started:false,..."
+)
+
+// orderPlanContainers records what each planned container depends on and
+// sorts the containers so dependencies are created, and started, first.
+// Dependencies are inferred from legacy links, compose depends_on labels, and
+// environment values that name another container's network alias.
+func orderPlanContainers(plan *replicationPlan) {
+	byName := make(map[string]*plannedContainer, len(plan.Containers))
+	byService := make(map[string]string)          // project/service -> container name
+	byAlias := make(map[string]map[string]string) // network -> alias -> container name
+	for i := range plan.Containers {
+		c := plan.Containers[i].Inspect
+		name := containerName(c)
+		byName[name] = &plan.Containers[i]
+		if service := c.Config.Labels[composeServiceLabel]; service != "" {
+			byService[c.Config.Labels[composeProjectLabel]+"/"+service] = name
+		}
+		for netName, ep := range containerNetworks(c) {
+			if byAlias[netName] == nil {
+				byAlias[netName] = make(map[string]string)
+			}
+			byAlias[netName][name] = name
+			for _, alias := range append(append([]string(nil), ep.Aliases...), ep.DNSNames...) {
+				byAlias[netName][alias] = name
+			}
+		}
+	}
+
+	deps := make(map[string][]string, len(byName))
+	for name, pc := range byName {
+		found := make(map[string]bool)
+		for _, dep := range inferDependencies(pc.Inspect, byService, byAlias) {
+			if dep != name && byName[dep] != nil {
+				found[dep] = true
+			}
+		}
+		pc.DependsOn = sortedKeys(found)
+		deps[name] = pc.DependsOn
+	}
+
+	levels, cyclic := startorder.Levels(deps)
+	if len(cyclic) > 0 {
+		slog.Warn("Containers have circular dependencies; creating them in name order", "containers", cyclic)
+	}
+
+	ordered := make([]plannedContainer, 0, len(plan.Containers))
+	for _, name := range startorder.Flatten(levels) {
+		ordered = append(ordered, *byName[name])
+	}
+	plan.Containers = ordered
+}
+
+// inferDependencies returns the names of the containers c depends on.
+func inferDependencies(c types.ContainerJSON, byService map[string]string, byAlias map[string]map[string]string) []string {
+	var deps []string
+
+	// Legacy links: "/db:/web/db"
+	if c.HostConfig != nil {
+		for _, link := range c.HostConfig.Links {
+			target, _, _ := strings.Cut(link, ":")
+			deps = append(deps, strings.TrimPrefix(target, "/"))
+		}
+	}
+
+	// Compose depends_on: "db:service_started:false,cache:service_healthy:true"
+	project := c.Config.Labels[composeProjectLabel]
+	for _, entry := range strings.Split(c.Config.Labels[composeDependsOnLabel], ",") {
+		service, _, _ := strings.Cut(strings.TrimSpace(entry), ":")
+		if name, ok := byService[project+"/"+service]; ok && service != "" {
+			deps = append(deps, name)
+		}
+	}
+
+	// Environment values that mention a host on a shared network, e.g.
+	// DATABASE_URL=postgres://app@db:5432/app
+	for netName := range containerNetworks(c) {
+		aliases := byAlias[netName]
+		for _, env := range c.Config.Env {
+			_, value, _ := strings.Cut(env, "=")
+			for _, host := range hostTokens(value) {
+				if name, ok := aliases[host]; ok {
+					deps = append(deps, name)
+				}
+			}
+		}
+	}
+	return deps
+}
+
+// hostTokens splits s into the words that could be host names.
+func hostTokens(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.')
+	})
+}
@@ -0,0 +1,316 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"dockerap/store"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// destinationNamePattern limits destination names to what reads well in a
+// URL path and a replicate request.
+var destinationNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]{0,63}$`)
+
+// destinationView is a stored destination as the API shows it: the auth
+// token is never returned, only whether one is set.
+type destinationView struct {
+	store.Destination
+	AuthToken    string `json:"authToken,omitempty"`
+	HasAuthToken bool   `json:"hasAuthToken"`
+}
+
+func viewDestination(d store.Destination) destinationView {
+	return destinationView{Destination: d, HasAuthToken: d.AuthToken != ""}
+}
+
+// destinationInput is the body of a create or update. Enabled defaults to
+// true, and an update without authToken keeps the stored one.
+type destinationInput struct {
+	Name                  string `json:"name"`
+	URL                   string `json:"url"`
+	AuthToken             string `json:"authToken"`
+	TLSCACert             string `json:"tlsCaCert"`
+	TLSServerName         string `json:"tlsServerName"`
+	TLSInsecureSkipVerify bool   `json:"tlsInsecureSkipVerify"`
+	Enabled               *bool  `json:"enabled"`
+}
+
+// destination validates in and converts it for the store.
+func (in destinationInput) destination() (store.Destination, error) {
+	d := store.Destination{
+		Name:                  strings.TrimSpace(in.Name),
+		URL:                   strings.TrimRight(strings.TrimSpace(in.URL), "/"),
+		AuthToken:             in.AuthToken,
+		TLSCACert:             strings.TrimSpace(in.TLSCACert),
+		TLSServerName:         strings.TrimSpace(in.TLSServerName),
+		TLSInsecureSkipVerify: in.TLSInsecureSkipVerify,
+		Enabled:               in.Enabled == nil || *in.Enabled,
+	}
+	if !destinationNamePattern.MatchString(d.Name) {
+		return d, fmt.Errorf("invalid destination name %q: use letters, digits, '.', '_' and '-'", d.Name)
+	}
+	u, err := url.Parse(d.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return d, fmt.Errorf("invalid destination URL %q: expected http://host:port or https://host:port", d.URL)
+	}
+	if d.TLSCACert != "" && !x509.NewCertPool().AppendCertsFromPEM([]byte(d.TLSCACert)) {
+		return d, fmt.Errorf("tlsCaCert contains no PEM certificates")
+	}
+	if d.TLSInsecureSkipVerify && d.TLSCACert != "" {
+		return d, fmt.Errorf("tlsInsecureSkipVerify is set together with tlsCaCert, so the CA would be ignored")
+	}
+	return d, nil
+}
+
+// handleDestinations lists the stored destinations and creates new ones.
+func (s *Server) handleDestinations(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		dests, err := s.store.GetDestinations()
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Unable to get destinations", "err", err)
+			writeError(w, r, "Unable to get destinations", err)
+			return
+		}
+		views := make([]destinationView, 0, len(dests))
+		for _, d := range dests {
+			views = append(views, viewDestination(d))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(views)
+
+	case http.MethodPost:
+		var in destinationInput
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		d, err := in.destination()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := s.store.CreateDestination(d); err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, store.ErrDestinationExists) {
+				status = http.StatusConflict
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		s.destTransports.reset()
+		slog.InfoContext(r.Context(), "Saved destination", "name", d.Name, "url", d.URL)
+		s.writeDestination(w, r, d.Name, http.StatusCreated)
+
+	default:
+		http.Error(w, "Only GET and POST methods are allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleDestination reads, updates or deletes the destination named in the path.
+func (s *Server) handleDestination(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	switch r.Method {
+	case http.MethodGet:
+		s.writeDestination(w, r, name, http.StatusOK)
+
+	case http.MethodPut:
+		var in destinationInput
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		in.Name = name
+		d, err := in.destination()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if d.AuthToken == "" {
+			existing, err := s.store.GetDestination(name)
+			if errors.Is(err, store.ErrDestinationNotFound) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			d.AuthToken = existing.AuthToken
+		}
+		if err := s.store.UpdateDestination(d); err != nil {
+			status := http.StatusInternalServerError
+			switch {
+			case errors.Is(err, store.ErrDestinationNotFound):
+				status = http.StatusNotFound
+			case errors.Is(err, store.ErrDestinationExists):
+				status = http.StatusConflict
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		s.destTransports.reset()
+		slog.InfoContext(r.Context(), "Updated destination", "name", d.Name, "url", d.URL, "enabled", d.Enabled)
+		s.writeDestination(w, r, name, http.StatusOK)
+
+	case http.MethodDelete:
+		if err := s.store.DeleteDestination(name); err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, store.ErrDestinationNotFound) {
+				status = http.StatusNotFound
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		s.destTransports.reset()
+		slog.InfoContext(r.Context(), "Deleted destination", "name", name)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Only GET, PUT and DELETE methods are allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) writeDestination(w http.ResponseWriter, r *http.Request, name string, status int) {
+	d, err := s.store.GetDestination(name)
+	if errors.Is(err, store.ErrDestinationNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to get destination", "name", name, "err", err)
+		writeError(w, r, "Unable to get destination", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(viewDestination(*d))
+}
+
+// destinations returns the URLs a replicate, plan, verify or reconcile
+// request targets: its destination URLs followed by the stored destinations
+// it names. Unknown and disabled names are errors.
+func (s *Server) destinations(p *replicateRequest) ([]string, error) {
+	urls := p.destinations()
+	seen := make(map[string]bool)
+	for _, u := range urls {
+		seen[u] = true
+	}
+	for _, name := range p.DestinationNames {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		d, err := s.store.GetDestination(name)
+		if errors.Is(err, store.ErrDestinationNotFound) {
+			return nil, fmt.Errorf("unknown destination %q", name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to get destination %q: %w", name, err)
+		}
+		if !d.Enabled {
+			return nil, fmt.Errorf("destination %q is disabled", name)
+		}
+		if !seen[d.URL] {
+			seen[d.URL] = true
+			urls = append(urls, d.URL)
+		}
+	}
+	return urls, nil
+}
+
+// destinationTransports caches a transport per stored destination, so
+// connections are reused across the items of a job. Writes to the
+// destinations table reset it.
+type destinationTransports struct {
+	mu    sync.Mutex
+	byURL map[string]http.RoundTripper
+}
+
+func (t *destinationTransports) reset() {
+	t.mu.Lock()
+	t.byURL = nil
+	t.mu.Unlock()
+}
+
+// destinationTransport returns the transport for a stored destination at
+// dest, or nil when dest is not stored. Its TLS settings add to PEER_CA_FILE
+// and the mTLS client certificate, and its token replaces API_TOKEN.
+func (s *Server) destinationTransport(dest string) http.RoundTripper {
+	s.destTransports.mu.Lock()
+	defer s.destTransports.mu.Unlock()
+	if rt, ok := s.destTransports.byURL[dest]; ok {
+		return rt
+	}
+
+	d, err := s.store.GetDestinationByURL(dest)
+	if err != nil {
+		slog.Error("Unable to look up destination", "dest", dest, "err", err)
+		return nil
+	}
+	var rt http.RoundTripper
+	if d != nil {
+		rt = s.buildDestinationTransport(d)
+	}
+	if s.destTransports.byURL == nil {
+		s.destTransports.byURL = make(map[string]http.RoundTripper)
+	}
+	s.destTransports.byURL[dest] = rt
+	return rt
+}
+
+func (s *Server) buildDestinationTransport(d *store.Destination) http.RoundTripper {
+	var base http.RoundTripper = &requestIDTransport{base: s.destinationTLSTransport(d)}
+	token := s.cfg.APIToken
+	if d.AuthToken != "" {
+		token = d.AuthToken
+	}
+	if token != "" {
+		return &tokenTransport{base: base, token: token}
+	}
+	return base
+}
+
+// destinationTLSTransport is the peer transport with d's TLS settings, and no token.
+func (s *Server) destinationTLSTransport(d *store.Destination) http.RoundTripper {
+	var base http.RoundTripper = http.DefaultTransport
+	if s.cfg.PeerTransport != nil {
+		base = s.cfg.PeerTransport
+	}
+	if d.TLSCACert != "" || d.TLSServerName != "" || d.TLSInsecureSkipVerify {
+		if t, ok := base.(*http.Transport); ok {
+			t = t.Clone()
+			tlsConfig := &tls.Config{}
+			if t.TLSClientConfig != nil {
+				tlsConfig = t.TLSClientConfig.Clone()
+			}
+			if d.TLSCACert != "" {
+				var pool *x509.CertPool
+				if tlsConfig.RootCAs != nil {
+					pool = tlsConfig.RootCAs.Clone()
+				} else if sys, err := x509.SystemCertPool(); err == nil {
+					pool = sys
+				} else {
+					pool = x509.NewCertPool()
+				}
+				pool.AppendCertsFromPEM([]byte(d.TLSCACert))
+				tlsConfig.RootCAs = pool
+			}
+			if d.TLSServerName != "" {
+				tlsConfig.ServerName = d.TLSServerName
+			}
+			tlsConfig.InsecureSkipVerify = tlsConfig.InsecureSkipVerify || d.TLSInsecureSkipVerify
+			t.TLSClientConfig = tlsConfig
+			base = t
+		}
+	}
+	return base
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"dockerap/apiclient"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/docker/docker/api/types"
+)
+
+// summarizeDiskUsage works out per-category totals the way docker system df
+// does. Layers shared between images are counted once.
+func summarizeDiskUsage(du types.DiskUsage) apiclient.DiskUsage {
+	var out apiclient.DiskUsage
+
+	out.Images = apiclient.DiskUsageCategory{Count: len(du.Images), Size: du.LayersSize}
+	var imagesUsed int64
+	for _, img := range du.Images {
+		if img.Containers <= 0 {
+			continue
+		}
+		out.Images.Active++
+		if img.Size >= 0 && img.SharedSize >= 0 {
+			imagesUsed += img.Size - img.SharedSize
+		}
+	}
+	out.Images.Reclaimable = max(du.LayersSize-imagesUsed, 0)
+
+	out.Containers.Count = len(du.Containers)
+	for _, c := range du.Containers {
+		out.Containers.Size += c.SizeRw
+		if c.State == "running" || c.State == "paused" || c.State == "restarting" {
+			out.Containers.Active++
+		} else {
+			out.Containers.Reclaimable += c.SizeRw
+		}
+	}
+
+	out.Volumes.Count = len(du.Volumes)
+	for _, v := range du.Volumes {
+		if v.UsageData == nil || v.UsageData.Size < 0 {
+			continue // the driver cannot tell
+		}
+		out.Volumes.Size += v.UsageData.Size
+		if v.UsageData.RefCount > 0 {
+			out.Volumes.Active++
+		} else {
+			out.Volumes.Reclaimable += v.UsageData.Size
+		}
+	}
+
+	out.BuildCache.Count = len(du.BuildCache)
+	for _, bc := range du.BuildCache {
+		if bc.InUse {
+			out.BuildCache.Active++
+		}
+		if bc.Shared {
+			continue // counted with the images
+		}
+		out.BuildCache.Size += bc.Size
+		if !bc.InUse {
+			out.BuildCache.Reclaimable += bc.Size
+		}
+	}
+
+	for _, c := range []apiclient.DiskUsageCategory{out.Images, out.Containers, out.Volumes, out.BuildCache} {
+		out.Total += c.Size
+		out.Reclaimable += c.Reclaimable
+	}
+	return out
+}
+
+// handleSystemDF reports how much disk the local daemon's images,
+// containers, volumes and build cache use and how much of it could be
+// reclaimed, so a destination can be checked before a large copy.
+func (s *Server) handleSystemDF(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	cli, err := newDockerClient(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to create docker client", "err", err)
+		writeError(w, r, "Unable to create docker client", err)
+		return
+	}
+	defer cli.Close()
+
+	du, err := cli.DiskUsage(r.Context(), types.DiskUsageOptions{})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to read disk usage", "err", err)
+		writeError(w, r, "Unable to read disk usage", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summarizeDiskUsage(du))
+}
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"dockerap/config"
+	"dockerap/store"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// dockerContextMeta is the part of a context's meta.json the server reads.
+type dockerContextMeta struct {
+	Name      string `json:"Name"`
+	Endpoints map[string]struct {
+		Host          string `json:"Host"`
+		SkipTLSVerify bool   `json:"SkipTLSVerify"`
+	} `json:"Endpoints"`
+}
+
+// loadDockerContextsDir finds the contexts the docker CLI keeps under
+// DOCKER_CONFIG, or ~/.docker when it is not set.
+func loadDockerContextsDir(v *config.Validator, cfg *Config) {
+	dir := os.Getenv("DOCKER_CONFIG")
+	if dir != "" {
+		v.File("DOCKER_CONFIG", dir)
+	} else if home, err := os.UserHomeDir(); err == nil {
+		dir = filepath.Join(home, ".docker")
+	} else {
+		return
+	}
+	cfg.DockerContextsDir = filepath.Join(dir, "contexts")
+}
+
+// readDockerContexts reads the Docker contexts in dir as hosts, with the
+// TLS material the CLI stores beside them. The default context is the local
+// daemon and is not stored, and a missing directory holds no contexts.
+func readDockerContexts(dir string) ([]store.Host, error) {
+	if dir == "" {
+		return nil, nil
+	}
+	entries, err := os.ReadDir(filepath.Join(dir, "meta"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var hosts []store.Host
+	for _, e := range entries {
+		metaFile := filepath.Join(dir, "meta", e.Name(), "meta.json")
+		info, err := os.Stat(metaFile)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		data, err := os.ReadFile(metaFile)
+		if err != nil {
+			return nil, err
+		}
+		var meta dockerContextMeta
+		if err := json.Unmarshal(data, &meta); err != nil {
+			return nil, fmt.Errorf("invalid Docker context %s: %w", e.Name(), err)
+		}
+		endpoint, ok := meta.Endpoints["docker"]
+		if !ok || endpoint.Host == "" || strings.EqualFold(meta.Name, localHostName) {
+			continue
+		}
+		h := store.Host{
+			Name:                  meta.Name,
+			Address:               endpoint.Host,
+			TLSInsecureSkipVerify: endpoint.SkipTLSVerify,
+			// The CLI keeps no timestamps, so the metadata's is the best there is
+			CreatedAt: info.ModTime().UTC(),
+			UpdatedAt: info.ModTime().UTC(),
+		}
+		// TLS files live under the same digest of the name as the metadata
+		id := sha256.Sum256([]byte(meta.Name))
+		tlsDir := filepath.Join(dir, "tls", hex.EncodeToString(id[:]), "docker")
+		for file, field := range map[string]*string{"ca.pem": &h.TLSCACert, "cert.pem": &h.TLSCert, "key.pem": &h.TLSKey} {
+			pem, err := os.ReadFile(filepath.Join(tlsDir, file))
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return nil, fmt.Errorf("unable to read TLS files of Docker context %s: %w", meta.Name, err)
+			}
+			*field = string(pem)
+		}
+		hosts = append(hosts, h)
+	}
+	sort.Slice(hosts, func(i, j int) bool { return hosts[i].Name < hosts[j].Name })
+	return hosts, nil
+}
+
+// dockerContexts returns the Docker contexts that no stored host shadows.
+// Contexts are read on every call so ones made with docker context create
+// show up without a restart; an unreadable directory is logged and skipped.
+func (s *Server) dockerContexts(ctx context.Context, stored []store.Host) []store.Host {
+	contexts, err := readDockerContexts(s.cfg.DockerContextsDir)
+	if err != nil {
+		slog.WarnContext(ctx, "Unable to read Docker contexts", "dir", s.cfg.DockerContextsDir, "err", err)
+		return nil
+	}
+	taken := make(map[string]bool, len(stored))
+	for _, h := range stored {
+		taken[h.Name] = true
+	}
+	var out []store.Host
+	for _, h := range contexts {
+		if !taken[h.Name] {
+			out = append(out, h)
+		}
+	}
+	return out
+}
+
+// dockerContext returns the Docker context called name, for callers that
+// found no stored host by that name. A missing one is store.ErrHostNotFound.
+func (s *Server) dockerContext(ctx context.Context, name string) (*store.Host, error) {
+	for _, h := range s.dockerContexts(ctx, nil) {
+		if h.Name == name {
+			return &h, nil
+		}
+	}
+	return nil, store.ErrHostNotFound
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+)
+
+// eventsKeepAlive is how often an idle event stream sends a comment, so
+// proxies do not close it.
+const eventsKeepAlive = 30 * time.Second
+
+// eventTypes are the Docker event types /api/events passes on.
+var eventTypes = map[string]bool{
+	string(events.ContainerEventType): true,
+	string(events.VolumeEventType):    true,
+	string(events.NetworkEventType):   true,
+}
+
+// handleEvents streams the daemon's container, volume and network events as
+// server-sent events, one per Docker event, named after its type and carrying
+// the Docker event as JSON. ?type=container,volume narrows the types and
+// ?since=<unix time or duration> replays recent events first.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	args := filters.NewArgs()
+	if t := r.URL.Query().Get("type"); t != "" {
+		for _, typ := range strings.Split(t, ",") {
+			typ = strings.TrimSpace(typ)
+			if !eventTypes[typ] {
+				http.Error(w, fmt.Sprintf("Unknown event type %q; use container, volume or network", typ), http.StatusBadRequest)
+				return
+			}
+			args.Add("type", typ)
+		}
+	} else {
+		for typ := range eventTypes {
+			args.Add("type", typ)
+		}
+	}
+
+	cli, err := newDockerClient(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to create docker client", "err", err)
+		writeError(w, r, "Unable to create docker client", err)
+		return
+	}
+	defer cli.Close()
+
+	// Fail with a status while one can still be sent
+	ctx := r.Context()
+	if _, err := cli.Ping(ctx); err != nil {
+		slog.ErrorContext(ctx, "Unable to reach docker daemon", "err", err)
+		http.Error(w, fmt.Sprintf("Unable to reach docker daemon: %s", err), http.StatusBadGateway)
+		return
+	}
+	msgs, errs := cli.Events(ctx, types.EventsOptions{Since: r.URL.Query().Get("since"), Filters: args})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // keep nginx from buffering the stream
+	w.WriteHeader(http.StatusOK)
+	rc := http.NewResponseController(w)
+	rc.Flush()
+
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case err := <-errs:
+			if ctx.Err() == nil {
+				slog.WarnContext(ctx, "Docker event stream ended", "err", err)
+				fmt.Fprintf(w, "event: error\ndata: %s\n\n", strings.ReplaceAll(err.Error(), "\n", " "))
+				rc.Flush()
+			}
+			return
+		case msg := <-msgs:
+			data, err := json.Marshal(msg)
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", msg.Type, data); err != nil {
+				return
+			}
+			rc.Flush()
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			rc.Flush()
+		}
+	}
+}
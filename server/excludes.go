@@ -0,0 +1,131 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// excludeMatcher reports whether a path relative to a volume root is excluded.
+type excludeMatcher func(rel string) bool
+
+// compileExcludes builds a matcher from glob patterns. A pattern without a
+// slash (e.g. "*.log") matches a file or directory name at any depth; a
+// pattern with one (e.g. "cache/**") is matched against the whole path from
+// the volume root, where "**" spans directories. Excluding a directory
+// excludes everything beneath it.
+func compileExcludes(patterns []string) (excludeMatcher, error) {
+	var names []string
+	var paths []*regexp.Regexp
+	for _, p := range patterns {
+		p = strings.Trim(strings.TrimSpace(p), "/")
+		if p == "" {
+			continue
+		}
+		if !strings.Contains(p, "/") {
+			if _, err := path.Match(p, ""); err != nil {
+				return nil, fmt.Errorf("invalid exclude pattern %q: %w", p, err)
+			}
+			names = append(names, p)
+			continue
+		}
+		re, err := globToRegexp(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exclude pattern %q: %w", p, err)
+		}
+		paths = append(paths, re)
+	}
+
+	return func(rel string) bool {
+		rel = strings.Trim(rel, "/")
+		for _, elem := range strings.Split(rel, "/") {
+			for _, n := range names {
+				if ok, _ := path.Match(n, elem); ok {
+					return true
+				}
+			}
+		}
+		for _, re := range paths {
+			if re.MatchString(rel) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// globToRegexp translates a slash-separated glob into an anchored regexp that
+// also matches anything beneath a matching directory.
+func globToRegexp(glob string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				b.WriteString(".*")
+				i++
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("(/.*)?$")
+	return regexp.Compile(b.String())
+}
+
+// stripArchiveRoot turns a tar entry name from the Docker archive API, which
+// is rooted at the copied directory's name, into a path relative to it.
+func stripArchiveRoot(name string) string {
+	name = strings.TrimPrefix(name, "./")
+	if _, rest, found := strings.Cut(name, "/"); found {
+		return rest
+	}
+	return ""
+}
+
+func (s *Server) handleVolumeExcludes(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		excludes, err := s.store.GetVolumeExcludes()
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Unable to get volume excludes", "err", err)
+			writeError(w, r, "Unable to get volume excludes", err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(excludes)
+
+	case http.MethodPost:
+		var payload struct {
+			VolumeName string   `json:"volumeName"`
+			Patterns   []string `json:"patterns"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if _, err := compileExcludes(payload.Patterns); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := s.store.SetVolumeExcludes(payload.VolumeName, payload.Patterns); err != nil {
+			slog.ErrorContext(r.Context(), "Unable to save volume excludes", "err", err)
+			writeError(w, r, "Unable to save volume excludes", err)
+			return
+		}
+		slog.InfoContext(r.Context(), "Updated exclude patterns for volume", "volume", payload.VolumeName, "patterns", payload.Patterns)
+		w.WriteHeader(http.StatusOK)
+
+	default:
+		http.Error(w, "Only GET and POST methods are allowed", http.StatusMethodNotAllowed)
+	}
+}
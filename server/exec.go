@@ -0,0 +1,272 @@
+package server
+
+import (
+	"dockerap/store"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	"golang.org/x/net/websocket"
+)
+
+// execAttachTTL is how long a new exec session waits for its terminal to
+// attach before it is forgotten.
+const execAttachTTL = time.Minute
+
+// defaultExecCmd is run when an exec session names no command.
+var defaultExecCmd = []string{"/bin/sh"}
+
+// execSession is an exec instance created through the UI that has not been
+// attached to yet.
+type execSession struct {
+	Container string
+	User      string
+	Tty       bool
+	Expires   time.Time
+}
+
+// execSessions holds the exec instances waiting for a terminal. Only
+// instances created here can be attached to, and each only once.
+type execSessions struct {
+	mu       sync.Mutex
+	sessions map[string]execSession
+}
+
+func newExecSessions() *execSessions {
+	return &execSessions{sessions: make(map[string]execSession)}
+}
+
+func (st *execSessions) add(id string, sess execSession) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	now := time.Now()
+	for i, pending := range st.sessions {
+		if now.After(pending.Expires) {
+			delete(st.sessions, i)
+		}
+	}
+	sess.Expires = now.Add(execAttachTTL)
+	st.sessions[id] = sess
+}
+
+// take removes and returns the waiting session id.
+func (st *execSessions) take(id string) (execSession, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	sess, ok := st.sessions[id]
+	delete(st.sessions, id)
+	if !ok || time.Now().After(sess.Expires) {
+		return execSession{}, false
+	}
+	return sess, true
+}
+
+// execMessage is one JSON message on an exec WebSocket. The browser sends
+// stdin and resize messages; the server sends stdout and stderr, then exit
+// with the command's exit code.
+type execMessage struct {
+	Type string `json:"type"` // stdin, resize, stdout, stderr, exit or error
+	Data string `json:"data,omitempty"`
+	Cols uint   `json:"cols,omitempty"`
+	Rows uint   `json:"rows,omitempty"`
+	Code int    `json:"code,omitempty"`
+}
+
+// execWriter sends whatever is written to it to the browser as stdout or
+// stderr messages, holding back a rune split across writes.
+type execWriter struct {
+	conn    *websocket.Conn
+	stream  string
+	pending []byte
+}
+
+func (e *execWriter) Write(p []byte) (int, error) {
+	buf := append(e.pending, p...)
+	n := len(buf)
+	for i := 1; i <= utf8.UTFMax && i <= len(buf); i++ {
+		if utf8.RuneStart(buf[len(buf)-i]) {
+			if !utf8.FullRune(buf[len(buf)-i:]) {
+				n = len(buf) - i
+			}
+			break
+		}
+	}
+	e.pending = append([]byte(nil), buf[n:]...)
+	if n == 0 {
+		return len(p), nil
+	}
+	if err := websocket.JSON.Send(e.conn, execMessage{Type: e.stream, Data: string(buf[:n])}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// handleExecCreate creates an exec instance in a container for a browser
+// terminal and returns its ID, which /api/exec/{id} then attaches to. The
+// body may name the command (default /bin/sh), the user and working directory
+// to run it as, and whether to allocate a TTY.
+func (s *Server) handleExecCreate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var payload struct {
+		Cmd        []string `json:"cmd"`
+		User       string   `json:"user"`
+		WorkingDir string   `json:"workingDir"`
+		Tty        bool     `json:"tty"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+	if len(payload.Cmd) == 0 {
+		payload.Cmd = defaultExecCmd
+	}
+
+	cli, err := newDockerClient(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to create docker client", "err", err)
+		writeError(w, r, "Unable to create docker client", err)
+		return
+	}
+	defer cli.Close()
+
+	id := r.PathValue("id")
+	exec, err := cli.ContainerExecCreate(r.Context(), id, types.ExecConfig{
+		User:         payload.User,
+		WorkingDir:   payload.WorkingDir,
+		Cmd:          payload.Cmd,
+		Tty:          payload.Tty,
+		AttachStdin:  true,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+
+	p, _ := principalFrom(r.Context())
+	entry := store.AuditEntry{
+		Actor:      p.User,
+		RemoteAddr: r.RemoteAddr,
+		Action:     "container:exec",
+		Target:     id,
+		Outcome:    "created",
+		Detail:     strings.Join(payload.Cmd, " "),
+	}
+	if err != nil {
+		entry.Outcome = "failed"
+		entry.Detail += ": " + err.Error()
+	}
+	if auditErr := s.store.RecordAudit(entry); auditErr != nil {
+		slog.ErrorContext(r.Context(), "Unable to record audit entry", "action", entry.Action, "err", auditErr)
+	}
+
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to create exec session", "container", id, "err", err)
+		status := http.StatusInternalServerError
+		if client.IsErrNotFound(err) {
+			status = http.StatusNotFound
+		}
+		http.Error(w, fmt.Sprintf("Unable to create exec session: %s", err), status)
+		return
+	}
+
+	s.execs.add(exec.ID, execSession{Container: id, User: p.User, Tty: payload.Tty})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"id": exec.ID})
+}
+
+// handleExecAttach upgrades to a WebSocket and bridges it to an exec
+// instance created by handleExecCreate: stdin messages are written to the
+// command, its output comes back as stdout and stderr messages, and an exit
+// message carries its exit code. Only the user who created the session may
+// attach, once, within a minute.
+func (s *Server) handleExecAttach(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	p, _ := principalFrom(r.Context())
+	sess, ok := s.execs.take(id)
+	if !ok || sess.User != p.User {
+		http.Error(w, "Unknown or expired exec session", http.StatusNotFound)
+		return
+	}
+
+	ctx := r.Context()
+	cli, err := newDockerClient(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "Unable to create docker client", "err", err)
+		writeError(w, r, "Unable to create docker client", err)
+		return
+	}
+	defer cli.Close()
+
+	attach, err := cli.ContainerExecAttach(ctx, id, types.ExecStartCheck{Tty: sess.Tty})
+	if err != nil {
+		slog.ErrorContext(ctx, "Unable to attach to exec session", "container", sess.Container, "err", err)
+		http.Error(w, fmt.Sprintf("Unable to attach to exec session: %s", err), http.StatusBadGateway)
+		return
+	}
+	defer attach.Close()
+
+	ws := websocket.Server{
+		Handshake: s.checkOrigin,
+		Handler: func(conn *websocket.Conn) {
+			slog.InfoContext(ctx, "Terminal attached", "container", sess.Container, "user", p.User)
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				stdout := &execWriter{conn: conn, stream: "stdout"}
+				stderr := &execWriter{conn: conn, stream: "stderr"}
+				var err error
+				if sess.Tty {
+					_, err = io.Copy(stdout, attach.Reader)
+				} else {
+					_, err = stdcopy.StdCopy(stdout, stderr, attach.Reader)
+				}
+				if err != nil {
+					websocket.JSON.Send(conn, execMessage{Type: "error", Data: err.Error()})
+				}
+				if inspect, err := cli.ContainerExecInspect(ctx, id); err == nil {
+					websocket.JSON.Send(conn, execMessage{Type: "exit", Code: inspect.ExitCode})
+				}
+				conn.Close()
+			}()
+
+		read:
+			for {
+				var msg execMessage
+				if err := websocket.JSON.Receive(conn, &msg); err != nil {
+					break
+				}
+				switch msg.Type {
+				case "stdin":
+					if _, err := attach.Conn.Write([]byte(msg.Data)); err != nil {
+						break read
+					}
+				case "resize":
+					if sess.Tty && msg.Cols > 0 && msg.Rows > 0 {
+						cli.ContainerExecResize(ctx, id, container.ResizeOptions{Width: msg.Cols, Height: msg.Rows})
+					}
+				}
+			}
+
+			// The browser left, or the command ended and closed the socket
+			attach.Close()
+			<-done
+			slog.InfoContext(ctx, "Terminal detached", "container", sess.Container, "user", p.User)
+		},
+	}
+	ws.ServeHTTP(w, r)
+}
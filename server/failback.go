@@ -0,0 +1,155 @@
+package server
+
+import (
+	"context"
+	"dockerap/labels"
+	"dockerap/logging"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/client"
+)
+
+// DirectionFailback marks a report for a failback run.
+const DirectionFailback = "failback"
+
+// failbackRequest asks a standby to copy its replicas' volumes back to the
+// primary they were replicated from.
+type failbackRequest struct {
+	Primary      string `json:"primary"`      // URL of the original primary's DockerApp
+	SourceHost   string `json:"sourceHost"`   // source host label on the replicas, defaults to Primary
+	StopReplicas bool   `json:"stopReplicas"` // stop each replica before its volumes are read
+}
+
+// failbackMount is one volume of a local replica to copy back into the
+// source container of the same name on the primary.
+type failbackMount struct {
+	ReplicaID  string
+	SourceName string
+	Mount      dataMount
+}
+
+// planFailback finds the local replicas of sourceHost and the volumes to copy
+// back. A volume shared by several replicas is copied once.
+func (s *Server) planFailback(ctx context.Context, cli *client.Client, sourceHost string) ([]failbackMount, error) {
+	replicas, err := cli.ContainerList(ctx, container.ListOptions{
+		All: true,
+		Filters: filters.NewArgs(
+			filters.Arg("label", labels.Replica+"=true"),
+			filters.Arg("label", labels.SourceHost+"="+sourceHost),
+		),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list replicas: %w", err)
+	}
+	excludes, err := s.store.GetVolumeExcludes()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get volume excludes: %w", err)
+	}
+
+	var mounts []failbackMount
+	seen := make(map[string]bool)
+	for _, c := range replicas {
+		sourceName := c.Labels[labels.SourceName]
+		if sourceName == "" {
+			continue
+		}
+		for _, m := range c.Mounts {
+			if m.Type != mount.TypeVolume || isAnonymousVolume(m.Name) || seen[m.Name] {
+				continue
+			}
+			seen[m.Name] = true
+			mounts = append(mounts, failbackMount{
+				ReplicaID:  c.ID,
+				SourceName: sourceName,
+				Mount:      dataMount{Kind: m.Type, Source: m.Name, Path: m.Destination, Excludes: excludes[m.Name]},
+			})
+		}
+	}
+	return mounts, nil
+}
+
+// handleFailback runs on a standby: it reverses replication, copying the
+// volumes of its replicas back into the original containers on the primary,
+// and reports the run like any other replication job.
+func (s *Server) handleFailback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var payload failbackRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	payload.Primary = strings.TrimRight(payload.Primary, "/")
+	if payload.Primary == "" {
+		http.Error(w, "Primary address cannot be empty", http.StatusBadRequest)
+		return
+	}
+	if payload.SourceHost == "" {
+		payload.SourceHost = payload.Primary
+	}
+
+	cli, err := newDockerClient(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to create docker client", "err", err)
+		writeError(w, r, "Unable to create docker client", err)
+		return
+	}
+	defer cli.Close()
+
+	ctx := context.WithoutCancel(r.Context())
+	mounts, err := s.planFailback(ctx, cli, payload.SourceHost)
+	if err != nil {
+		slog.ErrorContext(ctx, "Unable to plan failback", "err", err)
+		writeError(w, r, "Unable to plan failback", err)
+		return
+	}
+	if len(mounts) == 0 {
+		http.Error(w, fmt.Sprintf("No replica volumes found for %s", payload.SourceHost), http.StatusNotFound)
+		return
+	}
+
+	if err := checkPeerAPI(ctx, s.peerClient(payload.Primary), payload.Primary); err != nil {
+		slog.ErrorContext(ctx, "Primary is not compatible", "primary", payload.Primary, "err", err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	jobID := newJobID()
+	report := &ReplicationReport{JobID: jobID, RequestID: logging.RequestID(r.Context()), Direction: DirectionFailback, StartedAt: time.Now().UTC()}
+	slog.InfoContext(ctx, "Failback job started", "job_id", jobID, "volumes", len(mounts), "primary", payload.Primary)
+
+	result := DestinationResult{Destination: payload.Primary}
+	stopped := make(map[string]bool)
+	for _, fm := range mounts {
+		result.run(ctx, s.peerTransport(payload.Primary), ItemResult{Type: "volume", Name: fm.Mount.Source}, func(httpClient *http.Client) error {
+			if payload.StopReplicas && !stopped[fm.ReplicaID] {
+				if err := cli.ContainerStop(ctx, fm.ReplicaID, container.StopOptions{}); err != nil {
+					return fmt.Errorf("stop replica %s: %w", fm.SourceName, err)
+				}
+				stopped[fm.ReplicaID] = true
+			}
+			return copyMountData(ctx, cli, httpClient, payload.Primary, fm.ReplicaID, fm.SourceName, fm.Mount)
+		})
+	}
+	result.DurationMs = time.Since(report.StartedAt).Milliseconds()
+
+	report.Destinations = []DestinationResult{result}
+	report.finish()
+	s.saveReport(report)
+	slog.InfoContext(ctx, "Failback job finished", "job_id", jobID, "status", report.Status, "duration", time.Duration(report.DurationMs)*time.Millisecond)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(report.httpStatus())
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"dockerap/store"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/docker/docker/client"
+)
+
+// selectionCounts is what the selection badge shows.
+type selectionCounts struct {
+	Profile    string
+	Containers int // including those selected by rules
+	Volumes    int
+	Networks   int
+	Images     int
+	Projects   int
+}
+
+// renderFragment writes one named template from fragments.html, bound to
+// the request like the index page it is part of.
+func (s *Server) renderFragment(w http.ResponseWriter, r *http.Request, name string, data any) {
+	p, _ := principalFrom(r.Context())
+	tmpl, err := s.indexTemplate(s.csrfToken(w, r), p)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to parse template", "err", err)
+		writeError(w, r, "Unable to parse template", err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := tmpl.ExecuteTemplate(w, name, data); err != nil {
+		slog.ErrorContext(r.Context(), "Unable to execute template", "template", name, "err", err)
+		writeError(w, r, "Unable to execute template", err)
+	}
+}
+
+// handleContainerFragment renders one container's rows of the list, so the
+// UI can swap them in after a change instead of reloading the page.
+func (s *Server) handleContainerFragment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	cli, err := newDockerClient(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to create docker client", "err", err)
+		writeError(w, r, "Unable to create docker client", err)
+		return
+	}
+	defer cli.Close()
+
+	page, err := s.containerInfos(r.Context(), cli, "", containerQuery{Page: 1, ID: r.PathValue("id")})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to build container list", "err", err)
+		writeError(w, r, "Unable to build container list", err)
+		return
+	}
+	if len(page.Containers) != 1 {
+		http.Error(w, fmt.Sprintf("No such container: %s", r.PathValue("id")), http.StatusNotFound)
+		return
+	}
+	s.renderFragment(w, r, "containerRow", page.Containers[0])
+}
+
+// handleSelectionFragment renders the badge counting what is selected, in
+// the profile named by ?profile= or the global selection.
+func (s *Server) handleSelectionFragment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	profile := r.URL.Query().Get("profile")
+	var cli *client.Client
+	if profile == "" {
+		var err error
+		cli, err = newDockerClient(r.Context())
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Unable to create docker client", "err", err)
+			writeError(w, r, "Unable to create docker client", err)
+			return
+		}
+		defer cli.Close()
+	}
+	sel, err := s.loadSelection(r.Context(), cli, "", profile)
+	if errors.Is(err, store.ErrProfileNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to load selection", "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if profile == "" {
+		if err := s.addRuleMatches(r.Context(), cli, sel); err != nil {
+			slog.ErrorContext(r.Context(), "Unable to evaluate selection rules", "err", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	s.renderFragment(w, r, "selectionBadge", selectionCounts{
+		Profile:    profile,
+		Containers: len(sel.Containers),
+		Volumes:    len(sel.Volumes),
+		Networks:   len(sel.Networks),
+		Images:     len(sel.Images),
+		Projects:   len(sel.Projects),
+	})
+}
+
+// handleJobFragments renders the progress cards of running and recently
+// finished replication jobs.
+func (s *Server) handleJobFragments(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s.renderFragment(w, r, "jobCards", s.jobs.list())
+}
+
+// handleJobFragment renders one job's progress card.
+func (s *Server) handleJobFragment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	job, ok := s.jobs.get(r.PathValue("id"))
+	if !ok {
+		http.Error(w, fmt.Sprintf("No running or recent job %s", r.PathValue("id")), http.StatusNotFound)
+		return
+	}
+	s.renderFragment(w, r, "jobCard", job)
+}
@@ -0,0 +1,234 @@
+package server
+
+import (
+	"dockerap/store"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+// Operations that can be placed behind a confirmation gate. Each one calls
+// checkConfirmation before it changes anything.
+const (
+	OpReconcile = "reconcile"
+	OpRollback  = "rollback"
+	OpPrune     = "prune"
+)
+
+var gatedOperations = []string{OpReconcile, OpRollback, OpPrune}
+
+// Confirmation is embedded in the payload of gated operations.
+type Confirmation struct {
+	Phrase     string `json:"confirmationPhrase"`
+	ApprovalID int64  `json:"approvalId"`
+}
+
+// checkConfirmation enforces the gate configured for op and records the
+// outcome in the audit log. A nil error means the operation may proceed.
+// Approvals are only honoured for the logged-in user who requested them.
+func (s *Server) checkConfirmation(r *http.Request, op string, c Confirmation) error {
+	p, loggedIn := principalFrom(r.Context())
+	gate, err := s.store.GetConfirmationGate(op)
+	if err != nil {
+		return fmt.Errorf("unable to load confirmation gate for %s: %w", op, err)
+	}
+
+	var checkErr error
+	switch gate.Mode {
+	case store.GateModeNone, "":
+		return nil
+	case store.GateModePhrase:
+		phrase := gate.Phrase
+		if phrase == "" {
+			phrase = op
+		}
+		if c.Phrase != phrase {
+			checkErr = fmt.Errorf("%s requires typing the confirmation phrase %q", op, phrase)
+		}
+	case store.GateModeApproval:
+		switch {
+		case c.ApprovalID == 0:
+			checkErr = fmt.Errorf("%s requires an approved request from a second user", op)
+		case !loggedIn:
+			checkErr = fmt.Errorf("%s requires an approval, which needs UI login to know who requested it", op)
+		default:
+			checkErr = s.store.ConsumeApproval(c.ApprovalID, op, p.User)
+		}
+	default:
+		checkErr = fmt.Errorf("unknown gate mode %q for %s", gate.Mode, op)
+	}
+
+	entry := store.AuditEntry{
+		Actor:      p.User,
+		RemoteAddr: r.RemoteAddr,
+		Action:     "confirm:" + op,
+		Target:     gate.Mode,
+		Outcome:    "confirmed",
+	}
+	if c.ApprovalID != 0 {
+		entry.Detail = fmt.Sprintf("approval %d", c.ApprovalID)
+	}
+	if checkErr != nil {
+		entry.Outcome = "rejected"
+		entry.Detail = checkErr.Error()
+	}
+	if err := s.store.RecordAudit(entry); err != nil {
+		slog.ErrorContext(r.Context(), "Unable to record audit entry", "op", op, "err", err)
+	}
+	return checkErr
+}
+
+func (s *Server) handleGates(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		configured, err := s.store.GetConfirmationGates()
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Unable to get confirmation gates", "err", err)
+			writeError(w, r, "Unable to get confirmation gates", err)
+			return
+		}
+		var gates []store.ConfirmationGate
+		for _, op := range gatedOperations {
+			g, ok := configured[op]
+			if !ok {
+				g = store.ConfirmationGate{Operation: op, Mode: store.GateModeNone}
+			}
+			gates = append(gates, g)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(gates)
+
+	case http.MethodPost:
+		var gate store.ConfirmationGate
+		if err := json.NewDecoder(r.Body).Decode(&gate); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if !isGatedOperation(gate.Operation) {
+			http.Error(w, fmt.Sprintf("Unknown operation: %s", gate.Operation), http.StatusBadRequest)
+			return
+		}
+		if err := s.store.SetConfirmationGate(gate); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		slog.InfoContext(r.Context(), "Confirmation gate set", "operation", gate.Operation, "mode", gate.Mode)
+		w.WriteHeader(http.StatusOK)
+
+	default:
+		http.Error(w, "Only GET and POST methods are allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) handleApprovals(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid approval id", http.StatusBadRequest)
+			return
+		}
+		approval, err := s.store.GetApproval(id)
+		if err == store.ErrApprovalNotFound {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(approval)
+
+	case http.MethodPost:
+		p, ok := principalFrom(r.Context())
+		if !ok {
+			http.Error(w, "Approvals need UI login to know who requested them", http.StatusBadRequest)
+			return
+		}
+		var payload struct {
+			Operation string `json:"operation"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if !isGatedOperation(payload.Operation) {
+			http.Error(w, fmt.Sprintf("Unknown operation: %s", payload.Operation), http.StatusBadRequest)
+			return
+		}
+		id, err := s.store.CreateApproval(payload.Operation, p.User)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		s.store.RecordAudit(store.AuditEntry{
+			Actor:      p.User,
+			RemoteAddr: r.RemoteAddr,
+			Action:     "approval:request",
+			Target:     payload.Operation,
+			Outcome:    "pending",
+			Detail:     fmt.Sprintf("approval %d", id),
+		})
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]int64{"id": id})
+
+	default:
+		http.Error(w, "Only GET and POST methods are allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) handleApprove(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	p, ok := principalFrom(r.Context())
+	if !ok {
+		http.Error(w, "Approvals need UI login to know who approved them", http.StatusBadRequest)
+		return
+	}
+	var payload struct {
+		ID int64 `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	entry := store.AuditEntry{
+		Actor:      p.User,
+		RemoteAddr: r.RemoteAddr,
+		Action:     "approval:approve",
+		Target:     strconv.FormatInt(payload.ID, 10),
+		Outcome:    "approved",
+	}
+	err := s.store.ApproveApproval(payload.ID, p.User)
+	if err != nil {
+		entry.Outcome = "rejected"
+		entry.Detail = err.Error()
+	}
+	s.store.RecordAudit(entry)
+
+	if err == store.ErrApprovalNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func isGatedOperation(op string) bool {
+	for _, o := range gatedOperations {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"dockerap/store"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// requestApproval posts body to /api/approvals as user and returns the new
+// approval's ID.
+func requestApproval(t *testing.T, srv *Server, user, body string) int64 {
+	t.Helper()
+	w := serve(t, srv, http.MethodPost, "/api/approvals", user, strings.NewReader(body))
+	if w.Code != http.StatusOK {
+		t.Fatalf("POST /api/approvals as %s: %d %s", user, w.Code, w.Body)
+	}
+	var res struct {
+		ID int64 `json:"id"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	return res.ID
+}
+
+func TestApprovalIdentitiesComeFromTheSession(t *testing.T) {
+	srv := newTestServer(t, map[string]role{"otto": roleOperator, "ada": roleAdmin, "alan": roleAdmin})
+
+	id := requestApproval(t, srv, "otto", `{"operation":"prune","requestedBy":"alan"}`)
+	a, err := srv.store.GetApproval(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.RequestedBy != "otto" {
+		t.Errorf("requestedBy = %q, want the logged-in otto", a.RequestedBy)
+	}
+
+	w := serve(t, srv, http.MethodPost, "/api/approvals/approve", "ada", strings.NewReader(fmt.Sprintf(`{"id":%d,"approvedBy":"alan"}`, id)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("approve as ada: %d %s", w.Code, w.Body)
+	}
+	if a, _ := srv.store.GetApproval(id); a.ApprovedBy != "ada" {
+		t.Errorf("approvedBy = %q, want the logged-in ada", a.ApprovedBy)
+	}
+
+	entries, err := srv.store.GetAudit(store.AuditFilter{Action: "approval"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if e.Actor == "alan" {
+			t.Errorf("audit entry %s is recorded as alan, who was only named in the body", e.Action)
+		}
+	}
+}
+
+func TestApprovalRejectsTheRequesterAsApprover(t *testing.T) {
+	srv := newTestServer(t, map[string]role{"ada": roleAdmin})
+	id := requestApproval(t, srv, "ada", `{"operation":"reconcile"}`)
+
+	w := serve(t, srv, http.MethodPost, "/api/approvals/approve", "ada", strings.NewReader(fmt.Sprintf(`{"id":%d}`, id)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("self-approval: %d %s, want 400", w.Code, w.Body)
+	}
+	if a, _ := srv.store.GetApproval(id); a.ApprovedAt != nil {
+		t.Errorf("approval %d was approved by its requester", id)
+	}
+}
+
+func TestApprovalOnlyConfirmsForItsRequester(t *testing.T) {
+	srv := newTestServer(t, map[string]role{"otto": roleOperator, "olga": roleOperator, "ada": roleAdmin})
+	if err := srv.store.SetConfirmationGate(store.ConfirmationGate{Operation: OpPrune, Mode: store.GateModeApproval}); err != nil {
+		t.Fatal(err)
+	}
+	id := requestApproval(t, srv, "otto", `{"operation":"prune"}`)
+	if w := serve(t, srv, http.MethodPost, "/api/approvals/approve", "ada", strings.NewReader(fmt.Sprintf(`{"id":%d}`, id))); w.Code != http.StatusOK {
+		t.Fatalf("approve as ada: %d %s", w.Code, w.Body)
+	}
+
+	confirm := func(user string) error {
+		r := httptest.NewRequest(http.MethodPost, "/api/prune/images", nil)
+		if user != "" {
+			r = r.WithContext(withPrincipal(r.Context(), principal{User: user, Role: roleOperator}))
+		}
+		return srv.checkConfirmation(r, OpPrune, Confirmation{ApprovalID: id})
+	}
+	if err := confirm(""); err == nil {
+		t.Error("confirmed without a logged-in user")
+	}
+	if err := confirm("olga"); err == nil {
+		t.Error("olga used otto's approval")
+	}
+	if err := confirm("otto"); err != nil {
+		t.Errorf("otto's approval: %v", err)
+	}
+	if err := confirm("otto"); err == nil {
+		t.Error("otto's approval confirmed a second run")
+	}
+}
+
+func TestEveryGatedOperationIsListed(t *testing.T) {
+	srv := newTestServer(t, testRoles)
+	w := serve(t, srv, http.MethodGet, "/api/gates", "vera", nil)
+	var gates []store.ConfirmationGate
+	if err := json.NewDecoder(w.Body).Decode(&gates); err != nil {
+		t.Fatal(err)
+	}
+	var ops []string
+	for _, g := range gates {
+		ops = append(ops, g.Operation)
+	}
+	if got, want := strings.Join(ops, " "), "reconcile rollback prune"; got != want {
+		t.Errorf("gates = %s, want %s", got, want)
+	}
+	if w := serve(t, srv, http.MethodPost, "/api/gates", "ada", strings.NewReader(`{"operation":"failover","mode":"phrase"}`)); w.Code != http.StatusBadRequest {
+		t.Errorf("POST a failover gate: %d, want 400 as nothing enforces it", w.Code)
+	}
+}
@@ -0,0 +1,27 @@
+package server
+
+import (
+	"context"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+)
+
+// effectiveHealthcheck returns the healthcheck the source container runs
+// with: its own, or else the one baked into its image. The replica gets it
+// explicitly so it keeps the same check even if the destination's copy of the
+// image was built or tagged differently.
+func effectiveHealthcheck(ctx context.Context, cli *client.Client, inspect types.ContainerJSON) (*container.HealthConfig, error) {
+	if inspect.Config.Healthcheck != nil {
+		return inspect.Config.Healthcheck, nil
+	}
+	img, _, err := cli.ImageInspectWithRaw(ctx, inspect.Image)
+	if err != nil {
+		return nil, err
+	}
+	if img.Config == nil {
+		return nil, nil
+	}
+	return img.Config.Healthcheck, nil
+}
@@ -0,0 +1,174 @@
+package server
+
+import (
+	"dockerap/store"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Page sizes for the replication history.
+const (
+	defaultHistoryLimit = 100
+	maxHistoryLimit     = 1000
+)
+
+// runRecord turns a finished job's report into its run and one item per
+// item and destination, as the history keeps them.
+func runRecord(rep *ReplicationReport) (store.Run, []store.RunItem) {
+	run := store.Run{
+		JobID:      rep.JobID,
+		RequestID:  rep.RequestID,
+		Profile:    rep.Profile,
+		Direction:  rep.Direction,
+		Status:     rep.Status,
+		Replicated: rep.Replicated,
+		Failed:     rep.Failed,
+		Bytes:      rep.Bytes,
+		DurationMs: rep.DurationMs,
+		StartedAt:  rep.StartedAt,
+		FinishedAt: rep.FinishedAt,
+	}
+	var errs []string
+	var items []store.RunItem
+	for _, d := range rep.Destinations {
+		if d.Error != "" {
+			errs = append(errs, d.Destination+": "+d.Error)
+		}
+		for _, item := range d.Items {
+			items = append(items, store.RunItem{
+				Destination: d.Destination,
+				Type:        item.Type,
+				Name:        item.Name,
+				Status:      item.Status,
+				Error:       item.Error,
+				Bytes:       item.Bytes,
+				DurationMs:  item.DurationMs,
+			})
+		}
+	}
+	run.Error = strings.Join(errs, "; ")
+	return run, items
+}
+
+// parseHistoryFilter reads the job, destination, type, name, status, since
+// and limit parameters. since is an RFC 3339 time or a duration back from
+// now, such as 24h.
+func parseHistoryFilter(v url.Values) (store.HistoryFilter, error) {
+	f := store.HistoryFilter{
+		JobID:       strings.TrimSpace(v.Get("job")),
+		Destination: strings.TrimRight(strings.TrimSpace(v.Get("destination")), "/"),
+		Type:        strings.TrimSpace(v.Get("type")),
+		Name:        strings.TrimSpace(v.Get("name")),
+		Status:      strings.TrimSpace(v.Get("status")),
+		Limit:       defaultHistoryLimit,
+	}
+	if since := strings.TrimSpace(v.Get("since")); since != "" {
+		if d, err := time.ParseDuration(since); err == nil {
+			f.Since = time.Now().Add(-d)
+		} else if t, err := time.Parse(time.RFC3339, since); err == nil {
+			f.Since = t
+		} else {
+			return f, fmt.Errorf("invalid since %q, expected an RFC 3339 time or a duration such as 24h", since)
+		}
+	}
+	if l := v.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 || n > maxHistoryLimit {
+			return f, fmt.Errorf("invalid limit %q, expected a number from 1 to %d", l, maxHistoryLimit)
+		}
+		f.Limit = n
+	}
+	return f, nil
+}
+
+// handleHistory lists the recorded outcome of every item of every run,
+// newest first. With ?lastSuccess=true it instead returns the most recent
+// successful run of each matching item on each destination.
+func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	f, err := parseHistoryFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var entries []store.HistoryEntry
+	if r.URL.Query().Get("lastSuccess") == "true" {
+		entries, err = s.store.GetLastSuccesses(f)
+	} else {
+		entries, err = s.store.GetHistory(f)
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to get history", "err", err)
+		writeError(w, r, "Unable to get history", err)
+		return
+	}
+	if entries == nil {
+		entries = []store.HistoryEntry{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// historyPage is what the history page shows.
+type historyPage struct {
+	Filter      store.HistoryFilter
+	Since       string // as typed, for the filter form
+	Entries     []store.HistoryEntry
+	LastSuccess []store.HistoryEntry
+}
+
+// Types and Statuses list what the history page's filters offer.
+func (p historyPage) Types() []string    { return []string{"container", "volume", "network"} }
+func (p historyPage) Statuses() []string { return []string{ItemReplicated, ItemFailed, ItemSkipped} }
+
+// handleHistoryPage renders the history with the same filters as
+// /api/history, below the last successful run of each item.
+func (s *Server) handleHistoryPage(w http.ResponseWriter, r *http.Request) {
+	f, err := parseHistoryFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	page := historyPage{Filter: f, Since: r.URL.Query().Get("since")}
+	if page.Entries, err = s.store.GetHistory(f); err == nil {
+		page.LastSuccess, err = s.store.GetLastSuccesses(f)
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to get history", "err", err)
+		writeError(w, r, "Unable to get history", err)
+		return
+	}
+
+	pages, err := s.pages()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to parse template", "err", err)
+		writeError(w, r, "Unable to parse template", err)
+		return
+	}
+	if err := pages.history.Execute(w, page); err != nil {
+		slog.ErrorContext(r.Context(), "Unable to execute template", "err", err)
+	}
+}
+
+// formatBytes renders n in binary units, like the UI's formatBytes.
+func formatBytes(n int64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	v, i := float64(n), 0
+	for v >= 1024 && i < len(units)-1 {
+		v /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%d B", n)
+	}
+	return fmt.Sprintf("%.1f %s", v, units[i])
+}
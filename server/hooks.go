@@ -0,0 +1,181 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"dockerap/store"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// Hook phases.
+const (
+	HookPre  = "pre"
+	HookPost = "post"
+)
+
+const (
+	defaultHookTimeout = 5 * time.Minute
+	maxHookOutput      = 4 << 10
+)
+
+// HookResult records one hook run inside a source container.
+type HookResult struct {
+	Container string `json:"container"`
+	Phase     string `json:"phase"`
+	ExitCode  int    `json:"exitCode"`
+	Output    string `json:"output,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// limitedBuffer keeps the first max bytes written to it and discards the rest.
+type limitedBuffer struct {
+	bytes.Buffer
+	max int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.Len(); room > 0 {
+		if len(p) > room {
+			b.Buffer.Write(p[:room])
+		} else {
+			b.Buffer.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+// runHook runs command with sh -c inside a container and waits for it.
+func runHook(ctx context.Context, cli *client.Client, containerID, command string, timeout time.Duration) (int, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	exec, err := cli.ContainerExecCreate(ctx, containerID, types.ExecConfig{
+		Cmd:          []string{"sh", "-c", command},
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return 0, "", fmt.Errorf("create exec: %w", err)
+	}
+	attach, err := cli.ContainerExecAttach(ctx, exec.ID, types.ExecStartCheck{})
+	if err != nil {
+		return 0, "", fmt.Errorf("start exec: %w", err)
+	}
+	defer attach.Close()
+
+	output := &limitedBuffer{max: maxHookOutput}
+	done := make(chan error, 1)
+	go func() {
+		_, err := stdcopy.StdCopy(output, output, attach.Reader)
+		done <- err
+	}()
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		// Stop the copy before reading what it wrote
+		attach.Close()
+		<-done
+		return 0, output.String(), fmt.Errorf("timed out after %s", timeout)
+	}
+	if err != nil {
+		return 0, output.String(), fmt.Errorf("read output: %w", err)
+	}
+
+	inspect, err := cli.ContainerExecInspect(ctx, exec.ID)
+	if err != nil {
+		return 0, output.String(), fmt.Errorf("inspect exec: %w", err)
+	}
+	if inspect.ExitCode != 0 {
+		return inspect.ExitCode, output.String(), fmt.Errorf("exited with status %d", inspect.ExitCode)
+	}
+	return 0, output.String(), nil
+}
+
+// runHooks runs the given phase of each planned container's hooks. Only
+// containers whose volumes are copied have hooks attached by buildPlan.
+// Containers whose pre hook fails are dropped from the plan, so their data
+// is not copied in an unknown state, but their post hook still runs to undo
+// whatever the pre hook got as far as doing.
+func (s *Server) runHooks(ctx context.Context, cli *client.Client, plan *replicationPlan, phase string) []HookResult {
+	containers := plan.Containers
+	if phase == HookPost {
+		containers = append(slices.Clone(plan.Containers), plan.preHookFailed...)
+	}
+
+	var results []HookResult
+	var kept []plannedContainer
+	for _, pc := range containers {
+		command := pc.Hooks.Pre
+		if phase == HookPost {
+			command = pc.Hooks.Post
+		}
+		if command == "" {
+			kept = append(kept, pc)
+			continue
+		}
+
+		timeout := defaultHookTimeout
+		if pc.Hooks.TimeoutSeconds > 0 {
+			timeout = time.Duration(pc.Hooks.TimeoutSeconds) * time.Second
+		}
+		name := containerName(pc.Inspect)
+		slog.InfoContext(ctx, "Running replication hook", "phase", phase, "container", name, "command", command)
+		exitCode, output, err := runHook(ctx, cli, pc.Inspect.ID, command, timeout)
+		result := HookResult{Container: name, Phase: phase, ExitCode: exitCode, Output: output}
+		if err != nil {
+			slog.ErrorContext(ctx, "Replication hook failed", "phase", phase, "container", name, "err", err)
+			result.Error = err.Error()
+			if phase == HookPre {
+				plan.Skipped = append(plan.Skipped, ItemResult{Type: "container", Name: name, Status: ItemFailed, Error: "pre-replication hook: " + err.Error()})
+				plan.preHookFailed = append(plan.preHookFailed, pc)
+				results = append(results, result)
+				continue
+			}
+		}
+		results = append(results, result)
+		kept = append(kept, pc)
+	}
+	if phase == HookPre {
+		plan.Containers = kept
+	}
+	return results
+}
+
+func (s *Server) handleHooks(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		hooks, err := s.store.GetReplicationHooks()
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Unable to get replication hooks", "err", err)
+			writeError(w, r, "Unable to get replication hooks", err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(hooks)
+
+	case http.MethodPost:
+		var hooks store.ReplicationHooks
+		if err := json.NewDecoder(r.Body).Decode(&hooks); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if err := s.store.SetReplicationHooks(hooks); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		slog.InfoContext(r.Context(), "Updated replication hooks for container", "container_id", hooks.ContainerID)
+		w.WriteHeader(http.StatusOK)
+
+	default:
+		http.Error(w, "Only GET and POST methods are allowed", http.StatusMethodNotAllowed)
+	}
+}
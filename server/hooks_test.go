@@ -0,0 +1,173 @@
+package server
+
+import (
+	"dockerap/store"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+func TestLimitedBufferKeepsTheFirstBytes(t *testing.T) {
+	tests := []struct {
+		writes []string
+		want   string
+	}{
+		{[]string{"abc"}, "abc"},
+		{[]string{"abcdef"}, "abcde"},
+		{[]string{"ab", "cd", "ef", "gh"}, "abcde"},
+		{[]string{"abcde", "f"}, "abcde"},
+	}
+	for _, tt := range tests {
+		b := &limitedBuffer{max: 5}
+		for _, w := range tt.writes {
+			if n, err := b.Write([]byte(w)); n != len(w) || err != nil {
+				t.Errorf("Write(%q) = %d, %v, want every byte taken", w, n, err)
+			}
+		}
+		if got := b.String(); got != tt.want {
+			t.Errorf("after %q: %q, want %q", tt.writes, got, tt.want)
+		}
+	}
+}
+
+// execBehaviour is what a fake exec writes and exits with. A hung exec
+// writes its output and then never finishes.
+type execBehaviour struct {
+	output string
+	exit   int
+	hang   bool
+}
+
+// fakeExecDaemon serves exec create, start and inspect as a Docker daemon
+// would, running each command as commands describes, and records the
+// commands in the order they ran.
+func fakeExecDaemon(t *testing.T, commands map[string]execBehaviour) (*client.Client, func() []string) {
+	t.Helper()
+	var mu sync.Mutex
+	var ran []string
+	var execs []string // exec ID i-1 runs execs[i-1]
+	hung := make(chan struct{})
+	command := func(path string) string { // run by the exec that path names
+		mu.Lock()
+		defer mu.Unlock()
+		n, _ := strconv.Atoi(strings.TrimPrefix(strings.Split(path, "/")[2], "exec"))
+		return execs[n-1]
+	}
+
+	daemon := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Api-Version", "1.43")
+		path := r.URL.Path[strings.Index(r.URL.Path[1:], "/")+1:] // without the version
+		switch {
+		case strings.HasSuffix(path, "/exec") && strings.HasPrefix(path, "/containers/"):
+			var cfg types.ExecConfig
+			json.NewDecoder(r.Body).Decode(&cfg)
+			mu.Lock()
+			execs = append(execs, cfg.Cmd[len(cfg.Cmd)-1])
+			id := len(execs)
+			mu.Unlock()
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{"Id": "exec" + strconv.Itoa(id)})
+		case strings.HasPrefix(path, "/exec/") && strings.HasSuffix(path, "/start"):
+			cmd := command(path)
+			mu.Lock()
+			ran = append(ran, cmd)
+			mu.Unlock()
+			conn, buf, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			buf.WriteString("HTTP/1.1 101 UPGRADED\r\nContent-Type: application/vnd.docker.raw-stream\r\nConnection: Upgrade\r\nUpgrade: tcp\r\n\r\n")
+			stdcopy.NewStdWriter(buf, stdcopy.Stdout).Write([]byte(commands[cmd].output))
+			buf.Flush()
+			if commands[cmd].hang {
+				<-hung
+			}
+		case strings.HasPrefix(path, "/exec/") && strings.HasSuffix(path, "/json"):
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]int{"ExitCode": commands[command(path)].exit})
+		default:
+			http.Error(w, `{"message":"page not found"}`, http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(func() {
+		close(hung)
+		daemon.Close()
+	})
+	cli, err := client.NewClientWithOpts(client.WithHost("tcp://"+strings.TrimPrefix(daemon.URL, "http://")), client.WithVersion("1.43"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cli.Close() })
+	return cli, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), ran...)
+	}
+}
+
+func TestRunHookTimesOut(t *testing.T) {
+	cli, _ := fakeExecDaemon(t, map[string]execBehaviour{"sleep 3600": {output: "flushing\n", hang: true}})
+
+	start := time.Now()
+	_, output, err := runHook(t.Context(), cli, "abc", "sleep 3600", 200*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("err = %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("runHook returned after %s, want soon after its timeout", elapsed)
+	}
+	if output != "flushing\n" {
+		t.Errorf("output = %q, want what the hook wrote before timing out", output)
+	}
+}
+
+func TestRunHooksRunsPostHookAfterAFailedPreHook(t *testing.T) {
+	srv := newTestServer(t, nil)
+	cli, ran := fakeExecDaemon(t, map[string]execBehaviour{
+		"lock db":   {output: "lock failed\n", exit: 1},
+		"unlock db": {},
+		"lock web":  {},
+		"sync web":  {},
+	})
+	container := func(id, name, pre, post string) plannedContainer {
+		var pc plannedContainer
+		pc.Inspect.ContainerJSONBase = &types.ContainerJSONBase{ID: id, Name: "/" + name}
+		pc.Hooks = store.ReplicationHooks{ContainerID: id, Pre: pre, Post: post}
+		return pc
+	}
+	plan := &replicationPlan{Containers: []plannedContainer{
+		container("db1", "db", "lock db", "unlock db"),
+		container("web1", "web", "lock web", "sync web"),
+		container("cache1", "cache", "", ""),
+	}}
+
+	pre := srv.runHooks(t.Context(), cli, plan, HookPre)
+	if len(pre) != 2 || pre[0].Error == "" || pre[1].Error != "" {
+		t.Errorf("pre hook results = %+v, want db's failed and web's succeeded", pre)
+	}
+	var names []string
+	for _, pc := range plan.Containers {
+		names = append(names, containerName(pc.Inspect))
+	}
+	if strings.Join(names, " ") != "web cache" {
+		t.Errorf("planned containers = %v, want db dropped", names)
+	}
+
+	srv.runHooks(t.Context(), cli, plan, HookPost)
+	if got, want := strings.Join(ran(), ", "), "lock db, lock web, sync web, unlock db"; got != want {
+		t.Errorf("hooks ran %s, want %s", got, want)
+	}
+	if len(plan.Containers) != 2 {
+		t.Errorf("post hooks put %d containers back in the plan, want 2", len(plan.Containers))
+	}
+}
@@ -0,0 +1,367 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"dockerap/logging"
+	"dockerap/store"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/client"
+)
+
+// localHostName names the Docker daemon the server itself is configured for,
+// through DOCKER_HOST or the default socket. It cannot be stored.
+const localHostName = "local"
+
+// hostListTimeout bounds how long one unreachable host may hold up the
+// grouped container list.
+const hostListTimeout = 10 * time.Second
+
+// hostView is a host as the API shows it: the client key is never returned,
+// only whether one is set.
+type hostView struct {
+	store.Host
+	TLSKey    string `json:"tlsKey,omitempty"`
+	HasTLSKey bool   `json:"hasTlsKey"`
+	Context   bool   `json:"context,omitempty"` // read from a Docker context, so managed with the docker CLI
+}
+
+func viewHost(h store.Host, fromContext bool) hostView {
+	return hostView{Host: h, HasTLSKey: h.TLSKey != "", Context: fromContext}
+}
+
+// contextHostError answers a change to a host that is only a Docker context,
+// or reports not found.
+func (s *Server) contextHostError(w http.ResponseWriter, r *http.Request, name string) {
+	if _, err := s.dockerContext(r.Context(), name); err == nil {
+		http.Error(w, fmt.Sprintf("docker host %s is a Docker context; change it with docker context update or rm", name), http.StatusConflict)
+		return
+	}
+	http.Error(w, store.ErrHostNotFound.Error(), http.StatusNotFound)
+}
+
+// hostInput is the body of a create or update. An update without tlsKey
+// keeps the stored one.
+type hostInput struct {
+	Name                  string `json:"name"`
+	Address               string `json:"address"`
+	TLSCACert             string `json:"tlsCaCert"`
+	TLSCert               string `json:"tlsCert"`
+	TLSKey                string `json:"tlsKey"`
+	TLSInsecureSkipVerify bool   `json:"tlsInsecureSkipVerify"`
+}
+
+// host validates in and converts it for the store. The key is checked
+// against the certificate by the caller once a stored key is filled in.
+func (in hostInput) host() (store.Host, error) {
+	h := store.Host{
+		Name:                  strings.TrimSpace(in.Name),
+		Address:               strings.TrimRight(strings.TrimSpace(in.Address), "/"),
+		TLSCACert:             strings.TrimSpace(in.TLSCACert),
+		TLSCert:               strings.TrimSpace(in.TLSCert),
+		TLSKey:                strings.TrimSpace(in.TLSKey),
+		TLSInsecureSkipVerify: in.TLSInsecureSkipVerify,
+	}
+	if !destinationNamePattern.MatchString(h.Name) {
+		return h, fmt.Errorf("invalid host name %q: use letters, digits, '.', '_' and '-'", h.Name)
+	}
+	if strings.EqualFold(h.Name, localHostName) {
+		return h, fmt.Errorf("%q names the local Docker daemon and cannot be stored", h.Name)
+	}
+	u, err := url.Parse(h.Address)
+	switch {
+	case err != nil:
+		return h, fmt.Errorf("invalid host address %q: %s", h.Address, err)
+	case u.Scheme == "tcp" && u.Host != "":
+	case u.Scheme == "unix" && u.Path != "":
+		if h.UsesTLS() {
+			return h, fmt.Errorf("TLS settings apply to tcp:// addresses only")
+		}
+	default:
+		return h, fmt.Errorf("invalid host address %q: expected tcp://host:port or unix:///path/to/docker.sock", h.Address)
+	}
+	if h.TLSCACert != "" && !x509.NewCertPool().AppendCertsFromPEM([]byte(h.TLSCACert)) {
+		return h, fmt.Errorf("tlsCaCert contains no PEM certificates")
+	}
+	if h.TLSInsecureSkipVerify && h.TLSCACert != "" {
+		return h, fmt.Errorf("tlsInsecureSkipVerify is set together with tlsCaCert, so the CA would be ignored")
+	}
+	return h, nil
+}
+
+// checkHostKeyPair checks that a host's client certificate and key belong
+// together, or that neither is set.
+func checkHostKeyPair(h store.Host) error {
+	if h.TLSCert == "" && h.TLSKey == "" {
+		return nil
+	}
+	if h.TLSCert == "" || h.TLSKey == "" {
+		return fmt.Errorf("tlsCert and tlsKey must be set together")
+	}
+	if _, err := tls.X509KeyPair([]byte(h.TLSCert), []byte(h.TLSKey)); err != nil {
+		return fmt.Errorf("invalid client certificate: %w", err)
+	}
+	return nil
+}
+
+// handleHosts lists the stored Docker hosts and creates new ones.
+func (s *Server) handleHosts(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		hosts, err := s.store.GetHosts()
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Unable to get docker hosts", "err", err)
+			writeError(w, r, "Unable to get docker hosts", err)
+			return
+		}
+		views := make([]hostView, 0, len(hosts))
+		for _, h := range hosts {
+			views = append(views, viewHost(h, false))
+		}
+		for _, h := range s.dockerContexts(r.Context(), hosts) {
+			views = append(views, viewHost(h, true))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(views)
+
+	case http.MethodPost:
+		var in hostInput
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		h, err := in.host()
+		if err == nil {
+			err = checkHostKeyPair(h)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := s.store.CreateHost(h); err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, store.ErrHostExists) {
+				status = http.StatusConflict
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		slog.InfoContext(r.Context(), "Saved docker host", "name", h.Name, "address", h.Address)
+		s.writeHost(w, r, h.Name, http.StatusCreated)
+
+	default:
+		http.Error(w, "Only GET and POST methods are allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleHost reads, updates or deletes the Docker host named in the path.
+func (s *Server) handleHost(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	switch r.Method {
+	case http.MethodGet:
+		s.writeHost(w, r, name, http.StatusOK)
+
+	case http.MethodPut:
+		var in hostInput
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		in.Name = name
+		h, err := in.host()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if h.TLSKey == "" && h.TLSCert != "" {
+			existing, err := s.store.GetHost(name)
+			if errors.Is(err, store.ErrHostNotFound) {
+				s.contextHostError(w, r, name)
+				return
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			h.TLSKey = existing.TLSKey
+		}
+		if err := checkHostKeyPair(h); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := s.store.UpdateHost(h); err != nil {
+			if errors.Is(err, store.ErrHostNotFound) {
+				s.contextHostError(w, r, name)
+				return
+			}
+			status := http.StatusInternalServerError
+			if errors.Is(err, store.ErrHostExists) {
+				status = http.StatusConflict
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		slog.InfoContext(r.Context(), "Updated docker host", "name", h.Name, "address", h.Address)
+		s.writeHost(w, r, name, http.StatusOK)
+
+	case http.MethodDelete:
+		if err := s.store.DeleteHost(name); err != nil {
+			if errors.Is(err, store.ErrHostNotFound) {
+				s.contextHostError(w, r, name)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		slog.InfoContext(r.Context(), "Deleted docker host", "name", name)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Only GET, PUT and DELETE methods are allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) writeHost(w http.ResponseWriter, r *http.Request, name string, status int) {
+	h, err := s.store.GetHost(name)
+	fromContext := false
+	if errors.Is(err, store.ErrHostNotFound) {
+		h, err = s.dockerContext(r.Context(), name)
+		fromContext = true
+	}
+	if errors.Is(err, store.ErrHostNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to get docker host", "name", name, "err", err)
+		writeError(w, r, "Unable to get docker host", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(viewHost(*h, fromContext))
+}
+
+// dockerClientFor connects to the named Docker host, a stored one or else a
+// Docker context, or to the local daemon when name is empty or "local". An
+// unknown name is store.ErrHostNotFound.
+func (s *Server) dockerClientFor(ctx context.Context, name string) (*client.Client, error) {
+	if name == "" || name == localHostName {
+		return newDockerClient(ctx)
+	}
+	h, err := s.store.GetHost(name)
+	if errors.Is(err, store.ErrHostNotFound) {
+		h, err = s.dockerContext(ctx, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if scheme, _, _ := strings.Cut(h.Address, "://"); scheme != "tcp" && scheme != "unix" {
+		return nil, fmt.Errorf("docker host %s is reached over %s, which only the docker CLI supports; use a tcp:// or unix:// address", h.Name, scheme)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if h.UsesTLS() {
+		tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12, InsecureSkipVerify: h.TLSInsecureSkipVerify}
+		if h.TLSCACert != "" {
+			pool := x509.NewCertPool()
+			pool.AppendCertsFromPEM([]byte(h.TLSCACert))
+			tlsConfig.RootCAs = pool
+		}
+		if h.TLSCert != "" {
+			cert, err := tls.X509KeyPair([]byte(h.TLSCert), []byte(h.TLSKey))
+			if err != nil {
+				return nil, fmt.Errorf("invalid client certificate for host %s: %w", h.Name, err)
+			}
+			tlsConfig.Certificates = []tls.Certificate{cert}
+		}
+		transport.TLSClientConfig = tlsConfig
+	} else {
+		// The client speaks https whenever the transport has a TLS config, and
+		// the default transport gains one once it has made an HTTP/2 request
+		transport.TLSClientConfig = nil
+	}
+	// The address is applied after the HTTP client so a unix socket gets its dialer
+	opts := []client.Opt{client.WithHTTPClient(&http.Client{Transport: transport}), client.WithHost(h.Address), client.WithAPIVersionNegotiation()}
+	if id := logging.RequestID(ctx); id != "" {
+		opts = append(opts, client.WithHTTPHeaders(map[string]string{requestIDHeader: id}))
+	}
+	return client.NewClientWithOpts(opts...)
+}
+
+// hostContainers is one host's group in the grouped container list.
+type hostContainers struct {
+	Host       string          `json:"host"`
+	Address    string          `json:"address,omitempty"`
+	Context    bool            `json:"context,omitempty"`
+	Error      string          `json:"error,omitempty"` // why the host could not be listed
+	Containers []ContainerInfo `json:"containers"`
+}
+
+// handleHostContainers lists the containers of the local daemon, every
+// stored host and every Docker context, grouped by host, with the filters of /api/containers. Hosts
+// are listed in parallel, and one that cannot be reached reports its error
+// without failing the others.
+func (s *Server) handleHostContainers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q, err := parseContainerQuery(r.URL.Query(), 0)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	hosts, err := s.store.GetHosts()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to get docker hosts", "err", err)
+		writeError(w, r, "Unable to get docker hosts", err)
+		return
+	}
+
+	groups := []hostContainers{{Host: localHostName}}
+	for _, h := range hosts {
+		groups = append(groups, hostContainers{Host: h.Name, Address: h.Address})
+	}
+	for _, h := range s.dockerContexts(r.Context(), hosts) {
+		groups = append(groups, hostContainers{Host: h.Name, Address: h.Address, Context: true})
+	}
+	var wg sync.WaitGroup
+	for i := range groups {
+		wg.Add(1)
+		go func(g *hostContainers) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(r.Context(), hostListTimeout)
+			defer cancel()
+			g.Containers = []ContainerInfo{}
+			cli, err := s.dockerClientFor(ctx, g.Host)
+			if err != nil {
+				g.Error = err.Error()
+				return
+			}
+			defer cli.Close()
+			page, err := s.containerInfos(ctx, cli, g.Host, q)
+			if err != nil {
+				slog.WarnContext(ctx, "Unable to list containers on docker host", "host", g.Host, "err", err)
+				g.Error = err.Error()
+				return
+			}
+			if page.Containers != nil {
+				g.Containers = page.Containers
+			}
+		}(&groups[i])
+	}
+	wg.Wait()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(groups)
+}
@@ -0,0 +1,177 @@
+package server
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"dockerap/apiclient"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/client"
+)
+
+// chainIDs returns the layer chain IDs for an image's ordered diff IDs. The
+// daemon stores layers by chain ID, so a layer is only reusable on the
+// destination if the whole stack beneath it is identical too.
+func chainIDs(diffIDs []string) []string {
+	ids := make([]string, 0, len(diffIDs))
+	for i, diffID := range diffIDs {
+		if i == 0 {
+			ids = append(ids, diffID)
+			continue
+		}
+		sum := sha256.Sum256([]byte(ids[i-1] + " " + diffID))
+		ids = append(ids, "sha256:"+hex.EncodeToString(sum[:]))
+	}
+	return ids
+}
+
+// Destination API: Report the layer chain IDs already present locally
+func (s *Server) handleImageLayers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	cli, err := newDockerClient(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to create docker client", "err", err)
+		writeError(w, r, "Unable to create docker client", err)
+		return
+	}
+	defer cli.Close()
+
+	ctx := context.WithoutCancel(r.Context())
+	images, err := cli.ImageList(ctx, image.ListOptions{All: true})
+	if err != nil {
+		slog.ErrorContext(ctx, "Unable to list images", "err", err)
+		writeError(w, r, "Unable to list images", err)
+		return
+	}
+
+	seen := make(map[string]bool)
+	chains := []string{}
+	for _, img := range images {
+		inspect, _, err := cli.ImageInspectWithRaw(ctx, img.ID)
+		if err != nil {
+			continue
+		}
+		for _, id := range chainIDs(inspect.RootFS.Layers) {
+			if !seen[id] {
+				seen[id] = true
+				chains = append(chains, id)
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(apiclient.ImageLayersResponse{ChainIDs: chains})
+}
+
+// fetchLayerChains asks dest which layer chain IDs it already has.
+func fetchLayerChains(ctx context.Context, httpClient *http.Client, dest string) (map[string]bool, error) {
+	ids, err := apiclient.New(dest, httpClient).ImageLayers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	chains := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		chains[id] = true
+	}
+	return chains, nil
+}
+
+// transferImageDelta streams image imageID to /api/v1/load-image, to be
+// tagged as tag, leaving out the layer blobs the destination already has.
+// The daemon skips reading layers it already stores, so the trimmed archive
+// loads to the same image. Layer blobs are found by name in the OCI layout
+// docker save writes from Docker 25 on; older daemons' archives name layers
+// by a legacy ID instead and are sent whole.
+func transferImageDelta(ctx context.Context, srcCli *client.Client, httpClient *http.Client, dest, imageID, tag string, existing map[string]bool) error {
+	inspect, _, err := srcCli.ImageInspectWithRaw(ctx, imageID)
+	if err != nil {
+		return fmt.Errorf("inspect image: %w", err)
+	}
+	skip := layersToSkip(inspect.RootFS.Layers, existing)
+
+	saved, err := srcCli.ImageSave(ctx, []string{imageID})
+	if err != nil {
+		return fmt.Errorf("save image: %w", err)
+	}
+	defer saved.Close()
+
+	pr, pw := io.Pipe()
+	skipped := 0
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		pw.CloseWithError(filterTar(saved, pw, func(name string) bool {
+			if skip[name] {
+				skipped++
+				return true
+			}
+			return false
+		}))
+	}()
+
+	err = apiclient.New(dest, httpClient).LoadImage(ctx, imageID, tag, pr)
+	pr.Close()
+	<-done
+	if err != nil {
+		return fmt.Errorf("load image: %w", err)
+	}
+	slog.InfoContext(ctx, "Delta transfer skipped layers", "image", tag, "dest", dest, "layers", skipped, "of", len(inspect.RootFS.Layers))
+	return nil
+}
+
+// layersToSkip returns the archive paths of the layer blobs, among an
+// image's ordered diff IDs, whose chain ID is in existing. A diff ID that
+// recurs higher up the image, as an empty layer can, is kept if any of its
+// chains is missing, since the daemon reads the blob for that one.
+func layersToSkip(diffIDs []string, existing map[string]bool) map[string]bool {
+	needed := make(map[string]bool)
+	for i, chain := range chainIDs(diffIDs) {
+		if !existing[chain] {
+			needed[diffIDs[i]] = true
+		}
+	}
+	skip := make(map[string]bool)
+	for _, diffID := range diffIDs {
+		if !needed[diffID] {
+			skip["blobs/"+strings.Replace(diffID, ":", "/", 1)] = true
+		}
+	}
+	return skip
+}
+
+// filterTar copies a tar stream from r to w, omitting entries for which skip returns true.
+func filterTar(r io.Reader, w io.Writer, skip func(name string) bool) error {
+	tr := tar.NewReader(r)
+	tw := tar.NewWriter(w)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if skip(hdr.Name) {
+			continue
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
@@ -0,0 +1,170 @@
+package server
+
+import (
+	"archive/tar"
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/client"
+)
+
+func TestLayersToSkipKeepsRecurringLayers(t *testing.T) {
+	base, app, empty := "sha256:"+strings.Repeat("a", 64), "sha256:"+strings.Repeat("b", 64), "sha256:"+strings.Repeat("e", 64)
+	diffIDs := []string{base, empty, app, empty}
+	chains := chainIDs(diffIDs)
+
+	skip := layersToSkip(diffIDs, map[string]bool{chains[0]: true, chains[1]: true})
+	if !skip["blobs/sha256/"+strings.Repeat("a", 64)] {
+		t.Errorf("skip = %v, want the base layer skipped", skip)
+	}
+	if len(skip) != 1 {
+		t.Errorf("skip = %v, want only the base layer: the empty layer is needed again above app", skip)
+	}
+}
+
+// zeros reads as an endless run of zero bytes.
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+// fakeImageDaemon serves inspect and save for image id, whose layers are
+// size bytes each, as a Docker daemon would. The save archive is generated
+// as it is read, in the OCI layout of Docker 25 and later.
+func fakeImageDaemon(t *testing.T, id string, diffIDs []string, size int64) *client.Client {
+	t.Helper()
+	daemon := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/images/"+id+"/json"):
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]any{"Id": id, "RootFS": map[string]any{"Type": "layers", "Layers": diffIDs}})
+		case strings.HasSuffix(r.URL.Path, "/images/get"):
+			w.Header().Set("Content-Type", "application/x-tar")
+			tw := tar.NewWriter(w)
+			for _, diffID := range diffIDs {
+				name := "blobs/" + strings.Replace(diffID, ":", "/", 1)
+				if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o444, Size: size}); err != nil {
+					return
+				}
+				if _, err := io.CopyN(tw, zeros{}, size); err != nil {
+					return
+				}
+			}
+			manifest, _ := json.Marshal([]map[string]any{{"Config": "blobs/sha256/" + strings.TrimPrefix(id, "sha256:"), "Layers": diffIDs}})
+			tw.WriteHeader(&tar.Header{Name: "manifest.json", Mode: 0o444, Size: int64(len(manifest))})
+			tw.Write(manifest)
+			tw.Close()
+		default:
+			http.Error(w, `{"message":"page not found"}`, http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(daemon.Close)
+	cli, err := client.NewClientWithOpts(client.WithHost("tcp://"+strings.TrimPrefix(daemon.URL, "http://")), client.WithVersion("1.43"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cli.Close() })
+	return cli
+}
+
+// resetPeakRSS clears the kernel's record of this process's peak resident
+// memory, so peakRSS reports the peak from now on.
+func resetPeakRSS() error {
+	return os.WriteFile("/proc/self/clear_refs", []byte("5"), 0)
+}
+
+// peakRSS returns this process's peak resident memory in bytes.
+func peakRSS() (int64, error) {
+	f, err := os.Open("/proc/self/status")
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if rest, ok := strings.CutPrefix(sc.Text(), "VmHWM:"); ok {
+			kb, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimSpace(rest), " kB"), 10, 64)
+			return kb << 10, err
+		}
+	}
+	return 0, fmt.Errorf("no VmHWM in /proc/self/status")
+}
+
+func TestImageDeltaStreamsInBoundedMemory(t *testing.T) {
+	if testing.Short() {
+		t.Skip("copies a 3 GiB image")
+	}
+	const layerSize = 768 << 20
+	var diffIDs []string
+	for _, c := range "abcd" {
+		diffIDs = append(diffIDs, "sha256:"+strings.Repeat(string(c), 64))
+	}
+	srcCli := fakeImageDaemon(t, "sha256:"+strings.Repeat("f", 64), diffIDs, layerSize)
+
+	var received []string
+	var total int64
+	dest := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/load-image" {
+			http.NotFound(w, r)
+			return
+		}
+		tr := tar.NewReader(r.Body)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			n, err := io.Copy(io.Discard, tr)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			received = append(received, hdr.Name)
+			total += n
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+	}))
+	defer dest.Close()
+
+	if err := resetPeakRSS(); err != nil {
+		t.Skipf("unable to reset peak RSS: %v", err)
+	}
+	before, err := peakRSS()
+	if err != nil {
+		t.Skip(err)
+	}
+
+	existing := map[string]bool{chainIDs(diffIDs)[0]: true}
+	if err := transferImageDelta(t.Context(), srcCli, dest.Client(), dest.URL, "sha256:"+strings.Repeat("f", 64), "app:1", existing); err != nil {
+		t.Fatal(err)
+	}
+
+	peak, err := peakRSS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if grew := peak - before; grew > 64<<20 {
+		t.Errorf("peak RSS grew by %d MiB copying %d MiB, want it bounded by 64 MiB", grew>>20, 4*layerSize>>20)
+	}
+	if want := []string{"blobs/sha256/" + strings.Repeat("b", 64), "blobs/sha256/" + strings.Repeat("c", 64), "blobs/sha256/" + strings.Repeat("d", 64), "manifest.json"}; strings.Join(received, " ") != strings.Join(want, " ") {
+		t.Errorf("destination received %v, want %v", received, want)
+	}
+	if total < 3*layerSize {
+		t.Errorf("destination received %d bytes, want the three missing layers", total)
+	}
+}
@@ -0,0 +1,271 @@
+package server
+
+import (
+	"context"
+	"dockerap/apiclient"
+	"dockerap/store"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/distribution/reference"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/jsonmessage"
+)
+
+// errImageDecisionRequired is returned when a container's image policy is
+// "prompt" and its tag now points at a different digest than the running image.
+type errImageDecisionRequired struct {
+	containerID   string
+	image         string
+	runningDigest string
+	latestDigest  string
+}
+
+func (e *errImageDecisionRequired) Error() string {
+	return fmt.Sprintf("image %s has a newer digest (%s, running %s); choose pin or follow for container %s",
+		e.image, e.latestDigest, e.runningDigest, e.containerID)
+}
+
+// resolveImageDigest decides which digest the destination should pull for
+// srcCont, on the named Docker host cli reaches, according to the
+// container's image policy. An empty digest means the destination follows
+// the tag. decision, if set, overrides a "prompt" policy for this run.
+func (s *Server) resolveImageDigest(ctx context.Context, cli *client.Client, host string, srcCont types.ContainerJSON, decision string) (string, error) {
+	policy, err := s.imagePolicy(host, srcCont)
+	if err != nil {
+		return "", fmt.Errorf("unable to get image policy: %w", err)
+	}
+
+	tag := srcCont.Config.Image
+	running, err := runningDigest(ctx, cli, srcCont)
+	if err != nil {
+		return "", err
+	}
+	if running == "" {
+		// Locally built or untagged images have no registry digest to pin to.
+		slog.InfoContext(ctx, "No repo digest for image", "tag", tag)
+		return "", nil
+	}
+
+	switch policy {
+	case store.ImagePolicyFollow:
+		return "", nil
+	case store.ImagePolicyPrompt:
+		dist, err := cli.DistributionInspect(ctx, tag, s.registryAuthForImage(tag))
+		if err != nil {
+			return "", fmt.Errorf("unable to resolve current digest for %s: %w", tag, err)
+		}
+		if dist.Descriptor.Digest.String() == running {
+			return running, nil
+		}
+		switch decision {
+		case store.ImagePolicyPin:
+			return running, nil
+		case store.ImagePolicyFollow:
+			return "", nil
+		}
+		return "", &errImageDecisionRequired{
+			containerID:   srcCont.ID,
+			image:         tag,
+			runningDigest: running,
+			latestDigest:  dist.Descriptor.Digest.String(),
+		}
+	default:
+		return running, nil
+	}
+}
+
+// runningDigest returns the registry digest of the image srcCont is running,
+// or "" if the image has no digest for the container's repository.
+func runningDigest(ctx context.Context, cli *client.Client, srcCont types.ContainerJSON) (string, error) {
+	img, _, err := cli.ImageInspectWithRaw(ctx, srcCont.Image)
+	if err != nil {
+		return "", fmt.Errorf("unable to inspect image %s: %w", srcCont.Config.Image, err)
+	}
+	return repoDigest(img.RepoDigests, srcCont.Config.Image), nil
+}
+
+// repoDigest returns the digest in repoDigests that belongs to image's
+// repository, or "" if there is none.
+func repoDigest(repoDigests []string, image string) string {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return ""
+	}
+	for _, rd := range repoDigests {
+		digested, err := reference.ParseNormalizedNamed(rd)
+		if err != nil {
+			continue
+		}
+		if canonical, ok := digested.(reference.Canonical); ok && digested.Name() == named.Name() {
+			return canonical.Digest().String()
+		}
+	}
+	return ""
+}
+
+// isDigestRef reports whether image already names a digest (repo@sha256:...).
+func isDigestRef(image string) bool {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return false
+	}
+	_, ok := named.(reference.Canonical)
+	return ok
+}
+
+// pinnedRef returns image@digest, replacing any tag, for pulling an exact image.
+func pinnedRef(image, digest string) (string, error) {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return "", err
+	}
+	return reference.FamiliarName(named) + "@" + digest, nil
+}
+
+// copyImage has the destination pull an image as pull describes. If it
+// cannot (locally built or private), image imageID is streamed from the
+// source with docker save/load and tagged as tag.
+func (s *Server) copyImage(ctx context.Context, srcCli *client.Client, httpClient *http.Client, dest string, pull apiclient.PullImageRequest, imageID, tag string) error {
+	cred, err := s.credentialForImage(pull.ImageName)
+	if err != nil {
+		return fmt.Errorf("look up registry credential: %w", err)
+	}
+	pull.RegistryAuth = registryAuth(cred)
+	if err := apiclient.New(dest, httpClient).PullImage(ctx, pull); err != nil {
+		slog.WarnContext(ctx, "Destination could not pull image, falling back to image transfer", "dest", dest, "image", tag, "err", err)
+		if err := transferImage(ctx, srcCli, httpClient, dest, imageID, tag); err != nil {
+			return fmt.Errorf("pull image %s failed and transfer fallback failed: %w", tag, err)
+		}
+	}
+	return nil
+}
+
+// transferImage streams image imageID from the source daemon to the
+// destination's /api/v1/load-image endpoint, for images the destination cannot
+// pull itself. The loaded image is tagged as tag, such as a container's image
+// name. Layers the destination already has are left out when it can report
+// them.
+func transferImage(ctx context.Context, srcCli *client.Client, httpClient *http.Client, dest, imageID, tag string) error {
+	existing, err := fetchLayerChains(ctx, httpClient, dest)
+	if err != nil {
+		slog.WarnContext(ctx, "Unable to get layer list, sending full image", "dest", dest, "err", err)
+	} else if len(existing) > 0 {
+		err := transferImageDelta(ctx, srcCli, httpClient, dest, imageID, tag, existing)
+		if err == nil {
+			return nil
+		}
+		slog.WarnContext(ctx, "Delta transfer failed, sending full image", "image", tag, "dest", dest, "err", err)
+	}
+
+	tar, err := srcCli.ImageSave(ctx, []string{imageID})
+	if err != nil {
+		return fmt.Errorf("save image: %w", err)
+	}
+	defer tar.Close()
+
+	if err := apiclient.New(dest, httpClient).LoadImage(ctx, imageID, tag, tar); err != nil {
+		return fmt.Errorf("load image: %w", err)
+	}
+	return nil
+}
+
+// drainJSONMessages consumes a Docker progress stream and returns the first
+// error reported in it.
+func drainJSONMessages(r io.Reader) error {
+	dec := json.NewDecoder(r)
+	for {
+		var msg jsonmessage.JSONMessage
+		if err := dec.Decode(&msg); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if msg.Error != nil {
+			return msg.Error
+		}
+	}
+}
+
+// imagePolicy returns the image policy of srcCont on the named Docker host:
+// its own, or the default.
+func (s *Server) imagePolicy(host string, srcCont types.ContainerJSON) (string, error) {
+	overrides, err := s.store.ResolveImagePolicies(selectionHost(host), map[string]string{srcCont.ID: containerName(srcCont)})
+	if err != nil {
+		return "", err
+	}
+	if policy, ok := overrides[srcCont.ID]; ok {
+		return policy, nil
+	}
+	policies, err := s.store.GetImagePolicies()
+	if err != nil {
+		return "", err
+	}
+	return policies.Default, nil
+}
+
+func (s *Server) handleImagePolicies(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		policies, err := s.store.GetImagePolicies()
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Unable to get image policies", "err", err)
+			writeError(w, r, "Unable to get image policies", err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(policies)
+
+	case http.MethodPost:
+		var payload struct {
+			ContainerID string `json:"containerId"` // empty sets the default
+			Host        string `json:"host"`        // Docker host the container is on; local by default
+			Policy      string `json:"policy"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		var name string
+		if payload.ContainerID != "" {
+			// Policies are kept by name, so they survive the container being recreated
+			cli, err := s.dockerClientFor(r.Context(), payload.Host)
+			if errors.Is(err, store.ErrHostNotFound) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err != nil {
+				slog.ErrorContext(r.Context(), "Unable to create docker client", "err", err)
+				writeError(w, r, "Unable to create docker client", err)
+				return
+			}
+			defer cli.Close()
+			inspect, err := cli.ContainerInspect(r.Context(), payload.ContainerID)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "Unable to inspect container", "id", payload.ContainerID, "err", err)
+				writeError(w, r, "Unable to inspect container", err)
+				return
+			}
+			name = containerName(inspect)
+			// Move a policy still kept under the ID first, so removing the
+			// override doesn't leave it behind
+			if _, err := s.store.ResolveImagePolicies(selectionHost(payload.Host), map[string]string{inspect.ID: name}); err != nil {
+				writeError(w, r, "Unable to get image policies", err)
+				return
+			}
+		}
+		if err := s.store.SetImagePolicy(selectionHost(payload.Host), name, payload.Policy); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+
+	default:
+		http.Error(w, "Only GET and POST methods are allowed", http.StatusMethodNotAllowed)
+	}
+}
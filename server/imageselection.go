@@ -0,0 +1,88 @@
+package server
+
+import (
+	"context"
+	"dockerap/apiclient"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/distribution/reference"
+	"github.com/docker/docker/client"
+)
+
+// planImage is an image a run copies to destinations on its own, without a
+// container: a selected one or, when only images are replicated, one a
+// selected container runs.
+type planImage struct {
+	Ref         string // such as nginx:1.25, and its name on the destination
+	ID          string // on the source
+	Digest      string // pinned digest, or "" to follow the tag
+	RelayRef    string // image reference in the relay registry, when relaying
+	RelayDigest string
+}
+
+// normalizeImageRef checks an image reference and returns it as the image
+// list shows it, with :latest added when it names neither tag nor digest.
+func normalizeImageRef(ref string) (string, error) {
+	named, err := reference.ParseNormalizedNamed(strings.TrimSpace(ref))
+	if err != nil {
+		return "", err
+	}
+	return reference.FamiliarString(reference.TagNameOnly(named)), nil
+}
+
+// planSelectedImages inspects the selected images on the source and adds
+// them to plan, pinned to the digest they have there. An image the source
+// does not have is skipped, like a missing volume.
+func planSelectedImages(ctx context.Context, srcCli *client.Client, plan *replicationPlan, refs map[string]bool) {
+	for _, ref := range sortedKeys(refs) {
+		img, _, err := srcCli.ImageInspectWithRaw(ctx, ref)
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to inspect source image", "image", ref, "err", err)
+			plan.Skipped = append(plan.Skipped, ItemResult{Type: "image", Name: ref, Status: ItemFailed, Error: err.Error()})
+			continue
+		}
+		plan.Images = append(plan.Images, planImage{Ref: ref, ID: img.ID, Digest: repoDigest(img.RepoDigests, ref)})
+	}
+}
+
+// keepImagesOnly reduces plan to images, for pre-seeding a standby: the
+// selected ones and those its containers run, each once. No network, volume
+// or container is created.
+func (plan *replicationPlan) keepImagesOnly() {
+	seen := make(map[string]bool)
+	for _, pi := range plan.Images {
+		seen[pi.Ref] = true
+	}
+	for _, pc := range plan.Containers {
+		ref := pc.Inspect.Config.Image
+		if seen[ref] {
+			continue
+		}
+		seen[ref] = true
+		plan.Images = append(plan.Images, planImage{Ref: ref, ID: pc.Inspect.Image, Digest: pc.ImageDigest})
+	}
+	sort.Slice(plan.Images, func(i, j int) bool { return plan.Images[i].Ref < plan.Images[j].Ref })
+
+	skipped := plan.Skipped[:0]
+	for _, item := range plan.Skipped {
+		// A container that could not be planned leaves its image behind too
+		if item.Type == "container" || item.Type == "image" {
+			skipped = append(skipped, item)
+		}
+	}
+	plan.Skipped = skipped
+	plan.Networks, plan.Volumes, plan.Containers, plan.VolumeData = nil, nil, nil, nil
+}
+
+// replicateImage has the destination pull a planned image, or streams it
+// there when it cannot.
+func (s *Server) replicateImage(ctx context.Context, srcCli *client.Client, httpClient *http.Client, dest string, pi planImage) error {
+	pull := apiclient.PullImageRequest{ImageName: pi.Ref, Digest: pi.Digest}
+	if pi.RelayRef != "" {
+		pull = apiclient.PullImageRequest{ImageName: pi.RelayRef, Digest: pi.RelayDigest, TagAs: pi.Ref}
+	}
+	return s.copyImage(ctx, srcCli, httpClient, dest, pull, pi.ID, pi.Ref)
+}
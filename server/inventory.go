@@ -0,0 +1,294 @@
+package server
+
+import (
+	"context"
+	"dockerap/store"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/client"
+)
+
+// Inventory is what the host is running at one point in time. Each entry maps
+// a stable key (container name, image ID, volume name) to the fields compared
+// when diffing snapshots.
+type Inventory struct {
+	Containers map[string]map[string]string `json:"containers"`
+	Images     map[string]map[string]string `json:"images"`
+	Volumes    map[string]map[string]string `json:"volumes"`
+}
+
+// Change is a single field that differs between two snapshots.
+type Change struct {
+	Name  string `json:"name"`
+	Field string `json:"field"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
+
+// KindDiff lists what was added, removed, or changed for one kind of object.
+type KindDiff struct {
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+	Changed []Change `json:"changed"`
+}
+
+// InventoryDiff compares two snapshots.
+type InventoryDiff struct {
+	From       store.Snapshot `json:"from"`
+	To         store.Snapshot `json:"to"`
+	Containers KindDiff       `json:"containers"`
+	Images     KindDiff       `json:"images"`
+	Volumes    KindDiff       `json:"volumes"`
+}
+
+// collectInventory reads the containers, images, and volumes on the local host.
+func collectInventory(ctx context.Context, cli *client.Client) (*Inventory, error) {
+	inv := &Inventory{
+		Containers: make(map[string]map[string]string),
+		Images:     make(map[string]map[string]string),
+		Volumes:    make(map[string]map[string]string),
+	}
+
+	containers, err := cli.ContainerList(ctx, container.ListOptions{All: true})
+	if err != nil {
+		return nil, fmt.Errorf("list containers: %w", err)
+	}
+	for _, c := range containers {
+		name := c.ID
+		if len(c.Names) > 0 {
+			name = strings.TrimPrefix(c.Names[0], "/")
+		}
+		var mounts []string
+		for _, m := range c.Mounts {
+			source := m.Name
+			if source == "" {
+				source = m.Source
+			}
+			mounts = append(mounts, source+":"+m.Destination)
+		}
+		sort.Strings(mounts)
+		// Containers are keyed by name so a recreated container shows up as changed
+		inv.Containers[name] = map[string]string{
+			"id":      c.ID,
+			"image":   c.Image,
+			"imageId": c.ImageID,
+			"state":   c.State,
+			"mounts":  strings.Join(mounts, ", "),
+		}
+	}
+
+	images, err := cli.ImageList(ctx, image.ListOptions{All: false})
+	if err != nil {
+		return nil, fmt.Errorf("list images: %w", err)
+	}
+	for _, img := range images {
+		tags := append([]string(nil), img.RepoTags...)
+		sort.Strings(tags)
+		inv.Images[img.ID] = map[string]string{
+			"tags": strings.Join(tags, ", "),
+			"size": strconv.FormatInt(img.Size, 10),
+		}
+	}
+
+	volumes, err := cli.VolumeList(ctx, volume.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("list volumes: %w", err)
+	}
+	for _, v := range volumes.Volumes {
+		inv.Volumes[v.Name] = map[string]string{
+			"driver":     v.Driver,
+			"mountpoint": v.Mountpoint,
+		}
+	}
+	return inv, nil
+}
+
+// takeSnapshot records the current inventory and returns the snapshot ID.
+func (s *Server) takeSnapshot(ctx context.Context) (int64, error) {
+	cli, err := newDockerClient(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("unable to create docker client: %w", err)
+	}
+	defer cli.Close()
+
+	inv, err := collectInventory(ctx, cli)
+	if err != nil {
+		return 0, err
+	}
+	data, err := json.Marshal(inv)
+	if err != nil {
+		return 0, err
+	}
+	return s.store.SaveSnapshot(string(data))
+}
+
+// runSnapshots takes an inventory snapshot at startup and then on every
+// snapshot interval, dropping snapshots older than the retention period.
+func (s *Server) runSnapshots(ctx context.Context) {
+	for {
+		start := time.Now()
+		if id, err := s.takeSnapshot(ctx); err != nil {
+			slog.ErrorContext(ctx, "Unable to take inventory snapshot", "err", err)
+		} else {
+			slog.InfoContext(ctx, "Took inventory snapshot", "id", id)
+		}
+		if err := s.store.PruneSnapshots(time.Now().Add(-s.cfg.SnapshotRetention)); err != nil {
+			slog.ErrorContext(ctx, "Unable to prune inventory snapshots", "err", err)
+		}
+		if !s.waitInterval(ctx, settingSnapshotInterval, start) {
+			return
+		}
+	}
+}
+
+// diffKind compares one kind of object between two inventories.
+func diffKind(from, to map[string]map[string]string) KindDiff {
+	d := KindDiff{Added: []string{}, Removed: []string{}, Changed: []Change{}}
+	for name, fields := range to {
+		old, ok := from[name]
+		if !ok {
+			d.Added = append(d.Added, name)
+			continue
+		}
+		for field, value := range fields {
+			if old[field] != value {
+				d.Changed = append(d.Changed, Change{Name: name, Field: field, From: old[field], To: value})
+			}
+		}
+	}
+	for name := range from {
+		if _, ok := to[name]; !ok {
+			d.Removed = append(d.Removed, name)
+		}
+	}
+	sort.Strings(d.Added)
+	sort.Strings(d.Removed)
+	sort.Slice(d.Changed, func(i, j int) bool {
+		if d.Changed[i].Name != d.Changed[j].Name {
+			return d.Changed[i].Name < d.Changed[j].Name
+		}
+		return d.Changed[i].Field < d.Changed[j].Field
+	})
+	return d
+}
+
+// loadInventory returns a stored snapshot and its decoded inventory.
+func (s *Server) loadInventory(id int64) (*store.Snapshot, *Inventory, error) {
+	snap, err := s.store.GetSnapshot(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	var inv Inventory
+	if err := json.Unmarshal([]byte(snap.Data), &inv); err != nil {
+		return nil, nil, fmt.Errorf("snapshot %d is corrupt: %w", id, err)
+	}
+	return snap, &inv, nil
+}
+
+func (s *Server) handleSnapshots(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		snapshots, err := s.store.GetSnapshots()
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Unable to get inventory snapshots", "err", err)
+			writeError(w, r, "Unable to get inventory snapshots", err)
+			return
+		}
+		if snapshots == nil {
+			snapshots = []store.Snapshot{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(snapshots)
+
+	case http.MethodPost:
+		id, err := s.takeSnapshot(r.Context())
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Unable to take inventory snapshot", "err", err)
+			writeError(w, r, "Unable to take inventory snapshot", err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": "success", "id": id})
+
+	default:
+		http.Error(w, "Only GET and POST methods are allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleSnapshotDiff compares two snapshots: GET /api/snapshots/diff?from=1&to=2.
+// If to is omitted the current inventory is compared instead.
+func (s *Server) handleSnapshotDiff(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	fromID, err := strconv.ParseInt(r.URL.Query().Get("from"), 10, 64)
+	if err != nil {
+		http.Error(w, "from must be a snapshot ID", http.StatusBadRequest)
+		return
+	}
+	fromSnap, fromInv, err := s.loadInventory(fromID)
+	if err != nil {
+		writeSnapshotError(w, r, err)
+		return
+	}
+
+	var toSnap *store.Snapshot
+	var toInv *Inventory
+	if v := r.URL.Query().Get("to"); v != "" {
+		toID, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			http.Error(w, "to must be a snapshot ID", http.StatusBadRequest)
+			return
+		}
+		if toSnap, toInv, err = s.loadInventory(toID); err != nil {
+			writeSnapshotError(w, r, err)
+			return
+		}
+	} else {
+		cli, err := newDockerClient(r.Context())
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Unable to create docker client", "err", err)
+			writeError(w, r, "Unable to create docker client", err)
+			return
+		}
+		defer cli.Close()
+		if toInv, err = collectInventory(r.Context(), cli); err != nil {
+			slog.ErrorContext(r.Context(), "Unable to collect inventory", "err", err)
+			writeError(w, r, "Unable to collect inventory", err)
+			return
+		}
+		toSnap = &store.Snapshot{CreatedAt: time.Now().UTC()}
+	}
+
+	diff := InventoryDiff{
+		From:       *fromSnap,
+		To:         *toSnap,
+		Containers: diffKind(fromInv.Containers, toInv.Containers),
+		Images:     diffKind(fromInv.Images, toInv.Images),
+		Volumes:    diffKind(fromInv.Volumes, toInv.Volumes),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(diff)
+}
+
+func writeSnapshotError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, store.ErrSnapshotNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	slog.Error("Unable to load inventory snapshot", "err", err)
+	writeError(w, r, "Unable to load inventory snapshot", err)
+}
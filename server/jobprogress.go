@@ -0,0 +1,159 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// finishedJobTTL is how long a finished job's progress card stays up.
+const finishedJobTTL = 10 * time.Minute
+
+// jobState is a replication job's progress as its card shows it.
+type jobState struct {
+	JobID        string
+	Profile      string
+	Destinations []string
+	StartedAt    time.Time
+	FinishedAt   time.Time // zero while running
+	Status       string    // running, or the report's status once finished
+	Total        int       // items across every destination
+	Done         int       // items replicated, failed or skipped
+	Failed       int
+	Bytes        int64
+	Current      []string // "destination: type name" being replicated now
+}
+
+// Percent is how far through its items the job is.
+func (st jobState) Percent() int {
+	if st.Total == 0 || st.Done >= st.Total {
+		return 100
+	}
+	return st.Done * 100 / st.Total
+}
+
+// Running reports whether the job has not finished yet.
+func (st jobState) Running() bool {
+	return st.FinishedAt.IsZero()
+}
+
+// jobProgress tracks one running job. Destinations replicate concurrently,
+// so every update takes the lock. A nil jobProgress ignores updates, for
+// runs such as failback that have no card.
+type jobProgress struct {
+	mu      sync.Mutex
+	state   jobState
+	current map[string]string // destination -> item being replicated
+}
+
+// begin records that dest has started on item.
+func (p *jobProgress) begin(dest string, item ItemResult) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.current[dest] = item.Type + " " + item.Name
+}
+
+// done records item's outcome on dest.
+func (p *jobProgress) done(dest string, item ItemResult) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.current, dest)
+	p.state.Done++
+	if item.Status == ItemFailed {
+		p.state.Failed++
+	}
+	p.state.Bytes += item.Bytes
+}
+
+// finish marks the job done with the report's totals.
+func (p *jobProgress) finish(report *ReplicationReport) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	clear(p.current)
+	p.state.Status = report.Status
+	p.state.FinishedAt = report.FinishedAt
+	p.state.Bytes = report.Bytes
+}
+
+func (p *jobProgress) snapshot() jobState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	st := p.state
+	st.Current = nil
+	for _, dest := range sortedKeys(p.current) {
+		st.Current = append(st.Current, fmt.Sprintf("%s: %s", dest, p.current[dest]))
+	}
+	return st
+}
+
+// jobTracker holds the progress of running jobs and of those finished within
+// finishedJobTTL. It lives in memory only; finished jobs keep their reports.
+type jobTracker struct {
+	mu   sync.Mutex
+	jobs map[string]*jobProgress
+}
+
+func newJobTracker() *jobTracker {
+	return &jobTracker{jobs: make(map[string]*jobProgress)}
+}
+
+// start begins tracking the job replicating plan to destinations.
+func (t *jobTracker) start(plan *replicationPlan, destinations []string) *jobProgress {
+	perDest := len(plan.Skipped) + len(plan.Images) + len(plan.Networks) + len(plan.Volumes) + len(plan.Containers)
+	p := &jobProgress{
+		state: jobState{
+			JobID:        plan.JobID,
+			Profile:      plan.Profile,
+			Destinations: destinations,
+			StartedAt:    time.Now().UTC(),
+			Status:       "running",
+			Total:        perDest * len(destinations),
+		},
+		current: make(map[string]string),
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for id, job := range t.jobs {
+		if st := job.snapshot(); !st.Running() && time.Since(st.FinishedAt) > finishedJobTTL {
+			delete(t.jobs, id)
+		}
+	}
+	t.jobs[plan.JobID] = p
+	return p
+}
+
+// get returns the state of the job id, if it is tracked.
+func (t *jobTracker) get(id string) (jobState, bool) {
+	t.mu.Lock()
+	p, ok := t.jobs[id]
+	t.mu.Unlock()
+	if !ok {
+		return jobState{}, false
+	}
+	return p.snapshot(), true
+}
+
+// list returns every tracked job, newest first.
+func (t *jobTracker) list() []jobState {
+	t.mu.Lock()
+	jobs := make([]*jobProgress, 0, len(t.jobs))
+	for _, p := range t.jobs {
+		jobs = append(jobs, p)
+	}
+	t.mu.Unlock()
+	states := make([]jobState, 0, len(jobs))
+	for _, p := range jobs {
+		if st := p.snapshot(); st.Running() || time.Since(st.FinishedAt) <= finishedJobTTL {
+			states = append(states, st)
+		}
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].StartedAt.After(states[j].StartedAt) })
+	return states
+}
@@ -0,0 +1,385 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/go-connections/nat"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultPVCSize is the storage a PersistentVolumeClaim requests when the
+// export does not give ?storage=. Docker volumes have no size to copy.
+const defaultPVCSize = "1Gi"
+
+// k8sQuantityPattern matches the storage sizes ?storage= accepts.
+var k8sQuantityPattern = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?(Ki|Mi|Gi|Ti|Pi|Ei|k|M|G|T|P|E)?$`)
+
+// k8sManagedBy marks what the export generates.
+const k8sManagedBy = "dockerapp"
+
+// The parts of the Kubernetes API the export writes, in the field order
+// kubectl shows them.
+type k8sMeta struct {
+	Name      string            `yaml:"name,omitempty"`
+	Namespace string            `yaml:"namespace,omitempty"`
+	Labels    map[string]string `yaml:"labels,omitempty"`
+}
+
+type k8sObject struct {
+	APIVersion string      `yaml:"apiVersion"`
+	Kind       string      `yaml:"kind"`
+	Metadata   k8sMeta     `yaml:"metadata"`
+	Spec       interface{} `yaml:"spec"`
+}
+
+type k8sDeploymentSpec struct {
+	Replicas int `yaml:"replicas"`
+	Strategy struct {
+		Type string `yaml:"type"`
+	} `yaml:"strategy"`
+	Selector struct {
+		MatchLabels map[string]string `yaml:"matchLabels"`
+	} `yaml:"selector"`
+	Template struct {
+		Metadata k8sMeta    `yaml:"metadata"`
+		Spec     k8sPodSpec `yaml:"spec"`
+	} `yaml:"template"`
+}
+
+type k8sPodSpec struct {
+	Hostname    string         `yaml:"hostname,omitempty"`
+	HostNetwork bool           `yaml:"hostNetwork,omitempty"`
+	Containers  []k8sContainer `yaml:"containers"`
+	Volumes     []k8sVolume    `yaml:"volumes,omitempty"`
+}
+
+type k8sContainer struct {
+	Name            string              `yaml:"name"`
+	Image           string              `yaml:"image"`
+	Command         []string            `yaml:"command,omitempty"`
+	Args            []string            `yaml:"args,omitempty"`
+	WorkingDir      string              `yaml:"workingDir,omitempty"`
+	Env             []k8sEnvVar         `yaml:"env,omitempty"`
+	Ports           []k8sContainerPort  `yaml:"ports,omitempty"`
+	VolumeMounts    []k8sVolumeMount    `yaml:"volumeMounts,omitempty"`
+	SecurityContext *k8sSecurityContext `yaml:"securityContext,omitempty"`
+	TTY             bool                `yaml:"tty,omitempty"`
+	Stdin           bool                `yaml:"stdin,omitempty"`
+}
+
+type k8sEnvVar struct {
+	Name  string `yaml:"name"`
+	Value string `yaml:"value"`
+}
+
+type k8sContainerPort struct {
+	ContainerPort int    `yaml:"containerPort"`
+	Protocol      string `yaml:"protocol"`
+}
+
+type k8sVolumeMount struct {
+	Name      string `yaml:"name"`
+	MountPath string `yaml:"mountPath"`
+	ReadOnly  bool   `yaml:"readOnly,omitempty"`
+}
+
+type k8sSecurityContext struct {
+	Privileged             bool             `yaml:"privileged,omitempty"`
+	ReadOnlyRootFilesystem bool             `yaml:"readOnlyRootFilesystem,omitempty"`
+	RunAsUser              *int64           `yaml:"runAsUser,omitempty"`
+	RunAsGroup             *int64           `yaml:"runAsGroup,omitempty"`
+	Capabilities           *k8sCapabilities `yaml:"capabilities,omitempty"`
+}
+
+type k8sCapabilities struct {
+	Add  []string `yaml:"add,omitempty"`
+	Drop []string `yaml:"drop,omitempty"`
+}
+
+type k8sVolume struct {
+	Name                  string             `yaml:"name"`
+	PersistentVolumeClaim *k8sClaimSource    `yaml:"persistentVolumeClaim,omitempty"`
+	HostPath              *k8sHostPathSource `yaml:"hostPath,omitempty"`
+	EmptyDir              *struct{}          `yaml:"emptyDir,omitempty"`
+}
+
+type k8sClaimSource struct {
+	ClaimName string `yaml:"claimName"`
+}
+
+type k8sHostPathSource struct {
+	Path string `yaml:"path"`
+}
+
+type k8sServiceSpec struct {
+	Selector map[string]string `yaml:"selector"`
+	Ports    []k8sServicePort  `yaml:"ports"`
+}
+
+type k8sServicePort struct {
+	Name       string `yaml:"name"`
+	Port       int    `yaml:"port"`
+	TargetPort int    `yaml:"targetPort"`
+	Protocol   string `yaml:"protocol"`
+}
+
+type k8sPVCSpec struct {
+	AccessModes []string `yaml:"accessModes"`
+	Resources   struct {
+		Requests map[string]string `yaml:"requests"`
+	} `yaml:"resources"`
+}
+
+// k8sNameInvalid matches what a DNS-1123 label may not contain.
+var k8sNameInvalid = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// k8sName turns a Docker name into a valid Kubernetes object name.
+func k8sName(name string) string {
+	n := k8sNameInvalid.ReplaceAllString(strings.ToLower(name), "-")
+	if len(n) > 63 {
+		n = n[:63]
+	}
+	n = strings.Trim(n, "-")
+	if n == "" {
+		n = "unnamed"
+	}
+	return n
+}
+
+// handleExportKubernetes writes the selected containers, or a profile's, as
+// Kubernetes manifests: a Deployment per container, a Service for the ports
+// it exposes and a PersistentVolumeClaim per named volume. They are a
+// starting point for moving a host into a cluster, to be reviewed before
+// they are applied.
+func (s *Server) handleExportKubernetes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	namespace := r.URL.Query().Get("namespace")
+	if namespace != "" && k8sName(namespace) != namespace {
+		http.Error(w, fmt.Sprintf("Invalid namespace %q", namespace), http.StatusBadRequest)
+		return
+	}
+	storage := r.URL.Query().Get("storage")
+	if storage == "" {
+		storage = defaultPVCSize
+	}
+	if !k8sQuantityPattern.MatchString(storage) {
+		http.Error(w, fmt.Sprintf("Invalid storage size %q", storage), http.StatusBadRequest)
+		return
+	}
+
+	cli, err := newDockerClient(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to create docker client", "err", err)
+		writeError(w, r, "Unable to create docker client", err)
+		return
+	}
+	defer cli.Close()
+
+	profile := r.URL.Query().Get("profile")
+	containers, volumes, notes, err := s.exportSelection(r.Context(), cli, profile)
+	if err != nil {
+		writeSelectionError(w, r, err)
+		return
+	}
+
+	meta := func(name string) k8sMeta {
+		return k8sMeta{Name: name, Namespace: namespace, Labels: map[string]string{
+			"app.kubernetes.io/name":       name,
+			"app.kubernetes.io/managed-by": k8sManagedBy,
+		}}
+	}
+	var objects []k8sObject
+	claims := make(map[string]bool)
+	for name := range volumes {
+		claims[name] = true
+	}
+	for _, pc := range containers {
+		svc, err := exportComposeService(r.Context(), cli, pc)
+		if err != nil {
+			notes = append(notes, fmt.Sprintf("container %s: %s", pc.Name, err))
+			continue
+		}
+		name := k8sName(pc.Name)
+		dep, ports, depNotes := k8sDeployment(pc.Inspect, svc, meta(name), claims)
+		for _, n := range depNotes {
+			notes = append(notes, fmt.Sprintf("container %s: %s", pc.Name, n))
+		}
+		objects = append(objects, dep)
+		if len(ports) > 0 {
+			objects = append(objects, k8sObject{APIVersion: "v1", Kind: "Service", Metadata: meta(name), Spec: k8sServiceSpec{
+				Selector: map[string]string{"app.kubernetes.io/name": name},
+				Ports:    ports,
+			}})
+		}
+	}
+	for _, volName := range sortedKeys(claims) {
+		spec := k8sPVCSpec{AccessModes: []string{"ReadWriteOnce"}}
+		spec.Resources.Requests = map[string]string{"storage": storage}
+		objects = append(objects, k8sObject{APIVersion: "v1", Kind: "PersistentVolumeClaim", Metadata: meta(k8sName(volName)), Spec: spec})
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	for _, o := range objects {
+		err = enc.Encode(o)
+		if err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = enc.Close()
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to encode manifests", "err", err)
+		writeError(w, r, "Unable to encode manifests", err)
+		return
+	}
+
+	source := "the current selection"
+	if profile != "" {
+		source = "profile " + profile
+	}
+	host, _ := os.Hostname()
+	w.Header().Set("Content-Type", "application/yaml")
+	fmt.Fprintf(w, "# Exported by DockerApp from %s on %s at %s\n", source, host, time.Now().UTC().Format(time.RFC3339))
+	fmt.Fprintf(w, "# Review before applying: each volume claim requests %s and volume contents are not copied.\n", storage)
+	for _, line := range notes {
+		fmt.Fprintf(w, "# Note: %s\n", line)
+	}
+	w.Write(buf.Bytes())
+}
+
+// k8sDeployment converts one container. Named volumes become claims, which
+// are added to claims; bind mounts become hostPath volumes. It returns the
+// Service ports for what the container exposes, and notes on what did not
+// carry over.
+func k8sDeployment(c types.ContainerJSON, svc composeService, meta k8sMeta, claims map[string]bool) (k8sObject, []k8sServicePort, []string) {
+	var notes []string
+	kc := k8sContainer{
+		Name:       meta.Name,
+		Image:      svc.Image,
+		Command:    svc.Entrypoint,
+		Args:       svc.Command,
+		WorkingDir: svc.WorkingDir,
+		TTY:        svc.TTY,
+		Stdin:      svc.StdinOpen,
+	}
+	for _, k := range sortedKeys(svc.Environment) {
+		if v := svc.Environment[k]; v != nil {
+			kc.Env = append(kc.Env, k8sEnvVar{Name: k, Value: *v})
+		}
+	}
+
+	sc := &k8sSecurityContext{Privileged: svc.Privileged, ReadOnlyRootFilesystem: svc.ReadOnly}
+	if svc.User != "" {
+		uid, gid, hasGroup := strings.Cut(svc.User, ":")
+		if u, err := strconv.ParseInt(uid, 10, 64); err == nil {
+			sc.RunAsUser = &u
+			if g, err := strconv.ParseInt(gid, 10, 64); hasGroup && err == nil {
+				sc.RunAsGroup = &g
+			}
+		} else {
+			notes = append(notes, fmt.Sprintf("user %q is not numeric; set runAsUser by hand", svc.User))
+		}
+	}
+	if len(svc.CapAdd) > 0 || len(svc.CapDrop) > 0 {
+		sc.Capabilities = &k8sCapabilities{Add: svc.CapAdd, Drop: svc.CapDrop}
+	}
+	if *sc != (k8sSecurityContext{}) {
+		kc.SecurityContext = sc
+	}
+
+	// A Service exposes what the image or container exposes, so other
+	// workloads reach it by name as they did over a Docker network
+	var ports []k8sServicePort
+	published := make(map[string]int)
+	for port, bindings := range c.HostConfig.PortBindings {
+		for _, b := range bindings {
+			if hp, err := strconv.Atoi(b.HostPort); err == nil {
+				published[string(port)] = hp
+			}
+		}
+	}
+	exposed := make([]nat.Port, 0, len(c.Config.ExposedPorts))
+	for port := range c.Config.ExposedPorts {
+		exposed = append(exposed, port)
+	}
+	slices.Sort(exposed)
+	for _, port := range exposed {
+		n := port.Int()
+		proto := strings.ToUpper(port.Proto())
+		kc.Ports = append(kc.Ports, k8sContainerPort{ContainerPort: n, Protocol: proto})
+		servicePort := n
+		if hp, ok := published[string(port)]; ok {
+			servicePort = hp
+		}
+		ports = append(ports, k8sServicePort{Name: fmt.Sprintf("%s-%d", strings.ToLower(proto), n), Port: servicePort, TargetPort: n, Protocol: proto})
+	}
+
+	var pod k8sPodSpec
+	pod.Hostname = svc.Hostname
+	for i, m := range svc.Volumes {
+		vm := k8sVolumeMount{MountPath: m.Target, ReadOnly: m.ReadOnly}
+		v := k8sVolume{}
+		switch {
+		case m.Type == "bind":
+			vm.Name = fmt.Sprintf("host-%d", i)
+			v.HostPath = &k8sHostPathSource{Path: m.Source}
+			notes = append(notes, fmt.Sprintf("bind mount %s is a hostPath volume, tied to one node", m.Source))
+		case m.Source == "":
+			vm.Name = fmt.Sprintf("scratch-%d", i)
+			v.EmptyDir = &struct{}{}
+		default:
+			vm.Name = k8sName(m.Source)
+			v.PersistentVolumeClaim = &k8sClaimSource{ClaimName: vm.Name}
+			claims[m.Source] = true
+		}
+		v.Name = vm.Name
+		kc.VolumeMounts = append(kc.VolumeMounts, vm)
+		pod.Volumes = append(pod.Volumes, v)
+	}
+
+	switch svc.NetworkMode {
+	case "host":
+		pod.HostNetwork = true
+	case "none":
+		notes = append(notes, "network_mode none has no equivalent; the pod is networked")
+	}
+	if len(svc.DependsOn) > 0 {
+		notes = append(notes, fmt.Sprintf("depends on %s; Kubernetes starts pods in any order", strings.Join(svc.DependsOn, ", ")))
+	}
+	for network, aliases := range svc.Networks {
+		if len(aliases) > 0 {
+			notes = append(notes, fmt.Sprintf("aliases %s on network %s are not carried over; use the Service name", strings.Join(aliases, ", "), network))
+		}
+	}
+	pod.Containers = []k8sContainer{kc}
+
+	var spec k8sDeploymentSpec
+	spec.Replicas = 1
+	// A ReadWriteOnce claim cannot be mounted by the old and new pod at once
+	spec.Strategy.Type = "RollingUpdate"
+	for _, v := range pod.Volumes {
+		if v.PersistentVolumeClaim != nil {
+			spec.Strategy.Type = "Recreate"
+		}
+	}
+	spec.Selector.MatchLabels = map[string]string{"app.kubernetes.io/name": meta.Name}
+	spec.Template.Metadata = k8sMeta{Labels: meta.Labels}
+	spec.Template.Spec = pod
+	return k8sObject{APIVersion: "apps/v1", Kind: "Deployment", Metadata: meta, Spec: spec}, ports, notes
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"context"
+	"dockerap/store"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+)
+
+// containerActions are the lifecycle actions /api/containers/{id}/{action}
+// runs against the local daemon.
+var containerActions = map[string]func(ctx context.Context, cli *client.Client, id string, r *http.Request) error{
+	"start": func(ctx context.Context, cli *client.Client, id string, r *http.Request) error {
+		return cli.ContainerStart(ctx, id, container.StartOptions{})
+	},
+	"stop": func(ctx context.Context, cli *client.Client, id string, r *http.Request) error {
+		return cli.ContainerStop(ctx, id, container.StopOptions{Timeout: stopTimeout(r)})
+	},
+	"restart": func(ctx context.Context, cli *client.Client, id string, r *http.Request) error {
+		return cli.ContainerRestart(ctx, id, container.StopOptions{Timeout: stopTimeout(r)})
+	},
+	"remove": func(ctx context.Context, cli *client.Client, id string, r *http.Request) error {
+		q := r.URL.Query()
+		return cli.ContainerRemove(ctx, id, container.RemoveOptions{
+			Force:         q.Get("force") == "true",
+			RemoveVolumes: q.Get("volumes") == "true",
+		})
+	},
+}
+
+// stopTimeout reads ?timeout=<seconds>, leaving the container's own stop
+// timeout in place when it is missing or not a number.
+func stopTimeout(r *http.Request) *int {
+	t, err := strconv.Atoi(r.URL.Query().Get("timeout"))
+	if err != nil || t < 0 {
+		return nil
+	}
+	return &t
+}
+
+// handleContainerAction starts, stops, restarts or removes a container on this
+// host, so replicas on the standby can be managed from the UI. Remove takes
+// ?force=true to remove a running container and ?volumes=true to remove its
+// anonymous volumes too. Every attempt is recorded in the audit log.
+func (s *Server) handleContainerAction(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, action := r.PathValue("id"), r.PathValue("action")
+	run, ok := containerActions[action]
+	if !ok {
+		http.Error(w, fmt.Sprintf("Unknown action %q; use start, stop, restart or remove", action), http.StatusNotFound)
+		return
+	}
+
+	cli, err := newDockerClient(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to create docker client", "err", err)
+		writeError(w, r, "Unable to create docker client", err)
+		return
+	}
+	defer cli.Close()
+
+	err = run(r.Context(), cli, id, r)
+
+	p, _ := principalFrom(r.Context())
+	entry := store.AuditEntry{
+		Actor:      p.User,
+		RemoteAddr: r.RemoteAddr,
+		Action:     "container:" + action,
+		Target:     id,
+		Outcome:    "succeeded",
+	}
+	if err != nil {
+		entry.Outcome = "failed"
+		entry.Detail = err.Error()
+	}
+	if auditErr := s.store.RecordAudit(entry); auditErr != nil {
+		slog.ErrorContext(r.Context(), "Unable to record audit entry", "action", entry.Action, "err", auditErr)
+	}
+
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to "+action+" container", "container", id, "err", err)
+		status := http.StatusInternalServerError
+		switch {
+		case client.IsErrNotFound(err):
+			status = http.StatusNotFound
+		case errdefs.IsConflict(err):
+			status = http.StatusConflict
+		}
+		http.Error(w, fmt.Sprintf("Unable to %s container: %s", action, err), status)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Container "+action+" requested", "container", id, "user", p.User)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"id": id, "action": action, "status": "ok"})
+}
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// listenPort returns the port part of the listen address.
+func (s *Server) listenPort() string {
+	_, port, err := net.SplitHostPort(s.cfg.ListenAddr)
+	if err != nil {
+		return "8080"
+	}
+	return port
+}
+
+// sourceHostAddress returns the address a standby's monitor should
+// health-check for this host, and the address replicas are labelled with.
+// An empty address is derived from the host name the request arrived on and
+// the port this server listens on; an address without a port gets the
+// listen port.
+func (s *Server) sourceHostAddress(r *http.Request, given string) string {
+	port := s.listenPort()
+	given = strings.TrimRight(strings.TrimSpace(given), "/")
+	if given == "" {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(r.Host); err == nil {
+			host = h
+		}
+		if host == "" {
+			return ""
+		}
+		scheme := "http"
+		if s.cfg.TLSEnabled() {
+			scheme = "https"
+		}
+		return scheme + "://" + net.JoinHostPort(host, port)
+	}
+
+	u, err := url.Parse(given)
+	if err != nil || u.Host == "" || u.Port() != "" {
+		return given
+	}
+	if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		return given
+	}
+	u.Host = net.JoinHostPort(u.Hostname(), port)
+	return u.String()
+}
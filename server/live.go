@@ -0,0 +1,195 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"golang.org/x/net/websocket"
+)
+
+// liveEventsRetry is how long the watcher waits before reconnecting to a
+// daemon whose event stream broke.
+const liveEventsRetry = 5 * time.Second
+
+// liveEvent is one update pushed to the browsers on /ws.
+type liveEvent struct {
+	Type     string `json:"type"`             // "container" or "selection"
+	Action   string `json:"action,omitempty"` // Docker event action, e.g. start or destroy
+	Kind     string `json:"kind,omitempty"`   // what a selection change is for: container or volume
+	ID       string `json:"id,omitempty"`     // full container ID
+	Name     string `json:"name,omitempty"`   // volume name for volume selections
+	Selected bool   `json:"selected"`
+	State    string `json:"state,omitempty"`  // container state after the event
+	Status   string `json:"status,omitempty"` // e.g. "Up 3 seconds"
+	User     string `json:"user,omitempty"`   // who changed the selection
+}
+
+// liveActions are the container event actions that change what the list shows.
+var liveActions = map[events.Action]bool{
+	events.ActionCreate:  true,
+	events.ActionStart:   true,
+	events.ActionRestart: true,
+	events.ActionStop:    true,
+	events.ActionKill:    true,
+	events.ActionDie:     true,
+	events.ActionOOM:     true,
+	events.ActionPause:   true,
+	events.ActionUnPause: true,
+	events.ActionRename:  true,
+	events.ActionDestroy: true,
+}
+
+// liveHub fans out updates to every connected browser. A browser that falls
+// behind misses updates rather than holding up the others.
+type liveHub struct {
+	mu   sync.Mutex
+	subs map[chan liveEvent]struct{}
+}
+
+func newLiveHub() *liveHub {
+	return &liveHub{subs: make(map[chan liveEvent]struct{})}
+}
+
+// subscribe returns a channel of updates and a function that stops them.
+func (h *liveHub) subscribe() (<-chan liveEvent, func()) {
+	ch := make(chan liveEvent, 32)
+	h.mu.Lock()
+	h.subs[ch] = struct{}{}
+	h.mu.Unlock()
+	return ch, func() {
+		h.mu.Lock()
+		if _, ok := h.subs[ch]; ok {
+			delete(h.subs, ch)
+			close(ch)
+		}
+		h.mu.Unlock()
+	}
+}
+
+func (h *liveHub) publish(ev liveEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// close ends every subscription, so open sockets are closed on shutdown.
+func (h *liveHub) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs {
+		delete(h.subs, ch)
+		close(ch)
+	}
+}
+
+// publishSelection tells other browsers that a container or volume was
+// selected or deselected.
+func (s *Server) publishSelection(r *http.Request, kind, id, name string, selected bool) {
+	p, _ := principalFrom(r.Context())
+	s.live.publish(liveEvent{Type: "selection", Kind: kind, ID: id, Name: name, Selected: selected, User: p.User})
+}
+
+// watchContainerEvents follows the daemon's container events and publishes
+// the ones that change the list, reconnecting until ctx is done.
+func (s *Server) watchContainerEvents(ctx context.Context) {
+	for {
+		if err := s.followContainerEvents(ctx); err != nil && ctx.Err() == nil {
+			slog.WarnContext(ctx, "Docker event stream ended, reconnecting", "retry", liveEventsRetry, "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			s.live.close()
+			return
+		case <-time.After(liveEventsRetry):
+		}
+	}
+}
+
+func (s *Server) followContainerEvents(ctx context.Context) error {
+	cli, err := newDockerClient(ctx)
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+
+	msgs, errs := cli.Events(ctx, types.EventsOptions{Filters: filters.NewArgs(filters.Arg("type", string(events.ContainerEventType)))})
+	for {
+		select {
+		case err := <-errs:
+			return err
+		case msg := <-msgs:
+			if !liveActions[msg.Action] {
+				continue
+			}
+			ev := liveEvent{Type: "container", Action: string(msg.Action), ID: msg.Actor.ID}
+			if msg.Action != events.ActionDestroy {
+				list, err := cli.ContainerList(ctx, container.ListOptions{All: true, Filters: filters.NewArgs(filters.Arg("id", msg.Actor.ID))})
+				if err == nil && len(list) == 1 {
+					ev.State, ev.Status = list[0].State, list[0].Status
+				}
+			}
+			s.live.publish(ev)
+		}
+	}
+}
+
+// checkOrigin is the WebSocket handshake check: only pages served by this
+// instance, or origins trusted by the CORS policy, may connect.
+func (s *Server) checkOrigin(cfg *websocket.Config, req *http.Request) error {
+	origin := req.Header.Get("Origin")
+	u, err := url.Parse(origin)
+	if err != nil || (u.Host != req.Host && !s.cfg.CORS.trusts(origin)) {
+		slog.WarnContext(req.Context(), "Rejected WebSocket from another origin", "origin", origin)
+		return websocket.ErrBadWebSocketOrigin
+	}
+	return nil
+}
+
+// handleLive upgrades to a WebSocket and streams list updates as JSON
+// messages until the browser goes away.
+func (s *Server) handleLive(w http.ResponseWriter, r *http.Request) {
+	ws := websocket.Server{
+		Handshake: s.checkOrigin,
+		Handler: func(conn *websocket.Conn) {
+			updates, stop := s.live.subscribe()
+			defer stop()
+
+			// The browser never sends anything; a read returning means it left
+			gone := make(chan struct{})
+			go func() {
+				var discard []byte
+				for websocket.Message.Receive(conn, &discard) == nil {
+				}
+				close(gone)
+			}()
+
+			for {
+				select {
+				case <-gone:
+					return
+				case ev, ok := <-updates:
+					if !ok {
+						return
+					}
+					if err := websocket.JSON.Send(conn, ev); err != nil {
+						return
+					}
+				}
+			}
+		},
+	}
+	ws.ServeHTTP(w, r)
+}
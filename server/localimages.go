@@ -0,0 +1,176 @@
+package server
+
+import (
+	"dockerap/store"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+)
+
+// localImage is an image on this host as listed by /api/images.
+type localImage struct {
+	ID           string    `json:"id"`
+	RepoTags     []string  `json:"repoTags"`
+	RepoDigests  []string  `json:"repoDigests"`
+	Created      time.Time `json:"created"`
+	Size         int64     `json:"size"`
+	Containers   int64     `json:"containers"`   // containers using the image, running or not
+	Dangling     bool      `json:"dangling"`     // untagged, usually left behind by a newer pull
+	SelectedTags []string  `json:"selectedTags"` // tags selected for replication on their own
+}
+
+// handleImages lists the images on this host, largest first, so the ones
+// piling up from repeated replications can be found and removed.
+// ?dangling=true lists only untagged images.
+func (s *Server) handleImages(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	cli, err := newDockerClient(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to create docker client", "err", err)
+		writeError(w, r, "Unable to create docker client", err)
+		return
+	}
+	defer cli.Close()
+
+	opts := image.ListOptions{ContainerCount: true}
+	if r.URL.Query().Get("dangling") == "true" {
+		opts.Filters = filters.NewArgs(filters.Arg("dangling", "true"))
+	}
+	summaries, err := cli.ImageList(r.Context(), opts)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to list images", "err", err)
+		writeError(w, r, "Unable to list images", err)
+		return
+	}
+
+	selected, err := s.store.GetSelectedImages()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to get selected images", "err", err)
+		writeError(w, r, "Unable to get selected images", err)
+		return
+	}
+
+	images := make([]localImage, 0, len(summaries))
+	for _, sum := range summaries {
+		img := localImage{
+			ID:           sum.ID,
+			RepoTags:     []string{},
+			RepoDigests:  sum.RepoDigests,
+			Created:      time.Unix(sum.Created, 0).UTC(),
+			Size:         sum.Size,
+			Containers:   sum.Containers,
+			SelectedTags: []string{},
+		}
+		for _, tag := range sum.RepoTags {
+			if tag != "<none>:<none>" {
+				img.RepoTags = append(img.RepoTags, tag)
+			}
+			if selected[tag] {
+				img.SelectedTags = append(img.SelectedTags, tag)
+			}
+		}
+		if img.RepoDigests == nil {
+			img.RepoDigests = []string{}
+		}
+		img.Dangling = len(img.RepoTags) == 0
+		images = append(images, img)
+	}
+	sort.Slice(images, func(i, j int) bool { return images[i].Size > images[j].Size })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(images)
+}
+
+// handleImage inspects (GET) or removes (DELETE) one image, named by ID or
+// reference. Removing takes ?force=true to untag an image used by stopped
+// containers or tagged more than once, and is recorded in the audit log.
+func (s *Server) handleImage(w http.ResponseWriter, r *http.Request) {
+	ref := r.PathValue("ref")
+
+	cli, err := newDockerClient(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to create docker client", "err", err)
+		writeError(w, r, "Unable to create docker client", err)
+		return
+	}
+	defer cli.Close()
+
+	switch r.Method {
+	case http.MethodGet:
+		_, raw, err := cli.ImageInspectWithRaw(r.Context(), ref)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if client.IsErrNotFound(err) {
+				status = http.StatusNotFound
+			}
+			http.Error(w, fmt.Sprintf("Unable to inspect image: %s", err), status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(raw)
+
+	case http.MethodDelete:
+		deleted, err := cli.ImageRemove(r.Context(), ref, image.RemoveOptions{
+			Force:         r.URL.Query().Get("force") == "true",
+			PruneChildren: true,
+		})
+
+		p, _ := principalFrom(r.Context())
+		entry := store.AuditEntry{
+			Actor:      p.User,
+			RemoteAddr: r.RemoteAddr,
+			Action:     "image:remove",
+			Target:     ref,
+			Outcome:    "succeeded",
+		}
+		if err != nil {
+			entry.Outcome = "failed"
+			entry.Detail = err.Error()
+		}
+		if auditErr := s.store.RecordAudit(entry); auditErr != nil {
+			slog.ErrorContext(r.Context(), "Unable to record audit entry", "action", entry.Action, "err", auditErr)
+		}
+
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Unable to remove image", "image", ref, "err", err)
+			status := http.StatusInternalServerError
+			switch {
+			case client.IsErrNotFound(err):
+				status = http.StatusNotFound
+			case errdefs.IsConflict(err):
+				status = http.StatusConflict
+			}
+			http.Error(w, fmt.Sprintf("Unable to remove image: %s", err), status)
+			return
+		}
+
+		var untagged, removed []string
+		for _, d := range deleted {
+			if d.Untagged != "" {
+				untagged = append(untagged, d.Untagged)
+			}
+			if d.Deleted != "" {
+				removed = append(removed, d.Deleted)
+			}
+		}
+		slog.InfoContext(r.Context(), "Removed image", "image", ref, "untagged", strings.Join(untagged, ","), "deleted", len(removed))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string][]string{"untagged": untagged, "deleted": removed})
+
+	default:
+		http.Error(w, "Only GET and DELETE methods are allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,189 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// sseLineWriter turns a container's output into server-sent events, one
+// event per line, named after the stream the line came from.
+type sseLineWriter struct {
+	mu     *sync.Mutex // shared by stdout, stderr and the keep-alive
+	rc     *http.ResponseController
+	w      io.Writer
+	stream string
+	buf    []byte
+}
+
+func (s *sseLineWriter) Write(p []byte) (int, error) {
+	s.buf = append(s.buf, p...)
+	for {
+		i := bytes.IndexByte(s.buf, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		if err := s.send(s.buf[:i]); err != nil {
+			return 0, err
+		}
+		s.buf = s.buf[i+1:]
+	}
+}
+
+// flush sends a final line that did not end in a newline.
+func (s *sseLineWriter) flush() error {
+	if len(s.buf) == 0 {
+		return nil
+	}
+	err := s.send(s.buf)
+	s.buf = nil
+	return err
+}
+
+func (s *sseLineWriter) send(line []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", s.stream, bytes.TrimSuffix(line, []byte("\r"))); err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
+
+// handleContainerLogs returns a container's logs. ?tail=N limits them to the
+// last N lines and ?timestamps=true prefixes each line with its time. Without
+// ?follow=true the logs are returned as plain text; with it they are streamed
+// as server-sent events named stdout or stderr, one per line, until the
+// container stops or the client goes away.
+func (s *Server) handleContainerLogs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	tail := q.Get("tail")
+	if tail == "" {
+		tail = "all"
+	} else if n, err := strconv.Atoi(tail); tail != "all" && (err != nil || n < 0) {
+		http.Error(w, fmt.Sprintf("Invalid tail %q; use a number of lines or all", tail), http.StatusBadRequest)
+		return
+	}
+	follow := q.Get("follow") == "true"
+
+	cli, err := newDockerClient(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to create docker client", "err", err)
+		writeError(w, r, "Unable to create docker client", err)
+		return
+	}
+	defer cli.Close()
+
+	ctx := r.Context()
+	id := r.PathValue("id")
+	info, err := cli.ContainerInspect(ctx, id)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if client.IsErrNotFound(err) {
+			status = http.StatusNotFound
+		}
+		http.Error(w, fmt.Sprintf("Unable to inspect container: %s", err), status)
+		return
+	}
+
+	logs, err := cli.ContainerLogs(ctx, id, container.LogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     follow,
+		Tail:       tail,
+		Timestamps: q.Get("timestamps") == "true",
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Unable to read container logs", "container", id, "err", err)
+		writeError(w, r, "Unable to read container logs", err)
+		return
+	}
+	defer logs.Close()
+
+	// Containers with a TTY have a single raw stream; the rest multiplex
+	// stdout and stderr and need splitting
+	tty := info.Config != nil && info.Config.Tty
+
+	if !follow {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if tty {
+			_, err = io.Copy(w, logs)
+		} else {
+			_, err = stdcopy.StdCopy(w, w, logs)
+		}
+		if err != nil && ctx.Err() == nil {
+			slog.WarnContext(ctx, "Container log copy ended early", "container", id, "err", err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // keep nginx from buffering the stream
+	w.WriteHeader(http.StatusOK)
+	rc := http.NewResponseController(w)
+	rc.Flush()
+
+	var mu sync.Mutex
+	stdout := &sseLineWriter{mu: &mu, rc: rc, w: w, stream: "stdout"}
+	stderr := &sseLineWriter{mu: &mu, rc: rc, w: w, stream: "stderr"}
+	done := make(chan error, 1)
+	go func() {
+		var err error
+		if tty {
+			_, err = io.Copy(stdout, logs)
+		} else {
+			_, err = stdcopy.StdCopy(stdout, stderr, logs)
+		}
+		stdout.flush()
+		stderr.flush()
+		done <- err
+	}()
+
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			// Stop the copy before the response writer goes away
+			logs.Close()
+			<-done
+			return
+		case err := <-done:
+			mu.Lock()
+			if err != nil && ctx.Err() == nil {
+				slog.WarnContext(ctx, "Container log stream ended", "container", id, "err", err)
+				fmt.Fprintf(w, "event: error\ndata: %s\n\n", strings.ReplaceAll(err.Error(), "\n", " "))
+			} else {
+				fmt.Fprint(w, "event: end\ndata: container stopped\n\n")
+			}
+			rc.Flush()
+			mu.Unlock()
+			return
+		case <-keepAlive.C:
+			mu.Lock()
+			_, err := fmt.Fprint(w, ": keep-alive\n\n")
+			if err == nil {
+				rc.Flush()
+			}
+			mu.Unlock()
+			if err != nil {
+				return
+			}
+		}
+	}
+}
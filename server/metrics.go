@@ -0,0 +1,180 @@
+package server
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/client"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Replication metrics, served on /metrics.
+var (
+	metricsRegistry = prometheus.NewRegistry()
+
+	replicationRuns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "dockerapp_replication_runs_total",
+		Help: "Replication and failback jobs by direction and final status.",
+	}, []string{"direction", "status"})
+	replicationRunDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "dockerapp_replication_run_duration_seconds",
+		Help:    "Duration of replication and failback jobs.",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 14), // 1s to about 2h
+	}, []string{"direction"})
+	replicationItems = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "dockerapp_replication_items_total",
+		Help: "Replicated items by type (image, network, volume, container) and result (replicated, failed, skipped).",
+	}, []string{"type", "result"})
+	replicationBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "dockerapp_replication_bytes_total",
+		Help: "Bytes sent to destinations by item type.",
+	}, []string{"type"})
+	transferDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "dockerapp_transfer_duration_seconds",
+		Help:    "Time to replicate a single item by type.",
+		Buckets: prometheus.ExponentialBuckets(0.1, 2, 16), // 100ms to about 55m
+	}, []string{"type"})
+	dockerAPIErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "dockerapp_docker_api_errors_total",
+		Help: "Docker API calls that failed to connect or returned a server error, by resource.",
+	}, []string{"resource"})
+)
+
+func init() {
+	metricsRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		replicationRuns, replicationRunDuration, replicationItems, replicationBytes, transferDuration, dockerAPIErrors,
+	)
+}
+
+// observeReport counts a finished job and its items.
+func observeReport(rep *ReplicationReport) {
+	direction := rep.Direction
+	if direction == "" {
+		direction = "replicate"
+	}
+	replicationRuns.WithLabelValues(direction, rep.Status).Inc()
+	replicationRunDuration.WithLabelValues(direction).Observe(time.Duration(rep.DurationMs * int64(time.Millisecond)).Seconds())
+	for _, d := range rep.Destinations {
+		for _, item := range d.Items {
+			replicationItems.WithLabelValues(item.Type, item.Status).Inc()
+			replicationBytes.WithLabelValues(item.Type).Add(float64(item.Bytes))
+			if item.Status != ItemSkipped {
+				transferDuration.WithLabelValues(item.Type).Observe(float64(item.DurationMs) / 1000)
+			}
+		}
+	}
+}
+
+// selectionCollector reports the current selection when scraped.
+type selectionCollector struct {
+	s    *Server
+	desc *prometheus.Desc
+}
+
+func (c selectionCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c selectionCollector) Collect(ch chan<- prometheus.Metric) {
+	counts := map[string]func() (int, error){
+		"container": func() (int, error) {
+			items, err := c.s.store.GetSelectedContainers()
+			return len(items), err
+		},
+		"volume": func() (int, error) {
+			items, err := c.s.store.GetSelectedVolumes()
+			return len(items), err
+		},
+		"network": func() (int, error) {
+			items, err := c.s.store.GetSelectedNetworks()
+			return len(items), err
+		},
+		"image": func() (int, error) {
+			items, err := c.s.store.GetSelectedImages()
+			return len(items), err
+		},
+		"project": func() (int, error) {
+			items, err := c.s.store.GetSelectedProjects()
+			return len(items), err
+		},
+	}
+	for kind, count := range counts {
+		n, err := count()
+		if err != nil {
+			slog.Error("Unable to count selected items", "type", kind, "err", err)
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(n), kind)
+	}
+	rules, err := c.s.store.GetSelectionRules()
+	if err != nil {
+		slog.Error("Unable to count selection rules", "err", err)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(len(rules)), "rule")
+}
+
+var registerSelection sync.Once
+
+// metricsHandler serves the Prometheus metrics of this process.
+func (s *Server) metricsHandler() http.Handler {
+	registerSelection.Do(func() {
+		metricsRegistry.MustRegister(selectionCollector{s: s, desc: prometheus.NewDesc(
+			"dockerapp_selected_items", "Items selected for replication by type (container, volume, network, image, project, rule).",
+			[]string{"type"}, nil)})
+	})
+	return promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{})
+}
+
+// dockerErrorTransport counts failed Docker API calls. Not-found and other
+// client errors are part of normal lookups and are not counted.
+type dockerErrorTransport struct {
+	base http.RoundTripper
+}
+
+func (t *dockerErrorTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.StatusCode >= 500 {
+		dockerAPIErrors.WithLabelValues(dockerResource(req.URL.Path)).Inc()
+	}
+	return resp, err
+}
+
+// dockerResource reduces a Docker API path such as /v1.45/containers/abc/json
+// to its resource, "containers".
+func dockerResource(path string) string {
+	parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	if len(parts) > 1 && strings.HasPrefix(parts[0], "v1.") {
+		parts = parts[1:]
+	}
+	return parts[0]
+}
+
+var (
+	dockerHTTPOnce   sync.Once
+	dockerHTTPClient *http.Client
+	dockerHTTPErr    error
+)
+
+// dockerHTTP returns the HTTP client for the Docker daemon, configured from
+// the environment like the Docker CLI and counting failed calls. It is shared
+// by every Docker client, so they also share connections.
+func dockerHTTP() (*http.Client, error) {
+	dockerHTTPOnce.Do(func() {
+		cli, err := client.NewClientWithOpts(client.FromEnv)
+		if err != nil {
+			dockerHTTPErr = err
+			return
+		}
+		dockerHTTPClient = cli.HTTPClient()
+		dockerHTTPClient.Transport = &dockerErrorTransport{base: dockerHTTPClient.Transport}
+	})
+	return dockerHTTPClient, dockerHTTPErr
+}
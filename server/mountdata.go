@@ -0,0 +1,253 @@
+package server
+
+import (
+	"context"
+	"dockerap/apiclient"
+	"dockerap/store"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/client"
+)
+
+// dataMount is a mount whose contents are copied to the replica.
+type dataMount struct {
+	Kind     mount.Type // volume or bind
+	Source   string     // volume name or source host path
+	Path     string     // mount destination inside the container
+	Excludes []string   // glob patterns left out of the copy
+}
+
+func (d dataMount) String() string {
+	desc := fmt.Sprintf("%s %s -> %s", d.Kind, d.Source, d.Path)
+	if len(d.Excludes) > 0 {
+		desc += " excluding " + strings.Join(d.Excludes, ", ")
+	}
+	return desc
+}
+
+// planMountData decides which mount contents each planned container carries:
+// selected named volumes (copied once, through the first container mounting
+// them) and bind mounts opted in for data replication, plus how the source
+// container is quiesced and which hooks run around the copy. Selected volumes
+// no planned container mounts carry their own contents.
+func (s *Server) planMountData(plan *replicationPlan, selectedVolumes map[string]bool) error {
+	selectedBinds, err := s.store.GetSelectedBindMounts()
+	if err != nil {
+		return fmt.Errorf("unable to get selected bind mounts: %w", err)
+	}
+	volumeExcludes, err := s.store.GetVolumeExcludes()
+	if err != nil {
+		return fmt.Errorf("unable to get volume excludes: %w", err)
+	}
+	quiesceModes, err := s.store.GetQuiesceModes()
+	if err != nil {
+		return fmt.Errorf("unable to get quiesce modes: %w", err)
+	}
+	hooks, err := s.store.GetReplicationHooks()
+	if err != nil {
+		return fmt.Errorf("unable to get replication hooks: %w", err)
+	}
+
+	copiedVolumes := make(map[string]bool)
+	for i := range plan.Containers {
+		pc := &plan.Containers[i]
+		for _, m := range pc.Inspect.Mounts {
+			switch m.Type {
+			case mount.TypeVolume:
+				if !selectedVolumes[m.Name] || copiedVolumes[m.Name] {
+					continue
+				}
+				copiedVolumes[m.Name] = true
+				pc.DataMounts = append(pc.DataMounts, dataMount{Kind: m.Type, Source: m.Name, Path: m.Destination, Excludes: volumeExcludes[m.Name]})
+			case mount.TypeBind:
+				for _, b := range selectedBinds[pc.Inspect.ID] {
+					if b.Source != m.Source {
+						continue
+					}
+					pc.DataMounts = append(pc.DataMounts, dataMount{Kind: m.Type, Source: m.Source, Path: m.Destination})
+					if b.TargetPath != "" && b.TargetPath != b.Source {
+						if pc.BindRemaps == nil {
+							pc.BindRemaps = make(map[string]string)
+						}
+						pc.BindRemaps[b.Source] = b.TargetPath
+					}
+				}
+			}
+		}
+		if len(pc.DataMounts) > 0 {
+			pc.Quiesce = quiesceModes[pc.Inspect.ID]
+			pc.Hooks = hooks[pc.Inspect.ID]
+		}
+	}
+
+	// Volumes selected on their own are copied with the volume itself
+	for _, vol := range plan.Volumes {
+		if copiedVolumes[vol.Name] {
+			continue
+		}
+		if plan.VolumeData == nil {
+			plan.VolumeData = make(map[string]dataMount)
+		}
+		plan.VolumeData[vol.Name] = dataMount{Kind: mount.TypeVolume, Source: vol.Name, Excludes: volumeExcludes[vol.Name]}
+	}
+	return nil
+}
+
+// remapBinds returns a copy of hc with bind mount sources moved according to
+// remaps (source host path -> destination host path).
+func remapBinds(hc *container.HostConfig, remaps map[string]string) *container.HostConfig {
+	if hc == nil || len(remaps) == 0 {
+		return hc
+	}
+	out := *hc
+	out.Binds = make([]string, len(hc.Binds))
+	for i, bind := range hc.Binds {
+		src, rest, found := strings.Cut(bind, ":")
+		if target, ok := remaps[src]; ok && found {
+			bind = target + ":" + rest
+		}
+		out.Binds[i] = bind
+	}
+	out.Mounts = make([]mount.Mount, len(hc.Mounts))
+	for i, m := range hc.Mounts {
+		if target, ok := remaps[m.Source]; ok && m.Type == mount.TypeBind {
+			m.Source = target
+		}
+		out.Mounts[i] = m
+	}
+	return &out
+}
+
+// copyMountData streams the contents of one mount from the source container
+// into the same path of the replica named replicaName on the destination.
+func copyMountData(ctx context.Context, srcCli *client.Client, httpClient *http.Client, dest, srcContainerID, replicaName string, dm dataMount) error {
+	return streamMountData(ctx, srcCli, httpClient, dest, srcContainerID, dm.Excludes, apiclient.RestoreTarget{Container: replicaName, Path: dm.Path})
+}
+
+// copyVolumeData streams the contents of a volume no planned container
+// mounts into the volume destVolume on the destination, through helper
+// containers where nothing mounts it.
+func (s *Server) copyVolumeData(ctx context.Context, srcCli *client.Client, httpClient *http.Client, dest, destVolume string, dm dataMount) error {
+	id, p, release, err := s.volumeAccess(ctx, srcCli, dm.Source)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return streamMountData(ctx, srcCli, httpClient, dest, id, dm.Excludes, apiclient.RestoreTarget{Volume: destVolume, Path: p})
+}
+
+// streamMountData restores the contents of target.Path in the source
+// container, less excluded paths, into target on the destination.
+func streamMountData(ctx context.Context, srcCli *client.Client, httpClient *http.Client, dest, srcContainerID string, excludes []string, target apiclient.RestoreTarget) error {
+	p := target.Path
+	excluded, err := compileExcludes(excludes)
+	if err != nil {
+		return err
+	}
+	tar, _, err := srcCli.CopyFromContainer(ctx, srcContainerID, p)
+	if err != nil {
+		return fmt.Errorf("read %s: %w", p, err)
+	}
+	defer tar.Close()
+
+	var body io.Reader = tar
+	if len(excludes) > 0 {
+		pr, pw := io.Pipe()
+		defer pr.Close()
+		go func() {
+			pw.CloseWithError(filterTar(tar, pw, func(name string) bool { return excluded(stripArchiveRoot(name)) }))
+		}()
+		body = pr
+	}
+
+	if err := apiclient.New(dest, httpClient).RestoreData(ctx, target, body); err != nil {
+		return fmt.Errorf("restore %s: %w", p, err)
+	}
+	return nil
+}
+
+// Destination API: Restore mount contents into a created container. The body
+// is a tar archive as returned by the Docker archive API for path, so it is
+// rooted at the last element of path and lands in whatever is mounted there.
+// Given a volume instead of a container, the contents go into that volume
+// through a helper container mounting it at path.
+func (s *Server) handleRestoreData(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	containerName := r.URL.Query().Get("container")
+	volumeName := r.URL.Query().Get("volume")
+	target := r.URL.Query().Get("path")
+	if (containerName == "") == (volumeName == "") || !path.IsAbs(target) || path.Clean(target) == "/" {
+		http.Error(w, "container or volume, and an absolute mount path, are required", http.StatusBadRequest)
+		return
+	}
+	slog.InfoContext(r.Context(), "Restoring data", "container", containerName, "volume", volumeName, "target", target)
+
+	cli, err := newDockerClient(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to create docker client", "err", err)
+		writeError(w, r, "Unable to create docker client", err)
+		return
+	}
+	defer cli.Close()
+
+	ctx := context.WithoutCancel(r.Context())
+	if volumeName != "" {
+		id, release, err := s.helperContainer(ctx, cli, volumeName, path.Clean(target))
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to restore data", "volume", volumeName, "err", err)
+			writeError(w, r, "Failed to restore data", err)
+			return
+		}
+		defer release()
+		containerName = id
+	}
+	if err := cli.CopyToContainer(ctx, containerName, path.Dir(path.Clean(target)), r.Body, types.CopyToContainerOptions{}); err != nil {
+		slog.ErrorContext(ctx, "Failed to restore data", "container", containerName, "target", target, "err", err)
+		writeError(w, r, "Failed to restore data", err)
+		return
+	}
+
+	slog.InfoContext(ctx, "Successfully restored data", "container", containerName, "target", target)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
+
+func (s *Server) handleBindMounts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var payload struct {
+		store.BindMount
+		IsSelected bool `json:"isSelected"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if payload.TargetPath != "" && !path.IsAbs(payload.TargetPath) {
+		http.Error(w, "targetPath must be an absolute path", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.store.SetBindMountSelection(payload.BindMount, payload.IsSelected); err != nil {
+		slog.ErrorContext(r.Context(), "Unable to update bind mount selection", "err", err)
+		writeError(w, r, "Unable to update bind mount selection", err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
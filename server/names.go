@@ -0,0 +1,169 @@
+package server
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
+)
+
+// nameRemap renames replicated containers and volumes on the destination, so
+// replicas can sit alongside containers of the same name there. Explicit
+// names win over the suffix.
+type nameRemap struct {
+	Suffix     string            `json:"suffix"`     // appended to every name without an explicit entry, e.g. "-replica"
+	Containers map[string]string `json:"containers"` // source container name -> replica name
+	Volumes    map[string]string `json:"volumes"`    // source volume name -> replica volume name
+}
+
+// validate checks the rename map.
+func (n *nameRemap) validate() error {
+	if n == nil {
+		return nil
+	}
+	if strings.ContainsAny(n.Suffix, "/: ") {
+		return fmt.Errorf("invalid name suffix %q", n.Suffix)
+	}
+	for from, to := range n.Containers {
+		if to == "" || strings.ContainsAny(to, "/: ") {
+			return fmt.Errorf("invalid replica name %q for container %s", to, from)
+		}
+	}
+	for from, to := range n.Volumes {
+		if to == "" || strings.ContainsAny(to, "/: ") {
+			return fmt.Errorf("invalid replica name %q for volume %s", to, from)
+		}
+	}
+	return nil
+}
+
+func (n *nameRemap) container(name string) string {
+	if to, ok := n.Containers[name]; ok {
+		return to
+	}
+	return name + n.Suffix
+}
+
+func (n *nameRemap) volume(name string) string {
+	if to, ok := n.Volumes[name]; ok {
+		return to
+	}
+	return name + n.Suffix
+}
+
+// applyNameRemap sets the replica name of every planned container and volume
+// and points volume mounts, volumes-from, links and network aliases at the
+// renamed resources. Compose depends_on labels name services, not
+// containers, and the dockerapp.depends-on label names source containers, so
+// both are left as they are.
+func applyNameRemap(plan *replicationPlan, remap *nameRemap) {
+	if remap == nil || (remap.Suffix == "" && len(remap.Containers) == 0 && len(remap.Volumes) == 0) {
+		return
+	}
+
+	plan.VolumeNames = make(map[string]string, len(plan.Volumes))
+	for _, vol := range plan.Volumes {
+		plan.VolumeNames[vol.Name] = remap.volume(vol.Name)
+	}
+	containerNames := make(map[string]string, len(plan.Containers))
+	for i := range plan.Containers {
+		pc := &plan.Containers[i]
+		pc.Name = remap.container(containerName(pc.Inspect))
+		containerNames[containerName(pc.Inspect)] = pc.Name
+	}
+
+	for i := range plan.Containers {
+		pc := &plan.Containers[i]
+		if pc.Inspect.HostConfig == nil {
+			continue
+		}
+		hc := *pc.Inspect.HostConfig
+		hc.Binds = make([]string, len(pc.Inspect.HostConfig.Binds))
+		for j, bind := range pc.Inspect.HostConfig.Binds {
+			// Host paths are absolute; anything else names a volume
+			src, rest, found := strings.Cut(bind, ":")
+			if to, ok := plan.VolumeNames[src]; ok && found {
+				bind = to + ":" + rest
+			}
+			hc.Binds[j] = bind
+		}
+		hc.Mounts = make([]mount.Mount, len(pc.Inspect.HostConfig.Mounts))
+		for j, m := range pc.Inspect.HostConfig.Mounts {
+			if to, ok := plan.VolumeNames[m.Source]; ok && m.Type == mount.TypeVolume {
+				m.Source = to
+			}
+			hc.Mounts[j] = m
+		}
+		hc.VolumesFrom = make([]string, len(pc.Inspect.HostConfig.VolumesFrom))
+		for j, from := range pc.Inspect.HostConfig.VolumesFrom {
+			name, mode, found := strings.Cut(from, ":")
+			if to, ok := containerNames[name]; ok {
+				from = to
+				if found {
+					from += ":" + mode
+				}
+			}
+			hc.VolumesFrom[j] = from
+		}
+		hc.Links = make([]string, len(pc.Inspect.HostConfig.Links))
+		for j, link := range pc.Inspect.HostConfig.Links {
+			hc.Links[j] = renameLink(link, pc.Name, containerNames)
+		}
+		pc.Inspect.HostConfig = &hc
+	}
+
+	for i := range plan.Containers {
+		pc := &plan.Containers[i]
+		if pc.Inspect.NetworkSettings == nil {
+			continue
+		}
+		settings := *pc.Inspect.NetworkSettings
+		settings.Networks = make(map[string]*network.EndpointSettings, len(pc.Inspect.NetworkSettings.Networks))
+		for name, ep := range pc.Inspect.NetworkSettings.Networks {
+			if ep != nil {
+				renamed := *ep
+				renamed.Aliases = make([]string, len(ep.Aliases))
+				for j, alias := range ep.Aliases {
+					if to, ok := containerNames[alias]; ok {
+						alias = to
+					}
+					renamed.Aliases[j] = alias
+				}
+				ep = &renamed
+			}
+			settings.Networks[name] = ep
+		}
+		pc.Inspect.NetworkSettings = &settings
+	}
+}
+
+// renameLink points a legacy link at the renamed target and renames the
+// linking container in it, keeping the alias the linking container uses.
+// Inspect gives links as "/db:/web/db"; a create request also takes "db:db"
+// and "db".
+func renameLink(link, self string, containerNames map[string]string) string {
+	target, alias, found := strings.Cut(link, ":")
+	if !found {
+		alias = target
+	}
+	rooted := strings.HasPrefix(target, "/")
+	target = strings.TrimPrefix(target, "/")
+	if to, ok := containerNames[target]; ok {
+		target = to
+	}
+	alias = path.Base(alias)
+	if rooted {
+		return "/" + target + ":/" + self + "/" + alias
+	}
+	return target + ":" + alias
+}
+
+// volumeName returns the name a planned volume gets on the destination.
+func (p *replicationPlan) volumeName(name string) string {
+	if to, ok := p.VolumeNames[name]; ok {
+		return to
+	}
+	return name
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/volume"
+)
+
+func TestRenameLink(t *testing.T) {
+	names := map[string]string{"db": "db-replica", "web": "web-replica"}
+	tests := []struct {
+		link string
+		want string
+	}{
+		{"/db:/web/db", "/db-replica:/web-replica/db"},
+		{"/db:/web/database", "/db-replica:/web-replica/database"},
+		{"db:database", "db-replica:database"},
+		{"db", "db-replica:db"},
+		{"/cache:/web/cache", "/cache:/web-replica/cache"},
+	}
+	for _, tt := range tests {
+		if got := renameLink(tt.link, "web-replica", names); got != tt.want {
+			t.Errorf("renameLink(%q) = %q, want %q", tt.link, got, tt.want)
+		}
+	}
+}
+
+func TestApplyNameRemap(t *testing.T) {
+	planned := func(name string, hc *container.HostConfig, networks map[string]*network.EndpointSettings, labels map[string]string) plannedContainer {
+		var pc plannedContainer
+		pc.Inspect.ContainerJSONBase = &types.ContainerJSONBase{ID: name + "1", Name: "/" + name, HostConfig: hc}
+		pc.Inspect.Config = &container.Config{Labels: labels}
+		pc.Inspect.NetworkSettings = &types.NetworkSettings{Networks: networks}
+		return pc
+	}
+	db := planned("db", &container.HostConfig{
+		Binds:  []string{"pgdata:/var/lib/postgresql/data", "/etc/pg:/etc/pg:ro"},
+		Mounts: []mount.Mount{{Type: mount.TypeVolume, Source: "pgdata", Target: "/backup"}},
+	}, map[string]*network.EndpointSettings{"shop": {Aliases: []string{"db", "postgres"}}},
+		map[string]string{composeServiceLabel: "db"})
+	web := planned("web", &container.HostConfig{
+		VolumesFrom: []string{"db:ro", "tools"},
+		Links:       []string{"/db:/web/database"},
+	}, map[string]*network.EndpointSettings{"shop": {Aliases: []string{"web"}}, "edge": nil},
+		map[string]string{composeServiceLabel: "web", composeDependsOnLabel: "db:service_started:false"})
+	web.DependsOn = []string{"db"}
+	plan := &replicationPlan{
+		Volumes:    []volume.Volume{{Name: "pgdata"}},
+		Containers: []plannedContainer{db, web},
+	}
+
+	applyNameRemap(plan, &nameRemap{Suffix: "-replica", Containers: map[string]string{"web": "storefront"}, Volumes: map[string]string{"pgdata": "pgdata-standby"}})
+
+	db, web = plan.Containers[0], plan.Containers[1]
+	if db.Name != "db-replica" || web.Name != "storefront" {
+		t.Errorf("replica names = %s, %s, want db-replica and storefront", db.Name, web.Name)
+	}
+	checks := []struct {
+		what      string
+		got, want any
+	}{
+		{"db binds", db.Inspect.HostConfig.Binds, []string{"pgdata-standby:/var/lib/postgresql/data", "/etc/pg:/etc/pg:ro"}},
+		{"db mounts", db.Inspect.HostConfig.Mounts, []mount.Mount{{Type: mount.TypeVolume, Source: "pgdata-standby", Target: "/backup"}}},
+		{"db aliases", db.Inspect.NetworkSettings.Networks["shop"].Aliases, []string{"db-replica", "postgres"}},
+		{"web volumes-from", web.Inspect.HostConfig.VolumesFrom, []string{"db-replica:ro", "tools"}},
+		{"web links", web.Inspect.HostConfig.Links, []string{"/db-replica:/storefront/database"}},
+		{"web aliases", web.Inspect.NetworkSettings.Networks["shop"].Aliases, []string{"storefront"}},
+		{"web on edge", web.Inspect.NetworkSettings.Networks["edge"], (*network.EndpointSettings)(nil)},
+		// Services and source names stay, as the monitor orders replicas by
+		// their dockerapp.source-name label
+		{"web depends_on label", web.Inspect.Config.Labels[composeDependsOnLabel], "db:service_started:false"},
+		{"web dependencies", web.DependsOn, []string{"db"}},
+	}
+	for _, c := range checks {
+		if !reflect.DeepEqual(c.got, c.want) {
+			t.Errorf("%s = %v, want %v", c.what, c.got, c.want)
+		}
+	}
+	if plan.volumeName("pgdata") != "pgdata-standby" || plan.volumeName("other") != "other" {
+		t.Errorf("volume names = %v", plan.VolumeNames)
+	}
+}
+
+func TestApplyNameRemapLeavesTheSourceInspect(t *testing.T) {
+	endpoint := &network.EndpointSettings{Aliases: []string{"db"}}
+	hc := &container.HostConfig{Links: []string{"/cache:/db/cache"}}
+	var pc plannedContainer
+	pc.Inspect.ContainerJSONBase = &types.ContainerJSONBase{ID: "db1", Name: "/db", HostConfig: hc}
+	pc.Inspect.Config = &container.Config{}
+	pc.Inspect.NetworkSettings = &types.NetworkSettings{Networks: map[string]*network.EndpointSettings{"shop": endpoint}}
+	plan := &replicationPlan{Containers: []plannedContainer{pc}}
+
+	applyNameRemap(plan, &nameRemap{Suffix: "-replica"})
+	if endpoint.Aliases[0] != "db" || hc.Links[0] != "/cache:/db/cache" {
+		t.Errorf("source inspect changed: aliases %v, links %v", endpoint.Aliases, hc.Links)
+	}
+}
+
+func TestNameRemapValidate(t *testing.T) {
+	tests := []struct {
+		remap *nameRemap
+		ok    bool
+	}{
+		{nil, true},
+		{&nameRemap{Suffix: "-replica"}, true},
+		{&nameRemap{Suffix: "/replica"}, false},
+		{&nameRemap{Containers: map[string]string{"web": ""}}, false},
+		{&nameRemap{Containers: map[string]string{"web": "store front"}}, false},
+		{&nameRemap{Volumes: map[string]string{"data": "data:ro"}}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.remap.validate(); (err == nil) != tt.ok {
+			t.Errorf("validate(%+v) = %v, want ok %t", tt.remap, err, tt.ok)
+		}
+	}
+}
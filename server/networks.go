@@ -0,0 +1,177 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+)
+
+// localNetwork is a network on this host as returned by /api/networks.
+type localNetwork struct {
+	ID         string             `json:"id"`
+	Name       string             `json:"name"`
+	Driver     string             `json:"driver"`
+	Scope      string             `json:"scope"`
+	Internal   bool               `json:"internal"`
+	Attachable bool               `json:"attachable"`
+	EnableIPv6 bool               `json:"enableIPv6"`
+	Subnets    []networkSubnet    `json:"subnets"`
+	Labels     map[string]string  `json:"labels"`
+	Options    map[string]string  `json:"options"`
+	Containers []networkContainer `json:"containers"`
+	IsSelected bool               `json:"isSelected"`
+}
+
+type networkSubnet struct {
+	Subnet  string `json:"subnet"`
+	Gateway string `json:"gateway,omitempty"`
+	IPRange string `json:"ipRange,omitempty"`
+}
+
+// networkContainer is a container attached to a network and its addresses there.
+type networkContainer struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	IPv4Address string `json:"ipv4Address,omitempty"`
+	IPv6Address string `json:"ipv6Address,omitempty"`
+	MacAddress  string `json:"macAddress,omitempty"`
+}
+
+func toLocalNetwork(n types.NetworkResource) localNetwork {
+	ln := localNetwork{
+		ID:         n.ID,
+		Name:       n.Name,
+		Driver:     n.Driver,
+		Scope:      n.Scope,
+		Internal:   n.Internal,
+		Attachable: n.Attachable,
+		EnableIPv6: n.EnableIPv6,
+		Subnets:    []networkSubnet{},
+		Labels:     n.Labels,
+		Options:    n.Options,
+		Containers: []networkContainer{},
+	}
+	for _, c := range n.IPAM.Config {
+		ln.Subnets = append(ln.Subnets, networkSubnet{Subnet: c.Subnet, Gateway: c.Gateway, IPRange: c.IPRange})
+	}
+	if ln.Labels == nil {
+		ln.Labels = map[string]string{}
+	}
+	if ln.Options == nil {
+		ln.Options = map[string]string{}
+	}
+	for id, ep := range n.Containers {
+		ln.Containers = append(ln.Containers, networkContainer{ID: id, Name: ep.Name, IPv4Address: ep.IPv4Address, IPv6Address: ep.IPv6Address, MacAddress: ep.MacAddress})
+	}
+	sort.Slice(ln.Containers, func(i, j int) bool { return ln.Containers[i].Name < ln.Containers[j].Name })
+	return ln
+}
+
+// userNetworks returns the user-defined networks on this host, keyed by
+// name, fully inspected so their attached containers are included. The
+// replication plan takes the networks it creates on destinations from here.
+func userNetworks(ctx context.Context, cli *client.Client) (map[string]types.NetworkResource, error) {
+	list, err := cli.NetworkList(ctx, types.NetworkListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list networks: %w", err)
+	}
+	networks := make(map[string]types.NetworkResource)
+	for _, n := range list {
+		if isPredefinedNetwork(n.Name) {
+			continue
+		}
+		// The list leaves out attached containers
+		full, err := cli.NetworkInspect(ctx, n.ID, types.NetworkInspectOptions{})
+		if err != nil {
+			if client.IsErrNotFound(err) {
+				continue // removed since it was listed
+			}
+			return nil, fmt.Errorf("unable to inspect network %s: %w", n.Name, err)
+		}
+		networks[full.Name] = full
+	}
+	return networks, nil
+}
+
+// handleNetworks lists the user-defined networks on this host with their
+// subnets, attached containers and selection state, sorted by name.
+func (s *Server) handleNetworks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	cli, err := newDockerClient(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to create docker client", "err", err)
+		writeError(w, r, "Unable to create docker client", err)
+		return
+	}
+	defer cli.Close()
+
+	networks, err := userNetworks(r.Context(), cli)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to list networks", "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	selected, err := s.store.GetSelectedNetworks()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to get selected networks", "err", err)
+		writeError(w, r, "Unable to get selected networks", err)
+		return
+	}
+	out := make([]localNetwork, 0, len(networks))
+	for _, n := range networks {
+		ln := toLocalNetwork(n)
+		ln.IsSelected = selected[n.Name]
+		out = append(out, ln)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+// handleNetwork returns one network, by name or ID, including the
+// predefined ones.
+func (s *Server) handleNetwork(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	cli, err := newDockerClient(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to create docker client", "err", err)
+		writeError(w, r, "Unable to create docker client", err)
+		return
+	}
+	defer cli.Close()
+
+	n, err := cli.NetworkInspect(r.Context(), r.PathValue("name"), types.NetworkInspectOptions{})
+	if err != nil {
+		status := http.StatusInternalServerError
+		if client.IsErrNotFound(err) {
+			status = http.StatusNotFound
+		}
+		http.Error(w, fmt.Sprintf("Unable to inspect network: %s", err), status)
+		return
+	}
+	selected, err := s.store.GetSelectedNetworks()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to get selected networks", "err", err)
+		writeError(w, r, "Unable to get selected networks", err)
+		return
+	}
+	ln := toLocalNetwork(n)
+	ln.IsSelected = selected[n.Name]
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ln)
+}
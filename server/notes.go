@@ -0,0 +1,112 @@
+package server
+
+import (
+	"crypto/rand"
+	"dockerap/store"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+// newJobID returns an identifier for a replication run that notes and tags can refer to.
+func newJobID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// handleNotes lists (GET ?type=&id=&q=), adds (POST), and deletes (DELETE ?id=) operator notes.
+func (s *Server) handleNotes(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		notes, err := s.store.GetNotes(store.NoteFilter{TargetType: q.Get("type"), TargetID: q.Get("id"), Query: q.Get("q")})
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Unable to get notes", "err", err)
+			writeError(w, r, "Unable to get notes", err)
+			return
+		}
+		if notes == nil {
+			notes = []store.Note{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(notes)
+
+	case http.MethodPost:
+		var note store.Note
+		if err := json.NewDecoder(r.Body).Decode(&note); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		id, err := s.store.AddNote(note)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": "success", "id": id})
+
+	case http.MethodDelete:
+		id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "id must be a note ID", http.StatusBadRequest)
+			return
+		}
+		if err := s.store.DeleteNote(id); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+
+	default:
+		http.Error(w, "Only GET, POST and DELETE methods are allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleTags lists tags (GET ?type=), finds tagged targets (GET ?tag=), and
+// replaces a target's tags (POST).
+func (s *Server) handleTags(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		var result interface{}
+		var err error
+		if tag := r.URL.Query().Get("tag"); tag != "" {
+			var targets []store.Target
+			targets, err = s.store.FindTagged(tag)
+			if targets == nil {
+				targets = []store.Target{}
+			}
+			result = targets
+		} else {
+			result, err = s.store.GetTags(r.URL.Query().Get("type"))
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Unable to get tags", "err", err)
+			writeError(w, r, "Unable to get tags", err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+
+	case http.MethodPost:
+		var payload struct {
+			TargetType string   `json:"targetType"`
+			TargetID   string   `json:"targetId"`
+			Tags       []string `json:"tags"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if err := s.store.SetTags(payload.TargetType, payload.TargetID, payload.Tags); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+
+	default:
+		http.Error(w, "Only GET and POST methods are allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,16 @@
+package server
+
+import (
+	"dockerap/apiclient"
+	"net/http"
+)
+
+// handleOpenAPI serves the OpenAPI document for the destination and job APIs.
+func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(apiclient.OpenAPI)
+}
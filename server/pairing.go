@@ -0,0 +1,285 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"dockerap/apiclient"
+	"dockerap/store"
+	"dockerap/version"
+	"encoding/base32"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// pairingCodeTTL is how long a pairing code can be exchanged.
+const pairingCodeTTL = 10 * time.Minute
+
+// pairingCodes are the one-time codes this instance has handed out and not
+// yet seen exchanged. They live in memory, so a restart voids them.
+type pairingCodes struct {
+	mu      sync.Mutex
+	expires map[string]time.Time
+}
+
+// issue returns a new code, formatted XXXX-XXXX for reading out.
+func (p *pairingCodes) issue() (string, time.Time, error) {
+	b := make([]byte, 5)
+	if _, err := rand.Read(b); err != nil {
+		return "", time.Time{}, err
+	}
+	raw := base32.StdEncoding.EncodeToString(b)
+	code := raw[:4] + "-" + raw[4:]
+	expires := time.Now().Add(pairingCodeTTL)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.expires == nil {
+		p.expires = make(map[string]time.Time)
+	}
+	for c, exp := range p.expires {
+		if time.Now().After(exp) {
+			delete(p.expires, c)
+		}
+	}
+	p.expires[code] = expires
+	return code, expires, nil
+}
+
+// redeem reports whether code is valid and voids it.
+func (p *pairingCodes) redeem(code string) bool {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for c, exp := range p.expires {
+		if subtle.ConstantTimeCompare([]byte(c), []byte(code)) == 1 {
+			delete(p.expires, c)
+			return time.Now().Before(exp)
+		}
+	}
+	return false
+}
+
+// handlePairingCodes hands out a one-time code that a source exchanges at
+// /api/v1/pair for a token of its own.
+func (s *Server) handlePairingCodes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	code, expires, err := s.pairing.issue()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to generate pairing code", "err", err)
+		writeError(w, r, "Unable to generate pairing code", err)
+		return
+	}
+	p, _ := principalFrom(r.Context())
+	entry := store.AuditEntry{Actor: p.User, RemoteAddr: r.RemoteAddr, Action: "pairing-code", Outcome: "succeeded"}
+	if auditErr := s.store.RecordAudit(entry); auditErr != nil {
+		slog.ErrorContext(r.Context(), "Unable to record audit entry", "action", entry.Action, "err", auditErr)
+	}
+	slog.InfoContext(r.Context(), "Issued pairing code", "expires", expires)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"code": code, "expiresAt": expires.UTC()})
+}
+
+// handlePeerPair is the destination side of pairing: a valid code buys a
+// long-lived token for the destination API and a description of this host.
+// It is the one destination endpoint that takes no token.
+func (s *Server) handlePeerPair(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.cfg.ClientCAs != nil && (r.TLS == nil || len(r.TLS.VerifiedChains) == 0) {
+		http.Error(w, "A valid client certificate is required", http.StatusUnauthorized)
+		return
+	}
+	var req apiclient.PairRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	entry := store.AuditEntry{Actor: req.Name, RemoteAddr: r.RemoteAddr, Action: "pair", Outcome: "failed"}
+	defer func() {
+		if auditErr := s.store.RecordAudit(entry); auditErr != nil {
+			slog.ErrorContext(r.Context(), "Unable to record audit entry", "action", entry.Action, "err", auditErr)
+		}
+	}()
+	if !s.pairing.redeem(req.Code) {
+		slog.WarnContext(r.Context(), "Rejected pairing with an invalid code", "remote_addr", r.RemoteAddr)
+		entry.Detail = "invalid or expired code"
+		http.Error(w, "Invalid or expired pairing code", http.StatusUnauthorized)
+		return
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		entry.Detail = err.Error()
+		writeError(w, r, "Unable to generate token", err)
+		return
+	}
+	token := hex.EncodeToString(b)
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = r.RemoteAddr
+	}
+	if err := s.store.CreatePeerToken(name, r.RemoteAddr, token); err != nil {
+		slog.ErrorContext(r.Context(), "Unable to store peer token", "err", err)
+		entry.Detail = err.Error()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	entry.Outcome = "succeeded"
+	slog.InfoContext(r.Context(), "Paired with source", "name", name, "remote_addr", r.RemoteAddr)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(apiclient.PairResponse{Token: token, Capabilities: readCapabilities(r.Context())})
+}
+
+// readCapabilities describes this host for a pairing source. The free space
+// is that of Docker's data directory, which is only known when it is mounted
+// into this container at the same path.
+func readCapabilities(ctx context.Context) apiclient.Capabilities {
+	caps := apiclient.Capabilities{Version: version.Version}
+	cli, err := newDockerClient(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "Unable to create docker client", "err", err)
+		return caps
+	}
+	defer cli.Close()
+	info, err := cli.Info(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "Unable to get Docker info", "err", err)
+		return caps
+	}
+	caps.Architecture = info.Architecture
+	var fs syscall.Statfs_t
+	if info.DockerRootDir != "" && syscall.Statfs(info.DockerRootDir, &fs) == nil {
+		caps.DiskAvailable = int64(fs.Bavail) * int64(fs.Bsize)
+	}
+	return caps
+}
+
+// pairRequest is the body of /api/pair: where the destination is, the code
+// it showed, and the settings to store it under.
+type pairRequest struct {
+	destinationInput
+	Code string `json:"code"`
+}
+
+// handlePair is the source side of pairing. It exchanges the code with the
+// destination and stores the destination with the token and capabilities it
+// returned, replacing any destination of the same name.
+func (s *Server) handlePair(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var payload pairRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(payload.Code) == "" {
+		http.Error(w, "Missing pairing code", http.StatusBadRequest)
+		return
+	}
+	d, err := payload.destination()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The API token is not sent: the destination may not share it
+	httpClient := &http.Client{Transport: &requestIDTransport{base: s.destinationTLSTransport(&d)}, Timeout: 30 * time.Second}
+	resp, err := apiclient.New(d.URL, httpClient).Pair(r.Context(), apiclient.PairRequest{Code: payload.Code, Name: s.sourceHostAddress(r, "")})
+	p, _ := principalFrom(r.Context())
+	entry := store.AuditEntry{Actor: p.User, RemoteAddr: r.RemoteAddr, Action: "pair", Target: d.Name, Outcome: "failed"}
+	defer func() {
+		if auditErr := s.store.RecordAudit(entry); auditErr != nil {
+			slog.ErrorContext(r.Context(), "Unable to record audit entry", "action", entry.Action, "err", auditErr)
+		}
+	}()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to pair with destination", "dest", d.URL, "err", err)
+		entry.Detail = err.Error()
+		status := http.StatusBadGateway
+		var apiErr *apiclient.Error
+		if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusUnauthorized {
+			status = http.StatusUnauthorized
+		}
+		http.Error(w, fmt.Sprintf("Unable to pair with %s: %s", d.URL, err), status)
+		return
+	}
+
+	d.AuthToken = resp.Token
+	d.Capabilities = store.DestinationCapabilities(resp.Capabilities)
+	if err := s.store.PairDestination(d); err != nil {
+		entry.Detail = err.Error()
+		status := http.StatusInternalServerError
+		if errors.Is(err, store.ErrDestinationExists) {
+			status = http.StatusConflict
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	s.destTransports.reset()
+	entry.Outcome = "succeeded"
+	entry.Detail = fmt.Sprintf("%s, version %s, %s", d.URL, resp.Capabilities.Version, resp.Capabilities.Architecture)
+	slog.InfoContext(r.Context(), "Paired with destination", "name", d.Name, "url", d.URL, "version", resp.Capabilities.Version, "architecture", resp.Capabilities.Architecture)
+	s.writeDestination(w, r, d.Name, http.StatusOK)
+}
+
+// handlePeerTokens lists the tokens sources received by pairing with this
+// instance and revokes them by ID.
+func (s *Server) handlePeerTokens(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		tokens, err := s.store.GetPeerTokens()
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Unable to get peer tokens", "err", err)
+			writeError(w, r, "Unable to get peer tokens", err)
+			return
+		}
+		if tokens == nil {
+			tokens = []store.PeerToken{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(tokens)
+
+	case http.MethodDelete:
+		id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid id", http.StatusBadRequest)
+			return
+		}
+		if err := s.store.DeletePeerToken(id); err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, store.ErrPeerTokenNotFound) {
+				status = http.StatusNotFound
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		p, _ := principalFrom(r.Context())
+		entry := store.AuditEntry{Actor: p.User, RemoteAddr: r.RemoteAddr, Action: "revoke-peer-token", Target: strconv.FormatInt(id, 10), Outcome: "succeeded"}
+		if auditErr := s.store.RecordAudit(entry); auditErr != nil {
+			slog.ErrorContext(r.Context(), "Unable to record audit entry", "action", entry.Action, "err", auditErr)
+		}
+		w.WriteHeader(http.StatusOK)
+
+	default:
+		http.Error(w, "Only GET and DELETE methods are allowed", http.StatusMethodNotAllowed)
+	}
+}
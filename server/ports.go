@@ -0,0 +1,167 @@
+package server
+
+import (
+	"context"
+	"dockerap/apiclient"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/docker/go-connections/nat"
+)
+
+// Port remapping strategies for published ports on the destination.
+const (
+	PortRemapNone   = "none"
+	PortRemapOffset = "offset" // add a fixed offset to every published host port
+	PortRemapMap    = "map"    // explicit source host port -> destination host port
+)
+
+// portRemap rewrites the host side of published ports so replicas do not
+// collide with ports already in use on the destination.
+type portRemap struct {
+	Strategy string            `json:"strategy"`
+	Offset   int               `json:"offset"`
+	Map      map[string]string `json:"map"` // "8080" or "8080/tcp" -> "18080"
+}
+
+// validate checks the remap settings.
+func (p *portRemap) validate() error {
+	if p == nil {
+		return nil
+	}
+	switch p.Strategy {
+	case "", PortRemapNone:
+	case PortRemapOffset:
+		if p.Offset == 0 {
+			return fmt.Errorf("port offset must be non-zero")
+		}
+	case PortRemapMap:
+		for from, to := range p.Map {
+			if _, err := strconv.Atoi(strings.Split(from, "/")[0]); err != nil {
+				return fmt.Errorf("invalid source port %q", from)
+			}
+			if n, err := strconv.Atoi(to); err != nil || n <= 0 || n > 65535 {
+				return fmt.Errorf("invalid destination port %q for %s", to, from)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown port remap strategy: %s", p.Strategy)
+	}
+	return nil
+}
+
+// hostPort returns the destination host port for a published source port.
+func (p *portRemap) hostPort(hostPort string, proto string) (string, error) {
+	if p == nil || hostPort == "" {
+		return hostPort, nil
+	}
+	switch p.Strategy {
+	case PortRemapOffset:
+		n, err := strconv.Atoi(hostPort)
+		if err != nil {
+			// Ranges and dynamic ports are left alone
+			return hostPort, nil
+		}
+		if n+p.Offset <= 0 || n+p.Offset > 65535 {
+			return "", fmt.Errorf("port %d with offset %d is out of range", n, p.Offset)
+		}
+		return strconv.Itoa(n + p.Offset), nil
+	case PortRemapMap:
+		if to, ok := p.Map[hostPort+"/"+proto]; ok {
+			return to, nil
+		}
+		if to, ok := p.Map[hostPort]; ok {
+			return to, nil
+		}
+	}
+	return hostPort, nil
+}
+
+// applyPortRemap rewrites the published ports of every planned container.
+func applyPortRemap(plan *replicationPlan, remap *portRemap) error {
+	if remap == nil || remap.Strategy == "" || remap.Strategy == PortRemapNone {
+		return nil
+	}
+	for i := range plan.Containers {
+		pc := &plan.Containers[i]
+		if pc.Inspect.HostConfig == nil || len(pc.Inspect.HostConfig.PortBindings) == 0 {
+			continue
+		}
+		hc := *pc.Inspect.HostConfig
+		hc.PortBindings = make(nat.PortMap, len(pc.Inspect.HostConfig.PortBindings))
+		for port, bindings := range pc.Inspect.HostConfig.PortBindings {
+			remapped := make([]nat.PortBinding, len(bindings))
+			for j, b := range bindings {
+				hostPort, err := remap.hostPort(b.HostPort, port.Proto())
+				if err != nil {
+					return fmt.Errorf("container %s: %w", containerName(pc.Inspect), err)
+				}
+				remapped[j] = nat.PortBinding{HostIP: b.HostIP, HostPort: hostPort}
+			}
+			hc.PortBindings[port] = remapped
+		}
+		// The plan owns its inspect data, so every destination gets the new bindings
+		pc.Inspect.HostConfig = &hc
+	}
+	return nil
+}
+
+// plannedPorts lists the host ports the planned containers will publish, as "port/proto".
+func plannedPorts(plan *replicationPlan) []string {
+	seen := make(map[string]bool)
+	for _, pc := range plan.Containers {
+		if pc.Inspect.HostConfig == nil {
+			continue
+		}
+		for port, bindings := range pc.Inspect.HostConfig.PortBindings {
+			for _, b := range bindings {
+				if b.HostPort != "" {
+					seen[b.HostPort+"/"+port.Proto()] = true
+				}
+			}
+		}
+	}
+	ports := make([]string, 0, len(seen))
+	for p := range seen {
+		ports = append(ports, p)
+	}
+	sort.Strings(ports)
+	return ports
+}
+
+// portChecks reports, for each requested "port/proto", whether a running
+// container on this host already publishes it.
+func portChecks(ctx context.Context, cli *client.Client, requested []string) ([]apiclient.CheckItem, error) {
+	containers, err := cli.ContainerList(ctx, container.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	used := make(map[string]string)
+	for _, c := range containers {
+		name := c.ID[:12]
+		if len(c.Names) > 0 {
+			name = strings.TrimPrefix(c.Names[0], "/")
+		}
+		for _, p := range c.Ports {
+			if p.PublicPort != 0 {
+				used[fmt.Sprintf("%d/%s", p.PublicPort, p.Type)] = name
+			}
+		}
+	}
+
+	var items []apiclient.CheckItem
+	for _, port := range requested {
+		item := apiclient.CheckItem{Name: "host port " + port, Status: CheckPass, Detail: "free"}
+		if owner, ok := used[port]; ok {
+			item.Status = CheckFail
+			item.Detail = "already published by " + owner
+			item.Hint = "replicate with a port remap (offset or explicit map), or move " + owner
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/go-connections/nat"
+)
+
+// plannedWithPorts returns a plan with one container publishing bindings.
+func plannedWithPorts(bindings nat.PortMap) *replicationPlan {
+	var pc plannedContainer
+	pc.Inspect.ContainerJSONBase = &types.ContainerJSONBase{ID: "dns1", Name: "/dns", HostConfig: &container.HostConfig{PortBindings: bindings}}
+	return &replicationPlan{Containers: []plannedContainer{pc}}
+}
+
+func TestApplyPortRemap(t *testing.T) {
+	bindings := nat.PortMap{
+		"53/tcp":        {{HostPort: "53"}},
+		"53/udp":        {{HostIP: "127.0.0.1", HostPort: "53"}},
+		"8000-8010/tcp": {{HostPort: "8000-8010"}},
+		"9000/tcp":      {{HostPort: ""}},
+	}
+	tests := []struct {
+		name  string
+		remap *portRemap
+		want  nat.PortMap
+		err   string
+	}{
+		{"none", &portRemap{Strategy: PortRemapNone}, bindings, ""},
+		{"offset", &portRemap{Strategy: PortRemapOffset, Offset: 10000}, nat.PortMap{
+			"53/tcp":        {{HostPort: "10053"}},
+			"53/udp":        {{HostIP: "127.0.0.1", HostPort: "10053"}},
+			"8000-8010/tcp": {{HostPort: "8000-8010"}},
+			"9000/tcp":      {{HostPort: ""}},
+		}, ""},
+		{"offset out of range", &portRemap{Strategy: PortRemapOffset, Offset: 65500}, nil, "container dns: port 53 with offset 65500 is out of range"},
+		{"map by protocol", &portRemap{Strategy: PortRemapMap, Map: map[string]string{"53/udp": "5353", "53": "1053"}}, nat.PortMap{
+			"53/tcp":        {{HostPort: "1053"}},
+			"53/udp":        {{HostIP: "127.0.0.1", HostPort: "5353"}},
+			"8000-8010/tcp": {{HostPort: "8000-8010"}},
+			"9000/tcp":      {{HostPort: ""}},
+		}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := plannedWithPorts(bindings)
+			err := applyPortRemap(plan, tt.remap)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Errorf("err = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(plan.Containers[0].Inspect.HostConfig.PortBindings, tt.want) {
+				t.Errorf("bindings = %v, want %v", plan.Containers[0].Inspect.HostConfig.PortBindings, tt.want)
+			}
+		})
+	}
+}
+
+func TestPortRemapValidate(t *testing.T) {
+	tests := []struct {
+		remap *portRemap
+		ok    bool
+	}{
+		{nil, true},
+		{&portRemap{Strategy: PortRemapOffset, Offset: 0}, false},
+		{&portRemap{Strategy: PortRemapMap, Map: map[string]string{"53/udp": "5353"}}, true},
+		{&portRemap{Strategy: PortRemapMap, Map: map[string]string{"dns": "5353"}}, false},
+		{&portRemap{Strategy: PortRemapMap, Map: map[string]string{"53": "70000"}}, false},
+		// A range can't be a map key, as hostPort looks ports up one by one
+		{&portRemap{Strategy: PortRemapMap, Map: map[string]string{"8000-8010": "18000"}}, false},
+		{&portRemap{Strategy: "shift"}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.remap.validate(); (err == nil) != tt.ok {
+			t.Errorf("validate(%+v) = %v, want ok %t", tt.remap, err, tt.ok)
+		}
+	}
+}
+
+func TestPortChecks(t *testing.T) {
+	cli := fakeContainerList(t, []types.Container{
+		{ID: "0123456789abcdef", Names: []string{"/unbound"}, Ports: []types.Port{{PrivatePort: 53, PublicPort: 53, Type: "udp"}}},
+		{ID: "fedcba9876543210", Ports: []types.Port{{PrivatePort: 80, PublicPort: 8080, Type: "tcp"}, {PrivatePort: 9000, Type: "tcp"}}},
+	})
+
+	plan := plannedWithPorts(nat.PortMap{
+		"53/tcp":   {{HostPort: "53"}},
+		"53/udp":   {{HostPort: "53"}},
+		"80/tcp":   {{HostPort: "8080"}},
+		"9000/tcp": {{HostPort: "9000"}},
+	})
+	requested := plannedPorts(plan)
+	if got := strings.Join(requested, " "); got != "53/tcp 53/udp 8080/tcp 9000/tcp" {
+		t.Fatalf("planned ports = %s", got)
+	}
+
+	items, err := portChecks(t.Context(), cli, requested)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"host port 53/tcp":   "free",
+		"host port 53/udp":   "already published by unbound",
+		"host port 8080/tcp": "already published by fedcba987654",
+		"host port 9000/tcp": "free",
+	}
+	for _, item := range items {
+		if item.Detail != want[item.Name] {
+			t.Errorf("%s: %s, want %s", item.Name, item.Detail, want[item.Name])
+		}
+		if taken := item.Status == CheckFail; taken != strings.HasPrefix(want[item.Name], "already") {
+			t.Errorf("%s: status %s", item.Name, item.Status)
+		}
+	}
+	if len(items) != len(want) {
+		t.Errorf("%d checks, want %d", len(items), len(want))
+	}
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// readinessTimeout bounds each dependency check so a hung daemon or locked
+// database fails the probe instead of stalling it.
+const readinessTimeout = 3 * time.Second
+
+// readiness is the body returned by /readyz.
+type readiness struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+// isProbe reports whether path is one of the health endpoints.
+func isProbe(path string) bool {
+	return path == "/healthz" || path == "/readyz"
+}
+
+// handleHealthz reports that the process is up and serving HTTP. It touches
+// nothing else, so it is safe for liveness probes.
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("ok\n"))
+}
+
+// handleReadyz reports whether this instance can do useful work: the Docker
+// daemon answers a ping and the database is reachable. Any failing check
+// turns the response into a 503.
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	res := readiness{Status: "ok", Checks: map[string]string{}}
+	check := func(name string, err error) {
+		if err != nil {
+			slog.WarnContext(ctx, "Readiness check failed", "check", name, "err", err)
+			res.Status = "unavailable"
+			res.Checks[name] = err.Error()
+			return
+		}
+		res.Checks[name] = "ok"
+	}
+	check("docker", pingDocker(ctx))
+	check("database", s.store.Ping(ctx))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if res.Status != "ok" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(res)
+}
+
+// pingDocker checks that the local Docker daemon responds.
+func pingDocker(ctx context.Context) error {
+	cli, err := newDockerClient(ctx)
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+	_, err = cli.Ping(ctx)
+	return err
+}
@@ -0,0 +1,182 @@
+package server
+
+import (
+	"dockerap/logging"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+)
+
+// problemContentType is the media type of RFC 7807 error responses.
+const problemContentType = "application/problem+json"
+
+// Error codes carried in problem responses, so the UI and peers can react to
+// an error without parsing its text.
+const (
+	codeInvalidRequest       = "invalid_request"
+	codeUnauthorized         = "unauthorized"
+	codeForbidden            = "forbidden"
+	codeNotFound             = "not_found"
+	codeMethodNotAllowed     = "method_not_allowed"
+	codeConflict             = "conflict"
+	codeTooLarge             = "too_large"
+	codeRateLimited          = "rate_limited"
+	codeInternal             = "internal_error"
+	codeUnavailable          = "unavailable"
+	codeCSRFInvalid          = "csrf_invalid"
+	codeConfirmationRequired = "confirmation_required"
+	codePolicyDenied         = "policy_denied"
+	codeDockerUnreachable    = "docker_unreachable"
+	codeImagePullFailed      = "image_pull_failed"
+)
+
+// problem is an RFC 7807 error response. Code is an extension member naming
+// the error, one of the code constants.
+type problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	Code      string `json:"code"`
+	RequestID string `json:"requestId,omitempty"`
+}
+
+// statusCode is the code of an error that only has a status to go by.
+func statusCode(status int) string {
+	switch status {
+	case http.StatusUnauthorized:
+		return codeUnauthorized
+	case http.StatusForbidden:
+		return codeForbidden
+	case http.StatusNotFound:
+		return codeNotFound
+	case http.StatusMethodNotAllowed:
+		return codeMethodNotAllowed
+	case http.StatusConflict:
+		return codeConflict
+	case http.StatusRequestEntityTooLarge:
+		return codeTooLarge
+	case http.StatusTooManyRequests:
+		return codeRateLimited
+	case http.StatusServiceUnavailable:
+		return codeUnavailable
+	}
+	if status < 500 {
+		return codeInvalidRequest
+	}
+	return codeInternal
+}
+
+// writeProblem answers with a problem+json error. An empty code is taken
+// from the status. Pages, which browsers show as they are, get the detail as
+// plain text instead.
+func writeProblem(w http.ResponseWriter, r *http.Request, status int, code, detail string) {
+	if !isAPIPath(r.URL.Path) {
+		http.Error(w, detail, status)
+		return
+	}
+	if code == "" {
+		code = statusCode(status)
+	}
+	h := w.Header()
+	h.Del("Content-Length")
+	h.Set("Content-Type", problemContentType)
+	h.Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    detail,
+		Instance:  r.URL.Path,
+		Code:      code,
+		RequestID: logging.RequestID(r.Context()),
+	})
+}
+
+// writeError answers with msg and err as a problem, its status and code
+// taken from err: a Docker daemon that cannot be reached is 503
+// docker_unreachable, and Docker's not found, conflict and invalid
+// parameter errors keep their meaning. Anything else is a 500.
+func writeError(w http.ResponseWriter, r *http.Request, msg string, err error) {
+	status, code := http.StatusInternalServerError, codeInternal
+	switch {
+	case client.IsErrConnectionFailed(err):
+		status, code = http.StatusServiceUnavailable, codeDockerUnreachable
+	case errdefs.IsNotFound(err):
+		status, code = http.StatusNotFound, codeNotFound
+	case errdefs.IsConflict(err):
+		status, code = http.StatusConflict, codeConflict
+	case errdefs.IsInvalidParameter(err):
+		status, code = http.StatusBadRequest, codeInvalidRequest
+	}
+	writeProblem(w, r, status, code, msg+": "+err.Error())
+}
+
+// isAPIPath reports whether path is answered with JSON, and so with
+// problem+json errors, rather than with a page.
+func isAPIPath(path string) bool {
+	return strings.HasPrefix(path, "/api/") || path == "/replicate" || path == "/select"
+}
+
+// problemWriter turns the plain text errors of http.Error into problems.
+// Handlers that know a more specific code call writeProblem themselves.
+type problemWriter struct {
+	http.ResponseWriter
+	r      *http.Request
+	status int // of a plain text error being held back, 0 otherwise
+	detail []byte
+}
+
+// maxProblemDetail bounds how much of a plain text error is kept.
+const maxProblemDetail = 4096
+
+func (pw *problemWriter) WriteHeader(status int) {
+	h := pw.Header()
+	if status >= 400 && pw.status == 0 && strings.HasPrefix(h.Get("Content-Type"), "text/plain") {
+		pw.status = status
+		return
+	}
+	pw.ResponseWriter.WriteHeader(status)
+}
+
+func (pw *problemWriter) Write(b []byte) (int, error) {
+	if pw.status == 0 {
+		return pw.ResponseWriter.Write(b)
+	}
+	if room := maxProblemDetail - len(pw.detail); room > 0 {
+		pw.detail = append(pw.detail, b[:min(len(b), room)]...)
+	}
+	return len(b), nil
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (pw *problemWriter) Unwrap() http.ResponseWriter {
+	return pw.ResponseWriter
+}
+
+// close sends the problem for a held back plain text error.
+func (pw *problemWriter) close() {
+	if pw.status == 0 {
+		return
+	}
+	writeProblem(pw.ResponseWriter, pw.r, pw.status, "", strings.TrimSpace(string(pw.detail)))
+}
+
+// problems answers errors from the API routes as RFC 7807 problem+json.
+// Pages, fragments and WebSocket upgrades keep their own error responses.
+func (s *Server) problems(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isAPIPath(r.URL.Path) || r.Header.Get("Upgrade") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		pw := &problemWriter{ResponseWriter: w, r: r}
+		defer pw.close()
+		next.ServeHTTP(pw, r)
+	})
+}
@@ -0,0 +1,210 @@
+package server
+
+import (
+	"context"
+	"dockerap/store"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+)
+
+// selection is a set of containers, volumes, networks, images and compose
+// projects to replicate.
+type selection struct {
+	Containers map[string]bool
+	Volumes    map[string]bool
+	Networks   map[string]bool
+	Images     map[string]bool
+	Projects   map[string]bool
+}
+
+// loadSelection returns the named profile's items, or the global selection
+// when profile is empty. The global selection's containers are those on the
+// named Docker host, which cli reaches; cli is not used for a profile.
+func (s *Server) loadSelection(ctx context.Context, cli *client.Client, host, profile string) (*selection, error) {
+	if profile != "" {
+		p, err := s.store.GetProfile(profile)
+		if err != nil {
+			return nil, err
+		}
+		return &selection{Containers: toSet(p.Containers), Volumes: toSet(p.Volumes), Networks: toSet(p.Networks), Images: toSet(p.Images), Projects: toSet(p.Projects)}, nil
+	}
+
+	sel := &selection{}
+	var err error
+	if sel.Containers, err = s.selectedContainers(ctx, cli, host); err != nil {
+		return nil, fmt.Errorf("unable to get selected containers: %w", err)
+	}
+	if sel.Volumes, err = s.store.GetSelectedVolumes(); err != nil {
+		return nil, fmt.Errorf("unable to get selected volumes: %w", err)
+	}
+	if sel.Networks, err = s.store.GetSelectedNetworks(); err != nil {
+		return nil, fmt.Errorf("unable to get selected networks: %w", err)
+	}
+	if sel.Images, err = s.store.GetSelectedImages(); err != nil {
+		return nil, fmt.Errorf("unable to get selected images: %w", err)
+	}
+	if sel.Projects, err = s.store.GetSelectedProjects(); err != nil {
+		return nil, fmt.Errorf("unable to get selected projects: %w", err)
+	}
+	return sel, nil
+}
+
+// selectionHost is the name selections on the named Docker host are stored
+// under: empty for the local daemon, however it was named.
+func selectionHost(name string) string {
+	if name == localHostName {
+		return ""
+	}
+	return name
+}
+
+// selectedContainers returns the IDs of the containers selected on the named
+// Docker host, which cli reaches, following those recreated since.
+func (s *Server) selectedContainers(ctx context.Context, cli *client.Client, host string) (map[string]bool, error) {
+	containers, err := cli.ContainerList(ctx, container.ListOptions{All: true})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list containers: %w", err)
+	}
+	return s.resolveSelectedContainers(host, containers)
+}
+
+// resolveSelectedContainers returns the IDs of the containers selected on
+// the named Docker host, given containers listed there.
+func (s *Server) resolveSelectedContainers(host string, containers []types.Container) (map[string]bool, error) {
+	return s.store.ResolveSelectedContainers(selectionHost(host), liveNames(containers))
+}
+
+// liveNames maps the IDs of listed containers to their names, empty for a
+// container without one.
+func liveNames(containers []types.Container) map[string]string {
+	live := make(map[string]string, len(containers))
+	for _, c := range containers {
+		live[c.ID] = ""
+		if len(c.Names) > 0 {
+			live[c.ID] = strings.TrimPrefix(c.Names[0], "/")
+		}
+	}
+	return live
+}
+
+// toSet turns a list into a set.
+func toSet(list []string) map[string]bool {
+	set := make(map[string]bool, len(list))
+	for _, v := range list {
+		set[v] = true
+	}
+	return set
+}
+
+// sortedKeys returns the keys of a set in order.
+func sortedKeys[V any](set map[string]V) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// handleProfiles lists, saves and deletes named replication profiles. A POST
+// with "fromSelection" saves the current global selection under the name.
+func (s *Server) handleProfiles(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		profiles, err := s.store.GetProfiles()
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Unable to get profiles", "err", err)
+			writeError(w, r, "Unable to get profiles", err)
+			return
+		}
+		if profiles == nil {
+			profiles = []store.Profile{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(profiles)
+
+	case http.MethodPost:
+		var payload struct {
+			store.Profile
+			FromSelection bool `json:"fromSelection"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if payload.Name == "" {
+			http.Error(w, "name is required", http.StatusBadRequest)
+			return
+		}
+		if payload.FromSelection {
+			cli, err := newDockerClient(r.Context())
+			if err != nil {
+				slog.ErrorContext(r.Context(), "Unable to create docker client", "err", err)
+				writeError(w, r, "Unable to create docker client", err)
+				return
+			}
+			defer cli.Close()
+			sel, err := s.loadSelection(r.Context(), cli, "", "")
+			if err != nil {
+				slog.ErrorContext(r.Context(), "Unable to load selection", "err", err)
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			payload.Containers = sortedKeys(sel.Containers)
+			payload.Volumes = sortedKeys(sel.Volumes)
+			payload.Networks = sortedKeys(sel.Networks)
+			payload.Images = sortedKeys(sel.Images)
+			payload.Projects = sortedKeys(sel.Projects)
+		}
+		for i, ref := range payload.Images {
+			norm, err := normalizeImageRef(ref)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Invalid image reference %s: %s", ref, err), http.StatusBadRequest)
+				return
+			}
+			payload.Images[i] = norm
+		}
+		if err := s.store.SaveProfile(payload.Profile); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		slog.InfoContext(r.Context(), "Saved profile", "name", payload.Name, "containers", len(payload.Containers), "volumes", len(payload.Volumes), "networks", len(payload.Networks), "images", len(payload.Images), "projects", len(payload.Projects))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+
+	case http.MethodDelete:
+		name := r.URL.Query().Get("name")
+		if name == "" {
+			http.Error(w, "name is required", http.StatusBadRequest)
+			return
+		}
+		if err := s.store.DeleteProfile(name); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+
+	default:
+		http.Error(w, "Only GET, POST and DELETE methods are allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// writeSelectionError reports a failure to load the selection, with 404 for
+// an unknown profile.
+func writeSelectionError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, store.ErrProfileNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	slog.Error("Unable to build replication plan", "err", err)
+	writeError(w, r, "Unable to build replication plan", err)
+}
@@ -0,0 +1,159 @@
+package server
+
+import (
+	"dockerap/labels"
+	"dockerap/store"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/errdefs"
+)
+
+// pruneRequest is the body of POST /api/prune/{kind}.
+type pruneRequest struct {
+	All          bool         `json:"all"`   // images: unused as well as dangling; volumes: named as well as anonymous
+	Until        string       `json:"until"` // containers and images: only those created before this, e.g. 24h
+	Confirmation Confirmation `json:"confirmation"`
+}
+
+// pruneResult is what a prune removed.
+type pruneResult struct {
+	Kind           string   `json:"kind"`
+	Deleted        []string `json:"deleted"`
+	Untagged       []string `json:"untagged,omitempty"`
+	SpaceReclaimed uint64   `json:"spaceReclaimed"` // bytes
+}
+
+// pruneFilters returns the Docker filters for a prune of kind. Containers
+// and volumes DockerApp created as replicas carry the source host label and
+// are always excluded, so a standby can be cleaned up without losing them.
+// Images still used by a replica, even a stopped one, are never pruned.
+func pruneFilters(kind string, req pruneRequest) (filters.Args, error) {
+	args := filters.NewArgs()
+	switch kind {
+	case "containers":
+		args.Add("label!", labels.SourceHost)
+	case "images":
+		if req.All {
+			args.Add("dangling", "false")
+		} else {
+			args.Add("dangling", "true")
+		}
+	case "volumes":
+		if req.Until != "" {
+			return args, fmt.Errorf("volumes cannot be pruned by age")
+		}
+		args.Add("label!", labels.SourceHost)
+		if req.All {
+			args.Add("all", "true")
+		}
+		return args, nil
+	default:
+		return args, fmt.Errorf("unknown prune kind %q, expected images, containers or volumes", kind)
+	}
+	if req.Until != "" {
+		args.Add("until", req.Until)
+	}
+	return args, nil
+}
+
+// handlePrune removes stopped containers, unused images or unused volumes
+// from this host, leaving DockerApp's replicas alone. Prune is a gated
+// operation, and each prune is recorded in the audit log.
+func (s *Server) handlePrune(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	kind := r.PathValue("kind")
+	var payload pruneRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+	args, err := pruneFilters(kind, payload)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	p, _ := principalFrom(r.Context())
+	if err := s.checkConfirmation(r, OpPrune, payload.Confirmation); err != nil {
+		writeProblem(w, r, http.StatusForbidden, codeConfirmationRequired, err.Error())
+		return
+	}
+
+	cli, err := newDockerClient(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to create docker client", "err", err)
+		writeError(w, r, "Unable to create docker client", err)
+		return
+	}
+	defer cli.Close()
+
+	res := pruneResult{Kind: kind, Deleted: []string{}}
+	switch kind {
+	case "containers":
+		rep, pruneErr := cli.ContainersPrune(r.Context(), args)
+		err = pruneErr
+		res.Deleted = append(res.Deleted, rep.ContainersDeleted...)
+		res.SpaceReclaimed = rep.SpaceReclaimed
+	case "images":
+		rep, pruneErr := cli.ImagesPrune(r.Context(), args)
+		err = pruneErr
+		for _, d := range rep.ImagesDeleted {
+			if d.Deleted != "" {
+				res.Deleted = append(res.Deleted, d.Deleted)
+			}
+			if d.Untagged != "" {
+				res.Untagged = append(res.Untagged, d.Untagged)
+			}
+		}
+		res.SpaceReclaimed = rep.SpaceReclaimed
+	case "volumes":
+		rep, pruneErr := cli.VolumesPrune(r.Context(), args)
+		err = pruneErr
+		res.Deleted = append(res.Deleted, rep.VolumesDeleted...)
+		res.SpaceReclaimed = rep.SpaceReclaimed
+	}
+
+	entry := store.AuditEntry{
+		Actor:      p.User,
+		RemoteAddr: r.RemoteAddr,
+		Action:     "prune:" + kind,
+		Outcome:    "succeeded",
+		Detail:     fmt.Sprintf("%d removed, %d bytes reclaimed", len(res.Deleted), res.SpaceReclaimed),
+	}
+	if payload.All {
+		entry.Target = "all"
+	}
+	if err != nil {
+		entry.Outcome = "failed"
+		entry.Detail = err.Error()
+	}
+	if auditErr := s.store.RecordAudit(entry); auditErr != nil {
+		slog.ErrorContext(r.Context(), "Unable to record audit entry", "action", entry.Action, "err", auditErr)
+	}
+
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to prune", "kind", kind, "err", err)
+		status := http.StatusInternalServerError
+		switch {
+		case errdefs.IsInvalidParameter(err):
+			status = http.StatusBadRequest
+		case errdefs.IsConflict(err):
+			status = http.StatusConflict // another prune is running
+		}
+		http.Error(w, fmt.Sprintf("Unable to prune %s: %s", kind, err), status)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Pruned", "kind", kind, "deleted", len(res.Deleted), "space_reclaimed", res.SpaceReclaimed)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
@@ -0,0 +1,148 @@
+package server
+
+import (
+	"context"
+	"dockerap/store"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+)
+
+// quiescer pauses or stops source containers while their volumes are read.
+// Replication to several destinations runs concurrently, so holds are
+// counted and the container is only resumed when the last copy finishes.
+type quiescer struct {
+	mu    sync.Mutex
+	holds map[string]*quiesceHold
+}
+
+type quiesceHold struct {
+	count int
+	mode  string
+	ready chan struct{} // closed once the first holder has quiesced the container
+	err   error
+	acted bool // whether the container was running and we changed its state
+}
+
+// acquire quiesces id according to mode, unless another copy already has.
+// Every successful acquire must be paired with release.
+func (q *quiescer) acquire(ctx context.Context, cli *client.Client, id, mode string) error {
+	q.mu.Lock()
+	if q.holds == nil {
+		q.holds = make(map[string]*quiesceHold)
+	}
+	if h, ok := q.holds[id]; ok {
+		h.count++
+		q.mu.Unlock()
+		<-h.ready
+		if h.err != nil {
+			q.release(context.Background(), cli, id)
+			return h.err
+		}
+		return nil
+	}
+	h := &quiesceHold{count: 1, mode: mode, ready: make(chan struct{})}
+	q.holds[id] = h
+	q.mu.Unlock()
+
+	h.acted, h.err = quiesce(ctx, cli, id, mode)
+	close(h.ready)
+	if h.err != nil {
+		q.release(context.Background(), cli, id)
+	}
+	return h.err
+}
+
+// release drops a hold and resumes the container when it was the last one.
+func (q *quiescer) release(ctx context.Context, cli *client.Client, id string) {
+	q.mu.Lock()
+	h, ok := q.holds[id]
+	if !ok {
+		q.mu.Unlock()
+		return
+	}
+	h.count--
+	if h.count > 0 {
+		q.mu.Unlock()
+		return
+	}
+	delete(q.holds, id)
+	q.mu.Unlock()
+
+	if h.err != nil || !h.acted {
+		return
+	}
+	var err error
+	switch h.mode {
+	case store.QuiescePause:
+		err = cli.ContainerUnpause(ctx, id)
+	case store.QuiesceStop:
+		err = cli.ContainerStart(ctx, id, container.StartOptions{})
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Unable to resume source container after copying its volumes", "id", id, "err", err)
+		return
+	}
+	slog.InfoContext(ctx, "Resumed source container", "id", id)
+}
+
+// quiesce pauses or stops a running container and reports whether it did.
+func quiesce(ctx context.Context, cli *client.Client, id, mode string) (bool, error) {
+	inspect, err := cli.ContainerInspect(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	if !inspect.State.Running || inspect.State.Paused {
+		return false, nil
+	}
+	switch mode {
+	case store.QuiescePause:
+		err = cli.ContainerPause(ctx, id)
+	case store.QuiesceStop:
+		err = cli.ContainerStop(ctx, id, container.StopOptions{})
+	default:
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("%s source container: %w", mode, err)
+	}
+	slog.InfoContext(ctx, "Quiesced source container for volume copy", "id", id, "mode", mode)
+	return true, nil
+}
+
+func (s *Server) handleQuiesce(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		modes, err := s.store.GetQuiesceModes()
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Unable to get quiesce modes", "err", err)
+			writeError(w, r, "Unable to get quiesce modes", err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(modes)
+
+	case http.MethodPost:
+		var payload struct {
+			ContainerID string `json:"containerId"`
+			Mode        string `json:"mode"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if err := s.store.SetQuiesceMode(payload.ContainerID, payload.Mode); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+
+	default:
+		http.Error(w, "Only GET and POST methods are allowed", http.StatusMethodNotAllowed)
+	}
+}
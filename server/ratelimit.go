@@ -0,0 +1,149 @@
+package server
+
+import (
+	"crypto/sha256"
+	"dockerap/config"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateLimiter is a set of token buckets, one per key, each refilled at rate
+// tokens per second up to burst.
+type rateLimiter struct {
+	rate  float64
+	burst float64
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	return &rateLimiter{rate: rate, burst: float64(burst), buckets: make(map[string]*bucket)}
+}
+
+// take spends a token from key's bucket. When it is empty, it returns false
+// and how long until the next token.
+func (l *rateLimiter) take(key string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Buckets idle long enough to have refilled are the same as new ones
+	if now.Sub(l.lastSweep) > time.Minute {
+		full := time.Duration(l.burst / l.rate * float64(time.Second))
+		for k, b := range l.buckets {
+			if now.Sub(b.last) > full {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// loadRateLimits reads RATE_LIMIT_PER_IP and RATE_LIMIT_PER_TOKEN, in
+// requests per second, and the RATE_LIMIT_BURST both allow.
+func loadRateLimits(v *config.Validator, cfg *Config) {
+	perIP := rateSetting(v, "RATE_LIMIT_PER_IP")
+	perToken := rateSetting(v, "RATE_LIMIT_PER_TOKEN")
+	burst := 0
+	if s := os.Getenv("RATE_LIMIT_BURST"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			v.Add("RATE_LIMIT_BURST", fmt.Sprintf("%q is not a positive whole number", s), "set how many requests a client may send at once, e.g. 20")
+		} else {
+			burst = n
+		}
+	}
+	burstFor := func(rate float64) int {
+		if burst > 0 {
+			return burst
+		}
+		return int(math.Max(1, math.Ceil(2*rate)))
+	}
+	if perIP > 0 {
+		cfg.IPLimiter = newRateLimiter(perIP, burstFor(perIP))
+	}
+	if perToken > 0 {
+		cfg.TokenLimiter = newRateLimiter(perToken, burstFor(perToken))
+	}
+}
+
+func rateSetting(v *config.Validator, key string) float64 {
+	s := os.Getenv(key)
+	if s == "" {
+		return 0
+	}
+	rate, err := strconv.ParseFloat(s, 64)
+	if err != nil || rate <= 0 || math.IsInf(rate, 0) {
+		v.Add(key, fmt.Sprintf("%q is not a positive number", s), "set the requests per second to allow, e.g. 10 or 0.5")
+		return 0
+	}
+	return rate
+}
+
+// rateLimit applies the per-IP and per-token limits to the /api/ routes,
+// answering 429 with a Retry-After once a client's bucket is empty.
+func (s *Server) rateLimit(next http.Handler) http.Handler {
+	if s.cfg.IPLimiter == nil && s.cfg.TokenLimiter == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		now := time.Now()
+		if s.cfg.IPLimiter != nil {
+			ip, _, err := net.SplitHostPort(r.RemoteAddr)
+			if err != nil {
+				ip = r.RemoteAddr
+			}
+			if ok, wait := s.cfg.IPLimiter.take(ip, now); !ok {
+				tooManyRequests(w, r, "client "+ip, wait)
+				return
+			}
+		}
+		if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && s.cfg.TokenLimiter != nil {
+			// Keyed by a hash so tokens are not kept in memory
+			sum := sha256.Sum256([]byte(token))
+			if ok, wait := s.cfg.TokenLimiter.take(hex.EncodeToString(sum[:8]), now); !ok {
+				tooManyRequests(w, r, "token", wait)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func tooManyRequests(w http.ResponseWriter, r *http.Request, who string, wait time.Duration) {
+	slog.WarnContext(r.Context(), "Rate limited", "method", r.Method, "path", r.URL.Path, "remote_addr", r.RemoteAddr, "limit", who)
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	writeProblem(w, r, http.StatusTooManyRequests, codeRateLimited, "Too many requests")
+}
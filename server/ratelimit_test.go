@@ -0,0 +1,98 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterTake(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	type step struct {
+		at   time.Duration // after start
+		key  string
+		ok   bool
+		wait time.Duration
+	}
+	tests := []struct {
+		name        string
+		rate        float64
+		burst       int
+		steps       []step
+		wantBuckets int
+	}{
+		{"burst then empty", 1, 2, []step{
+			{0, "a", true, 0},
+			{0, "a", true, 0},
+			{0, "a", false, time.Second},
+			{500 * time.Millisecond, "a", false, 500 * time.Millisecond},
+		}, 1},
+		{"refills at rate", 2, 1, []step{
+			{0, "a", true, 0},
+			{250 * time.Millisecond, "a", false, 250 * time.Millisecond},
+			{500 * time.Millisecond, "a", true, 0},
+			{500 * time.Millisecond, "a", false, 500 * time.Millisecond},
+		}, 1},
+		{"refills up to burst only", 1, 2, []step{
+			{0, "a", true, 0},
+			{0, "a", true, 0},
+			{30 * time.Second, "a", true, 0},
+			{30 * time.Second, "a", true, 0},
+			{30 * time.Second, "a", false, time.Second},
+		}, 1},
+		{"keys have their own buckets", 1, 1, []step{
+			{0, "a", true, 0},
+			{0, "b", true, 0},
+			{0, "a", false, time.Second},
+		}, 2},
+		{"idle buckets are swept", 0.05, 1, []step{
+			{0, "a", true, 0},
+			{50 * time.Second, "b", true, 0},
+			// a has had the 20s it takes to refill, b hasn't
+			{61 * time.Second, "c", true, 0},
+		}, 2},
+		{"a sweep doesn't refill a recent bucket", 0.01, 1, []step{
+			{0, "a", true, 0},
+			{61 * time.Second, "b", true, 0},
+			{61 * time.Second, "a", false, 39 * time.Second},
+		}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newRateLimiter(tt.rate, tt.burst)
+			l.lastSweep = start
+			for i, s := range tt.steps {
+				ok, wait := l.take(s.key, start.Add(s.at))
+				if ok != s.ok || (wait-s.wait).Abs() > time.Millisecond {
+					t.Errorf("step %d: take(%s) = %t, %s, want %t, %s", i, s.key, ok, wait, s.ok, s.wait)
+				}
+			}
+			if len(l.buckets) != tt.wantBuckets {
+				t.Errorf("%d buckets kept, want %d", len(l.buckets), tt.wantBuckets)
+			}
+		})
+	}
+}
+
+func TestTooManyRequestsRoundsRetryAfterUp(t *testing.T) {
+	tests := []struct {
+		wait time.Duration
+		want string
+	}{
+		{time.Millisecond, "1"},
+		{time.Second, "1"},
+		{1001 * time.Millisecond, "2"},
+		{39 * time.Second, "39"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		tooManyRequests(w, httptest.NewRequest(http.MethodGet, "/api/containers", nil), "client 10.0.0.1", tt.wait)
+		if w.Code != http.StatusTooManyRequests {
+			t.Errorf("wait %s: %d, want 429", tt.wait, w.Code)
+		}
+		if got := w.Header().Get("Retry-After"); got != tt.want {
+			t.Errorf("wait %s: Retry-After %s, want %s", tt.wait, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package server
+
+import (
+	"context"
+	"dockerap/apiclient"
+	"dockerap/labels"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/client"
+)
+
+// reconcileRequest is the body accepted by /api/reconcile.
+type reconcileRequest struct {
+	replicateRequest
+	DryRun bool `json:"dryRun"`
+}
+
+// handleReconcile removes replicas of this host's containers, volumes and
+// networks from each destination once they are no longer selected. Selected
+// containers that could not be planned are kept, so a temporary failure never
+// deletes a replica. Dry runs only report what would be removed.
+func (s *Server) handleReconcile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var payload reconcileRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	payload.SourceHostAddress = s.sourceHostAddress(r, payload.SourceHostAddress)
+	destinations, err := s.destinations(&payload.replicateRequest)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(destinations) == 0 || payload.SourceHostAddress == "" {
+		http.Error(w, "Destination and source host addresses cannot be empty", http.StatusBadRequest)
+		return
+	}
+	if err := payload.Rename.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !payload.DryRun {
+		if err := s.checkConfirmation(r, OpReconcile, payload.Confirmation); err != nil {
+			writeProblem(w, r, http.StatusForbidden, codeConfirmationRequired, err.Error())
+			return
+		}
+	}
+
+	srcCli, err := newDockerClient(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to create source docker client", "err", err)
+		writeError(w, r, "Unable to create source docker client", err)
+		return
+	}
+	defer srcCli.Close()
+
+	ctx := r.Context()
+	keep, err := s.keepSet(ctx, srcCli, payload.Rename)
+	if err != nil {
+		slog.ErrorContext(ctx, "Unable to resolve selection", "err", err)
+		writeError(w, r, "Unable to resolve selection", err)
+		return
+	}
+	keep.SourceHost = payload.SourceHostAddress
+	keep.DryRun = payload.DryRun
+
+	results := make([]apiclient.GCResult, len(destinations))
+	var wg sync.WaitGroup
+	for i, dest := range destinations {
+		wg.Add(1)
+		go func(i int, dest string) {
+			defer wg.Done()
+			httpClient := s.peerClient(dest)
+			res := apiclient.GCResult{DryRun: payload.DryRun}
+			if err := checkPeerAPI(ctx, httpClient, dest); err != nil {
+				res.Errors = append(res.Errors, err.Error())
+			} else if gc, err := apiclient.New(dest, httpClient).CollectGarbage(ctx, keep); err != nil {
+				res.Errors = append(res.Errors, err.Error())
+			} else {
+				res = *gc
+			}
+			res.Destination = dest
+			slog.InfoContext(ctx, "Reconciled", "dest", dest, "dry_run", payload.DryRun, "containers", len(res.Containers), "volumes", len(res.Volumes), "networks", len(res.Networks))
+			results[i] = res
+		}(i, dest)
+	}
+	wg.Wait()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+// keepSet resolves the current selection and every profile, including
+// compose projects, into the replicas a destination should keep.
+func (s *Server) keepSet(ctx context.Context, srcCli *client.Client, rename *nameRemap) (apiclient.GCRequest, error) {
+	keep := apiclient.GCRequest{KeepContainers: []string{}, KeepVolumes: []string{}, KeepNetworks: []string{}}
+	sel, err := s.loadSelection(ctx, srcCli, "", "")
+	if err != nil {
+		return keep, err
+	}
+	if err := s.addRuleMatches(ctx, srcCli, sel); err != nil {
+		return keep, err
+	}
+	containers, volumes, projects := sel.Containers, sel.Volumes, sel.Projects
+	profiles, err := s.store.GetProfiles()
+	if err != nil {
+		return keep, err
+	}
+	for _, p := range profiles {
+		for _, id := range p.Containers {
+			containers[id] = true
+		}
+		for _, v := range p.Volumes {
+			volumes[v] = true
+		}
+		for _, name := range p.Projects {
+			projects[name] = true
+		}
+		for _, name := range p.Networks {
+			sel.Networks[name] = true
+		}
+	}
+	networks, err := expandProjects(ctx, srcCli, projects, containers, volumes)
+	if err != nil {
+		return keep, err
+	}
+	networks = append(networks, sortedKeys(sel.Networks)...)
+
+	for id := range containers {
+		keep.KeepContainers = append(keep.KeepContainers, id)
+		inspect, err := srcCli.ContainerInspect(ctx, id)
+		if err != nil {
+			// The replica is still kept; only its networks are unknown
+			slog.WarnContext(ctx, "Failed to inspect selected container", "id", id, "err", err)
+			continue
+		}
+		// Selections made by short ID still match the full ID on the replica
+		keep.KeepContainers = append(keep.KeepContainers, inspect.ID)
+		for name := range inspect.NetworkSettings.Networks {
+			networks = append(networks, name)
+		}
+	}
+	for name := range volumes {
+		if rename != nil {
+			name = rename.volume(name)
+		}
+		keep.KeepVolumes = append(keep.KeepVolumes, name)
+	}
+	keep.KeepNetworks = append(keep.KeepNetworks, networks...)
+	return keep, nil
+}
+
+// Destination API: Remove replicas of a source that it no longer selects
+func (s *Server) handleGC(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var payload apiclient.GCRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if payload.SourceHost == "" {
+		http.Error(w, "sourceHost is required", http.StatusBadRequest)
+		return
+	}
+
+	cli, err := newDockerClient(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to create docker client", "err", err)
+		writeError(w, r, "Unable to create docker client", err)
+		return
+	}
+	defer cli.Close()
+
+	ctx := r.Context()
+	bySource := filters.NewArgs(filters.Arg("label", labels.SourceHost+"="+payload.SourceHost))
+	result := apiclient.GCResult{DryRun: payload.DryRun, Containers: []string{}, Volumes: []string{}, Networks: []string{}}
+
+	containers, err := cli.ContainerList(ctx, container.ListOptions{All: true,
+		Filters: filters.NewArgs(filters.Arg("label", labels.Replica+"=true"), filters.Arg("label", labels.SourceHost+"="+payload.SourceHost))})
+	if err != nil {
+		slog.ErrorContext(ctx, "Unable to list replicas", "err", err)
+		writeError(w, r, "Unable to list replicas", err)
+		return
+	}
+	for _, c := range unkept(containers, payload.KeepContainers, func(c types.Container) string { return c.Labels[labels.SourceID] }) {
+		name := containerListName(c)
+		if !payload.DryRun {
+			if err := cli.ContainerRemove(ctx, c.ID, container.RemoveOptions{Force: true, RemoveVolumes: true}); err != nil {
+				result.Errors = append(result.Errors, fmt.Sprintf("remove container %s: %s", name, err))
+				continue
+			}
+		}
+		result.Containers = append(result.Containers, name)
+	}
+
+	volumes, err := cli.VolumeList(ctx, volume.ListOptions{Filters: bySource})
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("list volumes: %s", err))
+	} else {
+		for _, v := range unkept(volumes.Volumes, payload.KeepVolumes, func(v *volume.Volume) string { return v.Name }) {
+			if !payload.DryRun {
+				if err := cli.VolumeRemove(ctx, v.Name, false); err != nil {
+					result.Errors = append(result.Errors, fmt.Sprintf("remove volume %s: %s", v.Name, err))
+					continue
+				}
+			}
+			result.Volumes = append(result.Volumes, v.Name)
+		}
+	}
+
+	networks, err := cli.NetworkList(ctx, types.NetworkListOptions{Filters: bySource})
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("list networks: %s", err))
+	}
+	for _, n := range unkept(networks, payload.KeepNetworks, func(n types.NetworkResource) string { return n.Name }) {
+		if !payload.DryRun {
+			if err := cli.NetworkRemove(ctx, n.ID); err != nil {
+				result.Errors = append(result.Errors, fmt.Sprintf("remove network %s: %s", n.Name, err))
+				continue
+			}
+		}
+		result.Networks = append(result.Networks, n.Name)
+	}
+
+	slog.InfoContext(ctx, "Garbage collected replicas", "source_host", payload.SourceHost, "dry_run", payload.DryRun, "containers", len(result.Containers), "volumes", len(result.Volumes), "networks", len(result.Networks), "errors", len(result.Errors))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// unkept returns the items whose key is not in keep, in their listed order.
+// A replica with no key, such as one missing its source ID label, is never
+// kept.
+func unkept[T any](items []T, keep []string, key func(T) string) []T {
+	set := toSet(keep)
+	var out []T
+	for _, item := range items {
+		if k := key(item); k == "" || !set[k] {
+			out = append(out, item)
+		}
+	}
+	return out
+}
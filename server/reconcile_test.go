@@ -0,0 +1,65 @@
+package server
+
+import (
+	"dockerap/labels"
+	"reflect"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+)
+
+func TestUnkeptReplicas(t *testing.T) {
+	replica := func(name, sourceID string) types.Container {
+		c := types.Container{ID: name + "1", Names: []string{"/" + name}, Labels: map[string]string{labels.Replica: "true"}}
+		if sourceID != "" {
+			c.Labels[labels.SourceID] = sourceID
+		}
+		return c
+	}
+	replicas := []types.Container{replica("web", "src-web"), replica("db", "src-db"), replica("orphan", ""), replica("old", "src-old")}
+	tests := []struct {
+		name string
+		keep []string
+		want []string
+	}{
+		{"keep nothing", nil, []string{"web", "db", "orphan", "old"}},
+		{"keep some", []string{"src-web", "src-db"}, []string{"orphan", "old"}},
+		{"keep everything selected", []string{"src-web", "src-db", "src-old"}, []string{"orphan"}},
+		// Replicas are matched by source ID, never by their own ID or name
+		{"own ID and name", []string{"web1", "web", "/web"}, []string{"web", "db", "orphan", "old"}},
+		// An empty keep entry must not protect replicas with no source ID
+		{"empty source ID", []string{""}, []string{"web", "db", "orphan", "old"}},
+		{"keep unknown", []string{"src-gone"}, []string{"web", "db", "orphan", "old"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, c := range unkept(replicas, tt.keep, func(c types.Container) string { return c.Labels[labels.SourceID] }) {
+				got = append(got, containerListName(c))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("removed %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnkeptNames(t *testing.T) {
+	names := []string{"pgdata", "cache", "shop_default"}
+	tests := []struct {
+		keep []string
+		want []string
+	}{
+		{nil, names},
+		{[]string{"pgdata", "shop_default"}, []string{"cache"}},
+		{[]string{"pgdata", "cache", "shop_default", "extra"}, nil},
+		// Names are exact, so a renamed volume doesn't keep its source
+		{[]string{"pgdata-standby", "Cache"}, names},
+	}
+	for _, tt := range tests {
+		got := unkept(names, tt.keep, func(name string) string { return name })
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("unkept(keep %v) = %v, want %v", tt.keep, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/distribution/reference"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/client"
+)
+
+// Image transports selectable per replication run.
+const (
+	TransportPull  = "pull"  // destination pulls from the image's own registry
+	TransportRelay = "relay" // source pushes to an intermediate registry the destination pulls from
+)
+
+// relayRef returns the name image gets in the relay registry, keeping its
+// repository path and tag so relayed images stay recognisable.
+func relayRef(relayRegistry, img string) (string, error) {
+	named, err := reference.ParseNormalizedNamed(img)
+	if err != nil {
+		return "", err
+	}
+	tag := "latest"
+	if tagged, ok := named.(reference.Tagged); ok {
+		tag = tagged.Tag()
+	}
+	return fmt.Sprintf("%s/%s:%s", strings.TrimRight(relayRegistry, "/"), reference.Path(named), tag), nil
+}
+
+// pushToRelay tags the image each planned container runs, and each planned
+// image, into the relay registry and pushes it once, recording the relay
+// reference and digest the destinations should pull. Items whose push fails
+// are moved to Skipped.
+func (s *Server) pushToRelay(ctx context.Context, srcCli *client.Client, plan *replicationPlan, relayRegistry string) {
+	var pushedImages []planImage
+	for _, pi := range plan.Images {
+		ref, digest, err := s.pushImageToRelay(ctx, srcCli, relayRegistry, pi.ID, pi.Ref)
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to push image to relay", "image", pi.Ref, "relay", relayRegistry, "err", err)
+			plan.Skipped = append(plan.Skipped, ItemResult{Type: "image", Name: pi.Ref, Status: ItemFailed, Error: "relay push: " + err.Error()})
+			continue
+		}
+		slog.InfoContext(ctx, "Pushed image to relay", "image", pi.Ref, "ref", ref, "digest", digest)
+		pi.RelayRef = ref
+		pi.RelayDigest = digest
+		pushedImages = append(pushedImages, pi)
+	}
+	plan.Images = pushedImages
+
+	var pushed []plannedContainer
+	for _, pc := range plan.Containers {
+		name := containerName(pc.Inspect)
+		ref, digest, err := s.pushImageToRelay(ctx, srcCli, relayRegistry, pc.Inspect.Image, pc.Inspect.Config.Image)
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to push image to relay", "container", name, "relay", relayRegistry, "err", err)
+			plan.Skipped = append(plan.Skipped, ItemResult{Type: "container", Name: name, Status: ItemFailed, Error: "relay push: " + err.Error()})
+			continue
+		}
+		slog.InfoContext(ctx, "Pushed image to relay", "container", name, "ref", ref, "digest", digest)
+		pc.RelayRef = ref
+		pc.RelayDigest = digest
+		pushed = append(pushed, pc)
+	}
+	plan.Containers = pushed
+}
+
+// pushImageToRelay pushes image imageID, known as name, to the relay
+// registry and returns its reference and digest there.
+func (s *Server) pushImageToRelay(ctx context.Context, srcCli *client.Client, relayRegistry, imageID, name string) (string, string, error) {
+	ref, err := relayRef(relayRegistry, name)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid image name %s: %w", name, err)
+	}
+
+	// Push the exact image planned, not whatever the tag points at now
+	if err := srcCli.ImageTag(ctx, imageID, ref); err != nil {
+		return "", "", fmt.Errorf("tag %s: %w", ref, err)
+	}
+	out, err := srcCli.ImagePush(ctx, ref, image.PushOptions{RegistryAuth: s.registryAuthForImage(ref)})
+	if err != nil {
+		return "", "", fmt.Errorf("push %s: %w", ref, err)
+	}
+	err = drainJSONMessages(out)
+	out.Close()
+	if err != nil {
+		return "", "", fmt.Errorf("push %s: %w", ref, err)
+	}
+
+	img, _, err := srcCli.ImageInspectWithRaw(ctx, ref)
+	if err != nil {
+		return "", "", fmt.Errorf("inspect %s: %w", ref, err)
+	}
+	digest := repoDigest(img.RepoDigests, ref)
+	if digest == "" {
+		return "", "", fmt.Errorf("registry returned no digest for %s", ref)
+	}
+	return ref, digest, nil
+}
@@ -0,0 +1,778 @@
+package server
+
+import (
+	"context"
+	"dockerap/apiclient"
+	"dockerap/labels"
+	"dockerap/logging"
+	"dockerap/store"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/client"
+)
+
+// Item statuses reported per replicated resource.
+const (
+	ItemReplicated = "replicated"
+	ItemFailed     = "failed"
+	ItemSkipped    = "skipped"
+)
+
+// replicateRequest is the body accepted by /replicate.
+type replicateRequest struct {
+	DestinationURL    string            `json:"destinationHost"`  // URL of destination app (e.g., http://5.6.7.8:8080)
+	DestinationURLs   []string          `json:"destinationHosts"` // fan out to several destinations in one run
+	SourceHostAddress string            `json:"sourceHostAddress"`
+	ImageDecisions    map[string]string `json:"imageDecisions"` // container ID -> pin|follow for "prompt" policies
+	Transport         string            `json:"transport"`      // pull (default) or relay
+	RelayRegistry     string            `json:"relayRegistry"`  // registry host[:port][/prefix] for the relay transport
+	PortRemap         *portRemap        `json:"portRemap"`      // rewrite published host ports on the destination
+	Rename            *nameRemap        `json:"rename"`         // rename containers and volumes on the destination
+	Rollback          bool              `json:"rollback"`       // remove what this job created on a destination where anything failed
+	Confirmation      Confirmation      `json:"confirmation"`   // satisfies the rollback gate
+	Profile           string            `json:"profile"`        // replicate a named profile instead of the selection; also ?profile=
+	DestinationNames  []string          `json:"destinations"`   // stored destinations, by name, added to the URLs above
+	Host              string            `json:"host"`           // Docker host to replicate from, stored under /api/hosts; local by default
+	ImagesOnly        bool              `json:"imagesOnly"`     // copy only images: the selected ones and those of the selected containers
+}
+
+// destinations returns the de-duplicated list of destination URLs in the request.
+func (p *replicateRequest) destinations() []string {
+	seen := make(map[string]bool)
+	var dests []string
+	for _, d := range append([]string{p.DestinationURL}, p.DestinationURLs...) {
+		d = strings.TrimRight(strings.TrimSpace(d), "/")
+		if d == "" || seen[d] {
+			continue
+		}
+		seen[d] = true
+		dests = append(dests, d)
+	}
+	return dests
+}
+
+// ItemResult is the outcome of replicating a single network, volume, image
+// or container.
+type ItemResult struct {
+	Type       string `json:"type"`
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	Bytes      int64  `json:"bytes"` // request bytes sent to the destination
+	DurationMs int64  `json:"durationMs"`
+}
+
+// DestinationResult is the outcome of a replication run against one destination.
+type DestinationResult struct {
+	Destination string                      `json:"destination"`
+	Items       []ItemResult                `json:"items"`
+	Replicated  int                         `json:"replicated"`
+	Failed      int                         `json:"failed"`
+	Bytes       int64                       `json:"bytes"`
+	DurationMs  int64                       `json:"durationMs"`
+	Error       string                      `json:"error,omitempty"` // why nothing was attempted, e.g. an incompatible destination
+	RolledBack  *apiclient.RemovedResources `json:"rolledBack,omitempty"`
+
+	progress *jobProgress // the job's progress card, nil when it has none
+}
+
+// run performs one item's action against the destination and records the
+// outcome. Each item gets its own client so the bytes it sends can be counted.
+func (d *DestinationResult) run(ctx context.Context, base http.RoundTripper, item ItemResult, action func(httpClient *http.Client) error) {
+	slog.InfoContext(ctx, "Replicating", "type", item.Type, "name", item.Name, "destination", d.Destination)
+	d.progress.begin(d.Destination, item)
+	counter := &countingTransport{base: base}
+	start := time.Now()
+	err := action(&http.Client{Transport: counter})
+	item.Bytes = counter.sent.Load()
+	item.DurationMs = time.Since(start).Milliseconds()
+	item.Status = ItemReplicated
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to replicate", "type", item.Type, "name", item.Name, "destination", d.Destination, "err", err)
+		item.Status = ItemFailed
+		item.Error = err.Error()
+	} else {
+		slog.InfoContext(ctx, "Successfully replicated", "type", item.Type, "name", item.Name, "destination", d.Destination)
+	}
+	d.add(item)
+}
+
+func (d *DestinationResult) add(item ItemResult) {
+	switch item.Status {
+	case ItemReplicated:
+		d.Replicated++
+	case ItemFailed:
+		d.Failed++
+	}
+	d.Bytes += item.Bytes
+	d.Items = append(d.Items, item)
+	d.progress.done(d.Destination, item)
+}
+
+// failAll records every planned item as failed with err, for a destination
+// that cannot be replicated to at all.
+func (d *DestinationResult) failAll(plan *replicationPlan, err error) {
+	d.Error = err.Error()
+	fail := func(typ, name string) {
+		d.add(ItemResult{Type: typ, Name: name, Status: ItemFailed, Error: d.Error})
+	}
+	for _, pi := range plan.Images {
+		fail("image", pi.Ref)
+	}
+	for _, n := range plan.Networks {
+		fail("network", n.Name)
+	}
+	for _, vol := range plan.Volumes {
+		fail("volume", vol.Name)
+	}
+	for _, pc := range plan.Containers {
+		fail("container", containerName(pc.Inspect))
+	}
+}
+
+// replicationPlan is the source-side view of what a run replicates. It is
+// built once and shared by every destination in a fan-out.
+type replicationPlan struct {
+	JobID                 string
+	Profile               string // named profile, or "" for the global selection
+	SourceHost            string
+	Projects              []string // selected compose projects
+	Images                []planImage
+	Networks              []types.NetworkResource
+	Volumes               []volume.Volume
+	Containers            []plannedContainer
+	Skipped               []ItemResult
+	PendingImageDecisions []string
+	VolumeNames           map[string]string    // source volume -> name on the destination, when renamed
+	VolumeData            map[string]dataMount // contents of selected volumes no planned container mounts
+
+	progress      *jobProgress       // updated as each destination's items finish
+	preHookFailed []plannedContainer // dropped from Containers by their pre hook; their post hook still runs
+}
+
+type plannedContainer struct {
+	Inspect     types.ContainerJSON
+	Name        string // replica name on the destination
+	ImageDigest string // pinned digest, or "" to follow the tag
+	RelayRef    string // image reference in the relay registry, when relaying
+	RelayDigest string
+	DataMounts  []dataMount       // mount contents copied after the replica is created
+	BindRemaps  map[string]string // bind source -> destination host path
+	Quiesce     string            // pause or stop the source while copying DataMounts
+	StartPolicy string            // what the replica does once created and filled
+	DependsOn   []string          // source names of planned containers to create first
+	Hooks       store.ReplicationHooks
+}
+
+func (s *Server) handleReplicate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	setAuditAction(r, "replication:start")
+
+	var payload replicateRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if profile := r.URL.Query().Get("profile"); profile != "" {
+		payload.Profile = profile
+	}
+
+	payload.SourceHostAddress = s.sourceHostAddress(r, payload.SourceHostAddress)
+	destinations, err := s.destinations(&payload)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(destinations) == 0 || payload.SourceHostAddress == "" {
+		http.Error(w, "Destination and source host addresses cannot be empty", http.StatusBadRequest)
+		return
+	}
+	switch payload.Transport {
+	case "", TransportPull:
+	case TransportRelay:
+		if payload.RelayRegistry == "" {
+			http.Error(w, "The relay transport requires relayRegistry", http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, fmt.Sprintf("Unknown transport: %s", payload.Transport), http.StatusBadRequest)
+		return
+	}
+	if err := payload.PortRemap.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := payload.Rename.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Rollback deletes from the destinations, so it is confirmed before anything runs
+	if payload.Rollback {
+		if err := s.checkConfirmation(r, OpRollback, payload.Confirmation); err != nil {
+			writeProblem(w, r, http.StatusForbidden, codeConfirmationRequired, err.Error())
+			return
+		}
+	}
+
+	jobID := newJobID()
+	report := &ReplicationReport{JobID: jobID, RequestID: logging.RequestID(r.Context()), StartedAt: time.Now().UTC()}
+	setAuditTarget(r, jobID, "")
+	slog.InfoContext(r.Context(), "Replication job started", "job_id", jobID, "destinations", destinations)
+	slog.InfoContext(r.Context(), "Replication job source version", "job_id", jobID, "version", readAbout(r.Context()).String())
+
+	// Get source Docker client
+	srcCli, err := s.dockerClientFor(r.Context(), payload.Host)
+	if errors.Is(err, store.ErrHostNotFound) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to create source docker client", "err", err)
+		writeError(w, r, "Unable to create source docker client", err)
+		return
+	}
+	defer srcCli.Close()
+
+	// A client that hangs up does not stop the job; the request ID stays for the logs
+	ctx := context.WithoutCancel(r.Context())
+	plan, err := s.buildPlan(ctx, srcCli, payload.Host, payload.Profile, payload.ImageDecisions)
+	if err != nil {
+		writeSelectionError(w, r, err)
+		return
+	}
+	if payload.ImagesOnly {
+		plan.keepImagesOnly()
+	}
+	plan.JobID = jobID
+	plan.SourceHost = payload.SourceHostAddress
+	if err := applyPortRemap(plan, payload.PortRemap); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	applyNameRemap(plan, payload.Rename)
+	plan.progress = s.jobs.start(plan, destinations)
+
+	if payload.Transport == TransportRelay {
+		s.pushToRelay(ctx, srcCli, plan, payload.RelayRegistry)
+	}
+
+	// Hooks run once on the source, around the copies to every destination
+	hookResults := s.runHooks(ctx, srcCli, plan, HookPre)
+
+	results := make([]DestinationResult, len(destinations))
+	// At most replicationConcurrency destinations copy at once, all when 0
+	slots := len(destinations)
+	if n := s.intSetting(settingReplicationConcurrency); n > 0 && n < slots {
+		slots = n
+	}
+	sem := make(chan struct{}, slots)
+	var wg sync.WaitGroup
+	for i, dest := range destinations {
+		wg.Add(1)
+		go func(i int, dest string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[i] = s.replicateTo(ctx, srcCli, dest, plan)
+			if payload.Rollback && results[i].Failed > 0 && results[i].Error == "" {
+				results[i].RolledBack = rollbackJob(ctx, s.peerClient(dest), dest, jobID)
+			}
+		}(i, dest)
+	}
+	wg.Wait()
+	hookResults = append(hookResults, s.runHooks(ctx, srcCli, plan, HookPost)...)
+
+	for _, res := range results {
+		slog.InfoContext(ctx, "Replication to destination finished", "destination", res.Destination, "replicated", res.Replicated, "failed", res.Failed, "bytes", res.Bytes)
+	}
+
+	report.Profile = plan.Profile
+	report.Destinations = results
+	report.Hooks = hookResults
+	report.PendingImageDecisions = plan.PendingImageDecisions
+	report.finish()
+	plan.progress.finish(report)
+	setAuditTarget(r, jobID, fmt.Sprintf("%s to %s", report.Status, strings.Join(destinations, ", ")))
+	if e := auditFrom(r.Context()); e != nil && report.Status == ReportPartial {
+		e.Outcome = "partial"
+	}
+	s.saveReport(report)
+	slog.InfoContext(ctx, "Replication job finished", "job_id", jobID, "status", report.Status, "duration", time.Duration(report.DurationMs)*time.Millisecond)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(report.httpStatus())
+	json.NewEncoder(w).Encode(report)
+}
+
+// planOutput is the JSON rendering of a replication plan returned by /api/plan.
+type planOutput struct {
+	Profile               string            `json:"profile,omitempty"`
+	Projects              []string          `json:"projects"`
+	Images                []string          `json:"images"`
+	Networks              []string          `json:"networks"`
+	Volumes               []string          `json:"volumes"`
+	Containers            []plannedImage    `json:"containers"`
+	Skipped               []ItemResult      `json:"skipped"`
+	PendingImageDecisions []string          `json:"pendingImageDecisions"`
+	Destinations          []destinationPlan `json:"destinations"`
+}
+
+type plannedImage struct {
+	Name        string   `json:"name"`
+	ReplicaName string   `json:"replicaName"`
+	Image       string   `json:"image"`
+	ImageDigest string   `json:"imageDigest,omitempty"`
+	Data        []string `json:"data,omitempty"`
+	Quiesce     string   `json:"quiesce,omitempty"`
+	StartPolicy string   `json:"startPolicy,omitempty"`
+	DependsOn   []string `json:"dependsOn,omitempty"`
+	PreHook     string   `json:"preHook,omitempty"`
+	PostHook    string   `json:"postHook,omitempty"`
+}
+
+type destinationPlan struct {
+	Destination string                `json:"destination"`
+	Checklist   []apiclient.CheckItem `json:"checklist"`
+	Error       string                `json:"error,omitempty"`
+}
+
+// handlePlan reports what /replicate would do for the same request body,
+// including each destination's environment checklist, without changing anything.
+func (s *Server) handlePlan(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var payload replicateRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if profile := r.URL.Query().Get("profile"); profile != "" {
+		payload.Profile = profile
+	}
+	if err := payload.PortRemap.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := payload.Rename.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	destinations, err := s.destinations(&payload)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	srcCli, err := s.dockerClientFor(r.Context(), payload.Host)
+	if errors.Is(err, store.ErrHostNotFound) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to create source docker client", "err", err)
+		writeError(w, r, "Unable to create source docker client", err)
+		return
+	}
+	defer srcCli.Close()
+
+	// A client that hangs up does not stop the job; the request ID stays for the logs
+	ctx := context.WithoutCancel(r.Context())
+	plan, err := s.buildPlan(ctx, srcCli, payload.Host, payload.Profile, payload.ImageDecisions)
+	if err != nil {
+		writeSelectionError(w, r, err)
+		return
+	}
+	if payload.ImagesOnly {
+		plan.keepImagesOnly()
+	}
+	if err := applyPortRemap(plan, payload.PortRemap); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	applyNameRemap(plan, payload.Rename)
+
+	info, err := srcCli.Info(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "Unable to get Docker info", "err", err)
+		writeError(w, r, "Unable to get Docker info", err)
+		return
+	}
+
+	out := planOutput{
+		Profile:               plan.Profile,
+		Projects:              plan.Projects,
+		Skipped:               plan.Skipped,
+		PendingImageDecisions: plan.PendingImageDecisions,
+	}
+	for _, pi := range plan.Images {
+		name := pi.Ref
+		if pi.Digest != "" {
+			name += " @ " + pi.Digest
+		}
+		out.Images = append(out.Images, name)
+	}
+	for _, n := range plan.Networks {
+		out.Networks = append(out.Networks, n.Name)
+	}
+	for _, v := range plan.Volumes {
+		name := v.Name
+		if to := plan.volumeName(v.Name); to != v.Name {
+			name += " -> " + to
+		}
+		if _, ok := plan.VolumeData[v.Name]; ok {
+			name += " (with data, not mounted by a selected container)"
+		}
+		out.Volumes = append(out.Volumes, name)
+	}
+	for _, pc := range plan.Containers {
+		pi := plannedImage{
+			Name:        containerName(pc.Inspect),
+			ReplicaName: pc.Name,
+			Image:       pc.Inspect.Config.Image,
+			ImageDigest: pc.ImageDigest,
+			Quiesce:     pc.Quiesce,
+			StartPolicy: pc.StartPolicy,
+			DependsOn:   pc.DependsOn,
+			PreHook:     pc.Hooks.Pre,
+			PostHook:    pc.Hooks.Post,
+		}
+		for _, dm := range pc.DataMounts {
+			desc := dm.String()
+			if target, ok := pc.BindRemaps[dm.Source]; ok {
+				desc += " (host path " + target + ")"
+			}
+			pi.Data = append(pi.Data, desc)
+		}
+		out.Containers = append(out.Containers, pi)
+	}
+
+	out.Destinations = make([]destinationPlan, len(destinations))
+	var wg sync.WaitGroup
+	for i, dest := range destinations {
+		wg.Add(1)
+		go func(i int, dest string) {
+			defer wg.Done()
+			httpClient := s.peerClient(dest)
+			dp := destinationPlan{Destination: dest}
+			if err := checkPeerAPI(ctx, httpClient, dest); err != nil {
+				dp.Error = err.Error()
+				out.Destinations[i] = dp
+				return
+			}
+			items, err := fetchChecklist(ctx, httpClient, dest, info.Architecture, plan)
+			if err != nil {
+				slog.WarnContext(ctx, "Failed to fetch checklist", "dest", dest, "err", err)
+				dp.Error = err.Error()
+			}
+			dp.Checklist = items
+			out.Destinations[i] = dp
+		}(i, dest)
+	}
+	wg.Wait()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+// buildPlan inspects the selected volumes and containers on the source, the
+// named Docker host srcCli reaches, or those of the named profile, and
+// resolves the image each container should be recreated from.
+func (s *Server) buildPlan(ctx context.Context, srcCli *client.Client, host, profile string, decisions map[string]string) (*replicationPlan, error) {
+	sel, err := s.loadSelection(ctx, srcCli, host, profile)
+	if err != nil {
+		return nil, err
+	}
+	if profile == "" {
+		if err := s.addRuleMatches(ctx, srcCli, sel); err != nil {
+			return nil, err
+		}
+	}
+	selectedContainers, selectedVolumes, selectedProjects := sel.Containers, sel.Volumes, sel.Projects
+	// A selected compose project brings all of its containers, volumes and networks
+	projectNetworks, err := expandProjects(ctx, srcCli, selectedProjects, selectedContainers, selectedVolumes)
+	if err != nil {
+		return nil, fmt.Errorf("unable to resolve compose projects: %w", err)
+	}
+
+	plan := &replicationPlan{Profile: profile}
+	for name := range selectedProjects {
+		plan.Projects = append(plan.Projects, name)
+	}
+	sort.Strings(plan.Projects)
+	for volName := range selectedVolumes {
+		srcVol, err := srcCli.VolumeInspect(ctx, volName)
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to inspect source volume", "volume", volName, "err", err)
+			plan.Skipped = append(plan.Skipped, ItemResult{Type: "volume", Name: volName, Status: ItemFailed, Error: err.Error()})
+			continue
+		}
+		plan.Volumes = append(plan.Volumes, srcVol)
+	}
+	planSelectedImages(ctx, srcCli, plan, sel.Images)
+
+	for containerID := range selectedContainers {
+		srcCont, err := srcCli.ContainerInspect(ctx, containerID)
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to inspect source container", "container_id", containerID, "err", err)
+			plan.Skipped = append(plan.Skipped, ItemResult{Type: "container", Name: containerID, Status: ItemFailed, Error: err.Error()})
+			continue
+		}
+
+		digest, err := s.resolveImageDigest(ctx, srcCli, host, srcCont, decisions[containerID])
+		if err != nil {
+			status := ItemFailed
+			if _, ok := err.(*errImageDecisionRequired); ok {
+				plan.PendingImageDecisions = append(plan.PendingImageDecisions, containerID)
+				status = ItemSkipped
+			}
+			slog.WarnContext(ctx, "Skipping container", "container_id", containerID, "err", err)
+			plan.Skipped = append(plan.Skipped, ItemResult{Type: "container", Name: containerName(srcCont), Status: status, Error: err.Error()})
+			continue
+		}
+		plan.Containers = append(plan.Containers, plannedContainer{Inspect: srcCont, Name: containerName(srcCont), ImageDigest: digest})
+	}
+
+	if err := s.planMountData(plan, selectedVolumes); err != nil {
+		return nil, err
+	}
+	startPolicies, err := s.store.GetStartPolicies()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get start policies: %w", err)
+	}
+	for i := range plan.Containers {
+		plan.Containers[i].StartPolicy = startPolicies[plan.Containers[i].Inspect.ID]
+	}
+	orderPlanContainers(plan)
+
+	// User-defined networks must exist on the destination before containers
+	// attach to them; selected ones are created even if no container uses them
+	netNames := append(projectNetworks, sortedKeys(sel.Networks)...)
+	for _, pc := range plan.Containers {
+		for netName := range containerNetworks(pc.Inspect) {
+			netNames = append(netNames, netName)
+		}
+	}
+	if len(netNames) == 0 {
+		return plan, nil
+	}
+	srcNetworks, err := userNetworks(ctx, srcCli)
+	if err != nil {
+		return nil, err
+	}
+	seenNetworks := make(map[string]bool)
+	for _, netName := range netNames {
+		if isPredefinedNetwork(netName) || seenNetworks[netName] {
+			continue
+		}
+		seenNetworks[netName] = true
+		srcNet, ok := srcNetworks[netName]
+		if !ok {
+			slog.WarnContext(ctx, "Source network not found", "network", netName)
+			plan.Skipped = append(plan.Skipped, ItemResult{Type: "network", Name: netName, Status: ItemFailed, Error: "no such network on the source"})
+			continue
+		}
+		plan.Networks = append(plan.Networks, srcNet)
+	}
+	return plan, nil
+}
+
+// containerNetworks returns the networks an inspected container is attached
+// to, none when the inspect has no network settings.
+func containerNetworks(c types.ContainerJSON) map[string]*network.EndpointSettings {
+	if c.NetworkSettings == nil {
+		return nil
+	}
+	return c.NetworkSettings.Networks
+}
+
+// isPredefinedNetwork reports whether name is one of the networks every daemon creates itself.
+func isPredefinedNetwork(name string) bool {
+	switch name {
+	case "bridge", "host", "none", "default":
+		return true
+	}
+	return false
+}
+
+// replicateTo pushes every planned image, network, volume and container to
+// one destination.
+func (s *Server) replicateTo(ctx context.Context, srcCli *client.Client, dest string, plan *replicationPlan) DestinationResult {
+	result := DestinationResult{Destination: dest, progress: plan.progress}
+	httpClient := s.peerClient(dest)
+	started := time.Now()
+
+	for _, item := range plan.Skipped {
+		result.add(item)
+	}
+	if err := checkPeerAPI(ctx, httpClient, dest); err != nil {
+		slog.ErrorContext(ctx, "Destination is not compatible", "dest", dest, "err", err)
+		result.failAll(plan, err)
+		result.DurationMs = time.Since(started).Milliseconds()
+		return result
+	}
+
+	// --- Image Replication via API ---
+	for _, pi := range plan.Images {
+		result.run(ctx, s.peerTransport(dest), ItemResult{Type: "image", Name: pi.Ref}, func(httpClient *http.Client) error {
+			return s.replicateImage(ctx, srcCli, httpClient, dest, pi)
+		})
+	}
+
+	// --- Network Replication via API ---
+	for _, n := range plan.Networks {
+		result.run(ctx, s.peerTransport(dest), ItemResult{Type: "network", Name: n.Name}, func(httpClient *http.Client) error {
+			return s.replicateNetwork(ctx, httpClient, dest, plan.JobID, plan.SourceHost, n)
+		})
+	}
+
+	// --- Volume Replication via API ---
+	for _, vol := range plan.Volumes {
+		result.run(ctx, s.peerTransport(dest), ItemResult{Type: "volume", Name: vol.Name}, func(httpClient *http.Client) error {
+			if err := s.replicateVolume(ctx, httpClient, dest, plan.JobID, plan.SourceHost, vol, plan.volumeName(vol.Name)); err != nil {
+				return err
+			}
+			if dm, ok := plan.VolumeData[vol.Name]; ok {
+				if err := s.copyVolumeData(ctx, srcCli, httpClient, dest, plan.volumeName(vol.Name), dm); err != nil {
+					return fmt.Errorf("copy volume data: %w", err)
+				}
+			}
+			return nil
+		})
+	}
+
+	// --- Container Replication via API ---
+	for _, pc := range plan.Containers {
+		result.run(ctx, s.peerTransport(dest), ItemResult{Type: "container", Name: containerName(pc.Inspect)}, func(httpClient *http.Client) error {
+			return s.replicateContainer(ctx, srcCli, httpClient, dest, plan.JobID, plan.SourceHost, pc)
+		})
+	}
+
+	result.DurationMs = time.Since(started).Milliseconds()
+	return result
+}
+
+// replicateNetwork creates n on the destination, reusing an existing network of the same name.
+func (s *Server) replicateNetwork(ctx context.Context, httpClient *http.Client, dest, jobID, sourceHost string, n types.NetworkResource) error {
+	_, err := apiclient.New(dest, httpClient).CreateNetwork(ctx, apiclient.CreateNetworkRequest{
+		Name:       n.Name,
+		Driver:     n.Driver,
+		Options:    n.Options,
+		Labels:     managedLabels(n.Labels, jobID, sourceHost),
+		IPAM:       &n.IPAM,
+		Internal:   n.Internal,
+		Attachable: n.Attachable,
+		EnableIPv6: n.EnableIPv6,
+	})
+	if err != nil {
+		return fmt.Errorf("create network: %w", err)
+	}
+	return nil
+}
+
+// replicateVolume creates vol on the destination under name.
+func (s *Server) replicateVolume(ctx context.Context, httpClient *http.Client, dest, jobID, sourceHost string, vol volume.Volume, name string) error {
+	_, err := apiclient.New(dest, httpClient).CreateVolume(ctx, apiclient.CreateVolumeRequest{
+		Name:       name,
+		Driver:     vol.Driver,
+		DriverOpts: vol.Options,
+		Labels:     managedLabels(vol.Labels, jobID, sourceHost),
+	})
+	if err != nil {
+		return fmt.Errorf("create volume: %w", err)
+	}
+	return nil
+}
+
+// replicateContainer pulls the planned image on the destination and creates
+// the container. If the destination cannot pull the image (locally built or
+// private), the image is streamed from the source with docker save/load.
+func (s *Server) replicateContainer(ctx context.Context, srcCli *client.Client, httpClient *http.Client, dest, jobID, sourceHost string, pc plannedContainer) error {
+	api := apiclient.New(dest, httpClient)
+	imageName := pc.Inspect.Config.Image
+	pull := apiclient.PullImageRequest{ImageName: imageName, Digest: pc.ImageDigest}
+	if pc.RelayRef != "" {
+		// Pull the relayed copy and give it the original name locally
+		pull = apiclient.PullImageRequest{ImageName: pc.RelayRef, Digest: pc.RelayDigest, TagAs: imageName}
+	}
+	if err := s.copyImage(ctx, srcCli, httpClient, dest, pull, pc.Inspect.Image, imageName); err != nil {
+		return err
+	}
+
+	// The destination tags pinned pulls with the source's image name, so the
+	// replica keeps a readable image reference while running identical bytes
+	contConfig := *pc.Inspect.Config
+
+	// Label the replica so the monitor can find it at failover time even if
+	// it is recreated with a new ID
+	contConfig.Labels = managedLabels(pc.Inspect.Config.Labels, jobID, sourceHost)
+	contConfig.Labels[labels.Replica] = "true"
+	contConfig.Labels[labels.SourceID] = pc.Inspect.ID
+	contConfig.Labels[labels.SourceName] = containerName(pc.Inspect)
+	if len(pc.DependsOn) > 0 {
+		contConfig.Labels[labels.DependsOn] = strings.Join(pc.DependsOn, ",")
+	}
+
+	healthcheck, err := effectiveHealthcheck(ctx, srcCli, pc.Inspect)
+	if err != nil {
+		return fmt.Errorf("read healthcheck: %w", err)
+	}
+	contConfig.Healthcheck = healthcheck
+
+	create := apiclient.CreateContainerRequest{
+		Name:          pc.Name,
+		Config:        &contConfig,
+		HostConfig:    remapBinds(pc.Inspect.HostConfig, pc.BindRemaps),
+		NetworkConfig: &network.NetworkingConfig{EndpointsConfig: containerNetworks(pc.Inspect)},
+	}
+	// Mount contents go in before the replica ever starts, so a replica with
+	// data is started separately once the copy is done
+	if len(pc.DataMounts) == 0 {
+		create.StartPolicy = pc.StartPolicy
+	}
+	if _, err := api.CreateContainer(ctx, create); err != nil {
+		return fmt.Errorf("create container: %w", err)
+	}
+
+	if len(pc.DataMounts) == 0 {
+		return nil
+	}
+	if pc.Quiesce != "" {
+		if err := s.quiesce.acquire(ctx, srcCli, pc.Inspect.ID, pc.Quiesce); err != nil {
+			return fmt.Errorf("quiesce source container: %w", err)
+		}
+		defer s.quiesce.release(context.Background(), srcCli, pc.Inspect.ID)
+	}
+	for _, dm := range pc.DataMounts {
+		if err := copyMountData(ctx, srcCli, httpClient, dest, pc.Inspect.ID, pc.Name, dm); err != nil {
+			return fmt.Errorf("copy %s data: %w", dm.Kind, err)
+		}
+	}
+	if pc.StartPolicy != "" && pc.StartPolicy != store.StartCreated {
+		if err := api.StartContainer(ctx, apiclient.StartContainerRequest{Name: pc.Name, StartPolicy: pc.StartPolicy}); err != nil {
+			return fmt.Errorf("start container: %w", err)
+		}
+	}
+	return nil
+}
+
+// containerName returns the container's name without the leading slash.
+func containerName(c types.ContainerJSON) string {
+	return strings.TrimPrefix(c.Name, "/")
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+)
+
+func TestPlanningContainerWithoutNetworkSettings(t *testing.T) {
+	bare := types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{Name: "/bare"},
+		Config:            &container.Config{Env: []string{"DB=db:5432"}},
+	}
+	if nets := containerNetworks(bare); nets != nil {
+		t.Errorf("containerNetworks = %v, want none", nets)
+	}
+
+	web := types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{Name: "/web"},
+		Config:            &container.Config{Env: []string{"DATABASE_URL=postgres://db:5432/app"}},
+		NetworkSettings: &types.NetworkSettings{Networks: map[string]*network.EndpointSettings{
+			"shop": {Aliases: []string{"web"}},
+		}},
+	}
+	db := types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{Name: "/db"},
+		Config:            &container.Config{},
+		NetworkSettings: &types.NetworkSettings{Networks: map[string]*network.EndpointSettings{
+			"shop": {Aliases: []string{"db"}},
+		}},
+	}
+	plan := &replicationPlan{Containers: []plannedContainer{{Inspect: web}, {Inspect: bare}, {Inspect: db}}}
+	orderPlanContainers(plan)
+
+	var names []string
+	for _, pc := range plan.Containers {
+		names = append(names, containerName(pc.Inspect))
+	}
+	if len(names) != 3 {
+		t.Fatalf("planned containers = %v, want all three", names)
+	}
+	for i, name := range names {
+		if name == "web" {
+			for _, before := range names[:i] {
+				if before == "db" {
+					return
+				}
+			}
+			t.Errorf("order = %v, want db before web", names)
+		}
+	}
+}
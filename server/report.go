@@ -0,0 +1,211 @@
+package server
+
+import (
+	"context"
+	"dockerap/notify"
+	"dockerap/store"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Overall outcome of a replication job.
+const (
+	ReportSucceeded = "succeeded"
+	ReportPartial   = "partial"
+	ReportFailed    = "failed"
+)
+
+// ReplicationReport is the result of one /replicate call. It is returned to
+// the caller and stored, so it can be fetched again from /api/reports.
+type ReplicationReport struct {
+	JobID                 string              `json:"jobId"`
+	RequestID             string              `json:"requestId,omitempty"` // X-Request-ID of the request that started the job
+	Profile               string              `json:"profile,omitempty"`
+	Direction             string              `json:"direction,omitempty"` // "failback" for reverse runs
+	Status                string              `json:"status"`
+	StartedAt             time.Time           `json:"startedAt"`
+	FinishedAt            time.Time           `json:"finishedAt"`
+	DurationMs            int64               `json:"durationMs"`
+	Replicated            int                 `json:"replicated"`
+	Failed                int                 `json:"failed"`
+	Bytes                 int64               `json:"bytes"`
+	Destinations          []DestinationResult `json:"destinations"`
+	Hooks                 []HookResult        `json:"hooks"`
+	PendingImageDecisions []string            `json:"pendingImageDecisions"`
+}
+
+// finish totals the destination results and sets the overall status.
+func (rep *ReplicationReport) finish() {
+	rep.FinishedAt = time.Now().UTC()
+	rep.DurationMs = rep.FinishedAt.Sub(rep.StartedAt).Milliseconds()
+	for _, d := range rep.Destinations {
+		rep.Replicated += d.Replicated
+		rep.Failed += d.Failed
+		rep.Bytes += d.Bytes
+	}
+	switch {
+	case rep.Failed == 0:
+		rep.Status = ReportSucceeded
+	case rep.Replicated == 0:
+		rep.Status = ReportFailed
+	default:
+		rep.Status = ReportPartial
+	}
+}
+
+// httpStatus maps the report status to the response code: 200 when
+// everything replicated, 207 when some items failed and 500 when all did.
+func (rep *ReplicationReport) httpStatus() int {
+	switch rep.Status {
+	case ReportPartial:
+		return http.StatusMultiStatus
+	case ReportFailed:
+		return http.StatusInternalServerError
+	}
+	return http.StatusOK
+}
+
+// saveReport persists rep and counts it in the metrics. A failure is logged
+// rather than failing the job, which has already run.
+func (s *Server) saveReport(rep *ReplicationReport) {
+	observeReport(rep)
+	data, err := json.Marshal(rep)
+	if err == nil {
+		err = s.store.SaveReport(rep.JobID, rep.Status, string(data))
+	}
+	if err != nil {
+		slog.Error("Unable to save report for job", "job_id", rep.JobID, "err", err)
+	}
+	if err := s.store.RecordRun(runRecord(rep)); err != nil {
+		slog.Error("Unable to record history for job", "job_id", rep.JobID, "err", err)
+	}
+	// Destinations that were never reached keep their last contact
+	for _, d := range rep.Destinations {
+		if d.Error != "" {
+			continue
+		}
+		if err := s.store.RecordDestinationActivity(d.Destination, rep.FinishedAt, d.Failed == 0); err != nil {
+			slog.Error("Unable to record destination activity", "dest", d.Destination, "err", err)
+		}
+	}
+	// Webhooks may be slow or retried; the caller is waiting for the report
+	go s.cfg.Notifier.Notify(context.Background(), reportEvent(rep))
+}
+
+// reportEvent turns a finished job's report into a webhook event.
+func reportEvent(rep *ReplicationReport) notify.Event {
+	e := notify.Event{
+		Type:       notify.ReplicationSucceeded,
+		Time:       rep.FinishedAt,
+		JobID:      rep.JobID,
+		Profile:    rep.Profile,
+		Direction:  rep.Direction,
+		Replicated: rep.Replicated,
+		Failed:     rep.Failed,
+		Bytes:      rep.Bytes,
+	}
+	switch rep.Status {
+	case ReportPartial:
+		e.Type = notify.ReplicationPartial
+	case ReportFailed:
+		e.Type = notify.ReplicationFailed
+	}
+	var errs []string
+	for _, d := range rep.Destinations {
+		e.Destinations = append(e.Destinations, d.Destination)
+		if d.Error != "" {
+			errs = append(errs, d.Destination+": "+d.Error)
+		}
+	}
+	e.Error = strings.Join(errs, "; ")
+
+	kind := "Replication"
+	if rep.Direction == DirectionFailback {
+		kind = "Failback"
+	}
+	e.Summary = fmt.Sprintf("%s job %s %s: %d replicated, %d failed, %s to %s in %s", kind, rep.JobID, rep.Status,
+		rep.Replicated, rep.Failed, formatBytes(rep.Bytes), strings.Join(e.Destinations, ", "),
+		(time.Duration(rep.DurationMs) * time.Millisecond).Round(time.Second))
+	if rep.Profile != "" {
+		e.Summary += fmt.Sprintf(" (profile %s)", rep.Profile)
+	}
+	return e
+}
+
+// countingTransport counts the request body bytes sent through it.
+type countingTransport struct {
+	base http.RoundTripper
+	sent atomic.Int64
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil && req.Body != http.NoBody {
+		req = req.Clone(req.Context())
+		req.Body = &countingReader{ReadCloser: req.Body, n: &t.sent}
+	}
+	return t.base.RoundTrip(req)
+}
+
+type countingReader struct {
+	io.ReadCloser
+	n *atomic.Int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n.Add(int64(n))
+	return n, err
+}
+
+// handleReports lists recent replication reports, or returns one with ?job=ID.
+func (s *Server) handleReports(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if jobID := r.URL.Query().Get("job"); jobID != "" {
+		rep, err := s.store.GetReport(jobID)
+		if errors.Is(err, store.ErrReportNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Unable to get report", "job_id", jobID, "err", err)
+			writeError(w, r, "Unable to get report", err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, rep.Data)
+		return
+	}
+
+	limit := 50
+	if l := r.URL.Query().Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n <= 0 {
+			http.Error(w, "limit must be a positive number", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	reports, err := s.store.GetReports(limit)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to get reports", "err", err)
+		writeError(w, r, "Unable to get reports", err)
+		return
+	}
+	if reports == nil {
+		reports = []store.Report{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reports)
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"dockerap/logging"
+	"encoding/hex"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/docker/docker/client"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// validRequestID accepts IDs from peers and proxies that are short and safe
+// to log.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// statusRecorder remembers the status and size of a response for the access log.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += int64(n)
+	return n, err
+}
+
+// Hijack hands the connection to WebSocket handlers, which assert
+// http.Hijacker directly instead of going through http.ResponseController.
+func (rec *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	rec.status = http.StatusSwitchingProtocols
+	return http.NewResponseController(rec.ResponseWriter).Hijack()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer to flush
+// streamed responses.
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// logRequests gives every request an ID, taken from an X-Request-ID header
+// sent by a peer or proxy or generated here, returns it in the response and
+// writes an access log line once the request is done.
+func (s *Server) logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+
+		rec := &statusRecorder{ResponseWriter: w}
+		start := time.Now()
+		ctx := logging.WithRequestID(r.Context(), id)
+		next.ServeHTTP(rec, r.WithContext(ctx))
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		// Successful probes arrive every few seconds and would drown out everything else
+		level := slog.LevelInfo
+		if isProbe(r.URL.Path) && rec.status < 400 {
+			level = slog.LevelDebug
+		}
+		slog.Log(ctx, level, "Request", "method", r.Method, "path", r.URL.Path, "status", rec.status,
+			"bytes", rec.bytes, "duration", time.Since(start).Round(time.Millisecond), "remote_addr", r.RemoteAddr)
+	})
+}
+
+// requestIDTransport passes the request ID on to other instances, so their
+// logs of the same replication carry it too.
+type requestIDTransport struct {
+	base http.RoundTripper
+}
+
+func (t *requestIDTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if id := logging.RequestID(req.Context()); id != "" && req.Header.Get(requestIDHeader) == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set(requestIDHeader, id)
+	}
+	return t.base.RoundTrip(req)
+}
+
+// newDockerClient connects to the local Docker daemon, tagging every call
+// with the request ID for daemons and socket proxies that log headers.
+func newDockerClient(ctx context.Context) (*client.Client, error) {
+	httpClient, err := dockerHTTP()
+	if err != nil {
+		return nil, err
+	}
+	opts := []client.Opt{client.FromEnv, client.WithHTTPClient(httpClient), client.WithAPIVersionNegotiation()}
+	if id := logging.RequestID(ctx); id != "" {
+		opts = append(opts, client.WithHTTPHeaders(map[string]string{requestIDHeader: id}))
+	}
+	return client.NewClientWithOpts(opts...)
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"context"
+	"dockerap/config"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// role is what a logged-in user may do. Each role includes the ones below it.
+type role int
+
+const (
+	roleViewer   role = iota + 1 // sees containers, plans and replication history
+	roleOperator                 // selects containers and runs replication, sync and failback
+	roleAdmin                    // manages policies, credentials, rules and gates
+)
+
+var roleNames = map[role]string{roleViewer: "viewer", roleOperator: "operator", roleAdmin: "admin"}
+
+func (r role) String() string {
+	return roleNames[r]
+}
+
+func parseRole(name string) (role, bool) {
+	for r, n := range roleNames {
+		if strings.EqualFold(name, n) {
+			return r, true
+		}
+	}
+	return 0, false
+}
+
+// principal is the user a request is made by.
+type principal struct {
+	User string
+	Role role
+}
+
+type principalKey struct{}
+
+func withPrincipal(ctx context.Context, p principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// principalFrom returns the logged-in user; there is none when login is off.
+func principalFrom(ctx context.Context) (principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(principal)
+	return p, ok
+}
+
+// loadRoles reads UI_ROLES, a comma separated list of user=role, and
+// UI_DEFAULT_ROLE for everyone else. A single UI_USERNAME is an admin.
+func loadRoles(v *config.Validator, cfg *Config) {
+	cfg.Roles = make(map[string]role)
+	cfg.DefaultRole = roleViewer
+	if name := os.Getenv("UI_DEFAULT_ROLE"); name != "" {
+		r, ok := parseRole(name)
+		if !ok {
+			v.Add("UI_DEFAULT_ROLE", fmt.Sprintf("%q is not a role", name), "use viewer, operator or admin")
+		}
+		cfg.DefaultRole = r
+	}
+	if user := os.Getenv("UI_USERNAME"); user != "" && os.Getenv("UI_HTPASSWD_FILE") == "" {
+		cfg.Roles[user] = roleAdmin
+	}
+
+	for _, entry := range strings.Split(os.Getenv("UI_ROLES"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		user, name, _ := strings.Cut(entry, "=")
+		r, ok := parseRole(name)
+		if !ok {
+			v.Add("UI_ROLES", fmt.Sprintf("%q does not give a valid role", entry), "use user=viewer, user=operator or user=admin")
+			continue
+		}
+		if _, known := cfg.Users[user]; !known {
+			v.Add("UI_ROLES", fmt.Sprintf("user %q has no password", user), "add the user to UI_HTPASSWD_FILE or remove it from UI_ROLES")
+			continue
+		}
+		cfg.Roles[user] = r
+	}
+}
+
+// roleOf returns the role of a logged-in user.
+func (c *Config) roleOf(user string) role {
+	if r, ok := c.Roles[user]; ok {
+		return r
+	}
+	return c.DefaultRole
+}
+
+// allow guards a UI route by role: every request needs at least min, whatever
+// its method. Routes that only read but take a POST body, such as the plan,
+// pass roleViewer. Without a login everything is allowed.
+func (s *Server) allow(min role, next http.HandlerFunc) http.HandlerFunc {
+	return s.allowReads(min, min, next)
+}
+
+// allowReads guards a UI route that shows and changes the same settings:
+// reads (GET and HEAD) need read, every other method needs write.
+func (s *Server) allowReads(read, write role, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p, ok := principalFrom(r.Context())
+		if !ok {
+			next(w, r)
+			return
+		}
+		need := write
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			need = read
+		}
+		if p.Role < need {
+			slog.WarnContext(r.Context(), "Denied request beyond user role", "method", r.Method, "path", r.URL.Path, "user", p.User, "role", p.Role.String(), "needs", need.String())
+			http.Error(w, fmt.Sprintf("This requires the %s role", need), http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var testRoles = map[string]role{"vera": roleViewer, "otto": roleOperator, "ada": roleAdmin}
+
+func TestReadsAboveViewerNeedTheirRole(t *testing.T) {
+	srv := newTestServer(t, testRoles)
+	tests := []struct {
+		path   string
+		denied []string // users answered 403
+	}{
+		{"/api/peer-tokens", []string{"vera", "otto"}},
+		{"/api/exec/abc", []string{"vera", "otto"}},
+	}
+	for _, tt := range tests {
+		for _, user := range tt.denied {
+			for _, method := range []string{http.MethodGet, http.MethodHead} {
+				if w := serve(t, srv, method, tt.path, user, nil); w.Code != http.StatusForbidden {
+					t.Errorf("%s %s as %s: %d, want 403", method, tt.path, user, w.Code)
+				}
+			}
+		}
+	}
+
+	if w := serve(t, srv, http.MethodGet, "/api/peer-tokens", "ada", nil); w.Code != http.StatusOK {
+		t.Errorf("GET /api/peer-tokens as admin: %d %s, want 200", w.Code, w.Body)
+	}
+}
+
+func TestReadsOfSettingsRoutesNeedViewer(t *testing.T) {
+	srv := newTestServer(t, testRoles)
+	for _, path := range []string{"/api/gates", "/api/hooks", "/api/settings", "/api/profiles", "/api/notes?targetType=container&targetId=abc"} {
+		if w := serve(t, srv, http.MethodGet, path, "vera", nil); w.Code != http.StatusOK {
+			t.Errorf("GET %s as viewer: %d %s, want 200", path, w.Code, w.Body)
+		}
+	}
+	// A valid gate, so only the role can turn it away
+	const gate = `{"operation":"rollback","mode":"phrase"}`
+	if w := serve(t, srv, http.MethodPost, "/api/gates", "vera", strings.NewReader(gate)); w.Code != http.StatusForbidden {
+		t.Errorf("POST /api/gates as viewer: %d, want 403", w.Code)
+	}
+	if w := serve(t, srv, http.MethodPost, "/api/gates", "otto", strings.NewReader(gate)); w.Code != http.StatusForbidden {
+		t.Errorf("POST /api/gates as operator: %d, want 403", w.Code)
+	}
+	if w := serve(t, srv, http.MethodPost, "/api/gates", "ada", strings.NewReader(gate)); w.Code != http.StatusOK {
+		t.Errorf("POST /api/gates as admin: %d %s, want 200", w.Code, w.Body)
+	}
+	if w := serve(t, srv, http.MethodPut, "/api/settings", "otto", strings.NewReader(`{"replicationConcurrency":2}`)); w.Code != http.StatusForbidden {
+		t.Errorf("PUT /api/settings as operator: %d, want 403", w.Code)
+	}
+}
+
+func TestPeerTokenOnlyReachesDestinationAPI(t *testing.T) {
+	srv := newTestServer(t, testRoles)
+	const token = "peer-token-0123456789"
+	if err := srv.store.CreatePeerToken("source", "10.0.0.5", token); err != nil {
+		t.Fatal(err)
+	}
+	request := func(path string) int {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, r)
+		return w.Code
+	}
+
+	for _, path := range []string{"/api/about", "/api/containers", "/api/destinations", "/api/history"} {
+		if code := request(path); code != http.StatusUnauthorized {
+			t.Errorf("GET %s with a peer token: %d, want 401", path, code)
+		}
+	}
+	if code := request("/api/v1/about"); code != http.StatusOK {
+		t.Errorf("GET /api/v1/about with a peer token: %d, want 200", code)
+	}
+}
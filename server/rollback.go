@@ -0,0 +1,121 @@
+package server
+
+import (
+	"context"
+	"dockerap/apiclient"
+	"dockerap/labels"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/volume"
+)
+
+// managedLabels returns a copy of l with the job and source host labels
+// added. Resources that already exist on the destination keep their own
+// labels, so only what a job created carries its ID and can be rolled back or
+// garbage collected.
+func managedLabels(l map[string]string, jobID, sourceHost string) map[string]string {
+	out := make(map[string]string, len(l)+5)
+	for k, v := range l {
+		out[k] = v
+	}
+	if jobID != "" {
+		out[labels.Job] = jobID
+	}
+	out[labels.SourceHost] = sourceHost
+	return out
+}
+
+// rollbackJob asks dest to remove everything jobID created there.
+func rollbackJob(ctx context.Context, httpClient *http.Client, dest, jobID string) *apiclient.RemovedResources {
+	slog.InfoContext(ctx, "Rolling back job", "job_id", jobID, "dest", dest)
+	result, err := apiclient.New(dest, httpClient).RemoveJob(ctx, jobID)
+	if err != nil {
+		result = &apiclient.RemovedResources{Errors: []string{err.Error()}}
+	}
+	for _, e := range result.Errors {
+		slog.WarnContext(ctx, "Rollback error", "job_id", jobID, "dest", dest, "err", e)
+	}
+	return result
+}
+
+// Destination API: Remove the containers, volumes and networks a replication job created
+func (s *Server) handleRemoveJob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	jobID := r.URL.Query().Get("job")
+	if jobID == "" {
+		http.Error(w, "job is required", http.StatusBadRequest)
+		return
+	}
+
+	cli, err := newDockerClient(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to create docker client", "err", err)
+		writeError(w, r, "Unable to create docker client", err)
+		return
+	}
+	defer cli.Close()
+
+	ctx := r.Context()
+	byJob := filters.NewArgs(filters.Arg("label", labels.Job+"="+jobID))
+	result := apiclient.RemovedResources{Containers: []string{}, Volumes: []string{}, Networks: []string{}}
+
+	// Containers go first, since they hold the volumes and networks
+	containers, err := cli.ContainerList(ctx, container.ListOptions{All: true, Filters: byJob})
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("list containers: %s", err))
+	}
+	for _, c := range containers {
+		if err := cli.ContainerRemove(ctx, c.ID, container.RemoveOptions{Force: true, RemoveVolumes: true}); err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("remove container %s: %s", c.ID[:12], err))
+			continue
+		}
+		result.Containers = append(result.Containers, containerListName(c))
+	}
+
+	volumes, err := cli.VolumeList(ctx, volume.ListOptions{Filters: byJob})
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("list volumes: %s", err))
+	} else {
+		for _, v := range volumes.Volumes {
+			if err := cli.VolumeRemove(ctx, v.Name, false); err != nil {
+				result.Errors = append(result.Errors, fmt.Sprintf("remove volume %s: %s", v.Name, err))
+				continue
+			}
+			result.Volumes = append(result.Volumes, v.Name)
+		}
+	}
+
+	networks, err := cli.NetworkList(ctx, types.NetworkListOptions{Filters: byJob})
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("list networks: %s", err))
+	}
+	for _, n := range networks {
+		if err := cli.NetworkRemove(ctx, n.ID); err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("remove network %s: %s", n.Name, err))
+			continue
+		}
+		result.Networks = append(result.Networks, n.Name)
+	}
+
+	slog.InfoContext(ctx, "Removed job", "job_id", jobID, "containers", len(result.Containers), "volumes", len(result.Volumes), "networks", len(result.Networks), "errors", len(result.Errors))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// containerListName returns the first name of a listed container without the leading slash.
+func containerListName(c types.Container) string {
+	if len(c.Names) == 0 {
+		return c.ID[:12]
+	}
+	return strings.TrimPrefix(c.Names[0], "/")
+}
@@ -0,0 +1,231 @@
+package server
+
+import (
+	"context"
+	"dockerap/store"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+)
+
+// selectionRule is a parsed rule:
+//
+//	label:KEY         the container has label KEY
+//	label:KEY=VALUE   label KEY has exactly VALUE
+//	image=REF         the image reference is exactly REF
+//	image~=REGEXP     the image reference matches REGEXP
+//	name=NAME         the container is named NAME
+//	name~=REGEXP      the container name matches REGEXP
+type selectionRule struct {
+	field string // label, image or name
+	key   string // label key
+	value string
+	match *regexp.Regexp // set for ~=
+	any   bool           // label present with any value
+}
+
+// parseSelectionRule parses a rule such as "label:backup=true" or "image~=postgres".
+func parseSelectionRule(rule string) (*selectionRule, error) {
+	rule = strings.TrimSpace(rule)
+	if key, ok := strings.CutPrefix(rule, "label:"); ok {
+		r := &selectionRule{field: "label"}
+		r.key, r.value, ok = strings.Cut(key, "=")
+		r.any = !ok
+		if r.key == "" {
+			return nil, fmt.Errorf("rule %q: label key is required", rule)
+		}
+		return r, nil
+	}
+
+	for _, field := range []string{"image", "name"} {
+		rest, ok := strings.CutPrefix(rule, field)
+		if !ok {
+			continue
+		}
+		r := &selectionRule{field: field}
+		if pattern, ok := strings.CutPrefix(rest, "~="); ok {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("rule %q: %w", rule, err)
+			}
+			r.match = re
+			return r, nil
+		}
+		if value, ok := strings.CutPrefix(rest, "="); ok && value != "" {
+			r.value = value
+			return r, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid rule %q: expected label:KEY[=VALUE], image=REF, image~=REGEXP, name=NAME or name~=REGEXP", rule)
+}
+
+// matches reports whether the rule selects c.
+func (r *selectionRule) matches(c types.Container) bool {
+	switch r.field {
+	case "label":
+		v, ok := c.Labels[r.key]
+		return ok && (r.any || v == r.value)
+	case "image":
+		return r.matchValue(c.Image)
+	case "name":
+		for _, name := range c.Names {
+			if r.matchValue(strings.TrimPrefix(name, "/")) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (r *selectionRule) matchValue(v string) bool {
+	if r.match != nil {
+		return r.match.MatchString(v)
+	}
+	return v == r.value
+}
+
+// ruleMatches evaluates the stored rules against the live container list and
+// returns the ID of each matching container with the first rule it matched.
+// Rules that no longer parse are logged and skipped.
+func (s *Server) ruleMatches(ctx context.Context, cli *client.Client) (map[string]string, error) {
+	rules, err := s.store.GetSelectionRules()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get selection rules: %w", err)
+	}
+	matched := make(map[string]string)
+	if len(rules) == 0 {
+		return matched, nil
+	}
+
+	containers, err := cli.ContainerList(ctx, container.ListOptions{All: true})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list containers: %w", err)
+	}
+	for _, rule := range rules {
+		parsed, err := parseSelectionRule(rule.Rule)
+		if err != nil {
+			slog.WarnContext(ctx, "Skipping selection rule", "id", rule.ID, "err", err)
+			continue
+		}
+		for _, c := range containers {
+			if _, ok := matched[c.ID]; !ok && parsed.matches(c) {
+				matched[c.ID] = rule.Rule
+			}
+		}
+	}
+	return matched, nil
+}
+
+// addRuleMatches adds the containers the selection rules match to sel.
+func (s *Server) addRuleMatches(ctx context.Context, cli *client.Client, sel *selection) error {
+	matched, err := s.ruleMatches(ctx, cli)
+	if err != nil {
+		return err
+	}
+	for id := range matched {
+		sel.Containers[id] = true
+	}
+	return nil
+}
+
+// ruleInfo is a selection rule with the containers it currently matches.
+type ruleInfo struct {
+	store.SelectionRule
+	Matches []string `json:"matches"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// handleSelectionRules lists, adds and deletes selection rules. Listing also
+// shows which containers each rule matches right now.
+func (s *Server) handleSelectionRules(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		rules, err := s.store.GetSelectionRules()
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Unable to get selection rules", "err", err)
+			writeError(w, r, "Unable to get selection rules", err)
+			return
+		}
+
+		cli, err := newDockerClient(r.Context())
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Unable to create docker client", "err", err)
+			writeError(w, r, "Unable to create docker client", err)
+			return
+		}
+		defer cli.Close()
+		containers, err := cli.ContainerList(r.Context(), container.ListOptions{All: true})
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Unable to list containers", "err", err)
+			writeError(w, r, "Unable to list containers", err)
+			return
+		}
+
+		infos := []ruleInfo{}
+		for _, rule := range rules {
+			info := ruleInfo{SelectionRule: rule, Matches: []string{}}
+			parsed, err := parseSelectionRule(rule.Rule)
+			if err != nil {
+				info.Error = err.Error()
+			} else {
+				for _, c := range containers {
+					if parsed.matches(c) && len(c.Names) > 0 {
+						info.Matches = append(info.Matches, strings.TrimPrefix(c.Names[0], "/"))
+					}
+				}
+			}
+			infos = append(infos, info)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(infos)
+
+	case http.MethodPost:
+		var payload struct {
+			Rule string `json:"rule"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if _, err := parseSelectionRule(payload.Rule); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		id, err := s.store.AddSelectionRule(strings.TrimSpace(payload.Rule))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		slog.InfoContext(r.Context(), "Added selection rule", "id", id, "rule", payload.Rule)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]int64{"id": id})
+
+	case http.MethodDelete:
+		id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "id must be a number", http.StatusBadRequest)
+			return
+		}
+		if err := s.store.DeleteSelectionRule(id); err != nil {
+			if errors.Is(err, store.ErrRuleNotFound) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+
+	default:
+		http.Error(w, "Only GET, POST and DELETE methods are allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+)
+
+func TestSelectionRuleMatches(t *testing.T) {
+	db := types.Container{ID: "db1", Names: []string{"/shop-db"}, Image: "postgres:16", Labels: map[string]string{"backup": "true", "tier": "data"}}
+	web := types.Container{ID: "web1", Names: []string{"/shop-web"}, Image: "nginx:1.27", Labels: map[string]string{"backup": "false"}}
+	bare := types.Container{ID: "bare1", Names: []string{"/scratch"}, Image: "busybox"}
+
+	tests := []struct {
+		rule string
+		want []string // IDs of db, web and bare that match
+	}{
+		{"label:backup", []string{"db1", "web1"}},
+		{"label:backup=true", []string{"db1"}},
+		{"label:backup=", nil},
+		{"label:tier=data", []string{"db1"}},
+		{"image=postgres:16", []string{"db1"}},
+		{"image=postgres", nil},
+		{"image~=postgres", []string{"db1"}},
+		{"image~=^(nginx|busybox)", []string{"web1", "bare1"}},
+		{"name=shop-db", []string{"db1"}},
+		{"name=/shop-db", nil},
+		{"name~=^shop-", []string{"db1", "web1"}},
+		{"name~=db$", []string{"db1"}},
+		{"  name=scratch  ", []string{"bare1"}},
+	}
+	for _, tt := range tests {
+		r, err := parseSelectionRule(tt.rule)
+		if err != nil {
+			t.Errorf("parseSelectionRule(%q): %v", tt.rule, err)
+			continue
+		}
+		var got []string
+		for _, c := range []types.Container{db, web, bare} {
+			if r.matches(c) {
+				got = append(got, c.ID)
+			}
+		}
+		if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("%q matches %v, want %v", tt.rule, got, tt.want)
+		}
+	}
+}
+
+func TestParseSelectionRuleRejects(t *testing.T) {
+	for _, rule := range []string{"", "label:", "label:=true", "image", "image=", "name~=(", "tag=latest", "names=db"} {
+		if _, err := parseSelectionRule(rule); err == nil {
+			t.Errorf("parseSelectionRule(%q) succeeded, want an error", rule)
+		}
+	}
+}
+
+// fakeContainerList serves the container list as a Docker daemon would.
+func fakeContainerList(t *testing.T, containers []types.Container) *client.Client {
+	t.Helper()
+	daemon := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/containers/json") {
+			http.Error(w, `{"message":"page not found"}`, http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(containers)
+	}))
+	t.Cleanup(daemon.Close)
+	cli, err := client.NewClientWithOpts(client.WithHost("tcp://"+strings.TrimPrefix(daemon.URL, "http://")), client.WithVersion("1.43"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cli.Close() })
+	return cli
+}
+
+func TestRuleMatchesCreditsTheOldestRule(t *testing.T) {
+	cli := fakeContainerList(t, []types.Container{
+		{ID: "db1", Names: []string{"/shop-db"}, Image: "postgres:16", Labels: map[string]string{"backup": "true"}},
+		{ID: "web1", Names: []string{"/shop-web"}, Image: "nginx:1.27"},
+		{ID: "bare1", Names: []string{"/scratch"}, Image: "busybox"},
+	})
+
+	tests := []struct {
+		name  string
+		rules []string // in the order they were added
+		want  map[string]string
+	}{
+		{"no rules", nil, map[string]string{}},
+		{"label before name", []string{"label:backup=true", "name~=^shop-"},
+			map[string]string{"db1": "label:backup=true", "web1": "name~=^shop-"}},
+		{"name before label", []string{"name~=^shop-", "label:backup=true"},
+			map[string]string{"db1": "name~=^shop-", "web1": "name~=^shop-"}},
+		{"unparseable rule skipped", []string{"image~=(", "image~=busybox"},
+			map[string]string{"bare1": "image~=busybox"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestServer(t, nil)
+			for _, rule := range tt.rules {
+				// Stored as is, as a rule written by an older version might be
+				if _, err := srv.store.AddSelectionRule(rule); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, err := srv.ruleMatches(t.Context(), cli)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Errorf("matched %v, want %v", got, tt.want)
+			}
+			for id, rule := range tt.want {
+				if got[id] != rule {
+					t.Errorf("%s matched by %q, want %q", id, got[id], rule)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// RuntimeStats is a snapshot of this process's memory use.
+type RuntimeStats struct {
+	Goroutines   int    `json:"goroutines"`
+	HeapAlloc    uint64 `json:"heapAllocBytes"`
+	HeapSys      uint64 `json:"heapSysBytes"`
+	Sys          uint64 `json:"sysBytes"`
+	RSS          uint64 `json:"rssBytes"`     // 0 where /proc is unavailable
+	PeakRSS      uint64 `json:"peakRssBytes"` // high-water mark since start
+	NumGC        uint32 `json:"numGC"`
+	TotalAlloc   uint64 `json:"totalAllocBytes"`
+	PauseTotalNs uint64 `json:"pauseTotalNs"`
+}
+
+// readRuntimeStats collects Go runtime and kernel memory figures.
+func readRuntimeStats() RuntimeStats {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	stats := RuntimeStats{
+		Goroutines:   runtime.NumGoroutine(),
+		HeapAlloc:    ms.HeapAlloc,
+		HeapSys:      ms.HeapSys,
+		Sys:          ms.Sys,
+		NumGC:        ms.NumGC,
+		TotalAlloc:   ms.TotalAlloc,
+		PauseTotalNs: ms.PauseTotalNs,
+	}
+
+	f, err := os.Open("/proc/self/status")
+	if err != nil {
+		return stats
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			continue
+		}
+		kb, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch key {
+		case "VmRSS":
+			stats.RSS = kb * 1024
+		case "VmHWM":
+			stats.PeakRSS = kb * 1024
+		}
+	}
+	return stats
+}
+
+// handleRuntimeStats reports memory use so load tests can watch an instance
+// during a transfer.
+func (s *Server) handleRuntimeStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(readRuntimeStats())
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"dockerap/store"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+)
+
+// bulkSelectFilter picks the containers a bulk selection applies to. The
+// criteria combine, and at least one must be given; All matches every
+// container on its own.
+type bulkSelectFilter struct {
+	All     bool   `json:"all"`
+	Label   string `json:"label"`   // key or key=value
+	Project string `json:"project"` // Compose project name
+	Image   string `json:"image"`   // substring of the image, case-insensitive
+}
+
+// describe sums the filter up for the audit log, such as "project=web image=nginx".
+func (f bulkSelectFilter) describe() string {
+	var parts []string
+	if f.All {
+		parts = append(parts, "all")
+	}
+	for _, c := range []struct{ name, value string }{{"label", f.Label}, {"project", f.Project}, {"image", f.Image}} {
+		if v := strings.TrimSpace(c.value); v != "" {
+			parts = append(parts, c.name+"="+v)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// handleSelectBulk selects or deselects every container matching a filter in
+// one store transaction. Like /select, selecting also selects the containers'
+// named volumes and user-defined networks unless withDependencies is false.
+func (s *Server) handleSelectBulk(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var payload struct {
+		Filter           bulkSelectFilter `json:"filter"`
+		IsSelected       bool             `json:"isSelected"`
+		WithDependencies *bool            `json:"withDependencies"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	f := payload.Filter
+	q := containerQuery{Image: strings.TrimSpace(f.Image)}
+	if l := strings.TrimSpace(f.Label); l != "" {
+		q.Labels = append(q.Labels, l)
+	}
+	if p := strings.TrimSpace(f.Project); p != "" {
+		q.Labels = append(q.Labels, composeProjectLabel+"="+p)
+	}
+	if !f.All && q.Image == "" && len(q.Labels) == 0 {
+		http.Error(w, "The filter needs all, label, project or image", http.StatusBadRequest)
+		return
+	}
+	if payload.IsSelected {
+		setAuditAction(r, "selection:select")
+	} else {
+		setAuditAction(r, "selection:deselect")
+	}
+	withDeps := payload.IsSelected && (payload.WithDependencies == nil || *payload.WithDependencies)
+
+	cli, err := newDockerClient(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to create docker client", "err", err)
+		writeError(w, r, "Unable to create docker client", err)
+		return
+	}
+	defer cli.Close()
+
+	containers, err := cli.ContainerList(r.Context(), container.ListOptions{All: true})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to list containers", "err", err)
+		writeError(w, r, "Unable to list containers", err)
+		return
+	}
+	ids := []string{}
+	var selected []store.SelectedContainer
+	volumeSet := make(map[string]bool)
+	networkSet := make(map[string]bool)
+	for _, c := range containers {
+		if !q.match(c) {
+			continue
+		}
+		ids = append(ids, c.ID)
+		selected = append(selected, store.SelectedContainer{ID: c.ID, Name: containerListName(c)})
+		if !withDeps {
+			continue
+		}
+		// The list carries the mounts, so no inspect per container is needed
+		for _, m := range c.Mounts {
+			if m.Type == mount.TypeVolume && m.Name != "" && !isAnonymousVolume(m.Name) {
+				volumeSet[m.Name] = true
+			}
+		}
+		if c.NetworkSettings != nil {
+			for name := range c.NetworkSettings.Networks {
+				if !isPredefinedNetwork(name) {
+					networkSet[name] = true
+				}
+			}
+		}
+	}
+	volumes, networks := sortedKeys(volumeSet), sortedKeys(networkSet)
+
+	if err := s.store.SetContainersSelected(selected, volumes, networks, payload.IsSelected); err != nil {
+		slog.ErrorContext(r.Context(), "Unable to update selection", "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, id := range ids {
+		s.publishSelection(r, "container", id, "", payload.IsSelected)
+	}
+	for _, name := range volumes {
+		s.publishSelection(r, "volume", "", name, true)
+	}
+	for _, name := range networks {
+		s.publishSelection(r, "network", "", name, true)
+	}
+	setAuditTarget(r, f.describe(), fmt.Sprintf("%d containers, %d volumes, %d networks", len(ids), len(volumes), len(networks)))
+	slog.InfoContext(r.Context(), "Bulk selection updated", "selected", payload.IsSelected, "containers", len(ids), "volumes", len(volumes), "networks", len(networks))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"containers": ids,
+		"volumes":    volumes,
+		"networks":   networks,
+		"isSelected": payload.IsSelected,
+	})
+}
@@ -2,131 +2,463 @@ package server
 
 import (
 	"context"
+	"dockerap/apiclient"
 	"dockerap/store"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"html/template"
-	"io"
-	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
 	"strings"
+	"syscall"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/image"
-	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/mount"
 	"github.com/docker/docker/api/types/volume"
 	"github.com/docker/docker/client"
 )
 
 // Server holds the dependencies for the web server.
 type Server struct {
-	store *store.Store
+	store     store.Store
+	cfg       *Config
+	quiesce   quiescer
+	sessions  *sessionStore
+	templates *pageTemplates
+	live      *liveHub
+	execs     *execSessions
+	jobs      *jobTracker
+
+	destTransports destinationTransports
+	pairing        pairingCodes
+	settings       runtimeSettings
 }
 
-// NewServer creates a new Server instance.
-func NewServer(s *store.Store) *Server {
-	return &Server{store: s}
+// NewServer creates a new Server instance, parsing the UI templates once.
+func NewServer(s store.Store, cfg *Config) (*Server, error) {
+	srv := &Server{store: s, cfg: cfg, sessions: newSessionStore(), live: newLiveHub(), execs: newExecSessions(), jobs: newJobTracker()}
+	tmpl, err := srv.parseTemplates()
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse templates: %w", err)
+	}
+	srv.templates = tmpl
+	if err := srv.loadSettings(); err != nil {
+		return nil, fmt.Errorf("unable to load settings: %w", err)
+	}
+	return srv, nil
+}
+
+// Handler returns the server's routes on a mux of its own, so several
+// servers can run in one process. The web UI and its API sit behind the login,
+// and each route names the role it needs, or the roles it needs to read and
+// to change it; the destination API uses the shared token instead.
+func (s *Server) Handler() http.Handler {
+	ui := http.NewServeMux()
+	ui.HandleFunc("/", s.allow(roleViewer, s.handleListContainers))
+	ui.HandleFunc("/select", s.audited("selection", s.allow(roleOperator, s.handleSelect)))
+	ui.HandleFunc("/api/select-bulk", s.audited("selection", s.allow(roleOperator, s.handleSelectBulk)))
+	ui.HandleFunc("/ws", s.allow(roleViewer, s.handleLive))
+	ui.HandleFunc("/api/containers", s.allow(roleViewer, s.handleContainers))
+	ui.HandleFunc("/api/containers/search", s.allow(roleViewer, s.handleContainerSearch))
+	ui.HandleFunc("/api/hosts/containers", s.allow(roleViewer, s.handleHostContainers))
+	ui.HandleFunc("/api/containers/{id}", s.allow(roleViewer, s.handleContainerInspect))
+	ui.HandleFunc("/containers/{id}", s.allow(roleViewer, s.handleContainerDetail))
+	ui.HandleFunc("/fragments/containers/{id}", s.allow(roleViewer, s.handleContainerFragment))
+	ui.HandleFunc("/fragments/selection", s.allow(roleViewer, s.handleSelectionFragment))
+	ui.HandleFunc("/fragments/jobs", s.allow(roleViewer, s.handleJobFragments))
+	ui.HandleFunc("/fragments/jobs/{id}", s.allow(roleViewer, s.handleJobFragment))
+	ui.HandleFunc("/api/containers/{id}/{action}", s.allow(roleOperator, s.handleContainerAction))
+	ui.HandleFunc("/api/containers/{id}/logs", s.allow(roleViewer, s.handleContainerLogs))
+	ui.HandleFunc("/api/containers/{id}/stats", s.allow(roleViewer, s.handleContainerStats))
+	ui.HandleFunc("/api/containers/{id}/exec", s.allow(roleAdmin, s.handleExecCreate))
+	ui.HandleFunc("/api/exec/{id}", s.allow(roleAdmin, s.handleExecAttach))
+	ui.HandleFunc("/api/events", s.allow(roleViewer, s.handleEvents))
+	ui.HandleFunc("/api/images", s.allow(roleViewer, s.handleImages))
+	ui.HandleFunc("/api/images/{ref...}", s.allowReads(roleViewer, roleOperator, s.handleImage))
+	ui.HandleFunc("/api/volumes", s.allow(roleViewer, s.handleVolumes))
+	ui.HandleFunc("/api/volumes/{name}/export", s.allow(roleOperator, s.handleVolumeExport))
+	ui.HandleFunc("/api/volumes/{name}/import", s.allow(roleAdmin, s.handleVolumeImport))
+	ui.HandleFunc("/api/networks", s.allow(roleViewer, s.handleNetworks))
+	ui.HandleFunc("/api/networks/{name}", s.allow(roleViewer, s.handleNetwork))
+	ui.HandleFunc("/api/system/df", s.allow(roleViewer, s.handleSystemDF))
+	ui.HandleFunc("/api/prune/{kind}", s.allow(roleOperator, s.handlePrune))
+	ui.HandleFunc("/replicate", s.audited("replication", s.allow(roleOperator, s.handleReplicate)))
+	ui.HandleFunc("/api/plan", s.allow(roleViewer, s.handlePlan))
+	ui.HandleFunc("/api/compose-projects", s.allow(roleViewer, s.handleComposeProjects))
+	ui.HandleFunc("/api/compose/up", s.allow(roleAdmin, s.handleComposeUp))
+	ui.HandleFunc("/api/export/compose", s.allow(roleViewer, s.handleExportCompose))
+	ui.HandleFunc("/api/export/kubernetes", s.allow(roleViewer, s.handleExportKubernetes))
+	ui.HandleFunc("/api/export/systemd", s.allow(roleViewer, s.handleExportSystemd))
+	ui.HandleFunc("/api/profiles", s.audited("profile", s.allowReads(roleViewer, roleOperator, s.handleProfiles)))
+	ui.HandleFunc("/api/selection-rules", s.audited("selection-rule", s.allowReads(roleViewer, roleAdmin, s.handleSelectionRules)))
+	ui.HandleFunc("/api/verify", s.allow(roleViewer, s.handleVerify))
+	ui.HandleFunc("/api/reports", s.allow(roleViewer, s.handleReports))
+	ui.HandleFunc("/api/history", s.allow(roleViewer, s.handleHistory))
+	ui.HandleFunc("/history", s.allow(roleViewer, s.handleHistoryPage))
+	ui.HandleFunc("/api/reconcile", s.audited("reconcile", s.allow(roleOperator, s.handleReconcile)))
+	ui.HandleFunc("/api/failback", s.audited("failback", s.allow(roleOperator, s.handleFailback)))
+	ui.HandleFunc("/api/sync", s.audited("sync", s.allow(roleOperator, s.handleSync)))
+
+	// Replication policy endpoints
+	ui.HandleFunc("/api/image-policies", s.audited("image-policy", s.allowReads(roleViewer, roleAdmin, s.handleImagePolicies)))
+	ui.HandleFunc("/api/registry-credentials", s.audited("registry-credential", s.allowReads(roleViewer, roleAdmin, s.handleRegistryCredentials)))
+	ui.HandleFunc("/api/destinations", s.audited("destination", s.allowReads(roleViewer, roleAdmin, s.handleDestinations)))
+	ui.HandleFunc("/api/destinations/{name}", s.audited("destination", s.allowReads(roleViewer, roleAdmin, s.handleDestination)))
+	ui.HandleFunc("/api/hosts", s.audited("host", s.allowReads(roleViewer, roleAdmin, s.handleHosts)))
+	ui.HandleFunc("/api/hosts/{name}", s.audited("host", s.allowReads(roleViewer, roleAdmin, s.handleHost)))
+	ui.HandleFunc("/api/pair", s.allow(roleAdmin, s.handlePair))
+	ui.HandleFunc("/api/pairing-codes", s.allow(roleAdmin, s.handlePairingCodes))
+	ui.HandleFunc("/api/peer-tokens", s.allow(roleAdmin, s.handlePeerTokens))
+	ui.HandleFunc("/api/bind-mounts", s.audited("bind-mount", s.allow(roleAdmin, s.handleBindMounts)))
+	ui.HandleFunc("/api/volume-excludes", s.audited("volume-exclude", s.allowReads(roleViewer, roleAdmin, s.handleVolumeExcludes)))
+	ui.HandleFunc("/api/quiesce", s.audited("quiesce", s.allowReads(roleViewer, roleAdmin, s.handleQuiesce)))
+	ui.HandleFunc("/api/hooks", s.audited("hook", s.allowReads(roleViewer, roleAdmin, s.handleHooks)))
+	ui.HandleFunc("/api/start-policies", s.audited("start-policy", s.allowReads(roleViewer, roleAdmin, s.handleStartPolicies)))
+
+	// Audit log of state-changing requests
+	ui.HandleFunc("/api/audit", s.allow(roleAdmin, s.handleAudit))
+	// Settings that can be changed without a restart
+	ui.HandleFunc("/api/settings", s.audited("settings", s.allowReads(roleViewer, roleAdmin, s.handleSettings)))
+
+	// Confirmation gates for dangerous operations
+	ui.HandleFunc("/api/gates", s.audited("gate", s.allowReads(roleViewer, roleAdmin, s.handleGates)))
+	ui.HandleFunc("/api/approvals", s.allowReads(roleViewer, roleOperator, s.handleApprovals))
+	ui.HandleFunc("/api/approvals/approve", s.allow(roleAdmin, s.handleApprove))
+
+	// Inventory snapshots
+	ui.HandleFunc("/api/snapshots", s.audited("snapshot", s.allowReads(roleViewer, roleOperator, s.handleSnapshots)))
+	ui.HandleFunc("/api/snapshots/diff", s.allow(roleViewer, s.handleSnapshotDiff))
+
+	// Operator notes and tags
+	ui.HandleFunc("/api/notes", s.audited("note", s.allowReads(roleViewer, roleOperator, s.handleNotes)))
+	ui.HandleFunc("/api/tags", s.audited("tag", s.allowReads(roleViewer, roleOperator, s.handleTags)))
+
+	// Runtime diagnostics
+	ui.HandleFunc("/api/about", s.allow(roleViewer, s.handleAbout))
+	ui.HandleFunc("/api/runtime-stats", s.allow(roleViewer, s.handleRuntimeStats))
+
+	mux := http.NewServeMux()
+	mux.Handle("/", s.csrfProtect(s.requireLogin(ui)))
+	mux.Handle("/login", s.csrfProtect(http.HandlerFunc(s.handleLogin)))
+	mux.Handle("/logout", s.csrfProtect(http.HandlerFunc(s.handleLogout)))
+	mux.Handle("/metrics", s.requireToken(s.metricsHandler().ServeHTTP))
+	mux.HandleFunc("/healthz", s.handleHealthz)
+	mux.HandleFunc("/readyz", s.handleReadyz)
+	mux.HandleFunc("/api/openapi.json", s.handleOpenAPI)
+
+	// Destination API endpoints, guarded by the shared API token
+	mux.HandleFunc("/api/v1/pull-image", s.requireToken(s.handlePullImage))
+	mux.HandleFunc("/api/v1/load-image", s.requireToken(s.handleLoadImage))
+	mux.HandleFunc("/api/v1/image-layers", s.requireToken(s.handleImageLayers))
+	mux.HandleFunc("/api/v1/create-container", s.requireToken(s.handleCreateContainer))
+	mux.HandleFunc("/api/v1/create-volume", s.requireToken(s.handleCreateVolume))
+	mux.HandleFunc("/api/v1/create-network", s.requireToken(s.handleCreateNetwork))
+	mux.HandleFunc("/api/v1/restore-data", s.requireToken(s.handleRestoreData))
+	mux.HandleFunc("/api/v1/start-container", s.requireToken(s.handleStartContainer))
+	mux.HandleFunc("/api/v1/remove-job", s.requireToken(s.handleRemoveJob))
+	mux.HandleFunc("/api/v1/gc", s.requireToken(s.handleGC))
+	mux.HandleFunc("/api/v1/fingerprint", s.requireToken(s.handleFingerprint))
+	mux.HandleFunc("/api/v1/volume-manifest", s.requireToken(s.handleVolumeManifest))
+	mux.HandleFunc("/api/v1/export-data", s.requireToken(s.handleExportData))
+	mux.HandleFunc("/api/v1/checklist", s.requireToken(s.handleChecklist))
+	mux.HandleFunc("/api/v1/system-df", s.requireToken(s.handleSystemDF))
+	mux.HandleFunc("/api/v1/about", s.requireToken(s.handleAbout))
+	mux.HandleFunc("/api/v1/pair", s.handlePeerPair)
+	for _, path := range legacyDestinationPaths {
+		mux.HandleFunc(path, handleLegacyAPI)
+	}
+	return s.logRequests(s.cors(s.rateLimit(s.compress(s.problems(mux)))))
 }
 
-// Run starts the HTTP server.
-func (s *Server) Run() {
-	http.HandleFunc("/", s.handleListContainers)
-	http.HandleFunc("/select", s.handleSelect)
-	http.HandleFunc("/replicate", s.handleReplicate)
+// Run serves HTTP until the process receives SIGTERM or an interrupt, then
+// stops accepting connections and waits for in-flight requests, such as
+// running replications, to finish.
+func (s *Server) Run() error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	go s.runSnapshots(ctx)
+	go s.runAuditPruning(ctx)
+	go s.watchContainerEvents(ctx)
+
+	certFile, keyFile := s.cfg.TLSCertFile, s.cfg.TLSKeyFile
+	if s.cfg.TLSSelfSigned {
+		var err error
+		if certFile, keyFile, err = ensureSelfSignedCert(s.cfg.TLSDir, s.cfg.TLSHosts); err != nil {
+			return fmt.Errorf("self-signed certificate: %w", err)
+		}
+	}
+
+	httpServer := &http.Server{Addr: s.cfg.ListenAddr, Handler: s.Handler(), TLSConfig: s.cfg.serverTLSConfig()}
+	errCh := make(chan error, 1)
+	go func() {
+		if certFile != "" {
+			slog.Info("Starting HTTPS server", "addr", s.cfg.ListenAddr)
+			errCh <- httpServer.ListenAndServeTLS(certFile, keyFile)
+			return
+		}
+		slog.Info("Starting server", "addr", s.cfg.ListenAddr)
+		errCh <- httpServer.ListenAndServe()
+	}()
 
-	// Destination API endpoints
-	http.HandleFunc("/api/pull-image", s.handlePullImage)
-	http.HandleFunc("/api/create-container", s.handleCreateContainer)
-	http.HandleFunc("/api/create-volume", s.handleCreateVolume)
+	select {
+	case err := <-errCh:
+		return fmt.Errorf("failed to start server: %w", err)
+	case <-ctx.Done():
+	}
 
-	fmt.Println("Starting server on :8080")
-	if err := http.ListenAndServe(":8080", nil); err != nil {
-		log.Fatalf("Failed to start server: %s", err)
+	slog.Info("Shutting down, waiting for in-flight requests", "timeout", s.cfg.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.cfg.ShutdownTimeout)
+	defer cancel()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("shutdown: %w", err)
 	}
+	slog.Info("Server stopped")
+	return nil
 }
 
+// handleListContainers renders the UI, one page of containers at a time.
+// The query string filters and pages the list as for /api/containers.
 func (s *Server) handleListContainers(w http.ResponseWriter, r *http.Request) {
-	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	q, err := parseContainerQuery(r.URL.Query(), defaultContainerPageSize)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	cli, err := newDockerClient(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to create docker client", "err", err)
+		writeError(w, r, "Unable to create docker client", err)
+		return
+	}
+	defer cli.Close()
+
+	page, err := s.containerInfos(r.Context(), cli, "", q)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to build container list", "err", err)
+		writeError(w, r, "Unable to build container list", err)
+		return
+	}
+	slog.DebugContext(r.Context(), "Built container infos for template", "count", len(page.Containers), "total", page.Total)
+
+	// Issued before the page is written, while the cookie can still be set
+	csrf := s.csrfToken(w, r)
+	p, _ := principalFrom(r.Context())
+	tmpl, err := s.indexTemplate(csrf, p)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to parse template", "err", err)
+		writeError(w, r, "Unable to parse template", err)
+		return
+	}
+
+	err = tmpl.Execute(w, page)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to execute template", "err", err)
+		writeError(w, r, "Unable to execute template", err)
+		return
+	}
+	slog.DebugContext(r.Context(), "Template executed successfully")
+}
+
+// handleContainers returns the container list shown in the UI as JSON,
+// including selection state, mounts and per-container settings. Every
+// matching container is returned unless page or pageSize is given; the
+// X-Total-Count header carries the number matching and a Link header points
+// to the neighbouring pages.
+func (s *Server) handleContainers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q, err := parseContainerQuery(r.URL.Query(), 0)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	cli, err := newDockerClient(r.Context())
 	if err != nil {
-		log.Printf("ERROR: Unable to create docker client: %s", err)
-		http.Error(w, fmt.Sprintf("Unable to create docker client: %s", err), http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "Unable to create docker client", "err", err)
+		writeError(w, r, "Unable to create docker client", err)
 		return
 	}
 	defer cli.Close()
 
+	page, err := s.containerInfos(r.Context(), cli, "", q)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to build container list", "err", err)
+		writeError(w, r, "Unable to build container list", err)
+		return
+	}
+	containerInfos := page.Containers
+	if containerInfos == nil {
+		containerInfos = []ContainerInfo{}
+	}
+	w.Header().Set("X-Total-Count", strconv.Itoa(page.Total))
+	var links []string
+	if q.Page > 1 {
+		links = append(links, fmt.Sprintf(`<%s%s>; rel="prev"`, r.URL.Path, page.PageURL(q.Page-1)))
+	}
+	if q.Page < page.Pages() {
+		links = append(links, fmt.Sprintf(`<%s%s>; rel="next"`, r.URL.Path, page.PageURL(q.Page+1)))
+	}
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(containerInfos)
+}
+
+// handleContainerSearch is /api/containers with a required q: the
+// containers whose names, image, label values or network names contain
+// every word of it, filtered and paged like the full list.
+func (s *Server) handleContainerSearch(w http.ResponseWriter, r *http.Request) {
+	if strings.TrimSpace(r.URL.Query().Get("q")) == "" {
+		http.Error(w, "Missing search text in q", http.StatusBadRequest)
+		return
+	}
+	s.handleContainers(w, r)
+}
+
+// containerInfos lists the containers on the named Docker host, which cli
+// reaches, that match q, one page of them, with their selection state, mounts
+// and replication settings.
+func (s *Server) containerInfos(ctx context.Context, cli *client.Client, host string, q containerQuery) (containerPage, error) {
 	// Log Docker host and version info
-	info, err := cli.Info(context.Background())
+	info, err := cli.Info(ctx)
 	if err != nil {
-		log.Printf("ERROR: Unable to get Docker info: %s", err)
+		slog.ErrorContext(ctx, "Unable to get Docker info", "err", err)
 	} else {
-		log.Printf("Connected to Docker daemon. Containers: %d, Images: %d", info.Containers, info.Images)
+		slog.DebugContext(ctx, "Connected to Docker daemon", "containers", info.Containers, "images", info.Images)
 	}
 
-	containers, err := cli.ContainerList(context.Background(), container.ListOptions{All: true})
+	containers, err := cli.ContainerList(ctx, container.ListOptions{All: true})
 	if err != nil {
-		log.Printf("ERROR: Unable to list containers: %s", err)
-		http.Error(w, fmt.Sprintf("Unable to list containers: %s", err), http.StatusInternalServerError)
-		return
+		return containerPage{}, fmt.Errorf("unable to list containers: %w", err)
+	}
+
+	slog.DebugContext(ctx, "Listed containers", "count", len(containers))
+	// Resolved against every container, before the list is filtered in place
+	selectedContainers, err := s.resolveSelectedContainers(host, containers)
+	if err != nil {
+		return containerPage{}, fmt.Errorf("unable to get selected containers: %w", err)
 	}
+	slog.DebugContext(ctx, "Retrieved selected containers from store", "count", len(selectedContainers))
 
-	log.Printf("Successfully listed %d containers", len(containers))
+	matching := containers[:0]
+	for _, c := range containers {
+		if q.match(c) {
+			matching = append(matching, c)
+		}
+	}
+	page := containerPage{Query: q, Total: len(matching)}
+	containers = q.page(matching)
 	for i, c := range containers {
-		log.Printf("Container %d: ID=%s, Names=%v, Image=%s", i, c.ID[:12], c.Names, c.Image)
+		slog.DebugContext(ctx, "Container", "index", i, "id", c.ID[:12], "names", c.Names, "image", c.Image)
 	}
 
-	selectedContainers, err := s.store.GetSelectedContainers()
+	ruleMatches, err := s.ruleMatches(ctx, cli)
 	if err != nil {
-		log.Printf("ERROR: Unable to get selected containers: %s", err)
-		http.Error(w, fmt.Sprintf("Unable to get selected containers: %s", err), http.StatusInternalServerError)
-		return
+		return containerPage{}, fmt.Errorf("unable to evaluate selection rules: %w", err)
 	}
-	log.Printf("Retrieved %d selected containers from store", len(selectedContainers))
 
 	selectedVolumes, err := s.store.GetSelectedVolumes()
 	if err != nil {
-		log.Printf("ERROR: Unable to get selected volumes: %s", err)
-		http.Error(w, fmt.Sprintf("Unable to get selected volumes: %s", err), http.StatusInternalServerError)
-		return
+		return containerPage{}, fmt.Errorf("unable to get selected volumes: %w", err)
+	}
+	slog.DebugContext(ctx, "Retrieved selected volumes from store", "count", len(selectedVolumes))
+
+	selectedBinds, err := s.store.GetSelectedBindMounts()
+	if err != nil {
+		return containerPage{}, fmt.Errorf("unable to get selected bind mounts: %w", err)
+	}
+
+	volumeExcludes, err := s.store.GetVolumeExcludes()
+	if err != nil {
+		return containerPage{}, fmt.Errorf("unable to get volume excludes: %w", err)
+	}
+
+	quiesceModes, err := s.store.GetQuiesceModes()
+	if err != nil {
+		return containerPage{}, fmt.Errorf("unable to get quiesce modes: %w", err)
+	}
+
+	hooks, err := s.store.GetReplicationHooks()
+	if err != nil {
+		return containerPage{}, fmt.Errorf("unable to get replication hooks: %w", err)
+	}
+
+	startPolicies, err := s.store.GetStartPolicies()
+	if err != nil {
+		return containerPage{}, fmt.Errorf("unable to get start policies: %w", err)
+	}
+
+	containerTags, err := s.store.GetTags(store.TargetContainer)
+	if err != nil {
+		return containerPage{}, fmt.Errorf("unable to get container tags: %w", err)
+	}
+	notes, err := s.store.GetNotes(store.NoteFilter{TargetType: store.TargetContainer})
+	if err != nil {
+		return containerPage{}, fmt.Errorf("unable to get container notes: %w", err)
+	}
+	containerNotes := make(map[string][]store.Note)
+	for _, n := range notes {
+		containerNotes[n.TargetID] = append(containerNotes[n.TargetID], n)
+	}
+
+	imagePolicies, err := s.store.ResolveImagePolicies(selectionHost(host), liveNames(containers))
+	if err != nil {
+		return containerPage{}, fmt.Errorf("unable to get image policies: %w", err)
 	}
-	log.Printf("Retrieved %d selected volumes from store", len(selectedVolumes))
 
 	var containerInfos []ContainerInfo
 	for _, c := range containers {
 		var mounts []MountInfo
 		for _, m := range c.Mounts {
-			mounts = append(mounts, MountInfo{
+			info := MountInfo{
 				MountPoint: m,
 				IsSelected: selectedVolumes[m.Name],
-			})
+				Excludes:   strings.Join(volumeExcludes[m.Name], ", "),
+			}
+			if m.Type == mount.TypeBind {
+				info.IsSelected = false
+				for _, b := range selectedBinds[c.ID] {
+					if b.Source == m.Source {
+						info.IsSelected = true
+						info.TargetPath = b.TargetPath
+					}
+				}
+			}
+			mounts = append(mounts, info)
 		}
 		containerInfos = append(containerInfos, ContainerInfo{
-			ID:         c.ID,
-			Names:      c.Names,
-			Image:      c.Image,
-			State:      c.State,
-			Status:     c.Status,
-			Mounts:     mounts,
-			IsSelected: selectedContainers[c.ID],
+			ID:          c.ID,
+			Names:       c.Names,
+			Image:       c.Image,
+			State:       c.State,
+			Status:      c.Status,
+			Mounts:      mounts,
+			IsSelected:  selectedContainers[c.ID] || ruleMatches[c.ID] != "",
+			MatchedRule: ruleMatches[c.ID],
+			ImagePolicy: imagePolicies[c.ID],
+			Quiesce:     quiesceModes[c.ID],
+			PreHook:     hooks[c.ID].Pre,
+			PostHook:    hooks[c.ID].Post,
+			StartPolicy: startPolicies[c.ID],
+			Tags:        containerTags[c.ID],
+			Notes:       containerNotes[c.ID],
 		})
 	}
-	log.Printf("Built %d containerInfos for template", len(containerInfos))
-
-	tmpl, err := template.ParseFiles("templates/index.html")
-	if err != nil {
-		log.Printf("ERROR: Unable to parse template: %s", err)
-		http.Error(w, fmt.Sprintf("Unable to parse template: %s", err), http.StatusInternalServerError)
-		return
-	}
-	log.Printf("Template parsed successfully")
-
-	err = tmpl.Execute(w, containerInfos)
-	if err != nil {
-		log.Printf("ERROR: Unable to execute template: %s", err)
-		http.Error(w, fmt.Sprintf("Unable to execute template: %s", err), http.StatusInternalServerError)
-		return
-	}
-	log.Printf("Template executed successfully")
+	page.Containers = containerInfos
+	return page, nil
 }
 
 func (s *Server) handleSelect(w http.ResponseWriter, r *http.Request) {
@@ -140,21 +472,138 @@ func (s *Server) handleSelect(w http.ResponseWriter, r *http.Request) {
 		ID         string `json:"id"`
 		Name       string `json:"name"`
 		IsSelected bool   `json:"isSelected"`
+		// Selecting a container also selects its named volumes and user-defined
+		// networks unless this is false
+		WithDependencies *bool `json:"withDependencies"`
+		// Docker host the container is on, stored under /api/hosts; local by default.
+		// Containers are selected per host.
+		Host string `json:"host"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
+	if payload.IsSelected {
+		setAuditAction(r, "selection:select")
+	} else {
+		setAuditAction(r, "selection:deselect")
+	}
+	target := payload.ID
+	if target == "" {
+		target = payload.Name
+	}
+	setAuditTarget(r, payload.Type+" "+target, "")
+	if payload.Type == "network" && isPredefinedNetwork(payload.Name) {
+		http.Error(w, fmt.Sprintf("Network %s exists on every host and cannot be selected", payload.Name), http.StatusBadRequest)
+		return
+	}
+	if payload.Type == "image" {
+		ref, err := normalizeImageRef(payload.Name)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid image reference %s: %s", payload.Name, err), http.StatusBadRequest)
+			return
+		}
+		payload.Name = ref
+	}
+
+	if payload.Type == "container" && payload.IsSelected && (payload.WithDependencies == nil || *payload.WithDependencies) {
+		deps, err := s.containerDependencies(r.Context(), payload.Host, payload.ID)
+		if errors.Is(err, store.ErrHostNotFound) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Unable to inspect container", "id", payload.ID, "err", err)
+			writeError(w, r, "Unable to inspect container", err)
+			return
+		}
+		c := store.SelectedContainer{Host: selectionHost(payload.Host), ID: payload.ID, Name: deps.name}
+		if err := s.store.SetContainersSelected([]store.SelectedContainer{c}, deps.Volumes, deps.Networks, true); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		s.publishSelection(r, "container", payload.ID, "", true)
+		for _, name := range deps.Volumes {
+			s.publishSelection(r, "volume", "", name, true)
+		}
+		for _, name := range deps.Networks {
+			s.publishSelection(r, "network", "", name, true)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(deps)
+		return
+	}
 
-	if err := s.store.UpdateSelection(payload.Type, payload.ID, payload.Name, payload.IsSelected); err != nil {
+	var err error
+	if payload.Type == "container" {
+		// The name is optional; it is learnt once the container is listed
+		c := store.SelectedContainer{Host: selectionHost(payload.Host), ID: payload.ID, Name: payload.Name}
+		err = s.store.SetContainersSelected([]store.SelectedContainer{c}, nil, nil, payload.IsSelected)
+	} else {
+		err = s.store.UpdateSelection(payload.Type, payload.Name, payload.IsSelected)
+	}
+	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	s.publishSelection(r, payload.Type, payload.ID, payload.Name, payload.IsSelected)
 
 	w.WriteHeader(http.StatusOK)
 }
 
+// selectionDependencies are the resources a container needs on the destination.
+type selectionDependencies struct {
+	Volumes  []string `json:"volumes"`  // named volumes, selected along with the container
+	Networks []string `json:"networks"` // user-defined networks, selected along with the container
+	name     string   // of the container, for the store
+}
+
+// containerDependencies lists the named volumes and user-defined networks of
+// a container on the named Docker host.
+func (s *Server) containerDependencies(ctx context.Context, host, id string) (selectionDependencies, error) {
+	deps := selectionDependencies{Volumes: []string{}, Networks: []string{}}
+	cli, err := s.dockerClientFor(ctx, host)
+	if err != nil {
+		return deps, err
+	}
+	defer cli.Close()
+
+	inspect, err := cli.ContainerInspect(ctx, id)
+	if err != nil {
+		return deps, err
+	}
+	deps.name = containerName(inspect)
+	for _, m := range inspect.Mounts {
+		// Anonymous volumes are recreated empty with the container, so only named ones count
+		if m.Type == mount.TypeVolume && m.Name != "" && !isAnonymousVolume(m.Name) {
+			deps.Volumes = append(deps.Volumes, m.Name)
+		}
+	}
+	if inspect.NetworkSettings != nil {
+		for name := range inspect.NetworkSettings.Networks {
+			if !isPredefinedNetwork(name) {
+				deps.Networks = append(deps.Networks, name)
+			}
+		}
+	}
+	sort.Strings(deps.Networks)
+	return deps, nil
+}
+
+// isAnonymousVolume reports whether name looks like a volume Docker named itself (64 hex characters).
+func isAnonymousVolume(name string) bool {
+	if len(name) != 64 {
+		return false
+	}
+	for _, c := range name {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return false
+		}
+	}
+	return true
+}
+
 // Destination API: Pull an image
 func (s *Server) handlePullImage(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -162,71 +611,187 @@ func (s *Server) handlePullImage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var payload struct {
-		ImageName string `json:"imageName"`
-	}
-
+	var payload apiclient.PullImageRequest
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	log.Printf("Pulling image: %s", payload.ImageName)
+	pullRef := payload.ImageName
+	if payload.Digest != "" {
+		ref, err := pinnedRef(payload.ImageName, payload.Digest)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid image reference: %s", err), http.StatusBadRequest)
+			return
+		}
+		pullRef = ref
+	}
 
-	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	// Inline credentials win over a stored reference, which wins over a
+	// credential stored for the image's registry on this host
+	cred := registryCredential(payload.RegistryAuth)
+	if cred == nil && payload.CredentialRef != "" {
+		stored, err := s.store.GetRegistryCredential(payload.CredentialRef)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Unable to use credential %s: %s", payload.CredentialRef, err), http.StatusBadRequest)
+			return
+		}
+		cred = stored
+	}
+	var registryAuth string
+	if cred != nil {
+		auth, err := encodeRegistryAuth(cred)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid registry credential: %s", err), http.StatusBadRequest)
+			return
+		}
+		registryAuth = auth
+	} else {
+		registryAuth = s.registryAuthForImage(payload.ImageName)
+	}
+
+	slog.InfoContext(r.Context(), "Pulling image", "pull_ref", pullRef)
+
+	cli, err := newDockerClient(r.Context())
 	if err != nil {
-		log.Printf("ERROR: Unable to create docker client: %s", err)
-		http.Error(w, fmt.Sprintf("Unable to create docker client: %s", err), http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "Unable to create docker client", "err", err)
+		writeError(w, r, "Unable to create docker client", err)
 		return
 	}
 	defer cli.Close()
 
-	out, err := cli.ImagePull(context.Background(), payload.ImageName, image.PullOptions{})
+	ctx := context.WithoutCancel(r.Context())
+	out, err := cli.ImagePull(ctx, pullRef, image.PullOptions{RegistryAuth: registryAuth})
 	if err != nil {
-		log.Printf("ERROR: Failed to pull image %s: %s", payload.ImageName, err)
-		http.Error(w, fmt.Sprintf("Failed to pull image: %s", err), http.StatusInternalServerError)
+		slog.ErrorContext(ctx, "Failed to pull image", "pull_ref", pullRef, "err", err)
+		writeProblem(w, r, http.StatusInternalServerError, codeImagePullFailed, fmt.Sprintf("Failed to pull image: %s", err))
 		return
 	}
-	io.Copy(io.Discard, out)
+	err = drainJSONMessages(out)
 	out.Close()
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to pull image", "pull_ref", pullRef, "err", err)
+		writeError(w, r, "Failed to pull image", err)
+		return
+	}
 
-	log.Printf("Successfully pulled image: %s", payload.ImageName)
+	if payload.Digest != "" {
+		// Verify the pulled image really carries the digest, then point the tag at it
+		img, _, err := cli.ImageInspectWithRaw(ctx, pullRef)
+		if err != nil {
+			slog.ErrorContext(ctx, "Unable to inspect pulled image", "pull_ref", pullRef, "err", err)
+			writeError(w, r, "Unable to inspect pulled image", err)
+			return
+		}
+		if repoDigest(img.RepoDigests, payload.ImageName) != payload.Digest {
+			slog.ErrorContext(ctx, "Pulled image does not match digest", "pull_ref", pullRef, "digest", payload.Digest)
+			writeProblem(w, r, http.StatusInternalServerError, codeImagePullFailed, fmt.Sprintf("Pulled image does not match digest %s", payload.Digest))
+			return
+		}
+		if !isDigestRef(payload.ImageName) {
+			if err := cli.ImageTag(ctx, img.ID, payload.ImageName); err != nil {
+				slog.ErrorContext(ctx, "Failed to tag image", "pull_ref", pullRef, "image_name", payload.ImageName, "err", err)
+				writeError(w, r, "Failed to tag image", err)
+				return
+			}
+		}
+	}
+
+	if payload.TagAs != "" {
+		if err := cli.ImageTag(ctx, pullRef, payload.TagAs); err != nil {
+			slog.ErrorContext(ctx, "Failed to tag image", "pull_ref", pullRef, "tag_as", payload.TagAs, "err", err)
+			writeError(w, r, "Failed to tag image", err)
+			return
+		}
+	}
+
+	slog.InfoContext(ctx, "Successfully pulled image", "pull_ref", pullRef)
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
 }
 
-// Destination API: Create a container
-func (s *Server) handleCreateContainer(w http.ResponseWriter, r *http.Request) {
+// Destination API: Load an image from a docker save tar stream. The optional
+// id and tag query parameters tag the loaded image so containers can
+// reference it by name.
+func (s *Server) handleLoadImage(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	var payload struct {
-		Name          string                      `json:"name"`
-		Config        *container.Config           `json:"config"`
-		HostConfig    *container.HostConfig       `json:"hostConfig"`
-		NetworkConfig *network.NetworkingConfig   `json:"networkConfig"`
+	imageID := r.URL.Query().Get("id")
+	tag := r.URL.Query().Get("tag")
+	slog.InfoContext(r.Context(), "Loading image", "tag", tag, "image_id", imageID)
+
+	cli, err := newDockerClient(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to create docker client", "err", err)
+		writeError(w, r, "Unable to create docker client", err)
+		return
+	}
+	defer cli.Close()
+
+	ctx := context.WithoutCancel(r.Context())
+	resp, err := cli.ImageLoad(ctx, r.Body, true)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to load image", "tag", tag, "err", err)
+		writeError(w, r, "Failed to load image", err)
+		return
+	}
+	err = drainJSONMessages(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to load image", "tag", tag, "err", err)
+		writeError(w, r, "Failed to load image", err)
+		return
+	}
+
+	if imageID != "" && tag != "" {
+		if err := cli.ImageTag(ctx, imageID, tag); err != nil {
+			slog.ErrorContext(ctx, "Failed to tag image", "image_id", imageID, "tag", tag, "err", err)
+			writeError(w, r, "Failed to tag image", err)
+			return
+		}
+	}
+
+	slog.InfoContext(ctx, "Successfully loaded image", "tag", tag)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
+
+// Destination API: Create a container
+func (s *Server) handleCreateContainer(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		return
 	}
 
+	var payload apiclient.CreateContainerRequest
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		log.Printf("ERROR: Invalid request body: %s", err)
+		slog.ErrorContext(r.Context(), "Invalid request body", "err", err)
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	log.Printf("Creating container: %s", payload.Name)
+	if v := s.currentCreatePolicy().violations(payload); len(v) > 0 {
+		slog.WarnContext(r.Context(), "Rejected container by policy", "name", payload.Name, "violations", v)
+		writeProblem(w, r, http.StatusForbidden, codePolicyDenied, fmt.Sprintf("Rejected by this destination's policy: %s", strings.Join(v, "; ")))
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Creating container", "name", payload.Name)
 
-	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	cli, err := newDockerClient(r.Context())
 	if err != nil {
-		log.Printf("ERROR: Unable to create docker client: %s", err)
-		http.Error(w, fmt.Sprintf("Unable to create docker client: %s", err), http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "Unable to create docker client", "err", err)
+		writeError(w, r, "Unable to create docker client", err)
 		return
 	}
 	defer cli.Close()
 
+	ctx := context.WithoutCancel(r.Context())
 	createdCont, err := cli.ContainerCreate(
-		context.Background(),
+		ctx,
 		payload.Config,
 		payload.HostConfig,
 		payload.NetworkConfig,
@@ -234,12 +799,19 @@ func (s *Server) handleCreateContainer(w http.ResponseWriter, r *http.Request) {
 		payload.Name,
 	)
 	if err != nil {
-		log.Printf("ERROR: Failed to create container %s: %s", payload.Name, err)
-		http.Error(w, fmt.Sprintf("Failed to create container: %s", err), http.StatusInternalServerError)
+		slog.ErrorContext(ctx, "Failed to create container", "name", payload.Name, "err", err)
+		writeError(w, r, "Failed to create container", err)
+		return
+	}
+
+	slog.InfoContext(ctx, "Successfully created container", "name", payload.Name, "id", createdCont.ID)
+
+	if err := applyStartPolicy(ctx, cli, createdCont.ID, payload.StartPolicy); err != nil {
+		slog.ErrorContext(ctx, "Created container but failed to apply start policy", "name", payload.Name, "start_policy", payload.StartPolicy, "err", err)
+		writeError(w, r, "Created container but failed to apply start policy", err)
 		return
 	}
 
-	log.Printf("Successfully created container: %s (ID: %s)", payload.Name, createdCont.ID)
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{
 		"status":      "success",
@@ -254,31 +826,24 @@ func (s *Server) handleCreateVolume(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var payload struct {
-		Name       string            `json:"name"`
-		Driver     string            `json:"driver"`
-		DriverOpts map[string]string `json:"driverOpts"`
-		Labels     map[string]string `json:"labels"`
-		VolumeData []byte            `json:"volumeData"` // Base64 encoded tar.gz
-	}
-
+	var payload apiclient.CreateVolumeRequest
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		log.Printf("ERROR: Invalid request body: %s", err)
+		slog.ErrorContext(r.Context(), "Invalid request body", "err", err)
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	log.Printf("Creating volume: %s", payload.Name)
+	slog.InfoContext(r.Context(), "Creating volume", "name", payload.Name)
 
-	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	cli, err := newDockerClient(r.Context())
 	if err != nil {
-		log.Printf("ERROR: Unable to create docker client: %s", err)
-		http.Error(w, fmt.Sprintf("Unable to create docker client: %s", err), http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "Unable to create docker client", "err", err)
+		writeError(w, r, "Unable to create docker client", err)
 		return
 	}
 	defer cli.Close()
 
-	ctx := context.Background()
+	ctx := context.WithoutCancel(r.Context())
 
 	// Create the volume
 	vol, err := cli.VolumeCreate(ctx, volume.CreateOptions{
@@ -288,15 +853,15 @@ func (s *Server) handleCreateVolume(w http.ResponseWriter, r *http.Request) {
 		Labels:     payload.Labels,
 	})
 	if err != nil {
-		log.Printf("ERROR: Failed to create volume %s: %s", payload.Name, err)
-		http.Error(w, fmt.Sprintf("Failed to create volume: %s", err), http.StatusInternalServerError)
+		slog.ErrorContext(ctx, "Failed to create volume", "name", payload.Name, "err", err)
+		writeError(w, r, "Failed to create volume", err)
 		return
 	}
 
-	log.Printf("Successfully created volume: %s", vol.Name)
+	slog.InfoContext(ctx, "Successfully created volume", "name", vol.Name)
 
-	// TODO: If volumeData is provided, populate the volume
-	// This would require creating a temporary container to extract the data
+	// Volume contents are restored through the replica that mounts the
+	// volume once it has been created, see handleRestoreData
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{
@@ -305,161 +870,97 @@ func (s *Server) handleCreateVolume(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func (s *Server) handleReplicate(w http.ResponseWriter, r *http.Request) {
+// Destination API: Create a network
+func (s *Server) handleCreateNetwork(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	var payload struct {
-		DestinationURL    string `json:"destinationHost"` // URL of destination app (e.g., http://5.6.7.8:8080)
-		SourceHostAddress string `json:"sourceHostAddress"`
-	}
-
+	var payload apiclient.CreateNetworkRequest
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		slog.ErrorContext(r.Context(), "Invalid request body", "err", err)
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	if payload.DestinationURL == "" || payload.SourceHostAddress == "" {
-		http.Error(w, "Destination and source host addresses cannot be empty", http.StatusBadRequest)
-		return
-	}
+	slog.InfoContext(r.Context(), "Creating network", "name", payload.Name)
 
-	log.Printf("Replication started for destination: %s", payload.DestinationURL)
-
-	// Get source Docker client
-	srcCli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	cli, err := newDockerClient(r.Context())
 	if err != nil {
-		log.Printf("ERROR: Unable to create source docker client: %s", err)
-		http.Error(w, fmt.Sprintf("Unable to create source docker client: %s", err), http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "Unable to create docker client", "err", err)
+		writeError(w, r, "Unable to create docker client", err)
 		return
 	}
-	defer srcCli.Close()
+	defer cli.Close()
 
-	// Get selected items from store
-	selectedContainers, err := s.store.GetSelectedContainers()
-	if err != nil {
-		log.Printf("ERROR: Unable to get selected containers: %s", err)
-		http.Error(w, fmt.Sprintf("Unable to get selected containers: %s", err), http.StatusInternalServerError)
-		return
-	}
-	selectedVolumes, err := s.store.GetSelectedVolumes()
+	ctx := context.WithoutCancel(r.Context())
+
+	// Networks are shared by several containers, so an existing one is reused
+	existing, err := cli.NetworkList(ctx, types.NetworkListOptions{Filters: filters.NewArgs(filters.Arg("name", payload.Name))})
 	if err != nil {
-		log.Printf("ERROR: Unable to get selected volumes: %s", err)
-		http.Error(w, fmt.Sprintf("Unable to get selected volumes: %s", err), http.StatusInternalServerError)
+		slog.ErrorContext(ctx, "Unable to list networks", "err", err)
+		writeError(w, r, "Unable to list networks", err)
 		return
 	}
-
-	ctx := context.Background()
-	httpClient := &http.Client{}
-
-	// --- Volume Replication via API ---
-	for volName := range selectedVolumes {
-		log.Printf("Replicating volume: %s", volName)
-		srcVol, err := srcCli.VolumeInspect(ctx, volName)
-		if err != nil {
-			log.Printf("Failed to inspect source volume %s: %s", volName, err)
-			continue
-		}
-
-		// Call destination app's API to create volume
-		volPayload := map[string]interface{}{
-			"name":       srcVol.Name,
-			"driver":     srcVol.Driver,
-			"driverOpts": srcVol.Options,
-			"labels":     srcVol.Labels,
-		}
-		jsonData, _ := json.Marshal(volPayload)
-		resp, err := httpClient.Post(payload.DestinationURL+"/api/create-volume", "application/json", strings.NewReader(string(jsonData)))
-		if err != nil {
-			log.Printf("Failed to create volume %s on destination: %s", volName, err)
-			continue
-		}
-		resp.Body.Close()
-
-		if resp.StatusCode != http.StatusOK {
-			log.Printf("Failed to create volume %s on destination: HTTP %d", volName, resp.StatusCode)
-			continue
+	for _, n := range existing {
+		if n.Name == payload.Name {
+			slog.InfoContext(ctx, "Network already exists", "name", n.Name, "id", n.ID)
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(map[string]string{
+				"status":    "exists",
+				"networkID": n.ID,
+			})
+			return
 		}
-
-		log.Printf("Successfully replicated volume: %s", volName)
 	}
 
-	// --- Container Replication via API ---
-	for containerID := range selectedContainers {
-		log.Printf("Replicating container: %s", containerID)
-		srcCont, err := srcCli.ContainerInspect(ctx, containerID)
-		if err != nil {
-			log.Printf("Failed to inspect source container %s: %s", containerID, err)
-			continue
-		}
-
-		// Call destination app's API to pull image
-		imgPayload := map[string]string{"imageName": srcCont.Config.Image}
-		jsonData, _ := json.Marshal(imgPayload)
-		resp, err := httpClient.Post(payload.DestinationURL+"/api/pull-image", "application/json", strings.NewReader(string(jsonData)))
-		if err != nil {
-			log.Printf("Failed to pull image %s on destination: %s", srcCont.Config.Image, err)
-			continue
-		}
-		resp.Body.Close()
-
-		if resp.StatusCode != http.StatusOK {
-			log.Printf("Failed to pull image %s on destination: HTTP %d", srcCont.Config.Image, resp.StatusCode)
-			continue
-		}
-
-		// Call destination app's API to create container
-		var containerName string
-		if len(srcCont.Name) > 1 {
-			containerName = strings.TrimPrefix(srcCont.Name, "/")
-		}
-
-		contPayload := map[string]interface{}{
-			"name":          containerName,
-			"config":        srcCont.Config,
-			"hostConfig":    srcCont.HostConfig,
-			"networkConfig": &network.NetworkingConfig{EndpointsConfig: srcCont.NetworkSettings.Networks},
-		}
-		jsonData, _ = json.Marshal(contPayload)
-		resp, err = httpClient.Post(payload.DestinationURL+"/api/create-container", "application/json", strings.NewReader(string(jsonData)))
-		if err != nil {
-			log.Printf("Failed to create container %s on destination: %s", containerName, err)
-			continue
-		}
-		resp.Body.Close()
-
-		if resp.StatusCode != http.StatusOK {
-			log.Printf("Failed to create container %s on destination: HTTP %d", containerName, resp.StatusCode)
-			continue
-		}
-
-		log.Printf("Successfully replicated container: %s", containerName)
+	created, err := cli.NetworkCreate(ctx, payload.Name, types.NetworkCreate{
+		Driver:     payload.Driver,
+		Options:    payload.Options,
+		Labels:     payload.Labels,
+		IPAM:       payload.IPAM,
+		Internal:   payload.Internal,
+		Attachable: payload.Attachable,
+		EnableIPv6: payload.EnableIPv6,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to create network", "name", payload.Name, "err", err)
+		writeError(w, r, "Failed to create network", err)
+		return
 	}
 
-	log.Println("Replication process finished.")
+	slog.InfoContext(ctx, "Successfully created network", "name", payload.Name, "id", created.ID)
 	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"status":    "success",
+		"networkID": created.ID,
+	})
 }
 
-// These would be unexported helper methods called by handleReplicate
-// func (s *Server) replicateVolumes(...)
-// func (s *Server) replicateContainers(...)
-// func (s *Server) deployMonitor(...)
-
 // --- Data structures for the template ---
 
 type MountInfo struct {
 	types.MountPoint
 	IsSelected bool
+	TargetPath string // destination host path for selected bind mounts
+	Excludes   string // comma-separated exclude patterns for volumes
 }
 
 type ContainerInfo struct {
-	ID         string
-	Names      []string
-	Image      string
-	State      string
-	Status     string
-	Mounts     []MountInfo
-	IsSelected bool
+	ID          string
+	Names       []string
+	Image       string
+	State       string
+	Status      string
+	Mounts      []MountInfo
+	IsSelected  bool
+	MatchedRule string // selection rule that selects the container, if any
+	ImagePolicy string // per-container override, empty when the default applies
+	Quiesce     string // pause or stop while volumes are copied, empty for none
+	StartPolicy string // what the replica does once created, empty for created only
+	PreHook     string // command run in the container before its volumes are copied
+	PostHook    string // command run after the copy
+	Tags        []string
+	Notes       []store.Note
 }
@@ -0,0 +1,204 @@
+package server
+
+import (
+	"dockerap/store"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestServer returns a server on an empty in-memory store. Each user in
+// roles can log in with that role; with none, the UI needs no login.
+func newTestServer(t *testing.T, roles map[string]role) *Server {
+	t.Helper()
+	st, err := store.NewMemoryStore()
+	if err != nil {
+		t.Fatalf("NewMemoryStore: %v", err)
+	}
+	t.Cleanup(st.Close)
+
+	cfg := &Config{SessionTTL: time.Hour, Roles: make(map[string]role), DefaultRole: roleViewer}
+	if len(roles) > 0 {
+		cfg.Users = make(map[string]string)
+		for user, r := range roles {
+			cfg.Users[user] = "secret"
+			cfg.Roles[user] = r
+		}
+	}
+	srv, err := NewServer(st, cfg)
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	return srv
+}
+
+// serve sends a request to srv's routes, logged in as user unless user is
+// empty, and returns the response.
+func serve(t *testing.T, srv *Server, method, path, user string, body io.Reader) *httptest.ResponseRecorder {
+	t.Helper()
+	r := httptest.NewRequest(method, path, body)
+	if user != "" {
+		token, err := srv.sessions.create(user, time.Hour)
+		if err != nil {
+			t.Fatalf("create session: %v", err)
+		}
+		r.AddCookie(&http.Cookie{Name: sessionCookie, Value: token})
+	}
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, r)
+	return w
+}
+
+func TestProfilesRoundTrip(t *testing.T) {
+	srv := newTestServer(t, nil)
+
+	w := serve(t, srv, http.MethodPost, "/api/profiles", "", strings.NewReader(`{"name":"web","containers":["abc"],"volumes":["data"],"images":["nginx"]}`))
+	if w.Code != http.StatusOK {
+		t.Fatalf("POST /api/profiles: %d %s", w.Code, w.Body)
+	}
+
+	w = serve(t, srv, http.MethodGet, "/api/profiles", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /api/profiles: %d %s", w.Code, w.Body)
+	}
+	var profiles []store.Profile
+	if err := json.NewDecoder(w.Body).Decode(&profiles); err != nil {
+		t.Fatal(err)
+	}
+	if len(profiles) != 1 || profiles[0].Name != "web" {
+		t.Fatalf("profiles = %+v, want one named web", profiles)
+	}
+	p := profiles[0]
+	if len(p.Containers) != 1 || p.Containers[0] != "abc" || len(p.Volumes) != 1 || p.Volumes[0] != "data" {
+		t.Errorf("profile items = %+v", p)
+	}
+	if len(p.Images) != 1 || p.Images[0] != "nginx:latest" {
+		t.Errorf("images = %v, want the normalized nginx:latest", p.Images)
+	}
+
+	w = serve(t, srv, http.MethodDelete, "/api/profiles?name=web", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("DELETE /api/profiles: %d %s", w.Code, w.Body)
+	}
+	if _, err := srv.store.GetProfile("web"); err != store.ErrProfileNotFound {
+		t.Errorf("GetProfile after delete: %v, want ErrProfileNotFound", err)
+	}
+}
+
+func TestSettingsPersistInStore(t *testing.T) {
+	srv := newTestServer(t, nil)
+
+	w := serve(t, srv, http.MethodPut, "/api/settings", "", strings.NewReader(`{"replicationConcurrency":3}`))
+	if w.Code != http.StatusOK {
+		t.Fatalf("PUT /api/settings: %d %s", w.Code, w.Body)
+	}
+	stored, err := srv.store.GetSettings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored[settingReplicationConcurrency] != "3" {
+		t.Errorf("stored settings = %v, want replicationConcurrency 3", stored)
+	}
+
+	w = serve(t, srv, http.MethodPut, "/api/settings", "", strings.NewReader(`{"replicationConcurrency":-1}`))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("PUT with a negative concurrency: %d, want 400", w.Code)
+	}
+	if got := srv.intSetting(settingReplicationConcurrency); got != 3 {
+		t.Errorf("concurrency after a rejected change = %d, want 3", got)
+	}
+}
+
+// fakeDockerHost serves inspect for the containers given, keyed by ID, as a
+// Docker daemon would, and stores it as the Docker host named name.
+func fakeDockerHost(t *testing.T, srv *Server, name string, containers map[string]any) {
+	t.Helper()
+	daemon := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Api-Version", "1.43")
+		if r.URL.Path == "/_ping" {
+			return
+		}
+		for id, inspect := range containers {
+			if strings.HasSuffix(r.URL.Path, "/containers/"+id+"/json") {
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(inspect)
+				return
+			}
+		}
+		http.Error(w, `{"message":"No such container"}`, http.StatusNotFound)
+	}))
+	t.Cleanup(daemon.Close)
+	if err := srv.store.CreateHost(store.Host{Name: name, Address: "tcp://" + strings.TrimPrefix(daemon.URL, "http://")}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSelectContainerSelectsDependencies(t *testing.T) {
+	inspect := map[string]any{
+		"Id":   "abc",
+		"Name": "/db",
+		"Mounts": []map[string]any{
+			{"Type": "volume", "Name": "pgdata", "Destination": "/var/lib/postgresql/data"},
+			{"Type": "volume", "Name": strings.Repeat("ab", 32), "Destination": "/tmp"},
+			{"Type": "bind", "Source": "/srv/conf", "Destination": "/etc/conf"},
+		},
+		"NetworkSettings": map[string]any{"Networks": map[string]any{"shop": map[string]any{}, "bridge": map[string]any{}}},
+	}
+
+	tests := []struct {
+		name              string
+		body              string
+		containerName     string // learnt from the inspect, which opting out skips
+		volumes, networks []string
+	}{
+		{"with dependencies", `{"type":"container","id":"abc","host":"edge","isSelected":true}`, "db", []string{"pgdata"}, []string{"shop"}},
+		{"opted out", `{"type":"container","id":"abc","host":"edge","isSelected":true,"withDependencies":false}`, "", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestServer(t, nil)
+			fakeDockerHost(t, srv, "edge", map[string]any{"abc": inspect})
+
+			w := serve(t, srv, http.MethodPost, "/select", "", strings.NewReader(tt.body))
+			if w.Code != http.StatusOK {
+				t.Fatalf("POST /select: %d %s", w.Code, w.Body)
+			}
+			if tt.networks != nil {
+				var deps selectionDependencies
+				if err := json.NewDecoder(w.Body).Decode(&deps); err != nil {
+					t.Fatal(err)
+				}
+				if !slices.Equal(deps.Volumes, tt.volumes) || !slices.Equal(deps.Networks, tt.networks) {
+					t.Errorf("response = %+v, want volumes %v and networks %v", deps, tt.volumes, tt.networks)
+				}
+			}
+
+			containers, err := srv.store.GetSelectedContainers()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(containers) != 1 || containers[0].Host != "edge" || containers[0].ID != "abc" || containers[0].Name != tt.containerName {
+				t.Errorf("selected containers = %+v, want abc named %q on edge", containers, tt.containerName)
+			}
+			volumes, err := srv.store.GetSelectedVolumes()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := sortedKeys(volumes); !slices.Equal(got, tt.volumes) {
+				t.Errorf("selected volumes = %v, want %v", got, tt.volumes)
+			}
+			networks, err := srv.store.GetSelectedNetworks()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := sortedKeys(networks); !slices.Equal(got, tt.networks) {
+				t.Errorf("selected networks = %v, want %v", got, tt.networks)
+			}
+		})
+	}
+}
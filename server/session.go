@@ -0,0 +1,250 @@
+package server
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"dockerap/config"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const sessionCookie = "dockerapp_session"
+
+// session is a logged-in UI user.
+type session struct {
+	User    string
+	Expires time.Time
+}
+
+// sessionStore keeps UI sessions in memory; a restart logs everyone out.
+type sessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]session
+}
+
+func newSessionStore() *sessionStore {
+	return &sessionStore{sessions: make(map[string]session)}
+}
+
+// create starts a session for user and returns its token.
+func (st *sessionStore) create(user string, ttl time.Duration) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	now := time.Now()
+	for t, sess := range st.sessions {
+		if now.After(sess.Expires) {
+			delete(st.sessions, t)
+		}
+	}
+	st.sessions[token] = session{User: user, Expires: now.Add(ttl)}
+	return token, nil
+}
+
+// get returns the live session for token.
+func (st *sessionStore) get(token string) (session, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	sess, ok := st.sessions[token]
+	if !ok || time.Now().After(sess.Expires) {
+		delete(st.sessions, token)
+		return session{}, false
+	}
+	return sess, true
+}
+
+func (st *sessionStore) delete(token string) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	delete(st.sessions, token)
+}
+
+// loadLoginConfig reads the UI login settings: a single UI_USERNAME and
+// UI_PASSWORD, or an htpasswd file with bcrypt or {SHA} entries.
+func loadLoginConfig(v *config.Validator, cfg *Config) {
+	cfg.SessionTTL = v.Duration("SESSION_TTL", 12*time.Hour)
+	username, password := os.Getenv("UI_USERNAME"), os.Getenv("UI_PASSWORD")
+	v.Pair("UI_USERNAME", username, "UI_PASSWORD", password)
+	if username != "" && password != "" {
+		cfg.Users = map[string]string{username: password}
+	}
+
+	if file := os.Getenv("UI_HTPASSWD_FILE"); file != "" {
+		if cfg.Users != nil {
+			v.Add("UI_HTPASSWD_FILE", "is set together with UI_USERNAME, so one of them would be ignored", "use either the htpasswd file or a single username and password")
+			return
+		}
+		users, err := readHtpasswd(file)
+		if err != nil {
+			v.Add("UI_HTPASSWD_FILE", err.Error(), "create it with htpasswd -B (bcrypt) or htpasswd -s (SHA-1)")
+			return
+		}
+		cfg.Users = users
+	}
+}
+
+// readHtpasswd reads user:hash lines, accepting bcrypt and {SHA} hashes.
+func readHtpasswd(file string) (map[string]string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read %s: %w", file, err)
+	}
+	defer f.Close()
+
+	users := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		user, hash, ok := strings.Cut(text, ":")
+		if !ok || user == "" {
+			return nil, fmt.Errorf("%s line %d is not user:hash", file, line)
+		}
+		if !strings.HasPrefix(hash, "$2") && !strings.HasPrefix(hash, "{SHA}") {
+			return nil, fmt.Errorf("%s line %d: only bcrypt and {SHA} hashes are supported", file, line)
+		}
+		users[user] = hash
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read %s: %w", file, err)
+	}
+	if len(users) == 0 {
+		return nil, fmt.Errorf("%s has no users", file)
+	}
+	return users, nil
+}
+
+// checkPassword compares password with a stored bcrypt hash, {SHA} hash or
+// plain password.
+func checkPassword(stored, password string) bool {
+	switch {
+	case strings.HasPrefix(stored, "$2"):
+		return bcrypt.CompareHashAndPassword([]byte(stored), []byte(password)) == nil
+	case strings.HasPrefix(stored, "{SHA}"):
+		sum := sha1.Sum([]byte(password))
+		return subtle.ConstantTimeCompare([]byte(stored[len("{SHA}"):]), []byte(base64.StdEncoding.EncodeToString(sum[:]))) == 1
+	}
+	return subtle.ConstantTimeCompare([]byte(stored), []byte(password)) == 1
+}
+
+// LoginEnabled reports whether the web UI requires a login.
+func (c *Config) LoginEnabled() bool {
+	return len(c.Users) > 0
+}
+
+// requireLogin guards the web UI and its API with a session cookie and passes
+// the user on to allow. Scripts can send the shared API token as a bearer
+// token instead; paired tokens only reach the destination API.
+func (s *Server) requireLogin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.cfg.LoginEnabled() {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if c, err := r.Cookie(sessionCookie); err == nil {
+			if sess, ok := s.sessions.get(c.Value); ok {
+				p := principal{User: sess.User, Role: s.cfg.roleOf(sess.User)}
+				next.ServeHTTP(w, r.WithContext(withPrincipal(r.Context(), p)))
+				return
+			}
+		}
+		// The API token stands for an admin, since it can already drive any peer
+		if s.validAPIToken(r) {
+			p := principal{User: "api-token", Role: roleAdmin}
+			next.ServeHTTP(w, r.WithContext(withPrincipal(r.Context(), p)))
+			return
+		}
+
+		if r.Method == http.MethodGet && strings.Contains(r.Header.Get("Accept"), "text/html") {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		http.Error(w, "Login required", http.StatusUnauthorized)
+	})
+}
+
+// handleLogin shows the login page and starts a session on valid credentials.
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	if !s.cfg.LoginEnabled() {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		s.renderLogin(w, r, "")
+
+	case http.MethodPost:
+		user, password := r.FormValue("username"), r.FormValue("password")
+		stored, ok := s.cfg.Users[user]
+		if !ok || !checkPassword(stored, password) {
+			slog.WarnContext(r.Context(), "Failed login", "user", user, "remote_addr", r.RemoteAddr)
+			w.WriteHeader(http.StatusUnauthorized)
+			s.renderLogin(w, r, "Invalid username or password.")
+			return
+		}
+		token, err := s.sessions.create(user, s.cfg.SessionTTL)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Unable to create session", "err", err)
+			writeError(w, r, "Unable to create session", err)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     sessionCookie,
+			Value:    token,
+			Path:     "/",
+			Expires:  time.Now().Add(s.cfg.SessionTTL),
+			HttpOnly: true,
+			Secure:   s.cfg.TLSEnabled(),
+			SameSite: http.SameSiteLaxMode,
+		})
+		slog.InfoContext(r.Context(), "User logged in", "user", user, "remote_addr", r.RemoteAddr)
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+
+	default:
+		http.Error(w, "Only GET and POST methods are allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleLogout ends the session.
+func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if c, err := r.Cookie(sessionCookie); err == nil {
+		s.sessions.delete(c.Value)
+	}
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: "", Path: "/", MaxAge: -1, HttpOnly: true})
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
+
+func (s *Server) renderLogin(w http.ResponseWriter, r *http.Request, message string) {
+	pages, err := s.pages()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to parse template", "err", err)
+		writeError(w, r, "Unable to parse template", err)
+		return
+	}
+	data := map[string]string{"Message": message, "CSRFToken": s.csrfToken(w, r)}
+	if err := pages.login.Execute(w, data); err != nil {
+		slog.ErrorContext(r.Context(), "Unable to execute template", "err", err)
+	}
+}
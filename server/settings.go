@@ -0,0 +1,349 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Types of setting values.
+const (
+	settingBool     = "bool"
+	settingInt      = "int"
+	settingDuration = "duration"
+)
+
+// Settings that can be changed at runtime through /api/settings.
+const (
+	settingCompressResponses      = "compressResponses"
+	settingReplicationConcurrency = "replicationConcurrency"
+	settingSnapshotInterval       = "inventorySnapshotInterval"
+	settingDenyPrivileged         = "destinationDenyPrivileged"
+	settingDenyHostNetwork        = "destinationDenyHostNetwork"
+)
+
+// settingDef describes a runtime setting. Its default comes from the
+// environment, so a setting that was never changed behaves as before.
+type settingDef struct {
+	key         string
+	kind        string
+	description string
+	def         func(cfg *Config) string
+	check       func(cfg *Config, value string) error // beyond the type, nil for none
+}
+
+var settingDefs = []settingDef{
+	{
+		key:         settingCompressResponses,
+		kind:        settingBool,
+		description: "Compress text and JSON responses with brotli or gzip (COMPRESS_RESPONSES).",
+		def:         func(cfg *Config) string { return strconv.FormatBool(cfg.CompressResponses) },
+	},
+	{
+		key:         settingReplicationConcurrency,
+		kind:        settingInt,
+		description: "How many destinations a replication job copies to at once, 0 for all of them (REPLICATION_CONCURRENCY).",
+		def:         func(cfg *Config) string { return strconv.Itoa(cfg.ReplicationConcurrency) },
+	},
+	{
+		key:         settingSnapshotInterval,
+		kind:        settingDuration,
+		description: "How often an inventory snapshot is taken (INVENTORY_SNAPSHOT_INTERVAL).",
+		def:         func(cfg *Config) string { return cfg.SnapshotInterval.String() },
+		check: func(cfg *Config, value string) error {
+			if d, _ := time.ParseDuration(value); d > cfg.SnapshotRetention {
+				return fmt.Errorf("is longer than INVENTORY_SNAPSHOT_RETENTION (%s), so at most one snapshot would be kept", cfg.SnapshotRetention)
+			}
+			return nil
+		},
+	},
+	{
+		key:         settingDenyPrivileged,
+		kind:        settingBool,
+		description: "Reject privileged containers replicated to this host (DESTINATION_DENY_PRIVILEGED).",
+		def:         func(cfg *Config) string { return strconv.FormatBool(cfg.CreatePolicy.denyPrivileged) },
+	},
+	{
+		key:         settingDenyHostNetwork,
+		kind:        settingBool,
+		description: "Reject containers on the host network replicated to this host (DESTINATION_DENY_HOST_NETWORK).",
+		def:         func(cfg *Config) string { return strconv.FormatBool(cfg.CreatePolicy.denyHostNetwork) },
+	},
+}
+
+// lookupSetting returns the definition of the setting called key.
+func lookupSetting(key string) (settingDef, bool) {
+	for _, d := range settingDefs {
+		if d.key == key {
+			return d, true
+		}
+	}
+	return settingDef{}, false
+}
+
+// decode turns raw, a setting's value in a request, into the text parse takes.
+func (d settingDef) decode(raw json.RawMessage) (string, error) {
+	switch d.kind {
+	case settingBool:
+		var b bool
+		if err := json.Unmarshal(raw, &b); err != nil {
+			return "", fmt.Errorf("is not a boolean")
+		}
+		return strconv.FormatBool(b), nil
+	case settingInt:
+		var n int
+		if err := json.Unmarshal(raw, &n); err != nil {
+			return "", fmt.Errorf("is not a whole number")
+		}
+		return strconv.Itoa(n), nil
+	}
+	var value string
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return "", fmt.Errorf("is not a duration such as 30m")
+	}
+	return value, nil
+}
+
+// parse checks value and returns it as it is stored.
+func (d settingDef) parse(cfg *Config, value string) (string, error) {
+	switch d.kind {
+	case settingBool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return "", fmt.Errorf("is not a boolean")
+		}
+		value = strconv.FormatBool(b)
+	case settingInt:
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return "", fmt.Errorf("is not a whole number of at least 0")
+		}
+		value = strconv.Itoa(n)
+	case settingDuration:
+		dur, err := time.ParseDuration(value)
+		if err != nil || dur <= 0 {
+			return "", fmt.Errorf("is not a positive duration such as 30m")
+		}
+		value = dur.String()
+	}
+	if d.check != nil {
+		if err := d.check(cfg, value); err != nil {
+			return "", err
+		}
+	}
+	return value, nil
+}
+
+// runtimeSettings keeps the stored settings in memory, so requests read them
+// without a query. changed is closed and replaced whenever they change.
+type runtimeSettings struct {
+	mu      sync.RWMutex
+	values  map[string]string
+	changed chan struct{}
+}
+
+// loadSettings reads the stored settings. Values that no longer apply, such
+// as an interval beyond a retention since shortened, are logged and ignored.
+func (s *Server) loadSettings() error {
+	values, err := s.store.GetSettings()
+	if err != nil {
+		return err
+	}
+	for key, value := range values {
+		d, ok := lookupSetting(key)
+		if !ok {
+			slog.Warn("Ignoring unknown stored setting", "key", key)
+			delete(values, key)
+			continue
+		}
+		if _, err := d.parse(s.cfg, value); err != nil {
+			slog.Warn("Ignoring stored setting", "key", key, "value", value, "err", err)
+			delete(values, key)
+		}
+	}
+	s.settings.mu.Lock()
+	s.settings.values = values
+	s.settings.changed = make(chan struct{})
+	s.settings.mu.Unlock()
+	return nil
+}
+
+// setting returns the current value of a setting as stored: the one set
+// through the API, or the default from the environment.
+func (s *Server) setting(key string) string {
+	s.settings.mu.RLock()
+	value, ok := s.settings.values[key]
+	s.settings.mu.RUnlock()
+	if ok {
+		return value
+	}
+	d, _ := lookupSetting(key)
+	return d.def(s.cfg)
+}
+
+func (s *Server) boolSetting(key string) bool {
+	b, _ := strconv.ParseBool(s.setting(key))
+	return b
+}
+
+func (s *Server) intSetting(key string) int {
+	n, _ := strconv.Atoi(s.setting(key))
+	return n
+}
+
+func (s *Server) durationSetting(key string) time.Duration {
+	d, _ := time.ParseDuration(s.setting(key))
+	return d
+}
+
+// settingsChanged returns a channel that is closed on the next change.
+func (s *Server) settingsChanged() <-chan struct{} {
+	s.settings.mu.RLock()
+	defer s.settings.mu.RUnlock()
+	return s.settings.changed
+}
+
+// waitInterval waits until the interval setting key has passed since start,
+// following changes to it on the way. It returns false once ctx is done.
+func (s *Server) waitInterval(ctx context.Context, key string, start time.Time) bool {
+	for {
+		changed := s.settingsChanged()
+		timer := time.NewTimer(time.Until(start.Add(s.durationSetting(key))))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return false
+		case <-timer.C:
+			return true
+		case <-changed:
+			timer.Stop()
+		}
+	}
+}
+
+// settingView is a setting as the API shows it, with typed values.
+type settingView struct {
+	Key         string `json:"key"`
+	Type        string `json:"type"`
+	Value       any    `json:"value"`
+	Default     any    `json:"default"`
+	Overridden  bool   `json:"overridden"` // set through the API rather than taken from the environment
+	Description string `json:"description"`
+}
+
+// typedSetting turns a stored value into its JSON type.
+func typedSetting(kind, value string) any {
+	switch kind {
+	case settingBool:
+		b, _ := strconv.ParseBool(value)
+		return b
+	case settingInt:
+		n, _ := strconv.Atoi(value)
+		return n
+	}
+	return value
+}
+
+func (s *Server) settingViews() []settingView {
+	s.settings.mu.RLock()
+	defer s.settings.mu.RUnlock()
+	views := make([]settingView, 0, len(settingDefs))
+	for _, d := range settingDefs {
+		def := d.def(s.cfg)
+		value, ok := s.settings.values[d.key]
+		if !ok {
+			value = def
+		}
+		views = append(views, settingView{
+			Key:         d.key,
+			Type:        d.kind,
+			Value:       typedSetting(d.kind, value),
+			Default:     typedSetting(d.kind, def),
+			Overridden:  ok,
+			Description: d.description,
+		})
+	}
+	return views
+}
+
+// handleSettings lists the runtime settings and changes them. A PUT body maps
+// keys to new values, or to null to go back to the default; either every
+// change applies or, if any is invalid, none does.
+func (s *Server) handleSettings(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s.settingViews())
+
+	case http.MethodPut:
+		var payload map[string]json.RawMessage
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		changes := make(map[string]*string, len(payload))
+		var keys []string
+		for key, raw := range payload {
+			d, ok := lookupSetting(key)
+			if !ok {
+				http.Error(w, fmt.Sprintf("Unknown setting: %s", key), http.StatusBadRequest)
+				return
+			}
+			keys = append(keys, key)
+			if string(raw) == "null" {
+				changes[key] = nil
+				continue
+			}
+			value, err := d.decode(raw)
+			if err == nil {
+				value, err = d.parse(s.cfg, value)
+			}
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Setting %s %s", key, err), http.StatusBadRequest)
+				return
+			}
+			changes[key] = &value
+		}
+		if err := s.store.UpdateSettings(changes); err != nil {
+			slog.ErrorContext(r.Context(), "Unable to update settings", "err", err)
+			writeError(w, r, "Unable to update settings", err)
+			return
+		}
+
+		s.settings.mu.Lock()
+		for key, value := range changes {
+			if value == nil {
+				delete(s.settings.values, key)
+			} else {
+				s.settings.values[key] = *value
+			}
+		}
+		close(s.settings.changed)
+		s.settings.changed = make(chan struct{})
+		s.settings.mu.Unlock()
+
+		sort.Strings(keys)
+		setAuditTarget(r, strings.Join(keys, ", "), "")
+		slog.InfoContext(r.Context(), "Settings updated", "keys", keys)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s.settingViews())
+
+	default:
+		http.Error(w, "Only GET and PUT methods are allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// currentCreatePolicy is the create policy with its toggles as set now.
+func (s *Server) currentCreatePolicy() createPolicy {
+	p := s.cfg.CreatePolicy
+	p.denyPrivileged = s.boolSetting(settingDenyPrivileged)
+	p.denyHostNetwork = s.boolSetting(settingDenyHostNetwork)
+	return p
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"context"
+	"dockerap/apiclient"
+	"dockerap/store"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+)
+
+// applyStartPolicy starts a freshly created replica according to policy.
+func applyStartPolicy(ctx context.Context, cli *client.Client, id, policy string) error {
+	switch policy {
+	case "", store.StartCreated:
+		return nil
+	case store.StartStopped:
+		if err := cli.ContainerStart(ctx, id, container.StartOptions{}); err != nil {
+			return fmt.Errorf("start: %w", err)
+		}
+		if err := cli.ContainerStop(ctx, id, container.StopOptions{}); err != nil {
+			return fmt.Errorf("stop: %w", err)
+		}
+	case store.StartRunning:
+		if err := cli.ContainerStart(ctx, id, container.StartOptions{}); err != nil {
+			return fmt.Errorf("start: %w", err)
+		}
+	default:
+		return fmt.Errorf("invalid start policy: %s", policy)
+	}
+	return nil
+}
+
+// Destination API: Apply a start policy to a replica once its data is in place
+func (s *Server) handleStartContainer(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var payload apiclient.StartContainerRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	cli, err := newDockerClient(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to create docker client", "err", err)
+		writeError(w, r, "Unable to create docker client", err)
+		return
+	}
+	defer cli.Close()
+
+	if err := applyStartPolicy(r.Context(), cli, payload.Name, payload.StartPolicy); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to apply start policy", "start_policy", payload.StartPolicy, "name", payload.Name, "err", err)
+		writeError(w, r, "Failed to apply start policy", err)
+		return
+	}
+	slog.InfoContext(r.Context(), "Applied start policy", "start_policy", payload.StartPolicy, "name", payload.Name)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) handleStartPolicies(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		policies, err := s.store.GetStartPolicies()
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Unable to get start policies", "err", err)
+			writeError(w, r, "Unable to get start policies", err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(policies)
+
+	case http.MethodPost:
+		var payload struct {
+			ContainerID string `json:"containerId"`
+			Policy      string `json:"policy"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if err := s.store.SetStartPolicy(payload.ContainerID, payload.Policy); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+
+	default:
+		http.Error(w, "Only GET and POST methods are allowed", http.StatusMethodNotAllowed)
+	}
+}
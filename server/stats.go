@@ -0,0 +1,145 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+)
+
+// containerStats is a container's resource use as shown in the UI, worked
+// out the same way docker stats does.
+type containerStats struct {
+	ID            string    `json:"id"`
+	Read          time.Time `json:"read"`
+	CPUPercent    float64   `json:"cpuPercent"`
+	MemoryUsage   uint64    `json:"memoryUsage"` // bytes, excluding the page cache
+	MemoryLimit   uint64    `json:"memoryLimit"`
+	MemoryPercent float64   `json:"memoryPercent"`
+	NetworkRx     uint64    `json:"networkRx"` // bytes received on all networks
+	NetworkTx     uint64    `json:"networkTx"`
+	BlockRead     uint64    `json:"blockRead"` // bytes read from block devices
+	BlockWrite    uint64    `json:"blockWrite"`
+	PIDs          uint64    `json:"pids"`
+}
+
+// summarizeStats reduces one sample from the daemon to containerStats. CPU
+// use needs the previous sample the daemon sends with it, so the first
+// sample of a stream reports none.
+func summarizeStats(id string, s types.StatsJSON) containerStats {
+	cs := containerStats{ID: id, Read: s.Read, PIDs: s.PidsStats.Current}
+
+	cpuDelta := float64(s.CPUStats.CPUUsage.TotalUsage) - float64(s.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(s.CPUStats.SystemUsage) - float64(s.PreCPUStats.SystemUsage)
+	cpus := float64(s.CPUStats.OnlineCPUs)
+	if cpus == 0 {
+		cpus = float64(len(s.CPUStats.CPUUsage.PercpuUsage))
+	}
+	if cpuDelta > 0 && systemDelta > 0 {
+		cs.CPUPercent = cpuDelta / systemDelta * cpus * 100
+	}
+
+	// cgroup v1 and v2 name the reclaimable cache differently
+	cs.MemoryUsage = s.MemoryStats.Usage
+	for _, key := range []string{"total_inactive_file", "inactive_file"} {
+		if v, ok := s.MemoryStats.Stats[key]; ok && v < cs.MemoryUsage {
+			cs.MemoryUsage -= v
+			break
+		}
+	}
+	cs.MemoryLimit = s.MemoryStats.Limit
+	if cs.MemoryLimit > 0 {
+		cs.MemoryPercent = float64(cs.MemoryUsage) / float64(cs.MemoryLimit) * 100
+	}
+
+	for _, n := range s.Networks {
+		cs.NetworkRx += n.RxBytes
+		cs.NetworkTx += n.TxBytes
+	}
+	for _, e := range s.BlkioStats.IoServiceBytesRecursive {
+		switch strings.ToLower(e.Op) {
+		case "read":
+			cs.BlockRead += e.Value
+		case "write":
+			cs.BlockWrite += e.Value
+		}
+	}
+	return cs
+}
+
+// handleContainerStats returns a container's CPU, memory, network and block
+// I/O use. By default it returns one sample as JSON; with ?stream=true it
+// sends a "stats" server-sent event about once a second until the client
+// goes away or the container stops.
+func (s *Server) handleContainerStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	stream := r.URL.Query().Get("stream") == "true"
+
+	cli, err := newDockerClient(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to create docker client", "err", err)
+		writeError(w, r, "Unable to create docker client", err)
+		return
+	}
+	defer cli.Close()
+
+	ctx := r.Context()
+	id := r.PathValue("id")
+	resp, err := cli.ContainerStats(ctx, id, stream)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if client.IsErrNotFound(err) {
+			status = http.StatusNotFound
+		}
+		http.Error(w, fmt.Sprintf("Unable to read container stats: %s", err), status)
+		return
+	}
+	defer resp.Body.Close()
+	dec := json.NewDecoder(resp.Body)
+
+	if !stream {
+		var sample types.StatsJSON
+		if err := dec.Decode(&sample); err != nil {
+			slog.ErrorContext(ctx, "Unable to decode container stats", "container", id, "err", err)
+			http.Error(w, fmt.Sprintf("Unable to decode container stats: %s", err), http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(summarizeStats(id, sample))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // keep nginx from buffering the stream
+	w.WriteHeader(http.StatusOK)
+	rc := http.NewResponseController(w)
+	rc.Flush()
+
+	for {
+		var sample types.StatsJSON
+		if err := dec.Decode(&sample); err != nil {
+			if err != io.EOF && ctx.Err() == nil {
+				slog.WarnContext(ctx, "Container stats stream ended", "container", id, "err", err)
+			}
+			return
+		}
+		data, err := json.Marshal(summarizeStats(id, sample))
+		if err != nil {
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "event: stats\ndata: %s\n\n", data); err != nil {
+			return
+		}
+		rc.Flush()
+	}
+}
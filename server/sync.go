@@ -0,0 +1,343 @@
+package server
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"dockerap/apiclient"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/client"
+)
+
+// SyncConflict is a file changed on both hosts since the last sync.
+type SyncConflict struct {
+	Path  string `json:"path"`
+	Local string `json:"local"` // hash here, empty if deleted
+	Peer  string `json:"peer"`  // hash on the peer, empty if deleted
+}
+
+// SyncResult is the outcome of a two-way sync of one volume.
+type SyncResult struct {
+	Volume         string         `json:"volume"`
+	Peer           string         `json:"peer"`
+	DryRun         bool           `json:"dryRun"`
+	Pushed         []string       `json:"pushed"`         // changed here, copied to the peer
+	Pulled         []string       `json:"pulled"`         // changed on the peer, copied here
+	Conflicts      []SyncConflict `json:"conflicts"`      // changed on both, left alone
+	DeletedLocally []string       `json:"deletedLocally"` // deleted here; reported, not applied
+	DeletedOnPeer  []string       `json:"deletedOnPeer"`  // deleted on the peer; reported, not applied
+	InSync         int            `json:"inSync"`
+	Error          string         `json:"error,omitempty"`
+}
+
+// volumeMountContainer finds a container, running or not, that mounts the
+// volume, and where it mounts it.
+func volumeMountContainer(ctx context.Context, cli *client.Client, volume string) (string, string, error) {
+	containers, err := cli.ContainerList(ctx, container.ListOptions{All: true, Filters: filters.NewArgs(filters.Arg("volume", volume))})
+	if err != nil {
+		return "", "", err
+	}
+	for _, c := range containers {
+		for _, m := range c.Mounts {
+			if m.Type == mount.TypeVolume && m.Name == volume {
+				return c.ID, m.Destination, nil
+			}
+		}
+	}
+	return "", "", fmt.Errorf("no container mounts volume %s", volume)
+}
+
+// readManifest builds the manifest of a volume, leaving out excluded paths.
+// Directories are not listed; they are created as files are copied.
+func readManifest(ctx context.Context, cli *client.Client, volume string, excludes []string) (*apiclient.VolumeManifest, error) {
+	excluded, err := compileExcludes(excludes)
+	if err != nil {
+		return nil, err
+	}
+	id, p, err := volumeMountContainer(ctx, cli, volume)
+	if err != nil {
+		return nil, err
+	}
+	rc, _, err := cli.CopyFromContainer(ctx, id, p)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", p, err)
+	}
+	defer rc.Close()
+
+	m := &apiclient.VolumeManifest{Container: id, Path: p, Files: make(map[string]string)}
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		rel := strings.TrimSuffix(stripArchiveRoot(hdr.Name), "/")
+		if rel == "" || excluded(rel) {
+			continue
+		}
+		switch hdr.Typeflag {
+		case tar.TypeReg:
+			h := sha256.New()
+			if _, err := io.Copy(h, tr); err != nil {
+				return nil, err
+			}
+			m.Files[rel] = fmt.Sprintf("sha256:%x %o", h.Sum(nil), hdr.Mode)
+		case tar.TypeSymlink:
+			m.Files[rel] = "symlink:" + hdr.Linkname
+		}
+	}
+	return m, nil
+}
+
+// exportFiles writes a tar of just the listed files under a container's
+// mount path to w, rooted like the Docker archive API's output for that path.
+func exportFiles(ctx context.Context, cli *client.Client, containerID, p string, files []string, w io.Writer) error {
+	keep := toSet(files)
+	rc, _, err := cli.CopyFromContainer(ctx, containerID, p)
+	if err != nil {
+		return fmt.Errorf("read %s: %w", p, err)
+	}
+	defer rc.Close()
+	return filterTar(rc, w, func(name string) bool {
+		return !keep[strings.TrimSuffix(stripArchiveRoot(name), "/")]
+	})
+}
+
+// diffSync compares both sides with the state of the last sync. A file
+// changed on one side only is copied to the other; one changed on both is a
+// conflict. It also returns the sync state to record once the copies are done.
+func diffSync(base, local, peer map[string]string, res *SyncResult) map[string]string {
+	paths := make(map[string]bool)
+	for _, m := range []map[string]string{base, local, peer} {
+		for p := range m {
+			paths[p] = true
+		}
+	}
+
+	next := make(map[string]string)
+	for _, p := range sortedKeys(paths) {
+		l, r, b := local[p], peer[p], base[p]
+		switch {
+		case l == r:
+			if l != "" {
+				res.InSync++
+				next[p] = l
+			}
+		case l == b && r == "":
+			res.DeletedOnPeer = append(res.DeletedOnPeer, p)
+			next[p] = b
+		case l == b:
+			res.Pulled = append(res.Pulled, p)
+			next[p] = r
+		case r == b && l == "":
+			res.DeletedLocally = append(res.DeletedLocally, p)
+			next[p] = b
+		case r == b:
+			res.Pushed = append(res.Pushed, p)
+			next[p] = l
+		default:
+			res.Conflicts = append(res.Conflicts, SyncConflict{Path: p, Local: l, Peer: r})
+			if b != "" {
+				next[p] = b
+			}
+		}
+	}
+	return next
+}
+
+// syncVolume runs a two-way sync of a volume with the same-purpose volume on
+// a peer instance.
+func (s *Server) syncVolume(ctx context.Context, cli *client.Client, peer, volume, peerVolume string, dryRun bool) *SyncResult {
+	res := &SyncResult{Volume: volume, Peer: peer, DryRun: dryRun, Pushed: []string{}, Pulled: []string{},
+		Conflicts: []SyncConflict{}, DeletedLocally: []string{}, DeletedOnPeer: []string{}}
+	fail := func(err error) *SyncResult {
+		slog.WarnContext(ctx, "Sync of volume failed", "volume", volume, "peer", peer, "err", err)
+		res.Error = err.Error()
+		return res
+	}
+
+	allExcludes, err := s.store.GetVolumeExcludes()
+	if err != nil {
+		return fail(fmt.Errorf("unable to get volume excludes: %w", err))
+	}
+	excludes := allExcludes[volume]
+	base, err := s.store.GetSyncBase(volume, peer)
+	if err != nil {
+		return fail(fmt.Errorf("unable to get sync state: %w", err))
+	}
+	local, err := readManifest(ctx, cli, volume, excludes)
+	if err != nil {
+		return fail(err)
+	}
+	httpClient := s.peerClient(peer)
+	if err := checkPeerAPI(ctx, httpClient, peer); err != nil {
+		return fail(err)
+	}
+	api := apiclient.New(peer, httpClient)
+	remote, err := api.VolumeManifest(ctx, apiclient.VolumeManifestRequest{Volume: peerVolume, Excludes: excludes})
+	if err != nil {
+		return fail(fmt.Errorf("peer manifest: %w", err))
+	}
+
+	next := diffSync(base, local.Files, remote.Files, res)
+	slog.InfoContext(ctx, "Synced volume", "volume", volume, "peer", peer, "pushed", len(res.Pushed), "pulled", len(res.Pulled), "conflicts", len(res.Conflicts))
+	if dryRun {
+		return res
+	}
+	if (len(res.Pushed) > 0 || len(res.Pulled) > 0) && path.Base(local.Path) != path.Base(remote.Path) {
+		return fail(fmt.Errorf("volume is mounted at %s here but at %s on the peer", local.Path, remote.Path))
+	}
+
+	if len(res.Pushed) > 0 {
+		pr, pw := io.Pipe()
+		go func() {
+			pw.CloseWithError(exportFiles(ctx, cli, local.Container, local.Path, res.Pushed, pw))
+		}()
+		err := api.RestoreData(ctx, apiclient.RestoreTarget{Container: remote.Container, Path: remote.Path}, pr)
+		pr.Close()
+		if err != nil {
+			return fail(fmt.Errorf("push: %w", err))
+		}
+	}
+	if len(res.Pulled) > 0 {
+		tar, err := api.ExportData(ctx, apiclient.ExportDataRequest{Volume: peerVolume, Files: res.Pulled})
+		if err != nil {
+			return fail(fmt.Errorf("pull: %w", err))
+		}
+		defer tar.Close()
+		if err := cli.CopyToContainer(ctx, local.Container, path.Dir(path.Clean(local.Path)), tar, types.CopyToContainerOptions{}); err != nil {
+			return fail(fmt.Errorf("pull: %w", err))
+		}
+	}
+
+	if err := s.store.SaveSyncBase(volume, peer, next); err != nil {
+		return fail(fmt.Errorf("unable to save sync state: %w", err))
+	}
+	return res
+}
+
+// handleSync runs a two-way sync of a volume with a peer. Files changed on
+// only one side since the last sync are copied across; files changed on both
+// are reported as conflicts and left untouched on both hosts.
+func (s *Server) handleSync(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var payload struct {
+		Peer       string `json:"peer"`
+		Volume     string `json:"volume"`
+		PeerVolume string `json:"peerVolume"` // defaults to Volume
+		DryRun     bool   `json:"dryRun"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	payload.Peer = strings.TrimRight(payload.Peer, "/")
+	if payload.Peer == "" || payload.Volume == "" {
+		http.Error(w, "peer and volume are required", http.StatusBadRequest)
+		return
+	}
+	if payload.PeerVolume == "" {
+		payload.PeerVolume = payload.Volume
+	}
+
+	cli, err := newDockerClient(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to create docker client", "err", err)
+		writeError(w, r, "Unable to create docker client", err)
+		return
+	}
+	defer cli.Close()
+
+	res := s.syncVolume(r.Context(), cli, payload.Peer, payload.Volume, payload.PeerVolume, payload.DryRun)
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case res.Error != "":
+		w.WriteHeader(http.StatusInternalServerError)
+	case len(res.Conflicts) > 0:
+		w.WriteHeader(http.StatusConflict)
+	}
+	json.NewEncoder(w).Encode(res)
+}
+
+// Destination API: List the files in a volume for a two-way sync
+func (s *Server) handleVolumeManifest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var payload apiclient.VolumeManifestRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	cli, err := newDockerClient(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to create docker client", "err", err)
+		writeError(w, r, "Unable to create docker client", err)
+		return
+	}
+	defer cli.Close()
+
+	m, err := readManifest(r.Context(), cli, payload.Volume, payload.Excludes)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to read manifest of volume", "volume", payload.Volume, "err", err)
+		writeError(w, r, "Unable to read volume manifest", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(m)
+}
+
+// Destination API: Export selected files of a volume as a tar archive
+func (s *Server) handleExportData(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var payload apiclient.ExportDataRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	cli, err := newDockerClient(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to create docker client", "err", err)
+		writeError(w, r, "Unable to create docker client", err)
+		return
+	}
+	defer cli.Close()
+
+	ctx := r.Context()
+	id, p, err := volumeMountContainer(ctx, cli, payload.Volume)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-tar")
+	if err := exportFiles(ctx, cli, id, p, payload.Files, w); err != nil {
+		// Headers are sent; the truncated archive fails on the receiving side
+		slog.ErrorContext(ctx, "Failed to export files", "files", len(payload.Files), "volume", payload.Volume, "err", err)
+	}
+}
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffSync(t *testing.T) {
+	tests := []struct {
+		name              string
+		base, local, peer string // hashes of the file, "" when it is absent
+		want              SyncResult
+		next              string // hash recorded for the next sync, "" for none
+	}{
+		{"unchanged", "a", "a", "a", SyncResult{InSync: 1}, "a"},
+		{"changed here", "a", "b", "a", SyncResult{Pushed: []string{"f"}}, "b"},
+		{"changed on the peer", "a", "a", "b", SyncResult{Pulled: []string{"f"}}, "b"},
+		{"created here", "", "b", "", SyncResult{Pushed: []string{"f"}}, "b"},
+		{"created on the peer", "", "", "b", SyncResult{Pulled: []string{"f"}}, "b"},
+		{"changed the same way on both", "a", "b", "b", SyncResult{InSync: 1}, "b"},
+		{"changed differently on both", "a", "b", "c", SyncResult{Conflicts: []SyncConflict{{Path: "f", Local: "b", Peer: "c"}}}, "a"},
+		{"created differently on both", "", "b", "c", SyncResult{Conflicts: []SyncConflict{{Path: "f", Local: "b", Peer: "c"}}}, ""},
+		{"deleted here", "a", "", "a", SyncResult{DeletedLocally: []string{"f"}}, "a"},
+		{"deleted on the peer", "a", "a", "", SyncResult{DeletedOnPeer: []string{"f"}}, "a"},
+		{"deleted on both", "a", "", "", SyncResult{}, ""},
+		{"deleted here, changed on the peer", "a", "", "c", SyncResult{Conflicts: []SyncConflict{{Path: "f", Peer: "c"}}}, "a"},
+		{"changed here, deleted on the peer", "a", "b", "", SyncResult{Conflicts: []SyncConflict{{Path: "f", Local: "b"}}}, "a"},
+	}
+	side := func(hash string) map[string]string {
+		if hash == "" {
+			return map[string]string{}
+		}
+		return map[string]string{"f": hash}
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var res SyncResult
+			next := diffSync(side(tt.base), side(tt.local), side(tt.peer), &res)
+			if !reflect.DeepEqual(res, tt.want) {
+				t.Errorf("result = %+v, want %+v", res, tt.want)
+			}
+			if !reflect.DeepEqual(next, side(tt.next)) {
+				t.Errorf("next state = %v, want %v", next, side(tt.next))
+			}
+		})
+	}
+}
@@ -0,0 +1,500 @@
+package server
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// dockerCLI is where units expect the docker CLI. systemd needs the full
+// path of the command it runs.
+const dockerCLI = "/usr/bin/docker"
+
+// unitFile is one file of a systemd export.
+type unitFile struct {
+	Name    string
+	Content string
+}
+
+// handleExportSystemd writes the selected containers, or a profile's, as
+// systemd units in a tar.gz, so a failover host without DockerApp can still
+// bring them up at boot. ?style=docker, the default, writes a
+// container-<name>.service per container that runs it with the docker CLI;
+// ?style=quadlet writes Podman Quadlet .container, .volume and .network
+// files instead.
+func (s *Server) handleExportSystemd(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	style := r.URL.Query().Get("style")
+	if style == "" {
+		style = "docker"
+	}
+	if style != "docker" && style != "quadlet" {
+		http.Error(w, fmt.Sprintf("Unknown style %q: use docker or quadlet", style), http.StatusBadRequest)
+		return
+	}
+
+	cli, err := newDockerClient(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to create docker client", "err", err)
+		writeError(w, r, "Unable to create docker client", err)
+		return
+	}
+	defer cli.Close()
+
+	profile := r.URL.Query().Get("profile")
+	f, skipped, err := s.exportCompose(r.Context(), cli, profile)
+	if err != nil {
+		writeSelectionError(w, r, err)
+		return
+	}
+	var units []unitFile
+	if style == "quadlet" {
+		units = quadletUnits(f)
+	} else {
+		units = dockerUnits(f)
+	}
+
+	source := "the current selection"
+	if profile != "" {
+		source = "profile " + profile
+	}
+	host, _ := os.Hostname()
+	now := time.Now().UTC()
+	var header strings.Builder
+	fmt.Fprintf(&header, "# Exported by DockerApp from %s on %s at %s\n", source, host, now.Format(time.RFC3339))
+	for _, line := range skipped {
+		fmt.Fprintf(&header, "# Skipped: %s\n", line)
+	}
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, u := range units {
+		content := header.String() + u.Content
+		err = tw.WriteHeader(&tar.Header{Name: u.Name, Mode: 0o644, Size: int64(len(content)), ModTime: now})
+		if err == nil {
+			_, err = tw.Write([]byte(content))
+		}
+		if err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = tw.Close()
+	}
+	if err == nil {
+		err = gz.Close()
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to write unit archive", "err", err)
+		writeError(w, r, "Unable to write unit archive", err)
+		return
+	}
+
+	filename := fmt.Sprintf("systemd-%s-%s.tar.gz", style, now.Format("20060102-150405"))
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Write(buf.Bytes())
+}
+
+// dockerUnitName is the service that runs a container in the docker style.
+func dockerUnitName(container string) string {
+	return "container-" + container + ".service"
+}
+
+// dockerUnits writes a service per container. The service creates the
+// container's networks and volumes if they are missing, replaces any
+// container of the same name with a fresh one and runs it attached, so
+// systemd sees it exit and restarts it as the container's restart policy
+// would.
+func dockerUnits(f *composeFile) []unitFile {
+	var units []unitFile
+	for _, name := range sortedKeys(f.Services) {
+		svc := f.Services[name]
+		var b strings.Builder
+		b.WriteString("[Unit]\n")
+		fmt.Fprintf(&b, "Description=Container %s\n", name)
+		b.WriteString("Wants=network-online.target\n")
+		b.WriteString("After=network-online.target docker.service\n")
+		b.WriteString("Requires=docker.service\n")
+		for _, dep := range svc.DependsOn {
+			fmt.Fprintf(&b, "After=%s\nRequires=%s\n", dockerUnitName(dep), dockerUnitName(dep))
+		}
+
+		b.WriteString("\n[Service]\n")
+		fmt.Fprintf(&b, "Restart=%s\n", systemdRestart(svc.Restart))
+		// The first start may pull the image
+		b.WriteString("TimeoutStartSec=0\n")
+		writeExec(&b, "ExecStartPre=-", dockerCLI, "rm", "--force", name)
+		for _, m := range svc.Volumes {
+			if m.Type != "volume" || m.Source == "" {
+				continue
+			}
+			args := []string{dockerCLI, "volume", "create"}
+			if v := f.Volumes[m.Source]; v != nil {
+				if v.Driver != "" {
+					args = append(args, "--driver", v.Driver)
+				}
+				for _, k := range sortedKeys(v.DriverOpts) {
+					args = append(args, "--opt", k+"="+v.DriverOpts[k])
+				}
+				labels := v.Labels.values()
+				for _, k := range sortedKeys(labels) {
+					args = append(args, "--label", k+"="+labels[k])
+				}
+			}
+			writeExec(&b, "ExecStartPre=-", append(args, m.Source)...)
+		}
+		networks := sortedKeys(svc.Networks)
+		for _, net := range networks {
+			args := []string{dockerCLI, "network", "create"}
+			if n := f.Networks[net]; n != nil {
+				if n.Driver != "" {
+					args = append(args, "--driver", n.Driver)
+				}
+				for _, k := range sortedKeys(n.DriverOpts) {
+					args = append(args, "--opt", k+"="+n.DriverOpts[k])
+				}
+				for _, c := range n.IPAM.Config {
+					if c.Subnet != "" {
+						args = append(args, "--subnet", c.Subnet)
+					}
+					if c.Gateway != "" {
+						args = append(args, "--gateway", c.Gateway)
+					}
+					if c.IPRange != "" {
+						args = append(args, "--ip-range", c.IPRange)
+					}
+				}
+				if n.Internal {
+					args = append(args, "--internal")
+				}
+				if n.Attachable {
+					args = append(args, "--attachable")
+				}
+				if n.EnableIPv6 {
+					args = append(args, "--ipv6")
+				}
+				labels := n.Labels.values()
+				for _, k := range sortedKeys(labels) {
+					args = append(args, "--label", k+"="+labels[k])
+				}
+			}
+			writeExec(&b, "ExecStartPre=-", append(args, net)...)
+		}
+		writeExec(&b, "ExecStartPre=", dockerCreateArgs(name, svc)...)
+		for i, net := range networks {
+			if i == 0 {
+				continue
+			}
+			args := []string{dockerCLI, "network", "connect"}
+			for _, a := range svc.Networks[net] {
+				args = append(args, "--alias", a)
+			}
+			writeExec(&b, "ExecStartPre=", append(args, net, name)...)
+		}
+		writeExec(&b, "ExecStart=", dockerCLI, "start", "--attach", name)
+		writeExec(&b, "ExecStop=", dockerCLI, "stop", name)
+		writeExec(&b, "ExecStopPost=-", dockerCLI, "rm", "--force", name)
+
+		b.WriteString("\n[Install]\n")
+		b.WriteString("WantedBy=multi-user.target\n")
+		units = append(units, unitFile{Name: dockerUnitName(name), Content: b.String()})
+	}
+	return units
+}
+
+// dockerCreateArgs returns the docker create command line for a service,
+// joined to the first of its networks.
+func dockerCreateArgs(name string, svc composeService) []string {
+	args := []string{dockerCLI, "create", "--name", name}
+	if svc.Hostname != "" {
+		args = append(args, "--hostname", svc.Hostname)
+	}
+	if svc.User != "" {
+		args = append(args, "--user", svc.User)
+	}
+	if svc.WorkingDir != "" {
+		args = append(args, "--workdir", svc.WorkingDir)
+	}
+	if svc.Privileged {
+		args = append(args, "--privileged")
+	}
+	if svc.ReadOnly {
+		args = append(args, "--read-only")
+	}
+	if svc.TTY {
+		args = append(args, "--tty")
+	}
+	if svc.StdinOpen {
+		args = append(args, "--interactive")
+	}
+	for _, c := range svc.CapAdd {
+		args = append(args, "--cap-add", c)
+	}
+	for _, c := range svc.CapDrop {
+		args = append(args, "--cap-drop", c)
+	}
+	for _, h := range svc.ExtraHosts {
+		args = append(args, "--add-host", h)
+	}
+	env := svc.Environment.values()
+	for _, k := range sortedKeys(env) {
+		args = append(args, "--env", k+"="+env[k])
+	}
+	labels := svc.Labels.values()
+	for _, k := range sortedKeys(labels) {
+		args = append(args, "--label", k+"="+labels[k])
+	}
+	for _, p := range svc.Ports {
+		args = append(args, "--publish", string(p))
+	}
+	for _, m := range svc.Volumes {
+		args = append(args, "--volume", m.shortSyntax())
+	}
+	if networks := sortedKeys(svc.Networks); len(networks) > 0 {
+		args = append(args, "--network", networks[0])
+		for _, a := range svc.Networks[networks[0]] {
+			args = append(args, "--network-alias", a)
+		}
+	} else if svc.NetworkMode != "" {
+		args = append(args, "--network", svc.NetworkMode)
+	}
+	// --entrypoint takes a single word; the rest go before the command
+	cmd := []string(svc.Command)
+	if len(svc.Entrypoint) > 0 {
+		args = append(args, "--entrypoint", svc.Entrypoint[0])
+		cmd = append(append([]string{}, svc.Entrypoint[1:]...), cmd...)
+	}
+	args = append(args, svc.Image)
+	return append(args, cmd...)
+}
+
+// quadletUnits writes a Quadlet file per container, volume and network.
+// Podman generates the services from them: <name>.service for a container,
+// which requires the <volume>-volume.service and <network>-network.service
+// that create what it uses.
+func quadletUnits(f *composeFile) []unitFile {
+	var units []unitFile
+	for _, name := range sortedKeys(f.Services) {
+		svc := f.Services[name]
+		var b strings.Builder
+		b.WriteString("[Unit]\n")
+		fmt.Fprintf(&b, "Description=Container %s\n", name)
+		for _, dep := range svc.DependsOn {
+			fmt.Fprintf(&b, "After=%s.service\nRequires=%s.service\n", dep, dep)
+		}
+
+		b.WriteString("\n[Container]\n")
+		writeKey(&b, "ContainerName", name)
+		writeKey(&b, "Image", svc.Image)
+		if svc.Hostname != "" {
+			writeKey(&b, "HostName", svc.Hostname)
+		}
+		if svc.User != "" {
+			writeKey(&b, "User", svc.User)
+		}
+		if svc.WorkingDir != "" {
+			writeKey(&b, "WorkingDir", svc.WorkingDir)
+		}
+		if svc.ReadOnly {
+			writeKey(&b, "ReadOnly", "true")
+		}
+		for _, c := range svc.CapAdd {
+			writeKey(&b, "AddCapability", c)
+		}
+		for _, c := range svc.CapDrop {
+			writeKey(&b, "DropCapability", c)
+		}
+		for _, h := range svc.ExtraHosts {
+			writeKey(&b, "AddHost", h)
+		}
+		env := svc.Environment.values()
+		for _, k := range sortedKeys(env) {
+			writeKey(&b, "Environment", k+"="+env[k])
+		}
+		labels := svc.Labels.values()
+		for _, k := range sortedKeys(labels) {
+			writeKey(&b, "Label", k+"="+labels[k])
+		}
+		for _, p := range svc.Ports {
+			writeKey(&b, "PublishPort", string(p))
+		}
+		for _, m := range svc.Volumes {
+			if m.Type == "volume" && m.Source != "" {
+				m.Source += ".volume"
+			}
+			writeKey(&b, "Volume", m.shortSyntax())
+		}
+		// Quadlet gives a container the same aliases on every network
+		seen := make(map[string]bool)
+		for _, net := range sortedKeys(svc.Networks) {
+			writeKey(&b, "Network", net+".network")
+			for _, a := range svc.Networks[net] {
+				if !seen[a] {
+					seen[a] = true
+					writeKey(&b, "NetworkAlias", a)
+				}
+			}
+		}
+		if len(svc.Networks) == 0 && (svc.NetworkMode == "host" || svc.NetworkMode == "none") {
+			writeKey(&b, "Network", svc.NetworkMode)
+		}
+		if len(svc.Entrypoint) == 1 {
+			writeKey(&b, "Entrypoint", svc.Entrypoint[0])
+		} else if len(svc.Entrypoint) > 1 {
+			// Podman reads a JSON array as the exec form
+			ep, _ := json.Marshal([]string(svc.Entrypoint))
+			writeKey(&b, "Entrypoint", string(ep))
+		}
+		if len(svc.Command) > 0 {
+			writeExec(&b, "Exec=", svc.Command...)
+		}
+		var podmanArgs []string
+		if svc.Privileged {
+			podmanArgs = append(podmanArgs, "--privileged")
+		}
+		if svc.TTY {
+			podmanArgs = append(podmanArgs, "--tty")
+		}
+		if svc.StdinOpen {
+			podmanArgs = append(podmanArgs, "--interactive")
+		}
+		if len(podmanArgs) > 0 {
+			writeExec(&b, "PodmanArgs=", podmanArgs...)
+		}
+
+		b.WriteString("\n[Service]\n")
+		fmt.Fprintf(&b, "Restart=%s\n", systemdRestart(svc.Restart))
+		b.WriteString("TimeoutStartSec=0\n")
+
+		b.WriteString("\n[Install]\n")
+		b.WriteString("WantedBy=multi-user.target default.target\n")
+		units = append(units, unitFile{Name: name + ".container", Content: b.String()})
+	}
+
+	for _, name := range sortedKeys(f.Volumes) {
+		var b strings.Builder
+		b.WriteString("[Volume]\n")
+		writeKey(&b, "VolumeName", name)
+		if v := f.Volumes[name]; v != nil {
+			if v.Driver != "" {
+				writeKey(&b, "Driver", v.Driver)
+			}
+			var opts []string
+			for _, k := range sortedKeys(v.DriverOpts) {
+				opts = append(opts, "--opt", k+"="+v.DriverOpts[k])
+			}
+			if len(opts) > 0 {
+				writeExec(&b, "PodmanArgs=", opts...)
+			}
+			labels := v.Labels.values()
+			for _, k := range sortedKeys(labels) {
+				writeKey(&b, "Label", k+"="+labels[k])
+			}
+		}
+		units = append(units, unitFile{Name: name + ".volume", Content: b.String()})
+	}
+
+	for _, name := range sortedKeys(f.Networks) {
+		var b strings.Builder
+		b.WriteString("[Network]\n")
+		writeKey(&b, "NetworkName", name)
+		if n := f.Networks[name]; n != nil {
+			if n.Driver != "" {
+				writeKey(&b, "Driver", n.Driver)
+			}
+			for _, k := range sortedKeys(n.DriverOpts) {
+				writeKey(&b, "Options", k+"="+n.DriverOpts[k])
+			}
+			for _, c := range n.IPAM.Config {
+				if c.Subnet != "" {
+					writeKey(&b, "Subnet", c.Subnet)
+				}
+				if c.Gateway != "" {
+					writeKey(&b, "Gateway", c.Gateway)
+				}
+				if c.IPRange != "" {
+					writeKey(&b, "IPRange", c.IPRange)
+				}
+			}
+			if n.Internal {
+				writeKey(&b, "Internal", "true")
+			}
+			if n.EnableIPv6 {
+				writeKey(&b, "IPv6", "true")
+			}
+			labels := n.Labels.values()
+			for _, k := range sortedKeys(labels) {
+				writeKey(&b, "Label", k+"="+labels[k])
+			}
+		}
+		units = append(units, unitFile{Name: name + ".network", Content: b.String()})
+	}
+	return units
+}
+
+// systemdRestart converts a Compose restart value to systemd's Restart=.
+// Docker's daemon no longer restarts the container, so systemd does.
+func systemdRestart(restart string) string {
+	switch {
+	case restart == "always" || restart == "unless-stopped":
+		return "always"
+	case strings.HasPrefix(restart, "on-failure"):
+		return "on-failure"
+	}
+	return "no"
+}
+
+// writeKey writes a key=value line with the value quoted if it needs to be.
+func writeKey(b *strings.Builder, key, value string) {
+	fmt.Fprintf(b, "%s=%s\n", key, systemdQuote(value))
+}
+
+// writeExec writes a command line setting, such as ExecStart=, with each
+// argument quoted if it needs to be.
+func writeExec(b *strings.Builder, prefix string, args ...string) {
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		// systemd expands $VAR on command lines
+		quoted[i] = strings.ReplaceAll(systemdQuote(a), "$", "$$")
+	}
+	fmt.Fprintf(b, "%s%s\n", prefix, strings.Join(quoted, " "))
+}
+
+// systemdQuote escapes the % that starts a systemd specifier and wraps s in
+// double quotes when it is empty or has spaces, quotes, backslashes or
+// control characters.
+func systemdQuote(s string) string {
+	s = strings.ReplaceAll(s, "%", "%%")
+	if s != "" && !strings.ContainsAny(s, " \t\n\"'\\;") {
+		return s
+	}
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"', '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"dockerap/templates"
+	"html/template"
+	"io/fs"
+	"os"
+)
+
+// pageTemplates are the parsed UI pages.
+type pageTemplates struct {
+	index     *template.Template
+	login     *template.Template
+	container *template.Template
+	history   *template.Template
+}
+
+// templateFS returns the UI templates: the copies embedded in the binary, or
+// the files in TemplatesDir when it is set, so they can be edited without
+// rebuilding.
+func (s *Server) templateFS() fs.FS {
+	if s.cfg.TemplatesDir != "" {
+		return os.DirFS(s.cfg.TemplatesDir)
+	}
+	return templates.FS
+}
+
+// parseTemplates parses every UI page. The index page's per-request
+// functions are bound to placeholders here and replaced in indexTemplate.
+func (s *Server) parseTemplates() (*pageTemplates, error) {
+	index, err := template.New("index.html").Funcs(s.indexFuncs("", principal{})).ParseFS(s.templateFS(), "index.html", "fragments.html")
+	if err != nil {
+		return nil, err
+	}
+	login, err := template.ParseFS(s.templateFS(), "login.html")
+	if err != nil {
+		return nil, err
+	}
+	container, err := template.ParseFS(s.templateFS(), "container.html")
+	if err != nil {
+		return nil, err
+	}
+	history, err := template.New("history.html").Funcs(template.FuncMap{"formatBytes": formatBytes}).ParseFS(s.templateFS(), "history.html")
+	if err != nil {
+		return nil, err
+	}
+	return &pageTemplates{index: index, login: login, container: container, history: history}, nil
+}
+
+// pages returns the templates parsed at startup, or in dev mode parses them
+// again so edits show up on the next reload.
+func (s *Server) pages() (*pageTemplates, error) {
+	if s.cfg.Dev {
+		return s.parseTemplates()
+	}
+	return s.templates, nil
+}
+
+// indexFuncs are the functions index.html calls, bound to one request.
+func (s *Server) indexFuncs(csrf string, p principal) template.FuncMap {
+	return template.FuncMap{
+		"loginEnabled": s.cfg.LoginEnabled,
+		"formatBytes":  formatBytes,
+		"csrfToken": func() string {
+			return csrf
+		},
+		"principal": func() principal {
+			return p
+		},
+	}
+}
+
+// indexTemplate returns a copy of index.html bound to the request's CSRF
+// token and principal. The shared template is never executed itself, so it
+// can always be cloned.
+func (s *Server) indexTemplate(csrf string, p principal) (*template.Template, error) {
+	pages, err := s.pages()
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := pages.index.Clone()
+	if err != nil {
+		return nil, err
+	}
+	return tmpl.Funcs(s.indexFuncs(csrf, p)), nil
+}
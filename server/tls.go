@@ -0,0 +1,202 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"dockerap/config"
+	"encoding/pem"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// loadTLSConfig reads the TLS_* settings for serving HTTPS and the PEER_*
+// settings for trusting other instances' certificates.
+func loadTLSConfig(v *config.Validator, cfg *Config) {
+	cfg.TLSCertFile = os.Getenv("TLS_CERT_FILE")
+	cfg.TLSKeyFile = os.Getenv("TLS_KEY_FILE")
+	cfg.TLSSelfSigned = v.Bool("TLS_SELF_SIGNED", false)
+	cfg.TLSDir = os.Getenv("TLS_SELF_SIGNED_DIR")
+	if cfg.TLSDir == "" {
+		cfg.TLSDir = "./tls"
+	}
+	for _, h := range strings.Split(os.Getenv("TLS_SELF_SIGNED_HOSTS"), ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			cfg.TLSHosts = append(cfg.TLSHosts, h)
+		}
+	}
+
+	v.Pair("TLS_CERT_FILE", cfg.TLSCertFile, "TLS_KEY_FILE", cfg.TLSKeyFile)
+	if cfg.TLSCertFile != "" {
+		v.File("TLS_CERT_FILE", cfg.TLSCertFile)
+	}
+	if cfg.TLSKeyFile != "" {
+		v.File("TLS_KEY_FILE", cfg.TLSKeyFile)
+	}
+	if cfg.TLSSelfSigned && cfg.TLSCertFile != "" {
+		v.Add("TLS_SELF_SIGNED", "is set together with TLS_CERT_FILE, so the generated certificate would be ignored", "unset one of them")
+	}
+
+	peerTLS := &tls.Config{}
+	if caFile := os.Getenv("PEER_CA_FILE"); caFile != "" {
+		pemData, err := os.ReadFile(caFile)
+		if err != nil {
+			v.Add("PEER_CA_FILE", fmt.Sprintf("cannot read %s: %s", caFile, err), "check the path and that the file is mounted into the container")
+		} else {
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pemData) {
+				v.Add("PEER_CA_FILE", caFile+" contains no PEM certificates", "point it at a PEM-encoded CA bundle or another instance's certificate")
+			}
+			peerTLS.RootCAs = pool
+		}
+	}
+	peerTLS.InsecureSkipVerify = v.Bool("PEER_INSECURE_SKIP_VERIFY", false)
+	if peerTLS.InsecureSkipVerify && peerTLS.RootCAs != nil {
+		v.Add("PEER_INSECURE_SKIP_VERIFY", "is set together with PEER_CA_FILE, so the CA bundle is ignored", "unset one of them")
+	}
+	clientCert, clientKey := os.Getenv("MTLS_CERT_FILE"), os.Getenv("MTLS_KEY_FILE")
+	v.Pair("MTLS_CERT_FILE", clientCert, "MTLS_KEY_FILE", clientKey)
+	if clientCert != "" && clientKey != "" {
+		cert, err := tls.LoadX509KeyPair(clientCert, clientKey)
+		if err != nil {
+			v.Add("MTLS_CERT_FILE", fmt.Sprintf("cannot load the client certificate: %s", err), "point MTLS_CERT_FILE and MTLS_KEY_FILE at a matching PEM certificate and key")
+		} else {
+			peerTLS.Certificates = []tls.Certificate{cert}
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = peerTLS
+	cfg.PeerTransport = transport
+
+	if caFile := os.Getenv("MTLS_CLIENT_CA_FILE"); caFile != "" {
+		pemData, err := os.ReadFile(caFile)
+		if err != nil {
+			v.Add("MTLS_CLIENT_CA_FILE", fmt.Sprintf("cannot read %s: %s", caFile, err), "check the path and that the file is mounted into the container")
+		} else {
+			cfg.ClientCAs = x509.NewCertPool()
+			if !cfg.ClientCAs.AppendCertsFromPEM(pemData) {
+				v.Add("MTLS_CLIENT_CA_FILE", caFile+" contains no PEM certificates", "point it at the CA that signs the peers' client certificates")
+			}
+		}
+		if !cfg.TLSEnabled() {
+			v.Add("MTLS_CLIENT_CA_FILE", "is set but the server does not serve HTTPS", "set TLS_CERT_FILE and TLS_KEY_FILE, or TLS_SELF_SIGNED=true")
+		}
+	}
+}
+
+// serverTLSConfig asks clients for a certificate when mutual TLS is
+// configured. Browsers without one can still use the UI; the destination API
+// rejects them in requireToken.
+func (c *Config) serverTLSConfig() *tls.Config {
+	if c.ClientCAs == nil {
+		return nil
+	}
+	return &tls.Config{ClientCAs: c.ClientCAs, ClientAuth: tls.VerifyClientCertIfGiven}
+}
+
+// TLSEnabled reports whether the server serves HTTPS.
+func (c *Config) TLSEnabled() bool {
+	return c.TLSCertFile != "" || c.TLSSelfSigned
+}
+
+// peerTransport is the transport for requests to the DockerApp instance at
+// dest, with the settings of the stored destination at that URL if any.
+func (s *Server) peerTransport(dest string) http.RoundTripper {
+	if rt := s.destinationTransport(dest); rt != nil {
+		return rt
+	}
+	var base http.RoundTripper = http.DefaultTransport
+	if s.cfg.PeerTransport != nil {
+		base = s.cfg.PeerTransport
+	}
+	base = &requestIDTransport{base: base}
+	if s.cfg.APIToken != "" {
+		return &tokenTransport{base: base, token: s.cfg.APIToken}
+	}
+	return base
+}
+
+// peerClient returns an HTTP client for requests to the DockerApp instance at dest.
+func (s *Server) peerClient(dest string) *http.Client {
+	return &http.Client{Transport: s.peerTransport(dest)}
+}
+
+// ensureSelfSignedCert returns the certificate and key in dir, generating
+// and saving a self-signed pair on first run so restarts keep the same
+// certificate and peers that trust it keep working.
+func ensureSelfSignedCert(dir string, hosts []string) (string, string, error) {
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	if _, err := os.Stat(certFile); err == nil {
+		if _, err := tls.LoadX509KeyPair(certFile, keyFile); err != nil {
+			return "", "", fmt.Errorf("load %s: %w", certFile, err)
+		}
+		return certFile, keyFile, nil
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return "", "", err
+	}
+	hostname, _ := os.Hostname()
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "DockerApp " + hostname},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(5, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	for _, h := range append([]string{"localhost", "127.0.0.1", hostname}, hosts...) {
+		if ip := net.ParseIP(h); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else if h != "" {
+			tmpl.DNSNames = append(tmpl.DNSNames, h)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return "", "", err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return "", "", err
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", "", err
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		return "", "", err
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644); err != nil {
+		return "", "", err
+	}
+	slog.Info("Generated self-signed certificate", "cert_file", certFile, "hosts", append(tmpl.DNSNames, ipStrings(tmpl.IPAddresses)...), "sha256", fmt.Sprintf("%x", sha256.Sum256(der)))
+	return certFile, keyFile, nil
+}
+
+func ipStrings(ips []net.IP) []string {
+	out := make([]string, len(ips))
+	for i, ip := range ips {
+		out[i] = ip.String()
+	}
+	return out
+}
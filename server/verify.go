@@ -0,0 +1,349 @@
+package server
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"dockerap/apiclient"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+)
+
+// Drift statuses reported by /api/verify.
+const (
+	DriftInSync  = "in-sync"
+	DriftChanged = "drift"
+	DriftMissing = "missing"
+	DriftError   = "error"
+)
+
+// fingerprintContainer inspects a container and checksums the requested mounts.
+func fingerprintContainer(ctx context.Context, cli *client.Client, target apiclient.FingerprintTarget) apiclient.ContainerFingerprint {
+	fp := apiclient.ContainerFingerprint{Name: target.Name}
+	inspect, err := cli.ContainerInspect(ctx, target.Name)
+	if err != nil {
+		if client.IsErrNotFound(err) {
+			return fp
+		}
+		fp.Error = err.Error()
+		return fp
+	}
+	fp.Found = true
+	fp.ImageID = inspect.Image
+	fp.ConfigHash = configHash(inspect.Config.Env, inspect.Config.Cmd, inspect.Config.Entrypoint,
+		inspect.Config.WorkingDir, inspect.Config.User, inspect.Config.Healthcheck, inspect.Config.Labels)
+
+	for _, m := range target.Mounts {
+		m.Checksum, m.Files, m.Bytes, err = checksumPath(ctx, cli, inspect.ID, m.Path, m.Excludes)
+		if err != nil {
+			m.Error = err.Error()
+		}
+		fp.Mounts = append(fp.Mounts, m)
+	}
+	return fp
+}
+
+// configHash hashes the parts of a container config that replication copies
+// unchanged. Labels DockerApp adds to replicas are left out, as are host
+// settings that port, name and bind remapping legitimately change.
+func configHash(env, cmd, entrypoint []string, workingDir, user string, hc *container.HealthConfig, l map[string]string) string {
+	h := sha256.New()
+	write := func(key string, values ...string) {
+		fmt.Fprintf(h, "%s=%q\n", key, values)
+	}
+	sortedEnv := append([]string(nil), env...)
+	sort.Strings(sortedEnv)
+	write("env", sortedEnv...)
+	write("cmd", cmd...)
+	write("entrypoint", entrypoint...)
+	write("workdir", workingDir)
+	write("user", user)
+	if hc != nil {
+		write("healthcheck", hc.Test...)
+		write("healthcheck-timing", hc.Interval.String(), hc.Timeout.String(), hc.StartPeriod.String(), hc.StartInterval.String(), fmt.Sprint(hc.Retries))
+	}
+	keys := make([]string, 0, len(l))
+	for k := range l {
+		if !strings.HasPrefix(k, "dockerapp.") {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		write("label", k, l[k])
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
+
+// checksumPath hashes the files under p in a container: each entry's path,
+// type, mode, link target and content, independent of archive order and
+// timestamps. Excluded paths are skipped, as they are when copying.
+func checksumPath(ctx context.Context, cli *client.Client, containerID, p string, excludes []string) (string, int, int64, error) {
+	excluded, err := compileExcludes(excludes)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	rc, _, err := cli.CopyFromContainer(ctx, containerID, p)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	defer rc.Close()
+
+	var entries []string
+	var files int
+	var size int64
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", 0, 0, err
+		}
+		rel := stripArchiveRoot(hdr.Name)
+		if rel != "" && excluded(rel) {
+			continue
+		}
+		content := sha256.New()
+		n, err := io.Copy(content, tr)
+		if err != nil {
+			return "", 0, 0, err
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			files++
+			size += n
+		}
+		entries = append(entries, fmt.Sprintf("%s %c %o %s %x", strings.TrimSuffix(rel, "/"), hdr.Typeflag, hdr.Mode, hdr.Linkname, content.Sum(nil)))
+	}
+	sort.Strings(entries)
+	sum := sha256.Sum256([]byte(strings.Join(entries, "\n")))
+	return "sha256:" + hex.EncodeToString(sum[:]), files, size, nil
+}
+
+// Destination API: Fingerprint containers and volumes for verification
+func (s *Server) handleFingerprint(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var payload apiclient.FingerprintRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	cli, err := newDockerClient(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to create docker client", "err", err)
+		writeError(w, r, "Unable to create docker client", err)
+		return
+	}
+	defer cli.Close()
+
+	ctx := r.Context()
+	resp := apiclient.FingerprintResponse{Volumes: make(map[string]bool)}
+	for _, target := range payload.Containers {
+		resp.Containers = append(resp.Containers, fingerprintContainer(ctx, cli, target))
+	}
+	for _, name := range payload.Volumes {
+		_, err := cli.VolumeInspect(ctx, name)
+		resp.Volumes[name] = err == nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// DriftItem is the outcome of one verification check.
+type DriftItem struct {
+	Type        string `json:"type"` // container or volume
+	Name        string `json:"name"`
+	Check       string `json:"check"` // exists, image, config or "data <path>"
+	Status      string `json:"status"`
+	Source      string `json:"source,omitempty"`
+	Destination string `json:"destination,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// VerifyResult is the verification report for one destination.
+type VerifyResult struct {
+	Destination string      `json:"destination"`
+	InSync      bool        `json:"inSync"`
+	Items       []DriftItem `json:"items"`
+	Error       string      `json:"error,omitempty"`
+}
+
+// handleVerify compares the selected source containers and volumes with
+// their replicas on each destination: image ID, config hash and the checksum
+// of every replicated mount. It accepts the same body as /api/plan.
+func (s *Server) handleVerify(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var payload replicateRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if profile := r.URL.Query().Get("profile"); profile != "" {
+		payload.Profile = profile
+	}
+	if err := payload.Rename.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	destinations, err := s.destinations(&payload)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(destinations) == 0 {
+		http.Error(w, "Destination host addresses cannot be empty", http.StatusBadRequest)
+		return
+	}
+
+	srcCli, err := newDockerClient(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to create source docker client", "err", err)
+		writeError(w, r, "Unable to create source docker client", err)
+		return
+	}
+	defer srcCli.Close()
+
+	ctx := r.Context()
+	plan, err := s.buildPlan(ctx, srcCli, "", payload.Profile, payload.ImageDecisions)
+	if err != nil {
+		writeSelectionError(w, r, err)
+		return
+	}
+	applyNameRemap(plan, payload.Rename)
+
+	// The source side is fingerprinted once and compared with every destination
+	var srcReq, destReq apiclient.FingerprintRequest
+	for _, pc := range plan.Containers {
+		var mounts []apiclient.MountChecksum
+		for _, dm := range pc.DataMounts {
+			mounts = append(mounts, apiclient.MountChecksum{Path: dm.Path, Excludes: dm.Excludes})
+		}
+		srcReq.Containers = append(srcReq.Containers, apiclient.FingerprintTarget{Name: pc.Inspect.ID, Mounts: mounts})
+		destReq.Containers = append(destReq.Containers, apiclient.FingerprintTarget{Name: pc.Name, Mounts: mounts})
+	}
+	for _, vol := range plan.Volumes {
+		destReq.Volumes = append(destReq.Volumes, plan.volumeName(vol.Name))
+	}
+	var source []apiclient.ContainerFingerprint
+	for _, target := range srcReq.Containers {
+		source = append(source, fingerprintContainer(ctx, srcCli, target))
+	}
+
+	results := make([]VerifyResult, len(destinations))
+	var wg sync.WaitGroup
+	for i, dest := range destinations {
+		wg.Add(1)
+		go func(i int, dest string) {
+			defer wg.Done()
+			results[i] = verifyDestination(ctx, s.peerClient(dest), dest, plan, source, destReq)
+		}(i, dest)
+	}
+	wg.Wait()
+
+	for _, res := range results {
+		slog.InfoContext(ctx, "Verified", "destination", res.Destination, "in_sync", res.InSync)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"destinations": results,
+		"skipped":      plan.Skipped,
+	})
+}
+
+// verifyDestination fingerprints the replicas on dest and compares them with source.
+func verifyDestination(ctx context.Context, httpClient *http.Client, dest string, plan *replicationPlan, source []apiclient.ContainerFingerprint, req apiclient.FingerprintRequest) VerifyResult {
+	result := VerifyResult{Destination: dest, Items: []DriftItem{}}
+	if err := checkPeerAPI(ctx, httpClient, dest); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	remote, err := apiclient.New(dest, httpClient).Fingerprint(ctx, req)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if len(remote.Containers) != len(source) {
+		result.Error = fmt.Sprintf("destination fingerprinted %d containers, expected %d", len(remote.Containers), len(source))
+		return result
+	}
+
+	add := func(item DriftItem) {
+		result.Items = append(result.Items, item)
+	}
+	compare := func(item DriftItem) {
+		item.Status = DriftInSync
+		if item.Source != item.Destination {
+			item.Status = DriftChanged
+		}
+		add(item)
+	}
+
+	for i, src := range source {
+		name := containerName(plan.Containers[i].Inspect)
+		dst := remote.Containers[i]
+		switch {
+		case src.Error != "":
+			add(DriftItem{Type: "container", Name: name, Check: "exists", Status: DriftError, Error: "source: " + src.Error})
+			continue
+		case dst.Error != "":
+			add(DriftItem{Type: "container", Name: name, Check: "exists", Status: DriftError, Error: dst.Error})
+			continue
+		case !dst.Found:
+			add(DriftItem{Type: "container", Name: name, Check: "exists", Status: DriftMissing, Destination: dst.Name})
+			continue
+		}
+		compare(DriftItem{Type: "container", Name: name, Check: "image", Source: src.ImageID, Destination: dst.ImageID})
+		compare(DriftItem{Type: "container", Name: name, Check: "config", Source: src.ConfigHash, Destination: dst.ConfigHash})
+		for j, m := range src.Mounts {
+			check := "data " + m.Path
+			if j >= len(dst.Mounts) {
+				add(DriftItem{Type: "container", Name: name, Check: check, Status: DriftError, Error: "not checksummed on the destination"})
+				continue
+			}
+			if m.Error != "" || dst.Mounts[j].Error != "" {
+				add(DriftItem{Type: "container", Name: name, Check: check, Status: DriftError,
+					Error: strings.TrimSpace("source: " + m.Error + " destination: " + dst.Mounts[j].Error)})
+				continue
+			}
+			compare(DriftItem{Type: "container", Name: name, Check: check,
+				Source:      fmt.Sprintf("%s (%d files, %d bytes)", m.Checksum, m.Files, m.Bytes),
+				Destination: fmt.Sprintf("%s (%d files, %d bytes)", dst.Mounts[j].Checksum, dst.Mounts[j].Files, dst.Mounts[j].Bytes)})
+		}
+	}
+	for _, vol := range plan.Volumes {
+		item := DriftItem{Type: "volume", Name: vol.Name, Check: "exists", Status: DriftInSync}
+		if !remote.Volumes[plan.volumeName(vol.Name)] {
+			item.Status = DriftMissing
+		}
+		add(item)
+	}
+
+	result.InSync = true
+	for _, item := range result.Items {
+		if item.Status != DriftInSync {
+			result.InSync = false
+		}
+	}
+	return result
+}
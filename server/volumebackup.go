@@ -0,0 +1,202 @@
+package server
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"dockerap/store"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+)
+
+// handleVolumeExport streams a volume's contents as a tar.gz download. The
+// archive's entries are relative to the volume root, so it can be unpacked
+// anywhere or sent back to /api/volumes/{name}/import.
+func (s *Server) handleVolumeExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := r.PathValue("name")
+
+	cli, err := newDockerClient(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to create docker client", "err", err)
+		writeError(w, r, "Unable to create docker client", err)
+		return
+	}
+	defer cli.Close()
+
+	ctx := r.Context()
+	if _, err := cli.VolumeInspect(ctx, name); err != nil {
+		status := http.StatusInternalServerError
+		if client.IsErrNotFound(err) {
+			status = http.StatusNotFound
+		}
+		http.Error(w, fmt.Sprintf("Unable to inspect volume: %s", err), status)
+		return
+	}
+	id, p, release, err := s.volumeAccess(ctx, cli, name)
+	if err != nil {
+		slog.ErrorContext(ctx, "Unable to reach volume", "volume", name, "err", err)
+		writeError(w, r, "Unable to reach volume", err)
+		return
+	}
+	defer release()
+	rc, _, err := cli.CopyFromContainer(ctx, id, p)
+	if err != nil {
+		slog.ErrorContext(ctx, "Unable to read volume", "volume", name, "err", err)
+		writeError(w, r, "Unable to read volume", err)
+		return
+	}
+	defer rc.Close()
+
+	filename := fmt.Sprintf("%s-%s.tar.gz", name, time.Now().UTC().Format("20060102-150405"))
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	counter := &countingWriter{w: w}
+	gz := gzip.NewWriter(counter)
+	err = rerootTar(rc, gz)
+	if err == nil {
+		err = gz.Close()
+	}
+	s.auditVolumeBackup(r, "volume-export", name, counter.n.Load(), err)
+	if err != nil {
+		// Headers are sent; the truncated archive fails to unpack
+		slog.ErrorContext(ctx, "Failed to export volume", "volume", name, "err", err)
+		return
+	}
+	slog.InfoContext(ctx, "Exported volume", "volume", name, "bytes", counter.n.Load())
+}
+
+// rerootTar copies a Docker archive of a directory from r to w with the
+// directory itself stripped from every entry name.
+func rerootTar(r io.Reader, w io.Writer) error {
+	tr := tar.NewReader(r)
+	tw := tar.NewWriter(w)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		rel := stripArchiveRoot(hdr.Name)
+		if rel == "" {
+			continue
+		}
+		hdr.Name = rel
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// handleVolumeImport unpacks a tar or tar.gz, as made by the export, into a
+// volume, creating the volume if it does not exist. Files in the archive
+// overwrite those in the volume; other files are left alone.
+func (s *Server) handleVolumeImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := r.PathValue("name")
+
+	cli, err := newDockerClient(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to create docker client", "err", err)
+		writeError(w, r, "Unable to create docker client", err)
+		return
+	}
+	defer cli.Close()
+
+	ctx := r.Context()
+	created := false
+	if _, err := cli.VolumeInspect(ctx, name); client.IsErrNotFound(err) {
+		if _, err := cli.VolumeCreate(ctx, volume.CreateOptions{Name: name}); err != nil {
+			slog.ErrorContext(ctx, "Unable to create volume", "volume", name, "err", err)
+			writeError(w, r, "Unable to create volume", err)
+			return
+		}
+		created = true
+	} else if err != nil {
+		slog.ErrorContext(ctx, "Unable to inspect volume", "volume", name, "err", err)
+		writeError(w, r, "Unable to inspect volume", err)
+		return
+	}
+	id, p, release, err := s.volumeAccess(ctx, cli, name)
+	if err != nil {
+		slog.ErrorContext(ctx, "Unable to reach volume", "volume", name, "err", err)
+		writeError(w, r, "Unable to reach volume", err)
+		return
+	}
+	defer release()
+
+	// The Docker archive API unpacks plain and gzip-compressed tars alike
+	body := &countingReader{ReadCloser: r.Body, n: new(atomic.Int64)}
+	err = cli.CopyToContainer(ctx, id, p, body, types.CopyToContainerOptions{})
+	s.auditVolumeBackup(r, "volume-import", name, body.n.Load(), err)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to import volume", "volume", name, "err", err)
+		status := http.StatusInternalServerError
+		if errdefs.IsInvalidParameter(err) {
+			status = http.StatusBadRequest
+		}
+		http.Error(w, fmt.Sprintf("Failed to import volume: %s", err), status)
+		return
+	}
+
+	slog.InfoContext(ctx, "Imported volume", "volume", name, "bytes", body.n.Load(), "created", created)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"volume":  name,
+		"created": created,
+		"bytes":   body.n.Load(),
+	})
+}
+
+// auditVolumeBackup records a volume export or import.
+func (s *Server) auditVolumeBackup(r *http.Request, action, name string, n int64, err error) {
+	p, _ := principalFrom(r.Context())
+	entry := store.AuditEntry{
+		Actor:      p.User,
+		RemoteAddr: r.RemoteAddr,
+		Action:     action,
+		Target:     name,
+		Outcome:    "succeeded",
+		Detail:     fmt.Sprintf("%d bytes", n),
+	}
+	if err != nil {
+		entry.Outcome = "failed"
+		entry.Detail = err.Error()
+	}
+	if auditErr := s.store.RecordAudit(entry); auditErr != nil {
+		slog.ErrorContext(r.Context(), "Unable to record audit entry", "action", entry.Action, "err", auditErr)
+	}
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n atomic.Int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n.Add(int64(n))
+	return n, err
+}
@@ -0,0 +1,28 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestVolumeExportNeedsOperator(t *testing.T) {
+	srv := newTestServer(t, testRoles)
+	for _, method := range []string{http.MethodGet, http.MethodHead} {
+		if w := serve(t, srv, method, "/api/volumes/pgdata/export", "vera", nil); w.Code != http.StatusForbidden {
+			t.Errorf("%s export as viewer: %d, want 403", method, w.Code)
+		}
+	}
+
+	const token = "peer-token-0123456789"
+	if err := srv.store.CreatePeerToken("source", "10.0.0.5", token); err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodGet, "/api/volumes/pgdata/export", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("export with a peer token: %d, want 401", w.Code)
+	}
+}
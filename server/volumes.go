@@ -0,0 +1,159 @@
+package server
+
+import (
+	"context"
+	"dockerap/labels"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/client"
+)
+
+// volumeHelperPath is where a helper container mounts the volume it reaches.
+const volumeHelperPath = "/volume"
+
+// localVolume is a volume on this host as listed by /api/volumes.
+type localVolume struct {
+	Name       string            `json:"name"`
+	Driver     string            `json:"driver"`
+	Scope      string            `json:"scope"`
+	Mountpoint string            `json:"mountpoint"`
+	CreatedAt  string            `json:"createdAt"`
+	Labels     map[string]string `json:"labels"`
+	Options    map[string]string `json:"options"`
+	Size       int64             `json:"size"` // bytes, -1 when the driver cannot tell
+	Containers []string          `json:"containers"`
+	IsSelected bool              `json:"isSelected"`
+}
+
+// handleVolumes lists every volume on this host, including ones no
+// container mounts, with its driver, labels, disk usage, the containers
+// using it and whether it is selected for replication.
+func (s *Server) handleVolumes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	cli, err := newDockerClient(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to create docker client", "err", err)
+		writeError(w, r, "Unable to create docker client", err)
+		return
+	}
+	defer cli.Close()
+
+	// The disk usage call lists the volumes and works out their sizes in one go
+	du, err := cli.DiskUsage(r.Context(), types.DiskUsageOptions{Types: []types.DiskUsageObject{types.VolumeObject}})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to read volume disk usage", "err", err)
+		writeError(w, r, "Unable to read volume disk usage", err)
+		return
+	}
+	containers, err := cli.ContainerList(r.Context(), container.ListOptions{All: true})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to list containers", "err", err)
+		writeError(w, r, "Unable to list containers", err)
+		return
+	}
+	usedBy := make(map[string][]string)
+	for _, c := range containers {
+		if len(c.Names) == 0 {
+			continue
+		}
+		for _, m := range c.Mounts {
+			if m.Type == mount.TypeVolume {
+				usedBy[m.Name] = append(usedBy[m.Name], strings.TrimPrefix(c.Names[0], "/"))
+			}
+		}
+	}
+	selected, err := s.store.GetSelectedVolumes()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Unable to get selected volumes", "err", err)
+		writeError(w, r, "Unable to get selected volumes", err)
+		return
+	}
+
+	volumes := make([]localVolume, 0, len(du.Volumes))
+	for _, v := range du.Volumes {
+		lv := localVolume{
+			Name:       v.Name,
+			Driver:     v.Driver,
+			Scope:      v.Scope,
+			Mountpoint: v.Mountpoint,
+			CreatedAt:  v.CreatedAt,
+			Labels:     v.Labels,
+			Options:    v.Options,
+			Size:       -1,
+			Containers: usedBy[v.Name],
+			IsSelected: selected[v.Name],
+		}
+		if v.UsageData != nil {
+			lv.Size = v.UsageData.Size
+		}
+		if lv.Labels == nil {
+			lv.Labels = map[string]string{}
+		}
+		if lv.Options == nil {
+			lv.Options = map[string]string{}
+		}
+		if lv.Containers == nil {
+			lv.Containers = []string{}
+		}
+		volumes = append(volumes, lv)
+	}
+	sort.Slice(volumes, func(i, j int) bool { return volumes[i].Name < volumes[j].Name })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(volumes)
+}
+
+// volumeAccess returns a container and path through which the contents of a
+// volume can be read or written with the Docker archive API: a container
+// that already mounts it, or else a helper container mounting it at
+// volumeHelperPath. release removes the helper, if one was made.
+func (s *Server) volumeAccess(ctx context.Context, cli *client.Client, volume string) (id, p string, release func(), err error) {
+	if id, p, err := volumeMountContainer(ctx, cli, volume); err == nil {
+		return id, p, func() {}, nil
+	}
+	id, release, err = s.helperContainer(ctx, cli, volume, volumeHelperPath)
+	if err != nil {
+		return "", "", nil, err
+	}
+	return id, volumeHelperPath, release, nil
+}
+
+// helperContainer creates a container that mounts volume at p and is never
+// started, which is all the archive API needs. The helper image is pulled
+// if this host does not have it yet.
+func (s *Server) helperContainer(ctx context.Context, cli *client.Client, volume, p string) (string, func(), error) {
+	img := s.cfg.VolumeHelperImage
+	if err := s.ensureImage(ctx, cli, img); err != nil {
+		return "", nil, fmt.Errorf("volume helper: %w", err)
+	}
+
+	created, err := cli.ContainerCreate(ctx,
+		&container.Config{Image: img, Labels: map[string]string{labels.Helper: "true"}},
+		&container.HostConfig{Mounts: []mount.Mount{{Type: mount.TypeVolume, Source: volume, Target: p}}},
+		nil, nil, "")
+	if err != nil {
+		return "", nil, fmt.Errorf("create helper container for volume %s: %w", volume, err)
+	}
+	release := func() {
+		// Removal must happen even if the request that needed the helper was cancelled
+		rmCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+		defer cancel()
+		if err := cli.ContainerRemove(rmCtx, created.ID, container.RemoveOptions{Force: true}); err != nil {
+			slog.WarnContext(ctx, "Unable to remove volume helper container", "container", created.ID, "err", err)
+		}
+	}
+	return created.ID, release, nil
+}
@@ -0,0 +1,139 @@
+package soak
+
+import (
+	"dockerap/config"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// File size distributions for synthetic volumes.
+const (
+	DistFixed     = "fixed"     // every file is the mean size
+	DistUniform   = "uniform"   // sizes spread evenly between 0 and twice the mean
+	DistLognormal = "lognormal" // mostly small files with a long tail of large ones
+)
+
+// Config controls a soak run.
+type Config struct {
+	SourceURL      string
+	DestinationURL string
+	VolumeSize     int64
+	FileCount      int
+	Distribution   string
+	Iterations     int
+	HelperImage    string
+	Keep           bool
+	MaxRSS         int64  // fail when either instance exceeds this resident size, 0 for no limit
+	APIToken       string // sent as a bearer token when the instances require a login
+}
+
+// LoadConfig reads the SOAK_* environment variables.
+func LoadConfig() (*Config, error) {
+	v := &config.Validator{}
+	cfg := &Config{
+		SourceURL:      strings.TrimRight(os.Getenv("SOAK_SOURCE_URL"), "/"),
+		DestinationURL: strings.TrimRight(v.Required("SOAK_DESTINATION_URL", "set it to the URL of the DockerApp instance to replicate to"), "/"),
+		FileCount:      1000,
+		Distribution:   os.Getenv("SOAK_FILE_SIZE_DISTRIBUTION"),
+		Iterations:     1,
+		HelperImage:    os.Getenv("SOAK_HELPER_IMAGE"),
+		Keep:           v.Bool("SOAK_KEEP", false),
+		VolumeSize:     256 << 20,
+		APIToken:       os.Getenv("API_TOKEN"),
+	}
+	if cfg.SourceURL == "" {
+		cfg.SourceURL = "http://localhost:8080"
+	}
+	v.URL("SOAK_SOURCE_URL", cfg.SourceURL)
+	if cfg.DestinationURL != "" {
+		v.URL("SOAK_DESTINATION_URL", cfg.DestinationURL)
+	}
+	if cfg.Distribution == "" {
+		cfg.Distribution = DistLognormal
+	}
+	if cfg.HelperImage == "" {
+		cfg.HelperImage = "busybox:latest"
+	}
+
+	if s := os.Getenv("SOAK_VOLUME_SIZE"); s != "" {
+		size, err := parseSize(s)
+		if err != nil || size <= 0 {
+			v.Add("SOAK_VOLUME_SIZE", fmt.Sprintf("%q is not a size", s), "use bytes or a suffix such as 512MiB or 2GiB")
+		}
+		cfg.VolumeSize = size
+	}
+	if s := os.Getenv("SOAK_MAX_RSS"); s != "" {
+		size, err := parseSize(s)
+		if err != nil || size <= 0 {
+			v.Add("SOAK_MAX_RSS", fmt.Sprintf("%q is not a size", s), "use bytes or a suffix such as 256MiB")
+		}
+		cfg.MaxRSS = size
+	}
+	cfg.FileCount = positiveInt(v, "SOAK_FILE_COUNT", cfg.FileCount)
+	cfg.Iterations = positiveInt(v, "SOAK_ITERATIONS", cfg.Iterations)
+
+	switch cfg.Distribution {
+	case DistFixed, DistUniform, DistLognormal:
+	default:
+		v.Add("SOAK_FILE_SIZE_DISTRIBUTION", fmt.Sprintf("unknown distribution %q", cfg.Distribution), "use fixed, uniform or lognormal")
+	}
+
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func positiveInt(v *config.Validator, key string, def int) int {
+	s := os.Getenv(key)
+	if s == "" {
+		return def
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n <= 0 {
+		v.Add(key, fmt.Sprintf("%q is not a positive integer", s), "")
+		return def
+	}
+	return n
+}
+
+// parseSize parses a byte count with an optional K/M/G/T suffix, decimal
+// (KB, MB) or binary (KiB, MiB).
+func parseSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	units := []struct {
+		suffix string
+		mult   int64
+	}{
+		{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30}, {"TiB", 1 << 40},
+		{"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9}, {"TB", 1e12},
+		{"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30}, {"T", 1 << 40},
+		{"B", 1},
+	}
+	for _, u := range units {
+		if strings.HasSuffix(s, u.suffix) {
+			n, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(s, u.suffix)), 64)
+			if err != nil {
+				return 0, err
+			}
+			return int64(n * float64(u.mult)), nil
+		}
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
+
+// formatSize renders a byte count for reports.
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
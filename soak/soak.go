@@ -0,0 +1,441 @@
+// Package soak is a load and soak test harness for the replication pipeline.
+// It fills a synthetic volume on the local Docker host, replicates it through
+// a running source instance to a destination instance, and reports
+// throughput and the memory both instances used along the way.
+package soak
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"dockerap/apiclient"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/client"
+)
+
+const (
+	soakLabel      = "dockerapp.soak"
+	sampleInterval = 250 * time.Millisecond
+	filesPerDir    = 100
+)
+
+// memoryStats mirrors the fields of /api/runtime-stats the harness tracks.
+type memoryStats struct {
+	HeapAlloc uint64 `json:"heapAllocBytes"`
+	RSS       uint64 `json:"rssBytes"`
+	PeakRSS   uint64 `json:"peakRssBytes"`
+}
+
+// IterationResult is the outcome of one replication pass.
+type IterationResult struct {
+	Iteration        int           `json:"iteration"`
+	Duration         time.Duration `json:"duration"`
+	BytesPerSecond   float64       `json:"bytesPerSecond"`
+	SourcePeakRSS    uint64        `json:"sourcePeakRssBytes"`
+	SourcePeakHeap   uint64        `json:"sourcePeakHeapBytes"`
+	DestPeakRSS      uint64        `json:"destinationPeakRssBytes"`
+	DestPeakHeap     uint64        `json:"destinationPeakHeapBytes"`
+	ReplicatedItems  int           `json:"replicatedItems"`
+	FailedItems      int           `json:"failedItems"`
+	ReplicationError string        `json:"error,omitempty"`
+	MemoryExceeded   bool          `json:"memoryExceeded,omitempty"`
+}
+
+// Report summarises a soak run.
+type Report struct {
+	VolumeBytes  int64             `json:"volumeBytes"`
+	FileCount    int               `json:"fileCount"`
+	Distribution string            `json:"distribution"`
+	GenerateTime time.Duration     `json:"generateDuration"`
+	Iterations   []IterationResult `json:"iterations"`
+}
+
+// Run executes the soak test described by cfg and prints a report. It
+// returns an error if setup fails or any iteration fails to replicate.
+func Run(cfg *Config) error {
+	ctx := context.Background()
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return fmt.Errorf("unable to create docker client: %w", err)
+	}
+	defer cli.Close()
+
+	if err := ensureImage(ctx, cli, cfg.HelperImage); err != nil {
+		return err
+	}
+
+	runID := time.Now().Format("20060102-150405")
+	volName := "dockerapp-soak-" + runID
+	if _, err := cli.VolumeCreate(ctx, volume.CreateOptions{Name: volName, Labels: map[string]string{soakLabel: runID}}); err != nil {
+		return fmt.Errorf("create volume: %w", err)
+	}
+	var containers []string
+	defer func() {
+		if cfg.Keep {
+			fmt.Printf("Keeping volume %s and containers %v\n", volName, containers)
+			return
+		}
+		cleanup(ctx, cli, cfg, volName, containers)
+	}()
+
+	fmt.Printf("Generating %s in %d files (%s) in volume %s...\n", formatSize(cfg.VolumeSize), cfg.FileCount, cfg.Distribution, volName)
+	report := Report{VolumeBytes: cfg.VolumeSize, FileCount: cfg.FileCount, Distribution: cfg.Distribution}
+	start := time.Now()
+	filler, err := createHelper(ctx, cli, cfg.HelperImage, volName, volName+"-fill", runID)
+	if err != nil {
+		return err
+	}
+	containers = append(containers, filler)
+	if err := fillVolume(ctx, cli, filler, fileSizes(cfg)); err != nil {
+		return fmt.Errorf("fill volume: %w", err)
+	}
+	report.GenerateTime = time.Since(start)
+
+	httpClient := &http.Client{Transport: bearerTransport(cfg.APIToken)}
+	if err := selectItem(ctx, httpClient, cfg.SourceURL, "volume", "", volName, true); err != nil {
+		return fmt.Errorf("select volume on source: %w", err)
+	}
+
+	failed := false
+	for i := 1; i <= cfg.Iterations; i++ {
+		// Each pass needs a fresh container name, since replicas are never overwritten
+		name := fmt.Sprintf("%s-%d", volName, i)
+		id, err := createHelper(ctx, cli, cfg.HelperImage, volName, name, runID)
+		if err != nil {
+			return err
+		}
+		containers = append(containers, id)
+		if i > 1 {
+			selectItem(ctx, httpClient, cfg.SourceURL, "container", containers[len(containers)-2], "", false)
+		}
+		if err := selectItem(ctx, httpClient, cfg.SourceURL, "container", id, "", true); err != nil {
+			return fmt.Errorf("select container on source: %w", err)
+		}
+
+		result := runIteration(ctx, httpClient, cfg, i)
+		if result.ReplicationError != "" || result.FailedItems > 0 {
+			failed = true
+		}
+		// Transfers stream, so memory must stay flat however large the volume is
+		if cfg.MaxRSS > 0 && (result.SourcePeakRSS > uint64(cfg.MaxRSS) || result.DestPeakRSS > uint64(cfg.MaxRSS)) {
+			result.MemoryExceeded = true
+			failed = true
+		}
+		report.Iterations = append(report.Iterations, result)
+		printIteration(result)
+	}
+
+	printSummary(report)
+	// The JSON form is for comparing runs across builds
+	if out, err := json.MarshalIndent(report, "", "  "); err == nil {
+		fmt.Printf("\n%s\n", out)
+	}
+	if failed {
+		return fmt.Errorf("one or more iterations failed to replicate or exceeded SOAK_MAX_RSS")
+	}
+	return nil
+}
+
+// runIteration triggers one replication through the source instance while
+// sampling the memory of both instances.
+func runIteration(ctx context.Context, httpClient *http.Client, cfg *Config, iteration int) IterationResult {
+	result := IterationResult{Iteration: iteration}
+
+	sampleCtx, stopSampling := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	var srcPeak, destPeak memoryStats
+	wg.Add(2)
+	go func() { defer wg.Done(); srcPeak = sampleMemory(sampleCtx, httpClient, cfg.SourceURL) }()
+	go func() { defer wg.Done(); destPeak = sampleMemory(sampleCtx, httpClient, cfg.DestinationURL) }()
+
+	start := time.Now()
+	replicated, failedItems, err := replicate(ctx, httpClient, cfg)
+	result.Duration = time.Since(start)
+	stopSampling()
+	wg.Wait()
+
+	result.ReplicatedItems = replicated
+	result.FailedItems = failedItems
+	if err != nil {
+		result.ReplicationError = err.Error()
+	}
+	if secs := result.Duration.Seconds(); secs > 0 {
+		result.BytesPerSecond = float64(cfg.VolumeSize) / secs
+	}
+	result.SourcePeakRSS, result.SourcePeakHeap = srcPeak.RSS, srcPeak.HeapAlloc
+	result.DestPeakRSS, result.DestPeakHeap = destPeak.RSS, destPeak.HeapAlloc
+	return result
+}
+
+// replicate asks the source instance to replicate its selection to the destination.
+func replicate(ctx context.Context, httpClient *http.Client, cfg *Config) (int, int, error) {
+	payload, _ := json.Marshal(map[string]string{
+		"destinationHost":   cfg.DestinationURL,
+		"sourceHostAddress": cfg.SourceURL,
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.SourceURL+"/replicate", bytes.NewReader(payload))
+	if err != nil {
+		return 0, 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer resp.Body.Close()
+	// Partly and wholly failed jobs answer 207 and 500 with the same report
+	if resp.Header.Get("Content-Type") != "application/json" {
+		return 0, 0, apiclient.ReadError(resp)
+	}
+
+	var body struct {
+		Destinations []struct {
+			Replicated int `json:"replicated"`
+			Failed     int `json:"failed"`
+			Items      []struct {
+				Type   string `json:"type"`
+				Name   string `json:"name"`
+				Status string `json:"status"`
+				Error  string `json:"error"`
+			} `json:"items"`
+		} `json:"destinations"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return 0, 0, err
+	}
+	replicated, failed := 0, 0
+	var firstErr error
+	for _, d := range body.Destinations {
+		replicated += d.Replicated
+		failed += d.Failed
+		for _, item := range d.Items {
+			if item.Error != "" && firstErr == nil {
+				firstErr = fmt.Errorf("%s %s: %s", item.Type, item.Name, item.Error)
+			}
+		}
+	}
+	return replicated, failed, firstErr
+}
+
+// sampleMemory polls an instance's runtime stats until ctx is cancelled and
+// returns the highest values seen.
+func sampleMemory(ctx context.Context, httpClient *http.Client, baseURL string) memoryStats {
+	var peak memoryStats
+	ticker := time.NewTicker(sampleInterval)
+	defer ticker.Stop()
+	for {
+		if stats, err := fetchMemory(ctx, httpClient, baseURL); err == nil {
+			peak.RSS = max(peak.RSS, stats.RSS)
+			peak.HeapAlloc = max(peak.HeapAlloc, stats.HeapAlloc)
+			peak.PeakRSS = max(peak.PeakRSS, stats.PeakRSS)
+		}
+		select {
+		case <-ctx.Done():
+			return peak
+		case <-ticker.C:
+		}
+	}
+}
+
+func fetchMemory(ctx context.Context, httpClient *http.Client, baseURL string) (memoryStats, error) {
+	var stats memoryStats
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+"/api/runtime-stats", nil)
+	if err != nil {
+		return stats, err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return stats, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return stats, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&stats)
+	return stats, err
+}
+
+// selectItem toggles the selection of a container or volume on an instance.
+func selectItem(ctx context.Context, httpClient *http.Client, baseURL, itemType, id, name string, selected bool) error {
+	payload, _ := json.Marshal(map[string]interface{}{"type": itemType, "id": id, "name": name, "isSelected": selected})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL+"/select", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return apiclient.ReadError(resp)
+	}
+	return nil
+}
+
+// ensureImage pulls ref if it is not present locally.
+func ensureImage(ctx context.Context, cli *client.Client, ref string) error {
+	if _, _, err := cli.ImageInspectWithRaw(ctx, ref); err == nil {
+		return nil
+	}
+	fmt.Printf("Pulling helper image %s...\n", ref)
+	out, err := cli.ImagePull(ctx, ref, image.PullOptions{})
+	if err != nil {
+		return fmt.Errorf("pull helper image: %w", err)
+	}
+	defer out.Close()
+	_, err = io.Copy(io.Discard, out)
+	return err
+}
+
+// createHelper creates, but never starts, a container that mounts the
+// synthetic volume at /data.
+func createHelper(ctx context.Context, cli *client.Client, img, volName, name, runID string) (string, error) {
+	resp, err := cli.ContainerCreate(ctx,
+		&container.Config{Image: img, Cmd: []string{"sleep", "infinity"}, Labels: map[string]string{soakLabel: runID}},
+		&container.HostConfig{Binds: []string{volName + ":/data"}},
+		nil, nil, name)
+	if err != nil {
+		return "", fmt.Errorf("create helper container %s: %w", name, err)
+	}
+	return resp.ID, nil
+}
+
+// fileSizes draws cfg.FileCount sizes from the configured distribution,
+// scaled so they add up to cfg.VolumeSize.
+func fileSizes(cfg *Config) []int64 {
+	rng := rand.New(rand.NewSource(1))
+	mean := float64(cfg.VolumeSize) / float64(cfg.FileCount)
+	raw := make([]float64, cfg.FileCount)
+	var sum float64
+	for i := range raw {
+		switch cfg.Distribution {
+		case DistFixed:
+			raw[i] = mean
+		case DistUniform:
+			raw[i] = rng.Float64() * 2 * mean
+		case DistLognormal:
+			const sigma = 1.5
+			raw[i] = math.Exp(math.Log(mean) - sigma*sigma/2 + sigma*rng.NormFloat64())
+		}
+		sum += raw[i]
+	}
+
+	sizes := make([]int64, cfg.FileCount)
+	var total int64
+	for i, r := range raw {
+		sizes[i] = int64(r * float64(cfg.VolumeSize) / sum)
+		total += sizes[i]
+	}
+	sizes[len(sizes)-1] += cfg.VolumeSize - total
+	return sizes
+}
+
+// fillVolume streams a generated tar of random, incompressible files into
+// the helper container's /data without holding any file in memory.
+func fillVolume(ctx context.Context, cli *client.Client, containerID string, sizes []int64) error {
+	pr, pw := io.Pipe()
+	go func() {
+		rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+		tw := tar.NewWriter(pw)
+		now := time.Now()
+		for i, size := range sizes {
+			dir := fmt.Sprintf("d%04d", i/filesPerDir)
+			if i%filesPerDir == 0 {
+				if err := tw.WriteHeader(&tar.Header{Name: dir + "/", Typeflag: tar.TypeDir, Mode: 0o755, ModTime: now}); err != nil {
+					pw.CloseWithError(err)
+					return
+				}
+			}
+			hdr := &tar.Header{Name: fmt.Sprintf("%s/f%06d.bin", dir, i), Typeflag: tar.TypeReg, Mode: 0o644, Size: size, ModTime: now}
+			if err := tw.WriteHeader(hdr); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+			if _, err := io.CopyN(tw, rng, size); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+		pw.CloseWithError(tw.Close())
+	}()
+	return cli.CopyToContainer(ctx, containerID, "/data", pr, types.CopyToContainerOptions{})
+}
+
+// cleanup deselects and removes what the run created on the source host.
+// Replicas on the destination are left for inspection.
+func cleanup(ctx context.Context, cli *client.Client, cfg *Config, volName string, containers []string) {
+	httpClient := &http.Client{Timeout: 10 * time.Second, Transport: bearerTransport(cfg.APIToken)}
+	selectItem(ctx, httpClient, cfg.SourceURL, "volume", "", volName, false)
+	for _, id := range containers {
+		selectItem(ctx, httpClient, cfg.SourceURL, "container", id, "", false)
+		if err := cli.ContainerRemove(ctx, id, container.RemoveOptions{Force: true}); err != nil {
+			fmt.Printf("Unable to remove helper container %s: %s\n", id, err)
+		}
+	}
+	if err := cli.VolumeRemove(ctx, volName, true); err != nil {
+		fmt.Printf("Unable to remove volume %s: %s\n", volName, err)
+	}
+	fmt.Printf("Removed soak artifacts from the source. Replicas named %s-* remain on the destination.\n", volName)
+}
+
+// bearerTransport adds the API token to every request, so the soak test can
+// reach instances that require a login.
+func bearerTransport(token string) http.RoundTripper {
+	if token == "" {
+		return http.DefaultTransport
+	}
+	return roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		req = req.Clone(req.Context())
+		req.Header.Set("Authorization", "Bearer "+token)
+		return http.DefaultTransport.RoundTrip(req)
+	})
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func printIteration(r IterationResult) {
+	status := "ok"
+	if r.ReplicationError != "" {
+		status = "error: " + r.ReplicationError
+	} else if r.MemoryExceeded {
+		status = "peak RSS over the limit"
+	}
+	fmt.Printf("Iteration %d: %s (%s/s), source peak RSS %s, destination peak RSS %s, %d replicated, %d failed, %s\n",
+		r.Iteration, r.Duration.Round(time.Millisecond), formatSize(int64(r.BytesPerSecond)),
+		formatSize(int64(r.SourcePeakRSS)), formatSize(int64(r.DestPeakRSS)), r.ReplicatedItems, r.FailedItems, status)
+}
+
+func printSummary(report Report) {
+	if len(report.Iterations) == 0 {
+		return
+	}
+	minRate, maxRate, sumRate := math.MaxFloat64, 0.0, 0.0
+	var srcRSS, destRSS uint64
+	for _, r := range report.Iterations {
+		minRate = math.Min(minRate, r.BytesPerSecond)
+		maxRate = math.Max(maxRate, r.BytesPerSecond)
+		sumRate += r.BytesPerSecond
+		srcRSS = max(srcRSS, r.SourcePeakRSS)
+		destRSS = max(destRSS, r.DestPeakRSS)
+	}
+	fmt.Printf("\nGenerated %s in %s\n", formatSize(report.VolumeBytes), report.GenerateTime.Round(time.Millisecond))
+	fmt.Printf("Throughput min/avg/max: %s/s / %s/s / %s/s\n",
+		formatSize(int64(minRate)), formatSize(int64(sumRate/float64(len(report.Iterations)))), formatSize(int64(maxRate)))
+	fmt.Printf("Peak RSS: source %s, destination %s\n", formatSize(int64(srcRSS)), formatSize(int64(destRSS)))
+}
@@ -0,0 +1,70 @@
+// Package startorder arranges containers so that the ones they depend on are
+// created and started first. It is shared by the server, which creates
+// replicas in that order, and the monitor, which starts them at failover.
+package startorder
+
+import "sort"
+
+// Levels groups names into start levels: every name's dependencies are in an
+// earlier level, so a level can start once the ones before it are up.
+// Dependencies on names outside deps are ignored. Names caught in a cycle, or
+// waiting on one, cannot be ordered: they are returned as cyclic and also
+// appended together as the last level.
+func Levels(deps map[string][]string) (levels [][]string, cyclic []string) {
+	waiting := make(map[string]int, len(deps))
+	dependents := make(map[string][]string)
+	for name, ds := range deps {
+		seen := make(map[string]bool)
+		for _, d := range ds {
+			if _, ok := deps[d]; !ok || d == name || seen[d] {
+				continue
+			}
+			seen[d] = true
+			waiting[name]++
+			dependents[d] = append(dependents[d], name)
+		}
+	}
+
+	var ready []string
+	for name := range deps {
+		if waiting[name] == 0 {
+			ready = append(ready, name)
+		}
+	}
+
+	placed := 0
+	for len(ready) > 0 {
+		sort.Strings(ready)
+		levels = append(levels, ready)
+		placed += len(ready)
+		var next []string
+		for _, name := range ready {
+			for _, dep := range dependents[name] {
+				if waiting[dep]--; waiting[dep] == 0 {
+					next = append(next, dep)
+				}
+			}
+		}
+		ready = next
+	}
+
+	if placed < len(deps) {
+		for name := range deps {
+			if waiting[name] > 0 {
+				cyclic = append(cyclic, name)
+			}
+		}
+		sort.Strings(cyclic)
+		levels = append(levels, cyclic)
+	}
+	return levels, cyclic
+}
+
+// Flatten returns the names in levels as a single start order.
+func Flatten(levels [][]string) []string {
+	var order []string
+	for _, level := range levels {
+		order = append(order, level...)
+	}
+	return order
+}
@@ -0,0 +1,104 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// AuditEntry is a single record in the audit log.
+type AuditEntry struct {
+	ID         int64     `json:"id"`
+	CreatedAt  time.Time `json:"createdAt"`
+	Actor      string    `json:"actor"`
+	RemoteAddr string    `json:"remoteAddr"`
+	Action     string    `json:"action"`
+	Target     string    `json:"target"`
+	Outcome    string    `json:"outcome"`
+	Detail     string    `json:"detail"`
+}
+
+// RecordAudit appends an entry to the audit log.
+func (s *SQLStore) RecordAudit(e AuditEntry) error {
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now().UTC()
+	}
+	_, err := s.db.Exec("INSERT INTO audit_log (created_at, actor, remote_addr, action, target, outcome, detail) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		e.CreatedAt.UTC(), e.Actor, e.RemoteAddr, e.Action, e.Target, e.Outcome, e.Detail)
+	if err != nil {
+		return fmt.Errorf("database operation failed: %w", err)
+	}
+	return nil
+}
+
+// AuditFilter selects audit entries. Empty fields match everything; Action
+// matches a whole action or its prefix before ':', so "destination" finds
+// "destination:create" and "destination:delete".
+type AuditFilter struct {
+	Actor   string
+	Action  string
+	Target  string
+	Outcome string
+	Since   time.Time
+	Limit   int
+}
+
+// GetAudit returns the entries matching f, newest first.
+func (s *SQLStore) GetAudit(f AuditFilter) ([]AuditEntry, error) {
+	var conds []string
+	var args []interface{}
+	for _, c := range []struct {
+		column, value string
+	}{
+		{"actor", f.Actor},
+		{"target", f.Target},
+		{"outcome", f.Outcome},
+	} {
+		if c.value != "" {
+			conds = append(conds, c.column+" = ?")
+			args = append(args, c.value)
+		}
+	}
+	if f.Action != "" {
+		conds = append(conds, "(action = ? OR action LIKE ? ESCAPE '\\')")
+		args = append(args, f.Action, escapeLike(f.Action)+":%")
+	}
+	if !f.Since.IsZero() {
+		conds = append(conds, "created_at >= ?")
+		args = append(args, f.Since.UTC())
+	}
+	query := "SELECT id, created_at, actor, remote_addr, action, target, outcome, detail FROM audit_log"
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	query += " ORDER BY id DESC"
+	if f.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, f.Limit)
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var entries []AuditEntry
+	for rows.Next() {
+		var e AuditEntry
+		if err := rows.Scan(&e.ID, &e.CreatedAt, &e.Actor, &e.RemoteAddr, &e.Action, &e.Target, &e.Outcome, &e.Detail); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// PruneAudit deletes the entries recorded before cutoff and returns how many
+// went.
+func (s *SQLStore) PruneAudit(cutoff time.Time) (int64, error) {
+	res, err := s.db.Exec("DELETE FROM audit_log WHERE created_at < ?", cutoff.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("database operation failed: %w", err)
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,50 @@
+package store
+
+import (
+	"fmt"
+)
+
+// BindMount is a container bind mount whose host data is replicated, and the
+// path it is recreated at on the destination ("" keeps the source path).
+type BindMount struct {
+	ContainerID string `json:"containerId"`
+	Source      string `json:"source"`
+	TargetPath  string `json:"targetPath"`
+}
+
+// GetSelectedBindMounts retrieves the selected bind mounts keyed by container ID.
+func (s *SQLStore) GetSelectedBindMounts() (map[string][]BindMount, error) {
+	rows, err := s.db.Query("SELECT container_id, source, target_path FROM selected_bind_mounts")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	selected := make(map[string][]BindMount)
+	for rows.Next() {
+		var m BindMount
+		if err := rows.Scan(&m.ContainerID, &m.Source, &m.TargetPath); err != nil {
+			return nil, err
+		}
+		selected[m.ContainerID] = append(selected[m.ContainerID], m)
+	}
+	return selected, rows.Err()
+}
+
+// SetBindMountSelection selects or deselects a bind mount for data replication.
+func (s *SQLStore) SetBindMountSelection(m BindMount, isSelected bool) error {
+	if m.ContainerID == "" || m.Source == "" {
+		return fmt.Errorf("container ID and source path are required")
+	}
+	var err error
+	if isSelected {
+		_, err = s.db.Exec("INSERT INTO selected_bind_mounts (container_id, source, target_path) VALUES (?, ?, ?) ON CONFLICT(container_id, source) DO UPDATE SET target_path = excluded.target_path",
+			m.ContainerID, m.Source, m.TargetPath)
+	} else {
+		_, err = s.db.Exec("DELETE FROM selected_bind_mounts WHERE container_id = ? AND source = ?", m.ContainerID, m.Source)
+	}
+	if err != nil {
+		return fmt.Errorf("database operation failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// ErrCredentialNotFound is returned when a named registry credential does not exist.
+var ErrCredentialNotFound = errors.New("registry credential not found")
+
+// RegistryCredential holds the login for a container registry.
+type RegistryCredential struct {
+	Name          string `json:"name"`
+	ServerAddress string `json:"serverAddress"`
+	Username      string `json:"username,omitempty"`
+	Password      string `json:"password,omitempty"`
+	IdentityToken string `json:"identityToken,omitempty"`
+}
+
+// GetRegistryCredentials retrieves all stored registry credentials.
+func (s *SQLStore) GetRegistryCredentials() ([]RegistryCredential, error) {
+	rows, err := s.db.Query("SELECT name, server_address, username, password, identity_token FROM registry_credentials ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var creds []RegistryCredential
+	for rows.Next() {
+		var c RegistryCredential
+		if err := rows.Scan(&c.Name, &c.ServerAddress, &c.Username, &c.Password, &c.IdentityToken); err != nil {
+			return nil, err
+		}
+		creds = append(creds, c)
+	}
+	return creds, rows.Err()
+}
+
+// GetRegistryCredential retrieves a registry credential by name.
+func (s *SQLStore) GetRegistryCredential(name string) (*RegistryCredential, error) {
+	var c RegistryCredential
+	err := s.db.QueryRow("SELECT name, server_address, username, password, identity_token FROM registry_credentials WHERE name = ?", name).
+		Scan(&c.Name, &c.ServerAddress, &c.Username, &c.Password, &c.IdentityToken)
+	if err == sql.ErrNoRows {
+		return nil, ErrCredentialNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// GetRegistryCredentialForServer retrieves the credential for a registry host, or nil if none is stored.
+func (s *SQLStore) GetRegistryCredentialForServer(serverAddress string) (*RegistryCredential, error) {
+	var c RegistryCredential
+	err := s.db.QueryRow("SELECT name, server_address, username, password, identity_token FROM registry_credentials WHERE server_address = ? ORDER BY name LIMIT 1", serverAddress).
+		Scan(&c.Name, &c.ServerAddress, &c.Username, &c.Password, &c.IdentityToken)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// SaveRegistryCredential creates or replaces a registry credential.
+func (s *SQLStore) SaveRegistryCredential(c RegistryCredential) error {
+	if c.Name == "" || c.ServerAddress == "" {
+		return fmt.Errorf("registry credential requires a name and server address")
+	}
+	_, err := s.db.Exec(`INSERT INTO registry_credentials (name, server_address, username, password, identity_token) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(name) DO UPDATE SET server_address = excluded.server_address, username = excluded.username,
+			password = excluded.password, identity_token = excluded.identity_token`,
+		c.Name, c.ServerAddress, c.Username, c.Password, c.IdentityToken)
+	if err != nil {
+		return fmt.Errorf("database operation failed: %w", err)
+	}
+	return nil
+}
+
+// DeleteRegistryCredential removes a registry credential.
+func (s *SQLStore) DeleteRegistryCredential(name string) error {
+	if _, err := s.db.Exec("DELETE FROM registry_credentials WHERE name = ?", name); err != nil {
+		return fmt.Errorf("database operation failed: %w", err)
+	}
+	return nil
+}
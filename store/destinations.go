@@ -0,0 +1,200 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrDestinationNotFound is returned when a named destination does not exist.
+	ErrDestinationNotFound = errors.New("destination not found")
+	// ErrDestinationExists is returned when creating a destination whose name or URL is taken.
+	ErrDestinationExists = errors.New("a destination with that name or URL already exists")
+)
+
+// Destination is a DockerApp instance replication can be sent to by name.
+type Destination struct {
+	Name      string `json:"name"`
+	URL       string `json:"url"`
+	AuthToken string `json:"authToken,omitempty"` // bearer token for its destination API, empty for API_TOKEN
+	// TLS settings for an https URL, on top of PEER_CA_FILE and the mTLS client certificate
+	TLSCACert             string    `json:"tlsCaCert,omitempty"` // PEM CA bundle to trust
+	TLSServerName         string    `json:"tlsServerName,omitempty"`
+	TLSInsecureSkipVerify bool      `json:"tlsInsecureSkipVerify"`
+	Enabled               bool      `json:"enabled"`
+	CreatedAt             time.Time `json:"createdAt"`
+	UpdatedAt             time.Time `json:"updatedAt"`
+	// Capabilities the destination reported when it was paired
+	Capabilities DestinationCapabilities `json:"capabilities"`
+	PairedAt     *time.Time              `json:"pairedAt,omitempty"`
+	// When it last answered a replication or pairing, and when a run to it
+	// last finished without failures
+	LastSeenAt   *time.Time `json:"lastSeenAt,omitempty"`
+	LastSyncedAt *time.Time `json:"lastSyncedAt,omitempty"`
+}
+
+// DestinationCapabilities describes a destination's host.
+type DestinationCapabilities struct {
+	Version       string `json:"version"`
+	Architecture  string `json:"architecture"`
+	DiskAvailable int64  `json:"diskAvailable"` // bytes free for Docker's data
+}
+
+const destinationColumns = "name, url, auth_token, tls_ca_cert, tls_server_name, tls_insecure_skip_verify, enabled, created_at, updated_at, version, architecture, disk_available, paired_at"
+
+// destinationSelectColumns adds the activity columns, which only
+// RecordDestinationActivity and pairing write.
+const destinationSelectColumns = destinationColumns + ", last_seen_at, last_synced_at"
+
+func scanDestination(row interface{ Scan(...interface{}) error }) (Destination, error) {
+	var d Destination
+	var pairedAt, lastSeenAt, lastSyncedAt sql.NullTime
+	err := row.Scan(&d.Name, &d.URL, &d.AuthToken, &d.TLSCACert, &d.TLSServerName, &d.TLSInsecureSkipVerify, &d.Enabled, &d.CreatedAt, &d.UpdatedAt,
+		&d.Capabilities.Version, &d.Capabilities.Architecture, &d.Capabilities.DiskAvailable, &pairedAt, &lastSeenAt, &lastSyncedAt)
+	if pairedAt.Valid {
+		d.PairedAt = &pairedAt.Time
+	}
+	if lastSeenAt.Valid {
+		d.LastSeenAt = &lastSeenAt.Time
+	}
+	if lastSyncedAt.Valid {
+		d.LastSyncedAt = &lastSyncedAt.Time
+	}
+	return d, err
+}
+
+// GetDestinations retrieves all destinations, sorted by name.
+func (s *SQLStore) GetDestinations() ([]Destination, error) {
+	rows, err := s.db.Query("SELECT " + destinationSelectColumns + " FROM destinations ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var dests []Destination
+	for rows.Next() {
+		d, err := scanDestination(rows)
+		if err != nil {
+			return nil, err
+		}
+		dests = append(dests, d)
+	}
+	return dests, rows.Err()
+}
+
+// GetDestination retrieves a destination by name.
+func (s *SQLStore) GetDestination(name string) (*Destination, error) {
+	d, err := scanDestination(s.db.QueryRow("SELECT "+destinationSelectColumns+" FROM destinations WHERE name = ?", name))
+	if err == sql.ErrNoRows {
+		return nil, ErrDestinationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// GetDestinationByURL retrieves the destination with url, or nil if none is stored.
+func (s *SQLStore) GetDestinationByURL(url string) (*Destination, error) {
+	d, err := scanDestination(s.db.QueryRow("SELECT "+destinationSelectColumns+" FROM destinations WHERE url = ?", url))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// CreateDestination stores a new destination.
+func (s *SQLStore) CreateDestination(d Destination) error {
+	if d.Name == "" || d.URL == "" {
+		return fmt.Errorf("destination requires a name and URL")
+	}
+	var taken int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM destinations WHERE name = ? OR url = ?", d.Name, d.URL).Scan(&taken); err != nil {
+		return fmt.Errorf("database operation failed: %w", err)
+	}
+	if taken > 0 {
+		return ErrDestinationExists
+	}
+	now := time.Now().UTC()
+	_, err := s.db.Exec("INSERT INTO destinations ("+destinationColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		d.Name, d.URL, d.AuthToken, d.TLSCACert, d.TLSServerName, d.TLSInsecureSkipVerify, d.Enabled, now, now,
+		d.Capabilities.Version, d.Capabilities.Architecture, d.Capabilities.DiskAvailable, d.PairedAt)
+	if err != nil {
+		return fmt.Errorf("database operation failed: %w", err)
+	}
+	return nil
+}
+
+// UpdateDestination replaces the settings of the destination called d.Name.
+func (s *SQLStore) UpdateDestination(d Destination) error {
+	var taken int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM destinations WHERE url = ? AND name != ?", d.URL, d.Name).Scan(&taken); err != nil {
+		return fmt.Errorf("database operation failed: %w", err)
+	}
+	if taken > 0 {
+		return ErrDestinationExists
+	}
+	res, err := s.db.Exec("UPDATE destinations SET url = ?, auth_token = ?, tls_ca_cert = ?, tls_server_name = ?, tls_insecure_skip_verify = ?, enabled = ?, updated_at = ? WHERE name = ?",
+		d.URL, d.AuthToken, d.TLSCACert, d.TLSServerName, d.TLSInsecureSkipVerify, d.Enabled, time.Now().UTC(), d.Name)
+	if err != nil {
+		return fmt.Errorf("database operation failed: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrDestinationNotFound
+	}
+	return nil
+}
+
+// DeleteDestination removes a destination.
+func (s *SQLStore) DeleteDestination(name string) error {
+	res, err := s.db.Exec("DELETE FROM destinations WHERE name = ?", name)
+	if err != nil {
+		return fmt.Errorf("database operation failed: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrDestinationNotFound
+	}
+	return nil
+}
+
+// PairDestination stores a destination that was just paired, with the token
+// and capabilities it returned. Pairing again under the same name replaces
+// the URL, token, TLS settings, enabled flag and capabilities.
+func (s *SQLStore) PairDestination(d Destination) error {
+	var taken int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM destinations WHERE url = ? AND name != ?", d.URL, d.Name).Scan(&taken); err != nil {
+		return fmt.Errorf("database operation failed: %w", err)
+	}
+	if taken > 0 {
+		return ErrDestinationExists
+	}
+	now := time.Now().UTC()
+	_, err := s.db.Exec(`INSERT INTO destinations (`+destinationColumns+`, last_seen_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(name) DO UPDATE SET url = excluded.url, auth_token = excluded.auth_token, tls_ca_cert = excluded.tls_ca_cert,
+			tls_server_name = excluded.tls_server_name, tls_insecure_skip_verify = excluded.tls_insecure_skip_verify, enabled = excluded.enabled,
+			updated_at = excluded.updated_at, version = excluded.version, architecture = excluded.architecture,
+			disk_available = excluded.disk_available, paired_at = excluded.paired_at, last_seen_at = excluded.last_seen_at`,
+		d.Name, d.URL, d.AuthToken, d.TLSCACert, d.TLSServerName, d.TLSInsecureSkipVerify, d.Enabled, now, now,
+		d.Capabilities.Version, d.Capabilities.Architecture, d.Capabilities.DiskAvailable, now, now)
+	if err != nil {
+		return fmt.Errorf("database operation failed: %w", err)
+	}
+	return nil
+}
+
+// RecordDestinationActivity notes that the destination at url answered at
+// at and, when synced is set, that a run to it finished without failures.
+// URLs that are not stored, as typed into a single run, are ignored.
+func (s *SQLStore) RecordDestinationActivity(url string, at time.Time, synced bool) error {
+	_, err := s.db.Exec("UPDATE destinations SET last_seen_at = ?, last_synced_at = CASE WHEN ? THEN ? ELSE last_synced_at END WHERE url = ?",
+		at.UTC(), synced, at.UTC(), url)
+	if err != nil {
+		return fmt.Errorf("database operation failed: %w", err)
+	}
+	return nil
+}
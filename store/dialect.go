@@ -0,0 +1,112 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+)
+
+// sqlDB runs the store's queries on SQLite or PostgreSQL. Queries are
+// written once, with ? placeholders and SQL both accept, and numbered as
+// PostgreSQL expects when it is the database.
+type sqlDB struct {
+	*sql.DB
+	postgres bool
+}
+
+func (db *sqlDB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return db.DB.Exec(db.rebind(query), args...)
+}
+
+func (db *sqlDB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return db.DB.Query(db.rebind(query), args...)
+}
+
+func (db *sqlDB) QueryRow(query string, args ...interface{}) *sql.Row {
+	return db.DB.QueryRow(db.rebind(query), args...)
+}
+
+func (db *sqlDB) Begin() (*sqlTx, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &sqlTx{Tx: tx, db: db}, nil
+}
+
+// sqlTx is a transaction on a sqlDB.
+type sqlTx struct {
+	*sql.Tx
+	db *sqlDB
+}
+
+func (tx *sqlTx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return tx.Tx.Exec(tx.db.rebind(query), args...)
+}
+
+func (tx *sqlTx) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return tx.Tx.Query(tx.db.rebind(query), args...)
+}
+
+func (tx *sqlTx) QueryRow(query string, args ...interface{}) *sql.Row {
+	return tx.Tx.QueryRow(tx.db.rebind(query), args...)
+}
+
+// rebind numbers the ? placeholders in query as $1, $2 and so on for
+// PostgreSQL. Question marks inside quoted strings are left alone.
+func (db *sqlDB) rebind(query string) string {
+	if !db.postgres || !strings.Contains(query, "?") {
+		return query
+	}
+	var b strings.Builder
+	n, quoted := 0, false
+	for _, r := range query {
+		switch {
+		case r == '\'':
+			quoted = !quoted
+		case r == '?' && !quoted:
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// skipLocked is the clause that keeps servers sharing a PostgreSQL database
+// from picking the same row in a SELECT ... LIMIT 1 subquery at once. SQLite
+// writes one statement at a time and needs none.
+func (db *sqlDB) skipLocked() string {
+	if db.postgres {
+		return " FOR UPDATE SKIP LOCKED"
+	}
+	return ""
+}
+
+// migrationLockID is the PostgreSQL advisory lock servers take while they
+// migrate a shared database. Any key works as long as it is always the same.
+const migrationLockID = 0x646f636b6572
+
+// lockMigrations keeps servers sharing a PostgreSQL database from migrating
+// it at the same time: the ones that start later wait, then find it
+// migrated. It returns the function that releases the lock.
+func (db *sqlDB) lockMigrations() (func(), error) {
+	if !db.postgres {
+		return func() {}, nil
+	}
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockID); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return func() {
+		conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", migrationLockID)
+		conn.Close()
+	}, nil
+}
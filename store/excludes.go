@@ -0,0 +1,57 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+)
+
+// GetVolumeExcludes retrieves the exclude patterns of every volume, keyed by volume name.
+func (s *SQLStore) GetVolumeExcludes() (map[string][]string, error) {
+	rows, err := s.db.Query("SELECT volume_name, pattern FROM volume_excludes ORDER BY volume_name, position")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	excludes := make(map[string][]string)
+	for rows.Next() {
+		var name, pattern string
+		if err := rows.Scan(&name, &pattern); err != nil {
+			return nil, err
+		}
+		excludes[name] = append(excludes[name], pattern)
+	}
+	return excludes, rows.Err()
+}
+
+// SetVolumeExcludes replaces the exclude patterns for a volume. Blank
+// patterns are dropped; an empty list clears them.
+func (s *SQLStore) SetVolumeExcludes(volumeName string, patterns []string) error {
+	if volumeName == "" {
+		return fmt.Errorf("volume name is required")
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("database operation failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM volume_excludes WHERE volume_name = ?", volumeName); err != nil {
+		return fmt.Errorf("database operation failed: %w", err)
+	}
+	position := 0
+	for _, p := range patterns {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if _, err := tx.Exec("INSERT INTO volume_excludes (volume_name, pattern, position) VALUES (?, ?, ?) ON CONFLICT DO NOTHING", volumeName, p, position); err != nil {
+			return fmt.Errorf("database operation failed: %w", err)
+		}
+		position++
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("database operation failed: %w", err)
+	}
+	return nil
+}
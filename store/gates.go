@@ -0,0 +1,145 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Confirmation modes for a gated operation.
+const (
+	GateModeNone     = "none"
+	GateModePhrase   = "phrase"
+	GateModeApproval = "approval"
+)
+
+// ErrApprovalNotFound is returned when an approval ID does not exist.
+var ErrApprovalNotFound = errors.New("approval not found")
+
+// ConfirmationGate describes the confirmation required before an operation runs.
+type ConfirmationGate struct {
+	Operation string `json:"operation"`
+	Mode      string `json:"mode"`
+	Phrase    string `json:"phrase,omitempty"`
+}
+
+// Approval is a four-eyes approval request for a gated operation.
+type Approval struct {
+	ID          int64      `json:"id"`
+	Operation   string     `json:"operation"`
+	RequestedBy string     `json:"requestedBy"`
+	ApprovedBy  string     `json:"approvedBy,omitempty"`
+	RequestedAt time.Time  `json:"requestedAt"`
+	ApprovedAt  *time.Time `json:"approvedAt,omitempty"`
+	Consumed    bool       `json:"consumed"`
+}
+
+// GetConfirmationGates retrieves all configured gates keyed by operation.
+func (s *SQLStore) GetConfirmationGates() (map[string]ConfirmationGate, error) {
+	rows, err := s.db.Query("SELECT operation, mode, phrase FROM confirmation_gates")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	gates := make(map[string]ConfirmationGate)
+	for rows.Next() {
+		var g ConfirmationGate
+		if err := rows.Scan(&g.Operation, &g.Mode, &g.Phrase); err != nil {
+			return nil, err
+		}
+		gates[g.Operation] = g
+	}
+	return gates, rows.Err()
+}
+
+// GetConfirmationGate retrieves the gate for an operation, defaulting to no confirmation.
+func (s *SQLStore) GetConfirmationGate(operation string) (ConfirmationGate, error) {
+	g := ConfirmationGate{Operation: operation, Mode: GateModeNone}
+	err := s.db.QueryRow("SELECT mode, phrase FROM confirmation_gates WHERE operation = ?", operation).Scan(&g.Mode, &g.Phrase)
+	if err != nil && err != sql.ErrNoRows {
+		return g, err
+	}
+	return g, nil
+}
+
+// SetConfirmationGate creates or replaces the gate for an operation.
+func (s *SQLStore) SetConfirmationGate(g ConfirmationGate) error {
+	switch g.Mode {
+	case GateModeNone, GateModePhrase, GateModeApproval:
+	default:
+		return fmt.Errorf("invalid gate mode: %s", g.Mode)
+	}
+
+	_, err := s.db.Exec("INSERT INTO confirmation_gates (operation, mode, phrase) VALUES (?, ?, ?) ON CONFLICT(operation) DO UPDATE SET mode = excluded.mode, phrase = excluded.phrase", g.Operation, g.Mode, g.Phrase)
+	if err != nil {
+		return fmt.Errorf("database operation failed: %w", err)
+	}
+	return nil
+}
+
+// CreateApproval records a pending approval request and returns its ID.
+func (s *SQLStore) CreateApproval(operation, requestedBy string) (int64, error) {
+	var id int64
+	err := s.db.QueryRow("INSERT INTO approvals (operation, requested_by, requested_at) VALUES (?, ?, ?) RETURNING id", operation, requestedBy, time.Now().UTC()).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("database operation failed: %w", err)
+	}
+	return id, nil
+}
+
+// GetApproval retrieves an approval by ID.
+func (s *SQLStore) GetApproval(id int64) (*Approval, error) {
+	var a Approval
+	var approvedAt sql.NullTime
+	err := s.db.QueryRow("SELECT id, operation, requested_by, approved_by, requested_at, approved_at, consumed FROM approvals WHERE id = ?", id).
+		Scan(&a.ID, &a.Operation, &a.RequestedBy, &a.ApprovedBy, &a.RequestedAt, &approvedAt, &a.Consumed)
+	if err == sql.ErrNoRows {
+		return nil, ErrApprovalNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if approvedAt.Valid {
+		a.ApprovedAt = &approvedAt.Time
+	}
+	return &a, nil
+}
+
+// ApproveApproval records a second user's approval. The approver must differ from the requester.
+func (s *SQLStore) ApproveApproval(id int64, approvedBy string) error {
+	a, err := s.GetApproval(id)
+	if err != nil {
+		return err
+	}
+	if approvedBy == "" || approvedBy == a.RequestedBy {
+		return fmt.Errorf("approval %d must be approved by a different user than %q", id, a.RequestedBy)
+	}
+	if a.ApprovedAt != nil {
+		return fmt.Errorf("approval %d has already been approved by %s", id, a.ApprovedBy)
+	}
+
+	_, err = s.db.Exec("UPDATE approvals SET approved_by = ?, approved_at = ? WHERE id = ?", approvedBy, time.Now().UTC(), id)
+	if err != nil {
+		return fmt.Errorf("database operation failed: %w", err)
+	}
+	return nil
+}
+
+// ConsumeApproval marks an approved request as used so it cannot authorize a
+// second run. Only the user who requested it can use it.
+func (s *SQLStore) ConsumeApproval(id int64, operation, requestedBy string) error {
+	res, err := s.db.Exec("UPDATE approvals SET consumed = 1 WHERE id = ? AND operation = ? AND requested_by = ? AND approved_at IS NOT NULL AND consumed = 0", id, operation, requestedBy)
+	if err != nil {
+		return fmt.Errorf("database operation failed: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("approval %d is not an unused, approved request for %s by %s", id, operation, requestedBy)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package store
+
+import (
+	"strings"
+	"time"
+)
+
+// HistoryEntry is the outcome of one item on one destination in one run,
+// with the run it was part of.
+type HistoryEntry struct {
+	ID          int64     `json:"id"`
+	JobID       string    `json:"jobId"`
+	Direction   string    `json:"direction,omitempty"` // "failback" for reverse runs
+	Destination string    `json:"destination"`
+	Type        string    `json:"type"` // network, volume or container
+	Name        string    `json:"name"`
+	Status      string    `json:"status"`
+	Error       string    `json:"error,omitempty"`
+	Bytes       int64     `json:"bytes"`
+	DurationMs  int64     `json:"durationMs"`
+	StartedAt   time.Time `json:"startedAt"`  // when the run started
+	FinishedAt  time.Time `json:"finishedAt"` // when the run finished
+}
+
+// HistoryFilter narrows GetHistory. Empty fields match everything.
+type HistoryFilter struct {
+	JobID       string
+	Destination string
+	Type        string
+	Name        string
+	Status      string
+	Since       time.Time
+	Limit       int
+}
+
+// historyColumns and historyTables read each run item together with its run.
+const (
+	historyColumns = "i.id, i.job_id, r.direction, i.destination, i.item_type, i.item_name, i.status, i.error, i.bytes, i.duration_ms, r.started_at, r.finished_at"
+	historyTables  = " FROM replication_run_items i JOIN replication_runs r ON r.job_id = i.job_id"
+)
+
+// GetHistory lists recorded items matching f, newest first.
+func (s *SQLStore) GetHistory(f HistoryFilter) ([]HistoryEntry, error) {
+	where, args := f.where()
+	query := "SELECT " + historyColumns + historyTables + where + " ORDER BY i.id DESC"
+	if f.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, f.Limit)
+	}
+	return s.queryHistory(query, args...)
+}
+
+// GetLastSuccesses returns, for every item and destination matching f, the
+// most recent run in which it replicated. f.Status and f.Limit are ignored.
+func (s *SQLStore) GetLastSuccesses(f HistoryFilter) ([]HistoryEntry, error) {
+	f.Status = "replicated"
+	where, args := f.where()
+	query := "SELECT " + historyColumns + historyTables + " WHERE i.id IN (SELECT MAX(i.id)" + historyTables + where +
+		" GROUP BY i.destination, i.item_type, i.item_name) ORDER BY i.item_type, i.item_name, i.destination"
+	return s.queryHistory(query, args...)
+}
+
+func (f HistoryFilter) where() (string, []interface{}) {
+	var conds []string
+	var args []interface{}
+	for _, c := range []struct {
+		column, value string
+	}{
+		{"i.job_id", f.JobID},
+		{"i.destination", f.Destination},
+		{"i.item_type", f.Type},
+		{"i.item_name", f.Name},
+		{"i.status", f.Status},
+	} {
+		if c.value != "" {
+			conds = append(conds, c.column+" = ?")
+			args = append(args, c.value)
+		}
+	}
+	if !f.Since.IsZero() {
+		conds = append(conds, "r.finished_at >= ?")
+		args = append(args, f.Since.UTC())
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+func (s *SQLStore) queryHistory(query string, args ...interface{}) ([]HistoryEntry, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []HistoryEntry
+	for rows.Next() {
+		var e HistoryEntry
+		if err := rows.Scan(&e.ID, &e.JobID, &e.Direction, &e.Destination, &e.Type, &e.Name, &e.Status, &e.Error, &e.Bytes, &e.DurationMs, &e.StartedAt, &e.FinishedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,60 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ReplicationHooks are commands run inside a source container around the
+// copy of its volumes, e.g. a database dump before and cleanup after.
+type ReplicationHooks struct {
+	ContainerID    string `json:"containerId"`
+	Pre            string `json:"pre"`
+	Post           string `json:"post"`
+	TimeoutSeconds int    `json:"timeoutSeconds"` // 0 uses the server default
+}
+
+// GetReplicationHooks retrieves the hooks of every container that has any, keyed by container ID.
+func (s *SQLStore) GetReplicationHooks() (map[string]ReplicationHooks, error) {
+	rows, err := s.db.Query("SELECT container_id, pre_command, post_command, timeout_seconds FROM replication_hooks")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hooks := make(map[string]ReplicationHooks)
+	for rows.Next() {
+		var h ReplicationHooks
+		if err := rows.Scan(&h.ContainerID, &h.Pre, &h.Post, &h.TimeoutSeconds); err != nil {
+			return nil, err
+		}
+		hooks[h.ContainerID] = h
+	}
+	return hooks, rows.Err()
+}
+
+// SetReplicationHooks creates or replaces a container's hooks. Hooks with
+// neither command are removed.
+func (s *SQLStore) SetReplicationHooks(h ReplicationHooks) error {
+	if h.ContainerID == "" {
+		return fmt.Errorf("container ID is required")
+	}
+	if h.TimeoutSeconds < 0 {
+		return fmt.Errorf("timeout cannot be negative")
+	}
+	h.Pre = strings.TrimSpace(h.Pre)
+	h.Post = strings.TrimSpace(h.Post)
+
+	var err error
+	if h.Pre == "" && h.Post == "" {
+		_, err = s.db.Exec("DELETE FROM replication_hooks WHERE container_id = ?", h.ContainerID)
+	} else {
+		_, err = s.db.Exec(`INSERT INTO replication_hooks (container_id, pre_command, post_command, timeout_seconds) VALUES (?, ?, ?, ?)
+			ON CONFLICT(container_id) DO UPDATE SET pre_command = excluded.pre_command, post_command = excluded.post_command, timeout_seconds = excluded.timeout_seconds`,
+			h.ContainerID, h.Pre, h.Post, h.TimeoutSeconds)
+	}
+	if err != nil {
+		return fmt.Errorf("database operation failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrHostNotFound is returned when a named Docker host does not exist.
+	ErrHostNotFound = errors.New("docker host not found")
+	// ErrHostExists is returned when creating a Docker host whose name or address is taken.
+	ErrHostExists = errors.New("a docker host with that name or address already exists")
+)
+
+// Host is a Docker daemon, other than the local one, whose containers can be
+// listed, selected and replicated.
+type Host struct {
+	Name    string `json:"name"`
+	Address string `json:"address"` // tcp://host:2376 or unix:///path/to/docker.sock
+	// TLS settings for a tcp address, as in DOCKER_CERT_PATH: the CA that
+	// signed the daemon's certificate and a client certificate and key
+	TLSCACert             string    `json:"tlsCaCert,omitempty"`
+	TLSCert               string    `json:"tlsCert,omitempty"`
+	TLSKey                string    `json:"tlsKey,omitempty"`
+	TLSInsecureSkipVerify bool      `json:"tlsInsecureSkipVerify"`
+	CreatedAt             time.Time `json:"createdAt"`
+	UpdatedAt             time.Time `json:"updatedAt"`
+}
+
+// UsesTLS reports whether the host is reached over TLS.
+func (h Host) UsesTLS() bool {
+	return h.TLSCACert != "" || h.TLSCert != "" || h.TLSInsecureSkipVerify
+}
+
+const hostColumns = "name, address, tls_ca_cert, tls_cert, tls_key, tls_insecure_skip_verify, created_at, updated_at"
+
+func scanHost(row interface{ Scan(...interface{}) error }) (Host, error) {
+	var h Host
+	err := row.Scan(&h.Name, &h.Address, &h.TLSCACert, &h.TLSCert, &h.TLSKey, &h.TLSInsecureSkipVerify, &h.CreatedAt, &h.UpdatedAt)
+	return h, err
+}
+
+// GetHosts retrieves all Docker hosts, sorted by name.
+func (s *SQLStore) GetHosts() ([]Host, error) {
+	rows, err := s.db.Query("SELECT " + hostColumns + " FROM docker_hosts ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hosts []Host
+	for rows.Next() {
+		h, err := scanHost(rows)
+		if err != nil {
+			return nil, err
+		}
+		hosts = append(hosts, h)
+	}
+	return hosts, rows.Err()
+}
+
+// GetHost retrieves a Docker host by name.
+func (s *SQLStore) GetHost(name string) (*Host, error) {
+	h, err := scanHost(s.db.QueryRow("SELECT "+hostColumns+" FROM docker_hosts WHERE name = ?", name))
+	if err == sql.ErrNoRows {
+		return nil, ErrHostNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+// CreateHost stores a new Docker host.
+func (s *SQLStore) CreateHost(h Host) error {
+	if h.Name == "" || h.Address == "" {
+		return fmt.Errorf("docker host requires a name and address")
+	}
+	var taken int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM docker_hosts WHERE name = ? OR address = ?", h.Name, h.Address).Scan(&taken); err != nil {
+		return fmt.Errorf("database operation failed: %w", err)
+	}
+	if taken > 0 {
+		return ErrHostExists
+	}
+	now := time.Now().UTC()
+	_, err := s.db.Exec("INSERT INTO docker_hosts ("+hostColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		h.Name, h.Address, h.TLSCACert, h.TLSCert, h.TLSKey, h.TLSInsecureSkipVerify, now, now)
+	if err != nil {
+		return fmt.Errorf("database operation failed: %w", err)
+	}
+	return nil
+}
+
+// UpdateHost replaces the settings of the Docker host called h.Name.
+func (s *SQLStore) UpdateHost(h Host) error {
+	var taken int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM docker_hosts WHERE address = ? AND name != ?", h.Address, h.Name).Scan(&taken); err != nil {
+		return fmt.Errorf("database operation failed: %w", err)
+	}
+	if taken > 0 {
+		return ErrHostExists
+	}
+	res, err := s.db.Exec("UPDATE docker_hosts SET address = ?, tls_ca_cert = ?, tls_cert = ?, tls_key = ?, tls_insecure_skip_verify = ?, updated_at = ? WHERE name = ?",
+		h.Address, h.TLSCACert, h.TLSCert, h.TLSKey, h.TLSInsecureSkipVerify, time.Now().UTC(), h.Name)
+	if err != nil {
+		return fmt.Errorf("database operation failed: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrHostNotFound
+	}
+	return nil
+}
+
+// DeleteHost removes a Docker host.
+func (s *SQLStore) DeleteHost(name string) error {
+	res, err := s.db.Exec("DELETE FROM docker_hosts WHERE name = ?", name)
+	if err != nil {
+		return fmt.Errorf("database operation failed: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrHostNotFound
+	}
+	return nil
+}
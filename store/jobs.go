@@ -0,0 +1,217 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// States of a queued job.
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+var (
+	// ErrJobNotFound is returned when no job exists with an ID.
+	ErrJobNotFound = errors.New("job not found")
+	// ErrJobExists is returned when enqueueing a job under an ID already in use.
+	ErrJobExists = errors.New("a job with that ID already exists")
+	// ErrJobLost is returned when a worker reports on a job it no longer
+	// holds, because it finished or another worker reclaimed it.
+	ErrJobLost = errors.New("job is not running on this worker")
+)
+
+// Job is a unit of work in the persistent queue, such as a replication to
+// run. Jobs outlive the process that enqueued them: a job whose worker stops
+// heartbeating is claimed again by the next worker.
+type Job struct {
+	ID          string     `json:"id"`
+	Type        string     `json:"type"`
+	Payload     string     `json:"payload"` // as the job type defines, usually JSON
+	State       string     `json:"state"`
+	Attempts    int        `json:"attempts"`
+	MaxAttempts int        `json:"maxAttempts"`
+	LastError   string     `json:"lastError,omitempty"`
+	Worker      string     `json:"worker,omitempty"` // that claimed it last
+	CreatedAt   time.Time  `json:"createdAt"`
+	UpdatedAt   time.Time  `json:"updatedAt"`
+	RunAfter    time.Time  `json:"runAfter"` // not claimed before this
+	HeartbeatAt *time.Time `json:"heartbeatAt,omitempty"`
+	FinishedAt  *time.Time `json:"finishedAt,omitempty"`
+}
+
+const jobColumns = "id, type, payload, state, attempts, max_attempts, last_error, worker, created_at, updated_at, run_after, heartbeat_at, finished_at"
+
+func scanJob(row interface{ Scan(...interface{}) error }) (Job, error) {
+	var j Job
+	var heartbeatAt, finishedAt sql.NullTime
+	err := row.Scan(&j.ID, &j.Type, &j.Payload, &j.State, &j.Attempts, &j.MaxAttempts, &j.LastError, &j.Worker,
+		&j.CreatedAt, &j.UpdatedAt, &j.RunAfter, &heartbeatAt, &finishedAt)
+	if heartbeatAt.Valid {
+		j.HeartbeatAt = &heartbeatAt.Time
+	}
+	if finishedAt.Valid {
+		j.FinishedAt = &finishedAt.Time
+	}
+	return j, err
+}
+
+// EnqueueJob queues j.Type with j.Payload under j.ID. It may be claimed
+// from j.RunAfter on, or at once when that is zero, and is tried up to
+// j.MaxAttempts times, at least once.
+func (s *SQLStore) EnqueueJob(j Job) error {
+	if j.ID == "" || j.Type == "" {
+		return fmt.Errorf("job requires an ID and type")
+	}
+	now := time.Now().UTC()
+	if j.RunAfter.IsZero() {
+		j.RunAfter = now
+	}
+	res, err := s.db.Exec("INSERT INTO jobs (id, type, payload, state, max_attempts, created_at, updated_at, run_after) VALUES (?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT(id) DO NOTHING",
+		j.ID, j.Type, j.Payload, JobQueued, max(j.MaxAttempts, 1), now, now, j.RunAfter.UTC())
+	if err != nil {
+		return fmt.Errorf("database operation failed: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrJobExists
+	}
+	return nil
+}
+
+// ClaimJob hands worker the queued job that is due longest, or nil when none
+// is. A running job whose heartbeat is older than staleAfter counts as
+// queued, as its worker is presumed gone; one that has no attempts left is
+// failed instead. Each claim is an attempt.
+func (s *SQLStore) ClaimJob(worker string, staleAfter time.Duration) (*Job, error) {
+	now := time.Now().UTC()
+	cutoff := now.Add(-staleAfter)
+	_, err := s.db.Exec("UPDATE jobs SET state = ?, last_error = ?, updated_at = ?, finished_at = ? WHERE state = ? AND heartbeat_at < ? AND attempts >= max_attempts",
+		JobFailed, "worker stopped responding", now, now, JobRunning, cutoff)
+	if err != nil {
+		return nil, fmt.Errorf("database operation failed: %w", err)
+	}
+
+	// One statement, so two workers cannot claim the same job
+	j, err := scanJob(s.db.QueryRow(`UPDATE jobs SET state = ?, worker = ?, attempts = attempts + 1, heartbeat_at = ?, updated_at = ?
+		WHERE id = (SELECT id FROM jobs WHERE (state = ? AND run_after <= ?) OR (state = ? AND heartbeat_at < ?) ORDER BY run_after, created_at LIMIT 1`+s.db.skipLocked()+`)
+		RETURNING `+jobColumns,
+		JobRunning, worker, now, now, JobQueued, now, JobRunning, cutoff))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("database operation failed: %w", err)
+	}
+	return &j, nil
+}
+
+// HeartbeatJob tells the queue that worker is still running job id.
+func (s *SQLStore) HeartbeatJob(id, worker string) error {
+	now := time.Now().UTC()
+	return s.updateRunningJob(id, "UPDATE jobs SET heartbeat_at = ?, updated_at = ? WHERE id = ? AND state = ? AND worker = ?",
+		now, now, id, JobRunning, worker)
+}
+
+// CompleteJob marks job id, run by worker, as succeeded.
+func (s *SQLStore) CompleteJob(id, worker string) error {
+	now := time.Now().UTC()
+	return s.updateRunningJob(id, "UPDATE jobs SET state = ?, last_error = '', updated_at = ?, finished_at = ? WHERE id = ? AND state = ? AND worker = ?",
+		JobSucceeded, now, now, id, JobRunning, worker)
+}
+
+// FailJob records why job id, run by worker, failed. It is queued again to
+// run from retryAt if it has attempts left, and failed for good otherwise.
+// The state it is left in is returned.
+func (s *SQLStore) FailJob(id, worker, reason string, retryAt time.Time) (string, error) {
+	now := time.Now().UTC()
+	var state string
+	err := s.db.QueryRow(`UPDATE jobs SET last_error = ?, updated_at = ?,
+			state = CASE WHEN attempts < max_attempts THEN ? ELSE ? END,
+			run_after = CASE WHEN attempts < max_attempts THEN ? ELSE run_after END,
+			finished_at = CASE WHEN attempts < max_attempts THEN finished_at ELSE ? END
+		WHERE id = ? AND state = ? AND worker = ? RETURNING state`,
+		reason, now, JobQueued, JobFailed, retryAt.UTC(), now, id, JobRunning, worker).Scan(&state)
+	if err == sql.ErrNoRows {
+		return "", s.jobLost(id)
+	}
+	if err != nil {
+		return "", fmt.Errorf("database operation failed: %w", err)
+	}
+	return state, nil
+}
+
+func (s *SQLStore) updateRunningJob(id, query string, args ...interface{}) error {
+	res, err := s.db.Exec(query, args...)
+	if err != nil {
+		return fmt.Errorf("database operation failed: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return s.jobLost(id)
+	}
+	return nil
+}
+
+// jobLost tells a job that does not exist from one the worker lost.
+func (s *SQLStore) jobLost(id string) error {
+	if _, err := s.GetJob(id); err != nil {
+		return err
+	}
+	return ErrJobLost
+}
+
+// GetJob retrieves a job by ID.
+func (s *SQLStore) GetJob(id string) (*Job, error) {
+	j, err := scanJob(s.db.QueryRow("SELECT "+jobColumns+" FROM jobs WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &j, nil
+}
+
+// GetJobs lists jobs in state, or in any state when it is empty, newest
+// first, up to limit when it is positive.
+func (s *SQLStore) GetJobs(state string, limit int) ([]Job, error) {
+	query := "SELECT " + jobColumns + " FROM jobs"
+	var args []interface{}
+	if state != "" {
+		query += " WHERE state = ?"
+		args = append(args, state)
+	}
+	query += " ORDER BY created_at DESC"
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit)
+	}
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []Job
+	for rows.Next() {
+		j, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, rows.Err()
+}
+
+// PruneJobs deletes jobs that finished before cutoff and returns how many
+// went.
+func (s *SQLStore) PruneJobs(cutoff time.Time) (int64, error) {
+	res, err := s.db.Exec("DELETE FROM jobs WHERE state IN (?, ?) AND finished_at < ?", JobSucceeded, JobFailed, cutoff.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("database operation failed: %w", err)
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,158 @@
+package store
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTestStore(t *testing.T) *SQLStore {
+	t.Helper()
+	st, err := NewMemoryStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(st.Close)
+	return st.(*SQLStore)
+}
+
+// claim claims the next job as worker and returns its ID, or "" when none is due.
+func claim(t *testing.T, s *SQLStore, worker string, staleAfter time.Duration) string {
+	t.Helper()
+	j, err := s.ClaimJob(worker, staleAfter)
+	if err != nil {
+		t.Fatalf("ClaimJob(%s): %v", worker, err)
+	}
+	if j == nil {
+		return ""
+	}
+	if j.State != JobRunning || j.Worker != worker {
+		t.Errorf("claimed job %s is %s by %q, want running by %s", j.ID, j.State, j.Worker, worker)
+	}
+	return j.ID
+}
+
+func TestClaimJobTakesTheJobDueLongest(t *testing.T) {
+	s := newTestStore(t)
+	now := time.Now()
+	for _, j := range []Job{
+		{ID: "later", Type: "replicate", RunAfter: now.Add(-time.Minute)},
+		{ID: "future", Type: "replicate", RunAfter: now.Add(time.Hour)},
+		{ID: "first", Type: "replicate", RunAfter: now.Add(-2 * time.Minute)},
+	} {
+		if err := s.EnqueueJob(j); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.EnqueueJob(Job{ID: "first", Type: "replicate"}); !errors.Is(err, ErrJobExists) {
+		t.Errorf("enqueueing first again: %v, want ErrJobExists", err)
+	}
+
+	for _, want := range []string{"first", "later", ""} {
+		if got := claim(t, s, "w1", time.Hour); got != want {
+			t.Errorf("claimed %q, want %q", got, want)
+		}
+	}
+}
+
+func TestClaimJobReclaimsAStaleClaim(t *testing.T) {
+	s := newTestStore(t)
+	if err := s.EnqueueJob(Job{ID: "j1", Type: "replicate", MaxAttempts: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if got := claim(t, s, "w1", time.Hour); got != "j1" {
+		t.Fatalf("claimed %q, want j1", got)
+	}
+	if got := claim(t, s, "w2", time.Hour); got != "" {
+		t.Errorf("w2 claimed %s while w1 heartbeats within the hour", got)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	if got := claim(t, s, "w2", time.Millisecond); got != "j1" {
+		t.Fatalf("w2 claimed %q, want j1 once w1 went quiet", got)
+	}
+	if j, _ := s.GetJob("j1"); j.Attempts != 2 {
+		t.Errorf("attempts = %d, want 2 after the reclaim", j.Attempts)
+	}
+
+	// Both attempts are used, so a second stale claim fails the job
+	time.Sleep(10 * time.Millisecond)
+	if got := claim(t, s, "w3", time.Millisecond); got != "" {
+		t.Errorf("w3 claimed %s, which has no attempts left", got)
+	}
+	j, err := s.GetJob("j1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j.State != JobFailed || j.FinishedAt == nil || j.LastError == "" {
+		t.Errorf("job is %s (finished %v, %q), want failed with a reason", j.State, j.FinishedAt, j.LastError)
+	}
+}
+
+func TestFailJobSchedulesARetry(t *testing.T) {
+	s := newTestStore(t)
+	if err := s.EnqueueJob(Job{ID: "j1", Type: "replicate", MaxAttempts: 2}); err != nil {
+		t.Fatal(err)
+	}
+	claim(t, s, "w1", time.Hour)
+
+	retryAt := time.Now().Add(time.Hour)
+	state, err := s.FailJob("j1", "w1", "destination unreachable", retryAt)
+	if err != nil || state != JobQueued {
+		t.Fatalf("FailJob = %q, %v, want queued for a retry", state, err)
+	}
+	j, _ := s.GetJob("j1")
+	if !j.RunAfter.Equal(retryAt.UTC()) || j.LastError != "destination unreachable" {
+		t.Errorf("job runs after %s with error %q, want %s and the reason", j.RunAfter, j.LastError, retryAt.UTC())
+	}
+	if got := claim(t, s, "w1", time.Hour); got != "" {
+		t.Errorf("claimed %s before its retry was due", got)
+	}
+
+	if _, err := s.db.Exec("UPDATE jobs SET run_after = ? WHERE id = ?", time.Now().UTC().Add(-time.Second), "j1"); err != nil {
+		t.Fatal(err)
+	}
+	if got := claim(t, s, "w2", time.Hour); got != "j1" {
+		t.Fatalf("claimed %q, want the retry of j1", got)
+	}
+	if state, err := s.FailJob("j1", "w2", "still unreachable", time.Now()); err != nil || state != JobFailed {
+		t.Errorf("FailJob on the last attempt = %q, %v, want failed", state, err)
+	}
+	if j, _ := s.GetJob("j1"); j.FinishedAt == nil {
+		t.Error("a job failed for good has no finish time")
+	}
+}
+
+func TestRunningJobUpdatesNeedTheClaimingWorker(t *testing.T) {
+	s := newTestStore(t)
+	if err := s.EnqueueJob(Job{ID: "j1", Type: "replicate"}); err != nil {
+		t.Fatal(err)
+	}
+	claim(t, s, "w1", time.Hour)
+
+	tests := []struct {
+		name string
+		call func() error
+		want error
+	}{
+		{"heartbeat by another worker", func() error { return s.HeartbeatJob("j1", "w2") }, ErrJobLost},
+		{"complete by another worker", func() error { return s.CompleteJob("j1", "w2") }, ErrJobLost},
+		{"fail by another worker", func() error { _, err := s.FailJob("j1", "w2", "x", time.Now()); return err }, ErrJobLost},
+		{"heartbeat of a missing job", func() error { return s.HeartbeatJob("j2", "w1") }, ErrJobNotFound},
+		{"heartbeat", func() error { return s.HeartbeatJob("j1", "w1") }, nil},
+		{"complete", func() error { return s.CompleteJob("j1", "w1") }, nil},
+		{"complete twice", func() error { return s.CompleteJob("j1", "w1") }, ErrJobLost},
+	}
+	for _, tt := range tests {
+		if err := tt.call(); !errors.Is(err, tt.want) {
+			t.Errorf("%s: %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	if n, err := s.PruneJobs(time.Now().Add(-time.Hour)); err != nil || n != 0 {
+		t.Errorf("PruneJobs before it finished = %d, %v, want 0", n, err)
+	}
+	if n, err := s.PruneJobs(time.Now().Add(time.Minute)); err != nil || n != 1 {
+		t.Errorf("PruneJobs after it finished = %d, %v, want 1", n, err)
+	}
+}
@@ -0,0 +1,550 @@
+package store
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// migration is one versioned step of the schema. Steps are applied in order
+// of version, each in a transaction together with its schema_version row, so
+// a step that fails leaves the database as it was before it.
+type migration struct {
+	version int
+	name    string
+	up      func(tx *sqlTx) error
+	down    func(tx *sqlTx) error // nil when the step cannot be reverted
+}
+
+// migrations is the schema's history on SQLite. Append new steps with the
+// next version, and the same step to postgresMigrations, and never edit one
+// that has shipped; databases that already applied it will not run it again.
+// TestPostgresMigrationsMatchSQLite fails when the two histories end in
+// different tables or columns.
+var migrations = []migration{
+	{version: 1, name: "baseline", up: migrateBaseline},
+	{version: 2, name: "replication runs", up: execAll(replicationRunsUp...), down: execAll(replicationRunsDown...)},
+	{version: 3, name: "destination activity", up: execAll(
+		`ALTER TABLE destinations ADD COLUMN last_seen_at DATETIME`,
+		`ALTER TABLE destinations ADD COLUMN last_synced_at DATETIME`,
+	), down: execAll(
+		`ALTER TABLE destinations DROP COLUMN last_synced_at`,
+		`ALTER TABLE destinations DROP COLUMN last_seen_at`,
+	)},
+	{version: 4, name: "settings", up: execAll(
+		`CREATE TABLE settings (
+			key TEXT PRIMARY KEY,
+			value TEXT NOT NULL,
+			updated_at DATETIME NOT NULL
+		)`,
+	), down: execAll(`DROP TABLE settings`)},
+	{version: 5, name: "jobs", up: execAll(
+		`CREATE TABLE jobs (
+			id TEXT PRIMARY KEY,
+			type TEXT NOT NULL,
+			payload TEXT NOT NULL DEFAULT '',
+			state TEXT NOT NULL,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			max_attempts INTEGER NOT NULL DEFAULT 1,
+			last_error TEXT NOT NULL DEFAULT '',
+			worker TEXT NOT NULL DEFAULT '',
+			created_at DATETIME NOT NULL,
+			updated_at DATETIME NOT NULL,
+			run_after DATETIME NOT NULL,
+			heartbeat_at DATETIME,
+			finished_at DATETIME
+		)`,
+		`CREATE INDEX jobs_state_run_after ON jobs (state, run_after)`,
+	), down: execAll(`DROP TABLE jobs`)},
+	{version: 6, name: "per-host container selection", up: execAll(hostSelectionUp...), down: execAll(hostSelectionDown...)},
+	{version: 7, name: "selected networks", up: execAll(
+		`CREATE TABLE selected_networks (
+			name TEXT PRIMARY KEY
+		)`,
+	), down: execAll(`DROP TABLE selected_networks`)},
+	{version: 8, name: "selected images", up: execAll(
+		`CREATE TABLE selected_images (
+			name TEXT PRIMARY KEY
+		)`,
+	), down: execAll(`DROP TABLE selected_images`)},
+	{version: 9, name: "image policies by container name", up: execAll(imagePolicyNamesUp...), down: execAll(imagePolicyNamesDown...)},
+}
+
+// baselineSchema is the schema as it was before migrations were versioned.
+// The statements tolerate tables that already exist, so databases created
+// back then adopt version 1 without changes.
+var baselineSchema = []string{
+	`CREATE TABLE IF NOT EXISTS selected_containers (
+		id TEXT PRIMARY KEY
+	)`,
+	`CREATE TABLE IF NOT EXISTS selected_volumes (
+		name TEXT PRIMARY KEY
+	)`,
+	`CREATE TABLE IF NOT EXISTS selected_projects (
+		name TEXT PRIMARY KEY
+	)`,
+	`CREATE TABLE IF NOT EXISTS selection_rules (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		rule TEXT NOT NULL UNIQUE,
+		created_at DATETIME NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS profiles (
+		name TEXT PRIMARY KEY,
+		created_at DATETIME NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS profile_items (
+		profile TEXT NOT NULL,
+		item_type TEXT NOT NULL,
+		item_id TEXT NOT NULL,
+		PRIMARY KEY (profile, item_type, item_id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS quiesce_modes (
+		container_id TEXT PRIMARY KEY,
+		mode TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS start_policies (
+		container_id TEXT PRIMARY KEY,
+		policy TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS replication_hooks (
+		container_id TEXT PRIMARY KEY,
+		pre_command TEXT NOT NULL DEFAULT '',
+		post_command TEXT NOT NULL DEFAULT '',
+		timeout_seconds INTEGER NOT NULL DEFAULT 0
+	)`,
+	`CREATE TABLE IF NOT EXISTS volume_excludes (
+		volume_name TEXT NOT NULL,
+		pattern TEXT NOT NULL,
+		position INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (volume_name, pattern)
+	)`,
+	`CREATE TABLE IF NOT EXISTS volume_sync_state (
+		volume TEXT NOT NULL,
+		peer TEXT NOT NULL,
+		path TEXT NOT NULL,
+		hash TEXT NOT NULL,
+		PRIMARY KEY (volume, peer, path)
+	)`,
+	`CREATE TABLE IF NOT EXISTS selected_bind_mounts (
+		container_id TEXT NOT NULL,
+		source TEXT NOT NULL,
+		target_path TEXT NOT NULL DEFAULT '',
+		PRIMARY KEY (container_id, source)
+	)`,
+	`CREATE TABLE IF NOT EXISTS confirmation_gates (
+		operation TEXT PRIMARY KEY,
+		mode TEXT NOT NULL,
+		phrase TEXT NOT NULL DEFAULT ''
+	)`,
+	`CREATE TABLE IF NOT EXISTS approvals (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		operation TEXT NOT NULL,
+		requested_by TEXT NOT NULL,
+		approved_by TEXT NOT NULL DEFAULT '',
+		requested_at DATETIME NOT NULL,
+		approved_at DATETIME,
+		consumed INTEGER NOT NULL DEFAULT 0
+	)`,
+	`CREATE TABLE IF NOT EXISTS image_policies (
+		container_id TEXT PRIMARY KEY,
+		policy TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS registry_credentials (
+		name TEXT PRIMARY KEY,
+		server_address TEXT NOT NULL,
+		username TEXT NOT NULL DEFAULT '',
+		password TEXT NOT NULL DEFAULT '',
+		identity_token TEXT NOT NULL DEFAULT ''
+	)`,
+	`CREATE TABLE IF NOT EXISTS audit_log (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		created_at DATETIME NOT NULL,
+		actor TEXT NOT NULL DEFAULT '',
+		remote_addr TEXT NOT NULL DEFAULT '',
+		action TEXT NOT NULL,
+		target TEXT NOT NULL DEFAULT '',
+		outcome TEXT NOT NULL DEFAULT '',
+		detail TEXT NOT NULL DEFAULT ''
+	)`,
+	`CREATE INDEX IF NOT EXISTS audit_log_created_at ON audit_log (created_at)`,
+	`CREATE TABLE IF NOT EXISTS inventory_snapshots (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		created_at DATETIME NOT NULL,
+		data TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS replication_reports (
+		job_id TEXT PRIMARY KEY,
+		created_at DATETIME NOT NULL,
+		status TEXT NOT NULL,
+		data TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS replication_history (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		job_id TEXT NOT NULL,
+		direction TEXT NOT NULL DEFAULT '',
+		destination TEXT NOT NULL,
+		item_type TEXT NOT NULL,
+		item_name TEXT NOT NULL,
+		status TEXT NOT NULL,
+		error TEXT NOT NULL DEFAULT '',
+		bytes INTEGER NOT NULL DEFAULT 0,
+		duration_ms INTEGER NOT NULL DEFAULT 0,
+		started_at DATETIME NOT NULL,
+		finished_at DATETIME NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS replication_history_item ON replication_history (item_type, item_name)`,
+	`CREATE INDEX IF NOT EXISTS replication_history_job ON replication_history (job_id)`,
+	`CREATE TABLE IF NOT EXISTS notes (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		target_type TEXT NOT NULL,
+		target_id TEXT NOT NULL,
+		body TEXT NOT NULL,
+		author TEXT NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS tags (
+		target_type TEXT NOT NULL,
+		target_id TEXT NOT NULL,
+		tag TEXT NOT NULL,
+		PRIMARY KEY (target_type, target_id, tag)
+	)`,
+	`CREATE TABLE IF NOT EXISTS destinations (
+		name TEXT PRIMARY KEY,
+		url TEXT NOT NULL UNIQUE,
+		auth_token TEXT NOT NULL DEFAULT '',
+		tls_ca_cert TEXT NOT NULL DEFAULT '',
+		tls_server_name TEXT NOT NULL DEFAULT '',
+		tls_insecure_skip_verify BOOLEAN NOT NULL DEFAULT 0,
+		enabled BOOLEAN NOT NULL DEFAULT 1,
+		created_at DATETIME NOT NULL,
+		updated_at DATETIME NOT NULL,
+		version TEXT NOT NULL DEFAULT '',
+		architecture TEXT NOT NULL DEFAULT '',
+		disk_available INTEGER NOT NULL DEFAULT 0,
+		paired_at DATETIME
+	)`,
+	`CREATE TABLE IF NOT EXISTS peer_tokens (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		remote_addr TEXT NOT NULL DEFAULT '',
+		token_hash TEXT NOT NULL UNIQUE,
+		created_at DATETIME NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS docker_hosts (
+		name TEXT PRIMARY KEY,
+		address TEXT NOT NULL UNIQUE,
+		tls_ca_cert TEXT NOT NULL DEFAULT '',
+		tls_cert TEXT NOT NULL DEFAULT '',
+		tls_key TEXT NOT NULL DEFAULT '',
+		tls_insecure_skip_verify BOOLEAN NOT NULL DEFAULT 0,
+		created_at DATETIME NOT NULL,
+		updated_at DATETIME NOT NULL
+	)`,
+}
+
+// migrateBaseline creates the baseline schema. Destination capabilities were
+// added to the table before versioning, so older databases gain them here.
+func migrateBaseline(tx *sqlTx) error {
+	if err := execAll(baselineSchema...)(tx); err != nil {
+		return err
+	}
+	for _, col := range []struct{ name, definition string }{
+		{"version", "TEXT NOT NULL DEFAULT ''"},
+		{"architecture", "TEXT NOT NULL DEFAULT ''"},
+		{"disk_available", "INTEGER NOT NULL DEFAULT 0"},
+		{"paired_at", "DATETIME"},
+	} {
+		if err := addColumn(tx, "destinations", col.name, col.definition); err != nil {
+			return fmt.Errorf("add %s to destinations: %w", col.name, err)
+		}
+	}
+	return nil
+}
+
+// replicationRunsUp records each run once, with its items in their own
+// table, instead of repeating the run on every item of replication_history.
+// Existing history is carried over; profiles, request IDs and durations come
+// from the stored reports where there are any.
+var replicationRunsUp = []string{
+	`CREATE TABLE replication_runs (
+		job_id TEXT PRIMARY KEY,
+		request_id TEXT NOT NULL DEFAULT '',
+		profile TEXT NOT NULL DEFAULT '',
+		direction TEXT NOT NULL DEFAULT '',
+		status TEXT NOT NULL,
+		error TEXT NOT NULL DEFAULT '',
+		replicated INTEGER NOT NULL DEFAULT 0,
+		failed INTEGER NOT NULL DEFAULT 0,
+		bytes INTEGER NOT NULL DEFAULT 0,
+		duration_ms INTEGER NOT NULL DEFAULT 0,
+		started_at DATETIME NOT NULL,
+		finished_at DATETIME NOT NULL
+	)`,
+	`CREATE INDEX replication_runs_finished_at ON replication_runs (finished_at)`,
+	`CREATE TABLE replication_run_items (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		job_id TEXT NOT NULL,
+		destination TEXT NOT NULL,
+		item_type TEXT NOT NULL,
+		item_name TEXT NOT NULL,
+		status TEXT NOT NULL,
+		error TEXT NOT NULL DEFAULT '',
+		bytes INTEGER NOT NULL DEFAULT 0,
+		duration_ms INTEGER NOT NULL DEFAULT 0
+	)`,
+	`CREATE INDEX replication_run_items_item ON replication_run_items (item_type, item_name)`,
+	`CREATE INDEX replication_run_items_job ON replication_run_items (job_id)`,
+	`INSERT INTO replication_runs (job_id, direction, status, replicated, failed, bytes, started_at, finished_at)
+	SELECT job_id, MAX(direction),
+		CASE WHEN SUM(status = 'failed') = 0 THEN 'succeeded' WHEN SUM(status = 'replicated') = 0 THEN 'failed' ELSE 'partial' END,
+		SUM(status = 'replicated'), SUM(status = 'failed'), SUM(bytes), MIN(started_at), MAX(finished_at)
+	FROM replication_history GROUP BY job_id`,
+	`UPDATE replication_runs SET
+		request_id = COALESCE(json_extract(r.data, '$.requestId'), ''),
+		profile = COALESCE(json_extract(r.data, '$.profile'), ''),
+		status = r.status,
+		duration_ms = COALESCE(json_extract(r.data, '$.durationMs'), 0)
+	FROM replication_reports r WHERE r.job_id = replication_runs.job_id AND json_valid(r.data)`,
+	`INSERT INTO replication_run_items (id, job_id, destination, item_type, item_name, status, error, bytes, duration_ms)
+	SELECT id, job_id, destination, item_type, item_name, status, error, bytes, duration_ms FROM replication_history`,
+	`DROP TABLE replication_history`,
+}
+
+// replicationRunsDown puts the history back into one table. Runs that had
+// no items, and what only the runs table held, are lost.
+var replicationRunsDown = []string{
+	`CREATE TABLE replication_history (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		job_id TEXT NOT NULL,
+		direction TEXT NOT NULL DEFAULT '',
+		destination TEXT NOT NULL,
+		item_type TEXT NOT NULL,
+		item_name TEXT NOT NULL,
+		status TEXT NOT NULL,
+		error TEXT NOT NULL DEFAULT '',
+		bytes INTEGER NOT NULL DEFAULT 0,
+		duration_ms INTEGER NOT NULL DEFAULT 0,
+		started_at DATETIME NOT NULL,
+		finished_at DATETIME NOT NULL
+	)`,
+	`CREATE INDEX replication_history_item ON replication_history (item_type, item_name)`,
+	`CREATE INDEX replication_history_job ON replication_history (job_id)`,
+	`INSERT INTO replication_history (id, job_id, direction, destination, item_type, item_name, status, error, bytes, duration_ms, started_at, finished_at)
+	SELECT i.id, i.job_id, r.direction, i.destination, i.item_type, i.item_name, i.status, i.error, i.bytes, i.duration_ms, r.started_at, r.finished_at
+	FROM replication_run_items i JOIN replication_runs r ON r.job_id = i.job_id`,
+	`DROP TABLE replication_run_items`,
+	`DROP TABLE replication_runs`,
+}
+
+// hostSelectionUp keys selected containers by host as well as ID, and keeps
+// their names. Selections made before are taken to be of local containers;
+// their names are filled in as the containers are next listed.
+var hostSelectionUp = []string{
+	`CREATE TABLE selected_containers_by_host (
+		host TEXT NOT NULL DEFAULT '',
+		id TEXT NOT NULL,
+		name TEXT NOT NULL DEFAULT '',
+		PRIMARY KEY (host, id)
+	)`,
+	`INSERT INTO selected_containers_by_host (id) SELECT id FROM selected_containers`,
+	`DROP TABLE selected_containers`,
+	`ALTER TABLE selected_containers_by_host RENAME TO selected_containers`,
+	`CREATE INDEX selected_containers_name ON selected_containers (host, name)`,
+}
+
+// hostSelectionDown goes back to bare IDs. Selections on other hosts become
+// indistinguishable from local ones.
+var hostSelectionDown = []string{
+	`CREATE TABLE selected_containers_by_id (
+		id TEXT PRIMARY KEY
+	)`,
+	`INSERT OR IGNORE INTO selected_containers_by_id (id) SELECT id FROM selected_containers`,
+	`DROP TABLE selected_containers`,
+	`ALTER TABLE selected_containers_by_id RENAME TO selected_containers`,
+}
+
+// imagePolicyNamesUp keys image policies by host and container name, so a
+// policy outlives its container being recreated. Policies set before are
+// taken to be of local containers and stay keyed by container ID until the
+// container is next listed.
+var imagePolicyNamesUp = []string{
+	`CREATE TABLE image_policies_by_name (
+		host TEXT NOT NULL DEFAULT '',
+		container_name TEXT NOT NULL,
+		policy TEXT NOT NULL,
+		PRIMARY KEY (host, container_name)
+	)`,
+	`INSERT INTO image_policies_by_name (container_name, policy) SELECT container_id, policy FROM image_policies`,
+	`DROP TABLE image_policies`,
+	`ALTER TABLE image_policies_by_name RENAME TO image_policies`,
+}
+
+// imagePolicyNamesDown goes back to container IDs. Policies on other hosts
+// are dropped, and those keyed by name match no container until set again.
+var imagePolicyNamesDown = []string{
+	`CREATE TABLE image_policies_by_id (
+		container_id TEXT PRIMARY KEY,
+		policy TEXT NOT NULL
+	)`,
+	`INSERT INTO image_policies_by_id (container_id, policy) SELECT container_name, policy FROM image_policies WHERE host = ''`,
+	`DROP TABLE image_policies`,
+	`ALTER TABLE image_policies_by_id RENAME TO image_policies`,
+}
+
+// execAll returns a step that runs each statement in turn.
+func execAll(stmts ...string) func(tx *sqlTx) error {
+	return func(tx *sqlTx) error {
+		for _, stmt := range stmts {
+			if _, err := tx.Exec(stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// addColumn adds a column to table unless it is already there.
+func addColumn(tx *sqlTx, table, column, definition string) error {
+	rows, err := tx.Query("SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	_, err = tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
+// migrations returns the schema's history on the store's database.
+func (s *SQLStore) migrations() []migration {
+	if s.db.postgres {
+		return postgresMigrations
+	}
+	return migrations
+}
+
+// LatestSchemaVersion is the version Migrate brings a database to.
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// SchemaVersion returns the version of the last migration applied to the
+// database, 0 for a new one.
+func (s *SQLStore) SchemaVersion() (int, error) {
+	// TIMESTAMP rather than DATETIME, which PostgreSQL does not have
+	createVersionTable := `
+	CREATE TABLE IF NOT EXISTS schema_version (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMP NOT NULL
+	);`
+	if _, err := s.db.Exec(createVersionTable); err != nil {
+		return 0, fmt.Errorf("failed to create schema_version table: %w", err)
+	}
+	var version int
+	if err := s.db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&version); err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return version, nil
+}
+
+// Migrate applies every migration the database has not had yet.
+func (s *SQLStore) Migrate() error {
+	return s.MigrateTo(LatestSchemaVersion())
+}
+
+// MigrateTo applies migrations up to version, or reverts those above it when
+// the database is ahead. Reverting stops before it starts if any step on the
+// way down cannot be reverted.
+func (s *SQLStore) MigrateTo(version int) error {
+	migrations := s.migrations()
+	latest := LatestSchemaVersion()
+	if version < 0 || version > latest {
+		return fmt.Errorf("schema version %d does not exist, expected 0 to %d", version, latest)
+	}
+	if first := migrations[0].version; version > 0 && version < first {
+		return fmt.Errorf("schema version %d does not exist on PostgreSQL, which starts at %d", version, first)
+	}
+	unlock, err := s.db.lockMigrations()
+	if err != nil {
+		return fmt.Errorf("failed to lock schema migrations: %w", err)
+	}
+	defer unlock()
+	current, err := s.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	if current > latest {
+		return fmt.Errorf("database schema version %d is newer than this build, which knows up to %d", current, latest)
+	}
+
+	if current <= version {
+		for _, m := range migrations {
+			if m.version <= current || m.version > version {
+				continue
+			}
+			if err := s.applyMigration(m, true); err != nil {
+				return err
+			}
+			slog.Info("Applied schema migration", "version", m.version, "name", m.name)
+		}
+		return nil
+	}
+
+	var steps []migration
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		if m.version > current || m.version <= version {
+			continue
+		}
+		if m.down == nil {
+			return fmt.Errorf("migration %d (%s) cannot be reverted", m.version, m.name)
+		}
+		steps = append(steps, m)
+	}
+	for _, m := range steps {
+		if err := s.applyMigration(m, false); err != nil {
+			return err
+		}
+		slog.Info("Reverted schema migration", "version", m.version, "name", m.name)
+	}
+	return nil
+}
+
+// applyMigration runs m's up step, or its down step when up is false, and
+// records the result in schema_version in the same transaction.
+func (s *SQLStore) applyMigration(m migration, up bool) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+	}
+	defer tx.Rollback()
+
+	step, record := m.up, "INSERT INTO schema_version (version, name, applied_at) VALUES (?, ?, ?)"
+	args := []interface{}{m.version, m.name, time.Now().UTC()}
+	if !up {
+		step, record = m.down, "DELETE FROM schema_version WHERE version = ?"
+		args = args[:1]
+	}
+	if err := step(tx); err != nil {
+		return fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+	}
+	if _, err := tx.Exec(record, args...); err != nil {
+		return fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+	}
+	return nil
+}
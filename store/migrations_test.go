@@ -0,0 +1,209 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// column is what the store's queries rely on in a column, whatever its type
+// on each database.
+type column struct {
+	notNull    bool
+	primaryKey bool
+}
+
+// tableColumns maps each table to its columns by name.
+type tableColumns map[string]map[string]column
+
+// sqliteTables reads the tables of a SQLite database, less schema_version,
+// which Migrate creates outside of the migrations.
+func sqliteTables(t *testing.T, db *sql.DB) tableColumns {
+	t.Helper()
+	rows, err := db.Query(`SELECT m.name, c.name, c."notnull", c.pk FROM sqlite_master m, pragma_table_info(m.name) c
+		WHERE m.type = 'table' AND m.name NOT IN ('schema_version', 'sqlite_sequence')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	tables := make(tableColumns)
+	for rows.Next() {
+		var table, name string
+		var notNull, pk int
+		if err := rows.Scan(&table, &name, &notNull, &pk); err != nil {
+			t.Fatal(err)
+		}
+		if tables[table] == nil {
+			tables[table] = make(map[string]column)
+		}
+		// A primary key is never null, though SQLite only enforces it for
+		// the columns declared NOT NULL
+		tables[table][name] = column{notNull: notNull == 1 || pk > 0, primaryKey: pk > 0}
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return tables
+}
+
+// postgresColumns reads the tables of the current schema of a PostgreSQL
+// database, less schema_version.
+func postgresColumns(t *testing.T, db *sql.DB) tableColumns {
+	t.Helper()
+	rows, err := db.Query(`SELECT c.table_name, c.column_name, c.is_nullable = 'NO',
+			EXISTS (SELECT 1 FROM information_schema.table_constraints tc
+				JOIN information_schema.key_column_usage k ON k.constraint_name = tc.constraint_name AND k.table_schema = tc.table_schema
+				WHERE tc.constraint_type = 'PRIMARY KEY' AND tc.table_schema = c.table_schema AND tc.table_name = c.table_name AND k.column_name = c.column_name)
+		FROM information_schema.columns c
+		WHERE c.table_schema = current_schema() AND c.table_name <> 'schema_version'`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	tables := make(tableColumns)
+	for rows.Next() {
+		var table, name string
+		var col column
+		if err := rows.Scan(&table, &name, &col.notNull, &col.primaryKey); err != nil {
+			t.Fatal(err)
+		}
+		if tables[table] == nil {
+			tables[table] = make(map[string]column)
+		}
+		tables[table][name] = col
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return tables
+}
+
+// postgresSchema migrates the PostgreSQL database named by
+// DOCKERAP_TEST_POSTGRES, which should be empty, and returns its tables.
+// Without one it runs postgresMigrations on a SQLite database instead, which
+// takes PostgreSQL's type names as they are, so the tables and columns they
+// create are still compared on every test run.
+func postgresSchema(t *testing.T) tableColumns {
+	t.Helper()
+	if dsn := os.Getenv("DOCKERAP_TEST_POSTGRES"); dsn != "" {
+		st, err := NewStore(dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := st.(*SQLStore)
+		t.Cleanup(func() {
+			if err := s.MigrateTo(0); err != nil {
+				t.Errorf("revert PostgreSQL migrations: %v", err)
+			}
+			s.Close()
+		})
+		if err := s.Migrate(); err != nil {
+			t.Fatal(err)
+		}
+		return postgresColumns(t, s.db.DB)
+	}
+
+	db := openMemoryDB(t)
+	applySteps(t, db, postgresMigrations, true)
+	return sqliteTables(t, db.DB)
+}
+
+func openMemoryDB(t *testing.T) *sqlDB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return &sqlDB{DB: db}
+}
+
+// applySteps runs the up steps of migrations in order, or their down steps
+// in reverse.
+func applySteps(t *testing.T, db *sqlDB, migrations []migration, up bool) {
+	t.Helper()
+	steps := slices.Clone(migrations)
+	if !up {
+		slices.Reverse(steps)
+	}
+	for _, m := range steps {
+		step := m.up
+		if !up {
+			step = m.down
+		}
+		tx, err := db.Begin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := step(tx); err != nil {
+			tx.Rollback()
+			t.Fatalf("migration %d (%s): %v", m.version, m.name, err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestPostgresMigrationsMatchSQLite(t *testing.T) {
+	st, err := NewMemoryStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	sqlite := sqliteTables(t, st.(*SQLStore).db.DB)
+	postgres := postgresSchema(t)
+
+	for _, table := range slices.Sorted(maps.Keys(sqlite)) {
+		if _, ok := postgres[table]; !ok {
+			t.Errorf("table %s is missing on PostgreSQL", table)
+		}
+	}
+	for _, table := range slices.Sorted(maps.Keys(postgres)) {
+		if _, ok := sqlite[table]; !ok {
+			t.Errorf("table %s is only on PostgreSQL", table)
+			continue
+		}
+		if diff := compareColumns(sqlite[table], postgres[table]); diff != "" {
+			t.Errorf("table %s differs: %s", table, diff)
+		}
+	}
+}
+
+// compareColumns describes how the columns of a table on SQLite differ from
+// those on PostgreSQL, or returns "" when they match.
+func compareColumns(sqlite, postgres map[string]column) string {
+	var diffs []string
+	for _, name := range slices.Sorted(maps.Keys(sqlite)) {
+		pg, ok := postgres[name]
+		switch {
+		case !ok:
+			diffs = append(diffs, name+" is missing on PostgreSQL")
+		case pg != sqlite[name]:
+			diffs = append(diffs, fmt.Sprintf("%s is %+v on SQLite but %+v on PostgreSQL", name, sqlite[name], pg))
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(postgres)) {
+		if _, ok := sqlite[name]; !ok {
+			diffs = append(diffs, name+" is only on PostgreSQL")
+		}
+	}
+	return strings.Join(diffs, "; ")
+}
+
+func TestPostgresBaselineDropsWhatItCreates(t *testing.T) {
+	db := openMemoryDB(t)
+	applySteps(t, db, postgresMigrations, true)
+	if created := slices.Sorted(maps.Keys(sqliteTables(t, db.DB))); !slices.Equal(created, slices.Sorted(slices.Values(postgresTables))) {
+		t.Errorf("postgresBaseline creates %v, postgresTables lists %v", created, postgresTables)
+	}
+	applySteps(t, db, postgresMigrations, false)
+	if left := sqliteTables(t, db.DB); len(left) > 0 {
+		t.Errorf("tables left after reverting: %v", slices.Sorted(maps.Keys(left)))
+	}
+}
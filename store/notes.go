@@ -0,0 +1,188 @@
+package store
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Note targets.
+const (
+	TargetContainer   = "container"
+	TargetDestination = "destination"
+	TargetJob         = "job"
+)
+
+// Note is a free-form operator comment on a container, destination, or replication job.
+type Note struct {
+	ID         int64     `json:"id"`
+	TargetType string    `json:"targetType"`
+	TargetID   string    `json:"targetId"`
+	Body       string    `json:"body"`
+	Author     string    `json:"author"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// Target identifies something notes and tags can be attached to.
+type Target struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// NoteFilter narrows GetNotes; empty fields match everything.
+type NoteFilter struct {
+	TargetType string
+	TargetID   string
+	Query      string // case-insensitive substring of the body
+}
+
+func validTarget(targetType, targetID string) error {
+	switch targetType {
+	case TargetContainer, TargetDestination, TargetJob:
+	default:
+		return fmt.Errorf("invalid target type: %s", targetType)
+	}
+	if targetID == "" {
+		return fmt.Errorf("target ID is required")
+	}
+	return nil
+}
+
+// AddNote stores a note and returns its ID.
+func (s *SQLStore) AddNote(n Note) (int64, error) {
+	if err := validTarget(n.TargetType, n.TargetID); err != nil {
+		return 0, err
+	}
+	if strings.TrimSpace(n.Body) == "" {
+		return 0, fmt.Errorf("note body cannot be empty")
+	}
+	var id int64
+	err := s.db.QueryRow("INSERT INTO notes (target_type, target_id, body, author, created_at) VALUES (?, ?, ?, ?, ?) RETURNING id",
+		n.TargetType, n.TargetID, n.Body, n.Author, time.Now().UTC()).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("database operation failed: %w", err)
+	}
+	return id, nil
+}
+
+// DeleteNote removes a note.
+func (s *SQLStore) DeleteNote(id int64) error {
+	if _, err := s.db.Exec("DELETE FROM notes WHERE id = ?", id); err != nil {
+		return fmt.Errorf("database operation failed: %w", err)
+	}
+	return nil
+}
+
+// GetNotes retrieves notes matching filter, newest first.
+func (s *SQLStore) GetNotes(filter NoteFilter) ([]Note, error) {
+	query := "SELECT id, target_type, target_id, body, author, created_at FROM notes WHERE 1 = 1"
+	var args []interface{}
+	if filter.TargetType != "" {
+		query += " AND target_type = ?"
+		args = append(args, filter.TargetType)
+	}
+	if filter.TargetID != "" {
+		query += " AND target_id = ?"
+		args = append(args, filter.TargetID)
+	}
+	if filter.Query != "" {
+		query += " AND LOWER(body) LIKE LOWER(?) ESCAPE '\\'"
+		args = append(args, "%"+escapeLike(filter.Query)+"%")
+	}
+	query += " ORDER BY id DESC"
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notes []Note
+	for rows.Next() {
+		var n Note
+		if err := rows.Scan(&n.ID, &n.TargetType, &n.TargetID, &n.Body, &n.Author, &n.CreatedAt); err != nil {
+			return nil, err
+		}
+		notes = append(notes, n)
+	}
+	return notes, rows.Err()
+}
+
+// SetTags replaces the tags on a target. Tags are trimmed, lower-cased, and de-duplicated.
+func (s *SQLStore) SetTags(targetType, targetID string, tags []string) error {
+	if err := validTarget(targetType, targetID); err != nil {
+		return err
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("database operation failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM tags WHERE target_type = ? AND target_id = ?", targetType, targetID); err != nil {
+		return fmt.Errorf("database operation failed: %w", err)
+	}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" {
+			continue
+		}
+		if _, err := tx.Exec("INSERT INTO tags (target_type, target_id, tag) VALUES (?, ?, ?) ON CONFLICT DO NOTHING", targetType, targetID, tag); err != nil {
+			return fmt.Errorf("database operation failed: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("database operation failed: %w", err)
+	}
+	return nil
+}
+
+// GetTags retrieves the tags of every target of targetType, keyed by target ID.
+func (s *SQLStore) GetTags(targetType string) (map[string][]string, error) {
+	rows, err := s.db.Query("SELECT target_id, tag FROM tags WHERE target_type = ? ORDER BY tag", targetType)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := make(map[string][]string)
+	for rows.Next() {
+		var id, tag string
+		if err := rows.Scan(&id, &tag); err != nil {
+			return nil, err
+		}
+		tags[id] = append(tags[id], tag)
+	}
+	return tags, rows.Err()
+}
+
+// FindTagged retrieves the targets carrying tag.
+func (s *SQLStore) FindTagged(tag string) ([]Target, error) {
+	rows, err := s.db.Query("SELECT target_type, target_id FROM tags WHERE tag = ?", strings.ToLower(strings.TrimSpace(tag)))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var targets []Target
+	for rows.Next() {
+		var t Target
+		if err := rows.Scan(&t.Type, &t.ID); err != nil {
+			return nil, err
+		}
+		targets = append(targets, t)
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		if targets[i].Type != targets[j].Type {
+			return targets[i].Type < targets[j].Type
+		}
+		return targets[i].ID < targets[j].ID
+	})
+	return targets, rows.Err()
+}
+
+// escapeLike escapes the LIKE wildcards in s.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
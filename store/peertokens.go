@@ -0,0 +1,85 @@
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrPeerTokenNotFound is returned when revoking a token that does not exist.
+var ErrPeerTokenNotFound = errors.New("peer token not found")
+
+// PeerToken is a token this instance issued to a source through pairing.
+// Only a hash of the token is kept.
+type PeerToken struct {
+	ID         int64     `json:"id"`
+	Name       string    `json:"name"`       // the name the source gave itself
+	RemoteAddr string    `json:"remoteAddr"` // where the pairing came from
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+func hashPeerToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreatePeerToken stores a newly issued token.
+func (s *SQLStore) CreatePeerToken(name, remoteAddr, token string) error {
+	_, err := s.db.Exec("INSERT INTO peer_tokens (name, remote_addr, token_hash, created_at) VALUES (?, ?, ?, ?)",
+		name, remoteAddr, hashPeerToken(token), time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("database operation failed: %w", err)
+	}
+	return nil
+}
+
+// PeerTokenValid reports whether token was issued by pairing and not revoked.
+func (s *SQLStore) PeerTokenValid(token string) (bool, error) {
+	var n int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM peer_tokens WHERE token_hash = ?", hashPeerToken(token)).Scan(&n); err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// HasPeerTokens reports whether any source has been paired.
+func (s *SQLStore) HasPeerTokens() (bool, error) {
+	var n int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM peer_tokens").Scan(&n); err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// GetPeerTokens lists the issued tokens, newest first.
+func (s *SQLStore) GetPeerTokens() ([]PeerToken, error) {
+	rows, err := s.db.Query("SELECT id, name, remote_addr, created_at FROM peer_tokens ORDER BY id DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []PeerToken
+	for rows.Next() {
+		var t PeerToken
+		if err := rows.Scan(&t.ID, &t.Name, &t.RemoteAddr, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+// DeletePeerToken revokes an issued token.
+func (s *SQLStore) DeletePeerToken(id int64) error {
+	res, err := s.db.Exec("DELETE FROM peer_tokens WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("database operation failed: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrPeerTokenNotFound
+	}
+	return nil
+}
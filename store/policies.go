@@ -0,0 +1,136 @@
+package store
+
+import (
+	"fmt"
+)
+
+// Image recreation policies applied when a source container's tag has moved.
+const (
+	ImagePolicyPin    = "pin"
+	ImagePolicyFollow = "follow"
+	ImagePolicyPrompt = "prompt"
+)
+
+// defaultImagePolicyKey is the container name of the image_policies row
+// holding the global default, which is stored for the local host.
+const defaultImagePolicyKey = "*"
+
+// ImagePolicyOverride is a container's own image policy. Host is the name of
+// a stored host or Docker context, empty for the local daemon. Name is the
+// container's name, so the policy outlives the container being recreated;
+// policies set before they were kept by name hold the container's ID until
+// it is seen again.
+type ImagePolicyOverride struct {
+	Host   string `json:"host"`
+	Name   string `json:"name"`
+	Policy string `json:"policy"`
+}
+
+// ImagePolicies holds the global default and per-container overrides.
+type ImagePolicies struct {
+	Default   string                `json:"default"`
+	Overrides []ImagePolicyOverride `json:"overrides"`
+}
+
+// GetImagePolicies retrieves the default image policy and all per-container overrides.
+func (s *SQLStore) GetImagePolicies() (*ImagePolicies, error) {
+	rows, err := s.db.Query("SELECT host, container_name, policy FROM image_policies ORDER BY host, container_name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	policies := &ImagePolicies{Default: ImagePolicyPin, Overrides: []ImagePolicyOverride{}}
+	for rows.Next() {
+		var o ImagePolicyOverride
+		if err := rows.Scan(&o.Host, &o.Name, &o.Policy); err != nil {
+			return nil, err
+		}
+		if o.Host == "" && o.Name == defaultImagePolicyKey {
+			policies.Default = o.Policy
+		} else {
+			policies.Overrides = append(policies.Overrides, o)
+		}
+	}
+	return policies, rows.Err()
+}
+
+// ResolveImagePolicies returns the overrides of containers on host, keyed by
+// container ID. live maps the IDs of containers now on host to their names;
+// it need not list them all. A policy still kept under its container's ID
+// moves to the container's name, unless the name has a policy of its own.
+func (s *SQLStore) ResolveImagePolicies(host string, live map[string]string) (map[string]string, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("database operation failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query("SELECT container_name, policy FROM image_policies WHERE host = ?", host)
+	if err != nil {
+		return nil, fmt.Errorf("database operation failed: %w", err)
+	}
+	stored := make(map[string]string)
+	for rows.Next() {
+		var name, policy string
+		if err := rows.Scan(&name, &policy); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("database operation failed: %w", err)
+		}
+		stored[name] = policy
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("database operation failed: %w", err)
+	}
+
+	overrides := make(map[string]string)
+	for id, name := range live {
+		policy, byID := stored[id]
+		if byID && name != "" {
+			if _, err := tx.Exec("DELETE FROM image_policies WHERE host = ? AND container_name = ?", host, id); err != nil {
+				return nil, fmt.Errorf("database operation failed: %w", err)
+			}
+			if _, ok := stored[name]; !ok {
+				if _, err := tx.Exec("INSERT INTO image_policies (host, container_name, policy) VALUES (?, ?, ?)", host, name, policy); err != nil {
+					return nil, fmt.Errorf("database operation failed: %w", err)
+				}
+				stored[name] = policy
+			}
+		}
+		if p, ok := stored[name]; ok && name != "" {
+			overrides[id] = p
+		} else if byID {
+			overrides[id] = policy
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("database operation failed: %w", err)
+	}
+	return overrides, nil
+}
+
+// SetImagePolicy sets the policy for the named container on host, or the
+// default when name is empty. An empty policy removes a per-container override.
+func (s *SQLStore) SetImagePolicy(host, name, policy string) error {
+	if name == "" {
+		host, name = "", defaultImagePolicyKey
+	}
+
+	var err error
+	switch policy {
+	case "":
+		if name == defaultImagePolicyKey {
+			return fmt.Errorf("the default image policy cannot be removed")
+		}
+		_, err = s.db.Exec("DELETE FROM image_policies WHERE host = ? AND container_name = ?", host, name)
+	case ImagePolicyPin, ImagePolicyFollow, ImagePolicyPrompt:
+		_, err = s.db.Exec("INSERT INTO image_policies (host, container_name, policy) VALUES (?, ?, ?) ON CONFLICT(host, container_name) DO UPDATE SET policy = excluded.policy", host, name, policy)
+	default:
+		return fmt.Errorf("invalid image policy: %s", policy)
+	}
+	if err != nil {
+		return fmt.Errorf("database operation failed: %w", err)
+	}
+	return nil
+}
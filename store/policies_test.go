@@ -0,0 +1,100 @@
+package store
+
+import (
+	"maps"
+	"slices"
+	"testing"
+)
+
+func TestImagePoliciesFollowContainersByName(t *testing.T) {
+	s := newTestStore(t)
+	for _, p := range []ImagePolicyOverride{
+		{Name: "web", Policy: ImagePolicyFollow},
+		{Host: "edge", Name: "web", Policy: ImagePolicyPrompt},
+		{Name: "", Policy: ImagePolicyFollow}, // the default
+	} {
+		if err := s.SetImagePolicy(p.Host, p.Name, p.Policy); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The web container was recreated under a new ID; db has no policy
+	got, err := s.ResolveImagePolicies("", map[string]string{"web2": "web", "db1": "db"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"web2": ImagePolicyFollow}; !maps.Equal(got, want) {
+		t.Errorf("local overrides = %v, want %v", got, want)
+	}
+	got, err = s.ResolveImagePolicies("edge", map[string]string{"web9": "web"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"web9": ImagePolicyPrompt}; !maps.Equal(got, want) {
+		t.Errorf("edge overrides = %v, want %v", got, want)
+	}
+
+	if err := s.SetImagePolicy("", "web", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetImagePolicy("", "", ""); err == nil {
+		t.Error("the default image policy was removed")
+	}
+	policies, err := s.GetImagePolicies()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if policies.Default != ImagePolicyFollow || len(policies.Overrides) != 1 || policies.Overrides[0] != (ImagePolicyOverride{Host: "edge", Name: "web", Policy: ImagePolicyPrompt}) {
+		t.Errorf("policies = %+v", policies)
+	}
+}
+
+func TestImagePoliciesKeptByIDMoveToTheName(t *testing.T) {
+	s := newTestStore(t)
+	if err := s.MigrateTo(8); err != nil {
+		t.Fatal(err)
+	}
+	for id, policy := range map[string]string{"*": ImagePolicyPrompt, "web1": ImagePolicyFollow, "db1": ImagePolicyFollow, "old1": ImagePolicyFollow} {
+		if _, err := s.db.Exec("INSERT INTO image_policies (container_id, policy) VALUES (?, ?)", id, policy); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	// db was given a policy of its own since, which wins over the old one
+	if err := s.SetImagePolicy("", "db", ImagePolicyPin); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.ResolveImagePolicies("", map[string]string{"web1": "web", "db1": "db", "new1": "new"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"web1": ImagePolicyFollow, "db1": ImagePolicyPin}; !maps.Equal(got, want) {
+		t.Errorf("overrides = %v, want %v", got, want)
+	}
+
+	// Once moved, the policy follows web to its next ID
+	got, err = s.ResolveImagePolicies("", map[string]string{"web2": "web"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"web2": ImagePolicyFollow}; !maps.Equal(got, want) {
+		t.Errorf("overrides after recreating web = %v, want %v", got, want)
+	}
+
+	policies, err := s.GetImagePolicies()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ImagePolicyOverride{
+		{Name: "db", Policy: ImagePolicyPin},
+		// Not seen yet, so still under its ID
+		{Name: "old1", Policy: ImagePolicyFollow},
+		{Name: "web", Policy: ImagePolicyFollow},
+	}
+	if policies.Default != ImagePolicyPrompt || !slices.Equal(policies.Overrides, want) {
+		t.Errorf("policies = %+v, want default prompt and %+v", policies, want)
+	}
+}
@@ -0,0 +1,248 @@
+package store
+
+// postgresMigrations is the schema's history on PostgreSQL. Support for it
+// came with version 8, so its first step creates that schema outright; later
+// steps are appended here as well as to migrations, with the same version.
+var postgresMigrations = []migration{
+	{version: 8, name: "baseline", up: execAll(postgresBaseline...), down: dropTables(postgresTables...)},
+	{version: 9, name: "image policies by container name", up: execAll(imagePolicyNamesUp...), down: execAll(imagePolicyNamesDown...)},
+}
+
+// postgresBaseline is the schema of version 8 in PostgreSQL's types: ids
+// are generated, timestamps keep their zone and counters of bytes and
+// milliseconds are 64-bit.
+var postgresBaseline = []string{
+	`CREATE TABLE selected_containers (
+		host TEXT NOT NULL DEFAULT '',
+		id TEXT NOT NULL,
+		name TEXT NOT NULL DEFAULT '',
+		PRIMARY KEY (host, id)
+	)`,
+	`CREATE INDEX selected_containers_name ON selected_containers (host, name)`,
+	`CREATE TABLE selected_volumes (
+		name TEXT PRIMARY KEY
+	)`,
+	`CREATE TABLE selected_projects (
+		name TEXT PRIMARY KEY
+	)`,
+	`CREATE TABLE selected_networks (
+		name TEXT PRIMARY KEY
+	)`,
+	`CREATE TABLE selected_images (
+		name TEXT PRIMARY KEY
+	)`,
+	`CREATE TABLE selection_rules (
+		id BIGSERIAL PRIMARY KEY,
+		rule TEXT NOT NULL UNIQUE,
+		created_at TIMESTAMPTZ NOT NULL
+	)`,
+	`CREATE TABLE profiles (
+		name TEXT PRIMARY KEY,
+		created_at TIMESTAMPTZ NOT NULL
+	)`,
+	`CREATE TABLE profile_items (
+		profile TEXT NOT NULL,
+		item_type TEXT NOT NULL,
+		item_id TEXT NOT NULL,
+		PRIMARY KEY (profile, item_type, item_id)
+	)`,
+	`CREATE TABLE quiesce_modes (
+		container_id TEXT PRIMARY KEY,
+		mode TEXT NOT NULL
+	)`,
+	`CREATE TABLE start_policies (
+		container_id TEXT PRIMARY KEY,
+		policy TEXT NOT NULL
+	)`,
+	`CREATE TABLE replication_hooks (
+		container_id TEXT PRIMARY KEY,
+		pre_command TEXT NOT NULL DEFAULT '',
+		post_command TEXT NOT NULL DEFAULT '',
+		timeout_seconds INTEGER NOT NULL DEFAULT 0
+	)`,
+	`CREATE TABLE volume_excludes (
+		volume_name TEXT NOT NULL,
+		pattern TEXT NOT NULL,
+		position INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (volume_name, pattern)
+	)`,
+	`CREATE TABLE volume_sync_state (
+		volume TEXT NOT NULL,
+		peer TEXT NOT NULL,
+		path TEXT NOT NULL,
+		hash TEXT NOT NULL,
+		PRIMARY KEY (volume, peer, path)
+	)`,
+	`CREATE TABLE selected_bind_mounts (
+		container_id TEXT NOT NULL,
+		source TEXT NOT NULL,
+		target_path TEXT NOT NULL DEFAULT '',
+		PRIMARY KEY (container_id, source)
+	)`,
+	`CREATE TABLE confirmation_gates (
+		operation TEXT PRIMARY KEY,
+		mode TEXT NOT NULL,
+		phrase TEXT NOT NULL DEFAULT ''
+	)`,
+	`CREATE TABLE approvals (
+		id BIGSERIAL PRIMARY KEY,
+		operation TEXT NOT NULL,
+		requested_by TEXT NOT NULL,
+		approved_by TEXT NOT NULL DEFAULT '',
+		requested_at TIMESTAMPTZ NOT NULL,
+		approved_at TIMESTAMPTZ,
+		consumed INTEGER NOT NULL DEFAULT 0
+	)`,
+	`CREATE TABLE image_policies (
+		container_id TEXT PRIMARY KEY,
+		policy TEXT NOT NULL
+	)`,
+	`CREATE TABLE registry_credentials (
+		name TEXT PRIMARY KEY,
+		server_address TEXT NOT NULL,
+		username TEXT NOT NULL DEFAULT '',
+		password TEXT NOT NULL DEFAULT '',
+		identity_token TEXT NOT NULL DEFAULT ''
+	)`,
+	`CREATE TABLE audit_log (
+		id BIGSERIAL PRIMARY KEY,
+		created_at TIMESTAMPTZ NOT NULL,
+		actor TEXT NOT NULL DEFAULT '',
+		remote_addr TEXT NOT NULL DEFAULT '',
+		action TEXT NOT NULL,
+		target TEXT NOT NULL DEFAULT '',
+		outcome TEXT NOT NULL DEFAULT '',
+		detail TEXT NOT NULL DEFAULT ''
+	)`,
+	`CREATE INDEX audit_log_created_at ON audit_log (created_at)`,
+	`CREATE TABLE inventory_snapshots (
+		id BIGSERIAL PRIMARY KEY,
+		created_at TIMESTAMPTZ NOT NULL,
+		data TEXT NOT NULL
+	)`,
+	`CREATE TABLE replication_reports (
+		job_id TEXT PRIMARY KEY,
+		created_at TIMESTAMPTZ NOT NULL,
+		status TEXT NOT NULL,
+		data TEXT NOT NULL
+	)`,
+	`CREATE TABLE replication_runs (
+		job_id TEXT PRIMARY KEY,
+		request_id TEXT NOT NULL DEFAULT '',
+		profile TEXT NOT NULL DEFAULT '',
+		direction TEXT NOT NULL DEFAULT '',
+		status TEXT NOT NULL,
+		error TEXT NOT NULL DEFAULT '',
+		replicated INTEGER NOT NULL DEFAULT 0,
+		failed INTEGER NOT NULL DEFAULT 0,
+		bytes BIGINT NOT NULL DEFAULT 0,
+		duration_ms BIGINT NOT NULL DEFAULT 0,
+		started_at TIMESTAMPTZ NOT NULL,
+		finished_at TIMESTAMPTZ NOT NULL
+	)`,
+	`CREATE INDEX replication_runs_finished_at ON replication_runs (finished_at)`,
+	`CREATE TABLE replication_run_items (
+		id BIGSERIAL PRIMARY KEY,
+		job_id TEXT NOT NULL,
+		destination TEXT NOT NULL,
+		item_type TEXT NOT NULL,
+		item_name TEXT NOT NULL,
+		status TEXT NOT NULL,
+		error TEXT NOT NULL DEFAULT '',
+		bytes BIGINT NOT NULL DEFAULT 0,
+		duration_ms BIGINT NOT NULL DEFAULT 0
+	)`,
+	`CREATE INDEX replication_run_items_item ON replication_run_items (item_type, item_name)`,
+	`CREATE INDEX replication_run_items_job ON replication_run_items (job_id)`,
+	`CREATE TABLE notes (
+		id BIGSERIAL PRIMARY KEY,
+		target_type TEXT NOT NULL,
+		target_id TEXT NOT NULL,
+		body TEXT NOT NULL,
+		author TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMPTZ NOT NULL
+	)`,
+	`CREATE TABLE tags (
+		target_type TEXT NOT NULL,
+		target_id TEXT NOT NULL,
+		tag TEXT NOT NULL,
+		PRIMARY KEY (target_type, target_id, tag)
+	)`,
+	`CREATE TABLE destinations (
+		name TEXT PRIMARY KEY,
+		url TEXT NOT NULL UNIQUE,
+		auth_token TEXT NOT NULL DEFAULT '',
+		tls_ca_cert TEXT NOT NULL DEFAULT '',
+		tls_server_name TEXT NOT NULL DEFAULT '',
+		tls_insecure_skip_verify BOOLEAN NOT NULL DEFAULT FALSE,
+		enabled BOOLEAN NOT NULL DEFAULT TRUE,
+		created_at TIMESTAMPTZ NOT NULL,
+		updated_at TIMESTAMPTZ NOT NULL,
+		version TEXT NOT NULL DEFAULT '',
+		architecture TEXT NOT NULL DEFAULT '',
+		disk_available BIGINT NOT NULL DEFAULT 0,
+		paired_at TIMESTAMPTZ,
+		last_seen_at TIMESTAMPTZ,
+		last_synced_at TIMESTAMPTZ
+	)`,
+	`CREATE TABLE peer_tokens (
+		id BIGSERIAL PRIMARY KEY,
+		name TEXT NOT NULL,
+		remote_addr TEXT NOT NULL DEFAULT '',
+		token_hash TEXT NOT NULL UNIQUE,
+		created_at TIMESTAMPTZ NOT NULL
+	)`,
+	`CREATE TABLE docker_hosts (
+		name TEXT PRIMARY KEY,
+		address TEXT NOT NULL UNIQUE,
+		tls_ca_cert TEXT NOT NULL DEFAULT '',
+		tls_cert TEXT NOT NULL DEFAULT '',
+		tls_key TEXT NOT NULL DEFAULT '',
+		tls_insecure_skip_verify BOOLEAN NOT NULL DEFAULT FALSE,
+		created_at TIMESTAMPTZ NOT NULL,
+		updated_at TIMESTAMPTZ NOT NULL
+	)`,
+	`CREATE TABLE settings (
+		key TEXT PRIMARY KEY,
+		value TEXT NOT NULL,
+		updated_at TIMESTAMPTZ NOT NULL
+	)`,
+	`CREATE TABLE jobs (
+		id TEXT PRIMARY KEY,
+		type TEXT NOT NULL,
+		payload TEXT NOT NULL DEFAULT '',
+		state TEXT NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		max_attempts INTEGER NOT NULL DEFAULT 1,
+		last_error TEXT NOT NULL DEFAULT '',
+		worker TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMPTZ NOT NULL,
+		updated_at TIMESTAMPTZ NOT NULL,
+		run_after TIMESTAMPTZ NOT NULL,
+		heartbeat_at TIMESTAMPTZ,
+		finished_at TIMESTAMPTZ
+	)`,
+	`CREATE INDEX jobs_state_run_after ON jobs (state, run_after)`,
+}
+
+// postgresTables are the tables postgresBaseline creates.
+var postgresTables = []string{
+	"selected_containers", "selected_volumes", "selected_projects", "selected_networks", "selected_images",
+	"selection_rules", "profiles", "profile_items", "quiesce_modes", "start_policies", "replication_hooks",
+	"volume_excludes", "volume_sync_state", "selected_bind_mounts", "confirmation_gates", "approvals",
+	"image_policies", "registry_credentials", "audit_log", "inventory_snapshots", "replication_reports",
+	"replication_runs", "replication_run_items", "notes", "tags", "destinations", "peer_tokens",
+	"docker_hosts", "settings", "jobs",
+}
+
+// dropTables returns a step that drops each table, with its indexes.
+func dropTables(tables ...string) func(tx *sqlTx) error {
+	return func(tx *sqlTx) error {
+		for _, table := range tables {
+			if _, err := tx.Exec("DROP TABLE " + table); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
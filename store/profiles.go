@@ -0,0 +1,151 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrProfileNotFound is returned when a profile name does not exist.
+var ErrProfileNotFound = errors.New("profile not found")
+
+// Item types a profile can hold.
+const (
+	ProfileContainer = "container"
+	ProfileVolume    = "volume"
+	ProfileProject   = "project"
+	ProfileNetwork   = "network"
+	ProfileImage     = "image"
+)
+
+// Profile is a named set of containers, volumes, networks, images and
+// compose projects that can be replicated instead of the global selection.
+type Profile struct {
+	Name       string   `json:"name"`
+	Containers []string `json:"containers"` // container IDs
+	Volumes    []string `json:"volumes"`
+	Projects   []string `json:"projects"`
+	Networks   []string `json:"networks"`
+	Images     []string `json:"images"` // image references such as nginx:1.25
+}
+
+// GetProfiles retrieves every profile with its items, ordered by name.
+func (s *SQLStore) GetProfiles() ([]Profile, error) {
+	rows, err := s.db.Query(`
+	SELECT p.name, i.item_type, i.item_id
+	FROM profiles p LEFT JOIN profile_items i ON i.profile = p.name
+	ORDER BY p.name, i.item_type, i.item_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var profiles []Profile
+	for rows.Next() {
+		var name string
+		var itemType, itemID *string
+		if err := rows.Scan(&name, &itemType, &itemID); err != nil {
+			return nil, err
+		}
+		if len(profiles) == 0 || profiles[len(profiles)-1].Name != name {
+			profiles = append(profiles, Profile{Name: name, Containers: []string{}, Volumes: []string{}, Projects: []string{}, Networks: []string{}, Images: []string{}})
+		}
+		if itemType != nil {
+			profiles[len(profiles)-1].add(*itemType, *itemID)
+		}
+	}
+	return profiles, rows.Err()
+}
+
+// GetProfile retrieves one profile with its items.
+func (s *SQLStore) GetProfile(name string) (*Profile, error) {
+	var exists int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM profiles WHERE name = ?", name).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if exists == 0 {
+		return nil, ErrProfileNotFound
+	}
+
+	rows, err := s.db.Query("SELECT item_type, item_id FROM profile_items WHERE profile = ? ORDER BY item_type, item_id", name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	p := &Profile{Name: name, Containers: []string{}, Volumes: []string{}, Projects: []string{}, Networks: []string{}, Images: []string{}}
+	for rows.Next() {
+		var itemType, itemID string
+		if err := rows.Scan(&itemType, &itemID); err != nil {
+			return nil, err
+		}
+		p.add(itemType, itemID)
+	}
+	return p, rows.Err()
+}
+
+func (p *Profile) add(itemType, itemID string) {
+	switch itemType {
+	case ProfileContainer:
+		p.Containers = append(p.Containers, itemID)
+	case ProfileVolume:
+		p.Volumes = append(p.Volumes, itemID)
+	case ProfileProject:
+		p.Projects = append(p.Projects, itemID)
+	case ProfileNetwork:
+		p.Networks = append(p.Networks, itemID)
+	case ProfileImage:
+		p.Images = append(p.Images, itemID)
+	}
+}
+
+// SaveProfile creates or replaces a profile and its items.
+func (s *SQLStore) SaveProfile(p Profile) error {
+	if p.Name == "" {
+		return fmt.Errorf("profile name is required")
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("database operation failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("INSERT INTO profiles (name, created_at) VALUES (?, ?) ON CONFLICT DO NOTHING", p.Name, time.Now().UTC()); err != nil {
+		return fmt.Errorf("database operation failed: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM profile_items WHERE profile = ?", p.Name); err != nil {
+		return fmt.Errorf("database operation failed: %w", err)
+	}
+	items := map[string][]string{ProfileContainer: p.Containers, ProfileVolume: p.Volumes, ProfileProject: p.Projects, ProfileNetwork: p.Networks, ProfileImage: p.Images}
+	for itemType, ids := range items {
+		for _, id := range ids {
+			if _, err := tx.Exec("INSERT INTO profile_items (profile, item_type, item_id) VALUES (?, ?, ?) ON CONFLICT DO NOTHING", p.Name, itemType, id); err != nil {
+				return fmt.Errorf("database operation failed: %w", err)
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("database operation failed: %w", err)
+	}
+	return nil
+}
+
+// DeleteProfile removes a profile and its items.
+func (s *SQLStore) DeleteProfile(name string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("database operation failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM profile_items WHERE profile = ?", name); err != nil {
+		return fmt.Errorf("database operation failed: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM profiles WHERE name = ?", name); err != nil {
+		return fmt.Errorf("database operation failed: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("database operation failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package store
+
+import (
+	"fmt"
+)
+
+// Quiesce modes applied to a source container while its volumes are copied.
+const (
+	QuiesceNone  = "none"
+	QuiescePause = "pause"
+	QuiesceStop  = "stop"
+)
+
+// GetQuiesceModes retrieves the quiesce mode of every container that has one set.
+func (s *SQLStore) GetQuiesceModes() (map[string]string, error) {
+	rows, err := s.db.Query("SELECT container_id, mode FROM quiesce_modes")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	modes := make(map[string]string)
+	for rows.Next() {
+		var id, mode string
+		if err := rows.Scan(&id, &mode); err != nil {
+			return nil, err
+		}
+		modes[id] = mode
+	}
+	return modes, rows.Err()
+}
+
+// SetQuiesceMode sets the quiesce mode for a container. QuiesceNone or an
+// empty mode removes the setting.
+func (s *SQLStore) SetQuiesceMode(containerID, mode string) error {
+	if containerID == "" {
+		return fmt.Errorf("container ID is required")
+	}
+
+	var err error
+	switch mode {
+	case "", QuiesceNone:
+		_, err = s.db.Exec("DELETE FROM quiesce_modes WHERE container_id = ?", containerID)
+	case QuiescePause, QuiesceStop:
+		_, err = s.db.Exec("INSERT INTO quiesce_modes (container_id, mode) VALUES (?, ?) ON CONFLICT(container_id) DO UPDATE SET mode = excluded.mode", containerID, mode)
+	default:
+		return fmt.Errorf("invalid quiesce mode: %s", mode)
+	}
+	if err != nil {
+		return fmt.Errorf("database operation failed: %w", err)
+	}
+	return nil
+}
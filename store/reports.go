@@ -0,0 +1,63 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrReportNotFound is returned when no report exists for a job ID.
+var ErrReportNotFound = errors.New("report not found")
+
+// Report is the stored result of one replication job, kept as JSON.
+type Report struct {
+	JobID     string    `json:"jobId"`
+	CreatedAt time.Time `json:"createdAt"`
+	Status    string    `json:"status"`
+	Data      string    `json:"-"`
+}
+
+// SaveReport stores the report of a finished replication job.
+func (s *SQLStore) SaveReport(jobID, status, data string) error {
+	_, err := s.db.Exec(`INSERT INTO replication_reports (job_id, created_at, status, data) VALUES (?, ?, ?, ?)
+		ON CONFLICT(job_id) DO UPDATE SET created_at = excluded.created_at, status = excluded.status, data = excluded.data`,
+		jobID, time.Now().UTC(), status, data)
+	if err != nil {
+		return fmt.Errorf("database operation failed: %w", err)
+	}
+	return nil
+}
+
+// GetReports lists stored reports, newest first, without their data.
+func (s *SQLStore) GetReports(limit int) ([]Report, error) {
+	rows, err := s.db.Query("SELECT job_id, created_at, status FROM replication_reports ORDER BY created_at DESC LIMIT ?", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reports []Report
+	for rows.Next() {
+		var rep Report
+		if err := rows.Scan(&rep.JobID, &rep.CreatedAt, &rep.Status); err != nil {
+			return nil, err
+		}
+		reports = append(reports, rep)
+	}
+	return reports, rows.Err()
+}
+
+// GetReport retrieves the report of a job including its data.
+func (s *SQLStore) GetReport(jobID string) (*Report, error) {
+	var rep Report
+	err := s.db.QueryRow("SELECT job_id, created_at, status, data FROM replication_reports WHERE job_id = ?", jobID).
+		Scan(&rep.JobID, &rep.CreatedAt, &rep.Status, &rep.Data)
+	if err == sql.ErrNoRows {
+		return nil, ErrReportNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &rep, nil
+}
@@ -0,0 +1,58 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrRuleNotFound is returned when a selection rule does not exist.
+var ErrRuleNotFound = errors.New("selection rule not found")
+
+// SelectionRule selects every container it matches, e.g. "label:backup=true".
+type SelectionRule struct {
+	ID        int64     `json:"id"`
+	Rule      string    `json:"rule"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// GetSelectionRules retrieves all selection rules, oldest first.
+func (s *SQLStore) GetSelectionRules() ([]SelectionRule, error) {
+	rows, err := s.db.Query("SELECT id, rule, created_at FROM selection_rules ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []SelectionRule
+	for rows.Next() {
+		var r SelectionRule
+		if err := rows.Scan(&r.ID, &r.Rule, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+	return rules, rows.Err()
+}
+
+// AddSelectionRule stores a selection rule and returns its ID.
+func (s *SQLStore) AddSelectionRule(rule string) (int64, error) {
+	var id int64
+	err := s.db.QueryRow("INSERT INTO selection_rules (rule, created_at) VALUES (?, ?) RETURNING id", rule, time.Now().UTC()).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("database operation failed: %w", err)
+	}
+	return id, nil
+}
+
+// DeleteSelectionRule removes a selection rule.
+func (s *SQLStore) DeleteSelectionRule(id int64) error {
+	res, err := s.db.Exec("DELETE FROM selection_rules WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("database operation failed: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrRuleNotFound
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Run is one replication or failback job: what it was asked to do and how
+// it ended, totalled over its items.
+type Run struct {
+	JobID      string    `json:"jobId"`
+	RequestID  string    `json:"requestId,omitempty"`
+	Profile    string    `json:"profile,omitempty"`
+	Direction  string    `json:"direction,omitempty"` // "failback" for reverse runs
+	Status     string    `json:"status"`
+	Error      string    `json:"error,omitempty"` // destinations nothing was attempted on, and why
+	Replicated int       `json:"replicated"`
+	Failed     int       `json:"failed"`
+	Bytes      int64     `json:"bytes"`
+	DurationMs int64     `json:"durationMs"`
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+}
+
+// RunItem is the outcome of one item on one destination in a run.
+type RunItem struct {
+	ID          int64  `json:"id"`
+	JobID       string `json:"jobId"`
+	Destination string `json:"destination"`
+	Type        string `json:"type"` // network, volume, image or container
+	Name        string `json:"name"`
+	Status      string `json:"status"`
+	Error       string `json:"error,omitempty"`
+	Bytes       int64  `json:"bytes"`
+	DurationMs  int64  `json:"durationMs"`
+}
+
+// RunFilter narrows GetRuns. Empty fields match everything.
+type RunFilter struct {
+	Profile   string
+	Direction string
+	Status    string
+	Since     time.Time
+	Limit     int
+}
+
+const (
+	runColumns     = "job_id, request_id, profile, direction, status, error, replicated, failed, bytes, duration_ms, started_at, finished_at"
+	runItemColumns = "id, job_id, destination, item_type, item_name, status, error, bytes, duration_ms"
+)
+
+// RecordRun stores a finished run and its items in one transaction. A run
+// recorded again under the same job ID replaces the earlier one.
+func (s *SQLStore) RecordRun(run Run, items []RunItem) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("database operation failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`INSERT INTO replication_runs (`+runColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(job_id) DO UPDATE SET request_id = excluded.request_id, profile = excluded.profile, direction = excluded.direction,
+			status = excluded.status, error = excluded.error, replicated = excluded.replicated, failed = excluded.failed, bytes = excluded.bytes,
+			duration_ms = excluded.duration_ms, started_at = excluded.started_at, finished_at = excluded.finished_at`,
+		run.JobID, run.RequestID, run.Profile, run.Direction, run.Status, run.Error, run.Replicated, run.Failed, run.Bytes, run.DurationMs,
+		run.StartedAt.UTC(), run.FinishedAt.UTC())
+	if err != nil {
+		return fmt.Errorf("database operation failed: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM replication_run_items WHERE job_id = ?", run.JobID); err != nil {
+		return fmt.Errorf("database operation failed: %w", err)
+	}
+	for _, item := range items {
+		_, err := tx.Exec("INSERT INTO replication_run_items (job_id, destination, item_type, item_name, status, error, bytes, duration_ms) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+			run.JobID, item.Destination, item.Type, item.Name, item.Status, item.Error, item.Bytes, item.DurationMs)
+		if err != nil {
+			return fmt.Errorf("database operation failed: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("database operation failed: %w", err)
+	}
+	return nil
+}
+
+// GetRuns lists recorded runs matching f, newest first.
+func (s *SQLStore) GetRuns(f RunFilter) ([]Run, error) {
+	var conds []string
+	var args []interface{}
+	for _, c := range []struct {
+		column, value string
+	}{
+		{"profile", f.Profile},
+		{"direction", f.Direction},
+		{"status", f.Status},
+	} {
+		if c.value != "" {
+			conds = append(conds, c.column+" = ?")
+			args = append(args, c.value)
+		}
+	}
+	if !f.Since.IsZero() {
+		conds = append(conds, "finished_at >= ?")
+		args = append(args, f.Since.UTC())
+	}
+	query := "SELECT " + runColumns + " FROM replication_runs"
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	query += " ORDER BY finished_at DESC"
+	if f.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, f.Limit)
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var runs []Run
+	for rows.Next() {
+		var r Run
+		if err := rows.Scan(&r.JobID, &r.RequestID, &r.Profile, &r.Direction, &r.Status, &r.Error, &r.Replicated, &r.Failed, &r.Bytes, &r.DurationMs, &r.StartedAt, &r.FinishedAt); err != nil {
+			return nil, err
+		}
+		runs = append(runs, r)
+	}
+	return runs, rows.Err()
+}
+
+// GetRunItems lists the items of one run, in the order they were recorded.
+func (s *SQLStore) GetRunItems(jobID string) ([]RunItem, error) {
+	rows, err := s.db.Query("SELECT "+runItemColumns+" FROM replication_run_items WHERE job_id = ? ORDER BY id", jobID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []RunItem
+	for rows.Next() {
+		var i RunItem
+		if err := rows.Scan(&i.ID, &i.JobID, &i.Destination, &i.Type, &i.Name, &i.Status, &i.Error, &i.Bytes, &i.DurationMs); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	return items, rows.Err()
+}
@@ -0,0 +1,52 @@
+package store
+
+import (
+	"fmt"
+	"time"
+)
+
+// GetSettings retrieves every stored setting, keyed by name. Settings that
+// were never set, or were reset, are absent and take their defaults.
+func (s *SQLStore) GetSettings() (map[string]string, error) {
+	rows, err := s.db.Query("SELECT key, value FROM settings")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	settings := make(map[string]string)
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, err
+		}
+		settings[key] = value
+	}
+	return settings, rows.Err()
+}
+
+// UpdateSettings stores several settings in one transaction. A nil value
+// removes the setting, so it takes its default again.
+func (s *SQLStore) UpdateSettings(changes map[string]*string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("database operation failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	for key, value := range changes {
+		if value == nil {
+			_, err = tx.Exec("DELETE FROM settings WHERE key = ?", key)
+		} else {
+			_, err = tx.Exec("INSERT INTO settings (key, value, updated_at) VALUES (?, ?, ?) ON CONFLICT(key) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at", key, *value, now)
+		}
+		if err != nil {
+			return fmt.Errorf("database operation failed: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("database operation failed: %w", err)
+	}
+	return nil
+}
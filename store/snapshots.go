@@ -0,0 +1,69 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrSnapshotNotFound is returned when a snapshot ID does not exist.
+var ErrSnapshotNotFound = errors.New("snapshot not found")
+
+// Snapshot is a point-in-time copy of the host inventory, stored as JSON.
+type Snapshot struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	Data      string    `json:"-"`
+}
+
+// SaveSnapshot stores an inventory snapshot and returns its ID.
+func (s *SQLStore) SaveSnapshot(data string) (int64, error) {
+	var id int64
+	err := s.db.QueryRow("INSERT INTO inventory_snapshots (created_at, data) VALUES (?, ?) RETURNING id", time.Now().UTC(), data).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("database operation failed: %w", err)
+	}
+	return id, nil
+}
+
+// GetSnapshots lists stored snapshots, newest first, without their data.
+func (s *SQLStore) GetSnapshots() ([]Snapshot, error) {
+	rows, err := s.db.Query("SELECT id, created_at FROM inventory_snapshots ORDER BY id DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var snapshots []Snapshot
+	for rows.Next() {
+		var snap Snapshot
+		if err := rows.Scan(&snap.ID, &snap.CreatedAt); err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, snap)
+	}
+	return snapshots, rows.Err()
+}
+
+// GetSnapshot retrieves a snapshot including its data.
+func (s *SQLStore) GetSnapshot(id int64) (*Snapshot, error) {
+	var snap Snapshot
+	err := s.db.QueryRow("SELECT id, created_at, data FROM inventory_snapshots WHERE id = ?", id).
+		Scan(&snap.ID, &snap.CreatedAt, &snap.Data)
+	if err == sql.ErrNoRows {
+		return nil, ErrSnapshotNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &snap, nil
+}
+
+// PruneSnapshots deletes snapshots taken before cutoff.
+func (s *SQLStore) PruneSnapshots(cutoff time.Time) error {
+	if _, err := s.db.Exec("DELETE FROM inventory_snapshots WHERE created_at < ?", cutoff.UTC()); err != nil {
+		return fmt.Errorf("database operation failed: %w", err)
+	}
+	return nil
+}
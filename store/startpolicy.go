@@ -0,0 +1,53 @@
+package store
+
+import (
+	"fmt"
+)
+
+// Start policies for a replica on the destination.
+const (
+	StartCreated = "created" // created and never started until failover (cold standby)
+	StartStopped = "stopped" // started once so it initialises, then stopped
+	StartRunning = "running" // started right away (warm standby)
+)
+
+// GetStartPolicies retrieves the start policy of every container that has one set.
+func (s *SQLStore) GetStartPolicies() (map[string]string, error) {
+	rows, err := s.db.Query("SELECT container_id, policy FROM start_policies")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	policies := make(map[string]string)
+	for rows.Next() {
+		var id, policy string
+		if err := rows.Scan(&id, &policy); err != nil {
+			return nil, err
+		}
+		policies[id] = policy
+	}
+	return policies, rows.Err()
+}
+
+// SetStartPolicy sets the start policy for a container's replica.
+// StartCreated or an empty policy removes the setting.
+func (s *SQLStore) SetStartPolicy(containerID, policy string) error {
+	if containerID == "" {
+		return fmt.Errorf("container ID is required")
+	}
+
+	var err error
+	switch policy {
+	case "", StartCreated:
+		_, err = s.db.Exec("DELETE FROM start_policies WHERE container_id = ?", containerID)
+	case StartStopped, StartRunning:
+		_, err = s.db.Exec("INSERT INTO start_policies (container_id, policy) VALUES (?, ?) ON CONFLICT(container_id) DO UPDATE SET policy = excluded.policy", containerID, policy)
+	default:
+		return fmt.Errorf("invalid start policy: %s", policy)
+	}
+	if err != nil {
+		return fmt.Errorf("database operation failed: %w", err)
+	}
+	return nil
+}
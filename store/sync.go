@@ -0,0 +1,47 @@
+package store
+
+import (
+	"fmt"
+)
+
+// GetSyncBase retrieves the file hashes of a volume as of its last two-way
+// sync with peer, keyed by path inside the volume.
+func (s *SQLStore) GetSyncBase(volume, peer string) (map[string]string, error) {
+	rows, err := s.db.Query("SELECT path, hash FROM volume_sync_state WHERE volume = ? AND peer = ?", volume, peer)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	base := make(map[string]string)
+	for rows.Next() {
+		var path, hash string
+		if err := rows.Scan(&path, &hash); err != nil {
+			return nil, err
+		}
+		base[path] = hash
+	}
+	return base, rows.Err()
+}
+
+// SaveSyncBase replaces the recorded sync state of a volume with peer.
+func (s *SQLStore) SaveSyncBase(volume, peer string, base map[string]string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("database operation failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM volume_sync_state WHERE volume = ? AND peer = ?", volume, peer); err != nil {
+		return fmt.Errorf("database operation failed: %w", err)
+	}
+	for path, hash := range base {
+		if _, err := tx.Exec("INSERT INTO volume_sync_state (volume, peer, path, hash) VALUES (?, ?, ?, ?)", volume, peer, path, hash); err != nil {
+			return fmt.Errorf("database operation failed: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("database operation failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,10 @@
+// Package templates embeds the web UI's HTML templates, so the binary serves
+// the UI from any working directory.
+package templates
+
+import "embed"
+
+// FS holds the templates, named by file name, e.g. "index.html".
+//
+//go:embed *.html
+var FS embed.FS
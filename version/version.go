@@ -0,0 +1,52 @@
+// Package version holds the build metadata of the binary. The values are set
+// at build time with -ldflags, for example
+//
+//	go build -ldflags "-X dockerap/version.Version=1.4.0 -X dockerap/version.Commit=$(git rev-parse HEAD)"
+//
+// and fall back to the VCS information Go embeds when they are not.
+package version
+
+import (
+	"runtime/debug"
+	"sync"
+)
+
+var (
+	// Version is the semantic version of the release.
+	Version = "dev"
+	// Commit is the git commit the binary was built from.
+	Commit = ""
+	// BuildDate is when the binary was built, in RFC 3339 format.
+	BuildDate = ""
+)
+
+var fillOnce sync.Once
+
+// fill copies the VCS revision and time from the embedded build info into
+// Commit and BuildDate when -ldflags did not set them.
+func fill() {
+	fillOnce.Do(func() {
+		info, ok := debug.ReadBuildInfo()
+		if !ok {
+			return
+		}
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if Commit == "" {
+					Commit = setting.Value
+				}
+			case "vcs.time":
+				if BuildDate == "" {
+					BuildDate = setting.Value
+				}
+			}
+		}
+	})
+}
+
+// Info returns the commit and build date, filled in from the embedded build info if needed.
+func Info() (commit, buildDate string) {
+	fill()
+	return Commit, BuildDate
+}